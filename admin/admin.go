@@ -0,0 +1,55 @@
+// Package admin serves the administration API: HTTP endpoints for
+// inspecting and controlling the running server, such as draining
+// proxy upstreams during a deployment. Packages register their
+// endpoints with Handle or HandleFunc, usually in an init function.
+//
+// The API has no authentication of its own, so it is only served
+// when an address is given, and that address should be reachable
+// only by trusted clients (like localhost).
+package admin
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+)
+
+var mux = http.NewServeMux()
+
+func init() {
+	mux.Handle("/debug/vars", expvar.Handler())
+}
+
+// Handle registers handler for the admin API path pattern.
+func Handle(pattern string, handler http.Handler) {
+	mux.Handle(pattern, handler)
+}
+
+// HandleFunc registers handler for the admin API path pattern.
+func HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	mux.HandleFunc(pattern, handler)
+}
+
+// Handler returns the handler that serves the admin API.
+func Handler() http.Handler {
+	return mux
+}
+
+// ListenAndServe serves the admin API on addr. It blocks
+// until the listener fails.
+func ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, mux)
+}
+
+// WriteJSON writes v to w as JSON with the given status code.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Error writes an error response with a JSON body
+// like {"error": "message"}.
+func Error(w http.ResponseWriter, status int, message string) {
+	WriteJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	HandleFunc("/test/hello", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, map[string]string{"hello": "world"})
+	})
+	HandleFunc("/test/fail", func(w http.ResponseWriter, r *http.Request) {
+		Error(w, http.StatusBadRequest, "no good")
+	})
+
+	for i, test := range []struct {
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"/test/hello", http.StatusOK, `{"hello":"world"}`},
+		{"/test/fail", http.StatusBadRequest, `{"error":"no good"}`},
+		{"/debug/vars", http.StatusOK, `"memstats"`},
+		{"/nothing", http.StatusNotFound, ""},
+	} {
+		req, _ := http.NewRequest("GET", test.path, nil)
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, req)
+
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectedBody) {
+			t.Errorf("Test %d: Expected body to contain %s, got %s", i, test.expectedBody, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Package dashboard serves a status page on the admin API, at
+// /dashboard, with each site's request rate, responses by status
+// class, requests in flight and certificate expiry, the open
+// connections of each server, and the health of proxy upstreams.
+package dashboard
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy/admin"
+	"github.com/mholt/caddy/app"
+	"github.com/mholt/caddy/middleware/proxy"
+	"github.com/mholt/caddy/server"
+)
+
+func init() {
+	admin.HandleFunc("/dashboard", serveDashboard)
+}
+
+// Page is what the dashboard template is executed with.
+type Page struct {
+	Generated time.Time
+	Refresh   int // seconds between reloads of the page; 0 for none
+	Servers   []Server
+	Upstreams []proxy.UpstreamStatus
+}
+
+// Server is a server and the sites it serves.
+type Server struct {
+	Address     string
+	Connections int64
+	Sites       []server.SiteStats
+}
+
+// collect gathers the state of the running servers.
+func collect(now time.Time) Page {
+	page := Page{Generated: now}
+
+	app.ServersMutex.Lock()
+	servers := app.Servers
+	app.ServersMutex.Unlock()
+	for _, s := range servers {
+		page.Servers = append(page.Servers, Server{
+			Address:     s.Address(),
+			Connections: s.Connections(),
+			Sites:       s.Stats(),
+		})
+	}
+	sort.Slice(page.Servers, func(i, j int) bool {
+		return page.Servers[i].Address < page.Servers[j].Address
+	})
+
+	page.Upstreams = proxy.Hosts()
+	sort.Slice(page.Upstreams, func(i, j int) bool {
+		a, b := page.Upstreams[i], page.Upstreams[j]
+		if a.Site != b.Site {
+			return a.Site < b.Site
+		}
+		return a.Host < b.Host
+	})
+	return page
+}
+
+// DefaultRefresh is how often the page reloads itself,
+// unless the request's refresh parameter says otherwise.
+const DefaultRefresh = 5
+
+func serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		admin.Error(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	page := collect(time.Now())
+	page.Refresh = DefaultRefresh
+	if refresh := r.URL.Query().Get("refresh"); refresh != "" {
+		n, err := strconv.Atoi(refresh)
+		if err != nil || n < 0 {
+			admin.Error(w, http.StatusBadRequest, "invalid refresh '"+refresh+"'")
+			return
+		}
+		page.Refresh = n
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := dashboardTemplate.Execute(w, page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// certWarning is how soon before a certificate expires the
+// dashboard points it out.
+const certWarning = 14 * 24 * time.Hour
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"rate": func(r float64) string {
+		return strconv.FormatFloat(r, 'f', 2, 64)
+	},
+	"expiry": func(now, t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		left := t.Sub(now)
+		if left <= 0 {
+			return "expired " + t.Format("2006-01-02")
+		}
+		return t.Format("2006-01-02") + " (" + strconv.Itoa(int(left.Hours()/24)) + " days)"
+	},
+	"expiring": func(now, t time.Time) bool {
+		return !t.IsZero() && t.Sub(now) < certWarning
+	},
+}).Parse(dashboardHTML))
+
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Caddy dashboard</title>
+{{if .Refresh}}<meta http-equiv="refresh" content="{{.Refresh}}">{{end}}
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { padding: .3em .8em; border-bottom: 1px solid #ddd; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.bad { color: #b00; font-weight: bold; }
+.muted { color: #888; }
+</style>
+</head>
+<body>
+<h1>Caddy dashboard</h1>
+<p class="muted">Generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}</p>
+{{$now := .Generated}}
+{{range .Servers}}
+<h2>{{.Address}} <span class="muted">({{.Connections}} connections open)</span></h2>
+<table>
+<tr><th>Site</th><th>Requests/s</th><th>Requests</th><th>In flight</th><th>1xx</th><th>2xx</th><th>3xx</th><th>4xx</th><th>5xx</th><th>Certificate expires</th></tr>
+{{range .Sites}}
+<tr>
+<td>{{.Site}}</td>
+<td>{{rate .Rate}}</td>
+<td>{{.Requests}}</td>
+<td>{{.Active}}</td>
+{{range $i, $n := .Statuses}}<td{{if and (eq $i 4) $n}} class="bad"{{end}}>{{$n}}</td>{{end}}
+<td{{if expiring $now .CertExpiry}} class="bad"{{end}}>{{expiry $now .CertExpiry}}</td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p>No servers are running.</p>
+{{end}}
+{{if .Upstreams}}
+<h2>Proxy upstreams</h2>
+<table>
+<tr><th>Site</th><th>Path</th><th>Host</th><th>Connections</th><th>Fails</th><th>State</th></tr>
+{{range .Upstreams}}
+<tr>
+<td>{{.Site}}</td>
+<td>{{.From}}</td>
+<td>{{.Host}}</td>
+<td>{{.Conns}}</td>
+<td>{{.Fails}}</td>
+<td>{{if .Draining}}draining{{else if .Unhealthy}}<span class="bad">unhealthy</span>{{else if .Fails}}<span class="bad">failing</span>{{else}}healthy{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`
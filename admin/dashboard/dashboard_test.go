@@ -0,0 +1,53 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/app"
+	"github.com/mholt/caddy/server"
+)
+
+func TestDashboard(t *testing.T) {
+	s, err := server.New("127.0.0.1:0", []server.Config{{Host: "localhost", Port: "2015", Root: "."}})
+	if err != nil {
+		t.Fatalf("Expected no error creating server, got: %v", err)
+	}
+	r, _ := http.NewRequest("GET", "http://localhost/missing", nil)
+	s.ServeHTTP(httptest.NewRecorder(), r)
+
+	app.ServersMutex.Lock()
+	app.Servers = append(app.Servers, s)
+	app.ServersMutex.Unlock()
+	defer func() {
+		app.ServersMutex.Lock()
+		app.Servers = app.Servers[:len(app.Servers)-1]
+		app.ServersMutex.Unlock()
+	}()
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/dashboard?refresh=0", nil)
+	serveDashboard(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	body := rec.Body.String()
+	for _, expected := range []string{"<h2>127.0.0.1:0 ", "<td>localhost:2015</td>", "<td>1</td>"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected dashboard to contain %q, got:\n%s", expected, body)
+		}
+	}
+	if strings.Contains(body, `http-equiv="refresh"`) {
+		t.Error("Expected no refresh with refresh=0")
+	}
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/dashboard?refresh=soon", nil)
+	serveDashboard(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a bad refresh, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
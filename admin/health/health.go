@@ -0,0 +1,48 @@
+// Package health serves a health check on the admin API, at
+// /health, for load balancers and orchestrators to tell when
+// the server is ready for traffic: it answers 503 Service
+// Unavailable while any site is still being warmed up (see
+// the warmup directive), and 200 OK once all of them are.
+package health
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/mholt/caddy/admin"
+	"github.com/mholt/caddy/app"
+)
+
+func init() {
+	admin.HandleFunc("/health", serveHealth)
+}
+
+// Status is the body of a health check response.
+type Status struct {
+	Ready   bool     `json:"ready"`
+	Warming []string `json:"warming,omitempty"` // sites being warmed up
+}
+
+func serveHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		admin.Error(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	app.ServersMutex.Lock()
+	servers := app.Servers
+	app.ServersMutex.Unlock()
+
+	var status Status
+	for _, s := range servers {
+		status.Warming = append(status.Warming, s.Warming()...)
+	}
+	sort.Strings(status.Warming)
+	status.Ready = len(status.Warming) == 0
+
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	admin.WriteJSON(w, code, status)
+}
@@ -0,0 +1,41 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/admin"
+	"github.com/mholt/caddy/app"
+	"github.com/mholt/caddy/server"
+)
+
+func TestHealth(t *testing.T) {
+	s, err := server.New("127.0.0.1:0", []server.Config{
+		{Host: "localhost", Port: "2015", Root: ".", Warmup: []string{"/"}},
+		{Host: "127.0.0.1", Port: "2015", Root: "."},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error creating server, got: %v", err)
+	}
+
+	app.ServersMutex.Lock()
+	app.Servers = append(app.Servers, s)
+	app.ServersMutex.Unlock()
+	defer func() {
+		app.ServersMutex.Lock()
+		app.Servers = app.Servers[:len(app.Servers)-1]
+		app.ServersMutex.Unlock()
+	}()
+
+	// not served yet, so localhost isn't warmed up
+	rec := httptest.NewRecorder()
+	admin.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d while warming up, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"warming":["localhost:2015"]`) {
+		t.Errorf("Expected localhost:2015 to be warming up, got %s", rec.Body.String())
+	}
+}
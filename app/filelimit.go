@@ -0,0 +1,41 @@
+package app
+
+import "expvar"
+
+// FileLimit is the soft and hard limit on the number of files
+// the process may have open, as of the last call to
+// CheckFileLimit. Both are zero if the limits are unknown.
+// It is published with the expvar package as "file_limit".
+var FileLimit struct {
+	Soft, Hard uint64
+}
+
+func init() {
+	expvar.Publish("file_limit", expvar.Func(func() interface{} {
+		return FileLimit
+	}))
+}
+
+// CheckFileLimit makes sure the process may open at least need
+// files, raising the soft limit as far as the hard limit allows
+// if it is too low. It returns false if the limit is still lower
+// than need; if the limit can't be determined, it returns true.
+func CheckFileLimit(need uint64) bool {
+	soft, hard, err := getFileLimit()
+	if err != nil {
+		return true
+	}
+
+	if soft < need {
+		raised := need
+		if raised > hard {
+			raised = hard
+		}
+		if setFileLimit(raised, hard) == nil {
+			soft = raised
+		}
+	}
+
+	FileLimit.Soft, FileLimit.Hard = soft, hard
+	return soft >= need
+}
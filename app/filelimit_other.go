@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package app
+
+import "errors"
+
+func getFileLimit() (soft, hard uint64, err error) {
+	return 0, 0, errors.New("file limit not supported on this platform")
+}
+
+func setFileLimit(soft, hard uint64) error {
+	return errors.New("file limit not supported on this platform")
+}
@@ -0,0 +1,16 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package app
+
+import "syscall"
+
+func getFileLimit() (soft, hard uint64, err error) {
+	var lim syscall.Rlimit
+	err = syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim)
+	return lim.Cur, lim.Max, err
+}
+
+func setFileLimit(soft, hard uint64) error {
+	return syscall.Setrlimit(syscall.RLIMIT_NOFILE, &syscall.Rlimit{Cur: soft, Max: hard})
+}
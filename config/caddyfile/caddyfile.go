@@ -0,0 +1,180 @@
+// Package caddyfile provides a syntax tree for Caddyfiles which can be
+// built up in code or parsed from text, modified, and written back out.
+// Unlike the parse package, which only organizes tokens for the
+// directives' setup functions, this package keeps the whole structure
+// of the file, including comments, so that tools can edit a
+// Caddyfile without losing what a person wrote in it.
+//
+// Building a Caddyfile looks like this:
+//
+//	f := new(caddyfile.File)
+//	site := f.Add("example.com", "www.example.com")
+//	site.Add("root", "/srv/example")
+//	site.Add("gzip")
+//	site.Add("errors").Add("404", "404.html")
+//	fmt.Print(f)
+//
+// This package only checks the structure of a Caddyfile; it doesn't
+// know which directives exist or what their arguments mean.
+package caddyfile
+
+import "bytes"
+
+// File is a whole Caddyfile.
+type File struct {
+	// The server blocks, in order
+	Blocks []*Block
+
+	// Comment lines after the last block
+	Comments []string
+}
+
+// Block is a server block: one or more site addresses and the
+// directives that configure them. A Block without any addresses
+// holds top-level lines that aren't part of a site, such as import.
+type Block struct {
+	// Comment lines above the block
+	Comments []string
+
+	// The site addresses, as written (e.g. "localhost:2015")
+	Addresses []string
+
+	// The directives in the block, in order
+	Directives []*Directive
+
+	// Comment lines just before the block's closing brace
+	EndComments []string
+
+	bare bool // written without braces (only possible if it's the only site)
+}
+
+// Directive is one line of a Caddyfile inside a server block,
+// with its own block of lines if it has one. Lines in a directive's
+// block (often called subdirectives or properties) are Directives too.
+type Directive struct {
+	// Comment lines above the directive
+	Comments []string
+
+	// The directive's name; the first token on the line
+	Name string
+
+	// The rest of the tokens on the line, unquoted
+	Args []string
+
+	// A comment at the end of the line, if any
+	Comment string
+
+	// The lines in the directive's block; nil if the directive
+	// doesn't have a block (an empty block is a non-nil slice)
+	Body []*Directive
+
+	// Comment lines just before the block's closing brace
+	EndComments []string
+
+	// The line the directive is on, if it was parsed
+	Line int
+
+	gap bool // preceded by a blank line
+}
+
+// Add appends a new server block for the given addresses
+// to f and returns it.
+func (f *File) Add(addresses ...string) *Block {
+	b := &Block{Addresses: addresses}
+	f.Blocks = append(f.Blocks, b)
+	return b
+}
+
+// Block returns the first server block that serves address,
+// or nil if there isn't one.
+func (f *File) Block(address string) *Block {
+	for _, b := range f.Blocks {
+		for _, addr := range b.Addresses {
+			if addr == address {
+				return b
+			}
+		}
+	}
+	return nil
+}
+
+// Remove removes the server block b from f. It returns
+// false if b isn't one of f's blocks.
+func (f *File) Remove(b *Block) bool {
+	for i, block := range f.Blocks {
+		if block == b {
+			f.Blocks = append(f.Blocks[:i], f.Blocks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// String returns f as Caddyfile text.
+func (f *File) String() string {
+	var buf bytes.Buffer
+	f.WriteTo(&buf)
+	return buf.String()
+}
+
+// Add appends a new directive to b and returns it.
+func (b *Block) Add(name string, args ...string) *Directive {
+	d := &Directive{Name: name, Args: args}
+	b.Directives = append(b.Directives, d)
+	return d
+}
+
+// Directive returns the first directive in b named name,
+// or nil if there isn't one.
+func (b *Block) Directive(name string) *Directive {
+	return find(b.Directives, name)
+}
+
+// Remove removes every directive named name from b and
+// returns how many were removed.
+func (b *Block) Remove(name string) int {
+	var n int
+	b.Directives, n = remove(b.Directives, name)
+	return n
+}
+
+// Add appends a new line to d's block, creating the
+// block if d doesn't have one yet, and returns it.
+func (d *Directive) Add(name string, args ...string) *Directive {
+	sub := &Directive{Name: name, Args: args}
+	d.Body = append(d.Body, sub)
+	return sub
+}
+
+// Directive returns the first line in d's block named
+// name, or nil if there isn't one.
+func (d *Directive) Directive(name string) *Directive {
+	return find(d.Body, name)
+}
+
+// Remove removes every line named name from d's block
+// and returns how many were removed.
+func (d *Directive) Remove(name string) int {
+	var n int
+	d.Body, n = remove(d.Body, name)
+	return n
+}
+
+func find(dirs []*Directive, name string) *Directive {
+	for _, d := range dirs {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+func remove(dirs []*Directive, name string) ([]*Directive, int) {
+	kept := dirs[:0]
+	for _, d := range dirs {
+		if d.Name != name {
+			kept = append(kept, d)
+		}
+	}
+	return kept, len(dirs) - len(kept)
+}
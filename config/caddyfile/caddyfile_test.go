@@ -0,0 +1,182 @@
+package caddyfile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	f := new(File)
+	site := f.Add("example.com", "www.example.com")
+	site.Add("root", "/srv/example")
+	site.Add("gzip")
+	errors := site.Add("errors")
+	errors.Add("404", "404.html")
+	errors.Add("log", "error log.txt")
+	f.Add("localhost:2015").Add("browse")
+
+	expected := `example.com, www.example.com {
+	root /srv/example
+	gzip
+	errors {
+		404 404.html
+		log "error log.txt"
+	}
+}
+
+localhost:2015 {
+	browse
+}
+`
+	if actual := f.String(); actual != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, actual)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for i, test := range []struct {
+		input, expected string
+	}{
+		// already formatted
+		{`# My site
+localhost:2015 {
+	root /srv # where the files are
+	gzip
+
+	# error pages
+	errors {
+		404 404.html
+		# more to come
+	}
+}
+`, ""},
+
+		// single site without braces stays that way
+		{`localhost
+root /srv
+`, ""},
+
+		// imports are kept
+		{`import sites/*.conf
+
+localhost {
+	import common.conf
+}
+`, ""},
+
+		// indentation, spacing, quoting, and braces are normalized
+		{`a.com,
+b.com
+{
+root   "/srv/my site"
+  header / X-Test "a\"b"   #note
+ext   ".html"
+   }
+c.com {
+}
+# the end`, `a.com, b.com {
+	root "/srv/my site"
+	header / X-Test "a\"b" #note
+	ext .html
+}
+
+c.com {
+}
+
+# the end
+`},
+
+		// empty directive blocks are kept
+		{`localhost {
+	fastcgi / 127.0.0.1:9000 {
+	}
+}`, `localhost {
+	fastcgi / 127.0.0.1:9000 {
+	}
+}
+`},
+	} {
+		f, err := Parse("Caddyfile", strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		expected := test.expected
+		if expected == "" {
+			expected = test.input
+		}
+		if actual := f.String(); actual != expected {
+			t.Errorf("Test %d: Expected:\n%s\nGot:\n%s", i, expected, actual)
+		}
+	}
+}
+
+func TestParseEdit(t *testing.T) {
+	f, err := Parse("Caddyfile", strings.NewReader(`a.com {
+	gzip
+	log access.log
+}
+b.com {
+	browse
+}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	a := f.Block("a.com")
+	if a == nil {
+		t.Fatal("Expected to find block for a.com")
+	}
+	if d := a.Directive("log"); d == nil || len(d.Args) != 1 || d.Args[0] != "access.log" {
+		t.Errorf("Expected log directive with argument access.log, got %#v", d)
+	}
+	if n := a.Remove("gzip"); n != 1 {
+		t.Errorf("Expected to remove 1 directive, removed %d", n)
+	}
+	a.Add("tls", "off")
+	if !f.Remove(f.Block("b.com")) {
+		t.Error("Expected to remove block for b.com")
+	}
+
+	expected := `a.com {
+	log access.log
+	tls off
+}
+`
+	if actual := f.String(); actual != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, actual)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for i, test := range []struct {
+		input, expectedErr string
+	}{
+		{`localhost {
+	gzip
+`, "Caddyfile:2 - Parse error: Unexpected EOF"},
+		{`localhost
+}`, "Caddyfile:2 - Parse error: Unexpected '}'"},
+		{`localhost {
+	root "/srv
+}`, "Caddyfile:2 - Parse error: Unterminated quoted string"},
+		{`{
+	gzip
+}`, "Caddyfile:1 - Parse error: Expected a site address"},
+		{`localhost {
+	gzip
+	{
+	}
+}`, "Caddyfile:3 - Parse error: Unexpected '{'"},
+		{`a.com,`, "Caddyfile:1 - Parse error: Expected another address"},
+	} {
+		_, err := Parse("Caddyfile", strings.NewReader(test.input))
+		if err == nil {
+			t.Errorf("Test %d: Expected error, got none", i)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), test.expectedErr) {
+			t.Errorf("Test %d: Expected error starting with %q, got %q", i, test.expectedErr, err.Error())
+		}
+	}
+}
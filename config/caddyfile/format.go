@@ -0,0 +1,115 @@
+package caddyfile
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// WriteTo writes f to w as Caddyfile text, indented with tabs.
+// Server blocks are separated by a blank line and have braces
+// unless the file has only one site which was written without them.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+
+	var sites int
+	for _, b := range f.Blocks {
+		if len(b.Addresses) > 0 {
+			sites++
+		}
+	}
+
+	for i, b := range f.Blocks {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+
+		if len(b.Addresses) == 0 {
+			writeDirectives(&buf, b.Directives, 0)
+			writeComments(&buf, b.EndComments, 0)
+			continue
+		}
+
+		writeComments(&buf, b.Comments, 0)
+
+		addresses := make([]string, len(b.Addresses))
+		for i, addr := range b.Addresses {
+			addresses[i] = Quote(addr)
+		}
+		buf.WriteString(strings.Join(addresses, ", "))
+
+		if b.bare && sites == 1 {
+			buf.WriteString("\n")
+			writeDirectives(&buf, b.Directives, 0)
+			writeComments(&buf, b.EndComments, 0)
+			continue
+		}
+
+		buf.WriteString(" {\n")
+		writeDirectives(&buf, b.Directives, 1)
+		writeComments(&buf, b.EndComments, 1)
+		buf.WriteString("}\n")
+	}
+
+	if len(f.Comments) > 0 {
+		if len(f.Blocks) > 0 {
+			buf.WriteString("\n")
+		}
+		writeComments(&buf, f.Comments, 0)
+	}
+
+	return buf.WriteTo(w)
+}
+
+func writeDirectives(buf *bytes.Buffer, dirs []*Directive, depth int) {
+	indent := strings.Repeat("\t", depth)
+
+	for i, d := range dirs {
+		if i > 0 && d.gap {
+			buf.WriteString("\n")
+		}
+		writeComments(buf, d.Comments, depth)
+
+		buf.WriteString(indent)
+		buf.WriteString(Quote(d.Name))
+		for _, arg := range d.Args {
+			buf.WriteString(" ")
+			buf.WriteString(Quote(arg))
+		}
+		if d.Body != nil {
+			buf.WriteString(" {")
+		}
+		if d.Comment != "" {
+			buf.WriteString(" ")
+			buf.WriteString(d.Comment)
+		}
+		buf.WriteString("\n")
+
+		if d.Body != nil {
+			writeDirectives(buf, d.Body, depth+1)
+			writeComments(buf, d.EndComments, depth+1)
+			buf.WriteString(indent)
+			buf.WriteString("}\n")
+		}
+	}
+}
+
+func writeComments(buf *bytes.Buffer, comments []string, depth int) {
+	for _, comment := range comments {
+		buf.WriteString(strings.Repeat("\t", depth))
+		if !strings.HasPrefix(comment, "#") {
+			buf.WriteString("# ")
+		}
+		buf.WriteString(comment)
+		buf.WriteString("\n")
+	}
+}
+
+// Quote returns s as a Caddyfile token: unchanged if that's
+// possible, otherwise in quotes with quotes inside escaped.
+func Quote(s string) string {
+	if s != "" && s != "{" && s != "}" && !strings.ContainsAny(s, " \t\r\n\"#") {
+		return s
+	}
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
@@ -0,0 +1,354 @@
+package caddyfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Parse reads a Caddyfile from input and returns its syntax tree.
+// The filename is only used in error messages. Imports are kept
+// as they are written rather than being replaced by the files
+// they import.
+func Parse(filename string, input io.Reader) (*File, error) {
+	items, err := lex(filename, input)
+	if err != nil {
+		return nil, err
+	}
+	lines, trailing := group(items)
+	p := &parser{filename: filename, lines: lines}
+	f, err := p.file()
+	if err != nil {
+		return nil, err
+	}
+	f.Comments = append(f.Comments, trailing...)
+	return f, nil
+}
+
+// item is a token or comment read from the input.
+type item struct {
+	text    string
+	line    int // line where the item starts
+	endLine int // line where it ends (quoted tokens may span lines)
+	quoted  bool
+	comment bool
+}
+
+// lex reads all the tokens and comments from input. Tokens are
+// delimited the same way as in the parse package's lexer.
+func lex(filename string, input io.Reader) ([]item, error) {
+	var items []item
+	var val []rune
+	var quoted, escaped, inToken bool
+	var start int
+
+	reader := bufio.NewReader(input)
+	line := 1
+
+	emit := func(wasQuoted bool) {
+		items = append(items, item{text: string(val), line: start, endLine: line, quoted: wasQuoted})
+		val, inToken = val[:0], false
+	}
+
+	for {
+		ch, _, err := reader.ReadRune()
+		if err == io.EOF {
+			if quoted {
+				return nil, fmt.Errorf("%s:%d - Parse error: Unterminated quoted string", filename, start)
+			}
+			if inToken {
+				emit(false)
+			}
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if quoted {
+			if !escaped {
+				if ch == '\\' {
+					escaped = true
+					continue
+				} else if ch == '"' {
+					quoted = false
+					emit(true)
+					continue
+				}
+			}
+			if escaped && ch != '"' {
+				// only quotes may be escaped
+				val = append(val, '\\')
+			}
+			if ch == '\n' {
+				line++
+			}
+			val = append(val, ch)
+			escaped = false
+			continue
+		}
+
+		if unicode.IsSpace(ch) {
+			if inToken {
+				emit(false)
+			}
+			if ch == '\n' {
+				line++
+			}
+			continue
+		}
+
+		if ch == '#' {
+			if inToken {
+				emit(false)
+			}
+			comment, err := reader.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			text := "#" + strings.TrimRightFunc(comment, unicode.IsSpace)
+			items = append(items, item{text: text, line: line, endLine: line, comment: true})
+			if strings.HasSuffix(comment, "\n") {
+				line++
+			}
+			continue
+		}
+
+		if !inToken {
+			inToken, start = true, line
+			if ch == '"' {
+				quoted = true
+				continue
+			}
+		}
+		val = append(val, ch)
+	}
+}
+
+// line is one logical line of a Caddyfile: the tokens on one
+// physical line up to and including an opening brace, or a
+// closing brace by itself.
+type line struct {
+	tokens   []string
+	open     bool     // ends with an opening brace
+	close    bool     // is a closing brace
+	comment  string   // comment at the end of the line
+	comments []string // comment lines above the line
+	gap      bool     // preceded by a blank line
+	num      int      // line number
+}
+
+// group organizes items into logical lines. It also returns the
+// comments that come after the last line.
+func group(items []item) ([]*line, []string) {
+	var lines []*line
+	var cur, last *line
+	var pending []string
+	var pendingGap bool
+	lastEnd := 0 // line where the previous item ended
+
+	finish := func() {
+		if cur != nil {
+			lines = append(lines, cur)
+			last, cur = cur, nil
+		}
+	}
+	begin := func(num int) {
+		finish()
+		cur = &line{comments: pending, gap: pendingGap, num: num}
+		pending, pendingGap = nil, false
+	}
+
+	for _, it := range items {
+		gap := lastEnd > 0 && it.line > lastEnd+1
+
+		if it.comment {
+			if last != nil && cur == nil && it.line == lastEnd {
+				last.comment = it.text
+			} else if cur != nil && it.line == lastEnd {
+				cur.comment = it.text
+			} else {
+				finish()
+				if len(pending) == 0 {
+					pendingGap = gap
+				}
+				pending = append(pending, it.text)
+			}
+			lastEnd = it.endLine
+			continue
+		}
+
+		switch {
+		case !it.quoted && it.text == "}":
+			if len(pending) == 0 {
+				pendingGap = gap
+			}
+			begin(it.line)
+			cur.close = true
+			finish()
+		case cur == nil || it.line > lastEnd:
+			if len(pending) == 0 {
+				pendingGap = gap
+			}
+			begin(it.line)
+			fallthrough
+		default:
+			if !it.quoted && it.text == "{" {
+				cur.open = true
+				finish()
+			} else {
+				cur.tokens = append(cur.tokens, it.text)
+			}
+		}
+		lastEnd = it.endLine
+	}
+	finish()
+
+	return lines, pending
+}
+
+type parser struct {
+	filename string
+	lines    []*line
+	pos      int
+}
+
+func (p *parser) next() *line {
+	if p.pos >= len(p.lines) {
+		return nil
+	}
+	p.pos++
+	return p.lines[p.pos-1]
+}
+
+func (p *parser) peek() *line {
+	if p.pos >= len(p.lines) {
+		return nil
+	}
+	return p.lines[p.pos]
+}
+
+func (p *parser) errf(ln *line, format string, args ...interface{}) error {
+	num := 0
+	if ln != nil {
+		num = ln.num
+	} else if len(p.lines) > 0 {
+		num = p.lines[len(p.lines)-1].num
+	}
+	return fmt.Errorf("%s:%d - Parse error: %s", p.filename, num, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) file() (*File, error) {
+	f := new(File)
+
+	for ln := p.next(); ln != nil; ln = p.next() {
+		if ln.close {
+			return nil, p.errf(ln, "Unexpected '}' because no matching opening brace")
+		}
+
+		// top-level import, which stands in for whole server blocks
+		if len(ln.tokens) > 0 && ln.tokens[0] == "import" && !ln.open {
+			f.Blocks = append(f.Blocks, &Block{Directives: []*Directive{directive(ln)}})
+			continue
+		}
+
+		b := &Block{Comments: ln.comments}
+		for {
+			if len(ln.tokens) == 0 {
+				return nil, p.errf(ln, "Expected a site address before '{'")
+			}
+			for _, tkn := range ln.tokens {
+				if addr := strings.TrimSuffix(tkn, ","); addr != "" {
+					b.Addresses = append(b.Addresses, addr)
+				}
+			}
+			if ln.comment != "" {
+				b.Comments = append(b.Comments, ln.comment)
+			}
+			if ln.open || !strings.HasSuffix(ln.tokens[len(ln.tokens)-1], ",") {
+				break
+			}
+			// trailing comma: another address follows
+			if ln = p.next(); ln == nil || ln.close {
+				return nil, p.errf(ln, "Expected another address - check for extra comma")
+			}
+			b.Comments = append(b.Comments, ln.comments...)
+		}
+
+		if !ln.open {
+			if nl := p.peek(); nl != nil && nl.open && len(nl.tokens) == 0 {
+				// opening brace on the line after the addresses
+				p.next()
+				ln = nl
+			}
+		}
+
+		var err error
+		b.bare = !ln.open
+		b.Directives, b.EndComments, err = p.directives(ln.open)
+		if err != nil {
+			return nil, err
+		}
+		f.Blocks = append(f.Blocks, b)
+	}
+
+	return f, nil
+}
+
+// directives parses lines into directives until a closing brace,
+// if closed is true, or the end of the input. It returns the
+// directives and any comments before the closing brace.
+func (p *parser) directives(closed bool) ([]*Directive, []string, error) {
+	var dirs []*Directive
+
+	for ln := p.next(); ln != nil; ln = p.next() {
+		if ln.close {
+			if !closed {
+				return nil, nil, p.errf(ln, "Unexpected '}' because no matching opening brace")
+			}
+			end := ln.comments
+			if ln.comment != "" {
+				end = append(end, ln.comment)
+			}
+			return dirs, end, nil
+		}
+		if len(ln.tokens) == 0 {
+			return nil, nil, p.errf(ln, "Unexpected '{' - it must be on the same line as the directive")
+		}
+
+		d := directive(ln)
+		if ln.open {
+			body, end, err := p.directives(true)
+			if err != nil {
+				return nil, nil, err
+			}
+			if body == nil {
+				body = []*Directive{}
+			}
+			d.Body, d.EndComments = body, end
+		}
+		dirs = append(dirs, d)
+	}
+
+	if closed {
+		return nil, nil, p.errf(nil, "Unexpected EOF - expected '}'")
+	}
+	return dirs, nil, nil
+}
+
+// directive makes a Directive out of the tokens on ln.
+func directive(ln *line) *Directive {
+	d := &Directive{
+		Comments: ln.comments,
+		Name:     ln.tokens[0],
+		Comment:  ln.comment,
+		Line:     ln.num,
+		gap:      ln.gap,
+	}
+	if len(ln.tokens) > 1 {
+		d.Args = ln.tokens[1:]
+	}
+	return d
+}
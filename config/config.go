@@ -5,11 +5,16 @@ import (
 	"io"
 	"log"
 	"net"
+	"net/http"
+	"strings"
 
 	"github.com/mholt/caddy/app"
 	"github.com/mholt/caddy/config/parse"
 	"github.com/mholt/caddy/config/setup"
 	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/hostroute"
+	"github.com/mholt/caddy/middleware/proxy"
+	"github.com/mholt/caddy/middleware/toggle"
 	"github.com/mholt/caddy/server"
 )
 
@@ -40,64 +45,303 @@ func Load(filename string, input io.Reader) ([]server.Config, error) {
 	// executing the directives that were parsed.
 	for _, sb := range serverBlocks {
 		config := server.Config{
-			Host:       sb.Host,
-			Port:       sb.Port,
-			Root:       Root,
-			Middleware: make(map[string][]middleware.Middleware),
-			ConfigFile: filename,
-			AppName:    app.Name,
-			AppVersion: app.Version,
-		}
-
-		// It is crucial that directives are executed in the proper order.
-		for _, dir := range directiveOrder {
-			// Execute directive if it is in the server block
-			if tokens, ok := sb.Tokens[dir.name]; ok {
-				// Each setup function gets a controller, which is the
-				// server config and the dispenser containing only
-				// this directive's tokens.
-				controller := &setup.Controller{
-					Config:    &config,
-					Dispenser: parse.NewDispenserTokens(filename, tokens),
-				}
-
-				midware, err := dir.setup(controller)
-				if err != nil {
-					return configs, err
-				}
-				if midware != nil {
-					// TODO: For now, we only support the default path scope /
-					config.Middleware["/"] = append(config.Middleware["/"], midware)
-				}
-			}
+			Host:        sb.Host,
+			Port:        sb.Port,
+			Hosts:       sb.Hosts,
+			Aliases:     sb.Aliases,
+			Root:        Root,
+			PanicPolicy: Panic,
+			Middleware:  make(map[string][]middleware.Middleware),
+			Directives:  make(map[string]string),
+			ConfigFile:  filename,
+			AppName:     app.Name,
+			AppVersion:  app.Version,
 		}
 
 		if config.Port == "" {
 			config.Port = Port
 		}
 
+		// The switches and proxy upstreams of the site are registered
+		// when it goes into service, so that a reload that fails
+		// leaves those of the running site in place
+		addr := config.Address()
+		config.Unpublish = append(config.Unpublish, func() {
+			toggle.Reset(addr)
+			proxy.Reset(addr)
+		})
+
+		tokens := func(name string) (parse.Dispenser, bool) {
+			t, ok := sb.Tokens[name]
+			return parse.NewDispenserTokens(filename, t), ok
+		}
+		if err := executeDirectives(&config, tokens, true); err != nil {
+			return configs, err
+		}
+
 		configs = append(configs, config)
 	}
 
+	// The CA checks that we control the sites with managed
+	// certificates over plain HTTP, so port 80 must be served
+	configs = append(configs, httpsRedirects(configs)...)
+
 	// restore logging settings
 	log.SetFlags(flags)
 
 	return configs, nil
 }
 
+// executeDirectives executes, in order, the directives that
+// dispenser has tokens for, setting up config and appending
+// the middleware they make to its chain. If toggles is true,
+// each layer of middleware can be turned off through the admin
+// API with a switch named after its directive.
+func executeDirectives(config *server.Config, dispenser func(name string) (parse.Dispenser, bool), toggles bool) error {
+	// The directives that got a switch
+	switches := make(map[string]bool)
+
+	// It is crucial that directives are executed in the proper order.
+	for _, dir := range directiveOrder {
+		// Execute directive if it is in the server block
+		d, ok := dispenser(dir.name)
+		if !ok {
+			continue
+		}
+		config.Directives[dir.name] = directiveText(d)
+
+		var midware middleware.Middleware
+		var err error
+		d, _ = dispenser(dir.name)
+		if dir.duplicates != merge {
+			occurrences := d.Occurrences()
+			if len(occurrences) > 1 && dir.duplicates == unique {
+				dup := occurrences[1]
+				dup.Next()
+				return dup.Errf("Directive '%s' may only be used once per site", dir.name)
+			}
+			d = occurrences[len(occurrences)-1]
+		}
+		switch dir.name {
+		case "handle_host":
+			midware, err = handleHost(config, d)
+		case "scope":
+			err = pathScopes(config, d)
+		default:
+			// Each setup function gets a controller, which is the
+			// server config and the dispenser containing only
+			// this directive's tokens.
+			controller := &setup.Controller{
+				Config:    config,
+				Dispenser: d,
+			}
+			midware, err = dir.setup(controller)
+		}
+		if err != nil {
+			return err
+		}
+		if midware != nil {
+			if toggles {
+				s := toggle.NewSwitch(!disabled(config, dir.name))
+				addr, name := config.Address(), dir.name
+				config.Publish = append(config.Publish, func() { toggle.Register(addr, name, s) })
+				switches[name] = true
+				midware = toggle.Layer(s, midware)
+			}
+			config.Middleware["/"] = append(config.Middleware["/"], midware)
+		}
+	}
+
+	if toggles {
+		for _, name := range config.Disabled {
+			if !switches[name] {
+				return fmt.Errorf("%s: cannot disable %s, which makes no middleware for %s",
+					config.ConfigFile, name, config.Address())
+			}
+		}
+	}
+	return nil
+}
+
+// disabled returns true if the middleware of the
+// directive called name should start turned off.
+func disabled(config *server.Config, name string) bool {
+	for _, d := range config.Disabled {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+// handleHost sets up the blocks of the handle_host directives
+// in d (see blockChain) and returns the middleware that sends
+// the requests for their hosts through their own middleware.
+func handleHost(config *server.Config, d parse.Dispenser) (middleware.Middleware, error) {
+	blocks, err := parse.HostBlocks(d)
+	if err != nil {
+		return nil, err
+	}
+
+	var chains [][]middleware.Middleware
+	for _, block := range blocks {
+		tokens := block.Tokens
+		chain, err := blockChain(config, "handle_host", func(dir string) (parse.Dispenser, bool) {
+			t, ok := tokens[dir]
+			return parse.NewDispenserTokens(config.ConfigFile, t), ok
+		})
+		if err != nil {
+			return nil, err
+		}
+		chains = append(chains, chain)
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		hr := hostroute.HostRoute{Next: next}
+		for i, block := range blocks {
+			h := next
+			for j := len(chains[i]) - 1; j >= 0; j-- {
+				h = chains[i][j](h)
+			}
+			hr.Routes = append(hr.Routes, hostroute.Route{Hosts: block.Hosts, Handler: h})
+		}
+		return hr
+	}, nil
+}
+
+// pathScopes sets up the blocks of the scope directives in d, and
+// keeps the chain of each block in config.Middleware by its paths.
+// A request takes the chain of the longest path it is under instead
+// of the middleware of the site itself (see server.Config), so the
+// site's directives that should apply there must be given again.
+func pathScopes(config *server.Config, d parse.Dispenser) error {
+	blocks, err := parse.PathBlocks(d)
+	if err != nil {
+		return err
+	}
+
+	for _, block := range blocks {
+		for _, p := range block.Paths {
+			if !strings.HasPrefix(p, "/") || p == "/" {
+				return fmt.Errorf("%s: scope %s must be a path below /; the site's own directives apply to all of it",
+					config.ConfigFile, p)
+			}
+			if _, ok := config.Middleware[p]; ok {
+				return fmt.Errorf("%s: scope %s is given more than once", config.ConfigFile, p)
+			}
+		}
+		tokens := block.Tokens
+		chain, err := blockChain(config, "scope", func(dir string) (parse.Dispenser, bool) {
+			t, ok := tokens[dir]
+			return parse.NewDispenserTokens(config.ConfigFile, t), ok
+		})
+		if err != nil {
+			return err
+		}
+		for _, p := range block.Paths {
+			config.Middleware[p] = chain
+		}
+	}
+	return nil
+}
+
+// blockChain sets up the directives of a block given to the
+// directive name, like a small site of its own that shares
+// config's settings, and returns the middleware they make.
+// Only directives that make middleware for the whole block
+// may be used in it, so scope blocks can't be.
+func blockChain(config *server.Config, name string, dispenser func(dir string) (parse.Dispenser, bool)) ([]middleware.Middleware, error) {
+	sub := *config
+	sub.Middleware = make(map[string][]middleware.Middleware)
+	sub.Directives = make(map[string]string)
+	sub.Startup, sub.Shutdown, sub.Checks, sub.Guards = nil, nil, nil, nil
+
+	if err := executeDirectives(&sub, dispenser, false); err != nil {
+		return nil, err
+	}
+	if _, ok := sub.Directives["scope"]; ok {
+		return nil, fmt.Errorf("%s: scope cannot be used in %s", config.ConfigFile, name)
+	}
+	if n := len(sub.Middleware["/"]); n < len(sub.Directives) {
+		return nil, fmt.Errorf("%s: only directives that handle requests can be used in %s, not those that configure the site",
+			config.ConfigFile, name)
+	}
+
+	config.Startup = append(config.Startup, sub.Startup...)
+	config.Shutdown = append(config.Shutdown, sub.Shutdown...)
+	config.Checks = append(config.Checks, sub.Checks...)
+	config.Guards = append(config.Guards, sub.Guards...)
+	return sub.Middleware["/"], nil
+}
+
+// httpsRedirects returns the configs of sites on port 80 that
+// redirect to the HTTPS sites among configs whose certificates
+// are managed, unless those are already served on port 80. The
+// ACME challenges of the CA are answered on them by the server.
+func httpsRedirects(configs []server.Config) []server.Config {
+	served := make(map[string]bool)
+	for _, conf := range configs {
+		if isHTTP(conf) {
+			served[conf.Host] = true
+		}
+	}
+
+	var redirects []server.Config
+	for _, conf := range configs {
+		if !conf.TLS.Managed() || served[conf.Host] {
+			continue
+		}
+		served[conf.Host] = true
+
+		host := conf.Host
+		if conf.Port != "443" && conf.Port != "https" {
+			host = net.JoinHostPort(conf.Host, conf.Port)
+		}
+		redirect := func(next middleware.Handler) middleware.Handler {
+			return middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+				http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+				return 0, nil
+			})
+		}
+		redirects = append(redirects, server.Config{
+			Host:          conf.Host,
+			Port:          "80",
+			BindHost:      conf.BindHost,
+			Root:          conf.Root,
+			PanicPolicy:   conf.PanicPolicy,
+			FilePerms:     conf.FilePerms,
+			Middleware:    map[string][]middleware.Middleware{"/": {redirect}},
+			Directives:    make(map[string]string),
+			ConfigFile:    conf.ConfigFile,
+			AppName:       conf.AppName,
+			AppVersion:    conf.AppVersion,
+			HTTPSRedirect: true,
+		})
+	}
+	return redirects
+}
+
+// isHTTP returns true if conf is a site on port 80.
+func isHTTP(conf server.Config) bool {
+	return conf.Port == "80" || conf.Port == "http"
+}
+
 // ArrangeBindings groups configurations by their bind address. For example,
 // a server that should listen on localhost and another on 127.0.0.1 will
 // be grouped into the same address: 127.0.0.1. It will return an error
-// if an address is malformed or a TLS listener is configured on the
-// same address as a plaintext HTTP listener. The return value is a map of
+// if an address is malformed, or a ConflictError listing every set of
+// sites that can't be bound together (see checkConflicts), rather than
+// letting the listeners fail one at a time. The return value is a map of
 // bind address to list of configs that would become VirtualHosts on that
 // server. Use the keys of the returned map to create listeners, and use
 // the associated values to set up the virtualhosts.
 func ArrangeBindings(allConfigs []server.Config) (map[*net.TCPAddr][]server.Config, error) {
 	addresses := make(map[*net.TCPAddr][]server.Config)
 
-	// Group configs by bind address
-	for _, conf := range allConfigs {
+	// Resolve the address of each config before grouping them,
+	// so that every conflict between them can be reported at once
+	resolved := make([]*net.TCPAddr, len(allConfigs))
+	for i, conf := range allConfigs {
 		newAddr, warnErr, fatalErr := resolveAddr(conf)
 		if fatalErr != nil {
 			return addresses, fatalErr
@@ -105,6 +349,15 @@ func ArrangeBindings(allConfigs []server.Config) (map[*net.TCPAddr][]server.Conf
 		if warnErr != nil {
 			log.Println("[Warning]", warnErr)
 		}
+		resolved[i] = newAddr
+	}
+	if err := checkConflicts(allConfigs, resolved); err != nil {
+		return addresses, err
+	}
+
+	// Group configs by bind address
+	for i, conf := range allConfigs {
+		newAddr := resolved[i]
 
 		// Make sure to compare the string representation of the address,
 		// not the pointer, since a new *TCPAddr is created each time.
@@ -121,24 +374,6 @@ func ArrangeBindings(allConfigs []server.Config) (map[*net.TCPAddr][]server.Conf
 		}
 	}
 
-	// Don't allow HTTP and HTTPS to be served on the same address
-	for _, configs := range addresses {
-		isTLS := configs[0].TLS.Enabled
-		for _, config := range configs {
-			if config.TLS.Enabled != isTLS {
-				thisConfigProto, otherConfigProto := "HTTP", "HTTP"
-				if config.TLS.Enabled {
-					thisConfigProto = "HTTPS"
-				}
-				if configs[0].TLS.Enabled {
-					otherConfigProto = "HTTPS"
-				}
-				return addresses, fmt.Errorf("configuration error: Cannot multiplex %s (%s) and %s (%s) on same address",
-					configs[0].Address(), otherConfigProto, config.Address(), thisConfigProto)
-			}
-		}
-	}
-
 	return addresses, nil
 }
 
@@ -211,15 +446,17 @@ func validDirective(d string) bool {
 // which are essentials for serving the cwd.
 func Default() server.Config {
 	return server.Config{
-		Root: Root,
-		Host: Host,
-		Port: Port,
+		Root:        Root,
+		Host:        Host,
+		Port:        Port,
+		PanicPolicy: Panic,
 	}
 }
 
-// These three defaults are configurable through the command line
+// These defaults are configurable through the command line
 var (
-	Root = DefaultRoot
-	Host = DefaultHost
-	Port = DefaultPort
+	Root  = DefaultRoot
+	Host  = DefaultHost
+	Port  = DefaultPort
+	Panic = middleware.PanicRecover
 )
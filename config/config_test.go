@@ -1,8 +1,14 @@
 package config
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/mholt/caddy/middleware/proxy"
+	mwtest "github.com/mholt/caddy/middleware/testing"
+	"github.com/mholt/caddy/middleware/toggle"
 	"github.com/mholt/caddy/server"
 )
 
@@ -60,3 +66,244 @@ func TestReolveAddr(t *testing.T) {
 		}
 	}
 }
+
+func TestHandleHost(t *testing.T) {
+	input := `localhost:2015 {
+		handle_host api.localhost *.cdn.localhost {
+			header / X-Host api
+		}
+		header / X-Site yes
+	}`
+	configs, err := Load("Testfile", strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	h := mwtest.Chain(&mwtest.Handler{}, configs[0].Middleware["/"]...)
+
+	for i, test := range []struct {
+		host         string
+		expectedHost string
+	}{
+		{"api.localhost:2015", "api"},
+		{"eu.cdn.localhost", "api"},
+		{"localhost:2015", ""},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = test.host
+		rec := mwtest.Serve(h, r)
+		rec.AssertStatus(t, http.StatusOK)
+		if got := rec.Header().Get("X-Host"); got != test.expectedHost {
+			t.Errorf("Test %d: Expected X-Host %q for %s, got %q", i, test.expectedHost, test.host, got)
+		}
+		if got := rec.Header().Get("X-Site"); got != "yes" {
+			t.Errorf("Test %d: Expected X-Site header for %s, got %q", i, test.host, got)
+		}
+	}
+
+	for i, input := range []string{
+		"localhost {\n handle_host {\n header / X-Host api\n }\n}",
+		"localhost {\n handle_host api.localhost\n}",
+		"localhost {\n handle_host api.localhost {\n root /srv\n }\n}",
+	} {
+		if _, err := Load("Testfile", strings.NewReader(input)); err == nil {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		}
+	}
+}
+
+func TestPathScopes(t *testing.T) {
+	input := `localhost:2015 {
+		header / X-Site yes
+		scope /static /assets {
+			header / X-Scope static
+		}
+		scope /api {
+			header / X-Scope api
+		}
+	}`
+	configs, err := Load("Testfile", strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	mw := configs[0].Middleware
+	if len(mw["/"]) != 1 {
+		t.Errorf("Expected only the site's own middleware in scope /, got %d layers", len(mw["/"]))
+	}
+	for _, scope := range []string{"/static", "/assets", "/api"} {
+		if len(mw[scope]) != 1 {
+			t.Errorf("Expected 1 layer in scope %s, got %d", scope, len(mw[scope]))
+		}
+	}
+	rec := mwtest.Serve(mwtest.Chain(&mwtest.Handler{}, mw["/api"]...), httptest.NewRequest("GET", "/api/x", nil))
+	if got := rec.Header().Get("X-Scope"); got != "api" {
+		t.Errorf("Expected X-Scope api from the chain of /api, got %q", got)
+	}
+
+	// access policies of browse in a scope still guard the whole site
+	configs, err = Load("Testfile", strings.NewReader(`localhost:2015 {
+		scope /files {
+			browse /files {
+				access
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(configs[0].Guards) != 1 {
+		t.Errorf("Expected the access guard of the scope's browse among the site's guards, got %d", len(configs[0].Guards))
+	}
+
+	for i, input := range []string{
+		"localhost {\n scope {\n header / X-Scope x\n }\n}",
+		"localhost {\n scope / {\n header / X-Scope x\n }\n}",
+		"localhost {\n scope static {\n header / X-Scope x\n }\n}",
+		"localhost {\n scope /a {\n header / X-Scope x\n }\n scope /a {\n gzip\n }\n}",
+		"localhost {\n scope /a {\n root /srv\n }\n}",
+		"localhost {\n scope /a {\n scope /a/b {\n gzip\n }\n }\n}",
+		"localhost {\n handle_host api.localhost {\n scope /a {\n gzip\n }\n }\n}",
+	} {
+		if _, err := Load("Testfile", strings.NewReader(input)); err == nil {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		}
+	}
+}
+
+func TestDuplicateDirectives(t *testing.T) {
+	for i, test := range []struct {
+		input        string
+		shouldErr    bool
+		expectedRoot string
+		expectedMW   int
+	}{
+		{"localhost {\n root /a\n root /b\n}", false, "/b", 0},
+		{"localhost {\n root /a\n}", false, "/a", 0},
+		{"localhost {\n gzip\n gzip {\n level 5\n }\n}", false, Root, 1},
+		{"localhost {\n header / X-A a\n header / X-B b\n}", false, Root, 1},
+		{"localhost {\n bind 127.0.0.1\n bind 127.0.0.2\n}", true, "", 0},
+		{"localhost {\n bind 127.0.0.1\n}", false, Root, 0},
+	} {
+		configs, err := Load("Testfile", strings.NewReader(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			} else if !strings.Contains(err.Error(), "Testfile:3") {
+				t.Errorf("Test %d: Expected error at the second occurrence, got '%v'", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if got := configs[0].Root; got != test.expectedRoot {
+			t.Errorf("Test %d: Expected root %s, got %s", i, test.expectedRoot, got)
+		}
+		if got := len(configs[0].Middleware["/"]); got != test.expectedMW {
+			t.Errorf("Test %d: Expected %d middleware, got %d", i, test.expectedMW, got)
+		}
+	}
+}
+
+func TestToggles(t *testing.T) {
+	input := `localhost:2020 {
+		header / X-Site yes
+		header / X-Maintenance yes
+		disable header
+	}`
+	configs, err := Load("Testfile", strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	h := mwtest.Chain(&mwtest.Handler{}, configs[0].Middleware["/"]...)
+	r := httptest.NewRequest("GET", "/", nil)
+	mwtest.Serve(h, r).AssertHeader(t, "X-Maintenance", "")
+
+	if _, ok := toggle.Lookup("localhost:2020", "header"); ok {
+		t.Fatal("Expected no switch before the site is published")
+	}
+	for _, publish := range configs[0].Publish {
+		publish()
+	}
+	s, ok := toggle.Lookup("localhost:2020", "header")
+	if !ok {
+		t.Fatal("Expected a switch for the header directive")
+	}
+	s.Set(true)
+	mwtest.Serve(h, r).AssertHeader(t, "X-Maintenance", "yes")
+
+	_, err = Load("Testfile", strings.NewReader("localhost:2020 {\n root /srv\n disable root\n}"))
+	if err == nil {
+		t.Error("Expected an error disabling a directive that makes no middleware")
+	}
+}
+
+func TestProxyUpstreamsPublished(t *testing.T) {
+	hosts := func() []string {
+		var names []string
+		for _, h := range proxy.Hosts() {
+			if h.Site == "localhost:2021" {
+				names = append(names, h.Host)
+			}
+		}
+		return names
+	}
+	load := func(upstream string) server.Config {
+		configs, err := Load("Testfile", strings.NewReader("localhost:2021 {\n proxy / "+upstream+"\n}"))
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		return configs[0]
+	}
+
+	old := load("old.test:8080")
+	for _, publish := range old.Publish {
+		publish()
+	}
+	defer proxy.Reset("localhost:2021")
+
+	// loading the site again doesn't touch the running one's upstreams
+	reloaded := load("new.test:8080")
+	if h := hosts(); len(h) != 1 || h[0] != "http://old.test:8080" {
+		t.Errorf("Expected only the running site's upstream, got %v", h)
+	}
+	for _, unpublish := range old.Unpublish {
+		unpublish()
+	}
+	for _, publish := range reloaded.Publish {
+		publish()
+	}
+	if h := hosts(); len(h) != 1 || h[0] != "http://new.test:8080" {
+		t.Errorf("Expected only the new site's upstream once published, got %v", h)
+	}
+}
+
+func TestHTTPSRedirects(t *testing.T) {
+	managed := server.TLSConfig{Enabled: true}
+	redirects := httpsRedirects([]server.Config{
+		{Host: "a.com", Port: "443", TLS: managed},
+		{Host: "b.com", Port: "8443", TLS: managed},
+		{Host: "c.com", Port: "443", TLS: managed},
+		{Host: "c.com", Port: "80"},
+		{Host: "d.com", Port: "443", TLS: server.TLSConfig{Enabled: true, Certificate: "d.crt", Key: "d.key"}},
+	})
+	if len(redirects) != 2 {
+		t.Fatalf("Expected redirects for a.com and b.com only, got %d", len(redirects))
+	}
+
+	for i, test := range []struct {
+		url, expectedLocation string
+	}{
+		{"http://a.com/x?y=z", "https://a.com/x?y=z"},
+		{"http://b.com/", "https://b.com:8443/"},
+	} {
+		conf := redirects[i]
+		if conf.Port != "80" || !conf.HTTPSRedirect {
+			t.Errorf("Test %d: Expected an HTTPS redirect on port 80, got port %s (%v)", i, conf.Port, conf.HTTPSRedirect)
+		}
+		h := mwtest.Chain(&mwtest.Handler{}, conf.Middleware["/"]...)
+		rec := mwtest.Serve(h, httptest.NewRequest("GET", test.url, nil))
+		rec.AssertStatus(t, http.StatusMovedPermanently)
+		rec.AssertHeader(t, "Location", test.expectedLocation)
+	}
+}
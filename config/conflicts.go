@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mholt/caddy/server"
+)
+
+// ConflictError lists the sites of a configuration that can't be
+// served together, each conflict naming the sites involved.
+type ConflictError struct {
+	Conflicts []string
+}
+
+func (e ConflictError) Error() string {
+	if len(e.Conflicts) == 1 {
+		return "configuration error: " + e.Conflicts[0]
+	}
+	return fmt.Sprintf("configuration error: %d conflicts:\n  %s",
+		len(e.Conflicts), strings.Join(e.Conflicts, "\n  "))
+}
+
+// checkConflicts returns a ConflictError if configs, to be
+// bound to the addresses at the same indexes of addrs, can't be
+// served together: if a site is defined more than once, if HTTP
+// and HTTPS sites share an address, or if some sites are bound
+// to the wildcard address of a port and others to a specific
+// address on it, which the operating system wouldn't allow.
+func checkConflicts(configs []server.Config, addrs []*net.TCPAddr) error {
+	var conflicts []string
+
+	// group the sites by what they are served on, in order
+	type group struct {
+		key   string
+		sites []int
+	}
+	groupBy := func(key func(i int) string) []group {
+		var groups []group
+		index := make(map[string]int)
+		for i := range configs {
+			k := key(i)
+			g, ok := index[k]
+			if !ok {
+				g = len(groups)
+				index[k] = g
+				groups = append(groups, group{key: k})
+			}
+			groups[g].sites = append(groups[g].sites, i)
+		}
+		return groups
+	}
+
+	// The same site twice on an address
+	for _, g := range groupBy(func(i int) string {
+		return strings.ToLower(configs[i].Host) + " " + addrs[i].String()
+	}) {
+		if len(g.sites) > 1 {
+			conflicts = append(conflicts, fmt.Sprintf("site %s is defined %d times: %s",
+				configs[g.sites[0]].Address(), len(g.sites), siteLabels(configs, g.sites, true)))
+		}
+	}
+
+	// HTTP and HTTPS on an address
+	for _, g := range groupBy(func(i int) string { return addrs[i].String() }) {
+		var plain, secure []int
+		for _, i := range g.sites {
+			if configs[i].TLS.Enabled {
+				secure = append(secure, i)
+			} else {
+				plain = append(plain, i)
+			}
+		}
+		if len(plain) > 0 && len(secure) > 0 {
+			conflicts = append(conflicts, fmt.Sprintf("cannot serve HTTP (%s) and HTTPS (%s) on the same address %s",
+				siteLabels(configs, plain, false), siteLabels(configs, secure, false), g.key))
+		}
+	}
+
+	// The wildcard address of a port and a specific one
+	for _, g := range groupBy(func(i int) string { return fmt.Sprint(addrs[i].Port) }) {
+		var wildcard, specific []int
+		for _, i := range g.sites {
+			if addrs[i].IP == nil || addrs[i].IP.IsUnspecified() {
+				wildcard = append(wildcard, i)
+			} else {
+				specific = append(specific, i)
+			}
+		}
+		if len(wildcard) > 0 && len(specific) > 0 {
+			conflicts = append(conflicts, fmt.Sprintf("cannot bind both to all interfaces (%s) and to specific addresses (%s) on port %s; use bind to pick one",
+				siteLabels(configs, wildcard, false), siteLabels(configs, specific, false), g.key))
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return ConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+// siteLabels describes the sites of configs at indexes for
+// an error message, with the files they are defined in if
+// withFile is true.
+func siteLabels(configs []server.Config, indexes []int, withFile bool) string {
+	labels := make([]string, len(indexes))
+	for j, i := range indexes {
+		labels[j] = configs[i].Address()
+		if withFile && configs[i].ConfigFile != "" {
+			labels[j] += " in " + configs[i].ConfigFile
+		}
+	}
+	return strings.Join(labels, ", ")
+}
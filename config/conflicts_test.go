@@ -0,0 +1,89 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/server"
+)
+
+func TestArrangeBindingsConflicts(t *testing.T) {
+	secure := func(c server.Config) server.Config {
+		c.TLS.Enabled = true
+		return c
+	}
+
+	for i, test := range []struct {
+		configs  []server.Config
+		expected []string // in the error, in order; none if it shouldn't error
+	}{
+		{
+			configs: []server.Config{
+				{Host: "a.test", Port: "8080", BindHost: "127.0.0.1"},
+				{Host: "b.test", Port: "8080", BindHost: "127.0.0.1"},
+				{Host: "a.test", Port: "8081", BindHost: "127.0.0.1"},
+			},
+		},
+		{
+			configs: []server.Config{
+				{Host: "a.test", Port: "8080", BindHost: "127.0.0.1", ConfigFile: "one"},
+				{Host: "A.test", Port: "8080", BindHost: "127.0.0.1", ConfigFile: "two"},
+			},
+			expected: []string{"site a.test:8080 is defined 2 times: a.test:8080 in one, A.test:8080 in two"},
+		},
+		{
+			configs: []server.Config{
+				{Host: "a.test", Port: "8080", BindHost: "127.0.0.1"},
+				secure(server.Config{Host: "b.test", Port: "8080", BindHost: "127.0.0.1"}),
+				{Host: "c.test", Port: "8080", BindHost: "127.0.0.1"},
+			},
+			expected: []string{"cannot serve HTTP (a.test:8080, c.test:8080) and HTTPS (b.test:8080) on the same address 127.0.0.1:8080"},
+		},
+		{
+			configs: []server.Config{
+				{Host: "a.test", Port: "8080", BindHost: "0.0.0.0"},
+				{Host: "b.test", Port: "8080", BindHost: "127.0.0.1"},
+				{Host: "c.test", Port: "8081", BindHost: "0.0.0.0"},
+			},
+			expected: []string{"all interfaces (a.test:8080) and to specific addresses (b.test:8080) on port 8080"},
+		},
+		{
+			configs: []server.Config{
+				{Host: "a.test", Port: "8080", BindHost: "127.0.0.1"},
+				{Host: "a.test", Port: "8080", BindHost: "127.0.0.1"},
+				secure(server.Config{Host: "b.test", Port: "8080", BindHost: "127.0.0.1"}),
+				{Host: "c.test", Port: "8080", BindHost: "0.0.0.0"},
+			},
+			expected: []string{
+				"3 conflicts",
+				"site a.test:8080 is defined 2 times",
+				"cannot serve HTTP (a.test:8080, a.test:8080) and HTTPS (b.test:8080)",
+				"all interfaces (c.test:8080) and to specific addresses (a.test:8080, a.test:8080, b.test:8080)",
+			},
+		},
+	} {
+		_, err := ArrangeBindings(test.configs)
+		if len(test.expected) == 0 {
+			if err != nil {
+				t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Test %d didn't error, but it should have", i)
+			continue
+		}
+		if _, ok := err.(ConflictError); !ok {
+			t.Errorf("Test %d: Expected a ConflictError, got %T", i, err)
+		}
+		msg, at := err.Error(), 0
+		for _, part := range test.expected {
+			j := strings.Index(msg[at:], part)
+			if j < 0 {
+				t.Errorf("Test %d: Expected %q (in order) in the error, got %q", i, part, msg)
+				break
+			}
+			at += j + len(part)
+		}
+	}
+}
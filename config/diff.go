@@ -0,0 +1,159 @@
+package config
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/admin"
+	"github.com/mholt/caddy/config/parse"
+	"github.com/mholt/caddy/server"
+)
+
+// Diff describes what a reload of a configuration file changed.
+type Diff struct {
+	File    string     `json:"file"`
+	Time    time.Time  `json:"time"`
+	Added   []string   `json:"added"`   // addresses of sites that are new
+	Removed []string   `json:"removed"` // addresses of sites that are gone
+	Changed []SiteDiff `json:"changed"`
+}
+
+// SiteDiff lists the directives of a site that changed on a reload.
+type SiteDiff struct {
+	Site    string   `json:"site"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// DiffConfigs compares the sites that were loaded from file before
+// a reload, old, with the ones loaded from it now, new.
+func DiffConfigs(file string, old, new []server.Config) Diff {
+	diff := Diff{
+		File:    file,
+		Time:    time.Now(),
+		Added:   []string{},
+		Removed: []string{},
+		Changed: []SiteDiff{},
+	}
+
+	oldSites := make(map[string]server.Config)
+	for _, conf := range old {
+		oldSites[conf.Address()] = conf
+	}
+	for _, conf := range new {
+		site := conf.Address()
+		before, ok := oldSites[site]
+		if !ok {
+			diff.Added = append(diff.Added, site)
+			continue
+		}
+		delete(oldSites, site)
+		added, removed, changed := diffKeys(before.Directives, conf.Directives)
+		if len(added)+len(removed)+len(changed) > 0 {
+			diff.Changed = append(diff.Changed, SiteDiff{site, added, removed, changed})
+		}
+	}
+	for site := range oldSites {
+		diff.Removed = append(diff.Removed, site)
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Site < diff.Changed[j].Site })
+	return diff
+}
+
+// diffKeys returns the keys that are only in new, only in old, and
+// in both with different values, each in directive order.
+func diffKeys(old, new map[string]string) (added, removed, changed []string) {
+	added, removed, changed = []string{}, []string{}, []string{}
+	for _, dir := range directiveOrder {
+		before, inOld := old[dir.name]
+		after, inNew := new[dir.name]
+		switch {
+		case inNew && !inOld:
+			added = append(added, dir.name)
+		case inOld && !inNew:
+			removed = append(removed, dir.name)
+		case inOld && before != after:
+			changed = append(changed, dir.name)
+		}
+	}
+	return
+}
+
+// Empty returns true if nothing changed.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String describes d on one line, like:
+//
+//	+site b.com:80; -site c.com:80; ~site a.com:80 (+proxy -gzip ~log)
+func (d Diff) String() string {
+	if d.Empty() {
+		return "no changes"
+	}
+	var parts []string
+	for _, site := range d.Added {
+		parts = append(parts, "+site "+site)
+	}
+	for _, site := range d.Removed {
+		parts = append(parts, "-site "+site)
+	}
+	for _, sd := range d.Changed {
+		var dirs []string
+		for _, name := range sd.Added {
+			dirs = append(dirs, "+"+name)
+		}
+		for _, name := range sd.Removed {
+			dirs = append(dirs, "-"+name)
+		}
+		for _, name := range sd.Changed {
+			dirs = append(dirs, "~"+name)
+		}
+		parts = append(parts, "~site "+sd.Site+" ("+strings.Join(dirs, " ")+")")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// directiveText returns the tokens in d joined by spaces.
+func directiveText(d parse.Dispenser) string {
+	var tokens []string
+	for d.Next() {
+		tokens = append(tokens, d.Val())
+	}
+	return strings.Join(tokens, " ")
+}
+
+// The diff of the last reload, for the admin API.
+var (
+	lastDiff   *Diff
+	lastDiffMu sync.Mutex
+)
+
+// RecordDiff keeps d as the diff of the last reload.
+func RecordDiff(d Diff) {
+	lastDiffMu.Lock()
+	lastDiff = &d
+	lastDiffMu.Unlock()
+}
+
+func init() {
+	// GET /config/diff returns the diff of the last reload,
+	// or null if there hasn't been one.
+	admin.HandleFunc("/config/diff", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			admin.Error(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		lastDiffMu.Lock()
+		d := lastDiff
+		lastDiffMu.Unlock()
+		admin.WriteJSON(w, http.StatusOK, d)
+	})
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	old, err := Load("sites.conf", strings.NewReader(`
+a.com:80 {
+	gzip
+	log access.log
+	root /srv/a
+}
+c.com:80 {
+	gzip
+}
+d.com:80 {
+	gzip
+}`))
+	if err != nil {
+		t.Fatalf("Expected no error loading old config, got: %v", err)
+	}
+	new, err := Load("sites.conf", strings.NewReader(`
+a.com:80 {
+	# comments and spacing don't matter
+	log   access.log
+	root /srv/a2
+	proxy /api localhost:9000
+}
+b.com:80 {
+	gzip
+}
+d.com:80 {
+	gzip
+}`))
+	if err != nil {
+		t.Fatalf("Expected no error loading new config, got: %v", err)
+	}
+
+	diff := DiffConfigs("sites.conf", old, new)
+	expected := "+site b.com:80; -site c.com:80; ~site a.com:80 (+proxy -gzip ~root)"
+	if actual := diff.String(); actual != expected {
+		t.Errorf("Expected diff %q, got %q", expected, actual)
+	}
+	if diff.File != "sites.conf" || diff.Empty() {
+		t.Errorf("Expected a diff for sites.conf, got %+v", diff)
+	}
+
+	if diff := DiffConfigs("sites.conf", new, new); !diff.Empty() || diff.String() != "no changes" {
+		t.Errorf("Expected no changes, got %q", diff)
+	}
+}
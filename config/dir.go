@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/server"
+)
+
+// LoadFile loads the configuration in the file named filename.
+func LoadFile(filename string) ([]server.Config, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return []server.Config{}, err
+	}
+	defer file.Close()
+	return Load(filename, file)
+}
+
+// LoadDir loads every configuration file in the directory dir
+// (as listed by DirFiles) and merges them into one list. This
+// lets many independently-managed sites be kept in one
+// conf.d-style directory, one or more sites per file. It is an
+// error for two files to define the same site address.
+//
+// The HTTPS redirect a file gets for a managed site is left out
+// if another file defines a site on port 80 for the same host,
+// or already has a redirect for it.
+func LoadDir(dir string) ([]server.Config, error) {
+	var configs []server.Config
+
+	files, err := DirFiles(dir)
+	if err != nil {
+		return configs, err
+	}
+
+	defined := make(map[string]string) // site address -> file
+	for _, file := range files {
+		fileConfigs, err := LoadFile(file)
+		if err != nil {
+			return configs, err
+		}
+		for _, conf := range fileConfigs {
+			if conf.HTTPSRedirect {
+				continue
+			}
+			if other, exists := defined[conf.Address()]; exists {
+				return configs, fmt.Errorf("%s: site %s is already defined in %s", file, conf.Address(), other)
+			}
+			defined[conf.Address()] = file
+		}
+		configs = append(configs, fileConfigs...)
+	}
+
+	return dropRedirects(configs), nil
+}
+
+// dropRedirects returns configs without the HTTPS redirects
+// for hosts that another site on port 80 in configs serves.
+func dropRedirects(configs []server.Config) []server.Config {
+	served := make(map[string]bool)
+	for _, conf := range configs {
+		if isHTTP(conf) && !conf.HTTPSRedirect {
+			served[conf.Host] = true
+		}
+	}
+
+	var kept []server.Config
+	for _, conf := range configs {
+		if conf.HTTPSRedirect {
+			if served[conf.Host] {
+				continue
+			}
+			served[conf.Host] = true
+		}
+		kept = append(kept, conf)
+	}
+	return kept
+}
+
+// DirFiles returns the paths of the configuration files in dir,
+// sorted by name. Subdirectories, hidden files, and editor
+// backup files (ending in ~) are skipped.
+func DirFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, info := range infos {
+		name := info.Name()
+		if !info.Mode().IsRegular() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// DirWatcher detects changes to the configuration files in a
+// directory so that only the files that changed need reloading.
+type DirWatcher struct {
+	Dir      string
+	modTimes map[string]time.Time
+}
+
+// NewDirWatcher returns a watcher for dir which considers
+// the files currently in it to be unchanged.
+func NewDirWatcher(dir string) (*DirWatcher, error) {
+	w := &DirWatcher{Dir: dir}
+	_, err := w.Changed()
+	return w, err
+}
+
+// Changed returns the files in the directory that were added,
+// modified, or removed since the last call to Changed.
+func (w *DirWatcher) Changed() ([]string, error) {
+	files, err := DirFiles(w.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	modTimes := make(map[string]time.Time)
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue // removed since listing; will be noticed next time
+		}
+		modTimes[file] = info.ModTime()
+		if last, ok := w.modTimes[file]; !ok || !last.Equal(info.ModTime()) {
+			changed = append(changed, file)
+		}
+	}
+	for file := range w.modTimes {
+		if _, ok := modTimes[file]; !ok {
+			changed = append(changed, file)
+		}
+	}
+
+	if w.modTimes == nil {
+		changed = nil // the first look establishes what "unchanged" is
+	}
+	w.modTimes = modTimes
+	sort.Strings(changed)
+
+	return changed, nil
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/server"
+)
+
+func TestLoadDirRedirects(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, contents string) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a.conf's managed site gets a redirect on port 80, which
+	// b.conf's own site on port 80 takes the place of
+	writeFile("a.conf", "https://example.com\ntls admin@example.com")
+	writeFile("b.conf", "http://example.com\nroot /srv")
+
+	configs, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var plain []server.Config
+	for _, conf := range configs {
+		if isHTTP(conf) {
+			plain = append(plain, conf)
+		}
+	}
+	if len(plain) != 1 || plain[0].HTTPSRedirect || plain[0].ConfigFile != filepath.Join(dir, "b.conf") {
+		t.Errorf("Expected only b.conf's site on port 80, got %+v", plain)
+	}
+
+	// without it, the redirect stays
+	if err := os.Remove(filepath.Join(dir, "b.conf")); err != nil {
+		t.Fatal(err)
+	}
+	configs, err = LoadDir(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var redirects int
+	for _, conf := range configs {
+		if conf.HTTPSRedirect {
+			redirects++
+		}
+	}
+	if redirects != 1 {
+		t.Errorf("Expected a redirect for a.conf's site, got %d", redirects)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_confd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile := func(name, contents string) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("b.example.com", "b.example.com:8080\nroot /srv/b")
+	writeFile("a.example.com", "a.example.com:8080\nroot /srv/a")
+	writeFile(".hidden", "c.example.com:8080")
+	writeFile("a.example.com~", "a.example.com:8080")
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("Expected 2 configs, got %d", len(configs))
+	}
+	for i, expected := range []struct{ host, root, file string }{
+		{"a.example.com", "/srv/a", filepath.Join(dir, "a.example.com")},
+		{"b.example.com", "/srv/b", filepath.Join(dir, "b.example.com")},
+	} {
+		if configs[i].Host != expected.host {
+			t.Errorf("Config %d: Expected host %s, got %s", i, expected.host, configs[i].Host)
+		}
+		if configs[i].Root != expected.root {
+			t.Errorf("Config %d: Expected root %s, got %s", i, expected.root, configs[i].Root)
+		}
+		if configs[i].ConfigFile != expected.file {
+			t.Errorf("Config %d: Expected config file %s, got %s", i, expected.file, configs[i].ConfigFile)
+		}
+	}
+
+	// The same site in two files is an error
+	writeFile("c.example.com", "b.example.com:8080")
+	if _, err := LoadDir(dir); err == nil {
+		t.Error("Expected error for site defined in two files, but got none")
+	}
+}
+
+func TestDirWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_confd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	if err := ioutil.WriteFile(a, []byte("a:80"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewDirWatcher(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(step string, expected []string) {
+		changed, err := w.Changed()
+		if err != nil {
+			t.Fatalf("%s: Expected no error, got: %v", step, err)
+		}
+		if !reflect.DeepEqual(changed, expected) {
+			t.Errorf("%s: Expected changed files %v, got %v", step, expected, changed)
+		}
+	}
+
+	check("Unchanged", nil)
+
+	if err := ioutil.WriteFile(b, []byte("b:80"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	check("Added", []string{b})
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(a, later, later); err != nil {
+		t.Fatal(err)
+	}
+	check("Modified", []string{a})
+
+	if err := os.Remove(b); err != nil {
+		t.Fatal(err)
+	}
+	check("Removed", []string{b})
+}
@@ -39,40 +39,99 @@ func init() {
 // pages, so it must be registered before the errors
 // middleware and any others that would write to the
 // response.
+//
+// Each directive also says what happens if it appears more than
+// once in a site. Those that make middleware usually merge all
+// of their occurrences, so their setup function gets them all;
+// plain settings take the last value, so a site can override one
+// imported from a snippet; and those that would be ambiguous if
+// given twice are an error.
 var directiveOrder = []directive{
 	// Essential directives that initialize vital configuration settings
-	{"root", setup.Root},
-	{"tls", setup.TLS},
-	{"bind", setup.BindHost},
+	{"root", setup.Root, lastWins},
+	{"tls", setup.TLS, unique},
+	{"bind", setup.BindHost, unique},
+	{"limits", setup.Limits, merge},
+	{"paths", setup.Paths, lastWins},
+	{"reject", setup.Reject, merge},
+	{"perms", setup.Perms, lastWins},
+	{"storage", setup.Storage, lastWins},
+	{"memcache", setup.MemCache, lastWins},
+	{"metadata", setup.Metadata, lastWins},
+	{"files", setup.Files, merge},
+	{"downloads", setup.Downloads, merge},
+	{"multipart", setup.Multipart, lastWins},
+	{"panic", setup.Panic, lastWins},
+	{"locales", setup.Locales, lastWins},
+	{"disable", setup.Disable, merge},
 
 	// Other directives that don't create HTTP handlers
-	{"startup", setup.Startup},
-	{"shutdown", setup.Shutdown},
+	{"startup", setup.Startup, merge},
+	{"shutdown", setup.Shutdown, merge},
+	{"cron", setup.Cron, merge},
+	{"warmup", setup.Warmup, merge},
 
 	// Directives that inject handlers (middleware)
-	{"log", setup.Log},
-	{"gzip", setup.Gzip},
-	{"errors", setup.Errors},
-	{"header", setup.Headers},
-	{"rewrite", setup.Rewrite},
-	{"redir", setup.Redir},
-	{"ext", setup.Ext},
-	{"basicauth", setup.BasicAuth},
-	{"internal", setup.Internal},
-	{"proxy", setup.Proxy},
-	{"fastcgi", setup.FastCGI},
-	{"websocket", setup.WebSocket},
-	{"markdown", setup.Markdown},
-	{"templates", setup.Templates},
-	{"browse", setup.Browse},
+	{"slowlog", setup.SlowLog, merge},
+	{"alert", setup.Alert, merge},
+	{"log", setup.Log, merge},
+	{"canonical", setup.Canonical, lastWins},
+	{"www", setup.WWW, lastWins},
+	{"methodoverride", setup.MethodOverride, merge},
+	{"gzip", setup.Gzip, merge},
+	{"errors", setup.Errors, merge},
+	{"ratelimit", setup.RateLimit, merge},
+	{"header", setup.Headers, merge},
+	{"charset", setup.Charset, merge},
+	{"attachment", setup.Attachment, merge},
+	{"collect", setup.Collect, merge},
+	{"intercept", setup.Intercept, merge},
+	{"rewrite", setup.Rewrite, merge},
+	{"abtest", setup.ABTest, merge},
+	{"redir", setup.Redir, merge},
+	{"shortlinks", setup.Shortlinks, merge},
+	{"netutil", setup.NetUtil, merge},
+	{"ext", setup.Ext, merge},
+	{"basicauth", setup.BasicAuth, merge},
+	{"hotlink", setup.Hotlink, merge},
+	{"signedurl", setup.SignedURL, merge},
+	{"internal", setup.Internal, merge},
+	{"handle_host", nil, merge}, // set up by the config package itself
+	{"scope", nil, merge},       // set up by the config package itself
+	{"decompress", setup.Decompress, merge},
+	{"proxy", setup.Proxy, merge},
+	{"fastcgi", setup.FastCGI, merge},
+	{"websocket", setup.WebSocket, merge},
+	{"markdown", setup.Markdown, merge},
+	{"templates", setup.Templates, merge},
+	{"browse", setup.Browse, merge},
 }
 
-// directive ties together a directive name with its setup function.
+// directive ties together a directive name with its setup function
+// and what to do if it appears more than once in a site.
 type directive struct {
-	name  string
-	setup SetupFunc
+	name       string
+	setup      SetupFunc
+	duplicates duplicatePolicy
 }
 
+// duplicatePolicy is what to do with a directive
+// that appears more than once in the same site.
+type duplicatePolicy int
+
+const (
+	// merge passes all occurrences to the setup
+	// function, which combines them as it sees fit
+	merge duplicatePolicy = iota
+
+	// lastWins passes only the last occurrence
+	// to the setup function; the others are ignored
+	lastWins
+
+	// unique makes more than one occurrence an error
+	unique
+)
+
 // A setup function takes a setup controller. Its return values may
 // both be nil. If middleware is not nil, it will be chained into
 // the HTTP handlers in the order specified in this package.
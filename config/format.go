@@ -0,0 +1,72 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/mholt/caddy/config/caddyfile"
+)
+
+// Format reads the Caddyfile in input and returns it in canonical
+// form: consistently indented and quoted, with the directives in
+// each server block in the order they are executed. Comments stay
+// with the lines they describe. Directives aren't moved past an
+// import, since the imported lines could depend on the order.
+// Syntax errors and unknown directives are reported with the
+// file name and line number.
+func Format(filename string, input io.Reader) ([]byte, error) {
+	f, err := caddyfile.Parse(filename, input)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range f.Blocks {
+		if len(b.Addresses) == 0 {
+			continue
+		}
+		for _, d := range b.Directives {
+			if d.Name != "import" && !validDirective(d.Name) {
+				return nil, fmt.Errorf("%s:%d - Parse error: Unknown directive '%s'", filename, d.Line, d.Name)
+			}
+		}
+		sortDirectives(b.Directives)
+	}
+
+	var buf bytes.Buffer
+	_, err = f.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+// sortDirectives sorts dirs into the order in which
+// they are executed, without moving any past an import.
+func sortDirectives(dirs []*caddyfile.Directive) {
+	start := 0
+	for i := 0; i <= len(dirs); i++ {
+		if i == len(dirs) || dirs[i].Name == "import" {
+			sort.Stable(byDirectiveOrder(dirs[start:i]))
+			start = i + 1
+		}
+	}
+}
+
+// byDirectiveOrder sorts directives by their place in directiveOrder.
+type byDirectiveOrder []*caddyfile.Directive
+
+func (d byDirectiveOrder) Len() int      { return len(d) }
+func (d byDirectiveOrder) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d byDirectiveOrder) Less(i, j int) bool {
+	return directiveIndex(d[i].Name) < directiveIndex(d[j].Name)
+}
+
+// directiveIndex returns the position of the
+// directive named name in directiveOrder.
+func directiveIndex(name string) int {
+	for i, dir := range directiveOrder {
+		if dir.name == name {
+			return i
+		}
+	}
+	return len(directiveOrder)
+}
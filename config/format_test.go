@@ -0,0 +1,70 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	for i, test := range []struct {
+		input       string
+		shouldErr   bool
+		expected    string
+		expectedErr string
+	}{
+		{`localhost:2015 {
+browse
+  # compress everything
+  gzip
+root    "/srv/my site"
+}`, false, `localhost:2015 {
+	root "/srv/my site"
+	# compress everything
+	gzip
+	browse
+}
+`, ""},
+
+		// directives don't move past imports
+		{`localhost {
+	gzip
+	root /srv
+	import common.conf
+	browse
+	log
+}`, false, `localhost {
+	root /srv
+	gzip
+	import common.conf
+	log
+	browse
+}
+`, ""},
+
+		{`localhost {
+	root /srv
+	gizp
+}`, true, "", "Caddyfile:3 - Parse error: Unknown directive 'gizp'"},
+
+		{`localhost {
+	root /srv
+`, true, "", "Caddyfile:2 - Parse error: Unexpected EOF - expected '}'"},
+	} {
+		out, err := Format("Caddyfile", strings.NewReader(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error, got none", i)
+			} else if err.Error() != test.expectedErr {
+				t.Errorf("Test %d: Expected error %q, got %q", i, test.expectedErr, err.Error())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+			continue
+		}
+		if string(out) != test.expected {
+			t.Errorf("Test %d: Expected:\n%s\nGot:\n%s", i, test.expected, out)
+		}
+	}
+}
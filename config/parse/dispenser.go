@@ -169,13 +169,14 @@ func (d *Dispenser) Args(targets ...*string) bool {
 
 // RemainingArgs loads any more arguments (tokens on the same line)
 // into a slice and returns them. Open curly brace tokens also indicate
-// the end of arguments, and the curly brace is not included in
-// the return value nor is it loaded.
+// the end of arguments, as do closing ones inside a block (so that a
+// block can close on the same line as its last arguments), and the
+// curly brace is not included in the return value nor is it loaded.
 func (d *Dispenser) RemainingArgs() []string {
 	var args []string
 
 	for d.NextArg() {
-		if d.Val() == "{" {
+		if d.Val() == "{" || d.Val() == "}" && d.nesting > 0 {
 			d.cursor--
 			break
 		}
@@ -243,3 +244,28 @@ func (d *Dispenser) isNewLine() bool {
 	return d.tokens[d.cursor-1].file != d.tokens[d.cursor].file ||
 		d.tokens[d.cursor-1].line+d.numLineBreaks(d.cursor-1) < d.tokens[d.cursor].line
 }
+
+// Occurrences splits the tokens of d, which must be those of
+// a single directive as a server block gathers them, into one
+// Dispenser for each time the directive appears, in order.
+func (d Dispenser) Occurrences() []Dispenser {
+	var occurrences []Dispenser
+	d.cursor, d.nesting = -1, 0
+
+	start, nesting := 0, 0
+	for d.Next() {
+		if d.cursor > start && nesting == 0 && d.isNewLine() {
+			occurrences = append(occurrences, NewDispenserTokens(d.filename, d.tokens[start:d.cursor]))
+			start = d.cursor
+		}
+		if d.Val() == "{" {
+			nesting++
+		} else if d.Val() == "}" && nesting > 0 {
+			nesting--
+		}
+	}
+	if start < len(d.tokens) {
+		occurrences = append(occurrences, NewDispenserTokens(d.filename, d.tokens[start:]))
+	}
+	return occurrences
+}
@@ -259,6 +259,31 @@ func TestDispenser_RemainingArgs(t *testing.T) {
 	}
 }
 
+func TestDispenser_RemainingArgsBlockEnd(t *testing.T) {
+	input := `dir1 { sub1 arg1 arg2 }
+			  dir2 arg3 }`
+	d := NewDispenser("Testfile", strings.NewReader(input))
+
+	d.Next() // dir1
+	if !d.NextBlock() || d.Val() != "sub1" {
+		t.Fatalf("Expected to be in the block at sub1, got %s", d.Val())
+	}
+	args := d.RemainingArgs()
+	if expected := []string{"arg1", "arg2"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("RemainingArgs(): Expected %v, got %v", expected, args)
+	}
+	if d.NextBlock() {
+		t.Errorf("Expected the block to end, got %s", d.Val())
+	}
+
+	// outside a block, a closing brace is just an argument
+	d.Next() // dir2
+	args = d.RemainingArgs()
+	if expected := []string{"arg3", "}"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("RemainingArgs(): Expected %v, got %v", expected, args)
+	}
+}
+
 func TestDispenser_ArgErr_Err(t *testing.T) {
 	input := `dir1 {
 			  }
@@ -290,3 +315,31 @@ func TestDispenser_ArgErr_Err(t *testing.T) {
 		t.Errorf("Expected error message with custom message in it ('foobar'); got '%v'", err)
 	}
 }
+
+func TestDispenser_Occurrences(t *testing.T) {
+	input := `gzip
+			  gzip {
+			      ext .html
+			      level 5
+			  }
+			  gzip /api {
+			  }`
+	d := NewDispenser("Testfile", strings.NewReader(input))
+
+	occurrences := d.Occurrences()
+	if len(occurrences) != 3 {
+		t.Fatalf("Expected 3 occurrences, got %d", len(occurrences))
+	}
+	for i, want := range []int{1, 7, 4} {
+		if got := len(occurrences[i].tokens); got != want {
+			t.Errorf("Occurrence %d: Expected %d tokens, got %d", i, want, got)
+		}
+		if !occurrences[i].Next() || occurrences[i].Val() != "gzip" {
+			t.Errorf("Occurrence %d: Expected to start with gzip, got '%s'", i, occurrences[i].Val())
+		}
+	}
+
+	if got := len(NewDispenser("Testfile", strings.NewReader("")).Occurrences()); got != 0 {
+		t.Errorf("Expected no occurrences without tokens, got %d", got)
+	}
+}
@@ -0,0 +1,62 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+// The fuzz targets below run their seed corpus as ordinary
+// tests; run them with -fuzz to search for crashes, e.g.:
+//
+//	go test -fuzz=FuzzServerBlocks ./config/parse
+
+func FuzzLexer(f *testing.F) {
+	for _, seed := range []string{
+		"host:123",
+		"host:123\n\ndirective",
+		`host:123 { directive "quoted \"arg\"" }`,
+		"# comment\nhost # trailing",
+		"\"unterminated",
+		"a\\",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		line := 1
+		for _, tkn := range allTokens(strings.NewReader(input)) {
+			if tkn.line < line {
+				t.Fatalf("Token %q on line %d comes after line %d", tkn.text, tkn.line, line)
+			}
+			line = tkn.line
+		}
+	})
+}
+
+func FuzzServerBlocks(f *testing.F) {
+	for _, seed := range []string{
+		"localhost",
+		"localhost:8080 dir1",
+		"http://host1, https://host2:1234 {\n\tdir1 a b\n\tdir2 {\n\t\tsub\n\t}\n}",
+		"host1 {\n}\nhost2 {\n\tdir3\n}",
+		"import import_test1.txt",
+		"host {\n\timport import_test3.txt a b\n}",
+		"[::1]:80 {",
+		"}",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		setupParseTests()
+		blocks, err := ServerBlocks("Testfile", strings.NewReader(input))
+		if err != nil {
+			return
+		}
+		for _, sb := range blocks {
+			for dir := range sb.Tokens {
+				if _, ok := ValidDirectives[dir]; !ok {
+					t.Fatalf("Parsed unknown directive %q", dir)
+				}
+			}
+		}
+	})
+}
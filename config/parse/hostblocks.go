@@ -0,0 +1,92 @@
+package parse
+
+// HostBlock is a block of directives that only apply to requests
+// for some of the hosts of a site, as given to handle_host:
+//
+//	handle_host api.example.com *.api.example.com {
+//		proxy / localhost:8080
+//	}
+type HostBlock struct {
+	Hosts  []string
+	Tokens map[string][]token // the tokens of each directive in the block
+}
+
+// PathBlock is a block of directives that handle the requests
+// under some paths of a site instead of those of the site itself,
+// as given to scope:
+//
+//	scope /static /assets {
+//		gzip
+//	}
+type PathBlock struct {
+	Paths  []string
+	Tokens map[string][]token // the tokens of each directive in the block
+}
+
+// HostBlocks parses the handle_host directives dispensed by d
+// into their blocks, whose directives are organized like those
+// of a server block. Each must have at least one host and a block.
+func HostBlocks(d Dispenser) ([]HostBlock, error) {
+	var blocks []HostBlock
+	err := directiveBlocks(d, func(args []string, tokens map[string][]token) {
+		blocks = append(blocks, HostBlock{Hosts: args, Tokens: tokens})
+	})
+	return blocks, err
+}
+
+// PathBlocks parses the scope directives dispensed by d into
+// their blocks, like HostBlocks. Each must have at least one
+// path and a block.
+func PathBlocks(d Dispenser) ([]PathBlock, error) {
+	var blocks []PathBlock
+	err := directiveBlocks(d, func(args []string, tokens map[string][]token) {
+		blocks = append(blocks, PathBlock{Paths: args, Tokens: tokens})
+	})
+	return blocks, err
+}
+
+// directiveBlocks parses each occurrence of the directive dispensed
+// by d, which takes arguments and a block of directives, and calls
+// add with its arguments and the tokens of each directive in it.
+func directiveBlocks(d Dispenser, add func(args []string, tokens map[string][]token)) error {
+	p := parser{Dispenser: d}
+
+	for p.Next() {
+		args := p.RemainingArgs()
+		if len(args) == 0 {
+			return p.ArgErr()
+		}
+		if !p.Next() {
+			return p.EofErr()
+		}
+		if err := p.openCurlyBrace(); err != nil {
+			return err
+		}
+
+		p.block = multiServerBlock{tokens: make(map[string][]token)}
+		closed := false
+		for p.Next() {
+			if p.Val() == "}" {
+				closed = true
+				break
+			}
+			if p.Val() == "import" {
+				if err := p.doImport(); err != nil {
+					return err
+				}
+				p.cursor-- // cursor is advanced when we continue, so roll back one more
+				continue
+			}
+			if err := p.directive(); err != nil {
+				return err
+			}
+		}
+		if !closed {
+			return p.EofErr()
+		}
+
+		add(args, p.block.tokens)
+	}
+
+	return nil
+}
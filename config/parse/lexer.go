@@ -15,6 +15,7 @@ type (
 		reader *bufio.Reader
 		token  token
 		line   int
+		err    error // error reading the input, other than io.EOF
 	}
 
 	// token represents a single parsable unit.
@@ -41,7 +42,8 @@ func (l *lexer) load(input io.Reader) error {
 // with a preceding \ character. No other chars
 // may be escaped. The rest of the line is skipped
 // if a "#" character is read in. Returns true if
-// a token was loaded; false otherwise.
+// a token was loaded; false otherwise. If reading
+// the input fails, the error is kept in l.err.
 func (l *lexer) next() bool {
 	var val []rune
 	var comment, quoted, escaped bool
@@ -57,10 +59,10 @@ func (l *lexer) next() bool {
 			if len(val) > 0 {
 				return makeToken()
 			}
-			if err == io.EOF {
-				return false
+			if err != io.EOF {
+				l.err = err
 			}
-			panic(err)
+			return false
 		}
 
 		if quoted {
@@ -1,13 +1,21 @@
 // Package parse provides facilities for parsing configuration files.
 package parse
 
-import "io"
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
 
 // ServerBlocks parses the input just enough to organize tokens,
 // in order, by server block. No further parsing is performed.
 // Server blocks are returned in the order in which they appear.
 func ServerBlocks(filename string, input io.Reader) ([]serverBlock, error) {
-	p := parser{Dispenser: NewDispenser(filename, input)}
+	body, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{Dispenser: NewDispenser(filename, bytes.NewReader(body))}
 	blocks, err := p.parseAll()
 	return blocks, err
 }
@@ -1,18 +1,28 @@
 package parse
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
 	"net"
-	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
 type parser struct {
 	Dispenser
-	block multiServerBlock // current server block being parsed
-	eof   bool             // if we encounter a valid EOF in a hard place
+	block   multiServerBlock // current server block being parsed
+	eof     bool             // if we encounter a valid EOF in a hard place
+	imports int              // number of imports done so far
 }
 
+// maxImports is how many imports one file may do, counting
+// those in imported files; an import cycle would otherwise
+// go on forever.
+const maxImports = 1000
+
 func (p *parser) parseAll() ([]serverBlock, error) {
 	var blocks []serverBlock
 
@@ -23,11 +33,21 @@ func (p *parser) parseAll() ([]serverBlock, error) {
 		}
 
 		// explode the multiServerBlock into multiple serverBlocks
+		var hosts, aliases []string
 		for _, addr := range p.block.addresses {
+			hosts = append(hosts, addr.host)
+		}
+		for _, addr := range p.block.aliases {
+			hosts = append(hosts, addr.host)
+			aliases = append(aliases, addr.host)
+		}
+		for _, addr := range append(p.block.addresses, p.block.aliases...) {
 			blocks = append(blocks, serverBlock{
-				Host:   addr.host,
-				Port:   addr.port,
-				Tokens: p.block.tokens,
+				Host:    addr.host,
+				Port:    addr.port,
+				Hosts:   hosts,
+				Aliases: aliases,
+				Tokens:  p.block.tokens,
 			})
 		}
 	}
@@ -71,7 +91,7 @@ func (p *parser) begin() error {
 }
 
 func (p *parser) addresses() error {
-	var expectingAnother bool
+	var expectingAnother, aliasing bool
 
 	for {
 		tkn := p.Val()
@@ -82,6 +102,10 @@ func (p *parser) addresses() error {
 			if err != nil {
 				return err
 			}
+			if p.cursor >= len(p.tokens) {
+				p.eof = true // nothing was imported at the end of the file
+				break
+			}
 			continue
 		}
 
@@ -93,9 +117,22 @@ func (p *parser) addresses() error {
 			break
 		}
 
+		// The addresses after alias are other names of the site,
+		// which the canonical directive can redirect to the first
+		if tkn == "alias" && len(p.block.addresses) > 0 {
+			if aliasing {
+				return p.Err("Expected alias only once")
+			}
+			aliasing = true
+			if !p.Next() || p.Val() == "{" || (!expectingAnother && p.isNewLine()) {
+				return p.Err("Expected an address after alias")
+			}
+			continue
+		}
+
 		// Trailing comma indicates another address will follow, which
 		// may possibly be on the next line
-		if tkn[len(tkn)-1] == ',' {
+		if strings.HasSuffix(tkn, ",") {
 			tkn = tkn[:len(tkn)-1]
 			expectingAnother = true
 		} else {
@@ -107,7 +144,11 @@ func (p *parser) addresses() error {
 		if err != nil {
 			return err
 		}
-		p.block.addresses = append(p.block.addresses, address{host, port})
+		if aliasing {
+			p.block.aliases = append(p.block.aliases, address{host, port})
+		} else {
+			p.block.addresses = append(p.block.addresses, address{host, port})
+		}
 
 		// Advance token and possibly break out of loop or return error
 		hasNext := p.Next()
@@ -178,42 +219,83 @@ func (p *parser) directives() error {
 	return nil
 }
 
-// doImport swaps out the import directive and its argument
-// (a total of 2 tokens) with the tokens in the file specified.
-// When the function returns, the cursor is on the token before
-// where the import directive was. In other words, call Next()
-// to access the first token that was imported.
+// doImport swaps out the import directive and its arguments with
+// the tokens in the file(s) specified. The first argument is a file
+// name or a glob pattern matching the files to import, in order; any
+// other arguments are substituted for the {args.N} placeholders in
+// the imported tokens, so one snippet can be reused with different
+// values. When the function returns, the cursor is on the first
+// token that was imported.
 func (p *parser) doImport() error {
+	start := p.cursor
 	if !p.NextArg() {
 		return p.ArgErr()
 	}
-	importFile := p.Val()
-	if p.NextArg() {
-		return p.Err("Import allows only one file to import")
+	importPattern := p.Val()
+	args := p.RemainingArgs()
+
+	p.imports++
+	if p.imports > maxImports {
+		return p.Errf("Could not import %s - more than %d imports; is there an import cycle?", importPattern, maxImports)
 	}
 
-	file, err := os.Open(importFile)
+	importFiles, err := filepath.Glob(importPattern)
 	if err != nil {
-		return p.Errf("Could not import %s - %v", importFile, err)
+		return p.Errf("Could not import %s - %v", importPattern, err)
+	}
+	if len(importFiles) == 0 && !strings.ContainsAny(importPattern, "*?[") {
+		// not a pattern, so the file must exist
+		importFiles = []string{importPattern}
 	}
-	defer file.Close()
-	importedTokens := allTokens(file)
 
-	// Tack the filename onto these tokens so any errors show the imported file's name
-	for i := 0; i < len(importedTokens); i++ {
-		importedTokens[i].file = filepath.Base(importFile)
+	var importedTokens []token
+	for _, importFile := range importFiles {
+		body, err := ioutil.ReadFile(importFile)
+		if err != nil {
+			return p.Errf("Could not import %s - %v", importFile, err)
+		}
+		tokens := allTokens(bytes.NewReader(body))
+
+		// Tack the filename onto these tokens so any errors show the imported file's name
+		for i := 0; i < len(tokens); i++ {
+			tokens[i].file = filepath.Base(importFile)
+			tokens[i].text, err = replaceImportArgs(tokens[i].text, args)
+			if err != nil {
+				return p.Errf("Could not import %s - %v", importFile, err)
+			}
+		}
+		importedTokens = append(importedTokens, tokens...)
 	}
 
-	// Splice out the import directive and its argument (2 tokens total)
+	// Splice out the import directive and its arguments
 	// and insert the imported tokens in their place.
-	tokensBefore := p.tokens[:p.cursor-1]
+	tokensBefore := p.tokens[:start]
 	tokensAfter := p.tokens[p.cursor+1:]
 	p.tokens = append(tokensBefore, append(importedTokens, tokensAfter...)...)
-	p.cursor-- // cursor was advanced one position to read the filename; rewind it
+	p.cursor = start
 
 	return nil
 }
 
+// importArgPlaceholder matches the placeholders in an
+// imported file that are replaced by import arguments.
+var importArgPlaceholder = regexp.MustCompile(`\{args\.(\d+)\}`)
+
+// replaceImportArgs replaces the {args.N} placeholders in text
+// with the Nth (counting from 0) argument in args.
+func replaceImportArgs(text string, args []string) (string, error) {
+	var err error
+	text = importArgPlaceholder.ReplaceAllStringFunc(text, func(placeholder string) string {
+		n, _ := strconv.Atoi(importArgPlaceholder.FindStringSubmatch(placeholder)[1])
+		if n >= len(args) {
+			err = fmt.Errorf("%s used, but only %d argument(s) given", placeholder, len(args))
+			return placeholder
+		}
+		return args[n]
+	})
+	return text, err
+}
+
 // directive collects tokens until the directive's scope
 // closes (either end of line or end of curly brace block).
 // It expects the currently-loaded token to be a directive
@@ -309,6 +391,8 @@ type (
 	// single host:port (address)
 	serverBlock struct {
 		Host, Port string
+		Hosts      []string           // all the hosts in the block, in order; the first is primary
+		Aliases    []string           // the hosts in the block given after alias
 		Tokens     map[string][]token // directive name to tokens (including directive)
 	}
 
@@ -316,6 +400,7 @@ type (
 	// multiple addresses that share the same tokens
 	multiServerBlock struct {
 		addresses []address
+		aliases   []address // the addresses after alias
 		tokens    map[string][]token
 	}
 
@@ -1,6 +1,9 @@
 package parse
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -364,6 +367,62 @@ func TestParseAll(t *testing.T) {
 		t.Errorf("Expected host2 and host3 to have same tokens, but they didn't.\nhost2 Block: %v\nhost3 Block: %v",
 			blocks[1].Tokens, blocks[2].Tokens)
 	}
+
+	// ...and know all the hosts of the block they came from
+	if expected := []string{"host2", "host3"}; !reflect.DeepEqual(blocks[2].Hosts, expected) {
+		t.Errorf("Expected host3 block to have hosts %v, but had %v", expected, blocks[2].Hosts)
+	}
+}
+
+func TestParseAliases(t *testing.T) {
+	setupParseTests()
+
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		hosts     []string
+		aliases   []string
+	}{
+		{`a.com b.com alias c.net d.net {
+			dir1
+		}`, false, []string{"a.com", "b.com", "c.net", "d.net"}, []string{"c.net", "d.net"}},
+		{`a.com, alias c.net:8080
+		dir1`, false, []string{"a.com", "c.net"}, []string{"c.net"}},
+		{`a.com,
+		alias c.net`, false, []string{"a.com", "c.net"}, []string{"c.net"}},
+		{`a.com b.com`, false, []string{"a.com", "b.com"}, nil},
+		{`alias {
+			dir1
+		}`, false, []string{"alias"}, nil},
+		{`a.com alias {
+			dir1
+		}`, true, nil, nil},
+		{`a.com alias`, true, nil, nil},
+		{`a.com alias b.com alias c.com`, true, nil, nil},
+	} {
+		p := testParser(test.input)
+		blocks, err := p.parseAll()
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if len(blocks) != len(test.hosts) {
+			t.Fatalf("Test %d: Expected %d blocks, got %d", i, len(test.hosts), len(blocks))
+		}
+		for j, block := range blocks {
+			if block.Host != test.hosts[j] {
+				t.Errorf("Test %d, block %d: Expected host %s, got %s", i, j, test.hosts[j], block.Host)
+			}
+			if !reflect.DeepEqual(block.Hosts, test.hosts) || !reflect.DeepEqual(block.Aliases, test.aliases) {
+				t.Errorf("Test %d, block %d: Expected hosts %v and aliases %v, got %v and %v",
+					i, j, test.hosts, test.aliases, block.Hosts, block.Aliases)
+			}
+		}
+	}
 }
 
 func setupParseTests() {
@@ -380,3 +439,174 @@ func testParser(input string) parser {
 	p := parser{Dispenser: NewDispenser("Test", buf)}
 	return p
 }
+
+func TestImportArgs(t *testing.T) {
+	setupParseTests()
+
+	p := testParser(`import import_test3.txt example.com /srv`)
+	blocks, err := p.parseAll()
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if len(blocks) != 1 {
+		t.Fatalf("Expected 1 server block, got %d", len(blocks))
+	}
+	if blocks[0].Host != "example.com" {
+		t.Errorf("Expected host to be 'example.com', but was '%s'", blocks[0].Host)
+	}
+	if actual := blocks[0].Tokens["dir1"][1].text; actual != "/srv" {
+		t.Errorf("Expected dir1 argument to be '/srv', but was '%s'", actual)
+	}
+	if actual := blocks[0].Tokens["dir2"][1].text; actual != "/srv/example.com" {
+		t.Errorf("Expected dir2 argument to be '/srv/example.com', but was '%s'", actual)
+	}
+
+	// Too few arguments for the placeholders
+	p = testParser(`import import_test3.txt example.com`)
+	if _, err := p.parseAll(); err == nil {
+		t.Error("Expected an error for missing import argument, but didn't get one")
+	}
+
+	// Glob patterns import every matching file, in order
+	dir, err := ioutil.TempDir("", "caddy_import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"b.conf", "a.conf", "c.txt"} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name+" {\n\tdir1 {args.0}\n}\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p = testParser(`import ` + filepath.Join(dir, "*.conf") + ` foo`)
+	blocks, err = p.parseAll()
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("Expected 2 server blocks, got %d", len(blocks))
+	}
+	for i, expected := range []string{"a.conf", "b.conf"} {
+		if blocks[i].Host != expected {
+			t.Errorf("Block %d: Expected host to be '%s', but was '%s'", i, expected, blocks[i].Host)
+		}
+		if actual := blocks[i].Tokens["dir1"][1].text; actual != "foo" {
+			t.Errorf("Block %d: Expected dir1 argument to be 'foo', but was '%s'", i, actual)
+		}
+	}
+
+	// A pattern that matches nothing imports nothing
+	p = testParser(`import ` + filepath.Join(dir, "*.none"))
+	blocks, err = p.parseAll()
+	if err != nil {
+		t.Errorf("Expected no error, but got: %v", err)
+	}
+	if len(blocks) != 0 {
+		t.Errorf("Expected 0 server blocks, got %d", len(blocks))
+	}
+}
+
+func TestImportCycle(t *testing.T) {
+	setupParseTests()
+
+	p := testParser(`localhost
+import import_test_cycle.txt`)
+	_, err := p.parseAll()
+	if err == nil || !strings.Contains(err.Error(), "import cycle") {
+		t.Errorf("Expected an import cycle error, got: %v", err)
+	}
+}
+
+func TestHostBlocks(t *testing.T) {
+	setupParseTests()
+
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		hosts     [][]string
+		dir1Args  []string // of the first block's dir1, if any
+	}{
+		{`handle_host api.example.com {
+			dir1 a {
+				b
+			}
+			dir2
+		}
+		handle_host *.example.com example.org {
+			dir2 x
+		}`, false, [][]string{{"api.example.com"}, {"*.example.com", "example.org"}}, []string{"dir1", "a", "{", "b", "}"}},
+		{`handle_host {
+			dir1
+		}`, true, nil, nil},
+		{`handle_host a.com`, true, nil, nil},
+		{`handle_host a.com dir1`, true, nil, nil},
+		{`handle_host a.com {
+			dir1`, true, nil, nil},
+		{`handle_host a.com {
+			dir1 {
+				x
+			}`, true, nil, nil},
+		{`handle_host a.com {
+			nope
+		}`, true, nil, nil},
+	} {
+		blocks, err := HostBlocks(NewDispenser("Test", strings.NewReader(test.input)))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if len(blocks) != len(test.hosts) {
+			t.Fatalf("Test %d: Expected %d blocks, got %d", i, len(test.hosts), len(blocks))
+		}
+		for j, block := range blocks {
+			if !reflect.DeepEqual(block.Hosts, test.hosts[j]) {
+				t.Errorf("Test %d, block %d: Expected hosts %v, got %v", i, j, test.hosts[j], block.Hosts)
+			}
+		}
+		var args []string
+		for _, tkn := range blocks[0].Tokens["dir1"] {
+			args = append(args, tkn.text)
+		}
+		if !reflect.DeepEqual(args, test.dir1Args) {
+			t.Errorf("Test %d: Expected dir1 tokens %v, got %v", i, test.dir1Args, args)
+		}
+		if len(blocks[1].Tokens["dir2"]) != 2 || len(blocks[0].Tokens["dir2"]) != 1 {
+			t.Errorf("Test %d: Expected each block to have its own dir2, got %v and %v", i, blocks[0].Tokens["dir2"], blocks[1].Tokens["dir2"])
+		}
+	}
+}
+
+func TestPathBlocks(t *testing.T) {
+	setupParseTests()
+
+	blocks, err := PathBlocks(NewDispenser("Test", strings.NewReader(`scope /static /assets {
+		dir1
+	}
+	scope /api {
+		dir2 x
+	}`)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("Expected 2 blocks, got %d", len(blocks))
+	}
+	if !reflect.DeepEqual(blocks[0].Paths, []string{"/static", "/assets"}) || !reflect.DeepEqual(blocks[1].Paths, []string{"/api"}) {
+		t.Errorf("Expected the paths of each block, got %v and %v", blocks[0].Paths, blocks[1].Paths)
+	}
+	if len(blocks[0].Tokens["dir1"]) != 1 || len(blocks[1].Tokens["dir2"]) != 2 {
+		t.Errorf("Expected each block to have its own directives, got %v and %v", blocks[0].Tokens, blocks[1].Tokens)
+	}
+
+	if _, err := PathBlocks(NewDispenser("Test", strings.NewReader(`scope {
+		dir1
+	}`))); err == nil {
+		t.Error("Expected an error for a scope without paths")
+	}
+}
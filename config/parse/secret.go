@@ -0,0 +1,39 @@
+package parse
+
+import (
+	"os"
+	"strings"
+)
+
+// Secret returns the sensitive value given as value, like a
+// password or token. So that it need not be written in the
+// Caddyfile, value may instead refer to where it is kept:
+//
+//	file:/run/secrets/name  the contents of the file
+//	env:NAME                the environment variable NAME
+//
+// A trailing newline is left out of the file's contents. Errors
+// are reported at the current token, like those of Errf.
+func (d *Dispenser) Secret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "file:"):
+		file := strings.TrimPrefix(value, "file:")
+		body, err := os.ReadFile(file)
+		if err != nil {
+			return "", d.Errf("Reading secret: %v", err)
+		}
+		secret := strings.TrimRight(string(body), "\r\n")
+		if secret == "" {
+			return "", d.Errf("Secret file %s is empty", file)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		secret := os.Getenv(name)
+		if secret == "" {
+			return "", d.Errf("Environment variable %s for secret is not set", name)
+		}
+		return secret, nil
+	}
+	return value, nil
+}
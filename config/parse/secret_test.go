@@ -0,0 +1,50 @@
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecret(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "secret")
+	if err := os.WriteFile(file, []byte("from a file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CADDY_TEST_SECRET", "from the environment")
+
+	for i, test := range []struct {
+		value     string
+		shouldErr bool
+		expected  string
+	}{
+		{"verbatim", false, "verbatim"},
+		{"file:" + file, false, "from a file"},
+		{"env:CADDY_TEST_SECRET", false, "from the environment"},
+		{"file:" + filepath.Join(dir, "missing"), true, ""},
+		{"file:" + empty, true, ""},
+		{"env:CADDY_TEST_SECRET_UNSET", true, ""},
+	} {
+		d := NewDispenser("Testfile", strings.NewReader(""))
+		actual, err := d.Secret(test.value)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if actual != test.expected {
+			t.Errorf("Test %d: Expected secret %q, got %q", i, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/admin"
+	"github.com/mholt/caddy/middleware"
+)
+
+// HistoryDir is the name of the directory, inside a configuration
+// directory, where copies of files that loaded successfully are
+// kept for manual rollback. DirFiles skips it because it is hidden.
+const HistoryDir = ".history"
+
+// historyTimeFormat names the copies in HistoryDir so that
+// they sort oldest first.
+const historyTimeFormat = "20060102-150405.000000000"
+
+// ReloadStatus describes the outcome of the last attempt to
+// reload a configuration file.
+type ReloadStatus struct {
+	File  string    `json:"file"`
+	Time  time.Time `json:"time"`
+	OK    bool      `json:"ok"`
+	Error string    `json:"error,omitempty"` // why the previous configuration was kept
+	Diff  *Diff     `json:"diff,omitempty"`  // what changed, if it was reloaded
+}
+
+// The outcome of the last reload of each file, for the admin API.
+var (
+	reloads   = make(map[string]ReloadStatus)
+	reloadsMu sync.Mutex
+)
+
+// RecordReload keeps the outcome of reloading file: err is the
+// reason the reload failed, or nil if it succeeded with diff.
+func RecordReload(file string, diff Diff, err error) {
+	status := ReloadStatus{File: file, Time: time.Now(), OK: err == nil}
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Diff = &diff
+		RecordDiff(diff)
+	}
+	reloadsMu.Lock()
+	reloads[file] = status
+	reloadsMu.Unlock()
+}
+
+// ReloadStatuses returns the outcome of the last reload
+// of each file, sorted by file name.
+func ReloadStatuses() []ReloadStatus {
+	reloadsMu.Lock()
+	defer reloadsMu.Unlock()
+	statuses := []ReloadStatus{}
+	for _, status := range reloads {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].File < statuses[j].File })
+	return statuses
+}
+
+// SaveHistory copies the configuration file into HistoryDir next
+// to it, then removes all but the keep newest copies of it. Nothing
+// is copied if the file is the same as the newest copy, or if
+// keep is 0. The copies and HistoryDir get perms, which are
+// private to the owner unless perms set their modes.
+func SaveHistory(file string, keep int, perms middleware.FilePerms) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	body, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(filepath.Dir(file), HistoryDir)
+	perms = perms.Defaults(0600, 0700)
+	err = perms.MkdirAll(dir)
+	if err != nil {
+		return err
+	}
+
+	copies, err := History(file)
+	if err != nil {
+		return err
+	}
+	if n := len(copies); n > 0 {
+		last, err := ioutil.ReadFile(copies[n-1])
+		if err == nil && bytes.Equal(last, body) {
+			return nil
+		}
+	}
+
+	name := filepath.Join(dir, filepath.Base(file)+"."+time.Now().Format(historyTimeFormat))
+	err = perms.WriteFile(name, body)
+	if err != nil {
+		return err
+	}
+	copies = append(copies, name)
+
+	for len(copies) > keep {
+		err := os.Remove(copies[0])
+		if err != nil {
+			return err
+		}
+		copies = copies[1:]
+	}
+	return nil
+}
+
+// History returns the paths of the copies of the configuration
+// file kept by SaveHistory, oldest first.
+func History(file string) ([]string, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(filepath.Dir(file), HistoryDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Base(file) + "."
+	var copies []string
+	for _, info := range infos {
+		name := info.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, err := time.Parse(historyTimeFormat, name[len(prefix):]); err != nil {
+			continue // another file's copy whose name starts the same
+		}
+		copies = append(copies, filepath.Join(filepath.Dir(file), HistoryDir, name))
+	}
+	sort.Strings(copies)
+	return copies, nil
+}
+
+func init() {
+	// GET /config/status returns the outcome of the last
+	// reload of each configuration file.
+	admin.HandleFunc("/config/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			admin.Error(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, ReloadStatuses())
+	})
+}
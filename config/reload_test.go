@@ -0,0 +1,89 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestSaveHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "a.conf")
+	other := filepath.Join(dir, "a.conf.old")
+	write := func(name, body string) {
+		if err := ioutil.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(other, "other")
+	if err := SaveHistory(other, 3, middleware.FilePerms{}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	for _, body := range []string{"1", "2", "2", "3", "4"} {
+		write(file, body)
+		if err := SaveHistory(file, 3, middleware.FilePerms{}); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+
+	copies, err := History(file)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var bodies []string
+	for _, c := range copies {
+		b, err := ioutil.ReadFile(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, string(b))
+	}
+	if len(bodies) != 3 || bodies[0] != "2" || bodies[1] != "3" || bodies[2] != "4" {
+		t.Errorf("Expected the 3 newest distinct copies [2 3 4], got %v", bodies)
+	}
+
+	if copies, _ := History(other); len(copies) != 1 {
+		t.Errorf("Expected other file's copy to be kept apart, got %v", copies)
+	}
+
+	files, err := DirFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("Expected history not to be listed as configuration, got %v", files)
+	}
+}
+
+func TestRecordReload(t *testing.T) {
+	RecordReload("a.conf", Diff{File: "a.conf"}, nil)
+	RecordReload("b.conf", Diff{}, errors.New("bad directive"))
+
+	statuses := ReloadStatuses()
+	if len(statuses) < 2 {
+		t.Fatalf("Expected at least 2 statuses, got %v", statuses)
+	}
+	for _, status := range statuses {
+		switch status.File {
+		case "a.conf":
+			if !status.OK || status.Diff == nil || status.Error != "" {
+				t.Errorf("Expected a.conf to have reloaded, got %+v", status)
+			}
+		case "b.conf":
+			if status.OK || status.Diff != nil || status.Error != "bad directive" {
+				t.Errorf("Expected b.conf to have failed, got %+v", status)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package setup
+
+import (
+	"strconv"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/abtest"
+)
+
+// ABTest configures a new ABTest middleware instance. The syntax is
+//
+//	abtest [path] {
+//		variant name percent [prefix]
+//		cookie  name
+//		header  name
+//	}
+//
+// with two or more variants, whose percentages add up to 100.
+func ABTest(c *Controller) (middleware.Middleware, error) {
+	tests, err := abtestParse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return abtest.ABTest{Next: next, Tests: tests}
+	}, nil
+}
+
+func abtestParse(c *Controller) ([]abtest.Test, error) {
+	var tests []abtest.Test
+
+	for c.Next() {
+		test := abtest.Test{Path: "/"}
+
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			test.Path = args[0]
+		default:
+			return tests, c.ArgErr()
+		}
+		for _, t := range tests {
+			if t.Path == test.Path {
+				return tests, c.Errf("Duplicate abtest for %s", test.Path)
+			}
+		}
+
+		var total int
+		for c.NextBlock() {
+			switch c.Val() {
+			case "variant":
+				args := c.RemainingArgs()
+				if len(args) < 2 || len(args) > 3 {
+					return tests, c.ArgErr()
+				}
+				weight, err := strconv.Atoi(args[1])
+				if err != nil || weight < 0 || weight > 100 {
+					return tests, c.Errf("Invalid variant percentage '%s'", args[1])
+				}
+				v := abtest.Variant{Name: args[0], Weight: weight}
+				if len(args) > 2 {
+					v.Prefix = args[2]
+				}
+				for _, other := range test.Variants {
+					if other.Name == v.Name {
+						return tests, c.Errf("Duplicate variant '%s'", v.Name)
+					}
+				}
+				test.Variants = append(test.Variants, v)
+				total += weight
+			case "cookie":
+				if !c.NextArg() {
+					return tests, c.ArgErr()
+				}
+				test.Cookie = c.Val()
+			case "header":
+				if !c.NextArg() {
+					return tests, c.ArgErr()
+				}
+				test.Header = c.Val()
+			default:
+				return tests, c.Errf("Unknown abtest property '%s'", c.Val())
+			}
+		}
+
+		if len(test.Variants) < 2 {
+			return tests, c.Err("An abtest needs at least two variants")
+		}
+		if total != 100 {
+			return tests, c.Errf("Variant percentages add up to %d, not 100", total)
+		}
+
+		tests = append(tests, test)
+	}
+
+	return tests, nil
+}
@@ -0,0 +1,109 @@
+package setup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy/middleware/abtest"
+)
+
+func TestABTest(t *testing.T) {
+	c := NewTestController(`abtest /landing {
+		variant a 50
+		variant b 50 /landing-b
+	}`)
+
+	mid, err := ABTest(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	if mid == nil {
+		t.Fatal("Expected middleware, was nil instead")
+	}
+
+	handler := mid(EmptyNext)
+	myHandler, ok := handler.(abtest.ABTest)
+	if !ok {
+		t.Fatalf("Expected handler to be type ABTest, got: %#v", handler)
+	}
+	if !SameNext(myHandler.Next, EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestABTestParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []abtest.Test
+	}{
+		{`abtest {
+			variant a 90
+			variant b 10 /b
+			cookie visitor
+			header X-Test
+		}`, false, []abtest.Test{{Path: "/", Cookie: "visitor", Header: "X-Test", Variants: []abtest.Variant{
+			{Name: "a", Weight: 90}, {Name: "b", Weight: 10, Prefix: "/b"},
+		}}}},
+		{`abtest /x {
+			variant a 50
+			variant b 50 /b
+		}
+		abtest /y {
+			variant a 50
+			variant b 50 /c
+		}`, false, []abtest.Test{
+			{Path: "/x", Variants: []abtest.Variant{{Name: "a", Weight: 50}, {Name: "b", Weight: 50, Prefix: "/b"}}},
+			{Path: "/y", Variants: []abtest.Variant{{Name: "a", Weight: 50}, {Name: "b", Weight: 50, Prefix: "/c"}}},
+		}},
+		{`abtest {
+			variant a 60
+			variant b 50 /b
+		}`, true, nil},
+		{`abtest {
+			variant a 100
+		}`, true, nil},
+		{`abtest {
+			variant a 50
+			variant a 50 /b
+		}`, true, nil},
+		{`abtest {
+			variant a half
+			variant b 50 /b
+		}`, true, nil},
+		{`abtest {
+			variant a
+			variant b 50 /b
+		}`, true, nil},
+		{`abtest {
+			variant a 50
+			variant b 50 /b
+			split cookie
+		}`, true, nil},
+		{`abtest / {
+			variant a 50
+			variant b 50 /b
+		}
+		abtest / {
+			variant a 50
+			variant b 50 /b
+		}`, true, nil},
+		{`abtest /a /b`, true, nil},
+	}
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		actual, err := abtestParse(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if err != nil || test.shouldErr {
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
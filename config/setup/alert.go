@@ -0,0 +1,123 @@
+package setup
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/alert"
+)
+
+// Alert configures a new Alert middleware instance.
+func Alert(c *Controller) (middleware.Middleware, error) {
+	handler, err := alertParse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Startup = append(c.Startup, handler.Start)
+	c.Shutdown = append(c.Shutdown, handler.Stop)
+
+	return func(next middleware.Handler) middleware.Handler {
+		handler.Next = next
+		return handler
+	}, nil
+}
+
+// alertParse parses:
+//
+//	alert webhook_url {
+//		errors       rate
+//		p99          duration
+//		window       duration
+//		interval     duration
+//		min_requests n
+//	}
+//
+// The error rate is a fraction, like 0.05, or a percentage, like 5%.
+// At least one of errors and p99 must be given.
+func alertParse(c *Controller) (*alert.Alert, error) {
+	handler := &alert.Alert{
+		Site:        c.Address(),
+		Window:      alert.DefaultWindow,
+		Interval:    alert.DefaultInterval,
+		MinRequests: alert.DefaultMinRequests,
+	}
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+		handler.Webhook = args[0]
+		if u, err := url.Parse(handler.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, c.Errf("Invalid webhook URL '%s'", handler.Webhook)
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return nil, c.ArgErr()
+			}
+			val := c.Val()
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+
+			switch what {
+			case "errors":
+				rate, err := parseRate(val)
+				if err != nil {
+					return nil, c.Errf("Invalid error rate '%s'", val)
+				}
+				handler.ErrorRate = rate
+			case "p99", "window", "interval":
+				dur, err := time.ParseDuration(val)
+				if err != nil || dur <= 0 {
+					return nil, c.Errf("Invalid %s '%s'", what, val)
+				}
+				switch what {
+				case "p99":
+					handler.P99 = dur
+				case "window":
+					handler.Window = dur
+				case "interval":
+					handler.Interval = dur
+				}
+			case "min_requests":
+				n, err := strconv.Atoi(val)
+				if err != nil || n < 0 {
+					return nil, c.Errf("Invalid min_requests '%s'", val)
+				}
+				handler.MinRequests = n
+			default:
+				return nil, c.Errf("Unknown alert property '%s'", what)
+			}
+		}
+	}
+
+	if handler.ErrorRate == 0 && handler.P99 == 0 {
+		return nil, c.Err("An alert needs an errors or p99 threshold")
+	}
+
+	return handler, nil
+}
+
+// parseRate parses a fraction between 0 and 1, or a percentage.
+func parseRate(s string) (float64, error) {
+	scale := 1.0
+	if strings.HasSuffix(s, "%") {
+		s, scale = strings.TrimSuffix(s, "%"), 100
+	}
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	rate /= scale
+	if rate <= 0 || rate > 1 {
+		return 0, strconv.ErrRange
+	}
+	return rate, nil
+}
@@ -0,0 +1,100 @@
+package setup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware/alert"
+)
+
+func TestAlert(t *testing.T) {
+	c := NewTestController(`alert https://hooks.example.com/caddy {
+		errors 5%
+	}`)
+
+	mid, err := Alert(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	if mid == nil {
+		t.Fatal("Expected middleware, was nil instead")
+	}
+	if len(c.Startup) != 1 || len(c.Shutdown) != 1 {
+		t.Errorf("Expected a startup and a shutdown function, got %d and %d", len(c.Startup), len(c.Shutdown))
+	}
+
+	handler := mid(EmptyNext)
+	myHandler, ok := handler.(*alert.Alert)
+	if !ok {
+		t.Fatalf("Expected handler to be type *Alert, got: %#v", handler)
+	}
+	if !SameNext(myHandler.Next, EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestAlertParse(t *testing.T) {
+	type settings struct {
+		Webhook     string
+		ErrorRate   float64
+		P99         time.Duration
+		Window      time.Duration
+		Interval    time.Duration
+		MinRequests int
+	}
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  settings
+	}{
+		{`alert http://localhost:9000/hook {
+			errors 0.02
+			p99 750ms
+			window 10m
+			interval 1m
+			min_requests 100
+		}`, false, settings{Webhook: "http://localhost:9000/hook", ErrorRate: 0.02, P99: 750 * time.Millisecond,
+			Window: 10 * time.Minute, Interval: time.Minute, MinRequests: 100}},
+		{`alert https://hooks.example.com/x {
+			errors 5%
+		}`, false, settings{Webhook: "https://hooks.example.com/x", ErrorRate: 0.05,
+			Window: alert.DefaultWindow, Interval: alert.DefaultInterval, MinRequests: alert.DefaultMinRequests}},
+		{`alert https://hooks.example.com/x`, true, settings{}},
+		{`alert {
+			errors 5%
+		}`, true, settings{}},
+		{`alert /hook {
+			errors 5%
+		}`, true, settings{}},
+		{`alert https://hooks.example.com/x {
+			errors 150%
+		}`, true, settings{}},
+		{`alert https://hooks.example.com/x {
+			p99 soon
+		}`, true, settings{}},
+		{`alert https://hooks.example.com/x {
+			p99 1s 2s
+		}`, true, settings{}},
+		{`alert https://hooks.example.com/x {
+			p95 1s
+		}`, true, settings{}},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		actual, err := alertParse(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if err != nil || test.shouldErr {
+			continue
+		}
+		got := settings{actual.Webhook, actual.ErrorRate, actual.P99, actual.Window, actual.Interval, actual.MinRequests}
+		if got != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, got)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package setup
 
 import (
+	"strings"
+
 	"github.com/mholt/caddy/middleware"
 	"github.com/mholt/caddy/middleware/basicauth"
 )
@@ -28,6 +30,18 @@ func basicAuthParse(c *Controller) ([]basicauth.Rule, error) {
 
 		args := c.RemainingArgs()
 
+		// An htpasswd file takes the place of a username
+		// and password, which are left empty
+		if n := len(args); n > 0 && strings.HasPrefix(args[n-1], "htpasswd=") {
+			file := strings.TrimPrefix(args[n-1], "htpasswd=")
+			htpasswd, err := basicauth.NewHtpasswd(file)
+			if err != nil {
+				return rules, c.Errf("Loading htpasswd file: %v", err)
+			}
+			rule.Htpasswd = htpasswd
+			args = append(args[:n-1], "", "")
+		}
+
 		switch len(args) {
 		case 2:
 			rule.Username = args[0]
@@ -46,6 +60,12 @@ func basicAuthParse(c *Controller) ([]basicauth.Rule, error) {
 			return rules, c.ArgErr()
 		}
 
+		password, err := c.Secret(rule.Password)
+		if err != nil {
+			return rules, err
+		}
+		rule.Password = password
+
 		rules = append(rules, rule)
 	}
 
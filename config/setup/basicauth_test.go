@@ -2,6 +2,8 @@ package setup
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/mholt/caddy/middleware/basicauth"
@@ -98,3 +100,42 @@ func TestBasicAuthParse(t *testing.T) {
 		}
 	}
 }
+
+func TestBasicAuthHtpasswd(t *testing.T) {
+	file := filepath.Join(t.TempDir(), ".htpasswd")
+	if err := os.WriteFile(file, []byte("user:$apr1$r31ManRI$R2oj3QbIYnb6oudoIg5nT0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input             string
+		shouldErr         bool
+		expectedResources []string
+	}{
+		{`basicauth htpasswd=` + file, false, nil},
+		{"basicauth htpasswd=" + file + " {\n /a\n /b\n}", false, []string{"/a", "/b"}},
+		{`basicauth /private htpasswd=` + file, false, []string{"/private"}},
+		{`basicauth /private user htpasswd=` + file, true, nil},
+		{`basicauth htpasswd=` + file + ".missing", true, nil},
+	}
+	for i, test := range tests {
+		rules, err := basicAuthParse(NewTestController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if len(rules) != 1 || rules[0].Htpasswd == nil {
+			t.Errorf("Test %d: Expected one rule with the htpasswd file, got %+v", i, rules)
+			continue
+		}
+		if fmt.Sprint(rules[0].Resources) != fmt.Sprint(test.expectedResources) {
+			t.Errorf("Test %d: Expected resources %v, got %v", i, test.expectedResources, rules[0].Resources)
+		}
+	}
+}
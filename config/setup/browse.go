@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"html/template"
 	"io/ioutil"
+	"strconv"
+	"time"
 
 	"github.com/mholt/caddy/middleware"
 	"github.com/mholt/caddy/middleware/browse"
@@ -18,7 +20,27 @@ func Browse(c *Controller) (middleware.Middleware, error) {
 
 	browse := browse.Browse{
 		Root:    c.Root,
+		FileSys: c.FileSystem(),
 		Configs: configs,
+		Hide:    []string{c.ConfigFile},
+		Locales: siteLocales(c),
+
+		MetadataFile: c.MetadataFile,
+		HidePatterns: c.Files.Hide,
+		IndexPages:   c.Files.IndexPages,
+	}
+	if c.MetadataFile != "" {
+		browse.Hide = append(browse.Hide, c.MetadataFile)
+	}
+
+	// Access policies are enforced ahead of all other middleware,
+	// of every scope, which could otherwise serve the files they
+	// protect
+	for _, bc := range configs {
+		if bc.AccessFile != "" {
+			c.Guards = append(c.Guards, browse.Guard)
+			break
+		}
 	}
 
 	return func(next middleware.Handler) middleware.Handler {
@@ -43,17 +65,22 @@ func browseParse(c *Controller) ([]browse.Config, error) {
 	for c.Next() {
 		var bc browse.Config
 
+		args := c.RemainingArgs()
+		if len(args) > 2 {
+			return configs, c.ArgErr()
+		}
+
 		// First argument is directory to allow browsing; default is site root
-		if c.NextArg() {
-			bc.PathScope = c.Val()
+		if len(args) > 0 {
+			bc.PathScope = args[0]
 		} else {
 			bc.PathScope = "/"
 		}
 
 		// Second argument would be the template file to use
 		var tplText string
-		if c.NextArg() {
-			tplBytes, err := ioutil.ReadFile(c.Val())
+		if len(args) > 1 {
+			tplBytes, err := ioutil.ReadFile(args[1])
 			if err != nil {
 				return configs, err
 			}
@@ -69,6 +96,95 @@ func browseParse(c *Controller) ([]browse.Config, error) {
 		}
 		bc.Template = tpl
 
+		// Optional block
+		for c.NextBlock() {
+			switch c.Val() {
+			case "preview":
+				bc.Preview = true
+				if c.NextArg() {
+					size, err := strconv.ParseInt(c.Val(), 10, 64)
+					if err != nil || size <= 0 {
+						return configs, c.Errf("Invalid preview size '%s'", c.Val())
+					}
+					bc.PreviewMaxSize = size
+				}
+			case "checksum":
+				algos := c.RemainingArgs()
+				if len(algos) == 0 {
+					return configs, c.ArgErr()
+				}
+				for _, algo := range algos {
+					if _, ok := browse.Checksums[algo]; !ok {
+						return configs, c.Errf("Unsupported checksum algorithm '%s'", algo)
+					}
+				}
+				bc.Checksums = append(bc.Checksums, algos...)
+			case "access":
+				bc.AccessFile = browse.DefaultAccessFile
+				if c.NextArg() {
+					bc.AccessFile = c.Val()
+				}
+			case "dir_sizes":
+				bc.DirSizes = true
+				args := c.RemainingArgs()
+				if len(args) > 2 {
+					return configs, c.ArgErr()
+				}
+				if len(args) > 0 {
+					depth, err := strconv.Atoi(args[0])
+					if err != nil || depth < 0 {
+						return configs, c.Errf("Invalid directory size depth '%s'", args[0])
+					}
+					bc.DirSizeDepth = depth
+				}
+				if len(args) > 1 {
+					timeout, err := time.ParseDuration(args[1])
+					if err != nil || timeout <= 0 {
+						return configs, c.Errf("Invalid directory size timeout '%s'", args[1])
+					}
+					bc.DirSizeTimeout = timeout
+				}
+			case "page_size":
+				if !c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				size, err := strconv.Atoi(c.Val())
+				if err != nil || size <= 0 || size > browse.MaxPageSize {
+					return configs, c.Errf("Invalid page size '%s'", c.Val())
+				}
+				bc.PageSize = size
+			case "dirs_first":
+				bc.DirsFirst = true
+			case "natural_sort":
+				bc.NaturalSort = true
+			case "time_format":
+				if !c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				bc.Format.Time = c.Val()
+			case "time_zone":
+				if !c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				loc, err := time.LoadLocation(c.Val())
+				if err != nil {
+					return configs, c.Errf("Unknown time zone '%s'", c.Val())
+				}
+				bc.Format.Location = loc
+			case "size_units":
+				if !c.NextArg() {
+					return configs, c.ArgErr()
+				}
+				units, err := browse.ParseUnits(c.Val())
+				if err != nil {
+					return configs, c.Err(err.Error())
+				}
+				bc.Format.Units = units
+			default:
+				return configs, c.Errf("Unknown browse property '%s'", c.Val())
+			}
+		}
+
 		// Save configuration
 		err = appendCfg(bc)
 		if err != nil {
@@ -81,7 +197,7 @@ func browseParse(c *Controller) ([]browse.Config, error) {
 
 // The default template to use when serving up directory listings
 const defaultTemplate = `<!DOCTYPE html>
-<html>
+<html lang="{{.Locale}}">
 	<head>
 		<title>{{.Name}}</title>
 		<meta charset="utf-8">
@@ -144,6 +260,42 @@ th a {
 	text-decoration: none;
 }
 
+tr.summary td {
+	color: #777;
+	border-top: 1px solid #DDD;
+}
+
+.checksum {
+	font-size: 11px;
+	color: #777;
+	word-break: break-all;
+}
+
+.description {
+	font-size: 13px;
+	color: #777;
+}
+
+img.icon {
+	width: 1em;
+	height: 1em;
+	vertical-align: middle;
+}
+
+p.description {
+	max-width: 750px;
+	margin: 0 auto 20px;
+}
+
+nav.pages {
+	padding: 20px 5%;
+	color: #777;
+}
+
+nav.pages a {
+	margin: 0 15px;
+}
+
 @media (max-width: 700px) {
 	.hideable {
 		display: none;
@@ -197,55 +349,55 @@ th a {
 	<body>
 		<header>
 			{{if .CanGoUp}}
-			<a href=".." class="up" title="Up one level">&#11025;</a>
+			<a href=".." class="up" title="{{.T "browse.up"}}">&#11025;</a>
 			{{else}}
 			<div class="up">&nbsp;</div>
 			{{end}}
 
-			<h1>{{.Path}}</h1>
+			<h1>{{range $i, $crumb := .Breadcrumbs}}{{if gt $i 1}}/{{end}}<a href="{{$crumb.URL}}">{{$crumb.Name}}</a>{{end}}</h1>
 		</header>
 		<main>
+			{{with .Metadata.Description}}<p class="description">{{.}}</p>{{end}}
 			<table>
 				<tr>
 					<th>
-						{{if and (eq .Sort "name") (ne .Order "desc")}}
-						<a href="?sort=name&order=desc">Name &#9650;</a>
-						{{else if and (eq .Sort "name") (ne .Order "asc")}}
-						<a href="?sort=name&order=asc">Name &#9660;</a>
-						{{else}}
-						<a href="?sort=name&order=asc">Name</a>
-						{{end}}
+						<a href="{{.SortURL "name"}}">{{.T "browse.name"}}{{if eq .Sort "name"}} {{if eq .Order "asc"}}&#9650;{{else}}&#9660;{{end}}{{end}}</a>
 					</th>
 					<th>
-						{{if and (eq .Sort "size") (ne .Order "desc")}}
-						<a href="?sort=size&order=desc">Size &#9650;</a>
-						{{else if and (eq .Sort "size") (ne .Order "asc")}}
-						<a href="?sort=size&order=asc">Size &#9660;</a>
-						{{else}}
-						<a href="?sort=size&order=asc">Size</a>
-						{{end}}
+						<a href="{{.SortURL "size"}}">{{.T "browse.size"}}{{if eq .Sort "size"}} {{if eq .Order "asc"}}&#9650;{{else}}&#9660;{{end}}{{end}}</a>
 					</th>
 					<th class="hideable">
-						{{if and (eq .Sort "time") (ne .Order "desc")}}
-						<a href="?sort=time&order=desc">Modified &#9650;</a>
-						{{else if and (eq .Sort "time") (ne .Order "asc")}}
-						<a href="?sort=time&order=asc">Modified &#9660;</a>
-						{{else}}
-						<a href="?sort=time&order=asc">Modified</a>
-						{{end}}
+						<a href="{{.SortURL "time"}}">{{.T "browse.modified"}}{{if eq .Sort "time"}} {{if eq .Order "asc"}}&#9650;{{else}}&#9660;{{end}}{{end}}</a>
 					</th>
 				</tr>
 				{{range .Items}}
 				<tr>
 					<td>
-						{{if .IsDir}}&#128194;{{else}}&#128196;{{end}}
-						<a href="{{.URL}}">{{.Name}}</a>
+						{{if .Metadata.Icon}}<img src="{{.Metadata.Icon}}" alt="" class="icon">{{else if .IsDir}}&#128194;{{else}}&#128196;{{end}}
+						<a href="{{.URL}}">{{or .Metadata.DisplayName .Name}}</a>
+						{{if and $.Preview (not .IsDir)}}<a href="{{.URL}}?preview" class="preview" title="{{$.T "browse.preview"}}">&#128065;</a>{{end}}
+						{{with .Metadata.Description}}<div class="description">{{.}}</div>{{end}}
+						{{$url := .URL}}{{range $algo, $sum := .Checksums}}
+						<div class="checksum hideable"><a href="{{$url}}?checksum={{$algo}}">{{$algo}}</a> <code>{{$sum}}</code></div>
+						{{end}}
 					</td>
 					<td>{{.HumanSize}}</td>
-					<td class="hideable">{{.HumanModTime "01/02/2006 3:04:05 PM -0700"}}</td>
+					<td class="hideable">{{.HumanModTime}}</td>
 				</tr>
 				{{end}}
+				<tr class="summary">
+					<td>{{.NumDirs}} {{if eq .NumDirs 1}}{{.T "browse.directory"}}{{else}}{{.T "browse.directories"}}{{end}}, {{.NumFiles}} {{if eq .NumFiles 1}}{{.T "browse.file"}}{{else}}{{.T "browse.files"}}{{end}}</td>
+					<td>{{.HumanTotalSize}}</td>
+					<td class="hideable"></td>
+				</tr>
 			</table>
+			{{if gt .NumPages 1}}
+			<nav class="pages">
+				{{if .HasPrev}}<a href="{{.PageURL .PrevPage}}">&larr; {{.T "browse.previous"}}</a>{{end}}
+				{{.T "browse.page" .Page .NumPages}}
+				{{if .HasNext}}<a href="{{.PageURL .NextPage}}">{{.T "browse.next"}} &rarr;</a>{{end}}
+			</nav>
+			{{end}}
 		</main>
 	</body>
 </html>`
@@ -0,0 +1,167 @@
+package setup
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware/browse"
+)
+
+func TestBrowseParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []browse.Config
+	}{
+		{`browse`, false, []browse.Config{{PathScope: "/"}}},
+		{`browse /files`, false, []browse.Config{{PathScope: "/files"}}},
+		{`browse /files {
+			preview
+		}`, false, []browse.Config{{PathScope: "/files", Preview: true}}},
+		{`browse /files {
+			preview 1024
+			checksum sha256 md5
+		}`, false, []browse.Config{{
+			PathScope:      "/files",
+			Preview:        true,
+			PreviewMaxSize: 1024,
+			Checksums:      []string{"sha256", "md5"},
+		}}},
+		{`browse /files {
+			access
+		}`, false, []browse.Config{{PathScope: "/files", AccessFile: browse.DefaultAccessFile}}},
+		{`browse /files {
+			access .htbrowse
+		}`, false, []browse.Config{{PathScope: "/files", AccessFile: ".htbrowse"}}},
+		{`browse /files {
+			time_format "2006-01-02 15:04"
+			time_zone UTC
+			size_units iec
+		}`, false, []browse.Config{{
+			PathScope: "/files",
+			Format:    browse.Format{Time: "2006-01-02 15:04", Location: time.UTC, Units: browse.UnitsIEC},
+		}}},
+		{`browse /files {
+			dirs_first
+			natural_sort
+		}`, false, []browse.Config{{PathScope: "/files", DirsFirst: true, NaturalSort: true}}},
+		{`browse /files {
+			dir_sizes
+		}`, false, []browse.Config{{PathScope: "/files", DirSizes: true}}},
+		{`browse /files {
+			dir_sizes 3 500ms
+		}`, false, []browse.Config{{PathScope: "/files", DirSizes: true, DirSizeDepth: 3, DirSizeTimeout: 500 * time.Millisecond}}},
+		{`browse /files {
+			page_size 50
+		}`, false, []browse.Config{{PathScope: "/files", PageSize: 50}}},
+		{`browse /files {
+			page_size 0
+		}`, true, nil},
+		{`browse /files {
+			page_size 100000
+		}`, true, nil},
+		{`browse /files {
+			dir_sizes -1
+		}`, true, nil},
+		{`browse /files {
+			dir_sizes 3 soon
+		}`, true, nil},
+		{`browse /files {
+			size_units kb
+		}`, true, nil},
+		{`browse /files {
+			time_zone Nowhere/Special
+		}`, true, nil},
+		{`browse /files {
+			time_format
+		}`, true, nil},
+		{`browse /files {
+			checksum crc32
+		}`, true, nil},
+		{`browse /files {
+			preview -1
+		}`, true, nil},
+		{`browse /files {
+			unknown
+		}`, true, nil},
+		{`browse /files
+		  browse /files`, true, nil},
+		{`browse /files tpl.html extra`, true, nil},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		configs, err := browseParse(c)
+
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d: Expected error but found none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: Expected no error but found: %v", i, err)
+			continue
+		}
+		if len(configs) != len(test.expected) {
+			t.Fatalf("Test %d: Expected %d configs, got %d", i, len(test.expected), len(configs))
+		}
+		for j, expected := range test.expected {
+			actual := configs[j]
+			if actual.PathScope != expected.PathScope {
+				t.Errorf("Test %d, config %d: Expected path scope %s, got %s", i, j, expected.PathScope, actual.PathScope)
+			}
+			if actual.Template == nil {
+				t.Errorf("Test %d, config %d: Expected a template, got nil", i, j)
+			}
+			if actual.Preview != expected.Preview {
+				t.Errorf("Test %d, config %d: Expected preview %v, got %v", i, j, expected.Preview, actual.Preview)
+			}
+			if actual.PreviewMaxSize != expected.PreviewMaxSize {
+				t.Errorf("Test %d, config %d: Expected preview size %d, got %d", i, j, expected.PreviewMaxSize, actual.PreviewMaxSize)
+			}
+			if actual.AccessFile != expected.AccessFile {
+				t.Errorf("Test %d, config %d: Expected access file %q, got %q", i, j, expected.AccessFile, actual.AccessFile)
+			}
+			if actual.Format.Time != expected.Format.Time || actual.Format.Units != expected.Format.Units ||
+				actual.Format.Location.String() != expected.Format.Location.String() {
+				t.Errorf("Test %d, config %d: Expected format %+v, got %+v", i, j, expected.Format, actual.Format)
+			}
+			if actual.DirsFirst != expected.DirsFirst || actual.NaturalSort != expected.NaturalSort {
+				t.Errorf("Test %d, config %d: Expected dirs first %v and natural sort %v, got %v and %v", i, j,
+					expected.DirsFirst, expected.NaturalSort, actual.DirsFirst, actual.NaturalSort)
+			}
+			if actual.DirSizes != expected.DirSizes || actual.DirSizeDepth != expected.DirSizeDepth ||
+				actual.DirSizeTimeout != expected.DirSizeTimeout {
+				t.Errorf("Test %d, config %d: Expected dir sizes %v (depth %d, timeout %v), got %v (depth %d, timeout %v)", i, j,
+					expected.DirSizes, expected.DirSizeDepth, expected.DirSizeTimeout,
+					actual.DirSizes, actual.DirSizeDepth, actual.DirSizeTimeout)
+			}
+			if actual.PageSize != expected.PageSize {
+				t.Errorf("Test %d, config %d: Expected page size %d, got %d", i, j, expected.PageSize, actual.PageSize)
+			}
+			if len(actual.Checksums) != len(expected.Checksums) {
+				t.Errorf("Test %d, config %d: Expected checksums %v, got %v", i, j, expected.Checksums, actual.Checksums)
+			}
+		}
+	}
+}
+
+func TestBrowseDefaultTemplate(t *testing.T) {
+	configs, err := browseParse(NewTestController(`browse`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var buf bytes.Buffer
+	listing := browse.Listing{Name: "files", Path: "/files/", NumDirs: 1, NumFiles: 2, Page: 1, NumPages: 2}
+	if err := configs[0].Template.Execute(&buf, listing); err != nil {
+		t.Fatalf("Expected the default template to execute, got %v", err)
+	}
+	for _, expected := range []string{">Name", ">Size", "1 directory, 2 files", "Page 1 of 2"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected the listing to contain %q", expected)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package setup
+
+import (
+	"net/http"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/canonical"
+)
+
+// Canonical configures a new Canonical middleware instance. If
+// the site's block names aliases, only those are redirected.
+func Canonical(c *Controller) (middleware.Middleware, error) {
+	host, err := canonicalParse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return canonical.Canonical{Next: next, Host: host, Aliases: c.Aliases, Code: http.StatusMovedPermanently}
+	}, nil
+}
+
+// canonicalParse returns the hostname to redirect to, which is
+// the first host of the site's block unless another is given.
+func canonicalParse(c *Controller) (string, error) {
+	host := c.Host
+	if len(c.Hosts) > 0 {
+		host = c.Hosts[0]
+	}
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			host = args[0]
+		default:
+			return "", c.ArgErr()
+		}
+	}
+
+	if host == "" || host == "0.0.0.0" {
+		return "", c.Err("No hostname to redirect to; specify one")
+	}
+
+	return host, nil
+}
+
+// WWW configures a new WWW middleware instance. The syntax is
+//
+//	www [remove|add] [https]
+//
+// which redirects www.<host> to <host> (remove, the default), or
+// <host> to www.<host> (add). Both hostnames must be addresses of
+// the site for its requests to arrive here. With https, plain HTTP
+// requests are redirected straight to HTTPS, rather than taking one
+// redirect to the other hostname and another to HTTPS.
+func WWW(c *Controller) (middleware.Middleware, error) {
+	w3, err := wwwParse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		w3.Next = next
+		return w3
+	}, nil
+}
+
+func wwwParse(c *Controller) (canonical.WWW, error) {
+	w3 := canonical.WWW{Code: http.StatusMovedPermanently}
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) > 2 {
+			return w3, c.ArgErr()
+		}
+		if len(args) > 0 {
+			switch args[0] {
+			case "remove":
+				w3.Add = false
+			case "add":
+				w3.Add = true
+			default:
+				return w3, c.Errf("Invalid www mode '%s'; use remove or add", args[0])
+			}
+		}
+		if len(args) > 1 {
+			if args[1] != "https" {
+				return w3, c.Errf("Unknown www option '%s'", args[1])
+			}
+			w3.HTTPS = true
+		}
+	}
+
+	return w3, nil
+}
@@ -0,0 +1,109 @@
+package setup
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy/middleware/canonical"
+)
+
+func TestCanonical(t *testing.T) {
+	c := NewTestController(`canonical`)
+	c.Host = "www.example.com"
+	c.Hosts = []string{"example.com", "www.example.com"}
+
+	mid, err := Canonical(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+	if mid == nil {
+		t.Fatal("Expected middleware, was nil instead")
+	}
+
+	handler := mid(EmptyNext)
+	myHandler, ok := handler.(canonical.Canonical)
+	if !ok {
+		t.Fatalf("Expected handler to be type Canonical, got: %#v", handler)
+	}
+	if myHandler.Host != "example.com" {
+		t.Errorf("Expected primary host example.com, got %s", myHandler.Host)
+	}
+	if myHandler.Aliases != nil {
+		t.Errorf("Expected no aliases, got %v", myHandler.Aliases)
+	}
+
+	c = NewTestController(`canonical`)
+	c.Host, c.Hosts, c.Aliases = "foo.example.net", []string{"example.com", "foo.example.net"}, []string{"foo.example.net"}
+	mid, err = Canonical(c)
+	if err != nil {
+		t.Fatalf("Expected no errors, but got: %v", err)
+	}
+	if aliases := mid(EmptyNext).(canonical.Canonical).Aliases; len(aliases) != 1 || aliases[0] != "foo.example.net" {
+		t.Errorf("Expected the block's aliases, got %v", aliases)
+	}
+	if !SameNext(myHandler.Next, EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestCanonicalParse(t *testing.T) {
+	tests := []struct {
+		input        string
+		host         string
+		hosts        []string
+		shouldErr    bool
+		expectedHost string
+	}{
+		{`canonical`, "example.com", nil, false, "example.com"},
+		{`canonical`, "b.com", []string{"a.com", "b.com"}, false, "a.com"},
+		{`canonical c.com`, "b.com", []string{"a.com", "b.com"}, false, "c.com"},
+		{`canonical a.com b.com`, "a.com", nil, true, ""},
+		{`canonical`, "", nil, true, ""},
+		{`canonical`, "0.0.0.0", []string{"0.0.0.0"}, true, ""},
+	}
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		c.Host, c.Hosts = test.host, test.hosts
+
+		host, err := canonicalParse(c)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if host != test.expectedHost {
+			t.Errorf("Test %d: Expected host %q, got %q", i, test.expectedHost, host)
+		}
+	}
+}
+
+func TestWWWParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  canonical.WWW
+	}{
+		{`www`, false, canonical.WWW{Code: 301}},
+		{`www remove`, false, canonical.WWW{Code: 301}},
+		{`www add`, false, canonical.WWW{Add: true, Code: 301}},
+		{`www add https`, false, canonical.WWW{Add: true, HTTPS: true, Code: 301}},
+		{`www strip`, true, canonical.WWW{}},
+		{`www add http`, true, canonical.WWW{}},
+		{`www add https now`, true, canonical.WWW{}},
+	}
+	for i, test := range tests {
+		c := NewTestController(test.input)
+
+		w3, err := wwwParse(c)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if err != nil || test.shouldErr {
+			continue
+		}
+		if w3 != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, w3)
+		}
+	}
+}
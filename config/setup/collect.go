@@ -0,0 +1,80 @@
+package setup
+
+import (
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/collect"
+)
+
+// Collect configures a new Collect middleware instance.
+// The syntax is
+//
+//	collect [path] {
+//		file  views.log
+//		token secret
+//	}
+//
+// The beacon endpoint is at path (/_collect by default), and
+// views are appended to file. With token, reports can be
+// exported from path/export; the token may be read from a
+// file or the environment instead (see parse.Dispenser.Secret).
+// Anyone can send beacons, so the site should limit the rate
+// of requests to path, like
+//
+//	ratelimit /_collect 1/s 10
+func Collect(c *Controller) (middleware.Middleware, error) {
+	coll, err := collectParse(c)
+	if err != nil {
+		return nil, err
+	}
+	c.Shutdown = append(c.Shutdown, coll.Store.Close)
+
+	return func(next middleware.Handler) middleware.Handler {
+		coll.Next = next
+		return coll
+	}, nil
+}
+
+func collectParse(c *Controller) (collect.Collect, error) {
+	coll := collect.Collect{Path: "/_collect"}
+	var file string
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			coll.Path = args[0]
+		default:
+			return coll, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return coll, c.ArgErr()
+			}
+			switch what {
+			case "file":
+				file = c.Val()
+			case "token":
+				token, err := c.Secret(c.Val())
+				if err != nil {
+					return coll, err
+				}
+				coll.Token = token
+			default:
+				return coll, c.Errf("Unknown collect property '%s'", what)
+			}
+			if c.NextArg() {
+				return coll, c.ArgErr()
+			}
+		}
+	}
+
+	if file == "" {
+		return coll, c.Err("collect needs a file to record views in")
+	}
+	coll.Store = collect.OpenStore(file, c.FilePerms)
+
+	return coll, nil
+}
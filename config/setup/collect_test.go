@@ -0,0 +1,65 @@
+package setup
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy/middleware/collect"
+)
+
+func TestCollect(t *testing.T) {
+	c := NewTestController(`collect /stats {
+		file views.log
+		token secret
+	}`)
+
+	mid, err := Collect(c)
+	if err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	handler := mid(EmptyNext)
+	myHandler, ok := handler.(collect.Collect)
+	if !ok {
+		t.Fatalf("Expected handler to be type Collect, got: %#v", handler)
+	}
+	if myHandler.Path != "/stats" || myHandler.Token != "secret" || myHandler.Store == nil {
+		t.Errorf("Expected settings to be parsed, got %+v", myHandler)
+	}
+	if !SameNext(myHandler.Next, EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if len(c.Shutdown) != 1 {
+		t.Errorf("Expected a shutdown function to close the file, got %d", len(c.Shutdown))
+	}
+}
+
+func TestCollectParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+	}{
+		{`collect {
+			file views.log
+		}`, false},
+		{`collect`, true},
+		{`collect /a /b`, true},
+		{`collect {
+			file
+		}`, true},
+		{`collect {
+			file a.log b.log
+		}`, true},
+		{`collect {
+			file views.log
+			salt x
+		}`, true},
+	}
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		_, err := collectParse(c)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package setup
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/content"
+)
+
+// Charset configures a new Charset middleware instance.
+// The syntax is
+//
+//	charset name [path [extensions...]]
+//
+// which sets the charset of text responses to name, for
+// all of the site, or just for the files under path that
+// have one of the extensions.
+func Charset(c *Controller) (middleware.Middleware, error) {
+	rules, err := charsetParse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return content.Charset{Next: next, Rules: rules}
+	}, nil
+}
+
+func charsetParse(c *Controller) ([]content.CharsetRule, error) {
+	var rules []content.CharsetRule
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return rules, c.ArgErr()
+		}
+		rule := content.CharsetRule{Charset: args[0], Path: "/"}
+		if strings.ContainsAny(rule.Charset, " ;\"") {
+			return rules, c.Errf("Invalid charset '%s'", rule.Charset)
+		}
+		if len(args) > 1 {
+			rule.Path = args[1]
+			rule.Extensions = args[2:]
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// Attachment configures a new Attachment middleware instance.
+// The syntax is
+//
+//	attachment path [extensions...]
+//
+// which has browsers download the files under path that have
+// one of the extensions, or all of them if none are given.
+func Attachment(c *Controller) (middleware.Middleware, error) {
+	rules, err := attachmentParse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return content.Attachment{Next: next, Rules: rules}
+	}, nil
+}
+
+func attachmentParse(c *Controller) ([]content.AttachmentRule, error) {
+	var rules []content.AttachmentRule
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return rules, c.ArgErr()
+		}
+		rules = append(rules, content.AttachmentRule{Path: args[0], Extensions: args[1:]})
+	}
+
+	return rules, nil
+}
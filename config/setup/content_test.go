@@ -0,0 +1,59 @@
+package setup
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mholt/caddy/middleware/content"
+)
+
+func TestCharsetParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []content.CharsetRule
+	}{
+		{`charset utf-8`, false, []content.CharsetRule{{Path: "/", Charset: "utf-8"}}},
+		{`charset iso-8859-1 /legacy .txt .csv
+		  charset utf-8`, false, []content.CharsetRule{
+			{Path: "/legacy", Extensions: []string{".txt", ".csv"}, Charset: "iso-8859-1"},
+			{Path: "/", Charset: "utf-8"},
+		}},
+		{`charset`, true, nil},
+		{`charset "utf-8; x=y"`, true, nil},
+	}
+	for i, test := range tests {
+		rules, err := charsetParse(NewTestController(test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if !test.shouldErr && fmt.Sprint(rules) != fmt.Sprint(test.expected) {
+			t.Errorf("Test %d: Expected rules %v, got %v", i, test.expected, rules)
+		}
+	}
+}
+
+func TestAttachmentParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []content.AttachmentRule
+	}{
+		{`attachment /downloads`, false, []content.AttachmentRule{{Path: "/downloads", Extensions: []string{}}}},
+		{`attachment / .zip .iso`, false, []content.AttachmentRule{{Path: "/", Extensions: []string{".zip", ".iso"}}}},
+		{`attachment`, true, nil},
+	}
+	for i, test := range tests {
+		rules, err := attachmentParse(NewTestController(test.input))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if !test.shouldErr && fmt.Sprint(rules) != fmt.Sprint(test.expected) {
+			t.Errorf("Test %d: Expected rules %v, got %v", i, test.expected, rules)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package setup
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/cron"
+	caddylog "github.com/mholt/caddy/middleware/log"
+	"github.com/mholt/caddy/server"
+	"github.com/mholt/caddy/server/acme"
+)
+
+// DefaultCronTimeout is how long the commands of a cron job
+// may run if the job doesn't set its own timeout.
+const DefaultCronTimeout = 10 * time.Minute
+
+// Cron runs actions on a schedule while the server is running.
+// The syntax is
+//
+//	cron <schedule> <action> [args...]
+//	cron <schedule> {
+//		jitter  <duration>
+//		timeout <duration>
+//		<action> [args...]
+//		...
+//	}
+//
+// where schedule is one of those cron.Parse takes (quoted if it
+// has spaces, except for @every <duration>), and the actions of a
+// block run one after another until one fails. The actions are
+//
+//	exec <command> [args...]  run a command
+//	git_pull [dir]            run git pull in dir or the site root
+//	purge_cache               drop the files the file server cached
+//	check_certs [days]        fail if the site's certificate expires
+//	                          within days (30 by default)
+//	reopen_logs               reopen the log files, after rotation
+//
+// Commands (exec and git_pull) are killed if they run longer than
+// timeout, DefaultCronTimeout by default. A run that is due while
+// the last one is still going is skipped.
+func Cron(c *Controller) (middleware.Middleware, error) {
+	jobs, err := cronParse(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		c.Startup = append(c.Startup, job.Start)
+		c.Shutdown = append(c.Shutdown, job.Stop)
+	}
+	return nil, nil
+}
+
+func cronParse(c *Controller) ([]*cron.Job, error) {
+	var jobs []*cron.Job
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return jobs, c.ArgErr()
+		}
+		spec := args[0]
+		if spec == "@every" && len(args) > 1 {
+			spec, args = "@every "+args[1], args[1:]
+		}
+		schedule, err := cron.Parse(spec)
+		if err != nil {
+			return jobs, c.Err(err.Error())
+		}
+		job := &cron.Job{Schedule: schedule}
+		timeout := DefaultCronTimeout
+
+		var actions []func() error
+		var names []string
+		if len(args) > 1 {
+			action, err := cronAction(c, args[1], args[2:], &timeout)
+			if err != nil {
+				return jobs, err
+			}
+			actions, names = append(actions, action), append(names, args[1])
+		}
+
+		for c.NextBlock() {
+			name := c.Val()
+			if name == "jitter" {
+				if !c.NextArg() {
+					return jobs, c.ArgErr()
+				}
+				jitter, err := time.ParseDuration(c.Val())
+				if err != nil || jitter < 0 {
+					return jobs, c.Errf("Invalid jitter '%s'", c.Val())
+				}
+				job.Jitter = jitter
+				continue
+			}
+			if name == "timeout" {
+				if !c.NextArg() {
+					return jobs, c.ArgErr()
+				}
+				d, err := time.ParseDuration(c.Val())
+				if err != nil || d <= 0 {
+					return jobs, c.Errf("Invalid timeout '%s'", c.Val())
+				}
+				timeout = d
+				continue
+			}
+			action, err := cronAction(c, name, c.RemainingArgs(), &timeout)
+			if err != nil {
+				return jobs, err
+			}
+			actions, names = append(actions, action), append(names, name)
+		}
+
+		if len(actions) == 0 {
+			return jobs, c.Err("cron needs an action to run")
+		}
+		job.Name = fmt.Sprintf("%s (%s)", strings.Join(names, ", "), spec)
+		job.Run = func() error {
+			for _, action := range actions {
+				if err := action(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// cronAction returns the function for the cron action called name
+// with the arguments args. Commands are killed after the duration
+// timeout points to, which is read when they run, as the job's
+// timeout may be set after its actions.
+func cronAction(c *Controller, name string, args []string, timeout *time.Duration) (func() error, error) {
+	switch name {
+	case "exec":
+		if len(args) == 0 {
+			return nil, c.ArgErr()
+		}
+		// the args were already split and unquoted by the parser
+		command, args := args[0], args[1:]
+		return func() error {
+			return runCommand(*timeout, "", command, args...)
+		}, nil
+
+	case "git_pull":
+		if len(args) > 1 {
+			return nil, c.ArgErr()
+		}
+		dir := c.Root
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		return func() error {
+			return runCommand(*timeout, dir, "git", "pull")
+		}, nil
+
+	case "purge_cache":
+		if len(args) > 0 {
+			return nil, c.ArgErr()
+		}
+		if c.Purger == nil {
+			c.Purger = new(server.CachePurger)
+		}
+		purger := c.Purger
+		return func() error {
+			purger.Purge()
+			return nil
+		}, nil
+
+	case "check_certs":
+		if len(args) > 1 {
+			return nil, c.ArgErr()
+		}
+		days := 30
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return nil, c.Errf("Invalid number of days '%s'", args[0])
+			}
+			days = n
+		}
+		if !c.TLS.Enabled {
+			return nil, c.Err("check_certs needs the site to have a certificate (see tls)")
+		}
+		certFile := c.TLS.Certificate
+		if c.TLS.Managed() {
+			// the certificate is obtained with ACME and kept in its storage
+			m := &acme.Manager{DirectoryURL: c.TLS.ACME.CA, Storage: acme.Storage(c.TLS.ACME.Storage)}
+			certFile = m.CertificateFile(c.Host)
+		}
+		return func() error {
+			return checkCertExpiry(certFile, time.Duration(days)*24*time.Hour)
+		}, nil
+
+	case "reopen_logs":
+		if len(args) > 0 {
+			return nil, c.ArgErr()
+		}
+		return caddylog.Reopen, nil
+	}
+
+	return nil, c.Errf("Unknown cron action '%s'", name)
+}
+
+// runCommand runs command with args in dir, killing it if it takes
+// longer than timeout, and returns an error with its output if it fails.
+func runCommand(timeout time.Duration, dir, command string, args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Dir = dir
+	// don't wait forever for children that keep the output open
+	cmd.WaitDelay = 5 * time.Second
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %v", timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", strings.Join(cmd.Args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// checkCertExpiry returns an error if the first certificate in
+// the PEM file certFile expires within d, or can't be read.
+func checkCertExpiry(certFile string, d time.Duration) error {
+	data, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return fmt.Errorf("%s: no certificate found", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("%s: %v", certFile, err)
+	}
+	if left := cert.NotAfter.Sub(time.Now()); left < d {
+		return fmt.Errorf("%s: certificate for %s expires %s (in %v)", certFile,
+			cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339), left.Truncate(time.Hour))
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package setup
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/server/acme"
+)
+
+func TestCron(t *testing.T) {
+	for i, test := range []struct {
+		input          string
+		shouldErr      bool
+		expectedJobs   int
+		expectedJitter time.Duration
+		expectedPurger bool
+	}{
+		{`cron @every 1h purge_cache`, false, 1, 0, true},
+		{`cron "0 4 * * *" exec echo hello`, false, 1, 0, false},
+		{`cron @daily {
+			jitter 10m
+			git_pull /srv/site
+			purge_cache
+		}`, false, 1, 10 * time.Minute, true},
+		{`cron @hourly reopen_logs
+		  cron @every 5m exec true`, false, 2, 0, false},
+		{`cron`, true, 0, 0, false},
+		{`cron @hourly`, true, 0, 0, false},
+		{`cron @every purge_cache`, true, 0, 0, false},
+		{`cron "0 4 * *" purge_cache`, true, 0, 0, false},
+		{`cron @hourly fly_away`, true, 0, 0, false},
+		{`cron @hourly exec`, true, 0, 0, false},
+		{`cron @hourly purge_cache now`, true, 0, 0, false},
+		{`cron @hourly check_certs`, true, 0, 0, false}, // no TLS
+		{`cron @hourly {
+			jitter soon
+			purge_cache
+		}`, true, 0, 0, false},
+		{`cron @hourly {
+			timeout 0s
+			exec true
+		}`, true, 0, 0, false},
+	} {
+		c := NewTestController(test.input)
+		jobs, err := cronParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if len(jobs) != test.expectedJobs {
+			t.Errorf("Test %d: Expected %d jobs, got %d", i, test.expectedJobs, len(jobs))
+			continue
+		}
+		if jobs[0].Jitter != test.expectedJitter {
+			t.Errorf("Test %d: Expected jitter %v, got %v", i, test.expectedJitter, jobs[0].Jitter)
+		}
+		if (c.Purger != nil) != test.expectedPurger {
+			t.Errorf("Test %d: Expected a cache purger to be %v", i, test.expectedPurger)
+		}
+	}
+}
+
+func TestCronRun(t *testing.T) {
+	c := NewTestController(`cron @hourly exec true`)
+	jobs, err := cronParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := jobs[0].Run(); err != nil {
+		t.Errorf("Expected the command to run, got: %v", err)
+	}
+
+	c = NewTestController(`cron @hourly {
+		exec false
+		exec true
+	}`)
+	jobs, err = cronParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := jobs[0].Run(); err == nil {
+		t.Errorf("Expected the failing command to fail the run")
+	}
+}
+
+func TestCronRunArgs(t *testing.T) {
+	// the quoted args must reach the command as they are
+	c := NewTestController(`cron @hourly exec test "a b" = "a b"`)
+	jobs, err := cronParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := jobs[0].Run(); err != nil {
+		t.Errorf("Expected the args to be passed unsplit, got: %v", err)
+	}
+}
+
+func TestCronRunTimeout(t *testing.T) {
+	c := NewTestController(`cron @hourly {
+		timeout 100ms
+		exec sleep 10
+	}`)
+	jobs, err := cronParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	start := time.Now()
+	if err := jobs[0].Run(); err == nil {
+		t.Errorf("Expected the command to time out")
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("Expected the command to be killed, but it ran for %v", took)
+	}
+}
+
+func TestCronCheckManagedCert(t *testing.T) {
+	storage, err := ioutil.TempDir("", "caddy_cron_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(storage)
+
+	// a certificate obtained with ACME that expires in 10 days
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &acme.Manager{Storage: acme.Storage(storage)}
+	certFile := m.CertificateFile("example.com")
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		days      string
+		shouldErr bool
+	}{
+		{"30", true},
+		{"5", false},
+	} {
+		c := NewTestController(`cron @daily check_certs ` + test.days)
+		c.Host = "example.com"
+		c.TLS.Enabled = true
+		c.TLS.ACME.Storage = storage
+		jobs, err := cronParse(c)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if err := jobs[0].Run(); (err != nil) != test.shouldErr {
+			t.Errorf("Test %d: Expected error to be %v, got: %v", i, test.shouldErr, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package setup
+
+import (
+	"strconv"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/decompress"
+)
+
+// Decompress configures a new Decompress middleware instance.
+// The syntax is
+//
+//	decompress [paths...] {
+//		max_size size
+//		max_ratio ratio
+//	}
+//
+// Request bodies to the paths (the whole site by default) that
+// are compressed with gzip or deflate are decompressed. A body
+// may expand to at most max_size (10MB by default), and to at
+// most max_ratio (100 by default) times its compressed size.
+func Decompress(c *Controller) (middleware.Middleware, error) {
+	d, err := decompressParse(c)
+	if err != nil {
+		return nil, err
+	}
+	d.Name = c.Host + " decompress"
+
+	return func(next middleware.Handler) middleware.Handler {
+		d.Next = next
+		return d
+	}, nil
+}
+
+func decompressParse(c *Controller) (decompress.Decompress, error) {
+	var d decompress.Decompress
+
+	for c.Next() {
+		paths := c.RemainingArgs()
+		if len(paths) == 0 {
+			paths = []string{"/"}
+		}
+		d.Paths = append(d.Paths, paths...)
+
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return d, c.ArgErr()
+			}
+			val := c.Val()
+			if c.NextArg() {
+				return d, c.ArgErr()
+			}
+
+			switch what {
+			case "max_size":
+				size, err := parseDownloadsSize(c, what, val)
+				if err != nil {
+					return d, err
+				}
+				d.MaxSize = size
+			case "max_ratio":
+				ratio, err := strconv.ParseInt(val, 10, 64)
+				if err != nil || ratio < 1 {
+					return d, c.Errf("Invalid max_ratio '%s'", val)
+				}
+				d.MaxRatio = ratio
+			default:
+				return d, c.Errf("Unknown decompress option '%s'", what)
+			}
+		}
+	}
+
+	return d, nil
+}
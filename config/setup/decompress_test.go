@@ -0,0 +1,82 @@
+package setup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy/middleware/decompress"
+)
+
+func TestDecompress(t *testing.T) {
+	c := NewTestController(`decompress /upload`)
+	c.Host = "localhost"
+
+	mid, err := Decompress(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	if mid == nil {
+		t.Fatal("Expected middleware, was nil instead")
+	}
+
+	handler := mid(EmptyNext)
+	myHandler, ok := handler.(decompress.Decompress)
+	if !ok {
+		t.Fatalf("Expected handler to be type Decompress, got: %#v", handler)
+	}
+	if myHandler.Name != "localhost decompress" {
+		t.Errorf("Expected limit name 'localhost decompress', got '%s'", myHandler.Name)
+	}
+	if !SameNext(myHandler.Next, EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestDecompressParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  decompress.Decompress
+	}{
+		{`decompress`, false, decompress.Decompress{Paths: []string{"/"}}},
+		{`decompress /upload /api`, false, decompress.Decompress{Paths: []string{"/upload", "/api"}}},
+		{`decompress /upload
+		  decompress /api`, false, decompress.Decompress{Paths: []string{"/upload", "/api"}}},
+		{`decompress /upload {
+			max_size 1MB
+			max_ratio 20
+		}`, false, decompress.Decompress{Paths: []string{"/upload"}, MaxSize: 1000000, MaxRatio: 20}},
+		{`decompress {
+			max_size
+		}`, true, decompress.Decompress{}},
+		{`decompress {
+			max_size lots
+		}`, true, decompress.Decompress{}},
+		{`decompress {
+			max_ratio 0
+		}`, true, decompress.Decompress{}},
+		{`decompress {
+			max_ratio 10 20
+		}`, true, decompress.Decompress{}},
+		{`decompress {
+			brotli on
+		}`, true, decompress.Decompress{}},
+	}
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		actual, err := decompressParse(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if err != nil || test.shouldErr {
+			continue
+		}
+
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
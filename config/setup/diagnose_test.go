@@ -0,0 +1,35 @@
+package setup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDirectiveChecks(t *testing.T) {
+	for i, test := range []struct {
+		input    string
+		setup    func(*Controller) error
+		expected []string
+	}{
+		{`log / /var/log/access.log`, func(c *Controller) error { _, err := Log(c); return err },
+			[]string{"log file /var/log/access.log"}},
+		{`log / stdout`, func(c *Controller) error { _, err := Log(c); return err },
+			nil},
+		{`proxy / localhost:8080 https://backend.example.com`, func(c *Controller) error { _, err := Proxy(c); return err },
+			[]string{"upstream localhost:8080 resolves", "upstream backend.example.com resolves"}},
+		{`templates /blog .html`, func(c *Controller) error { _, err := Templates(c); return err },
+			[]string{"templates under /blog parse"}},
+	} {
+		c := NewTestController(test.input)
+		if err := test.setup(c); err != nil {
+			t.Fatalf("Test %d: Expected no error, got %v", i, err)
+		}
+		var got []string
+		for _, check := range c.Checks {
+			got = append(got, check.What)
+		}
+		if strings.Join(got, "|") != strings.Join(test.expected, "|") {
+			t.Errorf("Test %d: Expected checks %v, got %v", i, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package setup
+
+import "github.com/mholt/caddy/middleware"
+
+// Disable sets which directives' middleware starts turned off,
+// so it can be turned on later through the admin API without
+// a reload, like a page shown while the site is under
+// maintenance.
+func Disable(c *Controller) (middleware.Middleware, error) {
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return nil, c.ArgErr()
+		}
+		c.Disabled = append(c.Disabled, args...)
+	}
+	return nil, nil
+}
@@ -0,0 +1,40 @@
+package setup
+
+import "testing"
+
+func TestDisable(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []string
+	}{
+		{`disable gzip`, false, []string{"gzip"}},
+		{"disable gzip\ndisable redir errors.debug", false, []string{"gzip", "redir", "errors.debug"}},
+		{`disable`, true, nil},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		mid, err := Disable(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if mid != nil {
+			t.Errorf("Test %d: Expected no middleware, got some", i)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if len(c.Disabled) != len(test.expected) {
+			t.Fatalf("Test %d: Expected disabled %v, got %v", i, test.expected, c.Disabled)
+		}
+		for j, name := range test.expected {
+			if c.Disabled[j] != name {
+				t.Errorf("Test %d: Expected disabled %v, got %v", i, test.expected, c.Disabled)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package setup
+
+import (
+	"strconv"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/server"
+)
+
+// Downloads tunes the connection for serving large files.
+// The syntax is
+//
+//	downloads [threshold] {
+//		cork on|off
+//		write_buffer size
+//		chunk_size size
+//		ranges n
+//		read_ahead size
+//		streams n
+//	}
+//
+// Files of at least threshold bytes (1MB by default) are tuned for.
+// Corking is on unless turned off. For streaming video and audio,
+// ranges caps how many byte ranges a request may ask for, read_ahead
+// reads the file in large blocks, and streams limits how many range
+// requests each client IP may have going at once.
+func Downloads(c *Controller) (middleware.Middleware, error) {
+	c.Downloads = server.DownloadsConfig{Threshold: server.DefaultDownloadThreshold, Cork: true}
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			size, err := parseDownloadsSize(c, "threshold", args[0])
+			if err != nil {
+				return nil, err
+			}
+			c.Downloads.Threshold = size
+		default:
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return nil, c.ArgErr()
+			}
+			val := c.Val()
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+
+			switch what {
+			case "cork":
+				switch val {
+				case "on":
+					c.Downloads.Cork = true
+				case "off":
+					c.Downloads.Cork = false
+				default:
+					return nil, c.Errf("Invalid cork setting '%s'; use on or off", val)
+				}
+			case "write_buffer", "chunk_size":
+				size, err := parseDownloadsSize(c, what, val)
+				if err != nil {
+					return nil, err
+				}
+				if size > 1<<30 {
+					return nil, c.Errf("Invalid %s '%s'; at most 1GB", what, val)
+				}
+				if what == "write_buffer" {
+					c.Downloads.WriteBuffer = int(size)
+				} else {
+					c.Downloads.ChunkSize = int(size)
+				}
+			case "read_ahead":
+				size, err := parseDownloadsSize(c, what, val)
+				if err != nil {
+					return nil, err
+				}
+				if size > 64<<20 {
+					return nil, c.Errf("Invalid read_ahead '%s'; at most 64MiB", val)
+				}
+				c.Downloads.ReadAhead = int(size)
+			case "ranges", "streams":
+				n, err := strconv.Atoi(val)
+				if err != nil || n < 1 {
+					return nil, c.Errf("Invalid %s '%s'", what, val)
+				}
+				if what == "ranges" {
+					c.Downloads.MaxRanges = n
+				} else {
+					c.Downloads.Streams = n
+				}
+			default:
+				return nil, c.Errf("Unknown downloads option '%s'", what)
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func parseDownloadsSize(c *Controller, what, val string) (int64, error) {
+	size, err := humanize.ParseBytes(val)
+	if err != nil || size < 1 {
+		return 0, c.Errf("Invalid %s '%s'", what, val)
+	}
+	return int64(size), nil
+}
@@ -0,0 +1,68 @@
+package setup
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy/server"
+)
+
+func TestDownloads(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  server.DownloadsConfig
+	}{
+		{`downloads`, false, server.DownloadsConfig{Threshold: server.DefaultDownloadThreshold, Cork: true}},
+		{`downloads 10MB`, false, server.DownloadsConfig{Threshold: 10000000, Cork: true}},
+		{`downloads {
+			cork off
+			write_buffer 4MiB
+			chunk_size 256KiB
+		}`, false, server.DownloadsConfig{Threshold: server.DefaultDownloadThreshold, WriteBuffer: 4 << 20, ChunkSize: 256 << 10}},
+		{`downloads 4MB {
+			ranges 2
+			read_ahead 1MiB
+			streams 4
+		}`, false, server.DownloadsConfig{Threshold: 4000000, Cork: true, MaxRanges: 2, ReadAhead: 1 << 20, Streams: 4}},
+		{`downloads {
+			ranges 0
+		}`, true, server.DownloadsConfig{}},
+		{`downloads {
+			streams many
+		}`, true, server.DownloadsConfig{}},
+		{`downloads {
+			read_ahead 1GB
+		}`, true, server.DownloadsConfig{}},
+		{`downloads big`, true, server.DownloadsConfig{}},
+		{`downloads 1MB 2MB`, true, server.DownloadsConfig{}},
+		{`downloads {
+			cork maybe
+		}`, true, server.DownloadsConfig{}},
+		{`downloads {
+			chunk_size
+		}`, true, server.DownloadsConfig{}},
+		{`downloads {
+			write_buffer 2GB
+		}`, true, server.DownloadsConfig{}},
+		{`downloads {
+			sendfile on
+		}`, true, server.DownloadsConfig{}},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		mid, err := Downloads(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if mid != nil {
+			t.Errorf("Test %d: Expected no middleware, got some", i)
+		}
+		if !test.shouldErr && c.Downloads != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, c.Downloads)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package setup
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/mholt/caddy/middleware"
 	"github.com/mholt/caddy/middleware/errors"
+	"github.com/mholt/caddy/middleware/toggle"
 )
 
 // Errors configures a new gzip middleware instance.
@@ -18,25 +20,12 @@ func Errors(c *Controller) (middleware.Middleware, error) {
 		return nil, err
 	}
 
-	// Open the log file for writing when the server starts
-	c.Startup = append(c.Startup, func() error {
-		var err error
-		var file *os.File
-
-		if handler.LogFile == "stdout" {
-			file = os.Stdout
-		} else if handler.LogFile == "stderr" {
-			file = os.Stderr
-		} else if handler.LogFile != "" {
-			file, err = os.OpenFile(handler.LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
-			if err != nil {
-				return err
-			}
-		}
-
-		handler.Log = log.New(file, "", 0)
-		return nil
-	})
+	// The log file is opened for writing when the server starts
+	if handler.LogFile != "" {
+		handler.Log = log.New(newLogOutput(c, handler.LogFile), "", 0)
+	} else {
+		handler.Log = log.New(ioutil.Discard, "", 0)
+	}
 
 	return func(next middleware.Handler) middleware.Handler {
 		handler.Next = next
@@ -45,11 +34,15 @@ func Errors(c *Controller) (middleware.Middleware, error) {
 }
 
 func errorsParse(c *Controller) (*errors.ErrorHandler, error) {
-	// Very important that we make a pointer because the Startup
-	// function that opens the log file must have access to the
-	// same instance of the handler, not a copy.
-	handler := &errors.ErrorHandler{ErrorPages: make(map[int]string)}
+	handler := &errors.ErrorHandler{
+		ErrorPages:  make(map[int]string),
+		ClassPages:  make(map[int]string),
+		PanicPolicy: c.PanicPolicy,
+		Site:        c.Address(),
+		Locales:     siteLocales(c),
+	}
 
+	var debug bool
 	optionalBlock := func() (bool, error) {
 		var hadBlock bool
 
@@ -57,6 +50,21 @@ func errorsParse(c *Controller) (*errors.ErrorHandler, error) {
 			hadBlock = true
 
 			what := c.Val()
+			if what == "structured" {
+				scopes := c.RemainingArgs()
+				if len(scopes) == 0 {
+					scopes = []string{"/"}
+				}
+				handler.Structured = append(handler.Structured, scopes...)
+				continue
+			}
+			if what == "debug" {
+				if c.NextArg() {
+					return hadBlock, c.ArgErr()
+				}
+				debug = true
+				continue
+			}
 			if !c.NextArg() {
 				return hadBlock, c.ArgErr()
 			}
@@ -73,11 +81,18 @@ func errorsParse(c *Controller) (*errors.ErrorHandler, error) {
 				}
 				f.Close()
 
-				whatInt, err := strconv.Atoi(what)
-				if err != nil {
-					return hadBlock, c.Err("Expecting a numeric status code, got '" + what + "'")
+				switch {
+				case what == "*":
+					handler.DefaultPage = where
+				case len(what) == 3 && what[1:] == "xx" && what[0] >= '4' && what[0] <= '5':
+					handler.ClassPages[int(what[0]-'0')] = where
+				default:
+					whatInt, err := strconv.Atoi(what)
+					if err != nil {
+						return hadBlock, c.Err("Expecting a numeric status code, 4xx, 5xx or *, got '" + what + "'")
+					}
+					handler.ErrorPages[whatInt] = where
 				}
-				handler.ErrorPages[whatInt] = where
 			}
 		}
 		return hadBlock, nil
@@ -100,5 +115,10 @@ func errorsParse(c *Controller) (*errors.ErrorHandler, error) {
 		}
 	}
 
+	// Debug mode can be switched on and off while the server runs
+	handler.Debug = toggle.NewSwitch(debug)
+	addr := c.Address()
+	c.Publish = append(c.Publish, func() { toggle.Register(addr, "errors.debug", handler.Debug) })
+
 	return handler, nil
 }
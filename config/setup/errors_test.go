@@ -0,0 +1,120 @@
+package setup
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mholt/caddy/middleware/toggle"
+)
+
+func TestErrorsParse(t *testing.T) {
+	for i, test := range []struct {
+		input           string
+		shouldErr       bool
+		expectedPages   map[int]string
+		expectedClasses map[int]string
+		expectedDefault string
+	}{
+		{`errors {
+			404 404.html
+			4xx 4xx.html
+			5xx 5xx.html
+			* error.html
+		}`, false, map[int]string{404: "404.html"}, map[int]string{4: "4xx.html", 5: "5xx.html"}, "error.html"},
+		{`errors {
+			500 500.html
+		}`, false, map[int]string{500: "500.html"}, map[int]string{}, ""},
+		{`errors {
+			3xx 3xx.html
+		}`, true, nil, nil, ""},
+		{`errors {
+			4x 4x.html
+		}`, true, nil, nil, ""},
+	} {
+		c := NewTestController(test.input)
+		handler, err := errorsParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if len(handler.ErrorPages) != len(test.expectedPages) {
+			t.Errorf("Test %d: Expected pages %v, got %v", i, test.expectedPages, handler.ErrorPages)
+		}
+		for code, page := range test.expectedPages {
+			if handler.ErrorPages[code] != page {
+				t.Errorf("Test %d: Expected page %s for %d, got %s", i, page, code, handler.ErrorPages[code])
+			}
+		}
+		if len(handler.ClassPages) != len(test.expectedClasses) {
+			t.Errorf("Test %d: Expected class pages %v, got %v", i, test.expectedClasses, handler.ClassPages)
+		}
+		for class, page := range test.expectedClasses {
+			if handler.ClassPages[class] != page {
+				t.Errorf("Test %d: Expected page %s for %dxx, got %s", i, page, class, handler.ClassPages[class])
+			}
+		}
+		if handler.DefaultPage != test.expectedDefault {
+			t.Errorf("Test %d: Expected default page %q, got %q", i, test.expectedDefault, handler.DefaultPage)
+		}
+	}
+}
+
+func TestErrorsStructured(t *testing.T) {
+	for i, test := range []struct {
+		input    string
+		expected []string
+	}{
+		{"errors {\n 404 404.html\n}", nil},
+		{"errors {\n structured\n}", []string{"/"}},
+		{"errors {\n structured /api /v2\n}", []string{"/api", "/v2"}},
+	} {
+		handler, err := errorsParse(NewTestController(test.input))
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if fmt.Sprint(handler.Structured) != fmt.Sprint(test.expected) {
+			t.Errorf("Test %d: Expected structured scopes %v, got %v", i, test.expected, handler.Structured)
+		}
+	}
+}
+
+func TestErrorsDebug(t *testing.T) {
+	for i, test := range []struct {
+		input         string
+		shouldErr     bool
+		expectedDebug bool
+	}{
+		{"errors {\n debug\n}", false, true},
+		{"errors {\n 404 404.html\n}", false, false},
+		{"errors {\n debug on\n}", true, false},
+	} {
+		c := NewTestController(test.input)
+		handler, err := errorsParse(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if handler.Debug.On() != test.expectedDebug {
+			t.Errorf("Test %d: Expected debug %v, got %v", i, test.expectedDebug, handler.Debug.On())
+		}
+		for _, publish := range c.Publish {
+			publish()
+		}
+		if s, ok := toggle.Lookup(c.Address(), "errors.debug"); !ok || s != handler.Debug {
+			t.Errorf("Test %d: Expected the debug switch to be registered", i)
+		}
+	}
+}
@@ -2,8 +2,9 @@ package setup
 
 import (
 	"errors"
-	"net/http"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/mholt/caddy/middleware"
 	"github.com/mholt/caddy/middleware/fastcgi"
@@ -21,13 +22,28 @@ func FastCGI(c *Controller) (middleware.Middleware, error) {
 		return nil, err
 	}
 
+	for _, rule := range rules {
+		if pool := rule.Pool; pool != nil {
+			c.Shutdown = append(c.Shutdown, func() error {
+				pool.Close()
+				return nil
+			})
+		}
+	}
+
+	var limit *middleware.Limiter
+	if c.Limits.FastCGI > 0 {
+		limit = middleware.NewLimiter(c.Address()+" fastcgi", c.Limits.FastCGI)
+	}
+
 	return func(next middleware.Handler) middleware.Handler {
 		return fastcgi.Handler{
 			Next:            next,
 			Rules:           rules,
 			Root:            c.Root,
 			AbsRoot:         absRoot,
-			FileSys:         http.Dir(c.Root),
+			FileSys:         c.FileSystem(),
+			Limit:           limit,
 			SoftwareName:    c.AppName,
 			SoftwareVersion: c.AppVersion,
 			ServerName:      c.Host,
@@ -60,20 +76,24 @@ func fastcgiParse(c *Controller) ([]fastcgi.Rule, error) {
 			if err != nil {
 				return rules, c.Err("Invalid fastcgi rule preset '" + args[2] + "'")
 			}
+		default:
+			return rules, c.ArgErr()
 		}
 
 		for c.NextBlock() {
 			switch c.Val() {
 			case "ext":
-				if !c.NextArg() {
+				args := c.RemainingArgs()
+				if len(args) != 1 {
 					return rules, c.ArgErr()
 				}
-				rule.Ext = c.Val()
+				rule.Ext = args[0]
 			case "split":
-				if !c.NextArg() {
+				args := c.RemainingArgs()
+				if len(args) != 1 {
 					return rules, c.ArgErr()
 				}
-				rule.SplitPath = c.Val()
+				rule.SplitPath = args[0]
 			case "index":
 				args := c.RemainingArgs()
 				if len(args) == 0 {
@@ -86,9 +106,44 @@ func fastcgiParse(c *Controller) ([]fastcgi.Rule, error) {
 					return rules, c.ArgErr()
 				}
 				rule.EnvVars = append(rule.EnvVars, [2]string{envArgs[0], envArgs[1]})
+			case "pool":
+				poolArgs := c.RemainingArgs()
+				if len(poolArgs) == 0 || len(poolArgs) > 2 {
+					return rules, c.ArgErr()
+				}
+				size, err := strconv.Atoi(poolArgs[0])
+				if err != nil || size < 1 {
+					return rules, c.Errf("Invalid pool size '%s'", poolArgs[0])
+				}
+				var idleTimeout time.Duration
+				if len(poolArgs) > 1 {
+					idleTimeout, err = time.ParseDuration(poolArgs[1])
+					if err != nil || idleTimeout < 0 {
+						return rules, c.Errf("Invalid idle timeout '%s'", poolArgs[1])
+					}
+				}
+				rule.Pool = fastcgi.NewPool(rule.Address, size, idleTimeout)
+			case "protocol":
+				if !c.NextArg() {
+					return rules, c.ArgErr()
+				}
+				switch c.Val() {
+				case "fastcgi":
+					rule.Protocol = ""
+				case fastcgi.SCGI, fastcgi.UWSGI:
+					rule.Protocol = c.Val()
+				default:
+					return rules, c.Errf("Unknown protocol '%s'", c.Val())
+				}
+			default:
+				return rules, c.Errf("Unknown fastcgi property '%s'", c.Val())
 			}
 		}
 
+		if rule.Pool != nil && rule.Protocol != "" {
+			return rules, c.Errf("Connection pooling is not supported with %s", rule.Protocol)
+		}
+
 		rules = append(rules, rule)
 	}
 
@@ -1,8 +1,12 @@
 package setup
 
 import (
-	"github.com/mholt/caddy/middleware/fastcgi"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/fastcgi"
 )
 
 func TestFastCGI(t *testing.T) {
@@ -34,3 +38,186 @@ func TestFastCGI(t *testing.T) {
 	}
 
 }
+
+func TestFastCGILimit(t *testing.T) {
+	c := NewTestController(`fastcgi / 127.0.0.1:9000`)
+	c.Host, c.Port = "example.com", "8080"
+	c.Limits.FastCGI = 1
+
+	mid, err := FastCGI(c)
+	if err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	limit := mid(EmptyNext).(fastcgi.Handler).Limit
+	if !limit.Acquire() {
+		t.Fatal("Expected the first request to be let through")
+	}
+	defer limit.Release()
+	if limit.Acquire() {
+		t.Fatal("Expected the second request to be refused")
+	}
+	if hits := middleware.LimitHits.Get("example.com:8080 fastcgi"); hits == nil || hits.String() != "1" {
+		t.Errorf("Expected a hit on the limit of example.com:8080, got %v", hits)
+	}
+}
+
+func TestFastCGIPool(t *testing.T) {
+	tests := []struct {
+		input               string
+		shouldErr           bool
+		expectedSize        int
+		expectedIdleTimeout time.Duration
+	}{
+		{`fastcgi / 127.0.0.1:9000`, false, 0, 0},
+		{`fastcgi / 127.0.0.1:9000 {
+			pool 8
+		}`, false, 8, 0},
+		{`fastcgi / 127.0.0.1:9000 php {
+			pool 16 30s
+		}`, false, 16, 30 * time.Second},
+		{`fastcgi / 127.0.0.1:9000 {
+			pool
+		}`, true, 0, 0},
+		{`fastcgi / 127.0.0.1:9000 {
+			pool 0
+		}`, true, 0, 0},
+		{`fastcgi / 127.0.0.1:9000 {
+			pool 8 soon
+		}`, true, 0, 0},
+		{`fastcgi / 127.0.0.1:9000 {
+			pool 8 30s 1m
+		}`, true, 0, 0},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		rules, err := fastcgiParse(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+
+		pool := rules[0].Pool
+		if test.expectedSize == 0 {
+			if pool != nil {
+				t.Errorf("Test %d: Expected no pool, got %#v", i, pool)
+			}
+			continue
+		}
+		if pool == nil {
+			t.Errorf("Test %d: Expected a pool, got nil", i)
+			continue
+		}
+		if pool.Size != test.expectedSize {
+			t.Errorf("Test %d: Expected pool size %d, got %d", i, test.expectedSize, pool.Size)
+		}
+		if pool.IdleTimeout != test.expectedIdleTimeout {
+			t.Errorf("Test %d: Expected idle timeout %v, got %v", i, test.expectedIdleTimeout, pool.IdleTimeout)
+		}
+	}
+}
+
+func TestFastCGIProtocol(t *testing.T) {
+	tests := []struct {
+		input            string
+		shouldErr        bool
+		expectedProtocol string
+	}{
+		{`fastcgi / 127.0.0.1:9000`, false, ""},
+		{`fastcgi / 127.0.0.1:9000 {
+			protocol fastcgi
+		}`, false, ""},
+		{`fastcgi / 127.0.0.1:4000 {
+			protocol scgi
+		}`, false, fastcgi.SCGI},
+		{`fastcgi / /tmp/uwsgi.sock {
+			protocol uwsgi
+			ext .py
+		}`, false, fastcgi.UWSGI},
+		{`fastcgi / 127.0.0.1:4000 {
+			protocol
+		}`, true, ""},
+		{`fastcgi / 127.0.0.1:4000 {
+			protocol ajp
+		}`, true, ""},
+		{`fastcgi / 127.0.0.1:4000 {
+			protocol scgi
+			pool 8
+		}`, true, ""},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		rules, err := fastcgiParse(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if rules[0].Protocol != test.expectedProtocol {
+			t.Errorf("Test %d: Expected protocol '%s', got '%s'", i, test.expectedProtocol, rules[0].Protocol)
+		}
+	}
+}
+
+func TestFastCGIParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  fastcgi.Rule
+	}{
+		{`fastcgi 127.0.0.1:9000`, false, fastcgi.Rule{Path: "/", Address: "127.0.0.1:9000"}},
+		{`fastcgi / unix:/run/php-fpm.sock php`, false, fastcgi.Rule{
+			Path: "/", Address: "unix:/run/php-fpm.sock", Ext: ".php", SplitPath: ".php", IndexFiles: []string{"index.php"},
+		}},
+		{`fastcgi /app 127.0.0.1:9000 {
+			ext .php5
+			split .php5
+			index app.php5 index.php5
+			env APP_ENV production
+		}`, false, fastcgi.Rule{
+			Path: "/app", Address: "127.0.0.1:9000", Ext: ".php5", SplitPath: ".php5",
+			IndexFiles: []string{"app.php5", "index.php5"}, EnvVars: [][2]string{{"APP_ENV", "production"}},
+		}},
+		{`fastcgi`, true, fastcgi.Rule{}},
+		{`fastcgi / 127.0.0.1:9000 perl`, true, fastcgi.Rule{}},
+		{`fastcgi / 127.0.0.1:9000 php extra`, true, fastcgi.Rule{}},
+		{`fastcgi / 127.0.0.1:9000 {
+			ext
+		}`, true, fastcgi.Rule{}},
+		{`fastcgi / 127.0.0.1:9000 {
+			split .php .php5
+		}`, true, fastcgi.Rule{}},
+		{`fastcgi / 127.0.0.1:9000 {
+			root /var/www
+		}`, true, fastcgi.Rule{}},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		rules, err := fastcgiParse(c)
+
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules[0], test.expected) {
+			t.Errorf("Test %d: Expected rule %+v, got %+v", i, test.expected, rules[0])
+		}
+	}
+}
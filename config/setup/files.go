@@ -0,0 +1,70 @@
+package setup
+
+import (
+	"path"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Files configures how the file server finds and describes the
+// files of the site. The syntax is
+//
+//	files {
+//		index names...
+//		hide  patterns...
+//		etag  on|off
+//	}
+//
+// where index gives the files served for a directory, most preferred
+// first, hide gives the patterns of files and directories served as
+// though they don't exist (see middleware.HiddenPath), and etag turns
+// off the ETag that files are served with. Browse doesn't list hidden
+// files, nor directories that have one of the index files.
+func Files(c *Controller) (middleware.Middleware, error) {
+	for c.Next() {
+		if len(c.RemainingArgs()) > 0 {
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return nil, c.ArgErr()
+			}
+
+			switch what {
+			case "index":
+				for _, name := range args {
+					if strings.Contains(name, "/") {
+						return nil, c.Errf("Index file '%s' must be a file name, not a path", name)
+					}
+				}
+				c.Files.IndexPages = args
+			case "hide":
+				for _, pattern := range args {
+					if _, err := path.Match(pattern, ""); err != nil {
+						return nil, c.Errf("Invalid hide pattern '%s': %v", pattern, err)
+					}
+				}
+				c.Files.Hide = append(c.Files.Hide, args...)
+			case "etag":
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case "on":
+					c.Files.NoETag = false
+				case "off":
+					c.Files.NoETag = true
+				default:
+					return nil, c.Errf("Invalid etag setting '%s'; use on or off", args[0])
+				}
+			default:
+				return nil, c.Errf("Unknown files option '%s'", what)
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,67 @@
+package setup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy/server"
+)
+
+func TestFiles(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  server.FilesConfig
+	}{
+		{`files`, false, server.FilesConfig{}},
+		{`files {
+			index home.html index.html
+			hide  .git *.bak
+			hide  /private/*
+			etag  off
+		}`, false, server.FilesConfig{
+			IndexPages: []string{"home.html", "index.html"},
+			Hide:       []string{".git", "*.bak", "/private/*"},
+			NoETag:     true,
+		}},
+		{`files {
+			etag off
+		}
+		files {
+			etag on
+		}`, false, server.FilesConfig{}},
+		{`files extra`, true, server.FilesConfig{}},
+		{`files {
+			index
+		}`, true, server.FilesConfig{}},
+		{`files {
+			index sub/index.html
+		}`, true, server.FilesConfig{}},
+		{`files {
+			hide [
+		}`, true, server.FilesConfig{}},
+		{`files {
+			etag maybe
+		}`, true, server.FilesConfig{}},
+		{`files {
+			gzip on
+		}`, true, server.FilesConfig{}},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		mid, err := Files(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if mid != nil {
+			t.Errorf("Test %d: Expected no middleware, got some", i)
+		}
+		if !test.shouldErr && !reflect.DeepEqual(c.Files, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, c.Files)
+		}
+	}
+}
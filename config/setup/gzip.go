@@ -62,17 +62,72 @@ func gzipParse(c *Controller) ([]gzip.Config, error) {
 					}
 					pathFilter.IgnoredPaths.Add(p)
 				}
+			case "encodings":
+				names := c.RemainingArgs()
+				if len(names) == 0 {
+					return configs, c.ArgErr()
+				}
+				for _, name := range names {
+					if _, err := gzipEncoding(c, name); err != nil {
+						return configs, err
+					}
+				}
+				config.Encodings = names
 			case "level":
-				if !c.NextArg() {
+				// level [encoding] n; the encoding is gzip if not given
+				args := c.RemainingArgs()
+				name := "gzip"
+				switch len(args) {
+				case 1:
+				case 2:
+					name = args[0]
+				default:
+					return configs, c.ArgErr()
+				}
+				e, err := gzipEncoding(c, name)
+				if err != nil {
+					return configs, err
+				}
+				level, err := strconv.Atoi(args[len(args)-1])
+				if err != nil || !e.ValidLevel(level) {
+					return configs, c.Errf("Invalid %s compression level '%s'", name, args[len(args)-1])
+				}
+				if config.Levels == nil {
+					config.Levels = make(map[string]int)
+				}
+				config.Levels[name] = level
+			case "mime":
+				types := c.RemainingArgs()
+				if len(types) == 0 {
+					return configs, c.ArgErr()
+				}
+				for _, t := range types {
+					if i := strings.Index(t, "/"); i <= 0 || i == len(t)-1 {
+						return configs, c.Errf("Invalid media type '%s'; use a type like text/html or text/*", t)
+					}
+				}
+				config.MIMETypes = append(config.MIMETypes, types...)
+			case "min_length":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
 					return configs, c.ArgErr()
 				}
-				level, _ := strconv.Atoi(c.Val())
-				config.Level = level
+				length, err := strconv.Atoi(args[0])
+				if err != nil || length < 0 {
+					return configs, c.Errf("Invalid minimum length '%s'", args[0])
+				}
+				config.MinLength = length
 			default:
 				return configs, c.ArgErr()
 			}
 		}
 
+		for name := range config.Levels {
+			if !hasString(config.Encodings, name) && !(name == "gzip" && len(config.Encodings) == 0) {
+				return configs, c.Errf("Compression level given for %s, which isn't one of the encodings", name)
+			}
+		}
+
 		config.Filters = []gzip.Filter{}
 
 		// If ignored paths are specified, put in front to filter with path first
@@ -93,3 +148,25 @@ func gzipParse(c *Controller) ([]gzip.Config, error) {
 
 	return configs, nil
 }
+
+// gzipEncoding returns the compression encoding called name.
+func gzipEncoding(c *Controller, name string) (gzip.Encoding, error) {
+	e, ok := gzip.LookupEncoding(name)
+	if !ok {
+		if name == "br" {
+			return nil, c.Err("Brotli (br) is not built in; build with -tags brotli")
+		}
+		return nil, c.Errf("Unknown encoding '%s'; use one of %s", name, strings.Join(gzip.EncodingNames(), ", "))
+	}
+	return e, nil
+}
+
+// hasString returns true if list contains s.
+func hasString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -73,6 +73,26 @@ func TestGzip(t *testing.T) {
 		 level 1
 		}
 		`, false},
+		{`gzip { level 0 } `, true},
+		{`gzip { level fast } `, true},
+		{`gzip { level gzip 4 } `, false},
+		{`gzip { encodings gzip
+		 level gzip 4
+		} `, false},
+		{`gzip { encodings zstd } `, true},
+		{`gzip { encodings br } `, len(gzip.EncodingNames()) == 1},
+		{`gzip { encodings } `, true},
+		{`gzip { level zstd 4 } `, true},
+		{`gzip { level gzip 4 5 } `, true},
+		{`gzip { mime text/* application/json } `, false},
+		{`gzip { mime } `, true},
+		{`gzip { mime html } `, true},
+		{`gzip { mime text/ } `, true},
+		{`gzip { min_length 1024 } `, false},
+		{`gzip { min_length } `, true},
+		{`gzip { min_length -1 } `, true},
+		{`gzip { min_length 1k } `, true},
+		{`gzip { min_length 1 2 } `, true},
 	}
 	for i, test := range tests {
 		c := NewTestController(test.input)
@@ -84,3 +104,43 @@ func TestGzip(t *testing.T) {
 		}
 	}
 }
+
+func TestGzipLevels(t *testing.T) {
+	c := NewTestController(`gzip {
+		encodings gzip
+		level gzip 9
+	}
+	gzip {
+		level 2
+	}`)
+	configs, err := gzipParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("Expected 2 configs, got %d", len(configs))
+	}
+	if configs[0].Levels["gzip"] != 9 || len(configs[0].Encodings) != 1 {
+		t.Errorf("Expected gzip at level 9, got %+v", configs[0])
+	}
+	if configs[1].Levels["gzip"] != 2 || len(configs[1].Encodings) != 0 {
+		t.Errorf("Expected the default encodings with gzip at level 2, got %+v", configs[1])
+	}
+}
+
+func TestGzipConditions(t *testing.T) {
+	c := NewTestController(`gzip {
+		mime text/* application/json
+		min_length 512
+	}`)
+	configs, err := gzipParse(c)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if got := configs[0].MIMETypes; len(got) != 2 || got[0] != "text/*" || got[1] != "application/json" {
+		t.Errorf("Expected MIME types [text/* application/json], got %v", got)
+	}
+	if got := configs[0].MinLength; got != 512 {
+		t.Errorf("Expected minimum length 512, got %d", got)
+	}
+}
@@ -0,0 +1,90 @@
+package setup
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/hotlink"
+)
+
+// Hotlink configures a new Hotlink middleware instance.
+// The syntax is
+//
+//	hotlink [exts...] {
+//		allow       hosts...
+//		empty       allow|block
+//		placeholder path
+//	}
+//
+// Files with the extensions (common image, video and audio
+// ones by default) may only be requested from pages of the
+// site, its other hostnames, and the hosts that are allowed.
+func Hotlink(c *Controller) (middleware.Middleware, error) {
+	h, err := hotlinkParse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		h.Next = next
+		return h
+	}, nil
+}
+
+func hotlinkParse(c *Controller) (hotlink.Hotlink, error) {
+	var h hotlink.Hotlink
+
+	// the site's other hostnames may embed its files
+	for _, host := range c.Hosts {
+		if host != c.Host && host != "" && host != "0.0.0.0" {
+			h.Allowed = append(h.Allowed, host)
+		}
+	}
+
+	for c.Next() {
+		for _, ext := range c.RemainingArgs() {
+			if !strings.HasPrefix(ext, ".") {
+				return h, c.Errf("Invalid extension '%s' (must start with dot)", ext)
+			}
+			h.Extensions = append(h.Extensions, strings.ToLower(ext))
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			if len(args) == 0 {
+				return h, c.ArgErr()
+			}
+
+			switch what {
+			case "allow":
+				h.Allowed = append(h.Allowed, args...)
+			case "empty":
+				if len(args) != 1 {
+					return h, c.ArgErr()
+				}
+				switch args[0] {
+				case "allow":
+					h.BlockEmpty = false
+				case "block":
+					h.BlockEmpty = true
+				default:
+					return h, c.Errf("Invalid empty referer policy '%s'; use allow or block", args[0])
+				}
+			case "placeholder":
+				if len(args) != 1 {
+					return h, c.ArgErr()
+				}
+				h.Placeholder = args[0]
+			default:
+				return h, c.Errf("Unknown hotlink property '%s'", what)
+			}
+		}
+	}
+
+	if len(h.Extensions) == 0 {
+		h.Extensions = hotlink.DefaultExtensions
+	}
+
+	return h, nil
+}
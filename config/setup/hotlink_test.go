@@ -0,0 +1,61 @@
+package setup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy/middleware/hotlink"
+)
+
+func TestHotlinkParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  hotlink.Hotlink
+	}{
+		{`hotlink`, false, hotlink.Hotlink{
+			Extensions: hotlink.DefaultExtensions,
+			Allowed:    []string{"www.example.com"},
+		}},
+		{`hotlink .JPG .png {
+			allow friend.org *.friend.org
+			empty block
+			placeholder /hotlinked.png
+		}`, false, hotlink.Hotlink{
+			Extensions:  []string{".jpg", ".png"},
+			Allowed:     []string{"www.example.com", "friend.org", "*.friend.org"},
+			BlockEmpty:  true,
+			Placeholder: "/hotlinked.png",
+		}},
+		{`hotlink jpg`, true, hotlink.Hotlink{}},
+		{`hotlink {
+			allow
+		}`, true, hotlink.Hotlink{}},
+		{`hotlink {
+			empty sometimes
+		}`, true, hotlink.Hotlink{}},
+		{`hotlink {
+			placeholder /a.png /b.png
+		}`, true, hotlink.Hotlink{}},
+		{`hotlink {
+			deny thief.net
+		}`, true, hotlink.Hotlink{}},
+	}
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		c.Host, c.Hosts = "example.com", []string{"example.com", "www.example.com"}
+
+		actual, err := hotlinkParse(c)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if err != nil || test.shouldErr {
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
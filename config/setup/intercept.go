@@ -0,0 +1,89 @@
+package setup
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/intercept"
+)
+
+// Intercept configures a new Intercept middleware instance.
+func Intercept(c *Controller) (middleware.Middleware, error) {
+	rules, err := interceptParse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return intercept.Intercept{Next: next, FileSys: c.FileSystem(), Rules: rules}
+	}, nil
+}
+
+// interceptParse parses the intercept directive, which is
+//
+//	intercept [path] [status...] {
+//		status [file] [new_status]
+//	}
+//
+// A status on its own is handed to the errors middleware. With a
+// file, the file is served instead; new_status replaces the status
+// the file is served or handed on with.
+func interceptParse(c *Controller) ([]intercept.Rule, error) {
+	var rules []intercept.Rule
+
+	for c.Next() {
+		rule := intercept.Rule{Path: "/", Statuses: make(map[int]intercept.Action)}
+
+		args := c.RemainingArgs()
+		if len(args) > 0 && strings.HasPrefix(args[0], "/") {
+			rule.Path = args[0]
+			args = args[1:]
+		}
+		for _, arg := range args {
+			status, err := parseInterceptStatus(c, arg)
+			if err != nil {
+				return rules, err
+			}
+			rule.Statuses[status] = intercept.Action{Status: status}
+		}
+
+		for c.NextBlock() {
+			status, err := parseInterceptStatus(c, c.Val())
+			if err != nil {
+				return rules, err
+			}
+			action := intercept.Action{Status: status}
+			args := c.RemainingArgs()
+			if len(args) > 0 && strings.HasPrefix(args[0], "/") {
+				action.File = args[0]
+				args = args[1:]
+			}
+			switch len(args) {
+			case 0:
+			case 1:
+				if action.Status, err = parseInterceptStatus(c, args[0]); err != nil {
+					return rules, err
+				}
+			default:
+				return rules, c.ArgErr()
+			}
+			rule.Statuses[status] = action
+		}
+
+		if len(rule.Statuses) == 0 {
+			return rules, c.ArgErr()
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func parseInterceptStatus(c *Controller, s string) (int, error) {
+	status, err := strconv.Atoi(s)
+	if err != nil || status < 100 || status > 999 {
+		return 0, c.Errf("invalid status code '%s'", s)
+	}
+	return status, nil
+}
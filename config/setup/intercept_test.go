@@ -0,0 +1,84 @@
+package setup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy/middleware/intercept"
+)
+
+func TestIntercept(t *testing.T) {
+	c := NewTestController(`intercept 502`)
+
+	mid, err := Intercept(c)
+	if err != nil {
+		t.Errorf("Expected no errors, but got: %v", err)
+	}
+	if mid == nil {
+		t.Fatal("Expected middleware, was nil instead")
+	}
+
+	handler := mid(EmptyNext)
+	myHandler, ok := handler.(intercept.Intercept)
+	if !ok {
+		t.Fatalf("Expected handler to be type Intercept, got: %#v", handler)
+	}
+
+	if !SameNext(myHandler.Next, EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestInterceptParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []intercept.Rule
+	}{
+		{`intercept 502 504`, false, []intercept.Rule{
+			{Path: "/", Statuses: map[int]intercept.Action{
+				502: {Status: 502},
+				504: {Status: 504},
+			}},
+		}},
+		{`intercept /api {
+			404 /404.html
+			500 /oops.html 200
+			503 502
+		}`, false, []intercept.Rule{
+			{Path: "/api", Statuses: map[int]intercept.Action{
+				404: {File: "/404.html", Status: 404},
+				500: {File: "/oops.html", Status: 200},
+				503: {Status: 502},
+			}},
+		}},
+		{`intercept /api 502
+		intercept /app 404`, false, []intercept.Rule{
+			{Path: "/api", Statuses: map[int]intercept.Action{502: {Status: 502}}},
+			{Path: "/app", Statuses: map[int]intercept.Action{404: {Status: 404}}},
+		}},
+		{`intercept`, true, nil},
+		{`intercept /api`, true, nil},
+		{`intercept notastatus`, true, nil},
+		{`intercept / {
+			404 /404.html 200 extra
+		}`, true, nil},
+		{`intercept / {
+			404 /404.html 99
+		}`, true, nil},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		actual, err := interceptParse(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if !test.shouldErr && !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: Expected rules %+v, but got %+v", i, test.expected, actual)
+		}
+	}
+}
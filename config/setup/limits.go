@@ -0,0 +1,60 @@
+package setup
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy/middleware"
+)
+
+// Limits sets the caps on the resources the site may use.
+func Limits(c *Controller) (middleware.Middleware, error) {
+	for c.Next() {
+		if len(c.RemainingArgs()) > 0 {
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return nil, c.ArgErr()
+			}
+			val := c.Val()
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+
+			switch what {
+			case "fastcgi":
+				n, err := strconv.Atoi(val)
+				if err != nil || n < 1 {
+					return nil, c.Errf("Invalid fastcgi limit '%s'", val)
+				}
+				c.Limits.FastCGI = n
+			case "cache_memory":
+				size, err := humanize.ParseBytes(val)
+				if err != nil || size < 1 {
+					return nil, c.Errf("Invalid cache_memory limit '%s'", val)
+				}
+				c.Limits.CacheMemory = int64(size)
+			case "open_files":
+				n, err := strconv.Atoi(val)
+				if err != nil || n < 1 {
+					return nil, c.Errf("Invalid open_files limit '%s'", val)
+				}
+				c.Limits.OpenFiles = n
+			case "request_timeout":
+				dur, err := time.ParseDuration(val)
+				if err != nil || dur <= 0 {
+					return nil, c.Errf("Invalid request_timeout limit '%s'", val)
+				}
+				c.Limits.RequestTimeout = dur
+			default:
+				return nil, c.Errf("Unknown limit '%s'", what)
+			}
+		}
+	}
+
+	return nil, nil
+}
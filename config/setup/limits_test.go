@@ -0,0 +1,64 @@
+package setup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/server"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  server.Limits
+	}{
+		{`limits {
+			fastcgi 16
+			cache_memory 64MB
+			open_files 1000
+		}`, false, server.Limits{FastCGI: 16, CacheMemory: 64000000, OpenFiles: 1000}},
+		{`limits {
+			cache_memory 1MiB
+		}`, false, server.Limits{CacheMemory: 1 << 20}},
+		{`limits {
+			fastcgi 0
+		}`, true, server.Limits{}},
+		{`limits {
+			fastcgi
+		}`, true, server.Limits{}},
+		{`limits {
+			fastcgi 1 2
+		}`, true, server.Limits{}},
+		{`limits {
+			cache_memory lots
+		}`, true, server.Limits{}},
+		{`limits {
+			cgi 4
+		}`, true, server.Limits{}},
+		{`limits {
+			request_timeout 30s
+		}`, false, server.Limits{RequestTimeout: 30 * time.Second}},
+		{`limits {
+			request_timeout forever
+		}`, true, server.Limits{}},
+		{`limits fastcgi 4`, true, server.Limits{}},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		mid, err := Limits(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if mid != nil {
+			t.Errorf("Test %d: Expected no middleware, got some", i)
+		}
+		if !test.shouldErr && c.Limits != test.expected {
+			t.Errorf("Test %d: Expected limits %+v, got %+v", i, test.expected, c.Limits)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package setup
+
+import (
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/i18n"
+)
+
+// Locales sets the translations of the pages the server makes
+// itself, such as default error pages and directory listings,
+// which are served in the language the client prefers. The
+// syntax is
+//
+//	locales dir|off
+//
+// where dir holds translation files named by locale, like
+// de.json, which add to or override the translations that come
+// with the server. With off, pages are only served in English.
+func Locales(c *Controller) (middleware.Middleware, error) {
+	for c.Next() {
+		if !c.NextArg() {
+			return nil, c.ArgErr()
+		}
+		dir := c.Val()
+		if c.NextArg() {
+			return nil, c.ArgErr()
+		}
+
+		if dir == "off" {
+			c.Locales = new(i18n.Catalog)
+			continue
+		}
+		catalog := i18n.NewCatalog()
+		if err := catalog.LoadDir(dir); err != nil {
+			return nil, c.Errf("Loading translations: %v", err)
+		}
+		c.Locales = catalog
+	}
+	return nil, nil
+}
+
+// siteLocales returns the translations of c's site.
+func siteLocales(c *Controller) *i18n.Catalog {
+	if c.Locales != nil {
+		return c.Locales
+	}
+	return i18n.Default
+}
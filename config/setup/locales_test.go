@@ -0,0 +1,58 @@
+package setup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLocales(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "nl.json"), []byte(`{"status.404": "Niet gevonden"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(dir, "bad")
+	os.Mkdir(bad, 0755)
+	if err := ioutil.WriteFile(filepath.Join(bad, "nl.json"), []byte(`{"status.404":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []string
+	}{
+		{`locales ` + dir, false, []string{"de", "en", "es", "fr", "nl"}},
+		{`locales off`, false, nil},
+		{`locales`, true, nil},
+		{`locales ` + dir + ` extra`, true, nil},
+		{`locales ` + filepath.Join(dir, "missing"), true, nil},
+		{`locales ` + bad, true, nil},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		mid, err := Locales(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if mid != nil {
+			t.Errorf("Test %d: Expected no middleware, got some", i)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if got := siteLocales(c).Locales(); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Test %d: Expected locales %v, got %v", i, test.expected, got)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package setup
 
 import (
 	"log"
-	"os"
 
 	"github.com/mholt/caddy/middleware"
 	caddylog "github.com/mholt/caddy/middleware/log"
@@ -16,31 +15,13 @@ func Log(c *Controller) (middleware.Middleware, error) {
 		return nil, err
 	}
 
-	// Open the log files for writing when the server starts
-	c.Startup = append(c.Startup, func() error {
-		for i := 0; i < len(rules); i++ {
-			var err error
-			var file *os.File
-
-			if rules[i].OutputFile == "stdout" {
-				file = os.Stdout
-			} else if rules[i].OutputFile == "stderr" {
-				file = os.Stderr
-			} else {
-				file, err = os.OpenFile(rules[i].OutputFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
-				if err != nil {
-					return err
-				}
-			}
-
-			rules[i].Log = log.New(file, "", 0)
-		}
-
-		return nil
-	})
+	// The log files are opened for writing when the server starts
+	for i := range rules {
+		rules[i].Log = log.New(newLogOutput(c, rules[i].OutputFile), "", 0)
+	}
 
 	return func(next middleware.Handler) middleware.Handler {
-		return caddylog.Logger{Next: next, Rules: rules, ErrorFunc: server.DefaultErrorFunc}
+		return caddylog.Logger{Next: next, Rules: rules, ErrorFunc: server.DefaultErrorFunc, Site: c.Address()}
 	}, nil
 }
 
@@ -49,44 +30,62 @@ func logParse(c *Controller) ([]caddylog.Rule, error) {
 
 	for c.Next() {
 		args := c.RemainingArgs()
+		rule := caddylog.Rule{
+			PathScope:  "/",
+			OutputFile: caddylog.DefaultLogFilename,
+			Format:     caddylog.DefaultLogFormat,
+		}
 
-		if len(args) == 0 {
+		switch len(args) {
+		case 0:
 			// Nothing specified; use defaults
-			rules = append(rules, caddylog.Rule{
-				PathScope:  "/",
-				OutputFile: caddylog.DefaultLogFilename,
-				Format:     caddylog.DefaultLogFormat,
-			})
-		} else if len(args) == 1 {
+		case 1:
 			// Only an output file specified
-			rules = append(rules, caddylog.Rule{
-				PathScope:  "/",
-				OutputFile: args[0],
-				Format:     caddylog.DefaultLogFormat,
-			})
-		} else {
+			rule.OutputFile = args[0]
+		default:
 			// Path scope, output file, and maybe a format specified
-
-			format := caddylog.DefaultLogFormat
-
+			rule.PathScope = args[0]
+			rule.OutputFile = args[1]
 			if len(args) > 2 {
-				switch args[2] {
-				case "{common}":
-					format = caddylog.CommonLogFormat
-				case "{combined}":
-					format = caddylog.CombinedLogFormat
-				default:
-					format = args[2]
-				}
+				setLogFormat(&rule, args[2])
 			}
+		}
 
-			rules = append(rules, caddylog.Rule{
-				PathScope:  args[0],
-				OutputFile: args[1],
-				Format:     format,
-			})
+		for c.NextBlock() {
+			switch c.Val() {
+			case "format":
+				if !c.NextArg() {
+					return rules, c.ArgErr()
+				}
+				setLogFormat(&rule, c.Val())
+				if c.NextArg() {
+					return rules, c.ArgErr()
+				}
+			default:
+				return rules, c.Errf("Unknown log property '%s'", c.Val())
+			}
 		}
+
+		rules = append(rules, rule)
 	}
 
 	return rules, nil
 }
+
+// setLogFormat sets the format of rule to format, which
+// is a placeholder format or the name of a known one: "json",
+// "common" or "combined", which may be in curly braces.
+func setLogFormat(rule *caddylog.Rule, format string) {
+	rule.JSON = false
+	switch format {
+	case "{common}", "common":
+		rule.Format = caddylog.CommonLogFormat
+	case "{combined}", "combined":
+		rule.Format = caddylog.CombinedLogFormat
+	case "{json}", "json":
+		rule.Format = ""
+		rule.JSON = true
+	default:
+		rule.Format = format
+	}
+}
@@ -1,6 +1,9 @@
 package setup
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	caddylog "github.com/mholt/caddy/middleware/log"
@@ -98,6 +101,34 @@ func TestLogParse(t *testing.T) {
 			OutputFile: "log.txt",
 			Format:     "{when}",
 		}}},
+		{`log /api log.json {json}`, false, []caddylog.Rule{{
+			PathScope:  "/api",
+			OutputFile: "log.json",
+			JSON:       true,
+		}}},
+		{`log / access.log {
+			format json
+		}`, false, []caddylog.Rule{{
+			PathScope:  "/",
+			OutputFile: "access.log",
+			JSON:       true,
+		}}},
+		{`log stdout {
+			format combined
+		}`, false, []caddylog.Rule{{
+			PathScope:  "/",
+			OutputFile: "stdout",
+			Format:     caddylog.CombinedLogFormat,
+		}}},
+		{`log {
+			format
+		}`, true, nil},
+		{`log {
+			format json extra
+		}`, true, nil},
+		{`log {
+			rotate daily
+		}`, true, nil},
 	}
 	for i, test := range tests {
 		c := NewTestController(test.inputLogRules)
@@ -108,6 +139,9 @@ func TestLogParse(t *testing.T) {
 		} else if err != nil && !test.shouldErr {
 			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
 		}
+		if test.shouldErr {
+			continue
+		}
 		if len(actualLogRules) != len(test.expectedLogRules) {
 			t.Fatalf("Test %d expected %d no of Log rules, but got %d ",
 				i, len(test.expectedLogRules), len(actualLogRules))
@@ -124,6 +158,11 @@ func TestLogParse(t *testing.T) {
 					i, j, test.expectedLogRules[j].OutputFile, actualLogRule.OutputFile)
 			}
 
+			if actualLogRule.JSON != test.expectedLogRules[j].JSON {
+				t.Errorf("Test %d expected %dth LogRule JSON to be %v, but got %v",
+					i, j, test.expectedLogRules[j].JSON, actualLogRule.JSON)
+			}
+
 			if actualLogRule.Format != test.expectedLogRules[j].Format {
 				t.Errorf("Test %d expected %dth LogRule Format to be  %s  , but got %s",
 					i, j, test.expectedLogRules[j].Format, actualLogRule.Format)
@@ -132,3 +171,50 @@ func TestLogParse(t *testing.T) {
 	}
 
 }
+
+func TestLogOutputReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "access.log")
+
+	c := NewTestController(`log`)
+	out := newLogOutput(c, name)
+	for _, fn := range c.Startup {
+		if err := fn(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		for _, fn := range c.Shutdown {
+			fn()
+		}
+	}()
+
+	out.Write([]byte("first\n"))
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := caddylog.Reopen(); err != nil {
+		t.Fatalf("Expected no error reopening, got: %v", err)
+	}
+	out.Write([]byte("second\n"))
+
+	if rotated, _ := ioutil.ReadFile(name + ".1"); string(rotated) != "first\n" {
+		t.Errorf("Expected the rotated file to have the first line, got %q", rotated)
+	}
+	if current, _ := ioutil.ReadFile(name); string(current) != "second\n" {
+		t.Errorf("Expected the new file to have the second line, got %q", current)
+	}
+
+	// copytruncate leaves the file in place but empties it
+	if err := os.Truncate(name, 0); err != nil {
+		t.Fatal(err)
+	}
+	out.Write([]byte("third\n"))
+	if current, _ := ioutil.ReadFile(name); string(current) != "third\n" {
+		t.Errorf("Expected a truncated file to be written from the start, got %q", current)
+	}
+}
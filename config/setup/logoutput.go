@@ -0,0 +1,110 @@
+package setup
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	caddylog "github.com/mholt/caddy/middleware/log"
+	"github.com/mholt/caddy/middleware/logsink"
+	"github.com/mholt/caddy/server"
+)
+
+// logOutput is where a log is written: stdout, stderr, an
+// external collector (see logsink.Open), or else a file. It
+// is opened when the server starts, and may not be written
+// to before then.
+type logOutput struct {
+	name string
+	c    *Controller
+
+	mu   sync.Mutex // protects w, which a file is swapped out of when reopened
+	w    io.Writer
+	file *os.File
+}
+
+// newLogOutput returns the log output named name, and arranges
+// for it to be opened when the server starts. Collectors are
+// closed when it shuts down, so the entries they are holding
+// get sent. Files are reopened by caddylog.Reopen while the
+// server is running, for log rotation.
+func newLogOutput(c *Controller, name string) *logOutput {
+	out := &logOutput{name: name, c: c}
+	c.Startup = append(c.Startup, out.open)
+	if logsink.IsTarget(name) {
+		c.Shutdown = append(c.Shutdown, out.Close)
+	} else if out.isFile() {
+		c.Checks = append(c.Checks, server.Check{What: "log file " + name, Run: server.CheckWritableFile(name)})
+		c.Startup = append(c.Startup, func() error {
+			caddylog.RegisterOutput(out)
+			return nil
+		})
+		c.Shutdown = append(c.Shutdown, func() error {
+			caddylog.UnregisterOutput(out)
+			return nil
+		})
+	}
+	return out
+}
+
+// isFile returns true if the output is a file.
+func (out *logOutput) isFile() bool {
+	return out.name != "stdout" && out.name != "stderr" && !logsink.IsTarget(out.name)
+}
+
+func (out *logOutput) open() error {
+	switch {
+	case out.name == "stdout":
+		out.w = os.Stdout
+	case out.name == "stderr":
+		out.w = os.Stderr
+	case logsink.IsTarget(out.name):
+		sink, err := logsink.Open(out.name)
+		if err != nil {
+			return err
+		}
+		out.w = sink
+	default:
+		file, err := out.c.FilePerms.OpenFile(out.name, os.O_RDWR|os.O_CREATE|os.O_APPEND)
+		if err != nil {
+			return err
+		}
+		out.w, out.file = file, file
+	}
+	return nil
+}
+
+func (out *logOutput) Write(p []byte) (int, error) {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	return out.w.Write(p)
+}
+
+// Reopen implements caddylog.Reopener. A file is opened again
+// by name, in case it was moved away, and only then is the old
+// one closed, so no entry is lost. Other outputs are left alone.
+func (out *logOutput) Reopen() error {
+	if !out.isFile() {
+		return nil
+	}
+	file, err := out.c.FilePerms.OpenFile(out.name, os.O_RDWR|os.O_CREATE|os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	out.mu.Lock()
+	old := out.file
+	out.w, out.file = file, file
+	out.mu.Unlock()
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+// Close closes the output if it is a collector.
+func (out *logOutput) Close() error {
+	if closer, ok := out.w.(io.Closer); ok && logsink.IsTarget(out.name) {
+		return closer.Close()
+	}
+	return nil
+}
@@ -2,7 +2,6 @@ package setup
 
 import (
 	"io/ioutil"
-	"net/http"
 	"os"
 	"path"
 	"path/filepath"
@@ -22,9 +21,10 @@ func Markdown(c *Controller) (middleware.Middleware, error) {
 
 	md := markdown.Markdown{
 		Root:       c.Root,
-		FileSys:    http.Dir(c.Root),
+		FileSys:    c.FileSystem(),
 		Configs:    mdconfigs,
 		IndexFiles: []string{"index.md"},
+		FilePerms:  c.FilePerms,
 	}
 
 	// For any configs that enabled static site gen, sweep the whole path at startup
@@ -44,22 +44,33 @@ func Markdown(c *Controller) (middleware.Middleware, error) {
 			}
 
 			fp := filepath.Join(md.Root, cfg.PathScope)
-			filepath.Walk(fp, func(path string, info os.FileInfo, err error) error {
+			err = filepath.Walk(fp, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
 				for _, ext := range cfg.Extensions {
 					if !info.IsDir() && strings.HasSuffix(info.Name(), ext) {
-						// Load the file
-						body, err := ioutil.ReadFile(path)
-						if err != nil {
-							return err
-						}
-
 						// Get the relative path as if it were a HTTP request,
 						// then prepend with "/" (like a real HTTP request)
 						reqPath, err := filepath.Rel(md.Root, path)
 						if err != nil {
 							return err
 						}
-						reqPath = "/" + reqPath
+						reqPath = "/" + filepath.ToSlash(reqPath)
+
+						// Load the file the way it would be served, so
+						// links out of a confined root are skipped
+						f, err := md.FileSys.Open(reqPath)
+						if os.IsNotExist(err) {
+							break
+						} else if err != nil {
+							return err
+						}
+						body, err := ioutil.ReadAll(f)
+						f.Close()
+						if err != nil {
+							return err
+						}
 
 						// Generate the static file
 						_, err = md.Process(cfg, reqPath, body)
@@ -73,6 +84,9 @@ func Markdown(c *Controller) (middleware.Middleware, error) {
 
 				return nil
 			})
+			if err != nil {
+				return err
+			}
 		}
 
 		return nil
@@ -0,0 +1,67 @@
+package setup
+
+import (
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/server"
+)
+
+// MemCache makes the file server keep small files in memory.
+// The syntax is
+//
+//	memcache [max_size]
+//	memcache {
+//		max_size 256KB
+//		mmap
+//	}
+//
+// The memory all files may take is set with 'limits { cache_memory }'.
+func MemCache(c *Controller) (middleware.Middleware, error) {
+	c.MemCache = server.MemCacheConfig{Enabled: true, MaxFileSize: server.DefaultMemCacheMaxFileSize}
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			size, err := parseMemCacheSize(c, args[0])
+			if err != nil {
+				return nil, err
+			}
+			c.MemCache.MaxFileSize = size
+		default:
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "max_size":
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				size, err := parseMemCacheSize(c, c.Val())
+				if err != nil {
+					return nil, err
+				}
+				c.MemCache.MaxFileSize = size
+			case "mmap":
+				c.MemCache.Mmap = true
+			default:
+				return nil, c.Errf("Unknown memcache option '%s'", c.Val())
+			}
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func parseMemCacheSize(c *Controller, val string) (int64, error) {
+	size, err := humanize.ParseBytes(val)
+	if err != nil || size < 1 {
+		return 0, c.Errf("Invalid memcache max_size '%s'", val)
+	}
+	return int64(size), nil
+}
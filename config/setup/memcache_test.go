@@ -0,0 +1,50 @@
+package setup
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy/server"
+)
+
+func TestMemCache(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  server.MemCacheConfig
+	}{
+		{`memcache`, false, server.MemCacheConfig{Enabled: true, MaxFileSize: server.DefaultMemCacheMaxFileSize}},
+		{`memcache 1MB`, false, server.MemCacheConfig{Enabled: true, MaxFileSize: 1000000}},
+		{`memcache {
+			max_size 64KiB
+			mmap
+		}`, false, server.MemCacheConfig{Enabled: true, MaxFileSize: 64 << 10, Mmap: true}},
+		{`memcache huge`, true, server.MemCacheConfig{}},
+		{`memcache 1MB 2MB`, true, server.MemCacheConfig{}},
+		{`memcache {
+			max_size
+		}`, true, server.MemCacheConfig{}},
+		{`memcache {
+			mmap yes
+		}`, true, server.MemCacheConfig{}},
+		{`memcache {
+			mlock
+		}`, true, server.MemCacheConfig{}},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		mid, err := MemCache(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if mid != nil {
+			t.Errorf("Test %d: Expected no middleware, got some", i)
+		}
+		if !test.shouldErr && c.MemCache != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, c.MemCache)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package setup
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/metadata"
+)
+
+// Metadata turns on sidecar files that annotate the files in
+// their directory with a display name, description, icon and
+// headers (see metadata.Load). The syntax is
+//
+//	metadata [file]
+//
+// where file is the name of the sidecar files, .metadata if not
+// given. Browse shows what they say in listings, the file server
+// serves files with their headers, and neither serves the sidecar
+// files themselves.
+func Metadata(c *Controller) (middleware.Middleware, error) {
+	for c.Next() {
+		c.MetadataFile = metadata.DefaultFile
+		if c.NextArg() {
+			c.MetadataFile = c.Val()
+		}
+		if c.NextArg() {
+			return nil, c.ArgErr()
+		}
+		if strings.Contains(c.MetadataFile, "/") {
+			return nil, c.Errf("Metadata file '%s' must be a file name, not a path", c.MetadataFile)
+		}
+	}
+	return nil, nil
+}
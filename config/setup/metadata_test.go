@@ -0,0 +1,33 @@
+package setup
+
+import "testing"
+
+func TestMetadata(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  string
+	}{
+		{`metadata`, false, ".metadata"},
+		{`metadata .info`, false, ".info"},
+		{`metadata .info extra`, true, ""},
+		{`metadata sub/.info`, true, ""},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		mid, err := Metadata(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if mid != nil {
+			t.Errorf("Test %d: Expected no middleware, got some", i)
+		}
+		if !test.shouldErr && c.MetadataFile != test.expected {
+			t.Errorf("Test %d: Expected metadata file %s, got %s", i, test.expected, c.MetadataFile)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package setup
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/methodoverride"
+)
+
+// MethodOverride configures a new MethodOverride middleware
+// instance. The syntax is
+//
+//	methodoverride [paths...] {
+//		header name
+//		field  name
+//		allow  methods...
+//	}
+//
+// POST requests under the paths (all by default) are given
+// the method named by the header (X-HTTP-Method-Override by
+// default) or the form field (_method by default); "off" turns
+// either off. Only the allowed methods, PUT, PATCH and DELETE
+// unless given, may be named.
+func MethodOverride(c *Controller) (middleware.Middleware, error) {
+	m, err := methodOverrideParse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		m.Next = next
+		return m
+	}, nil
+}
+
+func methodOverrideParse(c *Controller) (methodoverride.MethodOverride, error) {
+	m := methodoverride.MethodOverride{
+		Header:  "X-HTTP-Method-Override",
+		Field:   "_method",
+		Allowed: []string{"PUT", "PATCH", "DELETE"},
+	}
+
+	for c.Next() {
+		m.Paths = append(m.Paths, c.RemainingArgs()...)
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "header", "field":
+				if len(args) != 1 {
+					return m, c.ArgErr()
+				}
+				name := args[0]
+				if name == "off" {
+					name = ""
+				}
+				if what == "header" {
+					m.Header = name
+				} else {
+					m.Field = name
+				}
+			case "allow":
+				if len(args) == 0 {
+					return m, c.ArgErr()
+				}
+				m.Allowed = nil
+				for _, method := range args {
+					method = strings.ToUpper(method)
+					if method == "GET" || method == "POST" || method == "CONNECT" {
+						return m, c.Errf("Method %s may not be given as an override", method)
+					}
+					m.Allowed = append(m.Allowed, method)
+				}
+			default:
+				return m, c.Errf("Unknown methodoverride property '%s'", what)
+			}
+		}
+	}
+
+	if m.Header == "" && m.Field == "" {
+		return m, c.Err("methodoverride needs a header or a field to read the method from")
+	}
+
+	return m, nil
+}
@@ -0,0 +1,66 @@
+package setup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy/middleware/methodoverride"
+)
+
+func TestMethodOverride(t *testing.T) {
+	c := NewTestController(`methodoverride`)
+	mid, err := MethodOverride(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	if mid == nil {
+		t.Fatal("Expected middleware, was nil instead")
+	}
+	handler := mid(EmptyNext)
+	myHandler, ok := handler.(methodoverride.MethodOverride)
+	if !ok {
+		t.Fatalf("Expected handler to be type MethodOverride, got: %#v", handler)
+	}
+	if !SameNext(myHandler.Next, EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestMethodOverrideParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  methodoverride.MethodOverride
+	}{
+		{`methodoverride`, false, methodoverride.MethodOverride{
+			Header: "X-HTTP-Method-Override", Field: "_method", Allowed: []string{"PUT", "PATCH", "DELETE"},
+		}},
+		{"methodoverride /api /admin {\n header X-Method\n field off\n allow put delete\n}", false, methodoverride.MethodOverride{
+			Paths: []string{"/api", "/admin"}, Header: "X-Method", Allowed: []string{"PUT", "DELETE"},
+		}},
+		{"methodoverride /api\nmethodoverride /admin", false, methodoverride.MethodOverride{
+			Paths: []string{"/api", "/admin"}, Header: "X-HTTP-Method-Override", Field: "_method", Allowed: []string{"PUT", "PATCH", "DELETE"},
+		}},
+		{"methodoverride {\n header off\n field off\n}", true, methodoverride.MethodOverride{}},
+		{"methodoverride {\n header\n}", true, methodoverride.MethodOverride{}},
+		{"methodoverride {\n allow\n}", true, methodoverride.MethodOverride{}},
+		{"methodoverride {\n allow DELETE GET\n}", true, methodoverride.MethodOverride{}},
+		{"methodoverride {\n methods PUT\n}", true, methodoverride.MethodOverride{}},
+	}
+	for i, test := range tests {
+		actual, err := methodOverrideParse(NewTestController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package setup
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Multipart sets how middleware that reads forms, such as
+// templates, parses multipart request bodies. The syntax is
+//
+//	multipart {
+//		memory size
+//		temp_dir dir
+//		max_parts n
+//		max_files n
+//	}
+//
+// Files that don't fit in memory (10MB by default, which form
+// values must fit in) are written to temporary files in temp_dir.
+// A body may have at most max_parts parts (1000 by default), and
+// at most max_files files (100 by default).
+func Multipart(c *Controller) (middleware.Middleware, error) {
+	for c.Next() {
+		if len(c.RemainingArgs()) > 0 {
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return nil, c.ArgErr()
+			}
+			val := c.Val()
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+
+			switch what {
+			case "memory":
+				size, err := parseDownloadsSize(c, what, val)
+				if err != nil {
+					return nil, err
+				}
+				c.Multipart.Memory = size
+			case "temp_dir":
+				info, err := os.Stat(val)
+				if err != nil || !info.IsDir() {
+					return nil, c.Errf("Invalid temp_dir '%s'; must be a directory", val)
+				}
+				c.Multipart.TempDir = val
+			case "max_parts", "max_files":
+				n, err := strconv.Atoi(val)
+				if err != nil || n < 1 {
+					return nil, c.Errf("Invalid %s '%s'", what, val)
+				}
+				if what == "max_parts" {
+					c.Multipart.MaxParts = n
+				} else {
+					c.Multipart.MaxFiles = n
+				}
+			default:
+				return nil, c.Errf("Unknown multipart property '%s'", what)
+			}
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,52 @@
+package setup
+
+import (
+	"os"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestMultipart(t *testing.T) {
+	tmp := os.TempDir()
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  middleware.MultipartLimits
+	}{
+		{`multipart {
+			memory 1MB
+			temp_dir ` + tmp + `
+			max_parts 50
+			max_files 5
+		}`, false, middleware.MultipartLimits{Memory: 1000000, TempDir: tmp, MaxParts: 50, MaxFiles: 5}},
+		{`multipart`, false, middleware.MultipartLimits{}},
+		{`multipart {
+			temp_dir /no/such/dir/hopefully
+		}`, true, middleware.MultipartLimits{}},
+		{`multipart {
+			max_parts 0
+		}`, true, middleware.MultipartLimits{}},
+		{`multipart {
+			memory
+		}`, true, middleware.MultipartLimits{}},
+		{`multipart {
+			max_size 1MB
+		}`, true, middleware.MultipartLimits{}},
+		{`multipart 1MB`, true, middleware.MultipartLimits{}},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		_, err := Multipart(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if !test.shouldErr && c.Multipart != test.expected {
+			t.Errorf("Test %d: Expected limits %+v, got %+v", i, test.expected, c.Multipart)
+		}
+	}
+}
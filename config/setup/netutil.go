@@ -0,0 +1,95 @@
+package setup
+
+import (
+	"net"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/netutil"
+)
+
+// NetUtil configures a new NetUtil middleware instance, which
+// serves network utility endpoints. The syntax is
+//
+//	netutil {
+//		dns_query [path] resolver
+//		ip        [path]
+//		time      [path]
+//		timeout   duration
+//	}
+//
+// The paths are /dns-query, /ip and /time by default, and a
+// resolver without a port is on port 53. Without a block, the
+// ip and time endpoints are enabled.
+func NetUtil(c *Controller) (middleware.Middleware, error) {
+	n, err := netutilParse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		n.Next = next
+		return n
+	}, nil
+}
+
+func netutilParse(c *Controller) (netutil.NetUtil, error) {
+	var n netutil.NetUtil
+
+	for c.Next() {
+		if len(c.RemainingArgs()) > 0 {
+			return n, c.ArgErr()
+		}
+
+		hadBlock := false
+		for c.NextBlock() {
+			hadBlock = true
+			what := c.Val()
+			args := c.RemainingArgs()
+			switch what {
+			case "dns_query":
+				switch len(args) {
+				case 1:
+					n.DNSQuery, n.Resolver = "/dns-query", args[0]
+				case 2:
+					n.DNSQuery, n.Resolver = args[0], args[1]
+				default:
+					return n, c.ArgErr()
+				}
+				if _, _, err := net.SplitHostPort(n.Resolver); err != nil {
+					n.Resolver = net.JoinHostPort(n.Resolver, "53")
+				}
+			case "ip", "time":
+				if len(args) > 1 {
+					return n, c.ArgErr()
+				}
+				path := "/" + what
+				if len(args) == 1 {
+					path = args[0]
+				}
+				if what == "ip" {
+					n.IP = path
+				} else {
+					n.Time = path
+				}
+			case "timeout":
+				if len(args) != 1 {
+					return n, c.ArgErr()
+				}
+				timeout, err := time.ParseDuration(args[0])
+				if err != nil || timeout <= 0 {
+					return n, c.Errf("Invalid timeout '%s'", args[0])
+				}
+				n.Timeout = timeout
+			default:
+				return n, c.Errf("Unknown netutil property '%s'", what)
+			}
+		}
+
+		if !hadBlock {
+			n.IP, n.Time = "/ip", "/time"
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,52 @@
+package setup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware/netutil"
+)
+
+func TestNetUtil(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  netutil.NetUtil
+	}{
+		{`netutil`, false, netutil.NetUtil{IP: "/ip", Time: "/time"}},
+		{`netutil {
+			dns_query 127.0.0.1
+			timeout 2s
+		}`, false, netutil.NetUtil{DNSQuery: "/dns-query", Resolver: "127.0.0.1:53", Timeout: 2 * time.Second}},
+		{`netutil {
+			dns_query /doh [::1]:5353
+			ip /whoami
+			time
+		}`, false, netutil.NetUtil{DNSQuery: "/doh", Resolver: "[::1]:5353", IP: "/whoami", Time: "/time"}},
+		{`netutil /ip`, true, netutil.NetUtil{}},
+		{`netutil {
+			dns_query
+		}`, true, netutil.NetUtil{}},
+		{`netutil {
+			timeout never
+		}`, true, netutil.NetUtil{}},
+		{`netutil {
+			ping
+		}`, true, netutil.NetUtil{}},
+	} {
+		n, err := netutilParse(NewTestController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if n != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, n)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package setup
+
+import "github.com/mholt/caddy/middleware"
+
+// Panic sets what is done when a handler panics while
+// serving the site: recover (respond with 500 and keep
+// serving), abort (close the connection) or exit.
+func Panic(c *Controller) (middleware.Middleware, error) {
+	for c.Next() {
+		if !c.NextArg() {
+			return nil, c.ArgErr()
+		}
+		policy, err := middleware.ParsePanicPolicy(c.Val())
+		if err != nil {
+			return nil, c.Err(err.Error())
+		}
+		if c.NextArg() {
+			return nil, c.ArgErr()
+		}
+		c.PanicPolicy = policy
+	}
+	return nil, nil
+}
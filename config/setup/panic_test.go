@@ -0,0 +1,39 @@
+package setup
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestPanic(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  middleware.PanicPolicy
+	}{
+		{`panic recover`, false, middleware.PanicRecover},
+		{`panic abort`, false, middleware.PanicAbort},
+		{`panic exit`, false, middleware.PanicExit},
+		{`panic`, true, middleware.PanicRecover},
+		{`panic crash`, true, middleware.PanicRecover},
+		{`panic exit now`, true, middleware.PanicRecover},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		mid, err := Panic(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if mid != nil {
+			t.Errorf("Test %d: Expected no middleware, got some", i)
+		}
+		if !test.shouldErr && c.PanicPolicy != test.expected {
+			t.Errorf("Test %d: Expected panic policy %s, got %s", i, test.expected, c.PanicPolicy)
+		}
+	}
+}
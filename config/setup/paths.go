@@ -0,0 +1,31 @@
+package setup
+
+import "github.com/mholt/caddy/middleware"
+
+// Paths sets how request paths are normalized before they are
+// matched. The syntax is
+//
+//	paths [decode|raw] [reject_invalid]
+//
+// With decode, the default, encoded characters are decoded before
+// matching; with raw, only unreserved ones are. With reject_invalid,
+// paths with invalid or over-long UTF-8, a NUL or double encoding
+// are rejected. See server.PathPolicy.
+func Paths(c *Controller) (middleware.Middleware, error) {
+	for c.Next() {
+		c.Paths.Enabled = true
+		for _, arg := range c.RemainingArgs() {
+			switch arg {
+			case "decode":
+				c.Paths.Raw = false
+			case "raw":
+				c.Paths.Raw = true
+			case "reject_invalid":
+				c.Paths.Reject = true
+			default:
+				return nil, c.Errf("Unknown paths option '%s'", arg)
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,36 @@
+package setup
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy/server"
+)
+
+func TestPaths(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  server.PathPolicy
+	}{
+		{`paths`, false, server.PathPolicy{Enabled: true}},
+		{`paths raw`, false, server.PathPolicy{Enabled: true, Raw: true}},
+		{`paths decode reject_invalid`, false, server.PathPolicy{Enabled: true, Reject: true}},
+		{`paths encoded`, true, server.PathPolicy{}},
+	} {
+		c := NewTestController(test.input)
+		_, err := Paths(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if c.Paths != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, c.Paths)
+		}
+	}
+}
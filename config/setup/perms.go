@@ -0,0 +1,84 @@
+package setup
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Perms sets the permissions and ownership of the
+// files the site creates, such as log files.
+func Perms(c *Controller) (middleware.Middleware, error) {
+	for c.Next() {
+		if len(c.RemainingArgs()) > 0 {
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			if !c.NextArg() {
+				return nil, c.ArgErr()
+			}
+			val := c.Val()
+			if c.NextArg() {
+				return nil, c.ArgErr()
+			}
+
+			switch what {
+			case "file", "dir":
+				mode, err := strconv.ParseUint(val, 8, 32)
+				if err != nil || mode > 0777 {
+					return nil, c.Errf("Invalid %s mode '%s'; use octal, like 0640", what, val)
+				}
+				if what == "file" {
+					c.FilePerms.Mode = os.FileMode(mode)
+				} else {
+					c.FilePerms.DirMode = os.FileMode(mode)
+				}
+			case "owner":
+				uid, err := lookupID(val, func(name string) (string, error) {
+					u, err := user.Lookup(name)
+					if err != nil {
+						return "", err
+					}
+					return u.Uid, nil
+				})
+				if err != nil {
+					return nil, c.Errf("Unknown owner '%s': %v", val, err)
+				}
+				c.FilePerms.UID, c.FilePerms.SetOwner = uid, true
+			case "group":
+				gid, err := lookupID(val, func(name string) (string, error) {
+					g, err := user.LookupGroup(name)
+					if err != nil {
+						return "", err
+					}
+					return g.Gid, nil
+				})
+				if err != nil {
+					return nil, c.Errf("Unknown group '%s': %v", val, err)
+				}
+				c.FilePerms.GID, c.FilePerms.SetGroup = gid, true
+			default:
+				return nil, c.Errf("Unknown perms property '%s'", what)
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// lookupID returns the numeric ID named by val, which may
+// be the number itself or a name to look up with lookup.
+func lookupID(val string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(val); err == nil {
+		return id, nil
+	}
+	idStr, err := lookup(val)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(idStr)
+}
@@ -0,0 +1,61 @@
+package setup
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestPerms(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  middleware.FilePerms
+	}{
+		{`perms {
+			file 0640
+			dir 750
+			owner 1000
+			group 1001
+		}`, false, middleware.FilePerms{Mode: 0640, DirMode: 0750, UID: 1000, GID: 1001, SetOwner: true, SetGroup: true}},
+		{`perms {
+			owner root
+		}`, false, middleware.FilePerms{UID: 0, SetOwner: true}},
+		{`perms {
+			group 0
+		}`, false, middleware.FilePerms{GID: 0, SetGroup: true}},
+		{`perms {
+			file 0600
+		}`, false, middleware.FilePerms{Mode: 0600}},
+		{`perms {
+			file 0999
+		}`, true, middleware.FilePerms{}},
+		{`perms {
+			file 01777
+		}`, true, middleware.FilePerms{}},
+		{`perms {
+			owner no-such-user-hopefully
+		}`, true, middleware.FilePerms{}},
+		{`perms {
+			file
+		}`, true, middleware.FilePerms{}},
+		{`perms {
+			umask 022
+		}`, true, middleware.FilePerms{}},
+		{`perms 0640`, true, middleware.FilePerms{}},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		_, err := Perms(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if !test.shouldErr && c.FilePerms != test.expected {
+			t.Errorf("Test %d: Expected perms %+v, got %+v", i, test.expected, c.FilePerms)
+		}
+	}
+}
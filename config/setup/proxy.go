@@ -1,13 +1,26 @@
 package setup
 
 import (
+	"net/url"
+	"strings"
+
 	"github.com/mholt/caddy/middleware"
 	"github.com/mholt/caddy/middleware/proxy"
+	"github.com/mholt/caddy/server"
 )
 
 // Proxy configures a new Proxy middleware instance.
 func Proxy(c *Controller) (middleware.Middleware, error) {
 	if upstreams, err := proxy.NewStaticUpstreams(c.Dispenser); err == nil {
+		addr := c.Address()
+		c.Publish = append(c.Publish, func() { proxy.Register(addr, upstreams) })
+		addUpstreamChecks(c, upstreams)
+		for _, upstream := range upstreams {
+			if w, ok := upstream.(proxy.Worker); ok {
+				c.Startup = append(c.Startup, w.Start)
+				c.Shutdown = append(c.Shutdown, w.Stop)
+			}
+		}
 		return func(next middleware.Handler) middleware.Handler {
 			return proxy.Proxy{Next: next, Upstreams: upstreams}
 		}, nil
@@ -15,3 +28,27 @@ func Proxy(c *Controller) (middleware.Middleware, error) {
 		return nil, err
 	}
 }
+
+// addUpstreamChecks adds a check that the name of each host
+// of upstreams resolves.
+func addUpstreamChecks(c *Controller, upstreams []proxy.Upstream) {
+	for _, upstream := range upstreams {
+		lister, ok := upstream.(proxy.HostLister)
+		if !ok {
+			continue
+		}
+		for _, host := range lister.StaticHosts() {
+			if !strings.Contains(host, "://") {
+				host = "http://" + host
+			}
+			u, err := url.Parse(host)
+			if err != nil || u.Hostname() == "" {
+				continue
+			}
+			c.Checks = append(c.Checks, server.Check{
+				What: "upstream " + u.Host + " resolves",
+				Run:  server.CheckResolves(u.Hostname()),
+			})
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package setup
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/ratelimit"
+)
+
+// RateLimit configures a new RateLimit middleware instance.
+// The syntax is
+//
+//	ratelimit [path] rate [burst]
+//
+// or
+//
+//	ratelimit [path] {
+//		rate  rate
+//		burst n
+//		by    ip|path
+//	}
+//
+// where rate is like 10/s, 100/m or 1000/h (per second if
+// there is no unit). The burst is the rate per second, rounded
+// up, if not given. Requests are counted by client IP address
+// unless by says otherwise. All the rules of a site share a
+// store of buckets, which is kept in the site's storage if it
+// has one, so that servers sharing it share the limits too.
+func RateLimit(c *Controller) (middleware.Middleware, error) {
+	rules, err := rateLimitParse(c)
+	if err != nil {
+		return nil, err
+	}
+	var store ratelimit.Store = ratelimit.NewMemoryStore(0)
+	if c.Storage != nil {
+		store = ratelimit.StorageStore{Storage: c.Storage, Prefix: "ratelimit/" + c.Address() + "/"}
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		return ratelimit.RateLimit{Next: next, Rules: rules, Store: store}
+	}, nil
+}
+
+func rateLimitParse(c *Controller) ([]ratelimit.Rule, error) {
+	var rules []ratelimit.Rule
+
+	for c.Next() {
+		rule := ratelimit.Rule{Path: "/"}
+		args := c.RemainingArgs()
+		if len(args) > 0 && strings.HasPrefix(args[0], "/") {
+			rule.Path = args[0]
+			args = args[1:]
+		}
+
+		var err error
+		switch len(args) {
+		case 0:
+		case 1, 2:
+			if rule.Rate, err = parseLimitRate(c, args[0]); err != nil {
+				return rules, err
+			}
+			if len(args) == 2 {
+				if rule.Burst, err = parseBurst(c, args[1]); err != nil {
+					return rules, err
+				}
+			}
+		default:
+			return rules, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+			if len(args) != 1 {
+				return rules, c.ArgErr()
+			}
+			switch what {
+			case "rate":
+				rule.Rate, err = parseLimitRate(c, args[0])
+			case "burst":
+				rule.Burst, err = parseBurst(c, args[0])
+			case "by":
+				switch args[0] {
+				case "ip":
+					rule.By = ratelimit.ByIP
+				case "path":
+					rule.By = ratelimit.ByPath
+				default:
+					err = c.Errf("Unknown key '%s'; use ip or path", args[0])
+				}
+			default:
+				err = c.ArgErr()
+			}
+			if err != nil {
+				return rules, err
+			}
+		}
+
+		if rule.Rate == 0 {
+			return rules, c.Err("No rate given")
+		}
+		if rule.Burst == 0 {
+			rule.Burst = int(math.Ceil(rule.Rate))
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// parseLimitRate parses a rate like 10/s, 100/m or 1000/h
+// into requests per second.
+func parseLimitRate(c *Controller, s string) (float64, error) {
+	n, per := s, 1.0
+	if i := strings.Index(s, "/"); i >= 0 {
+		switch s[i+1:] {
+		case "s":
+		case "m":
+			per = 60
+		case "h":
+			per = 3600
+		default:
+			return 0, c.Errf("Invalid rate '%s'; use a unit of s, m or h", s)
+		}
+		n = s[:i]
+	}
+	count, err := strconv.ParseFloat(n, 64)
+	if err != nil || count <= 0 || math.IsInf(count, 0) || math.IsNaN(count) {
+		return 0, c.Errf("Invalid rate '%s'", s)
+	}
+	return count / per, nil
+}
+
+// parseBurst parses the number of requests a client may make at once.
+func parseBurst(c *Controller, s string) (int, error) {
+	burst, err := strconv.Atoi(s)
+	if err != nil || burst < 1 {
+		return 0, c.Errf("Invalid burst '%s'", s)
+	}
+	return burst, nil
+}
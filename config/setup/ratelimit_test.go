@@ -0,0 +1,92 @@
+package setup
+
+import (
+	"testing"
+
+	"github.com/mholt/caddy/middleware/ratelimit"
+	"github.com/mholt/caddy/middleware/storage"
+)
+
+func TestRateLimit(t *testing.T) {
+	c := NewTestController(`ratelimit 10/s`)
+	mid, err := RateLimit(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	if mid == nil {
+		t.Fatal("Expected middleware, was nil instead")
+	}
+	handler := mid(EmptyNext)
+	myHandler, ok := handler.(ratelimit.RateLimit)
+	if !ok {
+		t.Fatalf("Expected handler to be type RateLimit, got: %#v", handler)
+	}
+	if !SameNext(myHandler.Next, EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if myHandler.Store == nil {
+		t.Error("Expected a store for the buckets")
+	}
+
+	c = NewTestController(`ratelimit 10/s`)
+	c.Host, c.Port = "example.com", "80"
+	c.Storage = storage.NewMemory()
+	mid, err = RateLimit(c)
+	if err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	store, ok := mid(EmptyNext).(ratelimit.RateLimit).Store.(ratelimit.StorageStore)
+	if !ok || store.Storage != c.Storage || store.Prefix != "ratelimit/example.com:80/" {
+		t.Errorf("Expected the buckets in the site's storage, got %#v", store)
+	}
+}
+
+func TestRateLimitParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []ratelimit.Rule
+	}{
+		{`ratelimit 10/s`, false, []ratelimit.Rule{{Path: "/", Rate: 10, Burst: 10}}},
+		{`ratelimit /api 60/m 5`, false, []ratelimit.Rule{{Path: "/api", Rate: 1, Burst: 5}}},
+		{`ratelimit 0.5`, false, []ratelimit.Rule{{Path: "/", Rate: 0.5, Burst: 1}}},
+		{"ratelimit /login {\n rate 3600/h\n burst 3\n by ip\n}\nratelimit /search {\n rate 100/s\n by path\n}", false, []ratelimit.Rule{
+			{Path: "/login", Rate: 1, Burst: 3},
+			{Path: "/search", Rate: 100, Burst: 100, By: ratelimit.ByPath},
+		}},
+		{`ratelimit`, true, nil},
+		{`ratelimit /api`, true, nil},
+		{`ratelimit 10/d`, true, nil},
+		{`ratelimit fast`, true, nil},
+		{`ratelimit -1/s`, true, nil},
+		{`ratelimit NaN/s`, true, nil},
+		{`ratelimit Inf`, true, nil},
+		{`ratelimit 10/s 0`, true, nil},
+		{`ratelimit /api 10/s 5 6`, true, nil},
+		{"ratelimit {\n rate 1/s\n by host\n}", true, nil},
+		{"ratelimit {\n rate\n}", true, nil},
+		{"ratelimit {\n limit 5\n}", true, nil},
+	}
+	for i, test := range tests {
+		rules, err := rateLimitParse(NewTestController(test.input))
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if len(rules) != len(test.expected) {
+			t.Errorf("Test %d: Expected %d rules, got %d", i, len(test.expected), len(rules))
+			continue
+		}
+		for j, rule := range rules {
+			if rule != test.expected[j] {
+				t.Errorf("Test %d: Expected rule %d to be %+v, got %+v", i, j, test.expected[j], rule)
+			}
+		}
+	}
+}
@@ -7,7 +7,21 @@ import (
 	"github.com/mholt/caddy/middleware/redirect"
 )
 
-// Redir configures a new Redirect middleware instance.
+// Redir configures a new Redirect middleware instance. The syntax is
+//
+//	redir to [code]
+//	redir from to code
+//
+// or, for many redirects at once, the table form
+//
+//	redir [code] {
+//		from to [code]
+//		...
+//	}
+//
+// where code is a 3xx status or meta, 301 if not given; in a table
+// it is the code of the lines that don't give their own. The
+// destinations may have placeholders, like https://{host}{uri}.
 func Redir(c *Controller) (middleware.Middleware, error) {
 	rules, err := redirParse(c)
 	if err != nil {
@@ -22,6 +36,16 @@ func Redir(c *Controller) (middleware.Middleware, error) {
 func redirParse(c *Controller) ([]redirect.Rule, error) {
 	var redirects []redirect.Rule
 
+	// checkRule makes sure rule doesn't redirect to itself
+	// and adds it to the redirects
+	checkRule := func(rule redirect.Rule) error {
+		if rule.From == rule.To {
+			return c.Err("Redirect rule cannot allow From and To arguments to be the same.")
+		}
+		redirects = append(redirects, rule)
+		return nil
+	}
+
 	for c.Next() {
 		var rule redirect.Rule
 		args := c.RemainingArgs()
@@ -29,6 +53,45 @@ func redirParse(c *Controller) ([]redirect.Rule, error) {
 		// Always set the default Code, then overwrite
 		rule.Code = http.StatusMovedPermanently
 
+		// The table form; its argument is the default code
+		var hadBlock bool
+		for c.NextBlock() {
+			if !hadBlock {
+				hadBlock = true
+				switch len(args) {
+				case 0:
+				case 1:
+					if err := setRedirCode(c, &rule, args[0]); err != nil {
+						return redirects, err
+					}
+				default:
+					return redirects, c.ArgErr()
+				}
+			}
+
+			line := rule
+			line.From = c.Val()
+			lineArgs := c.RemainingArgs()
+			switch len(lineArgs) {
+			case 2:
+				line.Meta = false
+				if err := setRedirCode(c, &line, lineArgs[1]); err != nil {
+					return redirects, err
+				}
+				fallthrough
+			case 1:
+				line.To = lineArgs[0]
+			default:
+				return redirects, c.ArgErr()
+			}
+			if err := checkRule(line); err != nil {
+				return redirects, err
+			}
+		}
+		if hadBlock {
+			continue
+		}
+
 		switch len(args) {
 		case 1:
 			// To specified
@@ -38,38 +101,41 @@ func redirParse(c *Controller) ([]redirect.Rule, error) {
 			// To and Code specified
 			rule.From = "/"
 			rule.To = args[0]
-			if "meta" == args[1] {
-				rule.Meta = true
-			} else if code, ok := httpRedirs[args[1]]; !ok {
-				return redirects, c.Err("Invalid redirect code '" + args[1] + "'")
-			} else {
-				rule.Code = code
+			if err := setRedirCode(c, &rule, args[1]); err != nil {
+				return redirects, err
 			}
 		case 3:
 			// From, To, and Code specified
 			rule.From = args[0]
 			rule.To = args[1]
-			if "meta" == args[2] {
-				rule.Meta = true
-			} else if code, ok := httpRedirs[args[2]]; !ok {
-				return redirects, c.Err("Invalid redirect code '" + args[2] + "'")
-			} else {
-				rule.Code = code
+			if err := setRedirCode(c, &rule, args[2]); err != nil {
+				return redirects, err
 			}
 		default:
 			return redirects, c.ArgErr()
 		}
 
-		if rule.From == rule.To {
-			return redirects, c.Err("Redirect rule cannot allow From and To arguments to be the same.")
+		if err := checkRule(rule); err != nil {
+			return redirects, err
 		}
-
-		redirects = append(redirects, rule)
 	}
 
 	return redirects, nil
 }
 
+// setRedirCode sets the code of rule, or makes
+// it a meta redirect, as code says.
+func setRedirCode(c *Controller, rule *redirect.Rule, code string) error {
+	if "meta" == code {
+		rule.Meta = true
+	} else if status, ok := httpRedirs[code]; !ok {
+		return c.Err("Invalid redirect code '" + code + "'")
+	} else {
+		rule.Code = status
+	}
+	return nil
+}
+
 // httpRedirs is a list of supported HTTP redirect codes.
 var httpRedirs = map[string]int{
 	"300": 300,
@@ -0,0 +1,86 @@
+package setup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy/middleware/redirect"
+)
+
+func TestRedirParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []redirect.Rule
+	}{
+		{`redir https://{host}{uri}`, false, []redirect.Rule{
+			{From: "/", To: "https://{host}{uri}", Code: 301},
+		}},
+		{`redir https://example.com{uri} 307`, false, []redirect.Rule{
+			{From: "/", To: "https://example.com{uri}", Code: 307},
+		}},
+		{`redir /old /new 302`, false, []redirect.Rule{
+			{From: "/old", To: "/new", Code: 302},
+		}},
+		{`redir /old /new meta`, false, []redirect.Rule{
+			{From: "/old", To: "/new", Code: 301, Meta: true},
+		}},
+		{`redir {
+			/a /b
+			/c /d 308
+			/e /f meta
+		}`, false, []redirect.Rule{
+			{From: "/a", To: "/b", Code: 301},
+			{From: "/c", To: "/d", Code: 308},
+			{From: "/e", To: "/f", Code: 301, Meta: true},
+		}},
+		{`redir 302 {
+			/a /b
+			/c /d 301
+		}
+		redir /x /y 307`, false, []redirect.Rule{
+			{From: "/a", To: "/b", Code: 302},
+			{From: "/c", To: "/d", Code: 301},
+			{From: "/x", To: "/y", Code: 307},
+		}},
+		{`redir meta {
+			/a /b
+			/c /d 302
+		}`, false, []redirect.Rule{
+			{From: "/a", To: "/b", Code: 301, Meta: true},
+			{From: "/c", To: "/d", Code: 302},
+		}},
+		{`redir`, true, nil},
+		{`redir /a /b /c /d`, true, nil},
+		{`redir /a /a 301`, true, nil},
+		{`redir /a 200`, true, nil},
+		{`redir 200 {
+			/a /b
+		}`, true, nil},
+		{`redir 301 302 {
+			/a /b
+		}`, true, nil},
+		{`redir {
+			/a
+		}`, true, nil},
+		{`redir {
+			/a /b 404
+		}`, true, nil},
+		{`redir {
+			/a /a
+		}`, true, nil},
+	}
+
+	for i, test := range tests {
+		actual, err := redirParse(NewTestController(test.input))
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if !test.shouldErr && !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: Expected rules %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
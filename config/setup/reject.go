@@ -0,0 +1,110 @@
+package setup
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/dustin/go-humanize"
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/server"
+)
+
+// Reject sets which requests are refused before any middleware
+// sees them. The syntax is
+//
+//	reject {
+//		cookie_size       size [code]
+//		header_size       size [code]
+//		no_host           [code]
+//		transfer_encoding [code]
+//		header            name [pattern [code]]
+//	}
+//
+// Requests with Cookie headers or headers in all larger than size
+// are refused with code 431 unless another is given; the others
+// with 400. A header is refused whatever its value, unless its
+// value must match the regular expression pattern. See
+// server.RejectPolicy.
+func Reject(c *Controller) (middleware.Middleware, error) {
+	for c.Next() {
+		if len(c.RemainingArgs()) > 0 {
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+
+			switch what {
+			case "cookie_size", "header_size":
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				size, err := humanize.ParseBytes(args[0])
+				if err != nil || size < 1 {
+					return nil, c.Errf("Invalid %s '%s'", what, args[0])
+				}
+				code, err := rejectCode(c, args[1:], http.StatusRequestHeaderFieldsTooLarge)
+				if err != nil {
+					return nil, err
+				}
+				if what == "cookie_size" {
+					c.Reject.CookieSize, c.Reject.CookieSizeCode = int64(size), code
+				} else {
+					c.Reject.HeaderSize, c.Reject.HeaderSizeCode = int64(size), code
+				}
+			case "no_host", "transfer_encoding":
+				if len(args) > 1 {
+					return nil, c.ArgErr()
+				}
+				code, err := rejectCode(c, args, http.StatusBadRequest)
+				if err != nil {
+					return nil, err
+				}
+				if what == "no_host" {
+					c.Reject.NoHostCode = code
+				} else {
+					c.Reject.TransferEncodingCode = code
+				}
+			case "header":
+				if len(args) == 0 || len(args) > 3 {
+					return nil, c.ArgErr()
+				}
+				h := server.RejectHeader{Name: http.CanonicalHeaderKey(args[0]), Code: http.StatusBadRequest}
+				if len(args) > 1 {
+					re, err := regexp.Compile(args[1])
+					if err != nil {
+						return nil, c.Errf("Invalid pattern '%s': %v", args[1], err)
+					}
+					h.Pattern = re
+				}
+				if len(args) > 2 {
+					code, err := rejectCode(c, args[2:], http.StatusBadRequest)
+					if err != nil {
+						return nil, err
+					}
+					h.Code = code
+				}
+				c.Reject.Headers = append(c.Reject.Headers, h)
+			default:
+				return nil, c.Errf("Unknown reject check '%s'", what)
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// rejectCode returns the status code in args, if there
+// is one, or def.
+func rejectCode(c *Controller, args []string, def int) (int, error) {
+	if len(args) == 0 {
+		return def, nil
+	}
+	code, err := strconv.Atoi(args[0])
+	if err != nil || code < 400 || code > 599 {
+		return 0, c.Errf("Invalid status code '%s'; use a 4xx or 5xx code", args[0])
+	}
+	return code, nil
+}
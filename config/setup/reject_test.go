@@ -0,0 +1,52 @@
+package setup
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestReject(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		check     func(c *Controller) bool
+	}{
+		{"reject {\n cookie_size 4KB\n header_size 16KB 400\n}", false, func(c *Controller) bool {
+			return c.Reject.CookieSize == 4000 && c.Reject.CookieSizeCode == http.StatusRequestHeaderFieldsTooLarge &&
+				c.Reject.HeaderSize == 16000 && c.Reject.HeaderSizeCode == http.StatusBadRequest
+		}},
+		{"reject {\n no_host\n transfer_encoding 501\n}", false, func(c *Controller) bool {
+			return c.Reject.NoHostCode == http.StatusBadRequest && c.Reject.TransferEncodingCode == http.StatusNotImplemented
+		}},
+		{"reject {\n header x-debug\n header User-Agent sqlmap 403\n}", false, func(c *Controller) bool {
+			h := c.Reject.Headers
+			return len(h) == 2 && h[0].Name == "X-Debug" && h[0].Pattern == nil && h[0].Code == http.StatusBadRequest &&
+				h[1].Pattern.MatchString("sqlmap/1.0") && h[1].Code == http.StatusForbidden
+		}},
+		{`reject`, false, func(c *Controller) bool { return c.Reject.NoHostCode == 0 && len(c.Reject.Headers) == 0 }},
+		{`reject no_host`, true, nil},
+		{"reject {\n cookie_size\n}", true, nil},
+		{"reject {\n cookie_size big\n}", true, nil},
+		{"reject {\n cookie_size 4KB 200\n}", true, nil},
+		{"reject {\n no_host 400 401\n}", true, nil},
+		{"reject {\n header X-Debug ( 403\n}", true, nil},
+		{"reject {\n header X-Debug .* 403 404\n}", true, nil},
+		{"reject {\n body_size 1MB\n}", true, nil},
+	} {
+		c := NewTestController(test.input)
+		_, err := Reject(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if !test.check(c) {
+			t.Errorf("Test %d: Unexpected policy %+v", i, c.Reject)
+		}
+	}
+}
@@ -5,7 +5,24 @@ import (
 	"github.com/mholt/caddy/middleware/rewrite"
 )
 
-// Rewrite configures a new Rewrite middleware instance.
+// Rewrite configures a new Rewrite middleware instance. The
+// syntax is
+//
+//	rewrite from to
+//
+// or
+//
+//	rewrite [base] {
+//		regexp pattern
+//		ext    extensions...
+//		if     a operator b
+//		to     destination
+//	}
+//
+// where a request under base whose path matches pattern, has
+// one of the extensions and meets every if condition (see
+// rewrite.If) is rewritten to destination. The pattern may be
+// left out if there is a condition.
 func Rewrite(c *Controller) (middleware.Middleware, error) {
 	rewrites, err := rewriteParse(c)
 	if err != nil {
@@ -22,18 +39,16 @@ func rewriteParse(c *Controller) ([]rewrite.Rule, error) {
 	var regexpRules []rewrite.Rule
 
 	for c.Next() {
-		var rule rewrite.Rule
-		var err error
 		var base = "/"
 		var pattern, to string
 		var ext []string
+		var ifs []rewrite.If
 
 		args := c.RemainingArgs()
 
 		switch len(args) {
 		case 2:
-			rule = rewrite.NewSimpleRule(args[0], args[1])
-			simpleRules = append(simpleRules, rule)
+			simpleRules = append(simpleRules, rewrite.NewSimpleRule(args[0], args[1]))
 		case 1:
 			base = args[0]
 			fallthrough
@@ -56,18 +71,34 @@ func rewriteParse(c *Controller) ([]rewrite.Rule, error) {
 						return nil, c.ArgErr()
 					}
 					ext = args1
+				case "if":
+					args1 := c.RemainingArgs()
+					if len(args1) != 3 {
+						return nil, c.ArgErr()
+					}
+					cond, err := rewrite.NewIf(args1[0], args1[1], args1[2])
+					if err != nil {
+						return nil, c.Err(err.Error())
+					}
+					ifs = append(ifs, cond)
 				default:
 					return nil, c.ArgErr()
 				}
 			}
+			// a condition can stand in for the pattern
+			if pattern == "" && len(ifs) > 0 {
+				pattern = ".*"
+			}
 			// ensure pattern and to are specified
 			if pattern == "" || to == "" {
 				return nil, c.ArgErr()
 			}
-			if rule, err = rewrite.NewRegexpRule(base, pattern, to, ext); err != nil {
+			regexpRule, err := rewrite.NewRegexpRule(base, pattern, to, ext)
+			if err != nil {
 				return nil, err
 			}
-			regexpRules = append(regexpRules, rule)
+			regexpRule.Ifs = ifs
+			regexpRules = append(regexpRules, regexpRule)
 		default:
 			return nil, c.ArgErr()
 		}
@@ -98,14 +98,14 @@ func TestRewriteParse(t *testing.T) {
 			r	.*
 			to	/to
 		 }`, false, []rewrite.Rule{
-			&rewrite.RegexpRule{"/", "/to", nil, regexp.MustCompile(".*")},
+			&rewrite.RegexpRule{"/", "/to", nil, regexp.MustCompile(".*"), nil},
 		}},
 		{`rewrite {
 			regexp	.*
 			to		/to
 			ext		/ html txt
 		 }`, false, []rewrite.Rule{
-			&rewrite.RegexpRule{"/", "/to", []string{"/", "html", "txt"}, regexp.MustCompile(".*")},
+			&rewrite.RegexpRule{"/", "/to", []string{"/", "html", "txt"}, regexp.MustCompile(".*"), nil},
 		}},
 		{`rewrite /path {
 			r	rr
@@ -116,8 +116,8 @@ func TestRewriteParse(t *testing.T) {
 		 	to 		/to
 		 }
 		 `, false, []rewrite.Rule{
-			&rewrite.RegexpRule{"/path", "/dest", nil, regexp.MustCompile("rr")},
-			&rewrite.RegexpRule{"/", "/to", nil, regexp.MustCompile("[a-z]+")},
+			&rewrite.RegexpRule{"/path", "/dest", nil, regexp.MustCompile("rr"), nil},
+			&rewrite.RegexpRule{"/", "/to", nil, regexp.MustCompile("[a-z]+"), nil},
 		}},
 		{`rewrite {
 			to	/to
@@ -183,3 +183,63 @@ func TestRewriteParse(t *testing.T) {
 	}
 
 }
+
+func TestRewriteParseIf(t *testing.T) {
+	tests := []struct {
+		input       string
+		shouldErr   bool
+		expectedRe  string
+		expectedIfs []rewrite.If
+	}{
+		{`rewrite {
+			if {>User-Agent} has Mobile
+			to /mobile/{path}
+		 }`, false, ".*", []rewrite.If{{A: "{>User-Agent}", Operator: "has", B: "Mobile"}}},
+		{`rewrite /api {
+			r    ^/v1/
+			if   {?format} is xml
+			if   {method} not GET
+			to   /xml/{path}
+		 }`, false, "^/v1/", []rewrite.If{
+			{A: "{?format}", Operator: "is", B: "xml"},
+			{A: "{method}", Operator: "not", B: "GET"},
+		}},
+		{`rewrite {
+			if {path} has
+			to /to
+		 }`, true, "", nil},
+		{`rewrite {
+			if {path} contains a
+			to /to
+		 }`, true, "", nil},
+		{`rewrite {
+			if {path} match (
+			to /to
+		 }`, true, "", nil},
+		{`rewrite {
+			if {path} is /a
+		 }`, true, "", nil},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		actual, err := rewriteParse(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if err != nil || test.shouldErr {
+			continue
+		}
+
+		rule := actual[0].(*rewrite.RegexpRule)
+		if rule.String() != test.expectedRe {
+			t.Errorf("Test %d: Expected pattern %s, got %s", i, test.expectedRe, rule.String())
+		}
+		if fmt.Sprint(rule.Ifs) != fmt.Sprint(test.expectedIfs) {
+			t.Errorf("Test %d: Expected conditions %v, got %v", i, test.expectedIfs, rule.Ifs)
+		}
+	}
+}
@@ -13,6 +13,15 @@ func Root(c *Controller) (middleware.Middleware, error) {
 			return nil, c.ArgErr()
 		}
 		c.Root = c.Val()
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "confine":
+				c.ConfineRoot = true
+			default:
+				return nil, c.Errf("Unknown root property '%s'", c.Val())
+			}
+		}
 	}
 
 	// Check if root path exists
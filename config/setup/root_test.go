@@ -0,0 +1,44 @@
+package setup
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRoot(t *testing.T) {
+	root := os.TempDir()
+
+	tests := []struct {
+		input           string
+		shouldErr       bool
+		expectedConfine bool
+	}{
+		{`root ` + root, false, false},
+		{`root ` + root + ` {
+			confine
+		}`, false, true},
+		{`root ` + root + ` {
+			chroot
+		}`, true, false},
+		{`root`, true, false},
+	}
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		_, err := Root(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if err != nil {
+			continue
+		}
+		if c.Root != root {
+			t.Errorf("Test %d: Expected root %s, got %s", i, root, c.Root)
+		}
+		if c.ConfineRoot != test.expectedConfine {
+			t.Errorf("Test %d: Expected ConfineRoot %v, got %v", i, test.expectedConfine, c.ConfineRoot)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package setup
+
+import "testing"
+
+func TestSecretDirectives(t *testing.T) {
+	t.Setenv("CADDY_TEST_KEY", "0123456789abcdef")
+	t.Setenv("CADDY_TEST_TOKEN", "token")
+
+	s, err := signedurlParse(NewTestController("signedurl /files {\n key env:CADDY_TEST_KEY\n endpoint /_sign env:CADDY_TEST_TOKEN\n}"))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if string(s.Key) != "0123456789abcdef" || s.Token != "token" {
+		t.Errorf("Expected the key and token from the environment, got %q and %q", s.Key, s.Token)
+	}
+
+	rules, err := basicAuthParse(NewTestController("basicauth /admin user env:CADDY_TEST_TOKEN"))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if rules[0].Password != "token" {
+		t.Errorf("Expected the password from the environment, got %q", rules[0].Password)
+	}
+
+	if _, err := basicAuthParse(NewTestController("basicauth /admin user env:CADDY_TEST_UNSET")); err == nil {
+		t.Error("Expected an error for an unset variable")
+	}
+}
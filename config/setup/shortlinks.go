@@ -0,0 +1,168 @@
+package setup
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/shortlinks"
+)
+
+// Shortlinks configures a new Shortlinks middleware instance.
+// The syntax is
+//
+//	shortlinks [prefix] {
+//		db    file
+//		file  links.txt
+//		api   path token
+//		code  status
+//	}
+//
+// Links are kept in db, a JSON file, with their hit counts. If
+// the site has storage, they are kept there instead, under the
+// key "shortlinks/db" (db defaults to "links"). The links in file, one "slug url [code]" per line, are added to it
+// whenever the site is loaded. With api, links may also be managed
+// over HTTP by clients with the token, which may be given as
+// file:path or env:NAME to keep it out of the Caddyfile. Links
+// redirect with code (302 by default) unless they have their own.
+func Shortlinks(c *Controller) (middleware.Middleware, error) {
+	s, links, err := shortlinksParse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(links) > 0 {
+		err = s.Store.Put(links...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.Shutdown = append(c.Shutdown, s.Store.Flush)
+
+	return func(next middleware.Handler) middleware.Handler {
+		s.Next = next
+		return s
+	}, nil
+}
+
+// shortlinksParse returns the middleware, with its store opened,
+// and the links of the flat file, if one is given.
+func shortlinksParse(c *Controller) (shortlinks.Shortlinks, []shortlinks.Link, error) {
+	s := shortlinks.Shortlinks{Prefix: "/", Code: 302}
+	var db string
+	var links []shortlinks.Link
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			s.Prefix = args[0]
+		default:
+			return s, nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "db":
+				if !c.NextArg() {
+					return s, nil, c.ArgErr()
+				}
+				db = c.Val()
+			case "file":
+				if !c.NextArg() {
+					return s, nil, c.ArgErr()
+				}
+				fileLinks, err := readLinksFile(c.Val())
+				if err != nil {
+					return s, nil, c.Errf("Reading links from %s: %v", c.Val(), err)
+				}
+				links = append(links, fileLinks...)
+			case "api":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return s, nil, c.ArgErr()
+				}
+				token, err := c.Secret(args[1])
+				if err != nil {
+					return s, nil, err
+				}
+				s.API, s.Token = args[0], token
+			case "code":
+				if !c.NextArg() {
+					return s, nil, c.ArgErr()
+				}
+				code, err := strconv.Atoi(c.Val())
+				if err != nil || !shortlinks.RedirectCode(code) {
+					return s, nil, c.Errf("Invalid redirect code '%s'", c.Val())
+				}
+				s.Code = code
+			default:
+				return s, nil, c.Errf("Unknown shortlinks property '%s'", c.Val())
+			}
+		}
+	}
+
+	var store *shortlinks.Store
+	var err error
+	switch {
+	case c.Storage != nil:
+		if db == "" {
+			db = "links"
+		}
+		store, err = shortlinks.Open(c.Storage, "shortlinks/"+db)
+	case db == "":
+		return s, nil, c.Err("shortlinks needs a db file to keep the links in")
+	default:
+		store, err = shortlinks.OpenStore(db, c.FilePerms)
+	}
+	if err != nil {
+		return s, nil, c.Errf("Opening shortlinks db %s: %v", db, err)
+	}
+	s.Store = store
+
+	return s, links, nil
+}
+
+// readLinksFile reads links from a file with one
+// "slug url [code]" per line. Blank lines and lines
+// starting with # are skipped.
+func readLinksFile(name string) ([]shortlinks.Link, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var links []shortlinks.Link
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected slug, url and optional code", lineNum)
+		}
+		link := shortlinks.Link{Slug: strings.Trim(fields[0], "/"), URL: fields[1]}
+		if len(fields) == 3 {
+			code, err := strconv.Atoi(fields[2])
+			if err != nil || !shortlinks.RedirectCode(code) {
+				return nil, fmt.Errorf("line %d: invalid redirect code '%s'", lineNum, fields[2])
+			}
+			link.Code = code
+		}
+		if msg := shortlinks.ValidSlug(link.Slug); msg != "" {
+			return nil, fmt.Errorf("line %d: %s", lineNum, msg)
+		}
+		if msg := shortlinks.ValidURL(link.URL); msg != "" {
+			return nil, fmt.Errorf("line %d: %s", lineNum, msg)
+		}
+		links = append(links, link)
+	}
+	return links, scanner.Err()
+}
@@ -0,0 +1,119 @@
+package setup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/middleware/shortlinks"
+	"github.com/mholt/caddy/middleware/storage"
+)
+
+func TestShortlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_shortlinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := filepath.Join(dir, "links.json")
+	file := filepath.Join(dir, "links.txt")
+	err = ioutil.WriteFile(file, []byte("# links\n\ndocs https://example.com/docs\n/blog/ /blog/ 301\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewTestController(`shortlinks /go {
+		db ` + db + `
+		file ` + file + `
+		api /_links secret
+		code 307
+	}`)
+	mid, err := Shortlinks(c)
+	if err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	handler := mid(EmptyNext)
+	s, ok := handler.(shortlinks.Shortlinks)
+	if !ok {
+		t.Fatalf("Expected handler to be type Shortlinks, got: %#v", handler)
+	}
+	if s.Prefix != "/go" || s.API != "/_links" || s.Token != "secret" || s.Code != 307 {
+		t.Errorf("Expected settings to be parsed, got %+v", s)
+	}
+	if !SameNext(s.Next, EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+	if link, ok := s.Store.Get("blog"); !ok || link.URL != "/blog/" || link.Code != 301 {
+		t.Errorf("Expected link from the file, got %+v", link)
+	}
+	if len(c.Shutdown) != 1 {
+		t.Errorf("Expected a shutdown function to save hits, got %d", len(c.Shutdown))
+	}
+	if _, err := os.Stat(db); err != nil {
+		t.Errorf("Expected the db to be written: %v", err)
+	}
+}
+
+func TestShortlinksStorage(t *testing.T) {
+	c := NewTestController(`shortlinks /go`)
+	c.Storage = storage.NewMemory()
+	mid, err := Shortlinks(c)
+	if err != nil {
+		t.Fatalf("Expected no errors, got: %v", err)
+	}
+	s := mid(EmptyNext).(shortlinks.Shortlinks)
+	if err := s.Store.Put(shortlinks.Link{Slug: "docs", URL: "/docs/"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Storage.Get("shortlinks/links"); err != nil {
+		t.Errorf("Expected the links in the site's storage, got %v", err)
+	}
+}
+
+func TestShortlinksParse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_shortlinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db := filepath.Join(dir, "links.json")
+	bad := filepath.Join(dir, "bad.txt")
+	if err := ioutil.WriteFile(bad, []byte("docs relative\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input     string
+		shouldErr bool
+	}{
+		{`shortlinks { db ` + db + `
+		}`, false},
+		{`shortlinks`, true},
+		{`shortlinks /go /to`, true},
+		{`shortlinks { db ` + db + `
+			code 200
+		}`, true},
+		{`shortlinks { db ` + db + `
+			api /_links
+		}`, true},
+		{`shortlinks { db ` + db + `
+			file ` + bad + `
+		}`, true},
+		{`shortlinks { db ` + db + `
+			file /no/such/file
+		}`, true},
+		{`shortlinks { db ` + db + `
+			ttl 5
+		}`, true},
+	}
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		_, _, err := shortlinksParse(c)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package setup
+
+import (
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/signedurl"
+)
+
+// minSignedURLKey is the shortest key that URLs may be signed with.
+const minSignedURLKey = 16
+
+// SignedURL configures a new SignedURL middleware instance.
+// The syntax is
+//
+//	signedurl paths... {
+//		key      secret
+//		endpoint path token
+//		max_ttl  duration
+//	}
+//
+// Requests for the paths must be signed with key, which must be
+// at least 16 characters. With endpoint, clients with the token
+// can have URLs signed for at most max_ttl (7 days by default).
+// The key and token may refer to secrets kept elsewhere; see
+// parse.Dispenser.Secret.
+func SignedURL(c *Controller) (middleware.Middleware, error) {
+	s, err := signedurlParse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next middleware.Handler) middleware.Handler {
+		s.Next = next
+		return s
+	}, nil
+}
+
+func signedurlParse(c *Controller) (signedurl.SignedURL, error) {
+	s := signedurl.SignedURL{MaxTTL: 7 * 24 * time.Hour}
+
+	for c.Next() {
+		paths := c.RemainingArgs()
+		if len(paths) == 0 {
+			return s, c.ArgErr()
+		}
+		s.Paths = append(s.Paths, paths...)
+
+		for c.NextBlock() {
+			what := c.Val()
+			args := c.RemainingArgs()
+
+			switch what {
+			case "key":
+				if len(args) != 1 {
+					return s, c.ArgErr()
+				}
+				key, err := c.Secret(args[0])
+				if err != nil {
+					return s, err
+				}
+				if len(key) < minSignedURLKey {
+					return s, c.Errf("Signing key must be at least %d characters", minSignedURLKey)
+				}
+				s.Key = []byte(key)
+			case "endpoint":
+				if len(args) != 2 {
+					return s, c.ArgErr()
+				}
+				token, err := c.Secret(args[1])
+				if err != nil {
+					return s, err
+				}
+				s.Endpoint, s.Token = args[0], token
+			case "max_ttl":
+				if len(args) != 1 {
+					return s, c.ArgErr()
+				}
+				ttl, err := time.ParseDuration(args[0])
+				if err != nil || ttl <= 0 {
+					return s, c.Errf("Invalid max_ttl '%s'", args[0])
+				}
+				s.MaxTTL = ttl
+			default:
+				return s, c.Errf("Unknown signedurl property '%s'", what)
+			}
+		}
+	}
+
+	if len(s.Key) == 0 {
+		return s, c.Err("signedurl needs a key to sign URLs with")
+	}
+
+	return s, nil
+}
@@ -0,0 +1,71 @@
+package setup
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware/signedurl"
+)
+
+func TestSignedURLParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  signedurl.SignedURL
+	}{
+		{`signedurl /files {
+			key 0123456789abcdef
+		}`, false, signedurl.SignedURL{
+			Paths:  []string{"/files"},
+			Key:    []byte("0123456789abcdef"),
+			MaxTTL: 7 * 24 * time.Hour,
+		}},
+		{`signedurl /files /videos {
+			key 0123456789abcdef
+			endpoint /_sign secret
+			max_ttl 1h
+		}`, false, signedurl.SignedURL{
+			Paths:    []string{"/files", "/videos"},
+			Key:      []byte("0123456789abcdef"),
+			Endpoint: "/_sign",
+			Token:    "secret",
+			MaxTTL:   time.Hour,
+		}},
+		{`signedurl /files`, true, signedurl.SignedURL{}},
+		{`signedurl {
+			key 0123456789abcdef
+		}`, true, signedurl.SignedURL{}},
+		{`signedurl /files {
+			key short
+		}`, true, signedurl.SignedURL{}},
+		{`signedurl /files {
+			key 0123456789abcdef
+			endpoint /_sign
+		}`, true, signedurl.SignedURL{}},
+		{`signedurl /files {
+			key 0123456789abcdef
+			max_ttl forever
+		}`, true, signedurl.SignedURL{}},
+		{`signedurl /files {
+			key 0123456789abcdef
+			algorithm sha1
+		}`, true, signedurl.SignedURL{}},
+	}
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		actual, err := signedurlParse(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if err != nil || test.shouldErr {
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package setup
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/slowlog"
+)
+
+// SlowLog configures a new SlowLog middleware instance.
+func SlowLog(c *Controller) (middleware.Middleware, error) {
+	handler, err := slowLogParse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// Time each layer of middleware, so entries can say where
+	// the time went
+	c.TraceMiddleware = true
+
+	// The log file is opened for writing when the server starts
+	handler.Log = log.New(newLogOutput(c, handler.OutputFile), "", 0)
+
+	return func(next middleware.Handler) middleware.Handler {
+		handler.Next = next
+		return handler
+	}, nil
+}
+
+// slowLogParse parses 'slowlog threshold [file]'. The threshold
+// is a duration, or a number of milliseconds.
+func slowLogParse(c *Controller) (*slowlog.SlowLog, error) {
+	handler := &slowlog.SlowLog{OutputFile: slowlog.DefaultLogFilename}
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) < 1 || len(args) > 2 {
+			return nil, c.ArgErr()
+		}
+
+		if ms, err := strconv.Atoi(args[0]); err == nil && ms >= 0 {
+			handler.Threshold = time.Duration(ms) * time.Millisecond
+		} else if dur, err := time.ParseDuration(args[0]); err == nil && dur >= 0 {
+			handler.Threshold = dur
+		} else {
+			return nil, c.Errf("Invalid slowlog threshold '%s'", args[0])
+		}
+
+		if len(args) > 1 {
+			handler.OutputFile = args[1]
+		}
+	}
+
+	return handler, nil
+}
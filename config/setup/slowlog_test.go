@@ -0,0 +1,69 @@
+package setup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware/slowlog"
+)
+
+func TestSlowLog(t *testing.T) {
+	c := NewTestController(`slowlog 500`)
+
+	mid, err := SlowLog(c)
+	if err != nil {
+		t.Errorf("Expected no errors, got: %v", err)
+	}
+	if mid == nil {
+		t.Fatal("Expected middleware, was nil instead")
+	}
+	if !c.TraceMiddleware {
+		t.Error("Expected middleware to be traced")
+	}
+
+	handler := mid(EmptyNext)
+	myHandler, ok := handler.(*slowlog.SlowLog)
+	if !ok {
+		t.Fatalf("Expected handler to be type *SlowLog, got: %#v", handler)
+	}
+	if !SameNext(myHandler.Next, EmptyNext) {
+		t.Error("'Next' field of handler was not set properly")
+	}
+}
+
+func TestSlowLogParse(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		threshold time.Duration
+		file      string
+	}{
+		{`slowlog 500`, false, 500 * time.Millisecond, slowlog.DefaultLogFilename},
+		{`slowlog 2s stderr`, false, 2 * time.Second, "stderr"},
+		{`slowlog 250ms /var/log/slow.log`, false, 250 * time.Millisecond, "/var/log/slow.log"},
+		{`slowlog`, true, 0, ""},
+		{`slowlog slow`, true, 0, ""},
+		{`slowlog -5`, true, 0, ""},
+		{`slowlog 1s a b`, true, 0, ""},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		actual, err := slowLogParse(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if actual.Threshold != test.threshold {
+			t.Errorf("Test %d: Expected threshold %v, got %v", i, test.threshold, actual.Threshold)
+		}
+		if actual.OutputFile != test.file {
+			t.Errorf("Test %d: Expected file %s, got %s", i, test.file, actual.OutputFile)
+		}
+	}
+}
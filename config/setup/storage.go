@@ -0,0 +1,109 @@
+package setup
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/storage"
+	"github.com/mholt/caddy/server"
+)
+
+// Storage sets where the site's middleware keeps its state, like
+// rate limits and short links. The syntax is
+//
+//	storage memory
+//	storage file directory
+//	storage redis address {
+//		password secret
+//		db       n
+//		prefix   prefix
+//		timeout  duration
+//		max_idle n
+//	}
+//
+// A redis store can be shared by several servers; its password
+// may refer to where it is kept, like other secrets. Without this
+// directive, each middleware keeps its state its own way.
+func Storage(c *Controller) (middleware.Middleware, error) {
+	for c.Next() {
+		args := c.RemainingArgs()
+		if len(args) == 0 {
+			return nil, c.ArgErr()
+		}
+
+		switch args[0] {
+		case "memory":
+			if len(args) != 1 {
+				return nil, c.ArgErr()
+			}
+			c.Storage = storage.NewMemory()
+		case "file":
+			if len(args) != 2 {
+				return nil, c.ArgErr()
+			}
+			dir := storage.NewDir(args[1], c.FilePerms)
+			c.Storage = dir
+			c.Checks = append(c.Checks, server.Check{What: "storage " + dir.Path(), Run: server.CheckWritableDir(dir.Path())})
+		case "redis":
+			if len(args) != 2 {
+				return nil, c.ArgErr()
+			}
+			rd, err := redisParse(c, args[1])
+			if err != nil {
+				return nil, err
+			}
+			c.Storage = rd
+			c.Checks = append(c.Checks, server.Check{What: "storage redis " + rd.Addr + " responds", Run: rd.Ping})
+		default:
+			return nil, c.Errf("Unknown storage '%s'; use memory, file or redis", args[0])
+		}
+		if args[0] != "redis" && c.NextBlock() {
+			return nil, c.Errf("Unexpected block for %s storage", args[0])
+		}
+	}
+	return nil, nil
+}
+
+// redisParse parses the block of a redis store at addr.
+func redisParse(c *Controller, addr string) (*storage.Redis, error) {
+	rd := &storage.Redis{Addr: addr}
+	for c.NextBlock() {
+		what := c.Val()
+		args := c.RemainingArgs()
+		if len(args) != 1 {
+			return nil, c.ArgErr()
+		}
+		switch what {
+		case "password":
+			password, err := c.Secret(args[0])
+			if err != nil {
+				return nil, err
+			}
+			rd.Password = password
+		case "db":
+			db, err := strconv.Atoi(args[0])
+			if err != nil || db < 0 {
+				return nil, c.Errf("Invalid redis db '%s'", args[0])
+			}
+			rd.DB = db
+		case "prefix":
+			rd.Prefix = args[0]
+		case "timeout":
+			timeout, err := time.ParseDuration(args[0])
+			if err != nil || timeout <= 0 {
+				return nil, c.Errf("Invalid redis timeout '%s'", args[0])
+			}
+			rd.Timeout = timeout
+		case "max_idle":
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return nil, c.Errf("Invalid redis max_idle '%s'", args[0])
+			}
+			rd.MaxIdle = n
+		default:
+			return nil, c.Errf("Unknown redis property '%s'", what)
+		}
+	}
+	return rd, nil
+}
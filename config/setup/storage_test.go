@@ -0,0 +1,69 @@
+package setup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/storage"
+)
+
+func TestStorage(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  storage.Storage
+	}{
+		{`storage memory`, false, storage.NewMemory()},
+		{`storage file /tmp/caddy_state`, false, storage.NewDir("/tmp/caddy_state", middleware.FilePerms{})},
+		{`storage redis localhost:6379`, false, &storage.Redis{Addr: "localhost:6379"}},
+		{"storage redis 10.0.0.5:6379 {\n password secret\n db 2\n prefix www/\n timeout 2s\n max_idle 8\n}", false,
+			&storage.Redis{Addr: "10.0.0.5:6379", Password: "secret", DB: 2, Prefix: "www/", Timeout: 2 * time.Second, MaxIdle: 8}},
+		{`storage`, true, nil},
+		{`storage memory extra`, true, nil},
+		{`storage file`, true, nil},
+		{`storage redis`, true, nil},
+		{`storage bolt state.db`, true, nil},
+		{"storage memory {\n size 10\n}", true, nil},
+		{"storage redis localhost:6379 {\n db -1\n}", true, nil},
+		{"storage redis localhost:6379 {\n timeout soon\n}", true, nil},
+		{"storage redis localhost:6379 {\n max_idle 0\n}", true, nil},
+		{"storage redis localhost:6379 {\n password\n}", true, nil},
+		{"storage redis localhost:6379 {\n user me\n}", true, nil},
+	}
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		_, err := Storage(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+
+		switch expected := test.expected.(type) {
+		case *storage.Memory:
+			if _, ok := c.Storage.(*storage.Memory); !ok {
+				t.Errorf("Test %d: Expected memory storage, got %#v", i, c.Storage)
+			}
+		case *storage.Dir:
+			if c.Storage != expected {
+				t.Errorf("Test %d: Expected storage in %s, got %#v", i, expected.Path(), c.Storage)
+			}
+		case *storage.Redis:
+			rd, ok := c.Storage.(*storage.Redis)
+			if !ok || rd.Addr != expected.Addr || rd.Password != expected.Password ||
+				rd.DB != expected.DB || rd.Prefix != expected.Prefix || rd.Timeout != expected.Timeout ||
+				rd.MaxIdle != expected.MaxIdle {
+				t.Errorf("Test %d: Expected %+v, got %#v", i, expected, c.Storage)
+			}
+		}
+		if _, memory := c.Storage.(*storage.Memory); !memory && len(c.Checks) != 1 {
+			t.Errorf("Test %d: Expected a check that the storage works, got %d checks", i, len(c.Checks))
+		}
+	}
+}
@@ -1,10 +1,11 @@
 package setup
 
 import (
-	"net/http"
+	"fmt"
 
 	"github.com/mholt/caddy/middleware"
 	"github.com/mholt/caddy/middleware/templates"
+	"github.com/mholt/caddy/server"
 )
 
 // Templates configures a new Templates middleware instance.
@@ -14,11 +15,29 @@ func Templates(c *Controller) (middleware.Middleware, error) {
 		return nil, err
 	}
 
+	root, fs := c.Root, c.FileSystem()
+	for _, rule := range rules {
+		rule := rule
+		c.Checks = append(c.Checks, server.Check{
+			What: "templates under " + rule.Path + " parse",
+			Run: func() error {
+				n, err := templates.ParseFiles(root, fs, rule)
+				if n > 1 {
+					return fmt.Errorf("%v (and %d more files with errors)", err, n-1)
+				}
+				return err
+			},
+		})
+	}
+
 	tmpls := templates.Templates{
-		Rules:   rules,
-		Root:    c.Root,
-		FileSys: http.Dir(c.Root),
+		Rules:     rules,
+		Root:      c.Root,
+		FileSys:   c.FileSystem(),
+		Multipart: c.Multipart,
 	}
+	perms := c.FilePerms
+	tmpls.Multipart.Perms = &perms
 
 	return func(next middleware.Handler) middleware.Handler {
 		tmpls.Next = next
@@ -32,12 +51,13 @@ func templatesParse(c *Controller) ([]templates.Rule, error) {
 	for c.Next() {
 		var rule templates.Rule
 
-		if c.NextArg() {
+		args := c.RemainingArgs()
+		if len(args) > 0 {
 			// First argument would be the path
-			rule.Path = c.Val()
+			rule.Path = args[0]
 
 			// Any remaining arguments are extensions
-			rule.Extensions = c.RemainingArgs()
+			rule.Extensions = args[1:]
 			if len(rule.Extensions) == 0 {
 				rule.Extensions = defaultTemplateExtensions
 			}
@@ -50,12 +70,45 @@ func templatesParse(c *Controller) ([]templates.Rule, error) {
 			rule.IndexFiles = append(rule.IndexFiles, "index"+ext)
 		}
 
+		// Optional block of layouts, like
+		//     layout .txt /layouts/pre.html raw
+		for c.NextBlock() {
+			if c.Val() != "layout" {
+				return rules, c.Errf("Unknown templates property '%s'", c.Val())
+			}
+			args := c.RemainingArgs()
+			if len(args) < 2 || len(args) > 3 || (len(args) == 3 && args[2] != "raw") {
+				return rules, c.ArgErr()
+			}
+			ext := args[0]
+			if !hasExtension(rule.Extensions, ext) {
+				return rules, c.Errf("Layout for '%s', which is not one of the template extensions", ext)
+			}
+			if _, ok := rule.Layouts[ext]; ok {
+				return rules, c.Errf("Duplicate layout for '%s'", ext)
+			}
+			if rule.Layouts == nil {
+				rule.Layouts = make(map[string]templates.Layout)
+			}
+			rule.Layouts[ext] = templates.Layout{File: args[1], Raw: len(args) == 3}
+		}
+
 		rules = append(rules, rule)
 	}
 
 	return rules, nil
 }
 
+// hasExtension returns true if ext is one of exts.
+func hasExtension(exts []string, ext string) bool {
+	for _, e := range exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
 const defaultTemplatePath = "/"
 
 var defaultTemplateExtensions = []string{".html", ".htm", ".tmpl", ".tpl", ".txt"}
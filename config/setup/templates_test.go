@@ -64,6 +64,40 @@ func TestTemplatesParse(t *testing.T) {
 			Path:       "/api4",
 			Extensions: []string{".txt", ".tpl"},
 		}}},
+		{`templates / .html .txt {
+			layout .html /layouts/base.html
+			layout .txt /layouts/pre.html raw
+		}`, false, []templates.Rule{{
+			Path:       "/",
+			Extensions: []string{".html", ".txt"},
+			Layouts: map[string]templates.Layout{
+				".html": {File: "/layouts/base.html"},
+				".txt":  {File: "/layouts/pre.html", Raw: true},
+			},
+		}}},
+		{`templates {
+			layout .tmpl /layouts/base.html
+		}`, false, []templates.Rule{{
+			Path:       defaultTemplatePath,
+			Extensions: defaultTemplateExtensions,
+			Layouts:    map[string]templates.Layout{".tmpl": {File: "/layouts/base.html"}},
+		}}},
+		{`templates / .html {
+			layout .md /layouts/base.html
+		}`, true, nil},
+		{`templates / .html {
+			layout .html
+		}`, true, nil},
+		{`templates / .html {
+			layout .html /base.html escaped
+		}`, true, nil},
+		{`templates / .html {
+			layout .html /a.html
+			layout .html /b.html
+		}`, true, nil},
+		{`templates / .html {
+			partials /partials
+		}`, true, nil},
 	}
 	for i, test := range tests {
 		c := NewTestController(test.inputTemplateConfig)
@@ -88,6 +122,10 @@ func TestTemplatesParse(t *testing.T) {
 			if fmt.Sprint(actualTemplateConfig.Extensions) != fmt.Sprint(test.expectedTemplateConfig[j].Extensions) {
 				t.Errorf("Expected %v to be the  Extensions , but got %v instead", test.expectedTemplateConfig[j].Extensions, actualTemplateConfig.Extensions)
 			}
+
+			if fmt.Sprint(actualTemplateConfig.Layouts) != fmt.Sprint(test.expectedTemplateConfig[j].Layouts) {
+				t.Errorf("Test %d: Expected layouts %v, but got %v", i, test.expectedTemplateConfig[j].Layouts, actualTemplateConfig.Layouts)
+			}
 		}
 	}
 
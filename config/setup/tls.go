@@ -17,19 +17,39 @@ func TLS(c *Controller) (middleware.Middleware, error) {
 	}
 
 	for c.Next() {
-		if !c.NextArg() {
-			return nil, c.ArgErr()
-		}
-		c.TLS.Certificate = c.Val()
-
-		if !c.NextArg() {
+		// With a certificate and key, they're loaded from their files;
+		// without them, the certificate is obtained automatically with
+		// ACME, for the account of the email address, if one is given
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			if !strings.Contains(args[0], "@") {
+				return nil, c.Errf("Expecting an email address or a certificate and key, got '%s'", args[0])
+			}
+			c.TLS.ACME.Email = args[0]
+		case 2:
+			c.TLS.Certificate, c.TLS.Key = args[0], args[1]
+		default:
 			return nil, c.ArgErr()
 		}
-		c.TLS.Key = c.Val()
 
 		// Optional block
 		for c.NextBlock() {
 			switch c.Val() {
+			case "ca", "storage":
+				what := c.Val()
+				if !c.NextArg() {
+					return nil, c.ArgErr()
+				}
+				if !c.TLS.Managed() {
+					return nil, c.Errf("'%s' is only for certificates obtained automatically", what)
+				}
+				if what == "ca" {
+					c.TLS.ACME.CA = c.Val()
+				} else {
+					c.TLS.ACME.Storage = c.Val()
+				}
 			case "protocols":
 				args := c.RemainingArgs()
 				if len(args) != 2 {
@@ -3,6 +3,8 @@ package setup
 import (
 	"crypto/tls"
 	"testing"
+
+	"github.com/mholt/caddy/server"
 )
 
 func TestTLSParseBasic(t *testing.T) {
@@ -66,7 +68,7 @@ func TestTLSParseBasic(t *testing.T) {
 }
 
 func TestTLSParseIncompleteParams(t *testing.T) {
-	c := NewTestController(`tls`)
+	c := NewTestController(`tls cert.crt cert.key extra`)
 
 	_, err := TLS(c)
 	if err == nil {
@@ -158,3 +160,43 @@ func TestTLSParseWithClientAuth(t *testing.T) {
 		t.Errorf("Expected an error, but no error returned")
 	}
 }
+
+func TestTLSParseACME(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  server.ACMEConfig
+	}{
+		{`tls`, false, server.ACMEConfig{}},
+		{`tls admin@example.com`, false, server.ACMEConfig{Email: "admin@example.com"}},
+		{`tls admin@example.com {
+			ca https://acme.example.com/directory
+			storage /var/lib/caddy
+		}`, false, server.ACMEConfig{Email: "admin@example.com", CA: "https://acme.example.com/directory", Storage: "/var/lib/caddy"}},
+		{`tls cert.crt cert.key {
+			ca https://acme.example.com/directory
+		}`, true, server.ACMEConfig{}},
+		{`tls {
+			storage
+		}`, true, server.ACMEConfig{}},
+	} {
+		c := NewTestController(test.input)
+		_, err := TLS(c)
+		if test.shouldErr {
+			if err == nil {
+				t.Errorf("Test %d didn't error, but it should have", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if !c.TLS.Managed() {
+			t.Errorf("Test %d: Expected the certificate to be managed", i)
+		}
+		if c.TLS.ACME != test.expected {
+			t.Errorf("Test %d: Expected ACME config %+v, got %+v", i, test.expected, c.TLS.ACME)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package setup
+
+import (
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Warmup sets paths that the server requests from the site
+// itself after it starts or is reloaded, to fill caches and
+// open upstream connections before the site is reported
+// ready on the admin API's health endpoint.
+func Warmup(c *Controller) (middleware.Middleware, error) {
+	for c.Next() {
+		paths := c.RemainingArgs()
+		if len(paths) == 0 {
+			return nil, c.ArgErr()
+		}
+		for _, p := range paths {
+			if !strings.HasPrefix(p, "/") {
+				return nil, c.Errf("Warm-up path '%s' must start with /", p)
+			}
+		}
+		c.Warmup = append(c.Warmup, paths...)
+	}
+	return nil, nil
+}
@@ -0,0 +1,41 @@
+package setup
+
+import "testing"
+
+func TestWarmup(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  []string
+	}{
+		{`warmup /`, false, []string{"/"}},
+		{"warmup / /api/ping\nwarmup /blog/", false, []string{"/", "/api/ping", "/blog/"}},
+		{`warmup`, true, nil},
+		{`warmup index.html`, true, nil},
+	}
+
+	for i, test := range tests {
+		c := NewTestController(test.input)
+		mid, err := Warmup(c)
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if mid != nil {
+			t.Errorf("Test %d: Expected no middleware, got some", i)
+		}
+		if test.shouldErr {
+			continue
+		}
+		if len(c.Warmup) != len(test.expected) {
+			t.Fatalf("Test %d: Expected warm-up paths %v, got %v", i, test.expected, c.Warmup)
+		}
+		for j, path := range test.expected {
+			if c.Warmup[j] != path {
+				t.Errorf("Test %d: Expected warm-up paths %v, got %v", i, test.expected, c.Warmup)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/mholt/caddy/app"
+	"github.com/mholt/caddy/config"
+	"github.com/mholt/caddy/server"
+)
+
+// diagnose loads the configuration and checks what its sites need
+// from this machine without serving them: that the files they read
+// and write can be, that their upstreams resolve, that their templates
+// parse and that their addresses are free. It prints a line for each
+// check to out and returns true if they all passed.
+func diagnose(out io.Writer) bool {
+	var passed, failed int
+	report := func(site, what string, err error) {
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "FAIL  %-24s %s: %v\n", site, what, err)
+			return
+		}
+		passed++
+		fmt.Fprintf(out, "ok    %-24s %s\n", site, what)
+	}
+	summary := func() bool {
+		fmt.Fprintf(out, "\n%d passed, %d failed\n", passed, failed)
+		return failed == 0
+	}
+
+	allConfigs, err := loadConfigs()
+	report("-", "configuration loads", err)
+	if err != nil {
+		return summary()
+	}
+
+	addresses, err := config.ArrangeBindings(allConfigs)
+	report("-", "site addresses don't conflict", err)
+
+	for _, conf := range allConfigs {
+		for _, check := range conf.Diagnostics() {
+			report(conf.Address(), check.What, check.Run())
+		}
+	}
+
+	// The listeners, in a stable order
+	var addrs []string
+	for addr := range addresses {
+		addrs = append(addrs, addr.String())
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		report(addr, "address is free to listen on", server.CheckListen(addr)())
+	}
+
+	var limitErr error
+	if needed := fileLimitNeeded(len(allConfigs)); !app.CheckFileLimit(needed) {
+		limitErr = fmt.Errorf("limit is %d; at least %d is recommended (ulimit -n %d)",
+			app.FileLimit.Soft, needed, needed)
+	}
+	report("-", "file descriptor limit", limitErr)
+
+	return summary()
+}
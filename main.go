@@ -7,14 +7,16 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
-	"path"
-	"runtime"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/mholt/caddy/admin"
+	_ "github.com/mholt/caddy/admin/dashboard" // serves /dashboard on the admin API
+	_ "github.com/mholt/caddy/admin/health"    // serves /health on the admin API
 	"github.com/mholt/caddy/app"
 	"github.com/mholt/caddy/config"
+	"github.com/mholt/caddy/middleware"
 	"github.com/mholt/caddy/server"
 )
 
@@ -22,17 +24,32 @@ var (
 	conf    string
 	cpu     string
 	version bool
+	watch   time.Duration
+	format  bool
+	history int
+
+	diagnoseOnly bool
+
+	adminAddr string
+
+	fromStdin bool // whether the configuration was read from stdin
 )
 
 func init() {
-	flag.StringVar(&conf, "conf", "", "Configuration file to use (default="+config.DefaultConfigFile+")")
+	flag.StringVar(&conf, "conf", "", "Configuration file or directory to use (default="+config.DefaultConfigFile+")")
 	flag.BoolVar(&app.Http2, "http2", true, "Enable HTTP/2 support") // TODO: temporary flag until http2 merged into std lib
 	flag.BoolVar(&app.Quiet, "quiet", false, "Quiet mode (no initialization output)")
 	flag.StringVar(&cpu, "cpu", "100%", "CPU cap")
 	flag.StringVar(&config.Root, "root", config.DefaultRoot, "Root path to default site")
 	flag.StringVar(&config.Host, "host", config.DefaultHost, "Default host")
 	flag.StringVar(&config.Port, "port", config.DefaultPort, "Default port")
+	flag.Var(&config.Panic, "panic", "What to do when a handler panics, unless a site's panic directive says otherwise: recover, abort or exit")
 	flag.BoolVar(&version, "version", false, "Show version")
+	flag.BoolVar(&format, "fmt", false, "Print the configuration file in canonical form and exit")
+	flag.BoolVar(&diagnoseOnly, "diagnose", false, "Check what the sites need from this machine, like readable roots and certificates, writable logs and free addresses, print a report and exit")
+	flag.DurationVar(&watch, "watch", 5*time.Second, "How often to check a configuration directory for changed files (0 to disable)")
+	flag.IntVar(&history, "history", 5, "How many copies of each configuration file that loaded successfully to keep in "+config.HistoryDir+" next to it (0 to disable)")
+	flag.StringVar(&adminAddr, "admin", "", "Address to serve the admin API on, like localhost:2019 (disabled if empty)")
 }
 
 func main() {
@@ -43,6 +60,22 @@ func main() {
 		os.Exit(0)
 	}
 
+	if format {
+		err := formatConfig()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if diagnoseOnly {
+		if !diagnose(os.Stdout) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Set CPU cap
 	err := app.SetCPU(cpu)
 	if err != nil {
@@ -61,23 +94,40 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Keep a copy of the configuration to roll back to
+	saveHistory(allConfigs)
+
+	// Make sure we can open enough files for the sites' load
+	// before the servers bind and start accepting connections
+	var numSites int
+	for _, configs := range addresses {
+		numSites += len(configs)
+	}
+	fdLimitOK := app.CheckFileLimit(fileLimitNeeded(numSites))
+
 	// Start each server with its one or more configurations
 	for addr, configs := range addresses {
-		s, err := server.New(addr.String(), configs)
+		err := startServer(addr.String(), configs)
 		if err != nil {
 			log.Fatal(err)
 		}
-		s.HTTP2 = app.Http2 // TODO: This setting is temporary
-		app.Wg.Add(1)
-		go func(s *server.Server) {
-			defer app.Wg.Done()
-			err := s.Serve()
-			if err != nil {
-				log.Fatal(err) // kill whole process to avoid a half-alive zombie server
-			}
-		}(s)
+	}
 
-		app.Servers = append(app.Servers, s)
+	// Serve the admin API
+	if adminAddr != "" {
+		go func() {
+			log.Fatal(admin.ListenAndServe(adminAddr))
+		}()
+	}
+
+	// Reload all sites on a signal (SIGUSR1), and reopen the
+	// log files on another (SIGHUP), where supported
+	reloadOnSignal()
+	reopenLogsOnSignal()
+
+	// Reload sites from a configuration directory as their files change
+	if isConfigDir() && watch > 0 {
+		go watchConfigDir(conf, watch)
 	}
 
 	// Show initialization output
@@ -96,7 +146,10 @@ func main() {
 			}
 
 			if !checkedFdLimit && !addr.IP.IsLoopback() {
-				checkFdlimit()
+				if !fdLimitOK {
+					fmt.Printf("Warning: File descriptor limit %d is too low for production sites.\nAt least %d is recommended. Set with \"ulimit -n %d\".\n",
+						app.FileLimit.Soft, fileLimitNeeded(numSites), fileLimitNeeded(numSites))
+				}
 				checkedFdLimit = true
 			}
 		}
@@ -106,21 +159,248 @@ func main() {
 	app.Wg.Wait()
 }
 
-// checkFdlimit issues a warning if the OS max file descriptors is below a recommended minimum.
-func checkFdlimit() {
-	const min = 4096
+// startServer creates a server that binds to addr and serves
+// configs, and starts it in the background.
+func startServer(addr string, configs []server.Config) error {
+	s, err := server.New(addr, configs)
+	if err != nil {
+		return err
+	}
+	serve(s, true)
+	return nil
+}
 
-	// Warn if ulimit is too low for production sites
-	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
-		out, err := exec.Command("sh", "-c", "ulimit -n").Output() // use sh because ulimit isn't in Linux $PATH
+// serve starts s in the background and adds it to the running
+// servers. If s stops with an error and fatal is true, the whole
+// process exits to avoid a half-alive zombie server; servers
+// started by a reload only log the error, since the sites that
+// were already up are fine.
+func serve(s *server.Server, fatal bool) {
+	s.HTTP2 = app.Http2 // TODO: This setting is temporary
+	app.Wg.Add(1)
+	go func(s *server.Server) {
+		defer app.Wg.Done()
+		err := s.Serve()
 		if err == nil {
-			// Note that an error here need not be reported
-			lim, err := strconv.Atoi(string(bytes.TrimSpace(out)))
-			if err == nil && lim < min {
-				fmt.Printf("Warning: File descriptor limit %d is too low for production sites.\nAt least %d is recommended. Set with \"ulimit -n %d\".\n", lim, min, min)
+			return
+		}
+		if fatal {
+			log.Fatal(err)
+		}
+		log.Printf("[ERROR] Serving %s: %v", s.Address(), err)
+	}(s)
+
+	app.ServersMutex.Lock()
+	app.Servers = append(app.Servers, s)
+	app.ServersMutex.Unlock()
+}
+
+// watchConfigDir checks the configuration directory dir for changed
+// files every interval and reloads them. Each file is reloaded on
+// its own, so a mistake in one site's file doesn't affect the others;
+// if a file can't be loaded or its sites can't be served, they keep
+// their old configuration. Either way, the outcome is recorded for
+// the admin API.
+func watchConfigDir(dir string, interval time.Duration) {
+	watcher, err := config.NewDirWatcher(dir)
+	if err != nil {
+		log.Println("[ERROR] Watching", dir+":", err)
+		return
+	}
+
+	for range time.Tick(interval) {
+		changed, err := watcher.Changed()
+		if err != nil {
+			log.Println("[ERROR] Watching", dir+":", err)
+			continue
+		}
+		for _, file := range changed {
+			reload(file)
+		}
+	}
+}
+
+// reloadMu keeps reloads, which may be started by the
+// configuration directory watcher or a signal, one at a time.
+var reloadMu sync.Mutex
+
+// reload reloads the configuration file named file, and records
+// and logs the outcome. If the file loaded, a copy of it is kept.
+func reload(file string) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	diff, err := reloadConfigFile(file)
+	config.RecordReload(file, diff, err)
+	if err != nil {
+		log.Printf("[ERROR] Reloading %s: %v; keeping the previous configuration", file, err)
+		return
+	}
+	log.Printf("Reloaded %s: %s", file, diff)
+	if _, err := os.Stat(file); err == nil {
+		app.ServersMutex.Lock()
+		servers := app.Servers
+		app.ServersMutex.Unlock()
+		var configs []server.Config
+		for _, s := range servers {
+			configs = append(configs, s.FileConfigs(file)...)
+		}
+		err := config.SaveHistory(file, history, historyPerms(configs, file))
+		if err != nil {
+			log.Printf("[ERROR] Saving a copy of %s: %v", file, err)
+		}
+	}
+}
+
+// reloadAll reloads every configuration file the sites were
+// loaded from. Sites read from stdin can't be reloaded.
+func reloadAll() {
+	var files []string
+	switch {
+	case isConfigDir():
+		var err error
+		files, err = config.DirFiles(conf)
+		if err != nil {
+			log.Printf("[ERROR] Reloading %s: %v", conf, err)
+			return
+		}
+	case conf != "":
+		files = []string{conf}
+	case fromStdin:
+		log.Println("[ERROR] Can't reload: the configuration was read from stdin")
+		return
+	default:
+		files = []string{config.DefaultConfigFile}
+	}
+	for _, file := range files {
+		reload(file)
+	}
+}
+
+// reloadConfigFile loads the configuration file named file and swaps
+// its sites into the running servers, starting new servers for any
+// new addresses. If the file was removed, its sites are taken down.
+// It returns what changed. The reload is all or nothing: if any
+// server can't take the new sites or a new address can't be bound,
+// every server goes back to the sites it had before.
+func reloadConfigFile(file string) (config.Diff, error) {
+	var configs []server.Config
+	if _, err := os.Stat(file); err == nil {
+		configs, err = config.LoadFile(file)
+		if err != nil {
+			return config.Diff{}, err
+		}
+	}
+
+	addresses, err := config.ArrangeBindings(configs)
+	if err != nil {
+		return config.Diff{}, err
+	}
+
+	app.ServersMutex.Lock()
+	servers := app.Servers
+	app.ServersMutex.Unlock()
+
+	var old []server.Config
+	for _, s := range servers {
+		old = append(old, s.FileConfigs(file)...)
+	}
+
+	var replacements []*server.Replacement
+	var started []*server.Server
+	fail := func(err error) (config.Diff, error) {
+		for _, r := range replacements {
+			r.Rollback()
+		}
+		for _, s := range started {
+			s.Close()
+		}
+		return config.Diff{}, err
+	}
+
+	for _, s := range servers {
+		var siteConfigs []server.Config
+		for addr, addrConfigs := range addresses {
+			if addr.String() == s.Address() {
+				siteConfigs = addrConfigs
+				delete(addresses, addr)
+				break
 			}
 		}
+		r, err := s.ReplaceFile(file, siteConfigs)
+		if err != nil {
+			return fail(err)
+		}
+		replacements = append(replacements, r)
+	}
+
+	// Bind new addresses before committing, so that an
+	// address in use doesn't leave the file half-reloaded
+	for addr, addrConfigs := range addresses {
+		s, err := server.New(addr.String(), addrConfigs)
+		if err != nil {
+			return fail(err)
+		}
+		err = s.Listen()
+		if err != nil {
+			return fail(err)
+		}
+		started = append(started, s)
+	}
+
+	for _, r := range replacements {
+		r.Commit()
+	}
+	for _, s := range started {
+		serve(s, false)
+	}
+
+	return config.DiffConfigs(file, old, configs), nil
+}
+
+// saveHistory keeps a copy of each configuration file named
+// by the -conf flag, so that it can be rolled back to by hand.
+// configs are the sites loaded from the files.
+func saveHistory(configs []server.Config) {
+	if conf == "" {
+		return
+	}
+	files := []string{conf}
+	if isConfigDir() {
+		var err error
+		files, err = config.DirFiles(conf)
+		if err != nil {
+			log.Printf("[ERROR] Saving copies of %s: %v", conf, err)
+			return
+		}
+	}
+	for _, file := range files {
+		err := config.SaveHistory(file, history, historyPerms(configs, file))
+		if err != nil {
+			log.Printf("[ERROR] Saving a copy of %s: %v", file, err)
+		}
+	}
+}
+
+// historyPerms returns the file permissions to keep copies of
+// the configuration file named file with: those of the first
+// site in configs that was loaded from it.
+func historyPerms(configs []server.Config, file string) middleware.FilePerms {
+	for _, c := range configs {
+		if c.ConfigFile == file {
+			return c.FilePerms
+		}
 	}
+	return middleware.FilePerms{}
+}
+
+// fileLimitNeeded returns how many files the process should be
+// able to open to serve numSites sites: a baseline for client
+// connections, plus some for each site's listener, log files,
+// and backend connections.
+func fileLimitNeeded(numSites int) uint64 {
+	const baseline, perSite = 4096, 8
+	return baseline + perSite*uint64(numSites)
 }
 
 // isLocalhost returns true if the string looks explicitly like a localhost address.
@@ -128,20 +408,50 @@ func isLocalhost(s string) bool {
 	return s == "localhost" || s == "::1" || strings.HasPrefix(s, "127.")
 }
 
+// formatConfig prints the configuration file named by the -conf
+// flag (or the default Caddyfile) in canonical form to stdout.
+func formatConfig() error {
+	filename := conf
+	if filename == "" {
+		filename = config.DefaultConfigFile
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	out, err := config.Format(filename, file)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+// isConfigDir returns true if the -conf flag names a directory.
+func isConfigDir() bool {
+	if conf == "" {
+		return false
+	}
+	info, err := os.Stat(conf)
+	return err == nil && info.IsDir()
+}
+
 // loadConfigs loads configuration from a file or stdin (piped).
 // Configuration is obtained from one of three sources, tried
 // in this order: 1. -conf flag, 2. stdin, 3. Caddyfile.
+// If -conf names a directory, every file in it is loaded.
 // If none of those are available, a default configuration is
 // loaded.
 func loadConfigs() ([]server.Config, error) {
 	// -conf flag
+	if isConfigDir() {
+		return config.LoadDir(conf)
+	}
 	if conf != "" {
-		file, err := os.Open(conf)
-		if err != nil {
-			return []server.Config{}, err
-		}
-		defer file.Close()
-		return config.Load(path.Base(conf), file)
+		return config.LoadFile(conf)
 	}
 
 	// stdin
@@ -157,6 +467,7 @@ func loadConfigs() ([]server.Config, error) {
 			log.Fatal(err)
 		}
 		if len(confBody) > 0 {
+			fromStdin = true
 			return config.Load("stdin", bytes.NewReader(confBody))
 		}
 	}
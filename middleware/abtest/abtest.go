@@ -0,0 +1,134 @@
+// Package abtest provides middleware that splits visitors between
+// variants of a part of a site, for A/B testing.
+package abtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"hash/fnv"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Defaults for a Test.
+const (
+	DefaultCookie = "caddy_visitor"
+	DefaultHeader = "X-Variant"
+)
+
+// visitorCookieAge is how long a visitor keeps their ID,
+// and with it their variants.
+const visitorCookieAge = 365 * 24 * 60 * 60
+
+// ABTest is middleware that assigns each visitor to a variant
+// of the tests whose paths they request.
+type ABTest struct {
+	Next  middleware.Handler
+	Tests []Test
+}
+
+// Test is an A/B test of the part of a site under Path.
+//
+// Visitors are told apart by an ID kept in a cookie, which is
+// given to them on their first visit. The ID, hashed with Path,
+// picks the variant, so a visitor sees the same one each time
+// (and may see different ones in different tests). Changing
+// the weights only moves the visitors whose hashes fall in the
+// part of the range that changes hands.
+type Test struct {
+	Path     string
+	Cookie   string // name of the visitor cookie
+	Header   string // request and response header naming the variant
+	Variants []Variant
+}
+
+// Variant is one variant of a test. Requests of visitors
+// assigned to it have Prefix put in front of their paths,
+// so that /page is served from /b/page, for example; the
+// control variant has no Prefix.
+type Variant struct {
+	Name   string
+	Weight int // percentage of visitors; the weights of a test add up to 100
+	Prefix string
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (a ABTest) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, test := range a.Tests {
+		if !middleware.Path(r.URL.Path).Matches(test.Path) {
+			continue
+		}
+
+		cookieName := test.Cookie
+		if cookieName == "" {
+			cookieName = DefaultCookie
+		}
+		var visitor string
+		if cookie, err := r.Cookie(cookieName); err == nil && cookie.Value != "" {
+			visitor = cookie.Value
+		} else {
+			visitor = newVisitorID()
+			http.SetCookie(w, &http.Cookie{
+				Name:     cookieName,
+				Value:    visitor,
+				Path:     "/",
+				MaxAge:   visitorCookieAge,
+				HttpOnly: true,
+			})
+			// later tests in this request see the same ID
+			r.AddCookie(&http.Cookie{Name: cookieName, Value: visitor})
+		}
+
+		variant := test.assign(visitor)
+
+		header := test.Header
+		if header == "" {
+			header = DefaultHeader
+		}
+		r.Header.Set(header, variant.Name) // for {>X-Variant} in logs, and backends
+		w.Header().Set(header, variant.Name)
+		w.Header().Add("Vary", "Cookie")
+
+		if variant.Prefix != "" {
+			r.URL.Path = strings.TrimSuffix(variant.Prefix, "/") + r.URL.Path
+		}
+		break
+	}
+
+	return a.Next.ServeHTTP(w, r)
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (a ABTest) Scopes() []string {
+	scopes := make([]string, len(a.Tests))
+	for i, test := range a.Tests {
+		scopes[i] = test.Path
+	}
+	return scopes
+}
+
+// assign returns the variant of the test for visitor.
+func (t Test) assign(visitor string) Variant {
+	h := fnv.New32a()
+	h.Write([]byte(visitor))
+	h.Write([]byte{0})
+	h.Write([]byte(t.Path))
+	bucket := int(h.Sum32() % 100)
+
+	for _, v := range t.Variants {
+		if bucket < v.Weight {
+			return v
+		}
+		bucket -= v.Weight
+	}
+	return t.Variants[len(t.Variants)-1]
+}
+
+// newVisitorID returns a random ID for a new visitor.
+func newVisitorID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
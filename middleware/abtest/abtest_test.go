@@ -0,0 +1,75 @@
+package abtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mwtest "github.com/mholt/caddy/middleware/testing"
+)
+
+func TestABTest(t *testing.T) {
+	next := &mwtest.Handler{}
+	a := ABTest{Next: next, Tests: []Test{{
+		Path: "/landing",
+		Variants: []Variant{
+			{Name: "a", Weight: 50},
+			{Name: "b", Weight: 50, Prefix: "/b/"},
+		},
+	}}}
+
+	// a new visitor gets a cookie and a variant
+	rec := mwtest.Serve(a, httptest.NewRequest("GET", "/landing/index.html", nil))
+	rec.AssertStatus(t, http.StatusOK)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != DefaultCookie || cookies[0].Value == "" {
+		t.Fatalf("Expected a visitor cookie, got %v", cookies)
+	}
+	variant := rec.Header().Get(DefaultHeader)
+	if got := next.Request().Header.Get(DefaultHeader); got != variant || variant == "" {
+		t.Errorf("Expected the request and response to name the same variant, got %q and %q", got, variant)
+	}
+
+	// and keeps it on later visits
+	for i := 0; i < 5; i++ {
+		r := httptest.NewRequest("GET", "/landing/index.html", nil)
+		r.AddCookie(cookies[0])
+		rec := mwtest.Serve(a, r)
+		if len(rec.Result().Cookies()) != 0 {
+			t.Errorf("Visit %d: Expected no new cookie", i)
+		}
+		rec.AssertHeader(t, DefaultHeader, variant)
+
+		expectedPath := "/landing/index.html"
+		if variant == "b" {
+			expectedPath = "/b/landing/index.html"
+		}
+		if got := next.Request().URL.Path; got != expectedPath {
+			t.Errorf("Visit %d: Expected path %s, got %s", i, expectedPath, got)
+		}
+	}
+
+	// other paths aren't part of the test
+	rec = mwtest.Serve(a, httptest.NewRequest("GET", "/other", nil))
+	rec.AssertHeader(t, DefaultHeader, "")
+	if len(rec.Result().Cookies()) != 0 {
+		t.Error("Expected no cookie outside the test")
+	}
+}
+
+func TestAssign(t *testing.T) {
+	test := Test{Path: "/", Variants: []Variant{{Name: "a", Weight: 80}, {Name: "b", Weight: 20}, {Name: "c", Weight: 0}}}
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[test.assign(fmt.Sprintf("visitor%d", i)).Name]++
+	}
+	if counts["a"] < 7500 || counts["a"] > 8500 || counts["c"] != 0 {
+		t.Errorf("Expected about 80%% a, 20%% b and no c, got %v", counts)
+	}
+
+	if test.assign("someone") != test.assign("someone") {
+		t.Error("Expected the same visitor to get the same variant")
+	}
+}
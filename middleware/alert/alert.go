@@ -0,0 +1,193 @@
+// Package alert implements middleware that keeps track of the rate of
+// server errors and the latency of a site's requests, and calls a
+// webhook when either goes over a threshold. It gives small deployments
+// basic alerting without an external monitoring system.
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Alert is middleware that records the status and duration of
+// each request over a sliding window. Every Interval, it checks
+// them against the thresholds, and POSTs an Event to Webhook when
+// the site starts or stops breaching them.
+type Alert struct {
+	Next    middleware.Handler
+	Site    string
+	Webhook string
+
+	// How far back requests are counted, and how often
+	// they are checked against the thresholds
+	Window   time.Duration
+	Interval time.Duration
+
+	// Thresholds; the fraction of responses with a 5xx status,
+	// and the 99th percentile of response times. Zero values
+	// aren't checked.
+	ErrorRate float64
+	P99       time.Duration
+
+	// Fewer requests than this in the window are not
+	// enough to go by, and never breach the thresholds
+	MinRequests int
+
+	mu     sync.Mutex
+	slots  [slotCount]slot
+	firing bool
+	stop   chan struct{}
+}
+
+// Event is the JSON body POSTed to the webhook.
+type Event struct {
+	Site      string    `json:"site"`
+	State     string    `json:"state"` // "firing" or "resolved"
+	Time      time.Time `json:"time"`
+	Window    string    `json:"window"`
+	Requests  int       `json:"requests"`
+	ErrorRate float64   `json:"error_rate"`
+	P99       string    `json:"p99"`
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (a *Alert) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	rec := middleware.NewResponseRecorder(w)
+	start := time.Now()
+
+	status, err := a.Next.ServeHTTP(rec, r)
+
+	written := status
+	if status < 400 {
+		written = rec.Status()
+	}
+	a.record(start, written, time.Since(start))
+
+	return status, err
+}
+
+// Start begins checking the thresholds every Interval. When a
+// site is reloaded, the new configuration's Alert takes over from
+// the old one, which is stopped.
+func (a *Alert) Start() error {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	if old := running[a.Site]; old != nil {
+		old.stopLocked()
+	}
+	running[a.Site] = a
+
+	a.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(a.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				a.check(now)
+			case <-stop:
+				return
+			}
+		}
+	}(a.stop)
+	return nil
+}
+
+// Stop stops checking the thresholds.
+func (a *Alert) Stop() error {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	a.stopLocked()
+	return nil
+}
+
+func (a *Alert) stopLocked() {
+	if a.stop != nil {
+		close(a.stop)
+		a.stop = nil
+	}
+	if running[a.Site] == a {
+		delete(running, a.Site)
+	}
+}
+
+// running holds the Alert checking each site's thresholds.
+var (
+	running   = make(map[string]*Alert)
+	runningMu sync.Mutex
+)
+
+// check compares the requests in the window up to now against the
+// thresholds, and calls the webhook if that changes whether they
+// are breached.
+func (a *Alert) check(now time.Time) {
+	s := a.summary(now)
+	errorRate, p99 := s.errorRate(), s.percentile(0.99)
+
+	breached := s.requests >= a.MinRequests && s.requests > 0 &&
+		(a.ErrorRate > 0 && errorRate > a.ErrorRate || a.P99 > 0 && p99 > a.P99)
+
+	a.mu.Lock()
+	changed := breached != a.firing
+	a.firing = breached
+	a.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	event := Event{
+		Site:      a.Site,
+		State:     "resolved",
+		Time:      now,
+		Window:    a.Window.String(),
+		Requests:  s.requests,
+		ErrorRate: errorRate,
+		P99:       p99.String(),
+	}
+	if breached {
+		event.State = "firing"
+	}
+	if err := a.notify(event); err != nil {
+		log.Printf("[ERROR] alert for %s: %v", a.Site, err)
+	}
+}
+
+// notify POSTs event to the webhook.
+func (a *Alert) notify(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	resp, err := webhookClient.Post(a.Webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return &webhookError{a.Webhook, resp.Status}
+	}
+	return nil
+}
+
+type webhookError struct {
+	url, status string
+}
+
+func (e *webhookError) Error() string {
+	return "webhook " + e.url + " responded " + e.status
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Defaults for the alert directive.
+const (
+	DefaultWindow      = 5 * time.Minute
+	DefaultInterval    = 30 * time.Second
+	DefaultMinRequests = 10
+)
@@ -0,0 +1,108 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestWindow(t *testing.T) {
+	a := &Alert{Window: time.Minute}
+	now := time.Now()
+
+	for i := 0; i < 98; i++ {
+		a.record(now, http.StatusOK, 10*time.Millisecond)
+	}
+	a.record(now, http.StatusBadGateway, 300*time.Millisecond)
+	a.record(now, http.StatusNotFound, 2*time.Second)
+	// too long ago to count
+	a.record(now.Add(-2*time.Minute), http.StatusInternalServerError, time.Minute)
+
+	s := a.summary(now)
+	if s.requests != 100 {
+		t.Errorf("Expected 100 requests in the window, got %d", s.requests)
+	}
+	if rate := s.errorRate(); rate != 0.01 {
+		t.Errorf("Expected error rate 0.01, got %v", rate)
+	}
+	if p := s.percentile(0.99); p < 300*time.Millisecond || p > 400*time.Millisecond {
+		t.Errorf("Expected p99 a little over 300ms, got %v", p)
+	}
+	if p := s.percentile(0.5); p < 10*time.Millisecond || p > 12*time.Millisecond {
+		t.Errorf("Expected p50 a little over 10ms, got %v", p)
+	}
+
+	if s := a.summary(now.Add(2 * time.Minute)); s.requests != 0 {
+		t.Errorf("Expected no requests in a later window, got %d", s.requests)
+	}
+}
+
+func TestAlert(t *testing.T) {
+	events := make(chan Event, 4)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Expected a JSON event, got error: %v", err)
+		}
+		events <- event
+	}))
+	defer hook.Close()
+
+	status := http.StatusOK
+	a := &Alert{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if status >= 500 {
+				w.WriteHeader(status)
+			}
+			return 0, nil
+		}),
+		Site:        "alert_test:80",
+		Webhook:     hook.URL,
+		Window:      time.Minute,
+		ErrorRate:   0.1,
+		MinRequests: 5,
+	}
+	serve := func(n int) {
+		for i := 0; i < n; i++ {
+			r, _ := http.NewRequest("GET", "/", nil)
+			a.ServeHTTP(httptest.NewRecorder(), r)
+		}
+	}
+
+	serve(4)
+	status = http.StatusServiceUnavailable
+	serve(1)
+	a.check(time.Now())
+	select {
+	case event := <-events:
+		if event.State != "firing" || event.Requests != 5 || event.ErrorRate != 0.2 || event.Site != a.Site {
+			t.Errorf("Expected a firing event for 5 requests at 0.2, got %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the webhook to be called")
+	}
+
+	// still breached; no news
+	a.check(time.Now())
+	select {
+	case event := <-events:
+		t.Errorf("Expected no event while still firing, got %+v", event)
+	default:
+	}
+
+	status = http.StatusOK
+	serve(10)
+	a.check(time.Now())
+	select {
+	case event := <-events:
+		if event.State != "resolved" {
+			t.Errorf("Expected a resolved event, got %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the webhook to be called")
+	}
+}
@@ -0,0 +1,122 @@
+package alert
+
+import (
+	"math"
+	"time"
+)
+
+// The window is divided into slotCount slots, which are reused
+// as time moves on. Response times are counted in a histogram
+// with bucketsPerDoubling buckets for every doubling from 1ms.
+const (
+	slotCount          = 60
+	bucketsPerDoubling = 4
+	bucketCount        = 18 * bucketsPerDoubling // up to ~4m
+)
+
+// slot holds the requests that started in one part of the window.
+type slot struct {
+	index    int64 // which slot-sized period since the epoch
+	requests int
+	errors   int
+	buckets  [bucketCount]int
+}
+
+// summary is the sum of the slots in the window.
+type summary struct {
+	requests int
+	errors   int
+	buckets  [bucketCount]int
+}
+
+// errorRate returns the fraction of requests that were server errors.
+func (s summary) errorRate() float64 {
+	if s.requests == 0 {
+		return 0
+	}
+	return float64(s.errors) / float64(s.requests)
+}
+
+// percentile returns the upper bound of the bucket
+// that the p-th fraction of response times fall in.
+func (s summary) percentile(p float64) time.Duration {
+	if s.requests == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p * float64(s.requests)))
+	seen := 0
+	for i, n := range s.buckets {
+		seen += n
+		if seen >= rank {
+			return bucketBound(i)
+		}
+	}
+	return bucketBound(bucketCount - 1)
+}
+
+// bucket returns the histogram bucket that d is counted in.
+func bucket(d time.Duration) int {
+	if d <= time.Millisecond {
+		return 0
+	}
+	i := int(math.Ceil(bucketsPerDoubling * math.Log2(float64(d)/float64(time.Millisecond))))
+	if i >= bucketCount {
+		return bucketCount - 1
+	}
+	return i
+}
+
+// bucketBound returns the longest duration counted in bucket i.
+func bucketBound(i int) time.Duration {
+	bound := float64(time.Millisecond) * math.Exp2(float64(i)/bucketsPerDoubling)
+	return time.Duration(bound).Round(time.Microsecond)
+}
+
+func (a *Alert) slotWidth() int64 {
+	width := int64(a.Window) / slotCount
+	if width < 1 {
+		width = 1
+	}
+	return width
+}
+
+// record counts a request that started at start.
+func (a *Alert) record(start time.Time, status int, d time.Duration) {
+	index := start.UnixNano() / a.slotWidth()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := &a.slots[index%slotCount]
+	if s.index > index {
+		return // its slot has moved on
+	}
+	if s.index != index {
+		*s = slot{index: index}
+	}
+	s.requests++
+	if status >= 500 {
+		s.errors++
+	}
+	s.buckets[bucket(d)]++
+}
+
+// summary sums the slots in the window that ends at now.
+func (a *Alert) summary(now time.Time) summary {
+	current := now.UnixNano() / a.slotWidth()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var sum summary
+	for i := range a.slots {
+		s := &a.slots[i]
+		if s.index <= current-slotCount || s.index > current {
+			continue
+		}
+		sum.requests += s.requests
+		sum.errors += s.errors
+		for b, n := range s.buckets {
+			sum.buckets[b] += n
+		}
+	}
+	return sum
+}
@@ -35,9 +35,7 @@ func (a BasicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 			hasAuth = true
 
 			// Check credentials
-			if !ok ||
-				username != rule.Username ||
-				subtle.ConstantTimeCompare([]byte(password), []byte(rule.Password)) != 1 {
+			if !ok || !rule.match(username, password) {
 				continue
 			}
 
@@ -60,10 +58,30 @@ func (a BasicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 }
 
 // Rule represents a BasicAuth rule. A username and password
-// combination protect the associated resources, which are
-// file or directory paths.
+// combination, or the users of an htpasswd file, protect the
+// associated resources, which are file or directory paths.
 type Rule struct {
 	Username  string
 	Password  string
+	Htpasswd  *Htpasswd
 	Resources []string
 }
+
+// match returns true if username and password are those
+// of the rule.
+func (rule Rule) match(username, password string) bool {
+	if rule.Htpasswd != nil {
+		return rule.Htpasswd.Match(username, password)
+	}
+	return username == rule.Username &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(rule.Password)) == 1
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (a BasicAuth) Scopes() []string {
+	var scopes []string
+	for _, rule := range a.Rules {
+		scopes = append(scopes, rule.Resources...)
+	}
+	return scopes
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/mholt/caddy/middleware"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestBasicAuth(t *testing.T) {
@@ -108,6 +111,89 @@ func TestMultipleOverlappingRules(t *testing.T) {
 }
 
 func contentHandler(w http.ResponseWriter, r *http.Request) (int, error) {
-	fmt.Fprintf(w, r.URL.String())
+	fmt.Fprint(w, r.URL.String())
 	return http.StatusOK, nil
 }
+
+func TestHtpasswd(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("bpass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), ".htpasswd")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("# users\nbob:" + string(bcryptHash) + "\n\nalice:$apr1$r31ManRI$R2oj3QbIYnb6oudoIg5nT0\n")
+
+	htpasswd, err := NewHtpasswd(path)
+	if err != nil {
+		t.Fatalf("Expected no error loading the file, got: %v", err)
+	}
+	rw := BasicAuth{
+		Next:  middleware.HandlerFunc(contentHandler),
+		Rules: []Rule{{Htpasswd: htpasswd, Resources: []string{"/private"}}},
+	}
+	check := func(i int, cred string, expected int) {
+		req, err := http.NewRequest("GET", "/private", nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request %v", i, err)
+		}
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(cred)))
+		result, _ := rw.ServeHTTP(httptest.NewRecorder(), req)
+		if result != expected {
+			t.Errorf("Test %d: Expected status %d for %s, got %d", i, expected, cred, result)
+		}
+	}
+
+	check(0, "bob:bpass", http.StatusOK)
+	check(1, "alice:password", http.StatusOK)
+	check(2, "alice:bpass", http.StatusUnauthorized)
+	check(3, "carol:password", http.StatusUnauthorized)
+
+	// the file is read again once it changes
+	write("carol:$apr1$r31ManRI$R2oj3QbIYnb6oudoIg5nT0\n")
+	check(4, "carol:password", http.StatusOK)
+	check(5, "alice:password", http.StatusUnauthorized)
+
+	// but the last good credentials are kept if it breaks
+	write("carol\n")
+	check(6, "carol:password", http.StatusOK)
+}
+
+func TestParseHtpasswd(t *testing.T) {
+	for i, test := range []struct {
+		content   string
+		shouldErr bool
+	}{
+		{"user:$apr1$r31ManRI$R2oj3QbIYnb6oudoIg5nT0", false},
+		{"user:$2y$05$abcdefghijklmnopqrstuv", false},
+		{"", false},
+		{"user", true},
+		{":$apr1$r31ManRI$R2oj3QbIYnb6oudoIg5nT0", true},
+		{"user:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", true},
+		{"user:plaintext", true},
+	} {
+		_, err := parseHtpasswd([]byte(test.content))
+		if test.shouldErr && err == nil {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if !test.shouldErr && err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+	}
+}
+
+func TestApr1(t *testing.T) {
+	for i, test := range []struct {
+		password, salt, expected string
+	}{
+		{"password", "r31ManRI", "$apr1$r31ManRI$R2oj3QbIYnb6oudoIg5nT0"},
+		{"a much longer password than sixteen", "abcdefgh", "$apr1$abcdefgh$CWmSdRXg6.q2WlUC6/oKv1"},
+	} {
+		if actual := apr1(test.password, test.salt); actual != test.expected {
+			t.Errorf("Test %d: Expected %s, got %s", i, test.expected, actual)
+		}
+	}
+}
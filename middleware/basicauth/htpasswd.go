@@ -0,0 +1,193 @@
+package basicauth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Htpasswd holds the credentials of an htpasswd file, whose
+// passwords are hashed with bcrypt or Apache's MD5 scheme.
+// The file is read again when it changes, so users can be
+// added or removed without restarting the server.
+type Htpasswd struct {
+	Path string
+
+	mu      sync.Mutex
+	size    int64
+	modTime time.Time
+	users   map[string]string // username to hash
+}
+
+// NewHtpasswd reads the htpasswd file at path.
+func NewHtpasswd(path string) (*Htpasswd, error) {
+	h := &Htpasswd{Path: path}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.load(info); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Match returns true if password is the password of username
+// in the file.
+func (h *Htpasswd) Match(username, password string) bool {
+	h.mu.Lock()
+	if info, err := os.Stat(h.Path); err != nil {
+		log.Printf("[ERROR] htpasswd: %v", err)
+	} else if info.Size() != h.size || !info.ModTime().Equal(h.modTime) {
+		// keep the old credentials if the new ones are no good
+		if err := h.load(info); err != nil {
+			log.Printf("[ERROR] htpasswd: %v", err)
+		}
+	}
+	hash, ok := h.users[username]
+	h.mu.Unlock()
+
+	return ok && MatchHash(hash, password)
+}
+
+// load reads the file, whose size and modification time are
+// those of info.
+func (h *Htpasswd) load(info os.FileInfo) error {
+	body, err := os.ReadFile(h.Path)
+	if err != nil {
+		return err
+	}
+	users, err := parseHtpasswd(body)
+	if err != nil {
+		return fmt.Errorf("%s:%v", h.Path, err)
+	}
+	h.users, h.size, h.modTime = users, info.Size(), info.ModTime()
+	return nil
+}
+
+// parseHtpasswd parses lines of username:hash, skipping
+// blank lines and comments.
+func parseHtpasswd(body []byte) (map[string]string, error) {
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("%d: expected username:hash", n)
+		}
+		hash := line[i+1:]
+		if !SupportedHash(hash) {
+			return nil, fmt.Errorf("%d: unsupported hash for %s; use bcrypt or MD5", n, line[:i])
+		}
+		users[line[:i]] = hash
+	}
+	return users, scanner.Err()
+}
+
+// SupportedHash returns true if hash is of a scheme that
+// MatchHash knows: bcrypt or Apache's MD5 scheme.
+func SupportedHash(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$", apr1Prefix} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchHash returns true if password hashes to hash.
+func MatchHash(hash, password string) bool {
+	if strings.HasPrefix(hash, apr1Prefix) {
+		salt := strings.TrimPrefix(hash, apr1Prefix)
+		if i := strings.Index(salt, "$"); i >= 0 {
+			salt = salt[:i]
+		}
+		return subtle.ConstantTimeCompare([]byte(apr1(password, salt)), []byte(hash)) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+const apr1Prefix = "$apr1$"
+
+// apr1 hashes password with salt in Apache's variant of
+// the MD5-based crypt scheme, which htpasswd uses by default.
+func apr1(password, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	d := md5.New()
+	d.Write(pw)
+	d.Write([]byte(apr1Prefix + salt))
+	for i := len(pw); i > 0; i -= 16 {
+		if i > 16 {
+			d.Write(altSum)
+		} else {
+			d.Write(altSum[:i])
+		}
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(pw[:1])
+		}
+	}
+	sum := d.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		d := md5.New()
+		if i&1 == 1 {
+			d.Write(pw)
+		} else {
+			d.Write(sum)
+		}
+		if i%3 != 0 {
+			d.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			d.Write(pw)
+		}
+		if i&1 == 1 {
+			d.Write(sum)
+		} else {
+			d.Write(pw)
+		}
+		sum = d.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var out []byte
+	encode := func(v uint, n int) {
+		for ; n > 0; n-- {
+			out = append(out, itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint(sum[g[0]])<<16|uint(sum[g[1]])<<8|uint(sum[g[2]]), 4)
+	}
+	encode(uint(sum[11]), 2)
+
+	return apr1Prefix + salt + "$" + string(out)
+}
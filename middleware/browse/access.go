@@ -0,0 +1,297 @@
+package browse
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/config/parse"
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/basicauth"
+)
+
+// DefaultAccessFile is the name of the per-directory access
+// policy file that is read if the config doesn't name another.
+const DefaultAccessFile = ".caddy-access"
+
+// AccessPolicy restricts browsing of a directory and everything
+// below it. Policies are read from access files, which look like:
+//
+//	listing off
+//	hide *.bak drafts
+//	realm "Members only"
+//	user bob $2a$04$u0Pamz5VQ4w6TLqLgwItq.3XQEiYkcWnbt1q8mdsybNMYpjfI/6B2
+//
+// A policy applies to the directory that contains the access file
+// and all of its subdirectories. Policies found deeper in the tree
+// are merged with those above them: listing can only be turned off,
+// hidden patterns accumulate, and the deepest set of users wins.
+// Everything under a hidden entry is hidden too.
+//
+// Passwords are given hashed, as htpasswd makes them with bcrypt
+// (htpasswd -nB) or Apache's MD5 scheme.
+type AccessPolicy struct {
+	// Whether directory listings are disabled
+	NoListing bool
+
+	// Patterns (as in path.Match) of entry names to hide
+	Hide []string
+
+	// The realm to use when asking for credentials
+	Realm string
+
+	// Map of username to password hash; if not empty,
+	// clients must authenticate as one of these users
+	Users map[string]string
+}
+
+// hides returns true if the entry named name should be hidden.
+func (p AccessPolicy) hides(name string) bool {
+	for _, pattern := range p.Hide {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// authorized returns true if the request carries
+// credentials for one of the policy's users, or if
+// the policy doesn't require any.
+func (p AccessPolicy) authorized(r *http.Request) bool {
+	if len(p.Users) == 0 {
+		return true
+	}
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	hash, ok := p.Users[username]
+	return ok && basicauth.MatchHash(hash, password)
+}
+
+// challenge sets the header that asks the client to authenticate
+// and returns the status code to go with it.
+func (p AccessPolicy) challenge(w http.ResponseWriter) int {
+	realm := p.Realm
+	if realm == "" {
+		realm = "Restricted"
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+strings.Replace(realm, `"`, "", -1)+`"`)
+	return http.StatusUnauthorized
+}
+
+// merge adds q, the policy of a directory below that of p, to p.
+func (p *AccessPolicy) merge(q AccessPolicy) {
+	p.NoListing = p.NoListing || q.NoListing
+	p.Hide = append(p.Hide, q.Hide...)
+	if q.Realm != "" {
+		p.Realm = q.Realm
+	}
+	if q.Users != nil {
+		p.Users = q.Users
+	}
+}
+
+// Guard returns middleware that enforces the access policies of b
+// ahead of next. It goes first in the chain of the site, so that the
+// files the policies protect can't be served by other middleware
+// that comes before b.
+func (b Browse) Guard(next middleware.Handler) middleware.Handler {
+	return accessGuard{b: b, next: next}
+}
+
+type accessGuard struct {
+	b    Browse
+	next middleware.Handler
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (g accessGuard) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if status, err := g.b.checkAccess(w, r); status != 0 {
+		return status, err
+	}
+	upath := path.Clean("/" + r.URL.Path)
+	return g.next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), accessCheckedKey{}, upath)))
+}
+
+// accessCheckedKey is the context key of the path whose
+// access the guard checked, so b doesn't check it again
+// unless the path was rewritten since.
+type accessCheckedKey struct{}
+
+// checkAccess enforces the access policy that applies to the
+// request, if any, and returns the status to respond with if the
+// request is refused, or 0 if it may go on.
+func (b Browse) checkAccess(w http.ResponseWriter, r *http.Request) (int, error) {
+	upath := path.Clean("/" + r.URL.Path)
+	if checked, _ := r.Context().Value(accessCheckedKey{}).(string); checked == upath {
+		return 0, nil
+	}
+	bc := b.fileConfig(upath)
+	if bc == nil || bc.AccessFile == "" {
+		return 0, nil
+	}
+	if strings.EqualFold(path.Base(upath), bc.AccessFile) {
+		return http.StatusNotFound, nil
+	}
+
+	info, err := b.stat(upath)
+	isDir := err == nil && info.IsDir()
+	policy, hidden, err := b.accessPolicy(upath, isDir, bc.AccessFile)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !policy.authorized(r) {
+		return policy.challenge(w), nil
+	}
+	if hidden {
+		return http.StatusNotFound, nil
+	}
+	return 0, nil
+}
+
+// accessPolicy returns the policy that applies to urlPath, which
+// is a directory if isDir is true: the access files named fileName
+// from the top of the site down to it, merged in that order, where
+// directories without an access file are skipped. hidden is true if
+// urlPath, or any directory on the way to it, is hidden by the
+// policy of the directory that contains it.
+func (b Browse) accessPolicy(urlPath string, isDir bool, fileName string) (policy AccessPolicy, hidden bool, err error) {
+	var names []string
+	if clean := strings.Trim(path.Clean("/"+urlPath), "/"); clean != "" {
+		names = strings.Split(clean, "/")
+	}
+	depth := len(names)
+	if !isDir && depth > 0 {
+		depth--
+	}
+
+	dir := "/"
+	for i := 0; i <= depth; i++ {
+		p, err := b.accessFile(path.Join(dir, fileName))
+		if err != nil {
+			return policy, hidden, err
+		}
+		policy.merge(p)
+		if i < len(names) {
+			hidden = hidden || policy.hides(names[i])
+			dir = path.Join(dir, names[i])
+		}
+	}
+	return policy, hidden, nil
+}
+
+// accessCache holds the policies of the access files that have
+// been read, by their path on disk, so that each is only read and
+// parsed again once it changes.
+var accessCache = struct {
+	sync.Mutex
+	files map[string]accessCacheEntry
+}{files: make(map[string]accessCacheEntry)}
+
+type accessCacheEntry struct {
+	size    int64
+	modTime time.Time
+	policy  AccessPolicy
+}
+
+// accessFile returns the policy of the access file at urlPath,
+// or an empty policy if there is none.
+func (b Browse) accessFile(urlPath string) (AccessPolicy, error) {
+	key := filepath.Join(b.Root, filepath.FromSlash(urlPath))
+
+	f, err := b.fileSystem().Open(urlPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			accessCache.Lock()
+			delete(accessCache.files, key)
+			accessCache.Unlock()
+			return AccessPolicy{}, nil
+		}
+		return AccessPolicy{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return AccessPolicy{}, err
+	}
+
+	accessCache.Lock()
+	entry, ok := accessCache.files[key]
+	accessCache.Unlock()
+	if ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return entry.policy, nil
+	}
+
+	var policy AccessPolicy
+	if err := policy.load(parse.NewDispenser(urlPath, f)); err != nil {
+		return AccessPolicy{}, err
+	}
+
+	accessCache.Lock()
+	accessCache.files[key] = accessCacheEntry{size: info.Size(), modTime: info.ModTime(), policy: policy}
+	accessCache.Unlock()
+
+	return policy, nil
+}
+
+// load reads the policy given by the tokens in d into p.
+func (p *AccessPolicy) load(d parse.Dispenser) error {
+	for d.Next() {
+		switch d.Val() {
+		case "listing":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			switch d.Val() {
+			case "off":
+				p.NoListing = true
+			case "on":
+				// listing can't be re-enabled below a parent that disabled it
+			default:
+				return d.Errf("Expected 'on' or 'off', got '%s'", d.Val())
+			}
+		case "hide":
+			patterns := d.RemainingArgs()
+			if len(patterns) == 0 {
+				return d.ArgErr()
+			}
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return d.Errf("Bad hide pattern '%s': %v", pattern, err)
+				}
+			}
+			p.Hide = append(p.Hide, patterns...)
+		case "realm":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			p.Realm = d.Val()
+		case "user":
+			var username, hash string
+			if !d.Args(&username, &hash) {
+				return d.ArgErr()
+			}
+			if !basicauth.SupportedHash(hash) {
+				return d.Errf("Password of user '%s' must be hashed with bcrypt or MD5, as by htpasswd", username)
+			}
+			if p.Users == nil {
+				p.Users = make(map[string]string)
+			}
+			p.Users[username] = hash
+		default:
+			return d.Errf("Unknown access property '%s'", d.Val())
+		}
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+	}
+
+	return nil
+}
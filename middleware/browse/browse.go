@@ -11,11 +11,13 @@ import (
 	"os"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/dustin/go-humanize"
 	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/i18n"
+	"github.com/mholt/caddy/middleware/metadata"
 )
 
 // Browse is an http.Handler that can show a file listing when
@@ -24,14 +26,83 @@ type Browse struct {
 	Next    middleware.Handler
 	Root    string
 	Configs []Config
+
+	// The file system the files under Root are read
+	// through; http.Dir(Root) if nil
+	FileSys http.FileSystem
+	Hide    []string // list of files to treat as "Not Found"
+
+	// Translations of listings, which are given to
+	// templates in the language the client prefers
+	Locales *i18n.Catalog
+
+	// Name of the sidecar files that annotate listings
+	// (see package metadata); none are read if empty
+	MetadataFile string
+
+	// Patterns of paths that are left out of listings and
+	// not browsable (see middleware.HiddenPath)
+	HidePatterns []string
+
+	// Names of the files that make a directory not browsable,
+	// since they are served for it; IndexPages if empty
+	IndexPages []string
 }
 
 // Config is a configuration for browsing in a particular path.
 type Config struct {
 	PathScope string
 	Template  *template.Template
+
+	// Whether directories are listed before files,
+	// whatever the sort order
+	DirsFirst bool
+
+	// Whether names are sorted with numbers in them
+	// compared by value, so "file2" comes before "file10"
+	NaturalSort bool
+
+	// Whether the sizes of directories in listings are
+	// the total size of everything in them, and how deep
+	// (0 for no limit) and how long to look when adding
+	// it up; zero DirSizeTimeout means DefaultDirSizeTimeout
+	DirSizes       bool
+	DirSizeDepth   int
+	DirSizeTimeout time.Duration
+
+	// Whether files in this path may be rendered inline
+	// when requested with the "preview" query parameter
+	Preview bool
+
+	// Files larger than this (in bytes) are not rendered
+	// inline; zero means DefaultPreviewMaxSize
+	PreviewMaxSize int64
+
+	// Checksum algorithms to show in listings and to serve
+	// with the "checksum" query parameter (see Checksums)
+	Checksums []string
+
+	// Name of the per-directory access policy file to
+	// honor; empty if access files are not used
+	AccessFile string
+
+	// How sizes and times are shown in listings
+	Format Format
+
+	// How many items are listed on a page unless the request
+	// asks for another number with the "limit" query parameter;
+	// zero means DefaultPageSize
+	PageSize int
 }
 
+// DefaultPageSize is how many items a page of a listing has
+// unless configured otherwise.
+const DefaultPageSize = 1000
+
+// MaxPageSize is the most items a request may ask to have
+// on a page of a listing.
+const MaxPageSize = 10000
+
 // A Listing is used to fill out a template.
 type Listing struct {
 	// The name of the directory (the last element of the path)
@@ -40,27 +111,183 @@ type Listing struct {
 	// The full path of the request
 	Path string
 
+	// Links to the path and each directory above it,
+	// starting with the root
+	Breadcrumbs []Breadcrumb
+
 	// Whether the parent directory is browsable
 	CanGoUp bool
 
 	// The items (files and folders) in the path
 	Items []FileInfo
 
+	// How many of the items are directories and files,
+	// and the total size of the files in bytes
+	NumDirs   int
+	NumFiles  int
+	TotalSize int64
+
 	// Which sorting order is used
 	Sort string
 
 	// And which order
 	Order string
+
+	// Which page of the items is listed, counting from 1,
+	// of how many, with at most Limit items per page
+	Page     int
+	NumPages int
+	Limit    int
+
+	// Whether files in this listing can be previewed
+	Preview bool
+
+	// How sizes and times are shown, for templates
+	// that format them in their own way
+	Format Format
+
+	// The locale of the client's language, like "de",
+	// which T translates messages into
+	Locale string
+
+	// What the directory's sidecar file says about itself
+	Metadata metadata.Entry
+
+	tr          i18n.Translator
+	dirsFirst   bool // see Config.DirsFirst
+	naturalSort bool // see Config.NaturalSort
+	pageSize    int  // the configured page size, which page URLs leave out
+}
+
+// T returns the message for key in the client's language,
+// formatted with args if there are any, like
+// {{.T "browse.page" .Page .NumPages}}.
+func (l Listing) T(key string, args ...interface{}) string {
+	return l.tr.T(key, args...)
+}
+
+// SortURL returns the query string that sorts the listing by
+// field ("name", "size" or "time"): in ascending order, unless
+// it is sorted that way already, in which case the order is
+// reversed. It starts over at the first page.
+func (l Listing) SortURL(field string) string {
+	order := "asc"
+	if l.Sort == field && l.Order == "asc" {
+		order = "desc"
+	}
+	return l.query(field, order, 1)
+}
+
+// PageURL returns the query string of page number
+// page of the listing, sorted the same way.
+func (l Listing) PageURL(page int) string {
+	return l.query(l.Sort, l.Order, page)
+}
+
+// HasPrev returns true if there is a page before this one.
+func (l Listing) HasPrev() bool { return l.Page > 1 }
+
+// HasNext returns true if there is a page after this one.
+func (l Listing) HasNext() bool { return l.Page < l.NumPages }
+
+// PrevPage returns the number of the page before this one.
+func (l Listing) PrevPage() int { return l.Page - 1 }
+
+// NextPage returns the number of the page after this one.
+func (l Listing) NextPage() int { return l.Page + 1 }
+
+// query returns the query string for the listing sorted by
+// field in order, at page.
+func (l Listing) query(field, order string, page int) string {
+	q := "?sort=" + url.QueryEscape(field) + "&order=" + url.QueryEscape(order)
+	if page > 1 {
+		q += "&page=" + strconv.Itoa(page)
+	}
+	if l.Limit != l.pageSize {
+		q += "&limit=" + strconv.Itoa(l.Limit)
+	}
+	return q
+}
+
+// paginate cuts the items of the listing down to the page asked
+// for, with at most limit items on it (the configured page size
+// if 0). Pages past the end show the last page.
+func (l *Listing) paginate(page, limit int) {
+	if limit <= 0 {
+		limit = l.pageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	l.Limit = limit
+
+	l.NumPages = (len(l.Items) + limit - 1) / limit
+	if l.NumPages == 0 {
+		l.NumPages = 1
+	}
+	if page < 1 {
+		page = 1
+	}
+	if page > l.NumPages {
+		page = l.NumPages
+	}
+	l.Page = page
+
+	start := (page - 1) * limit
+	end := start + limit
+	if end > len(l.Items) {
+		end = len(l.Items)
+	}
+	l.Items = l.Items[start:end]
+}
+
+// HumanTotalSize returns the total size of the files
+// in the listing as a human-readable string.
+func (l Listing) HumanTotalSize() string {
+	return l.Format.Size(l.TotalSize)
+}
+
+// Breadcrumb links to one of the directories in a listing's path.
+type Breadcrumb struct {
+	Name string // the directory's name, or "/" for the root
+	URL  string // the escaped path of the directory, ending in "/"
+}
+
+// breadcrumbs returns the breadcrumbs for urlPath.
+func breadcrumbs(urlPath string) []Breadcrumb {
+	crumbs := []Breadcrumb{{Name: "/", URL: "/"}}
+	dir := "/"
+	for _, name := range strings.Split(strings.Trim(urlPath, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		dir += name + "/"
+		u := url.URL{Path: dir}
+		crumbs = append(crumbs, Breadcrumb{Name: name, URL: u.String()})
+	}
+	return crumbs
 }
 
 // FileInfo is the info about a particular file or directory
 type FileInfo struct {
-	IsDir   bool
-	Name    string
-	Size    int64
-	URL     string
-	ModTime time.Time
-	Mode    os.FileMode
+	IsDir     bool
+	Name      string
+	Size      int64
+	URL       string
+	ModTime   time.Time
+	Mode      os.FileMode
+	Checksums map[string]string // algorithm name to hex digest
+
+	// What the directory's sidecar file says about it
+	Metadata metadata.Entry
+
+	// For a directory whose size was added up, whether
+	// the size is only part of it because there was too
+	// much to look through
+	Partial bool
+
+	format Format
+	info   os.FileInfo
 }
 
 // Implement sorting for Listing
@@ -74,6 +301,9 @@ func (l byName) Swap(i, j int) { l.Items[i], l.Items[j] = l.Items[j], l.Items[i]
 
 // Treat upper and lower case equally
 func (l byName) Less(i, j int) bool {
+	if l.naturalSort {
+		return naturalLess(strings.ToLower(l.Items[i].Name), strings.ToLower(l.Items[j].Name))
+	}
 	return strings.ToLower(l.Items[i].Name) < strings.ToLower(l.Items[j].Name)
 }
 
@@ -88,8 +318,29 @@ func (l byTime) Swap(i, j int)      { l.Items[i], l.Items[j] = l.Items[j], l.Ite
 func (l byTime) Less(i, j int) bool { return l.Items[i].ModTime.Before(l.Items[j].ModTime) }
 
 // Add sorting method to "Listing"
-// it will apply what's in ".Sort" and ".Order"
+// it will apply what's in ".Sort" and ".Order",
+// then move directories first if configured to
 func (l Listing) applySort() {
+	l.sortItems()
+	if l.dirsFirst {
+		sort.SliceStable(l.Items, func(i, j int) bool {
+			return l.Items[i].IsDir && !l.Items[j].IsDir
+		})
+	}
+}
+
+// validSort returns true if field and order are
+// a way that listings can be sorted.
+func validSort(field, order string) bool {
+	switch field {
+	case "name", "size", "time":
+	default:
+		return false
+	}
+	return order == "asc" || order == "desc"
+}
+
+func (l Listing) sortItems() {
 	// Check '.Order' to know how to sort
 	if l.Order == "desc" {
 		switch l.Sort {
@@ -118,14 +369,33 @@ func (l Listing) applySort() {
 	}
 }
 
-// HumanSize returns the size of the file as a human-readable string.
+// annotate sets the metadata of l and its items from entries.
+func (l *Listing) annotate(entries metadata.Dir) {
+	l.Metadata = entries["."]
+	for i, item := range l.Items {
+		l.Items[i].Metadata = entries[item.Name]
+	}
+}
+
+// HumanSize returns the size of the file as a human-readable
+// string, in the units the listing is configured with. A "+"
+// is added to the partial size of a directory.
 func (fi FileInfo) HumanSize() string {
-	return humanize.Bytes(uint64(fi.Size))
+	if fi.Partial {
+		return fi.format.Size(fi.Size) + "+"
+	}
+	return fi.format.Size(fi.Size)
 }
 
-// HumanModTime returns the modified time of the file as a human-readable string.
-func (fi FileInfo) HumanModTime(format string) string {
-	return fi.ModTime.Format(format)
+// HumanModTime returns the modified time of the file as a
+// human-readable string in the listing's time zone. The
+// layout is format if given, or else the configured one.
+func (fi FileInfo) HumanModTime(format ...string) string {
+	var layout string
+	if len(format) > 0 {
+		layout = format[0]
+	}
+	return fi.format.ModTime(fi.ModTime, layout)
 }
 
 var IndexPages = []string{
@@ -137,13 +407,15 @@ var IndexPages = []string{
 	"default.txt",
 }
 
-func directoryListing(files []os.FileInfo, urlPath string, canGoUp bool) (Listing, error) {
+func directoryListing(files []os.FileInfo, indexPages []string, urlPath string, canGoUp bool, format Format) (Listing, error) {
 	var fileinfos []FileInfo
+	var numDirs, numFiles int
+	var totalSize int64
 	for _, f := range files {
 		name := f.Name()
 
 		// Directory is not browsable if it contains index file
-		for _, indexName := range IndexPages {
+		for _, indexName := range indexPages {
 			if name == indexName {
 				return Listing{}, errors.New("Directory contains index file, not browsable!")
 			}
@@ -151,6 +423,10 @@ func directoryListing(files []os.FileInfo, urlPath string, canGoUp bool) (Listin
 
 		if f.IsDir() {
 			name += "/"
+			numDirs++
+		} else {
+			numFiles++
+			totalSize += f.Size()
 		}
 
 		url := url.URL{Path: name}
@@ -162,27 +438,93 @@ func directoryListing(files []os.FileInfo, urlPath string, canGoUp bool) (Listin
 			URL:     url.String(),
 			ModTime: f.ModTime(),
 			Mode:    f.Mode(),
+			format:  format,
+			info:    f,
 		})
 	}
 
 	return Listing{
-		Name:    path.Base(urlPath),
-		Path:    urlPath,
-		CanGoUp: canGoUp,
-		Items:   fileinfos,
+		Name:        path.Base(urlPath),
+		Path:        urlPath,
+		Breadcrumbs: breadcrumbs(urlPath),
+		CanGoUp:     canGoUp,
+		Items:       fileinfos,
+		NumDirs:     numDirs,
+		NumFiles:    numFiles,
+		TotalSize:   totalSize,
+		Format:      format,
 	}, nil
 }
 
+// fileConfig returns the first config whose path scope
+// matches urlPath, or nil if there is none.
+func (b Browse) fileConfig(urlPath string) *Config {
+	for i := range b.Configs {
+		if middleware.Path(urlPath).Matches(b.Configs[i].PathScope) {
+			return &b.Configs[i]
+		}
+	}
+	return nil
+}
+
+// fileSystem returns the file system that b reads files from.
+func (b Browse) fileSystem() http.FileSystem {
+	if b.FileSys != nil {
+		return b.FileSys
+	}
+	return http.Dir(b.Root)
+}
+
+// stat returns information about the file at urlPath.
+func (b Browse) stat(urlPath string) (os.FileInfo, error) {
+	f, err := b.fileSystem().Open(urlPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// isHidden returns true if the file named name
+// should be treated as though it does not exist.
+func (b Browse) isHidden(name string) bool {
+	for _, hiddenPath := range b.Hide {
+		// Case-insensitive comparison, same as the file server
+		if strings.EqualFold(name, path.Base(hiddenPath)) {
+			return true
+		}
+	}
+	return false
+}
+
 // ServeHTTP implements the middleware.Handler interface.
 func (b Browse) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
-	filename := b.Root + r.URL.Path
+	// The file server treats hidden paths as not found
+	if middleware.HiddenPath(b.HidePatterns, path.Clean(r.URL.Path)) {
+		return b.Next.ServeHTTP(w, r)
+	}
 
-	info, err := os.Stat(filename)
+	// The guard in front of the chain checked the path, but
+	// it may have been rewritten since
+	if status, err := b.checkAccess(w, r); status != 0 {
+		return status, err
+	}
+
+	info, err := b.stat(r.URL.Path)
 	if err != nil {
 		return b.Next.ServeHTTP(w, r)
 	}
 
 	if !info.IsDir() {
+		if bc := b.fileConfig(r.URL.Path); bc != nil {
+			query := r.URL.Query()
+			if _, ok := query["preview"]; ok && bc.Preview {
+				return b.servePreview(w, r, *bc)
+			}
+			if algo := query.Get("checksum"); algo != "" && bc.hasChecksum(algo) {
+				return b.serveChecksum(w, r, algo)
+			}
+		}
 		return b.Next.ServeHTTP(w, r)
 	}
 
@@ -199,8 +541,25 @@ func (b Browse) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 			return 0, nil
 		}
 
+		// Apply the access policy for this directory, if enabled;
+		// checkAccess already refused the request if it must be
+		var policy AccessPolicy
+		if bc.AccessFile != "" {
+			policy, _, err = b.accessPolicy(r.URL.Path, true, bc.AccessFile)
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
+			if policy.NoListing {
+				continue
+			}
+			policy.Hide = append(policy.Hide, bc.AccessFile)
+		}
+		if b.MetadataFile != "" {
+			policy.Hide = append(policy.Hide, b.MetadataFile)
+		}
+
 		// Load directory contents
-		file, err := os.Open(b.Root + r.URL.Path)
+		file, err := b.fileSystem().Open(r.URL.Path)
 		if err != nil {
 			if os.IsPermission(err) {
 				return http.StatusForbidden, err
@@ -214,6 +573,16 @@ func (b Browse) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 			return http.StatusForbidden, err
 		}
 
+		if len(policy.Hide) > 0 || len(b.HidePatterns) > 0 {
+			visible := files[:0]
+			for _, f := range files {
+				if !policy.hides(f.Name()) && !middleware.HiddenPath(b.HidePatterns, path.Join(r.URL.Path, f.Name())) {
+					visible = append(visible, f)
+				}
+			}
+			files = visible
+		}
+
 		// Determine if user can browse up another folder
 		var canGoUp bool
 		curPath := strings.TrimSuffix(r.URL.Path, "/")
@@ -224,13 +593,48 @@ func (b Browse) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 			}
 		}
 		// Assemble listing of directory contents
-		listing, err := directoryListing(files, r.URL.Path, canGoUp)
+		indexPages := b.IndexPages
+		if len(indexPages) == 0 {
+			indexPages = IndexPages
+		}
+		listing, err := directoryListing(files, indexPages, r.URL.Path, canGoUp, bc.Format)
 		if err != nil { // directory isn't browsable
 			continue
 		}
 
+		if b.MetadataFile != "" {
+			entries, err := metadata.Load(b.fileSystem(), r.URL.Path, b.MetadataFile)
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
+			listing.annotate(entries)
+		}
+
+		listing.Preview = bc.Preview
+		listing.tr = b.Locales.Translator(r)
+		listing.Locale = listing.tr.Locale
+		listing.dirsFirst = bc.DirsFirst
+		listing.naturalSort = bc.NaturalSort
+
+		if bc.DirSizes {
+			timeout := bc.DirSizeTimeout
+			if timeout == 0 {
+				timeout = DefaultDirSizeTimeout
+			}
+			deadline := time.Now().Add(timeout)
+			for i, f := range files {
+				if !f.IsDir() {
+					continue
+				}
+				size, complete := b.dirSize(path.Join(r.URL.Path, f.Name()), bc.DirSizeDepth, deadline)
+				listing.Items[i].Size = size
+				listing.Items[i].Partial = !complete
+			}
+		}
+
 		// Get the query vales and store them in the Listing struct
-		listing.Sort, listing.Order = r.URL.Query().Get("sort"), r.URL.Query().Get("order")
+		query := r.URL.Query()
+		listing.Sort, listing.Order = query.Get("sort"), query.Get("order")
 
 		// If the query 'sort' or 'order' is empty, check the cookies
 		if listing.Sort == "" || listing.Order == "" {
@@ -246,20 +650,55 @@ func (b Browse) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 				listing.Order = orderCookie.Value
 			}
 
-		} else { // save the query value of 'sort' and 'order' as cookies
+		} else if validSort(listing.Sort, listing.Order) { // save the query value of 'sort' and 'order' as cookies
 			http.SetCookie(w, &http.Cookie{Name: "sort", Value: listing.Sort, Path: "/"})
 			http.SetCookie(w, &http.Cookie{Name: "order", Value: listing.Order, Path: "/"})
 		}
 
+		// Don't let a bad value make links that don't sort
+		if !validSort(listing.Sort, listing.Order) {
+			listing.Sort, listing.Order = "name", "asc"
+		}
+
 		// Apply the sorting
 		listing.applySort()
 
+		// Then list only the page asked for
+		listing.pageSize = bc.PageSize
+		if listing.pageSize == 0 {
+			listing.pageSize = DefaultPageSize
+		}
+		page, _ := strconv.Atoi(query.Get("page"))
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		listing.paginate(page, limit)
+
+		// Checksums are only worked out for the files shown
+		if len(bc.Checksums) > 0 {
+			for i, item := range listing.Items {
+				if item.IsDir {
+					continue
+				}
+				listing.Items[i].Checksums = make(map[string]string)
+				for _, algo := range bc.Checksums {
+					sum, err := b.fileChecksum(path.Join(r.URL.Path, item.info.Name()), algo, item.info)
+					if os.IsNotExist(err) {
+						break // a link that can't be followed
+					}
+					if err != nil {
+						return http.StatusInternalServerError, err
+					}
+					listing.Items[i].Checksums[algo] = sum
+				}
+			}
+		}
+
 		var buf bytes.Buffer
 		err = bc.Template.Execute(&buf, listing)
 		if err != nil {
 			return http.StatusInternalServerError, err
 		}
 
+		listing.tr.SetHeaders(w.Header())
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		buf.WriteTo(w)
 
@@ -269,3 +708,12 @@ func (b Browse) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	// Didn't qualify; pass-thru
 	return b.Next.ServeHTTP(w, r)
 }
+
+// Scopes implements the middleware.Scoped interface.
+func (b Browse) Scopes() []string {
+	scopes := make([]string, len(b.Configs))
+	for i, bc := range b.Configs {
+		scopes[i] = bc.PathScope
+	}
+	return scopes
+}
@@ -1,9 +1,20 @@
 package browse
 
 import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/i18n"
 )
 
 // "sort" package has "IsSorted" function, but no "IsReversed";
@@ -94,3 +105,760 @@ func TestSort(t *testing.T) {
 		t.Errorf("The listing isn't reversed by time: %v", listing.Items)
 	}
 }
+
+func TestPreview(t *testing.T) {
+	root, err := ioutil.TempDir("", "browse_preview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"notes.txt": "<script>alert(1)</script>",
+		"readme.md": "# Hello\n\n<b>raw</b>",
+		"Caddyfile": "secret",
+		"big.txt":   strings.Repeat("a", 100),
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := Browse{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Root:    root,
+		Configs: []Config{{PathScope: "/", Preview: true, PreviewMaxSize: 64}},
+		Hide:    []string{"Caddyfile"},
+	}
+
+	tests := []struct {
+		url            string
+		expectedStatus int
+		contains       string
+		notContains    string
+	}{
+		{"/notes.txt?preview", http.StatusOK, "&lt;script&gt;alert(1)&lt;/script&gt;", "<script>alert"},
+		{"/readme.md?preview", http.StatusOK, "<h1>Hello</h1>", "<b>raw</b>"},
+		{"/big.txt?preview", http.StatusOK, "too large", strings.Repeat("a", 100)},
+		{"/Caddyfile?preview", http.StatusNotFound, "", "secret"},
+		{"/missing.txt?preview", http.StatusTeapot, "", ""},
+		{"/notes.txt", http.StatusTeapot, "", ""},
+	}
+
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+
+		status, _ := b.ServeHTTP(rec, req)
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		body := rec.Body.String()
+		if !strings.Contains(body, test.contains) {
+			t.Errorf("Test %d: Expected body to contain %q, got %q", i, test.contains, body)
+		}
+		if test.notContains != "" && strings.Contains(body, test.notContains) {
+			t.Errorf("Test %d: Expected body to not contain %q, got %q", i, test.notContains, body)
+		}
+	}
+
+	// Previews are disabled unless configured
+	b.Configs[0].Preview = false
+	req, _ := http.NewRequest("GET", "/notes.txt?preview", nil)
+	if status, _ := b.ServeHTTP(httptest.NewRecorder(), req); status != http.StatusTeapot {
+		t.Errorf("Expected preview to be passed through when disabled, got status %d", status)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	root, err := ioutil.TempDir("", "browse_checksum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	err = ioutil.WriteFile(filepath.Join(root, "hello.txt"), []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := Browse{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Root:    root,
+		Configs: []Config{{PathScope: "/", Template: template.Must(template.New("").Parse(`{{range .Items}}{{index .Checksums "md5"}}{{end}}`)), Checksums: []string{"sha256", "md5"}}},
+	}
+
+	tests := []struct {
+		url            string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"/hello.txt?checksum=sha256", http.StatusOK, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  hello.txt\n"},
+		{"/hello.txt?checksum=md5", http.StatusOK, "5d41402abc4b2a76b9719d911017c592  hello.txt\n"},
+		{"/hello.txt?checksum=sha1", http.StatusTeapot, ""},
+		{"/", http.StatusOK, "5d41402abc4b2a76b9719d911017c592"},
+	}
+
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+
+		status, err := b.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if body := rec.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+	}
+}
+
+func TestChecksumCacheSize(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hello.txt")
+	if err := ioutil.WriteFile(file, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := checksumKey{"/first", "md5"}
+	cacheChecksum(first, info, "first")
+	for i := 0; i < checksumCacheSize; i++ {
+		cacheChecksum(checksumKey{fmt.Sprintf("/%d", i), "md5"}, info, "sum")
+	}
+
+	checksumCache.Lock()
+	n := checksumCache.lru.Len()
+	checksumCache.Unlock()
+	if n != checksumCacheSize {
+		t.Errorf("Expected the cache to hold %d checksums, got %d", checksumCacheSize, n)
+	}
+	if _, ok := cachedChecksum(first, info); ok {
+		t.Error("Expected the least recently used checksum to be dropped")
+	}
+	if sum, ok := cachedChecksum(checksumKey{"/0", "md5"}, info); !ok || sum != "sum" {
+		t.Errorf("Expected a recent checksum to stay cached, got %q (%v)", sum, ok)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	root, err := ioutil.TempDir("", "browse_pages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tpl := `{{range .Items}}{{.Name}} {{end}}{{.Page}}/{{.NumPages}} {{.NumFiles}}` +
+		`{{if .HasPrev}} prev={{.PageURL .PrevPage}}{{end}}{{if .HasNext}} next={{.PageURL .NextPage}}{{end}} sort={{.SortURL "name"}}`
+	b := Browse{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Root:    root,
+		Configs: []Config{{PathScope: "/", Template: template.Must(template.New("").Parse(tpl)), PageSize: 2}},
+	}
+
+	tests := []struct {
+		url          string
+		expectedBody string
+	}{
+		{"/", "a.txt b.txt 1/3 5 next=?sort=name&amp;order=asc&amp;page=2 sort=?sort=name&amp;order=desc"},
+		{"/?page=2", "c.txt d.txt 2/3 5 prev=?sort=name&amp;order=asc next=?sort=name&amp;order=asc&amp;page=3 sort=?sort=name&amp;order=desc"},
+		{"/?page=9", "e.txt 3/3 5 prev=?sort=name&amp;order=asc&amp;page=2 sort=?sort=name&amp;order=desc"},
+		{"/?page=-1", "a.txt b.txt 1/3 5 next=?sort=name&amp;order=asc&amp;page=2 sort=?sort=name&amp;order=desc"},
+		{"/?sort=name&order=desc&limit=3", "e.txt d.txt c.txt 1/2 5 next=?sort=name&amp;order=desc&amp;page=2&amp;limit=3 sort=?sort=name&amp;order=asc&amp;limit=3"},
+		{"/?limit=99999", "a.txt b.txt c.txt d.txt e.txt 1/1 5 sort=?sort=name&amp;order=desc&amp;limit=10000"},
+		{"/?sort=bogus&order=up", "a.txt b.txt 1/3 5 next=?sort=name&amp;order=asc&amp;page=2 sort=?sort=name&amp;order=desc"},
+	}
+
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+
+		status, err := b.ServeHTTP(rec, req)
+		if err != nil || status != http.StatusOK {
+			t.Errorf("Test %d: Expected status 200 and no error, got %d and %v", i, status, err)
+		}
+		if body := rec.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+		if strings.Contains(test.url, "bogus") && len(rec.HeaderMap["Set-Cookie"]) > 0 {
+			t.Errorf("Test %d: Expected no cookies for an invalid sort, got %v", i, rec.HeaderMap["Set-Cookie"])
+		}
+	}
+}
+
+func TestLocalizedListing(t *testing.T) {
+	root, err := ioutil.TempDir("", "browse_locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tpl := `{{.Locale}}: {{.T "browse.name"}}, {{.T "browse.page" .Page .NumPages}}`
+	b := Browse{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Root:    root,
+		Configs: []Config{{PathScope: "/", Template: template.Must(template.New("").Parse(tpl)), PageSize: 2}},
+		Locales: i18n.Default,
+	}
+
+	for i, test := range []struct {
+		accept       string
+		expectedBody string
+	}{
+		{"", "en: Name, Page 1 of 2"},
+		{"de-CH, fr;q=0.9", "de: Name, Seite 1 von 2"},
+		{"fr-FR", "fr: Nom, Page 1 sur 2"},
+		{"ja, es;q=0.5", "es: Nombre, Página 1 de 2"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Language", test.accept)
+		rec := httptest.NewRecorder()
+
+		status, err := b.ServeHTTP(rec, req)
+		if err != nil || status != http.StatusOK {
+			t.Errorf("Test %d: Expected status 200 and no error, got %d and %v", i, status, err)
+		}
+		if body := rec.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+		if got := rec.Header().Get("Vary"); got != "Accept-Language" {
+			t.Errorf("Test %d: Expected to vary by Accept-Language, got %q", i, got)
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	root, err := ioutil.TempDir("", "browse_metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"a.txt": "a",
+		"b.txt": "b",
+		".metadata": `. {
+			description "Shared files"
+		}
+		a.txt {
+			name        "File A"
+			description "The first file"
+			icon        /icons/a.png
+		}`,
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tpl := `{{.Metadata.Description}}:{{range .Items}} {{or .Metadata.DisplayName .Name}}[{{.Metadata.Description}}|{{.Metadata.Icon}}]{{end}}`
+	b := Browse{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Root:         root,
+		Configs:      []Config{{PathScope: "/", Template: template.Must(template.New("").Parse(tpl))}},
+		MetadataFile: ".metadata",
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	status, err := b.ServeHTTP(rec, req)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("Expected status 200 and no error, got %d and %v", status, err)
+	}
+	expected := "Shared files: File A[The first file|/icons/a.png] b.txt[|]"
+	if body := rec.Body.String(); body != expected {
+		t.Errorf("Expected body %q, got %q", expected, body)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, ".metadata"), []byte("a.txt {\n\tcolour red\n}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status, err = b.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if status != http.StatusInternalServerError || err == nil {
+		t.Errorf("Expected a broken sidecar file to be an error, got %d and %v", status, err)
+	}
+}
+
+func TestHidePatternsAndIndexPages(t *testing.T) {
+	root, err := ioutil.TempDir("", "browse_hide")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"a.txt", "a.bak", ".git/config", "site/home.html"} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tpl := `{{range .Items}}{{.Name}} {{end}}`
+	b := Browse{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Root:         root,
+		Configs:      []Config{{PathScope: "/", Template: template.Must(template.New("").Parse(tpl))}},
+		HidePatterns: []string{"*.bak", ".git"},
+		IndexPages:   []string{"home.html"},
+	}
+
+	for i, test := range []struct {
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"/", http.StatusOK, "a.txt site "},
+		{"/.git/", http.StatusTeapot, ""},
+		{"/site/", http.StatusTeapot, ""},
+	} {
+		rec := httptest.NewRecorder()
+		status, err := b.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if body := rec.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+	}
+}
+
+// hunter2Hash is the bcrypt hash of "hunter2".
+const hunter2Hash = "$2a$04$u0Pamz5VQ4w6TLqLgwItq.3XQEiYkcWnbt1q8mdsybNMYpjfI/6B2"
+
+func TestAccessPolicy(t *testing.T) {
+	root, err := ioutil.TempDir("", "browse_access")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"public.txt":                            "public",
+		"notes.bak":                             "backup",
+		DefaultAccessFile:                       "hide *.bak drafts",
+		"private/secret.txt":                    "secret",
+		"private/" + DefaultAccessFile:          "realm \"Members only\"\nuser bob " + hunter2Hash,
+		"drafts/post.txt":                       "draft",
+		"private/unlisted/old/file.txt":         "old",
+		"private/unlisted/file.txt":             "file",
+		"private/unlisted/" + DefaultAccessFile: "listing off",
+	}
+	for name, content := range files {
+		fpath := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := Browse{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Root:    root,
+		Configs: []Config{{PathScope: "/", Template: template.Must(template.New("").Parse(`{{range .Items}}{{.Name}};{{end}}`)), AccessFile: DefaultAccessFile}},
+	}
+
+	tests := []struct {
+		url            string
+		user, pass     string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"/", "", "", http.StatusOK, "private;public.txt;"},
+		{"/public.txt", "", "", http.StatusTeapot, ""},
+		{"/notes.bak", "", "", http.StatusNotFound, ""},
+		{"/" + DefaultAccessFile, "", "", http.StatusNotFound, ""},
+		{"/private/", "", "", http.StatusUnauthorized, ""},
+		{"/private/", "bob", "wrong", http.StatusUnauthorized, ""},
+		{"/private/", "bob", "hunter2", http.StatusOK, "secret.txt;unlisted;"},
+		{"/private/secret.txt", "", "", http.StatusUnauthorized, ""},
+		{"/private/secret.txt", "bob", "hunter2", http.StatusTeapot, ""},
+		{"/private/unlisted/", "bob", "hunter2", http.StatusTeapot, ""},
+		{"/drafts/", "", "", http.StatusNotFound, ""},
+		{"/drafts/post.txt", "", "", http.StatusNotFound, ""},
+		{"/private/unlisted/old/file.txt", "", "", http.StatusUnauthorized, ""},
+		{"/private/unlisted/old/file.txt", "bob", "hunter2", http.StatusTeapot, ""},
+	}
+
+	for i, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.user != "" {
+			req.SetBasicAuth(test.user, test.pass)
+		}
+		rec := httptest.NewRecorder()
+
+		status, err := b.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if body := rec.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+		if status == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != `Basic realm="Members only"` {
+			t.Errorf("Test %d: Expected realm challenge, got %q", i, rec.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	modTime := time.Date(2015, 7, 4, 18, 30, 0, 0, time.UTC)
+	tokyo := time.FixedZone("JST", 9*60*60)
+
+	for i, test := range []struct {
+		format       Format
+		layout       []string
+		expectedSize string
+		expectedTime string
+	}{
+		{Format{}, nil, "1.5 MB", modTime.Local().Format(DefaultTimeFormat)},
+		{Format{Units: UnitsIEC, Location: time.UTC}, nil, "1.4 MiB", "07/04/2015 6:30:00 PM +0000"},
+		{Format{Units: UnitsBytes, Time: "2006-01-02 15:04", Location: tokyo}, nil, "1500000", "2015-07-05 03:30"},
+		{Format{Time: "2006-01-02 15:04", Location: time.UTC}, []string{"Jan 2"}, "1.5 MB", "Jul 4"},
+	} {
+		fi := FileInfo{Size: 1500000, ModTime: modTime, format: test.format}
+		if got := fi.HumanSize(); got != test.expectedSize {
+			t.Errorf("Test %d: Expected size %q, got %q", i, test.expectedSize, got)
+		}
+		if got := fi.HumanModTime(test.layout...); got != test.expectedTime {
+			t.Errorf("Test %d: Expected time %q, got %q", i, test.expectedTime, got)
+		}
+	}
+}
+
+func TestBreadcrumbs(t *testing.T) {
+	for i, test := range []struct {
+		path     string
+		expected []Breadcrumb
+	}{
+		{"/", []Breadcrumb{{"/", "/"}}},
+		{"/a/", []Breadcrumb{{"/", "/"}, {"a", "/a/"}}},
+		{"/a/b c/", []Breadcrumb{{"/", "/"}, {"a", "/a/"}, {"b c", "/a/b%20c/"}}},
+		{"/a//b", []Breadcrumb{{"/", "/"}, {"a", "/a/"}, {"b", "/a/b/"}}},
+	} {
+		got := breadcrumbs(test.path)
+		if len(got) != len(test.expected) {
+			t.Errorf("Test %d: Expected %v, got %v", i, test.expected, got)
+			continue
+		}
+		for j := range got {
+			if got[j] != test.expected[j] {
+				t.Errorf("Test %d: Expected breadcrumb %d to be %v, got %v", i, j, test.expected[j], got[j])
+			}
+		}
+	}
+}
+
+func TestSortDirsFirstNatural(t *testing.T) {
+	listing := Listing{
+		Items: []FileInfo{
+			{Name: "file10"},
+			{Name: "dir2", IsDir: true},
+			{Name: "File2"},
+			{Name: "dir10", IsDir: true},
+			{Name: "file02"},
+			{Name: "file1.txt"},
+		},
+		Sort:        "name",
+		Order:       "asc",
+		dirsFirst:   true,
+		naturalSort: true,
+	}
+	listing.applySort()
+
+	var names []string
+	for _, item := range listing.Items {
+		names = append(names, item.Name)
+	}
+	expected := "dir2 dir10 file1.txt File2 file02 file10"
+	if got := strings.Join(names, " "); got != expected {
+		t.Errorf("Expected order %q, got %q", expected, got)
+	}
+
+	listing.Order = "desc"
+	listing.applySort()
+	if listing.Items[0].Name != "dir10" || listing.Items[2].Name != "file10" {
+		t.Errorf("Expected directories first in descending order too, got %v", listing.Items)
+	}
+}
+
+func TestListingTotals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_browse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, size := range map[string]int{"a": 100, "b": 50} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listing, err := directoryListing(files, IndexPages, "/", false, Format{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if listing.NumDirs != 1 || listing.NumFiles != 2 || listing.TotalSize != 150 {
+		t.Errorf("Expected 1 dir, 2 files and 150 bytes, got %d, %d and %d",
+			listing.NumDirs, listing.NumFiles, listing.TotalSize)
+	}
+	if got := listing.HumanTotalSize(); got != "150 B" {
+		t.Errorf("Expected total size '150 B', got %q", got)
+	}
+}
+
+func TestDirSize(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_dirsize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	deep := filepath.Join(root, "a", "b", "c")
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for dir, size := range map[string]int{"a": 10, "a/b": 20, "a/b/c": 30} {
+		if err := ioutil.WriteFile(filepath.Join(root, dir, "f"), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := Browse{Root: root}
+	later := time.Now().Add(time.Minute)
+	for i, test := range []struct {
+		depth            int
+		deadline         time.Time
+		expectedSize     int64
+		expectedComplete bool
+	}{
+		{0, time.Now().Add(-time.Second), 0, false},
+		{1, later, 10, false},
+		{2, later, 30, false},
+		{3, later, 60, true},
+		{0, later, 60, true},
+	} {
+		size, complete := b.dirSize("/a", test.depth, test.deadline)
+		if size != test.expectedSize || complete != test.expectedComplete {
+			t.Errorf("Test %d: Expected size %d (complete: %v), got %d (complete: %v)",
+				i, test.expectedSize, test.expectedComplete, size, complete)
+		}
+	}
+
+	// complete sizes are cached until they expire
+	if err := ioutil.WriteFile(filepath.Join(deep, "g"), make([]byte, 40), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := b.dirSize("/a", 0, later); size != 60 {
+		t.Errorf("Expected cached size 60, got %d", size)
+	}
+	defer func(d time.Duration) { DirSizeCacheTime = d }(DirSizeCacheTime)
+	DirSizeCacheTime = 0
+	if size, _ := b.dirSize("/a", 0, later); size != 100 {
+		t.Errorf("Expected size 100 once the cached size expired, got %d", size)
+	}
+}
+
+func TestConfinedRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "browse_confined")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	outside, err := ioutil.TempDir("", "browse_outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "linkdir")); err != nil {
+		t.Skipf("Can't create symlinks: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "secret.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	b := Browse{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Root:    root,
+		FileSys: middleware.ConfinedDir(root),
+		Configs: []Config{{
+			PathScope: "/",
+			Template:  template.Must(template.New("").Parse(`{{range .Items}}{{.Name}} {{end}}`)),
+			Preview:   true,
+			Checksums: []string{"md5"},
+			DirSizes:  true,
+		}},
+	}
+
+	for i, url := range []string{"/linkdir/", "/secret.txt?checksum=md5", "/secret.txt?preview"} {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		if status, _ := b.ServeHTTP(rec, req); status != http.StatusTeapot {
+			t.Errorf("Test %d: Expected %s outside the root to be passed through, got status %d", i, url, status)
+		}
+		if strings.Contains(rec.Body.String(), "secret") {
+			t.Errorf("Test %d: Expected nothing from outside the root, got %q", i, rec.Body.String())
+		}
+	}
+
+	// the links themselves are still listed, but not followed
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	if status, err := b.ServeHTTP(rec, req); status != http.StatusOK {
+		t.Fatalf("Expected listing of the root, got status %d (%v)", status, err)
+	}
+}
+
+func TestAccessGuard(t *testing.T) {
+	root, err := ioutil.TempDir("", "browse_guard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := os.MkdirAll(filepath.Join(root, "private", "drafts"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	accessFile := filepath.Join(root, "private", DefaultAccessFile)
+	for name, content := range map[string]string{
+		"private/page.md":              "page",
+		"private/drafts/post.md":       "draft",
+		"private/" + DefaultAccessFile: "user bob " + hunter2Hash,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := Browse{
+		Root:    root,
+		Configs: []Config{{PathScope: "/", Template: template.Must(template.New("").Parse(``)), AccessFile: DefaultAccessFile}},
+	}
+	// stands in for middleware ahead of browse that serves files itself
+	served := middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+	guard := b.Guard(served)
+
+	serve := func(url, user, pass string) int {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user != "" {
+			req.SetBasicAuth(user, pass)
+		}
+		status, _ := guard.ServeHTTP(httptest.NewRecorder(), req)
+		return status
+	}
+
+	if status := serve("/private/page.md", "", ""); status != http.StatusUnauthorized {
+		t.Errorf("Expected the guard to ask for credentials, got status %d", status)
+	}
+	if status := serve("/private/page.md", "bob", "hunter2"); status != http.StatusOK {
+		t.Errorf("Expected the guard to let bob through, got status %d", status)
+	}
+	if status := serve("/private/"+DefaultAccessFile, "bob", "hunter2"); status != http.StatusNotFound {
+		t.Errorf("Expected the access file to be not found, got status %d", status)
+	}
+
+	// changes to the access file are picked up
+	if err := ioutil.WriteFile(accessFile, []byte("user bob "+hunter2Hash+"\nhide drafts"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(accessFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if status := serve("/private/drafts/post.md", "bob", "hunter2"); status != http.StatusNotFound {
+		t.Errorf("Expected files under a hidden directory to be not found, got status %d", status)
+	}
+
+	// passwords must be hashed
+	if err := ioutil.WriteFile(accessFile, []byte("user bob hunter2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status := serve("/private/page.md", "bob", "hunter2"); status != http.StatusInternalServerError {
+		t.Errorf("Expected a plain text password to be an error, got status %d", status)
+	}
+}
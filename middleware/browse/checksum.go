@@ -0,0 +1,160 @@
+package browse
+
+import (
+	"container/list"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Checksums maps the name of each supported checksum
+// algorithm to a function that makes a new hash.
+var Checksums = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// hasChecksum returns true if algo is enabled in c.
+func (c Config) hasChecksum(algo string) bool {
+	for _, a := range c.Checksums {
+		if a == algo {
+			return true
+		}
+	}
+	return false
+}
+
+// serveChecksum writes the checksum of the file at r.URL.Path
+// in the same format as the sha256sum family of tools, so the
+// response can be saved as a sidecar file and verified directly.
+func (b Browse) serveChecksum(w http.ResponseWriter, r *http.Request, algo string) (int, error) {
+	name := path.Base(r.URL.Path)
+	if b.isHidden(name) {
+		return http.StatusNotFound, nil
+	}
+
+	fpath := path.Clean("/" + r.URL.Path)
+	info, err := b.stat(fpath)
+	if err != nil {
+		if os.IsPermission(err) {
+			return http.StatusForbidden, err
+		}
+		return http.StatusNotFound, nil
+	}
+
+	sum, err := b.fileChecksum(fpath, algo, info)
+	if err != nil {
+		if os.IsPermission(err) {
+			return http.StatusForbidden, err
+		}
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s.%s"`, name, algo))
+	fmt.Fprintf(w, "%s  %s\n", sum, name)
+
+	return http.StatusOK, nil
+}
+
+// checksumCacheSize is how many checksums checksumCache holds;
+// the least recently used one is dropped to make room for another.
+const checksumCacheSize = 4096
+
+// checksumCache holds computed checksums so that files are
+// only read again once their size or modification time changes.
+var checksumCache = struct {
+	sync.Mutex
+	sums map[checksumKey]*list.Element
+	lru  *list.List // of *checksumEntry, most recently used first
+}{sums: make(map[checksumKey]*list.Element), lru: list.New()}
+
+type checksumKey struct {
+	path, algo string
+}
+
+type checksumEntry struct {
+	key     checksumKey
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// cachedChecksum returns the cached checksum of the file at key
+// if info shows the file hasn't changed since it was computed.
+func cachedChecksum(key checksumKey, info os.FileInfo) (string, bool) {
+	checksumCache.Lock()
+	defer checksumCache.Unlock()
+	el, ok := checksumCache.sums[key]
+	if !ok {
+		return "", false
+	}
+	entry := el.Value.(*checksumEntry)
+	if entry.size != info.Size() || !entry.modTime.Equal(info.ModTime()) {
+		return "", false
+	}
+	checksumCache.lru.MoveToFront(el)
+	return entry.sum, true
+}
+
+// cacheChecksum adds the checksum sum of the file at key, as
+// described by info, to checksumCache.
+func cacheChecksum(key checksumKey, info os.FileInfo, sum string) {
+	checksumCache.Lock()
+	defer checksumCache.Unlock()
+	entry := &checksumEntry{key: key, size: info.Size(), modTime: info.ModTime(), sum: sum}
+	if el, ok := checksumCache.sums[key]; ok {
+		el.Value = entry
+		checksumCache.lru.MoveToFront(el)
+		return
+	}
+	checksumCache.sums[key] = checksumCache.lru.PushFront(entry)
+	for checksumCache.lru.Len() > checksumCacheSize {
+		oldest := checksumCache.lru.Back()
+		checksumCache.lru.Remove(oldest)
+		delete(checksumCache.sums, oldest.Value.(*checksumEntry).key)
+	}
+}
+
+// fileChecksum returns the hex-encoded checksum of the file at
+// urlPath using algo. info must describe the same file; it is used
+// to determine whether a cached checksum is still valid.
+func (b Browse) fileChecksum(urlPath, algo string, info os.FileInfo) (string, error) {
+	newHash, ok := Checksums[algo]
+	if !ok {
+		return "", fmt.Errorf("unsupported checksum algorithm '%s'", algo)
+	}
+
+	key := checksumKey{filepath.Join(b.Root, filepath.FromSlash(urlPath)), algo}
+
+	if sum, ok := cachedChecksum(key, info); ok {
+		return sum, nil
+	}
+
+	f, err := b.fileSystem().Open(urlPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	cacheChecksum(key, info, sum)
+
+	return sum, nil
+}
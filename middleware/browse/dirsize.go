@@ -0,0 +1,92 @@
+package browse
+
+import (
+	"net/http"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultDirSizeTimeout is how long computing the sizes of
+// the directories in a listing may take if not configured.
+const DefaultDirSizeTimeout = time.Second
+
+// DirSizeCacheTime is how long the size of a directory is
+// remembered. Changes deep inside a directory don't change
+// its modification time, so cached sizes simply expire.
+var DirSizeCacheTime = time.Minute
+
+// dirSizeCache holds the sizes of directories that
+// were computed in full.
+var dirSizeCache = struct {
+	sync.Mutex
+	sizes map[dirSizeKey]dirSizeEntry
+}{sizes: make(map[dirSizeKey]dirSizeEntry)}
+
+type dirSizeKey struct {
+	path  string
+	depth int
+}
+
+type dirSizeEntry struct {
+	size     int64
+	computed time.Time
+}
+
+// dirSize returns the total size of the files in the directory
+// at urlPath and its subdirectories, going at most depth levels
+// down (no limit if depth is 0). The walk stops at deadline;
+// complete is false if it did, or if there were subdirectories
+// too deep or unreadable to count. Symbolic links are not
+// followed.
+func (b Browse) dirSize(urlPath string, depth int, deadline time.Time) (size int64, complete bool) {
+	key := dirSizeKey{filepath.Join(b.Root, filepath.FromSlash(urlPath)), depth}
+
+	dirSizeCache.Lock()
+	entry, ok := dirSizeCache.sizes[key]
+	dirSizeCache.Unlock()
+	if ok && time.Since(entry.computed) < DirSizeCacheTime {
+		return entry.size, true
+	}
+
+	size, complete = walkDirSize(b.fileSystem(), urlPath, depth, deadline)
+	if complete {
+		dirSizeCache.Lock()
+		dirSizeCache.sizes[key] = dirSizeEntry{size: size, computed: time.Now()}
+		dirSizeCache.Unlock()
+	}
+	return size, complete
+}
+
+func walkDirSize(fs http.FileSystem, urlPath string, depth int, deadline time.Time) (size int64, complete bool) {
+	if time.Now().After(deadline) {
+		return 0, false
+	}
+	dir, err := fs.Open(urlPath)
+	if err != nil {
+		return 0, false
+	}
+	infos, err := dir.Readdir(-1)
+	dir.Close()
+	if err != nil {
+		return 0, false
+	}
+
+	complete = true
+	for _, info := range infos {
+		switch {
+		case info.Mode().IsRegular():
+			size += info.Size()
+		case info.IsDir():
+			if depth == 1 {
+				complete = false
+				continue
+			}
+			sub, subComplete := walkDirSize(fs, path.Join(urlPath, info.Name()), depth-1, deadline)
+			size += sub
+			complete = complete && subComplete
+		}
+	}
+	return size, complete
+}
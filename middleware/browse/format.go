@@ -0,0 +1,112 @@
+package browse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// DefaultTimeFormat is the layout of modification
+// times in listings if none is configured.
+const DefaultTimeFormat = "01/02/2006 3:04:05 PM -0700"
+
+// Units that file sizes can be shown in.
+const (
+	UnitsSI    = "si"    // powers of 1000: kB, MB, ...
+	UnitsIEC   = "iec"   // powers of 1024: KiB, MiB, ...
+	UnitsBytes = "bytes" // the exact number of bytes
+)
+
+// Format is how file sizes and modification times are
+// shown in a listing. The zero value uses SI units and
+// DefaultTimeFormat in the server's local time zone.
+type Format struct {
+	// Layout of modification times, as for time.Format
+	Time string
+
+	// Time zone to show modification times in;
+	// nil for the server's local time zone
+	Location *time.Location
+
+	// Units of file sizes: UnitsSI, UnitsIEC or UnitsBytes
+	Units string
+}
+
+// ParseUnits checks that units names units that
+// sizes can be shown in.
+func ParseUnits(units string) (string, error) {
+	switch units {
+	case UnitsSI, UnitsIEC, UnitsBytes:
+		return units, nil
+	}
+	return "", fmt.Errorf("unknown size units '%s' (must be %s, %s or %s)", units, UnitsSI, UnitsIEC, UnitsBytes)
+}
+
+// Size formats size, a number of bytes.
+func (f Format) Size(size int64) string {
+	switch f.Units {
+	case UnitsIEC:
+		return humanize.IBytes(uint64(size))
+	case UnitsBytes:
+		return strconv.FormatInt(size, 10)
+	default:
+		return humanize.Bytes(uint64(size))
+	}
+}
+
+// ModTime formats t using layout, or the format's own
+// layout if layout is empty.
+func (f Format) ModTime(t time.Time, layout string) string {
+	if layout == "" {
+		layout = f.Time
+	}
+	if layout == "" {
+		layout = DefaultTimeFormat
+	}
+	if f.Location != nil {
+		t = t.In(f.Location)
+	}
+	return t.Format(layout)
+}
+
+// naturalLess reports whether a sorts before b when runs
+// of digits in them are compared by their numeric value.
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := digitPrefix(a), digitPrefix(b)
+		if da == "" || db == "" {
+			if a[0] != b[0] {
+				return a[0] < b[0]
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		// compare numbers by length, then digits,
+		// once leading zeros are out of the way
+		na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+		if len(na) != len(nb) {
+			return len(na) < len(nb)
+		}
+		if na != nb {
+			return na < nb
+		}
+		if len(da) != len(db) {
+			return len(da) < len(db) // fewer leading zeros first
+		}
+		a, b = a[len(da):], b[len(db):]
+	}
+	return len(a) < len(b)
+}
+
+// digitPrefix returns the run of ASCII digits s starts with.
+func digitPrefix(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
@@ -0,0 +1,162 @@
+package browse
+
+import (
+	"bytes"
+	"html/template"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/russross/blackfriday"
+)
+
+// DefaultPreviewMaxSize is the largest file, in bytes, that
+// is rendered inline if the config does not specify a size.
+const DefaultPreviewMaxSize = 1 << 16
+
+// A Preview is used to fill out the preview template
+// when a single file is requested with "?preview".
+type Preview struct {
+	// The name of the file
+	Name string
+
+	// The full path of the request (without the query string)
+	Path string
+
+	// Size of the file in bytes
+	Size int64
+
+	// What kind of preview this is: "text", "markdown", "image",
+	// or empty if the file can't be previewed
+	Kind string
+
+	// Whether the file was too large to be rendered inline
+	TooLarge bool
+
+	// Contents of a text file; escaped by the template
+	Text string
+
+	// Rendered contents of a markdown file
+	HTML template.HTML
+}
+
+// previewMarkdownFlags keep raw HTML, styles and unsafe
+// links in the markdown source out of the rendered preview.
+const previewMarkdownFlags = blackfriday.HTML_SKIP_HTML |
+	blackfriday.HTML_SKIP_STYLE |
+	blackfriday.HTML_SAFELINK
+
+// servePreview renders the file at r.URL.Path as a small HTML page
+// according to bc.
+func (b Browse) servePreview(w http.ResponseWriter, r *http.Request, bc Config) (int, error) {
+	if b.isHidden(path.Base(r.URL.Path)) {
+		return http.StatusNotFound, nil
+	}
+
+	f, err := b.fileSystem().Open(r.URL.Path)
+	if err != nil {
+		if os.IsPermission(err) {
+			return http.StatusForbidden, err
+		}
+		return http.StatusNotFound, nil
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return http.StatusNotFound, nil
+	}
+
+	preview := Preview{
+		Name: info.Name(),
+		Path: r.URL.Path,
+		Size: info.Size(),
+		Kind: previewKind(info.Name()),
+	}
+
+	maxSize := bc.PreviewMaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultPreviewMaxSize
+	}
+
+	if preview.Kind != "image" {
+		if info.Size() > maxSize {
+			preview.TooLarge = true
+		} else {
+			body, err := ioutil.ReadAll(f)
+			if err != nil {
+				return http.StatusInternalServerError, err
+			}
+			if preview.Kind == "markdown" {
+				renderer := blackfriday.HtmlRenderer(previewMarkdownFlags, "", "")
+				preview.HTML = template.HTML(blackfriday.Markdown(body, renderer, 0))
+			} else if strings.HasPrefix(http.DetectContentType(body), "text/") {
+				preview.Kind = "text"
+				preview.Text = string(body)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	err = previewTemplate.Execute(&buf, preview)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+
+	return http.StatusOK, nil
+}
+
+// previewKind guesses the kind of preview from the file name.
+// Files that aren't images or markdown return an empty string
+// and are sniffed for text once they are read.
+func previewKind(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	switch ext {
+	case ".md", ".markdown":
+		return "markdown"
+	}
+	if strings.HasPrefix(mime.TypeByExtension(ext), "image/") {
+		return "image"
+	}
+	return ""
+}
+
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+	<head>
+		<title>{{.Name}}</title>
+		<meta charset="utf-8">
+<style>
+body { padding: 1% 2%; font: 16px Arial; }
+header { padding: 10px 0 20px; }
+h1 { font-size: 24px; display: inline; margin-right: 20px; }
+pre { padding: 10px; background: #f5f5f5; overflow: auto; }
+img { max-width: 100%; }
+</style>
+	</head>
+	<body>
+		<header>
+			<h1>{{.Name}}</h1>
+			<a href="./">Back to listing</a> &middot; <a href="{{.Path}}">Download</a>
+		</header>
+		<main>
+			{{if .TooLarge}}
+			<p>This file is too large to preview.</p>
+			{{else if eq .Kind "image"}}
+			<img src="{{.Path}}" alt="{{.Name}}">
+			{{else if eq .Kind "markdown"}}
+			{{.HTML}}
+			{{else if eq .Kind "text"}}
+			<pre>{{.Text}}</pre>
+			{{else}}
+			<p>No preview is available for this file.</p>
+			{{end}}
+		</main>
+	</body>
+</html>`))
@@ -0,0 +1,113 @@
+// Package canonical provides middleware that redirects requests
+// for a site's alias hostnames to its primary hostname.
+package canonical
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Canonical is middleware that redirects requests for
+// any host other than Host to the same resource on Host.
+// If Aliases isn't empty, only requests for those hosts
+// are redirected.
+type Canonical struct {
+	Next    middleware.Handler
+	Host    string   // the primary hostname
+	Aliases []string // the hostnames to redirect; all others if empty
+	Code    int      // the redirect status code
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (c Canonical) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	host, port := splitHost(r.Host)
+
+	if strings.EqualFold(host, c.Host) || !c.isAlias(host) {
+		return c.Next.ServeHTTP(w, r)
+	}
+
+	redirect(w, r, scheme(r), c.Host, port, c.Code)
+	return 0, nil
+}
+
+// isAlias returns true if requests for host are to be redirected.
+func (c Canonical) isAlias(host string) bool {
+	if len(c.Aliases) == 0 {
+		return true
+	}
+	for _, alias := range c.Aliases {
+		if strings.EqualFold(host, alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// WWW is middleware that redirects requests for www.<host>
+// to <host>, or, if Add is true, requests for <host> to
+// www.<host>. Hosts that are IP addresses or have no dot,
+// like localhost, are left alone.
+type WWW struct {
+	Next  middleware.Handler
+	Add   bool // whether to add www. instead of removing it
+	HTTPS bool // whether to redirect to https, so that plain HTTP requests only take one hop
+	Code  int  // the redirect status code
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (w3 WWW) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	host, port := splitHost(r.Host)
+	if net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return w3.Next.ServeHTTP(w, r)
+	}
+
+	hasWWW := len(host) > 4 && strings.EqualFold(host[:4], "www.")
+	var target string
+	switch {
+	case w3.Add && !hasWWW:
+		target = "www." + host
+	case !w3.Add && hasWWW:
+		target = host[4:]
+	default:
+		return w3.Next.ServeHTTP(w, r)
+	}
+
+	toScheme := scheme(r)
+	if w3.HTTPS && toScheme != "https" {
+		// the port is for plain HTTP; use the default one
+		toScheme, port = "https", ""
+	}
+
+	redirect(w, r, toScheme, target, port, w3.Code)
+	return 0, nil
+}
+
+// splitHost splits the Host header of a request into
+// the hostname and port, which may be empty.
+func splitHost(hostport string) (host, port string) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return hostport, "" // no port in Host header
+	}
+	return host, port
+}
+
+// scheme returns the scheme of the URL that r requested.
+func scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// redirect redirects r to the same resource on host and
+// port (if any) with the given scheme.
+func redirect(w http.ResponseWriter, r *http.Request, scheme, host, port string, code int) {
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	http.Redirect(w, r, scheme+"://"+host+r.URL.RequestURI(), code)
+}
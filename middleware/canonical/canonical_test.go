@@ -0,0 +1,151 @@
+package canonical
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestCanonical(t *testing.T) {
+	c := Canonical{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+		Host: "example.com",
+		Code: http.StatusMovedPermanently,
+	}
+
+	for i, test := range []struct {
+		host             string
+		url              string
+		tls              bool
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"example.com", "/foo", false, http.StatusOK, ""},
+		{"EXAMPLE.com:8080", "/foo", false, http.StatusOK, ""},
+		{"www.example.com", "/foo?bar=baz", false, http.StatusMovedPermanently, "http://example.com/foo?bar=baz"},
+		{"www.example.com:8080", "/", false, http.StatusMovedPermanently, "http://example.com:8080/"},
+		{"alias.example.net", "/a/b", true, http.StatusMovedPermanently, "https://example.com/a/b"},
+	} {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		req.Host = test.host
+		if test.tls {
+			req.TLS = new(tls.ConnectionState)
+		}
+		rec := httptest.NewRecorder()
+
+		status, err := c.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status == 0 {
+			status = rec.Code
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if location := rec.Header().Get("Location"); location != test.expectedLocation {
+			t.Errorf("Test %d: Expected Location %q, got %q", i, test.expectedLocation, location)
+		}
+	}
+}
+
+func TestCanonicalAliases(t *testing.T) {
+	c := Canonical{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}),
+		Host:    "example.com",
+		Aliases: []string{"foo.example.net"},
+		Code:    http.StatusMovedPermanently,
+	}
+
+	for i, test := range []struct {
+		host             string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"example.com", http.StatusOK, ""},
+		{"www.example.com", http.StatusOK, ""},
+		{"FOO.example.net:8080", http.StatusMovedPermanently, "http://example.com:8080/a"},
+	} {
+		req, err := http.NewRequest("GET", "/a", nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		req.Host = test.host
+		rec := httptest.NewRecorder()
+
+		status, _ := c.ServeHTTP(rec, req)
+		if status == 0 {
+			status = rec.Code
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if location := rec.Header().Get("Location"); location != test.expectedLocation {
+			t.Errorf("Test %d: Expected Location %q, got %q", i, test.expectedLocation, location)
+		}
+	}
+}
+
+func TestWWW(t *testing.T) {
+	next := middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	for i, test := range []struct {
+		www              WWW
+		host             string
+		tls              bool
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{WWW{}, "example.com", false, http.StatusOK, ""},
+		{WWW{}, "www.example.com", false, http.StatusMovedPermanently, "http://example.com/foo?bar=baz"},
+		{WWW{}, "WWW.example.com:8080", false, http.StatusMovedPermanently, "http://example.com:8080/foo?bar=baz"},
+		{WWW{}, "www.example.com", true, http.StatusMovedPermanently, "https://example.com/foo?bar=baz"},
+		{WWW{HTTPS: true}, "www.example.com:8080", false, http.StatusMovedPermanently, "https://example.com/foo?bar=baz"},
+		{WWW{HTTPS: true}, "www.example.com:8443", true, http.StatusMovedPermanently, "https://example.com:8443/foo?bar=baz"},
+		{WWW{HTTPS: true}, "example.com", false, http.StatusOK, ""},
+		{WWW{Add: true}, "example.com", false, http.StatusMovedPermanently, "http://www.example.com/foo?bar=baz"},
+		{WWW{Add: true}, "www.example.com", false, http.StatusOK, ""},
+		{WWW{Add: true}, "localhost:2015", false, http.StatusOK, ""},
+		{WWW{Add: true}, "127.0.0.1", false, http.StatusOK, ""},
+		{WWW{}, "www.", false, http.StatusOK, ""},
+	} {
+		w3 := test.www
+		w3.Next, w3.Code = next, http.StatusMovedPermanently
+
+		req, err := http.NewRequest("GET", "/foo?bar=baz", nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		req.Host = test.host
+		if test.tls {
+			req.TLS = new(tls.ConnectionState)
+		}
+		rec := httptest.NewRecorder()
+
+		status, err := w3.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status == 0 {
+			status = rec.Code
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if location := rec.Header().Get("Location"); location != test.expectedLocation {
+			t.Errorf("Test %d: Expected Location %q, got %q", i, test.expectedLocation, location)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ClientCertificate returns the client certificate of r, if
+// the client gave one and it was verified (see the clients
+// subdirective of tls); nil otherwise.
+func ClientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// ClientCertFingerprint returns the SHA-256 fingerprint of
+// cert in hex, as shown by openssl x509 -fingerprint -sha256
+// without the colons.
+func ClientCertFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// clientCertReplacements adds the placeholders for the verified
+// client certificate of r to replacements, empty if it has none:
+//
+//	{tls_client_subject}      subject distinguished name
+//	{tls_client_issuer}       issuer distinguished name
+//	{tls_client_serial}       serial number, in decimal
+//	{tls_client_fingerprint}  SHA-256 fingerprint, in hex
+//	{tls_client_san_dns}      DNS names, separated by commas
+//	{tls_client_san_email}    email addresses, likewise
+//	{tls_client_san_uri}      URIs, likewise
+//	{tls_client_san_ip}       IP addresses, likewise
+//	{tls_client_certificate}  the certificate in PEM, URL-escaped
+//	                          so it fits in a header
+func clientCertReplacements(r *http.Request, replacements map[string]string) {
+	cert := ClientCertificate(r)
+	if cert == nil {
+		for _, placeholder := range clientCertPlaceholders {
+			replacements[placeholder] = ""
+		}
+		return
+	}
+	uris := make([]string, len(cert.URIs))
+	for i, u := range cert.URIs {
+		uris[i] = u.String()
+	}
+	ips := make([]string, len(cert.IPAddresses))
+	for i, ip := range cert.IPAddresses {
+		ips[i] = ip.String()
+	}
+	block := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+
+	replacements["{tls_client_subject}"] = cert.Subject.String()
+	replacements["{tls_client_issuer}"] = cert.Issuer.String()
+	replacements["{tls_client_serial}"] = cert.SerialNumber.String()
+	replacements["{tls_client_fingerprint}"] = ClientCertFingerprint(cert)
+	replacements["{tls_client_san_dns}"] = strings.Join(cert.DNSNames, ",")
+	replacements["{tls_client_san_email}"] = strings.Join(cert.EmailAddresses, ",")
+	replacements["{tls_client_san_uri}"] = strings.Join(uris, ",")
+	replacements["{tls_client_san_ip}"] = strings.Join(ips, ",")
+	replacements["{tls_client_certificate}"] = url.QueryEscape(string(block))
+}
+
+// clientCertPlaceholders are the placeholders of clientCertReplacements.
+var clientCertPlaceholders = []string{
+	"{tls_client_subject}", "{tls_client_issuer}", "{tls_client_serial}",
+	"{tls_client_fingerprint}", "{tls_client_san_dns}", "{tls_client_san_email}",
+	"{tls_client_san_uri}", "{tls_client_san_ip}", "{tls_client_certificate}",
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientCertReplacements(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, _ := url.Parse("spiffe://example.com/app")
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(42),
+		Subject:        pkix.Name{CommonName: "alice", Organization: []string{"Example"}},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		DNSNames:       []string{"alice.example.com", "a.example.com"},
+		EmailAddresses: []string{"alice@example.com"},
+		URIs:           []*url.URL{uri},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := http.NewRequest("GET", "https://example.com/", nil)
+	if got := NewReplacer(r, nil, "-").Replace("{tls_client_subject}|{tls_client_certificate}"); got != "-|-" {
+		t.Errorf("Expected empty values without a certificate, got %q", got)
+	}
+
+	// a certificate that wasn't verified doesn't count
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if ClientCertificate(r) != nil {
+		t.Error("Expected no client certificate unless it was verified")
+	}
+
+	r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	rep := NewReplacer(r, nil, "-")
+	for i, test := range []struct {
+		input, expected string
+	}{
+		{"{tls_client_subject}", "CN=alice,O=Example"},
+		{"{tls_client_issuer}", "CN=alice,O=Example"},
+		{"{tls_client_serial}", "42"},
+		{"{tls_client_fingerprint}", ClientCertFingerprint(cert)},
+		{"{tls_client_san_dns}", "alice.example.com,a.example.com"},
+		{"{tls_client_san_email}|{tls_client_san_uri}|{tls_client_san_ip}", "alice@example.com|spiffe://example.com/app|10.0.0.1"},
+	} {
+		if got := rep.Replace(test.input); got != test.expected {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.expected, got)
+		}
+	}
+
+	if fp := ClientCertFingerprint(cert); len(fp) != 64 {
+		t.Errorf("Expected a hex SHA-256 fingerprint, got %q", fp)
+	}
+	escaped := rep.Replace("{tls_client_certificate}")
+	if strings.ContainsAny(escaped, " \n") {
+		t.Errorf("Expected the certificate escaped for a header, got %q", escaped)
+	}
+	if pem, _ := url.QueryUnescape(escaped); !strings.HasPrefix(pem, "-----BEGIN CERTIFICATE-----\n") {
+		t.Errorf("Expected the certificate in PEM, got %q", pem)
+	}
+}
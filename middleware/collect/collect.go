@@ -0,0 +1,234 @@
+// Package collect provides middleware for privacy-friendly
+// analytics: pages send a beacon to an endpoint of the site,
+// which records the view without the visitor's full IP address
+// or user agent, and reports can be exported as JSON or CSV.
+package collect
+
+import (
+	"crypto/subtle"
+	"encoding/csv"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/admin"
+	"github.com/mholt/caddy/middleware"
+)
+
+// Collect is middleware that serves a beacon endpoint at Path,
+// and the export API at Path+"/export". Pages send a beacon
+// with the path they show and their referrer, like
+//
+//	navigator.sendBeacon("/_collect?p=" + encodeURIComponent(location.pathname) +
+//		"&r=" + encodeURIComponent(document.referrer))
+//
+// or, without JavaScript, with an <img> of the endpoint, in which
+// case the Referer header says which page it is.
+//
+// Anyone can send beacons, and each one that is recorded adds to the
+// store, so the endpoint should be covered by the ratelimit directive
+// to keep a single client from filling the disk.
+type Collect struct {
+	Next  middleware.Handler
+	Path  string // the beacon endpoint, like "/_collect"
+	Store *Store
+
+	// The token clients must send in an "Authorization: Bearer"
+	// header to export reports; exports are disabled if empty
+	Token string
+}
+
+// maxExportDays is the longest range of days an export may cover.
+const maxExportDays = 366
+
+// maxBeaconLength is the longest page path or referrer a beacon
+// may report; beacons with longer ones are refused.
+const maxBeaconLength = 1024
+
+// ServeHTTP implements the middleware.Handler interface.
+func (c Collect) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	switch r.URL.Path {
+	case c.Path:
+		return c.beacon(w, r)
+	case c.Path + "/export":
+		if c.Token != "" {
+			return c.export(w, r)
+		}
+	}
+	return c.Next.ServeHTTP(w, r)
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (c Collect) Scopes() []string {
+	return []string{c.Path}
+}
+
+// beacon records the view that r reports.
+func (c Collect) beacon(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != "GET" && r.Method != "POST" {
+		return http.StatusMethodNotAllowed, nil
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	agent := AgentClass(r.UserAgent())
+	if agent == "bot" || r.Header.Get("DNT") == "1" {
+		w.WriteHeader(http.StatusNoContent)
+		return 0, nil
+	}
+
+	query := r.URL.Query()
+	page, referrer := query.Get("p"), query.Get("r")
+	if page == "" {
+		// an <img> beacon, whose Referer is the page
+		if u, err := url.Parse(r.Referer()); err == nil {
+			page = u.Path
+		}
+	}
+	if page == "" || !strings.HasPrefix(page, "/") ||
+		len(page) > maxBeaconLength || len(referrer) > maxBeaconLength {
+		return http.StatusBadRequest, nil
+	}
+
+	view := View{
+		Time:     time.Now().UTC(),
+		Path:     page,
+		Referrer: referrerHost(referrer, r.Host),
+		IP:       AnonymizeIP(clientIP(r)),
+		Agent:    agent,
+	}
+	if err := c.Store.Record(view); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return 0, nil
+}
+
+// export writes a report of the days given by the from and
+// to query parameters (the last 30 days by default), as JSON
+// or, if the format parameter is "csv", as CSV with one row
+// for each path of each day.
+func (c Collect) export(w http.ResponseWriter, r *http.Request) (int, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(c.Token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		admin.Error(w, http.StatusUnauthorized, "missing or wrong token")
+		return 0, nil
+	}
+	if r.Method != "GET" {
+		admin.Error(w, http.StatusMethodNotAllowed, "use GET")
+		return 0, nil
+	}
+
+	query := r.URL.Query()
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -29)
+	var err error
+	if s := query.Get("to"); s != "" {
+		if to, err = time.Parse(dateFormat, s); err != nil {
+			admin.Error(w, http.StatusBadRequest, "invalid to date; use YYYY-MM-DD")
+			return 0, nil
+		}
+		from = to.AddDate(0, 0, -29)
+	}
+	if s := query.Get("from"); s != "" {
+		if from, err = time.Parse(dateFormat, s); err != nil {
+			admin.Error(w, http.StatusBadRequest, "invalid from date; use YYYY-MM-DD")
+			return 0, nil
+		}
+	}
+	if to.Before(from) || to.Sub(from) > maxExportDays*24*time.Hour {
+		admin.Error(w, http.StatusBadRequest, "dates must be in order and at most "+strconv.Itoa(maxExportDays)+" days apart")
+		return 0, nil
+	}
+
+	report, err := c.Store.Report(from, to)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	switch query.Get("format") {
+	case "", "json":
+		admin.WriteJSON(w, http.StatusOK, report)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename=views-"+report.From+"-"+report.To+".csv")
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"date", "path", "views"})
+		for _, day := range report.Days {
+			for _, path := range day.Paths {
+				cw.Write([]string{day.Date, path.Name, strconv.Itoa(path.Views)})
+			}
+		}
+		cw.Flush()
+	default:
+		admin.Error(w, http.StatusBadRequest, "unknown format; use json or csv")
+	}
+	return 0, nil
+}
+
+// clientIP returns the IP address of the client of r.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// AnonymizeIP returns ip with its host part zeroed: the last
+// byte of an IPv4 address, or all but the first 48 bits of an
+// IPv6 address. It returns "" if ip isn't an IP address.
+func AnonymizeIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// AgentClass returns the class of the user agent ua:
+// "bot", "mobile", "tablet", "desktop" or "other".
+func AgentClass(ua string) string {
+	lower := strings.ToLower(ua)
+	switch {
+	case lower == "":
+		return "other"
+	case strings.Contains(lower, "bot") || strings.Contains(lower, "crawl") ||
+		strings.Contains(lower, "spider") || strings.Contains(lower, "curl") ||
+		strings.Contains(lower, "wget") || strings.Contains(lower, "headless"):
+		return "bot"
+	case strings.Contains(lower, "ipad") || strings.Contains(lower, "tablet") ||
+		strings.Contains(lower, "android") && !strings.Contains(lower, "mobile"):
+		return "tablet"
+	case strings.Contains(lower, "mobi") || strings.Contains(lower, "iphone"):
+		return "mobile"
+	case strings.Contains(lower, "windows") || strings.Contains(lower, "macintosh") ||
+		strings.Contains(lower, "x11") || strings.Contains(lower, "linux"):
+		return "desktop"
+	}
+	return "other"
+}
+
+// referrerHost returns the host of the referrer URL ref, or ""
+// if there is none or it is the site itself (whose host is host).
+func referrerHost(ref, host string) string {
+	u, err := url.Parse(ref)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	if siteHost, _, err := net.SplitHostPort(host); err == nil {
+		host = siteHost
+	}
+	if strings.EqualFold(u.Hostname(), host) {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
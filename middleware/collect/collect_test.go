@@ -0,0 +1,157 @@
+package collect
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+	mwtest "github.com/mholt/caddy/middleware/testing"
+)
+
+const (
+	firefox = "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0"
+	iphone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148"
+)
+
+func TestCollect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_collect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := OpenStore(filepath.Join(dir, "views.log"), middleware.FilePerms{})
+	defer store.Close()
+
+	c := Collect{Next: &mwtest.Handler{Body: "next"}, Path: "/_collect", Store: store, Token: "secret"}
+
+	for i, test := range []struct {
+		method         string
+		url            string
+		ua             string
+		remote         string
+		referer        string
+		expectedStatus int
+	}{
+		{"POST", "/_collect?p=/blog/&r=https://news.example.net/item", firefox, "203.0.113.7:1234", "", 204},
+		{"GET", "/_collect?p=/blog/&r=http://example.com/", iphone, "203.0.113.9:1234", "", 204},
+		{"GET", "/_collect", firefox, "[2001:db8:1:2::5]:1234", "http://example.com/about?x=1", 204},
+		{"GET", "/_collect?p=/blog/", "Googlebot/2.1", "198.51.100.1:1234", "", 204},
+		{"GET", "/_collect?p=blog", firefox, "198.51.100.1:1234", "", 400},
+		{"GET", "/_collect?p=/" + strings.Repeat("a", 1024), firefox, "198.51.100.1:1234", "", 400},
+		{"GET", "/_collect?p=/blog/&r=https://example.net/" + strings.Repeat("a", 1024), firefox, "198.51.100.1:1234", "", 400},
+		{"GET", "/_collect", firefox, "198.51.100.1:1234", "http://example.com/" + strings.Repeat("a", 1024), 400},
+		{"PUT", "/_collect?p=/blog/", firefox, "198.51.100.1:1234", "", 405},
+		{"GET", "/blog/", firefox, "198.51.100.1:1234", "", 200},
+	} {
+		r := httptest.NewRequest(test.method, test.url, nil)
+		r.Host = "example.com"
+		r.RemoteAddr = test.remote
+		r.Header.Set("User-Agent", test.ua)
+		if test.referer != "" {
+			r.Header.Set("Referer", test.referer)
+		}
+		rec := mwtest.Serve(c, r)
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, rec.Code)
+		}
+	}
+
+	body, err := ioutil.ReadFile(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 views recorded, got %d: %s", len(lines), body)
+	}
+	var v View
+	if err := json.Unmarshal([]byte(lines[0]), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Path != "/blog/" || v.Referrer != "news.example.net" || v.IP != "203.0.113.0" || v.Agent != "desktop" {
+		t.Errorf("Expected anonymized view, got %+v", v)
+	}
+
+	// JSON export
+	r := httptest.NewRequest("GET", "/_collect/export", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	rec := mwtest.Serve(c, r)
+	rec.AssertStatus(t, http.StatusOK)
+	var report Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Views != 3 || report.Visitors != 3 || len(report.Days) != 1 {
+		t.Errorf("Expected 3 views by 3 visitors on 1 day, got %+v", report)
+	}
+	if len(report.Paths) != 2 || report.Paths[0] != (Count{"/blog/", 2}) {
+		t.Errorf("Expected /blog/ to be the top path, got %v", report.Paths)
+	}
+	if len(report.Referrers) != 1 || report.Agents["mobile"] != 1 {
+		t.Errorf("Expected the site's own referrer to be left out, got %v and %v", report.Referrers, report.Agents)
+	}
+
+	// CSV export
+	r = httptest.NewRequest("GET", "/_collect/export?format=csv", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	rec = mwtest.Serve(c, r)
+	rec.AssertStatus(t, http.StatusOK)
+	rec.AssertBodyContains(t, time.Now().UTC().Format(dateFormat)+",/blog/,2\n")
+
+	// export errors
+	for i, test := range []struct {
+		url, token     string
+		expectedStatus int
+	}{
+		{"/_collect/export", "", 401},
+		{"/_collect/export", "wrong", 401},
+		{"/_collect/export?from=yesterday", "secret", 400},
+		{"/_collect/export?from=2020-01-02&to=2020-01-01", "secret", 400},
+		{"/_collect/export?from=2020-01-01&to=2022-01-01", "secret", 400},
+		{"/_collect/export?format=xml", "secret", 400},
+	} {
+		r := httptest.NewRequest("GET", test.url, nil)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		if rec := mwtest.Serve(c, r); rec.Code != test.expectedStatus {
+			t.Errorf("Export test %d: Expected status %d, got %d", i, test.expectedStatus, rec.Code)
+		}
+	}
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	for i, test := range []struct{ ip, expected string }{
+		{"203.0.113.77", "203.0.113.0"},
+		{"2001:db8:aaaa:bbbb::1", "2001:db8:aaaa::"},
+		{"::ffff:203.0.113.77", "203.0.113.0"},
+		{"not an ip", ""},
+	} {
+		if got := AnonymizeIP(test.ip); got != test.expected {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.expected, got)
+		}
+	}
+}
+
+func TestAgentClass(t *testing.T) {
+	for i, test := range []struct{ ua, expected string }{
+		{firefox, "desktop"},
+		{iphone, "mobile"},
+		{"Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X)", "tablet"},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) Mobile Safari/537.36", "mobile"},
+		{"Mozilla/5.0 (compatible; bingbot/2.0)", "bot"},
+		{"curl/8.0", "bot"},
+		{"", "other"},
+	} {
+		if got := AgentClass(test.ua); got != test.expected {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.expected, got)
+		}
+	}
+}
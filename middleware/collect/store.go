@@ -0,0 +1,208 @@
+package collect
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// View is a recorded page view.
+type View struct {
+	Time     time.Time `json:"time"`
+	Path     string    `json:"path"`
+	Referrer string    `json:"referrer,omitempty"` // host of the referring site
+	IP       string    `json:"ip"`                 // anonymized
+	Agent    string    `json:"agent"`              // the class of user agent, like "mobile"
+}
+
+// Store keeps page views in a file, one JSON object per line.
+// Views are only appended, so the file can be rotated or
+// trimmed by external tools.
+type Store struct {
+	path  string
+	perms middleware.FilePerms
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Stores are shared by path, so that sites (and reloads of a
+// site) that collect into the same file don't interleave
+// partial lines.
+var (
+	stores   = make(map[string]*Store)
+	storesMu sync.Mutex
+)
+
+// OpenStore returns the store kept in the file at path.
+func OpenStore(path string, perms middleware.FilePerms) *Store {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if s, ok := stores[path]; ok {
+		return s
+	}
+	s := &Store{path: path, perms: perms}
+	stores[path] = s
+	return s
+}
+
+// Record appends v to the store.
+func (s *Store) Record(v View) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		s.file, err = s.perms.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = s.file.Write(line)
+	return err
+}
+
+// Close closes the file; it is opened again by the next Record.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Count is the number of views of something, like a path.
+type Count struct {
+	Name  string `json:"name"`
+	Views int    `json:"views"`
+}
+
+// Day is the views of one day.
+type Day struct {
+	Date     string  `json:"date"`
+	Views    int     `json:"views"`
+	Visitors int     `json:"visitors"`
+	Paths    []Count `json:"paths"`
+}
+
+// Report is the views between two dates, added up.
+type Report struct {
+	From      string         `json:"from"`
+	To        string         `json:"to"`
+	Views     int            `json:"views"`
+	Visitors  int            `json:"visitors"` // unique per day, summed
+	Paths     []Count        `json:"paths"`
+	Referrers []Count        `json:"referrers"`
+	Agents    map[string]int `json:"agents"`
+	Days      []Day          `json:"days"`
+}
+
+// dateFormat is how days are written in reports.
+const dateFormat = "2006-01-02"
+
+// Report adds up the views from the start of day from to the
+// end of day to, in UTC. Visitors are told apart by their
+// anonymized IP and user agent class, so they are only
+// approximately unique.
+func (s *Store) Report(from, to time.Time) (Report, error) {
+	from = from.UTC().Truncate(24 * time.Hour)
+	to = to.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	report := Report{
+		From:   from.Format(dateFormat),
+		To:     to.Add(-time.Hour).Format(dateFormat),
+		Agents: make(map[string]int),
+	}
+
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return report, nil
+	}
+	if err != nil {
+		return report, err
+	}
+	defer file.Close()
+
+	paths := make(map[string]int)
+	referrers := make(map[string]int)
+	days := make(map[string]*dayCounts)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var v View
+		if json.Unmarshal(scanner.Bytes(), &v) != nil {
+			continue // a line cut short by a crash
+		}
+		if v.Time.Before(from) || !v.Time.Before(to) {
+			continue
+		}
+
+		report.Views++
+		paths[v.Path]++
+		if v.Referrer != "" {
+			referrers[v.Referrer]++
+		}
+		report.Agents[v.Agent]++
+
+		date := v.Time.UTC().Format(dateFormat)
+		day, ok := days[date]
+		if !ok {
+			day = &dayCounts{paths: make(map[string]int), visitors: make(map[string]bool)}
+			days[date] = day
+		}
+		day.views++
+		day.paths[v.Path]++
+		day.visitors[v.IP+" "+v.Agent] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return report, err
+	}
+
+	report.Paths = counts(paths)
+	report.Referrers = counts(referrers)
+	report.Days = []Day{}
+	for date, day := range days {
+		report.Days = append(report.Days, Day{
+			Date:     date,
+			Views:    day.views,
+			Visitors: len(day.visitors),
+			Paths:    counts(day.paths),
+		})
+		report.Visitors += len(day.visitors)
+	}
+	sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Date < report.Days[j].Date })
+
+	return report, nil
+}
+
+type dayCounts struct {
+	views    int
+	paths    map[string]int
+	visitors map[string]bool
+}
+
+// counts returns the counts in m, most views first.
+func counts(m map[string]int) []Count {
+	list := make([]Count, 0, len(m))
+	for name, views := range m {
+		list = append(list, Count{Name: name, Views: views})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Views != list[j].Views {
+			return list[i].Views > list[j].Views
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// ConfinedDir is like http.Dir, except that it refuses to open any
+// file which resolves, after following symbolic links, to a path
+// outside of the directory. This keeps links inside the site root
+// from exposing the rest of the file system.
+//
+// Files are opened with os.Root, which resolves each element of
+// the path relative to the directory it is in, so a link that is
+// swapped in while the file is being opened can't lead out of the
+// directory either.
+type ConfinedDir string
+
+// Open implements http.FileSystem. Files outside the directory
+// are reported as not existing.
+func (d ConfinedDir) Open(name string) (http.File, error) {
+	if filepath.Separator != '/' && strings.ContainsRune(name, filepath.Separator) ||
+		strings.Contains(name, "\x00") {
+		return nil, os.ErrNotExist
+	}
+
+	root, err := os.OpenRoot(string(d))
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	rel := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if rel == "" {
+		rel = "."
+	}
+	f, err := root.Open(filepath.FromSlash(rel))
+	if err != nil && escapes(err) {
+		// os.Root doesn't follow absolute links, even to files
+		// inside it; those are resolved here, and the file is
+		// still opened through root, so it can't lead out
+		if resolved, ok := d.resolve(rel); ok {
+			f, err = root.Open(resolved)
+		}
+	}
+	if err != nil {
+		if escapes(err) {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// resolve returns rel, a slash-separated path relative to d, with
+// the symbolic links in it followed, relative to d again. It returns
+// false if the path can't be resolved or leads out of d.
+func (d ConfinedDir) resolve(rel string) (string, bool) {
+	dir, err := filepath.EvalSymlinks(string(d))
+	if err != nil {
+		return "", false
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(dir, filepath.FromSlash(rel)))
+	if err != nil {
+		return "", false
+	}
+	rel, err = filepath.Rel(dir, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// escapes returns true if err is the error os.Root gives for
+// a path that leads out of it. Errors from the operating system
+// carry an errno; the one for escaping the root does not.
+func escapes(err error) bool {
+	var errno syscall.Errno
+	return !errors.As(err, &errno) && !os.IsNotExist(err) && !os.IsPermission(err)
+}
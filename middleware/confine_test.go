@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfinedDir(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "caddy_confined")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	root := filepath.Join(tmp, "site")
+	for _, dir := range []string{root, filepath.Join(root, "sub")} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(tmp, "secret.txt"), filepath.Join(root, "sub", "page.html")} {
+		if err := ioutil.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(root, "escape.txt"):   filepath.Join(tmp, "secret.txt"),
+		filepath.Join(root, "up"):           tmp,
+		filepath.Join(root, "inside.html"):  filepath.Join(root, "sub", "page.html"),
+		filepath.Join(root, "relative.txt"): filepath.Join("..", "secret.txt"),
+		filepath.Join(root, "sibling.html"): filepath.Join("sub", "page.html"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("Can't create symlinks: %v", err)
+		}
+	}
+
+	dir := ConfinedDir(root)
+	for i, test := range []struct {
+		name     string
+		shouldOK bool
+	}{
+		{"/", true},
+		{"/sub/page.html", true},
+		{"/inside.html", true},
+		{"/sibling.html", true},
+		{"/relative.txt", false},
+		{"/../secret.txt", false},
+		{"/escape.txt", false},
+		{"/up/secret.txt", false},
+		{"/up", false},
+		{"/missing.txt", false},
+	} {
+		f, err := dir.Open(test.name)
+		if test.shouldOK && err != nil {
+			t.Errorf("Test %d: Expected to open %s, got error: %v", i, test.name, err)
+		}
+		if !test.shouldOK {
+			if err == nil {
+				t.Errorf("Test %d: Expected not to open %s, but did", i, test.name)
+			} else if !os.IsNotExist(err) {
+				t.Errorf("Test %d: Expected not-exist error for %s, got: %v", i, test.name, err)
+			}
+		}
+		if f != nil {
+			f.Close()
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Package content provides middleware that controls how browsers
+// treat responses: the charset of text and whether files are
+// downloaded rather than shown.
+package content
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Charset is middleware that sets the charset parameter of the
+// Content-Type of text responses, replacing any charset the
+// response already had.
+type Charset struct {
+	Next  middleware.Handler
+	Rules []CharsetRule
+}
+
+// CharsetRule sets the charset of text responses to requests
+// for paths under Path with one of Extensions, or any
+// extension if there are none.
+type CharsetRule struct {
+	Path       string
+	Extensions []string
+	Charset    string
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (c Charset) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, rule := range c.Rules {
+		if matches(r.URL.Path, rule.Path, rule.Extensions) {
+			cw := &charsetWriter{ResponseWriter: w, charset: rule.Charset}
+			status, err := c.Next.ServeHTTP(cw, r)
+			cw.finish()
+			return status, err
+		}
+	}
+	return c.Next.ServeHTTP(w, r)
+}
+
+// IsText returns true if responses of mediaType are text
+// that a charset applies to.
+func IsText(mediaType string) bool {
+	switch mediaType {
+	case "application/javascript", "application/xml", "image/svg+xml":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/")
+}
+
+// charsetWriter sets the charset in the Content-Type header
+// just before the header is written. If there is no Content-Type
+// yet, the header is held back until the body can be sniffed.
+type charsetWriter struct {
+	http.ResponseWriter
+	charset     string
+	status      int // held back, if not 0
+	wroteHeader bool
+}
+
+// WriteHeader holds status back if the body must be sniffed to
+// find the Content-Type. Informational (1xx) responses come before
+// the final one, so they are passed on as they are.
+func (w *charsetWriter) WriteHeader(status int) {
+	if status < 200 && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.wroteHeader || w.status != 0 {
+		return
+	}
+	if w.Header().Get("Content-Type") == "" && status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified {
+		w.status = status
+		return
+	}
+	w.writeHeader(status)
+}
+
+func (w *charsetWriter) writeHeader(status int) {
+	w.wroteHeader = true
+	w.setCharset()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *charsetWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			// net/http would sniff it after we could see it
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.writeHeader(w.status)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// finish writes the header if it was held back
+// for a body that never came.
+func (w *charsetWriter) finish() {
+	if !w.wroteHeader && w.status != 0 {
+		w.writeHeader(w.status)
+	}
+}
+
+// ReadFrom lets the file server still use sendfile.
+func (w *charsetWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok && w.wroteHeader {
+		return rf.ReadFrom(src)
+	}
+	// hide ReadFrom, or Copy would call it again
+	return io.Copy(struct{ io.Writer }{w}, src)
+}
+
+func (w *charsetWriter) Flush() {
+	w.finish()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *charsetWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("not a Hijacker")
+}
+
+func (w *charsetWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return nil
+}
+
+func (w *charsetWriter) setCharset() {
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil || !IsText(mediaType) {
+		return
+	}
+	params["charset"] = w.charset
+	w.Header().Set("Content-Type", mime.FormatMediaType(mediaType, params))
+}
+
+// Attachment is middleware that has browsers download files
+// rather than show them, by setting Content-Disposition.
+type Attachment struct {
+	Next  middleware.Handler
+	Rules []AttachmentRule
+}
+
+// AttachmentRule makes attachments of the files under Path
+// with one of Extensions, or any extension if there are none.
+type AttachmentRule struct {
+	Path       string
+	Extensions []string
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (a Attachment) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, rule := range a.Rules {
+		if matches(r.URL.Path, rule.Path, rule.Extensions) {
+			w.Header().Set("Content-Disposition", Disposition(path.Base(r.URL.Path)))
+			break
+		}
+	}
+	return a.Next.ServeHTTP(w, r)
+}
+
+// Disposition returns the value of a Content-Disposition header
+// for downloading a file named filename. Names that aren't plain
+// ASCII are encoded as RFC 6266 says, which browsers understand.
+func Disposition(filename string) string {
+	if v := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); v != "" {
+		return v
+	}
+	return "attachment"
+}
+
+// matches returns true if urlPath is under scope and has
+// one of exts, or if exts is empty. Directories don't match.
+func matches(urlPath, scope string, exts []string) bool {
+	if !middleware.Path(urlPath).Matches(scope) || strings.HasSuffix(urlPath, "/") {
+		return false
+	}
+	if len(exts) == 0 {
+		return true
+	}
+	ext := path.Ext(urlPath)
+	for _, e := range exts {
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (c Charset) Scopes() []string {
+	scopes := make([]string, len(c.Rules))
+	for i, rule := range c.Rules {
+		scopes[i] = rule.Path
+	}
+	return scopes
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (a Attachment) Scopes() []string {
+	scopes := make([]string, len(a.Rules))
+	for i, rule := range a.Rules {
+		scopes[i] = rule.Path
+	}
+	return scopes
+}
@@ -0,0 +1,101 @@
+package content
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+	mwtest "github.com/mholt/caddy/middleware/testing"
+)
+
+func TestCharset(t *testing.T) {
+	c := Charset{Rules: []CharsetRule{
+		{Path: "/legacy", Extensions: []string{".txt"}, Charset: "iso-8859-1"},
+	}}
+
+	for i, test := range []struct {
+		path        string
+		contentType string
+		body        string
+		expected    string
+	}{
+		{"/legacy/a.txt", "text/plain; charset=utf-8", "x", "text/plain; charset=iso-8859-1"},
+		{"/legacy/a.txt", "", "plain text", "text/plain; charset=iso-8859-1"},
+		{"/legacy/a.txt", "image/png", "x", "image/png"},
+		{"/legacy/a.html", "text/html; charset=utf-8", "x", "text/html; charset=utf-8"},
+		{"/other/a.txt", "text/plain", "x", "text/plain"},
+	} {
+		next := &mwtest.Handler{Body: test.body}
+		if test.contentType != "" {
+			next.Header = http.Header{"Content-Type": {test.contentType}}
+		}
+		c.Next = next
+		rec := mwtest.Serve(c, httptest.NewRequest("GET", test.path, nil))
+		if got := rec.Header().Get("Content-Type"); got != test.expected {
+			t.Errorf("Test %d: Expected Content-Type %q, got %q", i, test.expected, got)
+		}
+	}
+}
+
+func TestAttachment(t *testing.T) {
+	a := Attachment{
+		Next:  &mwtest.Handler{},
+		Rules: []AttachmentRule{{Path: "/files", Extensions: []string{".zip"}}},
+	}
+
+	for i, test := range []struct {
+		path     string
+		expected string
+	}{
+		{"/files/a.zip", `attachment; filename=a.zip`},
+		{"/files/my report.ZIP", `attachment; filename="my report.ZIP"`},
+		{"/files/café.zip", `attachment; filename*=utf-8''caf%C3%A9.zip`},
+		{"/files/a.txt", ""},
+		{"/files/", ""},
+		{"/other/a.zip", ""},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.URL.Path = test.path
+		rec := mwtest.Serve(a, r)
+		if got := rec.Header().Get("Content-Disposition"); got != test.expected {
+			t.Errorf("Test %d: Expected Content-Disposition %q, got %q", i, test.expected, got)
+		}
+	}
+}
+
+func TestCharsetNoBody(t *testing.T) {
+	c := Charset{
+		Next:  &mwtest.Handler{Status: http.StatusAccepted},
+		Rules: []CharsetRule{{Path: "/", Charset: "utf-8"}},
+	}
+	rec := mwtest.Serve(c, httptest.NewRequest("GET", "/", nil))
+	rec.AssertStatus(t, http.StatusAccepted)
+}
+
+func TestCharsetEarlyHints(t *testing.T) {
+	c := Charset{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.WriteHeader(http.StatusEarlyHints)
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, "plain text")
+			return http.StatusCreated, nil
+		}),
+		Rules: []CharsetRule{{Path: "/", Charset: "utf-8"}},
+	}
+	srv := httptest.NewServer(mwtest.HTTPHandler(c))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected final status %d after a 103, got %d", http.StatusCreated, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Expected Content-Type with charset, got %q", ct)
+	}
+}
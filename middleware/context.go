@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// StatusClientClosedRequest is the status reported when the client
+// went away before its response was ready. No response is sent: the
+// errors and log middleware and the server don't write an error page
+// for it, but the status makes such requests stand out in the logs.
+const StatusClientClosedRequest = 499
+
+// ContextStatus returns the status to report for a request that was
+// abandoned because ctx, the request's context, is done: 504 if the
+// site's request timeout passed, or StatusClientClosedRequest if the
+// client disconnected. It returns 0 if ctx is not done.
+//
+// Handlers doing slow work on behalf of a request, such as waiting
+// for a backend, should stop once the request's context is done and
+// return this status with ctx.Err().
+func ContextStatus(ctx context.Context) int {
+	switch ctx.Err() {
+	case nil:
+		return 0
+	case context.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return StatusClientClosedRequest
+	}
+}
@@ -0,0 +1,100 @@
+// Package cron runs jobs, such as commands or housekeeping for a
+// site, on a schedule within the server process.
+package cron
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Job is a task that runs on a schedule.
+type Job struct {
+	Name     string        // for the log
+	Schedule Schedule      // when to run
+	Jitter   time.Duration // most to delay each run by, at random
+	Run      func() error
+
+	mu      sync.Mutex
+	running bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// now is time.Now, but tests can change it.
+var now = time.Now
+
+// Start starts running j on its schedule, until Stop is called.
+func (j *Job) Start() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.stop == nil {
+		j.stop, j.done = make(chan struct{}), make(chan struct{})
+		go j.loop(j.stop, j.done)
+	}
+	return nil
+}
+
+// Stop stops running j on its schedule. It doesn't wait for
+// a run already started to finish.
+func (j *Job) Stop() error {
+	j.mu.Lock()
+	stop, done := j.stop, j.done
+	j.stop, j.done = nil, nil
+	j.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	return nil
+}
+
+func (j *Job) loop(stop, done chan struct{}) {
+	defer close(done)
+	for {
+		next := j.Schedule.Next(now())
+		if next.IsZero() {
+			log.Printf("[WARNING] cron: %s will never run again", j.Name)
+			return
+		}
+		if j.Jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(j.Jitter))))
+		}
+
+		timer := time.NewTimer(next.Sub(now()))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		j.trigger()
+	}
+}
+
+// trigger runs j in the background, unless its last run hasn't
+// finished yet; runs never overlap, late ones are skipped.
+func (j *Job) trigger() {
+	j.mu.Lock()
+	if j.running {
+		j.mu.Unlock()
+		log.Printf("[WARNING] cron: %s is still running; skipping this run", j.Name)
+		return
+	}
+	j.running = true
+	j.mu.Unlock()
+
+	go func() {
+		start := now()
+		err := j.Run()
+		j.mu.Lock()
+		j.running = false
+		j.mu.Unlock()
+		if err != nil {
+			log.Printf("[ERROR] cron: %s: %v (after %v)", j.Name, err, now().Sub(start))
+			return
+		}
+		log.Printf("[INFO] cron: %s done in %v", j.Name, now().Sub(start))
+	}()
+}
@@ -0,0 +1,97 @@
+package cron
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+
+	for i, test := range []struct {
+		spec     string
+		from     string
+		expected string
+	}{
+		{"* * * * *", "2016-03-01 10:00", "2016-03-01 10:01"},
+		{"*/15 * * * *", "2016-03-01 10:07", "2016-03-01 10:15"},
+		{"0 4 * * *", "2016-03-01 10:07", "2016-03-02 04:00"},
+		{"30 2 1 * *", "2016-03-01 10:07", "2016-04-01 02:30"},
+		{"0 0 * * 1-5", "2016-03-04 10:00", "2016-03-07 00:00"}, // Friday to Monday
+		{"0 0 * * 7", "2016-03-04 10:00", "2016-03-06 00:00"},   // Sunday
+		{"0 0 13 * 5", "2016-03-01 10:00", "2016-03-04 00:00"},  // the 13th or a Friday
+		{"0 12 29 2 *", "2016-03-01 10:00", "2020-02-29 12:00"},
+		{"5,10 1-2 * * *", "2016-03-01 01:07", "2016-03-01 01:10"},
+		{"@hourly", "2016-03-01 10:07", "2016-03-01 11:00"},
+		{"@daily", "2016-03-01 10:07", "2016-03-02 00:00"},
+		{"@weekly", "2016-03-01 10:07", "2016-03-06 00:00"},
+		{"@monthly", "2016-03-01 10:07", "2016-04-01 00:00"},
+		{"@every 90m", "2016-03-01 10:07", "2016-03-01 11:37"},
+	} {
+		s, err := Parse(test.spec)
+		if err != nil {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+			continue
+		}
+		if next := s.Next(at(test.from)); !next.Equal(at(test.expected)) {
+			t.Errorf("Test %d: Expected %s after %s to be %s, got %s", i, test.spec, test.from, test.expected, next)
+		}
+	}
+
+	if s, _ := Parse("0 0 30 2 *"); !s.Next(time.Now()).IsZero() {
+		t.Errorf("Expected a schedule for February 30th never to run")
+	}
+
+	for i, spec := range []string{
+		"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *",
+		"* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *",
+		"@every", "@every soon", "@every 10ms", "@yearly",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		}
+	}
+}
+
+func TestJob(t *testing.T) {
+	var runs int32
+	release := make(chan struct{})
+	j := &Job{
+		Name:     "test",
+		Schedule: every(10 * time.Millisecond),
+		Run: func() error {
+			atomic.AddInt32(&runs, 1)
+			<-release
+			return errors.New("failed")
+		},
+	}
+	j.Start()
+	time.Sleep(100 * time.Millisecond)
+	j.Stop()
+
+	// the first run blocks, so the others must have been skipped
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Errorf("Expected overlapping runs to be skipped, got %d runs", n)
+	}
+	close(release)
+
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Errorf("Expected no runs after the job stopped, got %d runs", n)
+	}
+
+	j.Start()
+	time.Sleep(50 * time.Millisecond)
+	j.Stop()
+	if n := atomic.LoadInt32(&runs); n < 2 {
+		t.Errorf("Expected the job to run again once restarted, got %d runs", n)
+	}
+}
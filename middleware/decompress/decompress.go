@@ -0,0 +1,170 @@
+// Package decompress provides middleware that decompresses request
+// bodies sent with a Content-Encoding, so that the handlers after it
+// (like proxy and fastcgi) get them as plain bodies.
+package decompress
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Defaults for the limits on how much a body may expand.
+const (
+	DefaultMaxSize  = 10 << 20 // 10MB
+	DefaultMaxRatio = 100
+)
+
+// ErrTooLarge is returned when reading a decompressed body that
+// goes over the limits. It is what a zip bomb looks like.
+var ErrTooLarge = errors.New("decompressed request body too large")
+
+// Decompress is middleware that decompresses request bodies
+// encoded with gzip or deflate. Bodies in other encodings are
+// passed on as they are.
+type Decompress struct {
+	Next  middleware.Handler
+	Paths []string
+
+	// A body may decompress to at most MaxSize bytes, and
+	// to at most MaxRatio times as many bytes as were read
+	// of it; a zero value means the default
+	MaxSize  int64
+	MaxRatio int64
+
+	// Name of the limit in middleware.LimitHits,
+	// like "example.com decompress"
+	Name string
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (d Decompress) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" || r.Body == nil || !d.matches(r.URL.Path) {
+		return d.Next.ServeHTTP(w, r)
+	}
+
+	compressed := &countingReader{r: r.Body}
+	buffered := bufio.NewReader(compressed)
+	var body io.Reader
+	switch encoding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(buffered)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		body = zr
+	case "deflate":
+		// properly zlib, but some clients send raw deflate
+		if header, err := buffered.Peek(2); err == nil && isZlibHeader(header) {
+			zr, err := zlib.NewReader(buffered)
+			if err != nil {
+				return http.StatusBadRequest, err
+			}
+			body = zr
+		} else {
+			body = flate.NewReader(buffered)
+		}
+	default:
+		return d.Next.ServeHTTP(w, r)
+	}
+
+	maxSize, maxRatio := d.MaxSize, d.MaxRatio
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxRatio <= 0 {
+		maxRatio = DefaultMaxRatio
+	}
+	limited := &limitedReader{
+		r:          body,
+		closer:     r.Body,
+		compressed: compressed,
+		maxSize:    maxSize,
+		maxRatio:   maxRatio,
+	}
+
+	r.Body = limited
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+
+	status, err := d.Next.ServeHTTP(w, r)
+	if limited.exceeded {
+		middleware.LimitHits.Add(d.Name, 1)
+		if status >= 400 {
+			return http.StatusRequestEntityTooLarge, ErrTooLarge
+		}
+	}
+	return status, err
+}
+
+// matches returns true if urlPath is in one of the paths.
+func (d Decompress) matches(urlPath string) bool {
+	for _, p := range d.Paths {
+		if middleware.Path(urlPath).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (d Decompress) Scopes() []string {
+	return d.Paths
+}
+
+// isZlibHeader returns true if b starts a zlib stream
+// (RFC 1950) compressed with deflate.
+func isZlibHeader(b []byte) bool {
+	return b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// limitedReader reads a decompressed body until it expands
+// too much, then fails with ErrTooLarge.
+type limitedReader struct {
+	r          io.Reader
+	closer     io.Closer
+	compressed *countingReader
+	n          int64
+	maxSize    int64
+	maxRatio   int64
+	exceeded   bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, ErrTooLarge
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	// a little slack for the first bytes, whose ratio can be high
+	if l.n > l.maxSize || (l.n > 1024 && l.n > l.maxRatio*l.compressed.n) {
+		l.exceeded = true
+		return 0, ErrTooLarge
+	}
+	return n, err
+}
+
+func (l *limitedReader) Close() error {
+	return l.closer.Close()
+}
@@ -0,0 +1,119 @@
+package decompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+	mwtest "github.com/mholt/caddy/middleware/testing"
+)
+
+// echo responds with the request body as it reads it, or
+// with 400 and the error if the body can't be read.
+var echo = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	w.Header().Set("X-Content-Encoding", r.Header.Get("Content-Encoding"))
+	w.Write(body)
+	return http.StatusOK, nil
+})
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	case "flate":
+		var err error
+		w, err = flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	d := Decompress{Next: echo, Paths: []string{"/upload"}}
+	text := []byte(strings.Repeat("hello, world ", 10))
+
+	for i, test := range []struct {
+		path     string
+		encoding string
+		body     []byte
+		status   int
+		expected string
+		encoded  string // Content-Encoding seen by the next handler
+	}{
+		{"/upload", "gzip", compress(t, "gzip", text), 200, string(text), ""},
+		{"/upload", "x-gzip", compress(t, "gzip", text), 200, string(text), ""},
+		{"/upload", "deflate", compress(t, "zlib", text), 200, string(text), ""},
+		{"/upload", "deflate", compress(t, "flate", text), 200, string(text), ""},
+		{"/upload", "", text, 200, string(text), ""},
+		{"/upload", "br", text, 200, string(text), "br"},
+		{"/other", "gzip", []byte("not decompressed"), 200, "not decompressed", "gzip"},
+		{"/upload", "gzip", []byte("not gzip"), 400, "", ""},
+	} {
+		r := httptest.NewRequest("POST", test.path, bytes.NewReader(test.body))
+		if test.encoding != "" {
+			r.Header.Set("Content-Encoding", test.encoding)
+		}
+		rec := mwtest.Serve(d, r)
+		if rec.Returned != test.status {
+			t.Errorf("Test %d: Expected status %d, got %d (%v)", i, test.status, rec.Returned, rec.Err)
+			continue
+		}
+		if test.status != 200 {
+			continue
+		}
+		if got := rec.Body.String(); got != test.expected {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expected, got)
+		}
+		if got := rec.Header().Get("X-Content-Encoding"); got != test.encoded {
+			t.Errorf("Test %d: Expected next handler to see Content-Encoding %q, got %q", i, test.encoded, got)
+		}
+	}
+}
+
+func TestDecompressLimits(t *testing.T) {
+	// a megabyte of zeros compresses to about a kilobyte
+	bomb := compress(t, "gzip", make([]byte, 1<<20))
+
+	for i, test := range []struct {
+		maxSize  int64
+		maxRatio int64
+		status   int
+	}{
+		{0, 0, http.StatusRequestEntityTooLarge}, // default ratio
+		{1 << 19, 10000, http.StatusRequestEntityTooLarge},
+		{2 << 20, 10000, http.StatusOK},
+	} {
+		d := Decompress{Next: echo, Paths: []string{"/"}, MaxSize: test.maxSize, MaxRatio: test.maxRatio, Name: "test decompress"}
+		r := httptest.NewRequest("POST", "/", bytes.NewReader(bomb))
+		r.Header.Set("Content-Encoding", "gzip")
+		rec := mwtest.Serve(d, r)
+		rec.AssertStatus(t, test.status)
+		if test.status == http.StatusRequestEntityTooLarge && rec.Err != ErrTooLarge {
+			t.Errorf("Test %d: Expected ErrTooLarge, got %v", i, rec.Err)
+		}
+	}
+
+	if hits := middleware.LimitHits.Get("test decompress").String(); hits != "2" {
+		t.Errorf("Expected 2 limit hits, got %s", hits)
+	}
+}
@@ -2,6 +2,7 @@
 package errors
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"log"
@@ -12,6 +13,9 @@ import (
 	"time"
 
 	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/i18n"
+	"github.com/mholt/caddy/middleware/logtail"
+	"github.com/mholt/caddy/middleware/toggle"
 )
 
 // ErrorHandler handles HTTP errors (or errors from other middleware).
@@ -20,6 +24,33 @@ type ErrorHandler struct {
 	ErrorPages map[int]string // map of status code to filename
 	LogFile    string
 	Log        *log.Logger
+
+	// Pages for whole classes of status codes, which are used
+	// when ErrorPages has none for a code: ClassPages maps the
+	// first digit of a code (4 for 4xx) to a filename, and
+	// DefaultPage, if not empty, is the page for any other error
+	ClassPages  map[int]string
+	DefaultPage string
+
+	// What to do when a handler panics, and the
+	// site the panic is counted for
+	PanicPolicy middleware.PanicPolicy
+	Site        string
+
+	// If on, error responses are plain text with the error
+	// that caused them, instead of the error pages; if nil,
+	// it is off
+	Debug *toggle.Switch
+
+	// Paths under which clients that prefer JSON or XML, such
+	// as those of an API, get a StructuredError instead of the
+	// error page
+	Structured []string
+
+	// Translations of the default error responses and the
+	// StatusText of templated pages, in the language the
+	// client prefers; English if nil
+	Locales *i18n.Catalog
 }
 
 func (h ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
@@ -29,31 +60,86 @@ func (h ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, er
 
 	if err != nil {
 		h.Log.Printf("%s [ERROR %d %s] %v", time.Now().Format(timeFormat), status, r.URL.Path, err)
+		h.record(r, status, fmt.Sprintf("[ERROR %d %s] %v", status, r.URL.Path, err))
 	}
 
-	if status >= 400 {
-		h.errorPage(w, status)
+	if status >= 400 && status != middleware.StatusClientClosedRequest {
+		h.errorPage(w, r, status, err)
 		return 0, err // status < 400 signals that a response has been written
 	}
 
 	return status, err
 }
 
-// errorPage serves a static error page to w according to the status
+// pagePath returns the filename of the error page for code: the
+// page for code itself, or else for its class, or else the default.
+func (h ErrorHandler) pagePath(code int) (string, bool) {
+	if pagePath, ok := h.ErrorPages[code]; ok {
+		return pagePath, true
+	}
+	if pagePath, ok := h.ClassPages[code/100]; ok {
+		return pagePath, true
+	}
+	return h.DefaultPage, h.DefaultPage != ""
+}
+
+// debug returns true if debug mode is on.
+func (h ErrorHandler) debug() bool {
+	return h.Debug != nil && h.Debug.On()
+}
+
+// errorPage serves an error page to w according to the status
 // code. If there is an error serving the error page, a plaintext error
-// message is written instead, and the extra error is logged.
-func (h ErrorHandler) errorPage(w http.ResponseWriter, code int) {
-	defaultBody := fmt.Sprintf("%d %s", code, http.StatusText(code))
+// message is written instead, and the extra error is logged. Pages
+// whose names end in .tmpl are executed as templates with a PageData
+// for r, code and err; others are static.
+func (h ErrorHandler) errorPage(w http.ResponseWriter, r *http.Request, code int, err error) {
+	tr := h.Locales.Translator(r)
+	defaultBody := fmt.Sprintf("%d %s", code, tr.StatusText(code))
+	defaultResponse := func() {
+		tr.SetHeaders(w.Header())
+		http.Error(w, defaultBody, code)
+	}
+
+	if format := h.structured(r); format != "" {
+		message := http.StatusText(code)
+		if h.debug() && err != nil {
+			message += ": " + err.Error()
+		}
+		writeStructured(w, r, format, code, message)
+		return
+	}
+
+	if h.debug() {
+		if err != nil {
+			defaultBody += "\n\n" + err.Error()
+		}
+		defaultResponse()
+		return
+	}
 
 	// See if an error page for this status code was specified
-	if pagePath, ok := h.ErrorPages[code]; ok {
+	if pagePath, ok := h.pagePath(code); ok {
+		if strings.HasSuffix(pagePath, ".tmpl") {
+			var buf bytes.Buffer
+			if err := renderPage(&buf, pagePath, newPageData(r, code, err, tr)); err != nil {
+				h.Log.Printf("HTTP %d could not render error page %s: %v", code, pagePath, err)
+				defaultResponse()
+				return
+			}
+			tr.SetHeaders(w.Header())
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(code)
+			buf.WriteTo(w)
+			return
+		}
 
 		// Try to open it
 		errorPage, err := os.Open(pagePath)
 		if err != nil {
 			// An error handling an error... <insert grumpy cat here>
 			h.Log.Printf("HTTP %d could not load error page %s: %v", code, pagePath, err)
-			http.Error(w, defaultBody, code)
+			defaultResponse()
 			return
 		}
 		defer errorPage.Close()
@@ -66,14 +152,14 @@ func (h ErrorHandler) errorPage(w http.ResponseWriter, code int) {
 		if err != nil {
 			// Epic fail... sigh.
 			h.Log.Printf("HTTP %d could not respond with %s: %v", code, pagePath, err)
-			http.Error(w, defaultBody, code)
+			defaultResponse()
 		}
 
 		return
 	}
 
 	// Default error response
-	http.Error(w, defaultBody, code)
+	defaultResponse()
 }
 
 func (h ErrorHandler) recovery(w http.ResponseWriter, r *http.Request) {
@@ -81,6 +167,9 @@ func (h ErrorHandler) recovery(w http.ResponseWriter, r *http.Request) {
 	if rec == nil {
 		return
 	}
+	if rec == http.ErrAbortHandler {
+		panic(rec) // the connection is meant to be aborted
+	}
 
 	// Obtain source of panic
 	// From: https://gist.github.com/swdunlop/9629168
@@ -109,7 +198,27 @@ func (h ErrorHandler) recovery(w http.ResponseWriter, r *http.Request) {
 
 	// Currently we don't use the function name, as file:line is more conventional
 	h.Log.Printf("%s [PANIC %s] %s:%d - %v", time.Now().Format(timeFormat), r.URL.String(), file, line, rec)
-	h.errorPage(w, http.StatusInternalServerError)
+	h.record(r, http.StatusInternalServerError, fmt.Sprintf("[PANIC %s] %s:%d - %v", r.URL.String(), file, line, rec))
+	h.PanicPolicy.Handle(h.Site)
+	var err error
+	if h.debug() {
+		err = fmt.Errorf("[PANIC %s] %s:%d - %v", r.URL.String(), file, line, rec)
+	}
+	h.errorPage(w, r, http.StatusInternalServerError, err)
+}
+
+// record keeps an error log entry for the admin API (see logtail).
+func (h ErrorHandler) record(r *http.Request, status int, line string) {
+	logtail.Record(logtail.Entry{
+		Time:   time.Now(),
+		Site:   h.Site,
+		Kind:   "error",
+		Remote: middleware.NewReplacer(r, nil, "").Replace("{remote}"),
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Status: status,
+		Line:   line,
+	})
 }
 
 const DefaultLogFilename = "error.log"
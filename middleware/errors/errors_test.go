@@ -2,8 +2,10 @@ package errors
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -13,6 +15,8 @@ import (
 	"testing"
 
 	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/i18n"
+	"github.com/mholt/caddy/middleware/toggle"
 )
 
 func TestErrors(t *testing.T) {
@@ -86,6 +90,13 @@ func TestErrors(t *testing.T) {
 				http.StatusForbidden, "not_exist_file", notExistErr),
 			expectedErr: nil,
 		},
+		{
+			next:         genErrorHandler(middleware.StatusClientClosedRequest, context.Canceled, ""),
+			expectedCode: middleware.StatusClientClosedRequest,
+			expectedBody: "",
+			expectedLog:  fmt.Sprintf("[ERROR %d %s] %v\n", middleware.StatusClientClosedRequest, "/", context.Canceled),
+			expectedErr:  context.Canceled,
+		},
 	}
 
 	req, err := http.NewRequest("GET", "/", nil)
@@ -123,3 +134,211 @@ func genErrorHandler(status int, err error, body string) middleware.Handler {
 		return status, err
 	})
 }
+
+func TestPanicPolicy(t *testing.T) {
+	panicky := middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		panic("oops")
+	})
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.Buffer{}
+	em := ErrorHandler{Next: panicky, Log: log.New(&buf, "", 0), Site: "errors_test:80"}
+	rec := httptest.NewRecorder()
+	em.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d after recovering, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	if !strings.Contains(buf.String(), "[PANIC /] ") {
+		t.Errorf("Expected the panic to be logged, got %q", buf.String())
+	}
+	if n := middleware.Panics.Get("errors_test:80"); n == nil || n.String() != "1" {
+		t.Errorf("Expected 1 panic to be counted, got %v", n)
+	}
+
+	em.PanicPolicy = middleware.PanicAbort
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("Expected to panic with http.ErrAbortHandler, got %v", rec)
+		}
+	}()
+	em.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestDebug(t *testing.T) {
+	em := ErrorHandler{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusBadGateway, errors.New("backend down")
+		}),
+		DefaultPage: "not_exist_file",
+		Log:         log.New(ioutil.Discard, "", 0),
+		Debug:       toggle.NewSwitch(true),
+	}
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	em.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected status %d, got %d", http.StatusBadGateway, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "backend down") {
+		t.Errorf("Expected the error in the body in debug mode, got %q", rec.Body.String())
+	}
+
+	em.Debug.Set(false)
+	rec = httptest.NewRecorder()
+	em.ServeHTTP(rec, req)
+	if strings.Contains(rec.Body.String(), "backend down") {
+		t.Errorf("Expected no error in the body with debug mode off, got %q", rec.Body.String())
+	}
+
+	em.Next = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		panic("oops")
+	})
+	em.Debug.Set(true)
+	rec = httptest.NewRecorder()
+	em.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), "oops") {
+		t.Errorf("Expected the panic in the body in debug mode, got %q", rec.Body.String())
+	}
+}
+
+func TestTemplatePages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errors_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	page := filepath.Join(dir, "error.tmpl")
+	broken := filepath.Join(dir, "broken.tmpl")
+	if err := ioutil.WriteFile(page, []byte(`{{.StatusCode}} {{.StatusText}} {{.Method}} {{.Path}} [{{.Error}}] {{.Header.Get "X-Test"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(broken, []byte(`{{.Nope}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.Buffer{}
+	em := ErrorHandler{
+		ErrorPages: map[int]string{
+			http.StatusNotFound:            page,
+			http.StatusInternalServerError: page,
+			http.StatusBadGateway:          broken,
+		},
+		Log: log.New(&buf, "", 0),
+	}
+
+	for i, test := range []struct {
+		status       int
+		err          error
+		path         string
+		expectedBody string
+	}{
+		{http.StatusNotFound, nil, "/missing", "404 Not Found GET /missing [] &lt;b&gt;"},
+		{http.StatusInternalServerError, errors.New("db down"), "/<script>", "500 Internal Server Error GET /&lt;script&gt; [db down] &lt;b&gt;"},
+		{http.StatusBadGateway, nil, "/", "502 Bad Gateway\n"},
+	} {
+		status, err := test.status, test.err
+		em.Next = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return status, err
+		})
+		req := httptest.NewRequest("GET", "/", nil)
+		req.URL.Path = test.path
+		req.Header.Set("X-Test", "<b>")
+		rec := httptest.NewRecorder()
+		em.ServeHTTP(rec, req)
+
+		if rec.Code != test.status {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.status, rec.Code)
+		}
+		if body := rec.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+	}
+	if !strings.Contains(buf.String(), "could not render error page") {
+		t.Errorf("Expected the broken page to be logged, got %q", buf.String())
+	}
+}
+
+func TestPagePath(t *testing.T) {
+	em := ErrorHandler{
+		ErrorPages:  map[int]string{http.StatusNotFound: "404.html"},
+		ClassPages:  map[int]string{4: "4xx.html", 5: "5xx.html"},
+		DefaultPage: "error.html",
+	}
+	for i, test := range []struct {
+		code     int
+		expected string
+	}{
+		{http.StatusNotFound, "404.html"},
+		{http.StatusForbidden, "4xx.html"},
+		{http.StatusGatewayTimeout, "5xx.html"},
+		{999, "error.html"},
+	} {
+		if actual, ok := em.pagePath(test.code); !ok || actual != test.expected {
+			t.Errorf("Test %d: Expected page %s for %d, got %s", i, test.expected, test.code, actual)
+		}
+	}
+
+	em.DefaultPage = ""
+	if actual, ok := em.pagePath(999); ok {
+		t.Errorf("Expected no page for 999 without a default, got %s", actual)
+	}
+}
+
+func TestLocalizedErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "errors_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	page := filepath.Join(dir, "error.tmpl")
+	if err := ioutil.WriteFile(page, []byte(`{{.Locale}}: {{.StatusCode}} {{.StatusText}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	em := ErrorHandler{
+		ErrorPages: map[int]string{http.StatusForbidden: page},
+		Log:        log.New(ioutil.Discard, "", 0),
+		Locales:    i18n.Default,
+	}
+
+	for i, test := range []struct {
+		status           int
+		accept           string
+		expectedBody     string
+		expectedLanguage string
+	}{
+		{http.StatusNotFound, "de-DE, en;q=0.5", "404 Nicht gefunden\n", "de"},
+		{http.StatusNotFound, "", "404 Not Found\n", "en"},
+		{http.StatusNotFound, "ja", "404 Not Found\n", "en"},
+		{http.StatusTeapot, "fr", "418 I'm a teapot\n", "fr"},
+		{http.StatusForbidden, "es", "es: 403 Prohibido", "es"},
+	} {
+		status := test.status
+		em.Next = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return status, nil
+		})
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Language", test.accept)
+		rec := httptest.NewRecorder()
+		em.ServeHTTP(rec, req)
+
+		if body := rec.Body.String(); body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+		if got := rec.Header().Get("Content-Language"); got != test.expectedLanguage {
+			t.Errorf("Test %d: Expected Content-Language %q, got %q", i, test.expectedLanguage, got)
+		}
+		if got := rec.Header().Get("Vary"); got != "Accept-Language" {
+			t.Errorf("Test %d: Expected to vary by Accept-Language, got %q", i, got)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package errors
+
+import (
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/mholt/caddy/middleware/i18n"
+)
+
+// PageData is what error page templates are executed with,
+// like {{.StatusCode}} {{.StatusText}} for "404 Not Found".
+type PageData struct {
+	StatusCode int
+	StatusText string // in the client's language, if there are translations
+	Locale     string // of the client's language, like "de"
+	Method     string
+	Path       string
+	Host       string
+
+	// The error that caused the response, if any. It is
+	// meant for the site's own use while developing; it
+	// may say things about the server that visitors
+	// shouldn't see.
+	Error string
+
+	// The request's headers
+	Header http.Header
+}
+
+func newPageData(r *http.Request, code int, err error, tr i18n.Translator) PageData {
+	data := PageData{
+		StatusCode: code,
+		StatusText: tr.StatusText(code),
+		Locale:     tr.Locale,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Host:       r.Host,
+		Header:     r.Header,
+	}
+	if err != nil {
+		data.Error = err.Error()
+	}
+	return data
+}
+
+// renderPage executes the template file at pagePath with data
+// into w. It is parsed each time, like static pages are read
+// each time, so it can be changed without a restart. Being
+// an HTML template, whatever comes from the request is escaped.
+func renderPage(w io.Writer, pagePath string, data PageData) error {
+	body, err := ioutil.ReadFile(pagePath)
+	if err != nil {
+		return err
+	}
+	tpl, err := template.New(pagePath).Parse(string(body))
+	if err != nil {
+		return err
+	}
+	return tpl.Execute(w, data)
+}
@@ -0,0 +1,111 @@
+package errors
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// StructuredError is the body of error responses to clients
+// that prefer JSON or XML to an HTML page, like API clients.
+type StructuredError struct {
+	XMLName   xml.Name `json:"-" xml:"error"`
+	Status    int      `json:"status" xml:"status"`
+	Message   string   `json:"message" xml:"message"`
+	RequestID string   `json:"request_id" xml:"request_id"`
+}
+
+// RequestIDHeader is the header with the ID of the request that
+// a structured error is for, which the client can quote. If the
+// request has one already, from a load balancer in front, it is
+// kept; otherwise one is made up.
+const RequestIDHeader = "X-Request-Id"
+
+// structured returns the format of structured error, "json" or
+// "xml", that the client of r prefers over HTML, or "" if it
+// prefers HTML or structured errors aren't served for r.
+func (h ErrorHandler) structured(r *http.Request) string {
+	for _, scope := range h.Structured {
+		if middleware.Path(r.URL.Path).Matches(scope) {
+			return preferredFormat(r.Header.Get("Accept"))
+		}
+	}
+	return ""
+}
+
+// writeStructured writes an error response with code to w in format.
+func writeStructured(w http.ResponseWriter, r *http.Request, format string, code int, message string) {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" {
+		id = newRequestID()
+	}
+	body := StructuredError{Status: code, Message: message, RequestID: id}
+
+	var b []byte
+	if format == "xml" {
+		b, _ = xml.Marshal(body)
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	} else {
+		b, _ = json.Marshal(body)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	w.Header().Set(RequestIDHeader, id)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	w.Write(b)
+}
+
+// preferredFormat returns "json" or "xml" if the Accept header
+// accept prefers either to HTML, or "" otherwise. Only types named
+// outright count; browsers accept */* too, but want pages.
+func preferredFormat(accept string) string {
+	var html, jsonQ, xmlQ float64
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		switch {
+		case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+			html = maxQ(html, q)
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			jsonQ = maxQ(jsonQ, q)
+		case mediaType == "application/xml" || mediaType == "text/xml":
+			xmlQ = maxQ(xmlQ, q)
+		}
+	}
+	switch {
+	case jsonQ > 0 && jsonQ >= html && jsonQ >= xmlQ:
+		return "json"
+	case xmlQ > 0 && xmlQ >= html:
+		return "xml"
+	}
+	return ""
+}
+
+func maxQ(a, b float64) float64 {
+	if b > a {
+		return b
+	}
+	return a
+}
+
+// newRequestID makes up an ID for a request.
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,73 @@
+package errors
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestStructuredErrors(t *testing.T) {
+	em := ErrorHandler{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusNotFound, nil
+		}),
+		Log:        log.New(ioutil.Discard, "", 0),
+		Structured: []string{"/api"},
+	}
+
+	for i, test := range []struct {
+		path, accept, requestID string
+		expectedType            string
+		expectedBody            string
+	}{
+		{"/api/users", "application/json", "abc123", "application/json; charset=utf-8",
+			`{"status":404,"message":"Not Found","request_id":"abc123"}`},
+		{"/api/users", "application/xml", "abc123", "application/xml; charset=utf-8",
+			`<error><status>404</status><message>Not Found</message><request_id>abc123</request_id></error>`},
+		{"/api/users", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "", "text/plain; charset=utf-8", "404 Not Found\n"},
+		{"/api/users", "*/*", "", "text/plain; charset=utf-8", "404 Not Found\n"},
+		{"/api/users", "text/html;q=0.5, application/problem+json", "x", "application/json; charset=utf-8",
+			`{"status":404,"message":"Not Found","request_id":"x"}`},
+		{"/site", "application/json", "", "text/plain; charset=utf-8", "404 Not Found\n"},
+	} {
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Header.Set("Accept", test.accept)
+		if test.requestID != "" {
+			req.Header.Set(RequestIDHeader, test.requestID)
+		}
+		rec := httptest.NewRecorder()
+		em.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Test %d: Expected status 404, got %d", i, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != test.expectedType {
+			t.Errorf("Test %d: Expected Content-Type %s, got %s", i, test.expectedType, ct)
+		}
+		if rec.Body.String() != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, rec.Body.String())
+		}
+	}
+
+	// a request ID is made up if the request has none
+	req := httptest.NewRequest("GET", "/api", nil)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	em.ServeHTTP(rec, req)
+	var body StructuredError
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected a JSON body, got %q: %v", rec.Body.String(), err)
+	}
+	if body.RequestID == "" || rec.Header().Get(RequestIDHeader) != body.RequestID {
+		t.Errorf("Expected a request ID in the body and header, got %q and %q", body.RequestID, rec.Header().Get(RequestIDHeader))
+	}
+	if strings.Contains(rec.Body.String(), "XMLName") {
+		t.Errorf("Expected no XML fields in JSON, got %q", rec.Body.String())
+	}
+}
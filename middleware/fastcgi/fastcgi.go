@@ -1,15 +1,19 @@
 // Package fastcgi has middleware that acts as a FastCGI client. Requests
 // that get forwarded to FastCGI stop the middleware execution chain.
 // The most common use for this package is to serve PHP websites via php-fpm.
+// Rules can also speak SCGI or uWSGI to their backend instead.
 package fastcgi
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/mholt/caddy/middleware"
 )
@@ -21,6 +25,7 @@ type Handler struct {
 	Root    string
 	AbsRoot string // same as root, but absolute path
 	FileSys http.FileSystem
+	Limit   *middleware.Limiter // caps concurrent FastCGI requests; nil for no limit
 
 	// These are sent to CGI scripts in env variables
 	SoftwareName    string
@@ -57,75 +62,135 @@ func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error)
 				return http.StatusInternalServerError, err
 			}
 
-			// Connect to FastCGI gateway
-			var fcgi *FCGIClient
+			middleware.TraceFrom(r).Note("fastcgi=%s", rule.Address)
 
-			// check if unix socket or tcp
-			if strings.HasPrefix(rule.Address, "/") || strings.HasPrefix(rule.Address, "unix:") {
-				if strings.HasPrefix(rule.Address, "unix:") {
-					rule.Address = rule.Address[len("unix:"):]
+			if !h.Limit.Acquire() {
+				return http.StatusServiceUnavailable, nil
+			}
+			defer h.Limit.Release()
+
+			if rule.Protocol == SCGI || rule.Protocol == UWSGI {
+				resp, err := gatewayRequest(rule.Protocol, rule.Address, r, env)
+				if err != nil {
+					if status := middleware.ContextStatus(r.Context()); status != 0 {
+						return status, err
+					}
+					if err == ErrBodyTooLarge {
+						return http.StatusRequestEntityTooLarge, err
+					}
+					return http.StatusBadGateway, err
 				}
-				fcgi, err = Dial("unix", rule.Address)
-			} else {
-				fcgi, err = Dial("tcp", rule.Address)
+				defer resp.Body.Close()
+				return writeResponse(w, resp)
 			}
+
+			// Connect to FastCGI gateway
+			fcgi, err := rule.dial()
 			if err != nil {
 				return http.StatusBadGateway, err
 			}
 
-			var resp *http.Response
-			contentLength, _ := strconv.Atoi(r.Header.Get("Content-Length"))
-			switch r.Method {
-			case "HEAD":
-				resp, err = fcgi.Head(env)
-			case "GET":
-				resp, err = fcgi.Get(env)
-			case "OPTIONS":
-				resp, err = fcgi.Options(env)
-			case "POST":
-				resp, err = fcgi.Post(env, r.Header.Get("Content-Type"), r.Body, contentLength)
-			case "PUT":
-				resp, err = fcgi.Put(env, r.Header.Get("Content-Type"), r.Body, contentLength)
-			case "PATCH":
-				resp, err = fcgi.Patch(env, r.Header.Get("Content-Type"), r.Body, contentLength)
-			case "DELETE":
-				resp, err = fcgi.Delete(env, r.Header.Get("Content-Type"), r.Body, contentLength)
-			default:
-				return http.StatusMethodNotAllowed, nil
+			// Closing the connection if the request's context is done
+			// interrupts the script's response, so it stops tying up
+			// the connection and a FastCGI slot
+			stop := closeOnDone(r.Context(), fcgi.Close)
+
+			resp, err := h.forward(fcgi, r, env)
+			if fcgi.reused && !fcgi.received && err != errMethodNotAllowed && !hasBody(r) && r.Context().Err() == nil {
+				// the server closed the pooled connection while it sat
+				// idle (e.g. php-fpm's pm.max_requests), so try again
+				// on a fresh one
+				stop()
+				fcgi.Close()
+				if fcgi, err = Dial(parseAddress(rule.Address)); err != nil {
+					return http.StatusBadGateway, err
+				}
+				fcgi.keepAlive = true
+				stop = closeOnDone(r.Context(), fcgi.Close)
+				resp, err = h.forward(fcgi, r, env)
 			}
-
-			if resp.Body != nil {
-				defer resp.Body.Close()
+			defer func() {
+				if !stop() {
+					// it was closed, so don't pool it
+					fcgi.keepAlive = false
+				}
+				rule.release(fcgi)
+			}()
+			if err == errMethodNotAllowed {
+				return http.StatusMethodNotAllowed, nil
 			}
 
 			if err != nil && err != io.EOF {
-				return http.StatusBadGateway, err
-			}
-
-			// Write the response header
-			for key, vals := range resp.Header {
-				for _, val := range vals {
-					w.Header().Add(key, val)
+				if status := middleware.ContextStatus(r.Context()); status != 0 {
+					return status, err
 				}
+				return http.StatusBadGateway, err
 			}
-			w.WriteHeader(resp.StatusCode)
 
-			// Write the response body
-			// TODO: If this has an error, the response will already be
-			// partly written. We should copy out of resp.Body into a buffer
-			// first, then write it to the response...
-			_, err = io.Copy(w, resp.Body)
-			if err != nil {
-				return http.StatusBadGateway, err
+			if resp.Body != nil {
+				defer resp.Body.Close()
 			}
 
-			return 0, nil
+			return writeResponse(w, resp)
 		}
 	}
 
 	return h.Next.ServeHTTP(w, r)
 }
 
+// writeResponse writes the backend's response to w.
+func writeResponse(w http.ResponseWriter, resp *http.Response) (int, error) {
+	// Write the response header
+	for key, vals := range resp.Header {
+		for _, val := range vals {
+			w.Header().Add(key, val)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	// Write the response body
+	// TODO: If this has an error, the response will already be
+	// partly written. We should copy out of resp.Body into a buffer
+	// first, then write it to the response...
+	_, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+
+	return 0, nil
+}
+
+var errMethodNotAllowed = errors.New("method not allowed")
+
+// forward sends r to the FastCGI server over fcgi.
+func (h Handler) forward(fcgi *FCGIClient, r *http.Request, env map[string]string) (*http.Response, error) {
+	contentLength, _ := strconv.Atoi(r.Header.Get("Content-Length"))
+	switch r.Method {
+	case "HEAD":
+		return fcgi.Head(env)
+	case "GET":
+		return fcgi.Get(env)
+	case "OPTIONS":
+		return fcgi.Options(env)
+	case "POST":
+		return fcgi.Post(env, r.Header.Get("Content-Type"), r.Body, contentLength)
+	case "PUT":
+		return fcgi.Put(env, r.Header.Get("Content-Type"), r.Body, contentLength)
+	case "PATCH":
+		return fcgi.Patch(env, r.Header.Get("Content-Type"), r.Body, contentLength)
+	case "DELETE":
+		return fcgi.Delete(env, r.Header.Get("Content-Type"), r.Body, contentLength)
+	default:
+		return nil, errMethodNotAllowed
+	}
+}
+
+// hasBody returns true if r has a request body that
+// would be consumed by forwarding it.
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.ContentLength != 0
+}
+
 func (h Handler) exists(path string) bool {
 	if _, err := os.Stat(h.Root + path); err == nil {
 		return true
@@ -137,9 +202,6 @@ func (h Handler) exists(path string) bool {
 func (h Handler) buildEnv(r *http.Request, rule Rule, fpath string) (map[string]string, error) {
 	var env map[string]string
 
-	// Get absolute path of requested resource
-	absPath := filepath.Join(h.AbsRoot, fpath)
-
 	// Separate remote IP and port; more lenient than net.SplitHostPort
 	var ip, port string
 	if idx := strings.Index(r.RemoteAddr, ":"); idx > -1 {
@@ -150,21 +212,21 @@ func (h Handler) buildEnv(r *http.Request, rule Rule, fpath string) (map[string]
 	}
 
 	// Split path in preparation for env variables
-	splitPos := strings.Index(fpath, rule.SplitPath)
-	var docURI, scriptName, scriptFilename, pathInfo string
-	if splitPos == -1 {
+	var docURI, pathInfo string
+	if pos := splitPos(fpath, rule.SplitPath); pos >= 0 {
+		// Request has the extension; path was split successfully,
+		// and what follows the script is for it to interpret
+		docURI = fpath[:pos]
+		pathInfo = fpath[pos:]
+	} else if len(rule.IndexFiles) > 0 {
 		// Request doesn't have the extension, so assume index file in root
 		docURI = "/" + rule.IndexFiles[0]
-		scriptName = "/" + rule.IndexFiles[0]
-		scriptFilename = filepath.Join(h.AbsRoot, rule.IndexFiles[0])
 		pathInfo = fpath
 	} else {
-		// Request has the extension; path was split successfully
-		docURI = fpath[:splitPos+len(rule.SplitPath)]
-		pathInfo = fpath[splitPos+len(rule.SplitPath):]
-		scriptName = fpath
-		scriptFilename = absPath
+		docURI = fpath
 	}
+	scriptName := docURI
+	scriptFilename := filepath.Join(h.AbsRoot, docURI)
 
 	// Some variables are unused but cleared explicitly to prevent
 	// the parent environment from interfering.
@@ -242,6 +304,98 @@ type Rule struct {
 
 	// Environment Variables
 	EnvVars [][2]string
+
+	// The protocol to speak to the server: SCGI, UWSGI, or
+	// empty for FastCGI.
+	Protocol string
+
+	// Persistent connections to the FastCGI server; if nil,
+	// a new connection is made for each request.
+	Pool *Pool
+}
+
+// dial returns a connection to the rule's FastCGI server,
+// from the pool if there is one.
+func (rule Rule) dial() (*FCGIClient, error) {
+	if rule.Pool != nil {
+		return rule.Pool.Get()
+	}
+	return Dial(parseAddress(rule.Address))
+}
+
+// release is called when the response from fcgi is done with.
+// It returns the connection to the pool or closes it.
+func (rule Rule) release(fcgi *FCGIClient) {
+	if rule.Pool != nil {
+		rule.Pool.Put(fcgi)
+		return
+	}
+	fcgi.Close()
+}
+
+// splitPos returns the position in fpath just past split, where
+// the path of the script ends, or -1 if it isn't in fpath. Split
+// must end a segment of the path, so that .php isn't found in
+// /file.phps.
+func splitPos(fpath, split string) int {
+	if split == "" {
+		return -1
+	}
+	for i := 0; ; {
+		j := strings.Index(fpath[i:], split)
+		if j < 0 {
+			return -1
+		}
+		end := i + j + len(split)
+		if end == len(fpath) || fpath[end] == '/' {
+			return end
+		}
+		i = end
+	}
 }
 
 var headerNameReplacer = strings.NewReplacer(" ", "_", "-", "_")
+
+// Scopes implements the middleware.Scoped interface.
+func (h Handler) Scopes() []string {
+	scopes := make([]string, len(h.Rules))
+	for i, rule := range h.Rules {
+		scopes[i] = rule.Path
+	}
+	return scopes
+}
+
+// closeOnDone calls closeFunc in its own goroutine once ctx is
+// done, unless the returned stop is called first. stop returns true
+// if it kept closeFunc from being called, and false if closeFunc was
+// called or stop was called before.
+func closeOnDone(ctx context.Context, closeFunc func()) (stop func() bool) {
+	var (
+		mu              sync.Mutex
+		stopped, closed bool
+		done            = make(chan struct{})
+	)
+	go func() {
+		select {
+		case <-ctx.Done():
+			mu.Lock()
+			closing := !stopped
+			closed = closing
+			mu.Unlock()
+			if closing {
+				closeFunc()
+			}
+		case <-done:
+		}
+	}()
+	return func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped || closed {
+			return false
+		}
+		stopped = true
+		close(done)
+		return true
+	}
+}
@@ -0,0 +1,82 @@
+package fastcgi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBuildEnv(t *testing.T) {
+	h := Handler{AbsRoot: "/srv/www", ServerName: "localhost", ServerPort: "8080"}
+	php := Rule{Path: "/", Ext: ".php", SplitPath: ".php", IndexFiles: []string{"index.php"}}
+
+	for i, test := range []struct {
+		rule                   Rule
+		fpath                  string
+		expectedScriptName     string
+		expectedScriptFilename string
+		expectedPathInfo       string
+	}{
+		{php, "/index.php", "/index.php", "/srv/www/index.php", ""},
+		{php, "/blog/post.php/2015/hello", "/blog/post.php", "/srv/www/blog/post.php", "/2015/hello"},
+		{php, "/pretty/url", "/index.php", "/srv/www/index.php", "/pretty/url"},
+		{php, "/source.phps", "/index.php", "/srv/www/index.php", "/source.phps"},
+		{php, "/a.phps/b.php/c", "/a.phps/b.php", "/srv/www/a.phps/b.php", "/c"},
+		{Rule{Path: "/"}, "/app.cgi", "/app.cgi", "/srv/www/app.cgi", ""},
+	} {
+		r, err := http.NewRequest("GET", "http://localhost"+test.fpath+"?q=1", nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		r.RemoteAddr = "10.0.0.1:5000"
+
+		env, err := h.buildEnv(r, test.rule, test.fpath)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if env["SCRIPT_NAME"] != test.expectedScriptName {
+			t.Errorf("Test %d: Expected SCRIPT_NAME %s, got %s", i, test.expectedScriptName, env["SCRIPT_NAME"])
+		}
+		if env["SCRIPT_FILENAME"] != test.expectedScriptFilename {
+			t.Errorf("Test %d: Expected SCRIPT_FILENAME %s, got %s", i, test.expectedScriptFilename, env["SCRIPT_FILENAME"])
+		}
+		if env["PATH_INFO"] != test.expectedPathInfo {
+			t.Errorf("Test %d: Expected PATH_INFO %q, got %q", i, test.expectedPathInfo, env["PATH_INFO"])
+		}
+		if _, ok := env["PATH_TRANSLATED"]; ok != (test.expectedPathInfo != "") {
+			t.Errorf("Test %d: Expected PATH_TRANSLATED only with PATH_INFO", i)
+		}
+		if env["QUERY_STRING"] != "q=1" || env["REMOTE_ADDR"] != "10.0.0.1" || env["DOCUMENT_ROOT"] != "/srv/www" {
+			t.Errorf("Test %d: Unexpected request variables in %v", i, env)
+		}
+	}
+}
+
+func TestCloseOnDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	closed := make(chan struct{}, 2)
+	stop := closeOnDone(ctx, func() { closed <- struct{}{} })
+	if !stop() {
+		t.Error("Expected stop to keep the connection from being closed")
+	}
+	if stop() {
+		t.Error("Expected a second stop to report false")
+	}
+	cancel()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	stop = closeOnDone(ctx, func() { closed <- struct{}{} })
+	cancel()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the connection to be closed once the context is done")
+	}
+	if stop() {
+		t.Error("Expected stop to report false after the connection was closed")
+	}
+	if len(closed) != 0 {
+		t.Error("Expected the stopped watch not to close its connection")
+	}
+}
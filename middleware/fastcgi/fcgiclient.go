@@ -26,7 +26,6 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"sync"
 )
 
@@ -111,6 +110,10 @@ func (rec *record) read(r io.Reader) (buf []byte, err error) {
 		return
 	}
 	if rec.h.Type == FCGI_END_REQUEST {
+		// consume the rest of the record so the connection can be reused
+		if _, err = io.CopyN(ioutil.Discard, r, int64(rec.h.ContentLength)+int64(rec.h.PaddingLength)); err != nil {
+			return
+		}
 		err = io.EOF
 		return
 	}
@@ -133,6 +136,9 @@ type FCGIClient struct {
 	buf       bytes.Buffer
 	keepAlive bool
 	reqId     uint16
+	reused    bool // whether the connection came from a pool's idle list
+	received  bool // whether any record was read for the last request
+	ended     bool // whether the responder ended the last request
 }
 
 // Dial connects to the fcgi responder at the specified network address.
@@ -159,6 +165,13 @@ func (c *FCGIClient) Close() {
 	c.rwc.Close()
 }
 
+// reusable returns true if the connection was kept open by the
+// responder and the whole response to the last request was read,
+// so the connection may be used for another request.
+func (c *FCGIClient) reusable() bool {
+	return c.keepAlive && c.ended
+}
+
 func (c *FCGIClient) writeRecord(recType uint8, content []byte) (err error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -316,8 +329,13 @@ func (w *streamReader) Read(p []byte) (n int, err error) {
 			rec := &record{}
 			w.buf, err = rec.read(w.c.rwc)
 			if err != nil {
+				if err == io.EOF && rec.h.Type == FCGI_END_REQUEST {
+					w.c.received = true
+					w.c.ended = true
+				}
 				return
 			}
+			w.c.received = true
 		}
 
 		n = len(p)
@@ -334,7 +352,13 @@ func (w *streamReader) Read(p []byte) (n int, err error) {
 // Do made the request and returns a io.Reader that translates the data read
 // from fcgi responder out of fcgi packet before returning it.
 func (c *FCGIClient) Do(p map[string]string, req io.Reader) (r io.Reader, err error) {
-	err = c.writeBeginRequest(uint16(FCGI_RESPONDER), 0)
+	var flags uint8
+	if c.keepAlive {
+		flags = FCGI_KEEP_CONN
+	}
+	c.received, c.ended = false, false
+
+	err = c.writeBeginRequest(uint16(FCGI_RESPONDER), flags)
 	if err != nil {
 		return
 	}
@@ -375,15 +399,10 @@ func (c *FCGIClient) Request(p map[string]string, req io.Reader) (resp *http.Res
 	resp.Header = http.Header(mimeHeader)
 
 	if resp.Header.Get("Status") != "" {
-		statusParts := strings.SplitN(resp.Header.Get("Status"), " ", 2)
-		resp.StatusCode, err = strconv.Atoi(statusParts[0])
+		resp.StatusCode, resp.Status, err = parseStatus(resp.Header.Get("Status"))
 		if err != nil {
 			return
 		}
-		if len(statusParts) > 1 {
-			resp.Status = statusParts[1]	
-		}
-		
 	} else {
 		resp.StatusCode = http.StatusOK
 	}
@@ -0,0 +1,217 @@
+package fastcgi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// Protocols other than FastCGI that a rule can speak to its backend.
+const (
+	// SCGI is the Simple Common Gateway Interface, used by some
+	// legacy Python, Ruby and C applications.
+	SCGI = "scgi"
+
+	// UWSGI is the native protocol of the uWSGI application server.
+	UWSGI = "uwsgi"
+)
+
+// gatewayRequest sends r with the CGI environment env to the SCGI or
+// uWSGI server at address and returns its response. Neither protocol
+// keeps the connection open, so the connection is closed along with
+// the response body.
+func gatewayRequest(protocol, address string, r *http.Request, env map[string]string) (*http.Response, error) {
+	body, length, err := requestBody(r)
+	if err != nil {
+		return nil, err
+	}
+	env["CONTENT_LENGTH"] = strconv.FormatInt(length, 10)
+
+	var head []byte
+	switch protocol {
+	case SCGI:
+		head = scgiHeaders(env)
+	case UWSGI:
+		if head, err = uwsgiHeaders(env); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("unknown gateway protocol " + protocol)
+	}
+
+	network, address := parseAddress(address)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(r.Context(), network, address)
+	if err != nil {
+		return nil, err
+	}
+	stop := closeOnDone(r.Context(), func() { conn.Close() })
+
+	if _, err = conn.Write(head); err == nil && body != nil {
+		_, err = io.CopyN(conn, body, length)
+	}
+	if err != nil {
+		stop()
+		conn.Close()
+		return nil, err
+	}
+
+	var resp *http.Response
+	rb := bufio.NewReader(conn)
+	if protocol == UWSGI {
+		// uWSGI applications reply with a full HTTP response
+		if resp, err = http.ReadResponse(rb, r); err == nil {
+			resp.Header.Del("Connection")
+		}
+	} else {
+		resp, err = readCGIResponse(rb)
+	}
+	if err != nil {
+		stop()
+		conn.Close()
+		return nil, err
+	}
+	resp.Body = connBody{resp.Body, conn, stop}
+	return resp, nil
+}
+
+// MaxBufferedBody is how many bytes of a request body of unknown
+// length may be read into memory to measure it; longer bodies are
+// refused with ErrBodyTooLarge.
+var MaxBufferedBody int64 = 10 << 20 // 10MB
+
+// ErrBodyTooLarge is returned for a request body of unknown
+// length that is longer than MaxBufferedBody.
+var ErrBodyTooLarge = errors.New("request body of unknown length is too large to forward")
+
+// requestBody returns the body of r and its length. A body
+// of unknown length is read into memory to measure it, since
+// both protocols need the length up front.
+func requestBody(r *http.Request) (io.Reader, int64, error) {
+	if r.Body == nil || r.ContentLength == 0 {
+		return nil, 0, nil
+	}
+	if r.ContentLength > 0 {
+		return r.Body, r.ContentLength, nil
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxBufferedBody+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if int64(len(b)) > MaxBufferedBody {
+		return nil, 0, ErrBodyTooLarge
+	}
+	return bytes.NewReader(b), int64(len(b)), nil
+}
+
+// scgiHeaders encodes env as an SCGI request header: a netstring
+// of NUL-terminated names and values, with CONTENT_LENGTH first.
+func scgiHeaders(env map[string]string) []byte {
+	var buf bytes.Buffer
+	pair := func(k, v string) {
+		buf.WriteString(k)
+		buf.WriteByte(0)
+		buf.WriteString(v)
+		buf.WriteByte(0)
+	}
+	pair("CONTENT_LENGTH", env["CONTENT_LENGTH"])
+	pair("SCGI", "1")
+	for k, v := range env {
+		if k != "CONTENT_LENGTH" && k != "SCGI" {
+			pair(k, v)
+		}
+	}
+
+	var ns bytes.Buffer
+	ns.WriteString(strconv.Itoa(buf.Len()))
+	ns.WriteByte(':')
+	ns.Write(buf.Bytes())
+	ns.WriteByte(',')
+	return ns.Bytes()
+}
+
+// uwsgiHeaders encodes env as a uWSGI request packet with
+// modifiers 0, which is a WSGI request.
+func uwsgiHeaders(env map[string]string) ([]byte, error) {
+	var vars bytes.Buffer
+	size := make([]byte, 2)
+	for k, v := range env {
+		if len(k) > 0xffff || len(v) > 0xffff {
+			return nil, errors.New("uwsgi: variable " + k + " is too long")
+		}
+		binary.LittleEndian.PutUint16(size, uint16(len(k)))
+		vars.Write(size)
+		vars.WriteString(k)
+		binary.LittleEndian.PutUint16(size, uint16(len(v)))
+		vars.Write(size)
+		vars.WriteString(v)
+	}
+	if vars.Len() > 0xffff {
+		return nil, errors.New("uwsgi: request headers are too large")
+	}
+
+	head := []byte{0, 0, 0, 0}
+	binary.LittleEndian.PutUint16(head[1:3], uint16(vars.Len()))
+	return append(head, vars.Bytes()...), nil
+}
+
+// readCGIResponse reads a CGI response, which is a block
+// of headers with an optional Status header, then the body.
+func readCGIResponse(rb *bufio.Reader) (*http.Response, error) {
+	mimeHeader, err := textproto.NewReader(rb).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header(mimeHeader),
+		Body:       ioutil.NopCloser(rb),
+	}
+	if status := resp.Header.Get("Status"); status != "" {
+		if resp.StatusCode, resp.Status, err = parseStatus(status); err != nil {
+			return nil, err
+		}
+		resp.Header.Del("Status")
+	}
+	resp.ContentLength, _ = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	return resp, nil
+}
+
+// parseStatus parses the value of a CGI Status header, like
+// "404 Not Found", into the code and the text after it. Codes
+// that can't be written as an HTTP status are an error.
+func parseStatus(status string) (int, string, error) {
+	parts := strings.SplitN(status, " ", 2)
+	code, err := strconv.Atoi(parts[0])
+	if err != nil || code < 100 || code > 999 {
+		return 0, "", fmt.Errorf("invalid Status header %q from backend", status)
+	}
+	if len(parts) > 1 {
+		return code, parts[1], nil
+	}
+	return code, "", nil
+}
+
+// connBody is a response body that closes
+// its connection when it is closed.
+type connBody struct {
+	io.ReadCloser
+	conn net.Conn
+	stop func() bool // stops closing conn when the request is done
+}
+
+func (b connBody) Close() error {
+	b.stop()
+	b.ReadCloser.Close()
+	return b.conn.Close()
+}
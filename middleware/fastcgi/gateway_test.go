@@ -0,0 +1,212 @@
+package fastcgi
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// serveGateway accepts one connection on a new listener and passes it
+// to handle, returning the listener's address.
+func serveGateway(t *testing.T, handle func(conn net.Conn)) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}()
+	return ln.Addr().String()
+}
+
+func TestSCGI(t *testing.T) {
+	env := make(chan map[string]string, 1)
+	body := make(chan string, 1)
+	addr := serveGateway(t, func(conn net.Conn) {
+		rb := bufio.NewReader(conn)
+		length, _ := rb.ReadString(':')
+		n, _ := strconv.Atoi(strings.TrimSuffix(length, ":"))
+		headers := make([]byte, n+1) // and the trailing comma
+		io.ReadFull(rb, headers)
+		fields := strings.Split(string(headers[:n]), "\x00")
+		vars := make(map[string]string)
+		for i := 0; i+1 < len(fields); i += 2 {
+			vars[fields[i]] = fields[i+1]
+		}
+		if fields[0] != "CONTENT_LENGTH" {
+			vars["CONTENT_LENGTH"] = "(not first)"
+		}
+		env <- vars
+		cl, _ := strconv.Atoi(vars["CONTENT_LENGTH"])
+		b := make([]byte, cl)
+		io.ReadFull(rb, b)
+		body <- string(b)
+		io.WriteString(conn, "Status: 201 Created\r\nContent-Type: text/plain\r\n\r\nHello, SCGI")
+	})
+
+	req, _ := http.NewRequest("POST", "/app", strings.NewReader("name=caddy"))
+	resp, err := gatewayRequest(SCGI, addr, req, map[string]string{"REQUEST_METHOD": "POST"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer resp.Body.Close()
+
+	vars := <-env
+	if vars["SCGI"] != "1" {
+		t.Errorf("Expected SCGI variable 1, got '%s'", vars["SCGI"])
+	}
+	if vars["CONTENT_LENGTH"] != "10" {
+		t.Errorf("Expected CONTENT_LENGTH 10 as the first variable, got '%s'", vars["CONTENT_LENGTH"])
+	}
+	if vars["REQUEST_METHOD"] != "POST" {
+		t.Errorf("Expected REQUEST_METHOD POST, got '%s'", vars["REQUEST_METHOD"])
+	}
+	if b := <-body; b != "name=caddy" {
+		t.Errorf("Expected request body 'name=caddy', got '%s'", b)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, resp.StatusCode)
+	}
+	if resp.Header.Get("Status") != "" {
+		t.Errorf("Expected Status header to be removed, got '%s'", resp.Header.Get("Status"))
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("Expected Content-Type text/plain, got '%s'", ct)
+	}
+	if b, _ := ioutil.ReadAll(resp.Body); string(b) != "Hello, SCGI" {
+		t.Errorf("Expected body 'Hello, SCGI', got '%s'", b)
+	}
+}
+
+func TestUWSGI(t *testing.T) {
+	env := make(chan map[string]string, 1)
+	addr := serveGateway(t, func(conn net.Conn) {
+		head := make([]byte, 4)
+		io.ReadFull(conn, head)
+		vars := make(map[string]string)
+		if head[0] == 0 && head[3] == 0 {
+			data := make([]byte, binary.LittleEndian.Uint16(head[1:3]))
+			io.ReadFull(conn, data)
+			for len(data) >= 2 {
+				kl := binary.LittleEndian.Uint16(data)
+				k := string(data[2 : 2+kl])
+				data = data[2+kl:]
+				vl := binary.LittleEndian.Uint16(data)
+				vars[k] = string(data[2 : 2+vl])
+				data = data[2+vl:]
+			}
+		}
+		env <- vars
+		io.WriteString(conn, "HTTP/1.1 404 Not Found\r\nContent-Type: text/plain\r\nConnection: close\r\n\r\nNo such page")
+	})
+
+	req, _ := http.NewRequest("GET", "/missing", nil)
+	resp, err := gatewayRequest(UWSGI, addr, req, map[string]string{
+		"REQUEST_METHOD": "GET",
+		"PATH_INFO":      "/missing",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer resp.Body.Close()
+
+	vars := <-env
+	if vars["PATH_INFO"] != "/missing" {
+		t.Errorf("Expected PATH_INFO /missing, got '%s'", vars["PATH_INFO"])
+	}
+	if vars["CONTENT_LENGTH"] != "0" {
+		t.Errorf("Expected CONTENT_LENGTH 0, got '%s'", vars["CONTENT_LENGTH"])
+	}
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+	if resp.Header.Get("Connection") != "" {
+		t.Errorf("Expected Connection header to be removed, got '%s'", resp.Header.Get("Connection"))
+	}
+	if b, _ := ioutil.ReadAll(resp.Body); string(b) != "No such page" {
+		t.Errorf("Expected body 'No such page', got '%s'", b)
+	}
+}
+
+func TestGatewayHandler(t *testing.T) {
+	addr := serveGateway(t, func(conn net.Conn) {
+		rb := bufio.NewReader(conn)
+		length, _ := rb.ReadString(':')
+		n, _ := strconv.Atoi(strings.TrimSuffix(length, ":"))
+		io.ReadFull(rb, make([]byte, n+1))
+		io.WriteString(conn, "Content-Type: text/plain\r\n\r\nfrom scgi")
+	})
+
+	h := Handler{
+		Rules: []Rule{{Path: "/", Address: addr, Ext: ".py", SplitPath: ".py", IndexFiles: []string{"index.py"}, Protocol: SCGI}},
+		Root:  ".",
+	}
+	req, _ := http.NewRequest("GET", "/app.py", nil)
+	rec := httptest.NewRecorder()
+
+	status, err := h.ServeHTTP(rec, req)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if status != 0 {
+		t.Errorf("Expected status 0 (response written), got %d", status)
+	}
+	if rec.Body.String() != "from scgi" {
+		t.Errorf("Expected body 'from scgi', got '%s'", rec.Body.String())
+	}
+}
+
+func TestGatewayBadStatus(t *testing.T) {
+	for i, status := range []string{"0", "42", "1000 Too Big", "abc"} {
+		addr := serveGateway(t, func(conn net.Conn) {
+			rb := bufio.NewReader(conn)
+			length, _ := rb.ReadString(':')
+			n, _ := strconv.Atoi(strings.TrimSuffix(length, ":"))
+			io.ReadFull(rb, make([]byte, n+1))
+			io.WriteString(conn, "Status: "+status+"\r\n\r\nbody")
+		})
+
+		h := Handler{
+			Rules: []Rule{{Path: "/", Address: addr, Ext: ".py", Protocol: SCGI}},
+			Root:  ".",
+		}
+		req, _ := http.NewRequest("GET", "/app.py", nil)
+		rec := httptest.NewRecorder()
+
+		if code, _ := h.ServeHTTP(rec, req); code != http.StatusBadGateway {
+			t.Errorf("Test %d: Expected status %d for Status %q, got %d", i, http.StatusBadGateway, status, code)
+		}
+	}
+}
+
+func TestGatewayBodyTooLarge(t *testing.T) {
+	defer func(n int64) { MaxBufferedBody = n }(MaxBufferedBody)
+	MaxBufferedBody = 4
+
+	h := Handler{
+		Rules: []Rule{{Path: "/", Address: "127.0.0.1:1", Ext: ".py", Protocol: SCGI}},
+		Root:  ".",
+	}
+	req, _ := http.NewRequest("POST", "/app.py", ioutil.NopCloser(strings.NewReader("too long")))
+	req.ContentLength = -1
+
+	status, err := h.ServeHTTP(httptest.NewRecorder(), req)
+	if status != http.StatusRequestEntityTooLarge || err != ErrBodyTooLarge {
+		t.Errorf("Expected status %d and ErrBodyTooLarge, got %d and %v", http.StatusRequestEntityTooLarge, status, err)
+	}
+}
@@ -0,0 +1,110 @@
+package fastcgi
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pool keeps persistent connections to a FastCGI server so that
+// they can be reused across requests instead of dialing for each
+// one. Connections are only ever used by one request at a time;
+// a connection is returned to the pool after its response has
+// been read completely.
+type Pool struct {
+	// The maximum number of idle connections to keep.
+	Size int
+
+	// How long a connection may sit idle in the pool before it
+	// is closed. Zero means idle connections are kept until the
+	// server closes them.
+	IdleTimeout time.Duration
+
+	network, address string
+
+	mu   sync.Mutex
+	idle []idleConn
+}
+
+type idleConn struct {
+	client *FCGIClient
+	since  time.Time
+}
+
+// NewPool returns a pool for connections to address, which is a
+// TCP address or a Unix socket path as accepted by Rule.Address.
+func NewPool(address string, size int, idleTimeout time.Duration) *Pool {
+	network, address := parseAddress(address)
+	return &Pool{
+		Size:        size,
+		IdleTimeout: idleTimeout,
+		network:     network,
+		address:     address,
+	}
+}
+
+// Get returns an idle connection from the pool, or dials a new
+// one if no idle connection is available.
+func (p *Pool) Get() (*FCGIClient, error) {
+	p.mu.Lock()
+	for len(p.idle) > 0 {
+		// take the most recently used connection; it is the least
+		// likely to have been closed by the server
+		ic := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if p.IdleTimeout > 0 && time.Since(ic.since) > p.IdleTimeout {
+			ic.client.Close()
+			continue
+		}
+		p.mu.Unlock()
+		ic.client.reused = true
+		return ic.client, nil
+	}
+	p.mu.Unlock()
+
+	fcgi, err := Dial(p.network, p.address)
+	if err != nil {
+		return nil, err
+	}
+	fcgi.keepAlive = true
+	return fcgi, nil
+}
+
+// Put returns fcgi to the pool. The connection is closed instead
+// if its last response was not read completely or the pool is full.
+func (p *Pool) Put(fcgi *FCGIClient) {
+	if !fcgi.reusable() {
+		fcgi.Close()
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.idle) >= p.Size {
+		fcgi.Close()
+		return
+	}
+	p.idle = append(p.idle, idleConn{client: fcgi, since: time.Now()})
+}
+
+// Close closes all idle connections in the pool.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ic := range p.idle {
+		ic.client.Close()
+	}
+	p.idle = nil
+}
+
+// parseAddress returns the network and address to dial for a rule
+// address: Unix sockets are absolute paths or prefixed with "unix:".
+func parseAddress(address string) (network, addr string) {
+	if strings.HasPrefix(address, "unix:") {
+		return "unix", address[len("unix:"):]
+	}
+	if strings.HasPrefix(address, "/") {
+		return "unix", address
+	}
+	return "tcp", address
+}
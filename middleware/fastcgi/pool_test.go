@@ -0,0 +1,163 @@
+package fastcgi
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/fcgi"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingListener counts the connections it accepts.
+type countingListener struct {
+	net.Listener
+	accepted int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt32(&l.accepted, 1)
+	}
+	return conn, err
+}
+
+func TestPool(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	listener := &countingListener{Listener: ln}
+	defer listener.Close()
+	go fcgi.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello"))
+	}))
+
+	pool := NewPool(ln.Addr().String(), 2, time.Minute)
+	defer pool.Close()
+
+	for i := 0; i < 3; i++ {
+		client, err := pool.Get()
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error getting a connection, got: %v", i, err)
+		}
+		resp, err := client.Get(map[string]string{"REQUEST_METHOD": "GET", "SERVER_PROTOCOL": "HTTP/1.1"})
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error from request, got: %v", i, err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error reading body, got: %v", i, err)
+		}
+		if string(body) != "Hello" {
+			t.Errorf("Test %d: Expected body 'Hello', got '%s'", i, body)
+		}
+		if !client.reusable() {
+			t.Errorf("Test %d: Expected connection to be reusable after reading the response", i)
+		}
+		pool.Put(client)
+	}
+
+	if n := atomic.LoadInt32(&listener.accepted); n != 1 {
+		t.Errorf("Expected 1 connection to be made, got %d", n)
+	}
+
+	// an unread response must not be returned to the pool
+	client, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Expected no error getting a connection, got: %v", err)
+	}
+	if _, err = client.Get(map[string]string{"REQUEST_METHOD": "GET", "SERVER_PROTOCOL": "HTTP/1.1"}); err != nil {
+		t.Fatalf("Expected no error from request, got: %v", err)
+	}
+	pool.Put(client)
+	if len(pool.idle) != 0 {
+		t.Errorf("Expected unread connection to be closed, but %d are idle", len(pool.idle))
+	}
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer ln.Close()
+	go fcgi.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	pool := NewPool(ln.Addr().String(), 1, time.Nanosecond)
+	client, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Expected no error getting a connection, got: %v", err)
+	}
+	client.ended = true
+	pool.Put(client)
+	time.Sleep(time.Millisecond)
+
+	again, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Expected no error getting a connection, got: %v", err)
+	}
+	if again == client {
+		t.Error("Expected expired idle connection to be replaced")
+	}
+	again.Close()
+}
+
+func TestParseAddress(t *testing.T) {
+	for i, test := range []struct {
+		address         string
+		expectedNetwork string
+		expectedAddress string
+	}{
+		{"127.0.0.1:9000", "tcp", "127.0.0.1:9000"},
+		{"/var/run/php5-fpm.sock", "unix", "/var/run/php5-fpm.sock"},
+		{"unix:/var/run/php5-fpm.sock", "unix", "/var/run/php5-fpm.sock"},
+	} {
+		network, address := parseAddress(test.address)
+		if network != test.expectedNetwork || address != test.expectedAddress {
+			t.Errorf("Test %d: Expected %s %s, got %s %s", i,
+				test.expectedNetwork, test.expectedAddress, network, address)
+		}
+	}
+}
+
+func TestHandlerRequestTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer ln.Close()
+	release := make(chan struct{})
+	defer close(release)
+	go fcgi.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+
+	pool := NewPool(ln.Addr().String(), 2, time.Minute)
+	defer pool.Close()
+	h := Handler{
+		Rules: []Rule{{Path: "/", Address: ln.Addr().String(), Ext: ".php", SplitPath: ".php", Pool: pool}},
+		Root:  ".",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", "/slow.php", nil)
+	req = req.WithContext(ctx)
+
+	start := time.Now()
+	status, _ := h.ServeHTTP(httptest.NewRecorder(), req)
+	if status != http.StatusGatewayTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusGatewayTimeout, status)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the request to be abandoned at its deadline, took %v", elapsed)
+	}
+	if len(pool.idle) != 0 {
+		t.Errorf("Expected the abandoned connection not to be pooled, got %d idle", len(pool.idle))
+	}
+}
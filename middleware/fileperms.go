@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// FilePerms describes the permissions and ownership to give the
+// files and directories that are created while serving a site,
+// such as log files. The zero value leaves them to the defaults
+// and the process's umask.
+type FilePerms struct {
+	// Permission bits for files; 0 for the default of 0644
+	// less the umask
+	Mode os.FileMode
+
+	// Permission bits for directories; 0 for the default
+	// of 0755 less the umask
+	DirMode os.FileMode
+
+	// Owner and group IDs to give files and directories;
+	// only used if SetOwner and SetGroup are true, so that
+	// the zero value leaves ownership unchanged
+	UID, GID           int
+	SetOwner, SetGroup bool
+
+	// The modes that files and directories are created with,
+	// less the umask, if Mode and DirMode are 0 (see Defaults)
+	defaultMode, defaultDirMode os.FileMode
+}
+
+// Defaults returns p with file and dir as the modes that files and
+// directories are created with, less the umask, instead of 0644 and
+// 0755, unless p sets modes of its own.
+func (p FilePerms) Defaults(file, dir os.FileMode) FilePerms {
+	p.defaultMode, p.defaultDirMode = file, dir
+	return p
+}
+
+// Owner returns p without its modes, so that files get
+// only their ownership from it.
+func (p FilePerms) Owner() FilePerms {
+	return FilePerms{UID: p.UID, GID: p.GID, SetOwner: p.SetOwner, SetGroup: p.SetGroup}
+}
+
+// OpenFile is like os.OpenFile, except the file gets the mode and
+// ownership described by p. They are applied every time the file is
+// opened, not only when it's created, so that changes take effect on
+// existing files too.
+func (p FilePerms) OpenFile(name string, flag int) (*os.File, error) {
+	file, err := os.OpenFile(name, flag, p.fileMode())
+	if err != nil {
+		return nil, err
+	}
+	if err := p.apply(name, p.Mode); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// WriteFile is like ioutil.WriteFile, except the file gets the
+// mode and ownership described by p.
+func (p FilePerms) WriteFile(name string, data []byte) error {
+	err := ioutil.WriteFile(name, data, p.fileMode())
+	if err != nil {
+		return err
+	}
+	return p.apply(name, p.Mode)
+}
+
+// MkdirAll is like os.MkdirAll, except the directory named by
+// path gets the mode and ownership described by p.
+func (p FilePerms) MkdirAll(path string) error {
+	mode := p.DirMode
+	if mode == 0 {
+		mode = p.defaultDirMode
+	}
+	if mode == 0 {
+		mode = 0755
+	}
+	err := os.MkdirAll(path, mode)
+	if err != nil {
+		return err
+	}
+	return p.apply(path, p.DirMode)
+}
+
+// Apply gives the file named name, which was created some
+// other way, like ioutil.TempFile, the mode and ownership
+// described by p.
+func (p FilePerms) Apply(name string) error {
+	return p.apply(name, p.Mode)
+}
+
+func (p FilePerms) fileMode() os.FileMode {
+	if p.Mode != 0 {
+		return p.Mode
+	}
+	if p.defaultMode != 0 {
+		return p.defaultMode
+	}
+	return 0644
+}
+
+// apply sets the mode (if not 0) and ownership
+// (if configured) of the file named name.
+func (p FilePerms) apply(name string, mode os.FileMode) error {
+	if mode != 0 {
+		// set explicitly, since the umask applies when creating
+		if err := os.Chmod(name, mode); err != nil {
+			return err
+		}
+	}
+	if p.SetOwner || p.SetGroup {
+		uid, gid := -1, -1 // unchanged
+		if p.SetOwner {
+			uid = p.UID
+		}
+		if p.SetGroup {
+			gid = p.GID
+		}
+		return os.Chown(name, uid, gid)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilePerms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_perms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := FilePerms{Mode: 0604, DirMode: 0705}
+
+	sub := filepath.Join(dir, "sub")
+	if err := p.MkdirAll(sub); err != nil {
+		t.Fatal(err)
+	}
+	logFile := filepath.Join(sub, "access.log")
+	f, err := p.OpenFile(logFile, os.O_RDWR|os.O_CREATE|os.O_APPEND)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	page := filepath.Join(sub, "index.html")
+	if err := p.WriteFile(page, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	// modes the site doesn't set come from Defaults
+	private := FilePerms{}.Defaults(0600, 0700)
+	privateDir := filepath.Join(dir, "private")
+	if err := private.MkdirAll(privateDir); err != nil {
+		t.Fatal(err)
+	}
+	key := filepath.Join(privateDir, "key")
+	if err := private.WriteFile(key, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]os.FileMode{sub: 0705, logFile: 0604, page: 0604, privateDir: 0700, key: 0600} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != expected {
+			t.Errorf("Expected %s to have mode %o, got %o", name, expected, mode)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+//go:build brotli
+// +build brotli
+
+package gzip
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Brotli is only built in with the brotli build tag, since
+// it needs a package outside the standard library.
+func init() {
+	RegisterEncoding("br", brotliEncoding{})
+}
+
+// brotliEncoding is the br Content-Encoding.
+type brotliEncoding struct{}
+
+func (brotliEncoding) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if level == DefaultLevel {
+		level = brotli.DefaultCompression
+	}
+	return brotli.NewWriterLevel(w, level), nil
+}
+
+func (brotliEncoding) ValidLevel(level int) bool {
+	return level >= brotli.BestSpeed && level <= brotli.BestCompression
+}
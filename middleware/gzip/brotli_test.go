@@ -0,0 +1,37 @@
+//go:build brotli
+// +build brotli
+
+package gzip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mwtest "github.com/mholt/caddy/middleware/testing"
+)
+
+func init() {
+	builtEncodings = append(builtEncodings, "br")
+}
+
+func TestBrotli(t *testing.T) {
+	g := Gzip{
+		Next: &mwtest.Handler{Header: http.Header{"Content-Type": {"text/plain"}}, Body: "hello"},
+		Configs: []Config{{
+			Filters:   []Filter{DefaultExtFilter()},
+			Encodings: []string{"br", "gzip"},
+		}},
+	}
+	r := httptest.NewRequest("GET", "/file.txt", nil)
+	r.Header.Set("Accept-Encoding", "gzip, br")
+	mwtest.Serve(g, r).AssertHeader(t, "Content-Encoding", "br")
+
+	br, ok := LookupEncoding("br")
+	if !ok {
+		t.Fatal("Expected br to be registered")
+	}
+	if !br.ValidLevel(11) || br.ValidLevel(12) {
+		t.Error("Expected brotli levels to go up to 11")
+	}
+}
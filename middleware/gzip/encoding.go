@@ -0,0 +1,128 @@
+package gzip
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLevel asks an Encoding for its default compression level.
+const DefaultLevel = -1
+
+// Encoding compresses responses with one Content-Encoding.
+// Encodings other than gzip plug in with RegisterEncoding.
+type Encoding interface {
+	// NewWriter returns a writer that compresses what is
+	// written to it into w at level, which is valid or
+	// DefaultLevel. Close must flush it.
+	NewWriter(w io.Writer, level int) (io.WriteCloser, error)
+
+	// ValidLevel returns true if level is a compression
+	// level of the encoding.
+	ValidLevel(level int) bool
+}
+
+var (
+	encodings   = map[string]Encoding{"gzip": gzipEncoding{}}
+	encodingsMu sync.RWMutex
+)
+
+// RegisterEncoding makes e available as the Content-Encoding
+// name, like "br". It is meant to be called from init functions.
+func RegisterEncoding(name string, e Encoding) {
+	encodingsMu.Lock()
+	encodings[name] = e
+	encodingsMu.Unlock()
+}
+
+// LookupEncoding returns the encoding registered as name.
+func LookupEncoding(name string) (Encoding, bool) {
+	encodingsMu.RLock()
+	defer encodingsMu.RUnlock()
+	e, ok := encodings[name]
+	return e, ok
+}
+
+// EncodingNames returns the names of the registered
+// encodings, sorted.
+func EncodingNames() []string {
+	encodingsMu.RLock()
+	defer encodingsMu.RUnlock()
+	var names []string
+	for name := range encodings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// gzipEncoding is the gzip Content-Encoding.
+type gzipEncoding struct{}
+
+func (gzipEncoding) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, level)
+}
+
+func (gzipEncoding) ValidLevel(level int) bool {
+	return level >= gzip.BestSpeed && level <= gzip.BestCompression
+}
+
+// negotiate returns the one of offered, which is in order of
+// preference, that the Accept-Encoding header accept likes best,
+// or "" if it accepts none of them. The client's quality values
+// come first; the order of offered breaks ties.
+func negotiate(accept string, offered []string) string {
+	qualities := make(map[string]float64)
+	wildcard := -1.0 // not given
+	for _, part := range strings.Split(accept, ",") {
+		name, q := parseQuality(part)
+		if name == "" {
+			continue
+		}
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		qualities[name] = q
+	}
+
+	var best string
+	bestQ := 0.0
+	for _, name := range offered {
+		q, ok := qualities[name]
+		if !ok {
+			// x-gzip is an old alias of gzip
+			if q, ok = qualities["x-"+name]; !ok {
+				q = wildcard
+			}
+		}
+		if q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// parseQuality splits an element of an Accept-Encoding header,
+// like "gzip;q=0.8", into the lowercased coding and its quality,
+// which is 1 unless given.
+func parseQuality(part string) (string, float64) {
+	fields := strings.Split(part, ";")
+	name := strings.ToLower(strings.TrimSpace(fields[0]))
+	q := 1.0
+	for _, param := range fields[1:] {
+		param = strings.TrimSpace(param)
+		if !strings.HasPrefix(param, "q=") && !strings.HasPrefix(param, "Q=") {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(param[2:], 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			parsed = 0
+		}
+		q = parsed
+	}
+	return name, q
+}
@@ -0,0 +1,127 @@
+package gzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	mwtest "github.com/mholt/caddy/middleware/testing"
+)
+
+// builtEncodings are the encodings registered by the package
+// itself, which depend on the build tags.
+var builtEncodings = []string{"gzip"}
+
+func TestNegotiate(t *testing.T) {
+	for i, test := range []struct {
+		accept   string
+		offered  []string
+		expected string
+	}{
+		{"gzip", []string{"gzip"}, "gzip"},
+		{"gzip, deflate, br", []string{"br", "gzip"}, "br"},
+		{"gzip, deflate, br", []string{"gzip", "br"}, "gzip"},
+		{"br;q=0.5, gzip", []string{"br", "gzip"}, "gzip"},
+		{"br;q=1.0, gzip;q=0.8", []string{"gzip", "br"}, "br"},
+		{"gzip;q=0", []string{"gzip"}, ""},
+		{"GZIP", []string{"gzip"}, "gzip"},
+		{"x-gzip", []string{"gzip"}, "gzip"},
+		{"*", []string{"br", "gzip"}, "br"},
+		{"*;q=0.1, gzip;q=0.5", []string{"br", "gzip"}, "gzip"},
+		{"*;q=0, br", []string{"gzip", "br"}, "br"},
+		{"identity", []string{"gzip"}, ""},
+		{"deflate", []string{"gzip"}, ""},
+		{"gzip;q=bad", []string{"gzip"}, ""},
+	} {
+		if got := negotiate(test.accept, test.offered); got != test.expected {
+			t.Errorf("Test %d: Expected %q for %q, got %q", i, test.expected, test.accept, got)
+		}
+	}
+}
+
+// reverseEncoding is a stand-in for an encoding plugged in
+// from outside: it "compresses" by writing the level and then
+// the reversed body.
+type reverseEncoding struct{}
+
+func (reverseEncoding) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return &reverseWriter{w: w, level: level}, nil
+}
+
+func (reverseEncoding) ValidLevel(level int) bool { return level >= 1 && level <= 3 }
+
+type reverseWriter struct {
+	w     io.Writer
+	level int
+	buf   bytes.Buffer
+}
+
+func (r *reverseWriter) Write(p []byte) (int, error) { return r.buf.Write(p) }
+
+func (r *reverseWriter) Close() error {
+	b := r.buf.Bytes()
+	out := []byte{byte('0' + r.level)}
+	for i := len(b) - 1; i >= 0; i-- {
+		out = append(out, b[i])
+	}
+	_, err := r.w.Write(out)
+	return err
+}
+
+func TestEncodings(t *testing.T) {
+	RegisterEncoding("x-reverse", reverseEncoding{})
+	defer func() {
+		encodingsMu.Lock()
+		delete(encodings, "x-reverse")
+		encodingsMu.Unlock()
+	}()
+
+	g := Gzip{
+		Next: &mwtest.Handler{Header: http.Header{"Content-Type": {"text/plain"}}, Body: "hello"},
+		Configs: []Config{{
+			Filters:   []Filter{DefaultExtFilter()},
+			Encodings: []string{"x-reverse", "gzip"},
+			Levels:    map[string]int{"x-reverse": 2},
+		}},
+	}
+
+	for i, test := range []struct {
+		accept           string
+		expectedEncoding string
+		expectedBody     string
+	}{
+		{"gzip, x-reverse", "x-reverse", "2olleh"},
+		{"gzip, x-reverse;q=0.5", "gzip", "hello"},
+		{"br", "", "hello"},
+	} {
+		r := httptest.NewRequest("GET", "/file.txt", nil)
+		r.Header.Set("Accept-Encoding", test.accept)
+		rec := mwtest.Serve(g, r)
+		rec.AssertHeader(t, "Content-Encoding", test.expectedEncoding)
+		rec.AssertHeader(t, "Vary", "Accept-Encoding")
+
+		body := rec.Body.Bytes()
+		if test.expectedEncoding == "gzip" {
+			zr, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("Test %d: %v", i, err)
+			}
+			body, _ = ioutil.ReadAll(zr)
+		}
+		if string(body) != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+	}
+
+	expected := append([]string{"x-reverse"}, builtEncodings...)
+	sort.Strings(expected)
+	if names := strings.Join(EncodingNames(), " "); names != strings.Join(expected, " ") {
+		t.Errorf("Expected encodings %s, got %s", strings.Join(expected, " "), names)
+	}
+}
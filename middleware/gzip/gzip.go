@@ -1,19 +1,24 @@
-// Package gzip provides a simple middleware layer that performs
-// gzip compression on the response.
+// Package gzip provides a simple middleware layer that compresses
+// responses with gzip or, with other encodings plugged in with
+// RegisterEncoding, whichever the client prefers.
 package gzip
 
 import (
-	"compress/gzip"
+	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/mholt/caddy/middleware"
 )
 
-// Gzip is a middleware type which gzips HTTP responses. It is
-// imperative that any handler which writes to a gzipped response
+// Gzip is a middleware type which compresses HTTP responses. It is
+// imperative that any handler which writes to a compressed response
 // specifies the Content-Type, otherwise some clients will assume
 // application/x-gzip and try to download a file.
 type Gzip struct {
@@ -24,42 +29,70 @@ type Gzip struct {
 // Config holds the configuration for Gzip middleware
 type Config struct {
 	Filters []Filter // Filters to use
-	Level   int      // Compression level
+
+	// Encodings to offer, in order of preference; just
+	// gzip if empty
+	Encodings []string
+
+	// Compression level of each encoding; those not
+	// in it use their default level
+	Levels map[string]int
+
+	// Media types of responses to compress, like text/html
+	// or text/*; any type if empty. Images and archives are
+	// compressed already, so there is little to gain.
+	MIMETypes []string
+
+	// Smallest response body to compress, in bytes; smaller
+	// ones would hardly shrink, if not grow. Up to this many
+	// bytes are held back until it is known how long the
+	// body is, unless its Content-Length is given.
+	MinLength int
 }
 
-// ServeHTTP serves a gzipped response if the client supports it.
+// ServeHTTP serves a compressed response if the client supports it.
 func (g Gzip) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
-	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+	accept := r.Header.Get("Accept-Encoding")
+	if accept == "" {
 		return g.Next.ServeHTTP(w, r)
 	}
 
 outer:
 	for _, c := range g.Configs {
 
-		// Check filters to determine if gzipping is permitted for this request
+		// Check filters to determine if compression is permitted for this request
 		for _, filter := range c.Filters {
 			if !filter.ShouldCompress(r) {
 				continue outer
 			}
 		}
 
-		// Delete this header so gzipping is not repeated later in the chain
+		// Responses to this request vary by encoding from here on,
+		// even if the client accepts none that are offered
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		name := negotiate(accept, c.encodings())
+		if name == "" {
+			break
+		}
+
+		// Delete this header so compression is not repeated later in the chain
 		r.Header.Del("Accept-Encoding")
 
-		w.Header().Set("Content-Encoding", "gzip")
-		gzipWriter, err := newWriter(c, w)
+		w.Header().Set("Content-Encoding", name)
+		encWriter, err := c.newWriter(name, w)
 		if err != nil {
 			// should not happen
 			return http.StatusInternalServerError, err
 		}
-		defer gzipWriter.Close()
-		gz := gzipResponseWriter{Writer: gzipWriter, ResponseWriter: w}
+		gz := &gzipResponseWriter{ResponseWriter: w, enc: encWriter, encoding: name, config: c}
+		defer gz.close()
 
 		// Any response in forward middleware will now be compressed
 		status, err := g.Next.ServeHTTP(gz, r)
 
 		// If there was an error that remained unhandled, we need
-		// to send something back before gzipWriter gets closed at
+		// to send something back before encWriter gets closed at
 		// the return of this method!
 		if status >= 400 {
 			gz.Header().Set("Content-Type", "text/plain") // very necessary
@@ -70,41 +103,221 @@ outer:
 		return status, err
 	}
 
-	// no matching filter
+	// no matching filter or encoding
 	return g.Next.ServeHTTP(w, r)
 }
 
-// newWriter create a new Gzip Writer based on the compression level.
-// If the level is valid (i.e. between 1 and 9), it uses the level.
-// Otherwise, it uses default compression level.
-func newWriter(c Config, w http.ResponseWriter) (*gzip.Writer, error) {
-	if c.Level >= gzip.BestSpeed && c.Level <= gzip.BestCompression {
-		return gzip.NewWriterLevel(w, c.Level)
+// encodings returns the encodings c offers.
+func (c Config) encodings() []string {
+	if len(c.Encodings) == 0 {
+		return []string{"gzip"}
+	}
+	return c.Encodings
+}
+
+// matchesType returns true if contentType is one of
+// the media types c compresses.
+func (c Config) matchesType(contentType string) bool {
+	if len(c.MIMETypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.MIMETypes {
+		if t == mediaType || strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// newWriter creates a writer that compresses into w with the
+// encoding name, at its level in c if it's valid and at the
+// default level otherwise.
+func (c Config) newWriter(name string, w io.Writer) (io.WriteCloser, error) {
+	e, ok := LookupEncoding(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding %s", name)
+	}
+	level, ok := c.Levels[name]
+	if !ok || !e.ValidLevel(level) {
+		level = DefaultLevel
 	}
-	return gzip.NewWriter(w), nil
+	return e.NewWriter(w, level)
 }
 
 // gzipResponeWriter wraps the underlying Write method
-// with a gzip.Writer to compress the output.
+// with the writer of an Encoding to compress the output.
+// Whether the response is worth compressing may depend on
+// its Content-Type and length, so the header and the start
+// of the body are held back until that is decided.
 type gzipResponseWriter struct {
-	io.Writer
 	http.ResponseWriter
+	enc      io.WriteCloser
+	encoding string
+	config   Config
+
+	status   int    // held back status code, if any
+	buf      []byte // held back start of the body
+	decided  bool
+	compress bool
+	hijacked bool
+}
+
+// compressible returns true if the response is of a type
+// that should be compressed and hasn't been encoded already
+// by a handler further down the chain, like a proxy whose
+// backend compresses its responses.
+func (w *gzipResponseWriter) compressible() bool {
+	if w.Header().Get("Content-Encoding") != w.encoding {
+		return false
+	}
+	if w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+	return w.config.matchesType(w.Header().Get("Content-Type"))
+}
+
+// decide settles whether to compress the response, and sends
+// the header and whatever was held back of the body.
+func (w *gzipResponseWriter) decide(compress bool) {
+	w.decided, w.compress = true, compress
+	if compress {
+		w.Header().Del("Content-Length")
+		// the compressed body isn't byte for byte the same
+		if etag := w.Header().Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			w.Header().Set("ETag", "W/"+etag)
+		}
+	} else if w.Header().Get("Content-Encoding") == w.encoding {
+		w.Header().Del("Content-Encoding")
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if len(w.buf) > 0 {
+		w.write(w.buf)
+		w.buf = nil
+	}
+}
+
+// write writes b to the client, compressed or not as decided.
+func (w *gzipResponseWriter) write(b []byte) (int, error) {
+	if w.compress {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// close sends what was held back and finishes the compressed
+// stream, unless the connection was hijacked and it no longer
+// can be.
+func (w *gzipResponseWriter) close() {
+	if w.hijacked {
+		return
+	}
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			// nothing was written; don't claim an encoding
+			w.Header().Del("Content-Encoding")
+			return
+		}
+		w.decide(w.compressible() && len(w.buf) >= w.config.MinLength)
+	}
+	if w.compress {
+		w.enc.Close()
+	}
 }
 
 // WriteHeader wraps the underlying WriteHeader method to prevent
 // problems with conflicting headers from proxied backends. For
 // example, a backend system that calculates Content-Length would
-// be wrong because it doesn't know it's being gzipped.
-func (w gzipResponseWriter) WriteHeader(code int) {
-	w.Header().Del("Content-Length")
-	w.ResponseWriter.WriteHeader(code)
+// be wrong because it doesn't know it's being compressed. The
+// header is held back if the body must be seen to know whether
+// to compress it. Informational (1xx) responses come before the
+// final one, so they are passed on without being recorded.
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if code < 200 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.decided || w.status != 0 {
+		return
+	}
+	w.status = code
+	if length, err := strconv.Atoi(w.Header().Get("Content-Length")); err == nil {
+		w.decide(w.compressible() && length >= w.config.MinLength)
+		return
+	}
+	typeKnown := len(w.config.MIMETypes) == 0 || w.Header().Get("Content-Type") != ""
+	if w.config.MinLength == 0 && typeKnown {
+		w.decide(w.compressible())
+	}
 }
 
 // Write wraps the underlying Write method to do compression.
-func (w gzipResponseWriter) Write(b []byte) (int, error) {
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
 	if w.Header().Get("Content-Type") == "" {
 		w.Header().Set("Content-Type", http.DetectContentType(b))
 	}
-	n, err := w.Writer.Write(b)
-	return n, err
+	if w.decided {
+		return w.write(b)
+	}
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+		if w.decided {
+			return w.write(b)
+		}
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.config.MinLength {
+		w.decide(w.compressible())
+	}
+	return len(b), nil
+}
+
+// Flush sends what has been compressed so far to the client, so
+// streamed responses such as server-sent events aren't held back
+// until the compressor's buffer fills. A response that is being
+// streamed is compressed whatever its length.
+func (w *gzipResponseWriter) Flush() {
+	if w.hijacked {
+		return
+	}
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.decide(w.compressible())
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok && w.compress {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the underlying connection, which is needed to
+// proxy websockets; nothing more is compressed once it is.
+func (w *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("I'm not a Hijacker")
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// CloseNotify returns the underlying writer's channel that
+// receives when the client goes away, or nil if it has none.
+func (w *gzipResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return nil
 }
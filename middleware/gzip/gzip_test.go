@@ -1,9 +1,18 @@
 package gzip
 
 import (
+	"bufio"
+	"compress/gzip"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/mholt/caddy/middleware"
@@ -87,7 +96,7 @@ func nextFunc(shouldGzip bool) middleware.Handler {
 			if w.Header().Get("Content-Encoding") != "gzip" {
 				return 0, fmt.Errorf("Content-Encoding must be gzip, found %v", r.Header.Get("Content-Encoding"))
 			}
-			if _, ok := w.(gzipResponseWriter); !ok {
+			if _, ok := w.(*gzipResponseWriter); !ok {
 				return 0, fmt.Errorf("ResponseWriter should be gzipResponseWriter, found %T", w)
 			}
 			return 0, nil
@@ -98,9 +107,198 @@ func nextFunc(shouldGzip bool) middleware.Handler {
 		if w.Header().Get("Content-Encoding") == "gzip" {
 			return 0, fmt.Errorf("Content-Encoding must not be gzip, found gzip")
 		}
-		if _, ok := w.(gzipResponseWriter); ok {
+		if _, ok := w.(*gzipResponseWriter); ok {
 			return 0, fmt.Errorf("ResponseWriter should not be gzipResponseWriter")
 		}
 		return 0, nil
 	})
 }
+
+func TestGzipFlushHijack(t *testing.T) {
+	gz := Gzip{Configs: []Config{{}}}
+
+	// what was written must reach the client when flushed,
+	// before the compressed stream is finished
+	var streamed string
+	gz.Next = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: hello\n\n")
+		w.(http.Flusher).Flush()
+
+		rec := w.(*gzipResponseWriter).ResponseWriter.(*httptest.ResponseRecorder)
+		zr, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		b, _ := io.ReadAll(zr)
+		streamed = string(b)
+		return http.StatusOK, nil
+	})
+	r := httptest.NewRequest("GET", "/events", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	if _, err := gz.ServeHTTP(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if !w.Flushed {
+		t.Error("Expected the underlying writer to be flushed")
+	}
+	if streamed != "data: hello\n\n" {
+		t.Errorf("Expected the event to be sent when flushed, got %q", streamed)
+	}
+
+	// nothing may be written once the connection is hijacked
+	gz.Next = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		if _, ok := w.(http.CloseNotifier); !ok {
+			return http.StatusInternalServerError, errors.New("expected a CloseNotifier")
+		}
+		_, _, err := w.(http.Hijacker).Hijack()
+		return 0, err
+	})
+	hw := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	r.Header.Set("Accept-Encoding", "gzip")
+	if _, err := gz.ServeHTTP(hw, r); err != nil {
+		t.Fatal(err)
+	}
+	if !hw.hijacked {
+		t.Error("Expected the underlying writer to be hijacked")
+	}
+	if hw.Body.Len() != 0 {
+		t.Errorf("Expected nothing written after hijacking, got %d bytes", hw.Body.Len())
+	}
+}
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+func TestGzipConditions(t *testing.T) {
+	big := strings.Repeat("compress me ", 100)
+	for i, test := range []struct {
+		config        Config
+		contentType   string
+		contentLength bool
+		body          string
+		writes        int
+		expectedGzip  bool
+	}{
+		{Config{}, "", false, big, 1, true},
+		{Config{}, "", false, "", 0, false},
+		{Config{MinLength: 100}, "", false, "tiny", 1, false},
+		{Config{MinLength: 100}, "", false, big, 1, true},
+		{Config{MinLength: 100}, "", false, big, 20, true},
+		{Config{MinLength: 100}, "text/plain", true, "tiny", 1, false},
+		{Config{MinLength: 100}, "text/plain", true, big, 1, true},
+		{Config{MIMETypes: []string{"text/*"}}, "text/css", false, big, 1, true},
+		{Config{MIMETypes: []string{"text/*"}}, "image/png", false, big, 1, false},
+		{Config{MIMETypes: []string{"application/json"}}, "application/json; charset=utf-8", false, big, 1, true},
+		{Config{MIMETypes: []string{"text/*"}}, "", false, big, 1, true}, // sniffed
+		{Config{MIMETypes: []string{"image/*"}}, "", false, big, 1, false},
+	} {
+		gz := Gzip{Configs: []Config{test.config}}
+		gz.Next = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if test.contentType != "" {
+				w.Header().Set("Content-Type", test.contentType)
+			}
+			w.Header().Set("ETag", `"v1"`)
+			if test.contentLength {
+				w.Header().Set("Content-Length", strconv.Itoa(len(test.body)))
+				w.WriteHeader(http.StatusOK)
+			}
+			for n := 0; n < test.writes; n++ {
+				part := test.body[n*len(test.body)/test.writes : (n+1)*len(test.body)/test.writes]
+				io.WriteString(w, part)
+			}
+			return http.StatusOK, nil
+		})
+		r := httptest.NewRequest("GET", "/file", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		if _, err := gz.ServeHTTP(w, r); err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+
+		gzipped := w.Header().Get("Content-Encoding") == "gzip"
+		if gzipped != test.expectedGzip {
+			t.Errorf("Test %d: Expected compressed to be %v, got %v", i, test.expectedGzip, gzipped)
+		}
+		body := w.Body.String()
+		if gzipped {
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("Test %d: %v", i, err)
+			}
+			b, _ := io.ReadAll(zr)
+			body = string(b)
+			if w.Header().Get("Content-Length") != "" {
+				t.Errorf("Test %d: Expected no Content-Length when compressed", i)
+			}
+		}
+		expectedETag := `"v1"`
+		if gzipped {
+			expectedETag = `W/"v1"`
+		}
+		if got := w.Header().Get("ETag"); got != expectedETag {
+			t.Errorf("Test %d: Expected ETag %s, got %s", i, expectedETag, got)
+		}
+		if body != test.body {
+			t.Errorf("Test %d: Expected body of %d bytes, got %d", i, len(test.body), len(body))
+		}
+	}
+}
+
+func TestGzipEarlyHints(t *testing.T) {
+	big := strings.Repeat("compress me ", 100)
+	gz := Gzip{Configs: []Config{{}}}
+	gz.Next = middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		w.Header().Set("Link", "</style.css>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, big)
+		return http.StatusCreated, nil
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	var informational []int
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			informational = append(informational, code)
+			return nil
+		},
+	}
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if len(informational) != 1 || informational[0] != http.StatusEarlyHints {
+		t.Errorf("Expected a 103 before the response, got %v", informational)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected final status %d after a 103, got %d", http.StatusCreated, resp.StatusCode)
+	}
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected the final response to be compressed")
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(zr); string(b) != big {
+		t.Errorf("Expected body of %d bytes, got %d", len(big), len(b))
+	}
+}
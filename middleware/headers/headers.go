@@ -19,15 +19,31 @@ type Headers struct {
 
 // ServeHTTP implements the middleware.Handler interface and serves requests,
 // setting headers on the response according to the configured rules.
+// The placeholder middleware.CSPNoncePlaceholder in a header value is
+// replaced by the request's nonce, which later handlers (such as
+// templates) get as well; the placeholders of middleware.Replacer
+// are replaced with values from the request.
 func (h Headers) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	var rep middleware.Replacer
 	for _, rule := range h.Rules {
 		if middleware.Path(r.URL.Path).Matches(rule.Path) {
 			for _, header := range rule.Headers {
 				if strings.HasPrefix(header.Name, "-") {
 					w.Header().Del(strings.TrimLeft(header.Name, "-"))
-				} else {
-					w.Header().Set(header.Name, header.Value)
+					continue
 				}
+				value := header.Value
+				if strings.Contains(value, middleware.CSPNoncePlaceholder) {
+					r = middleware.WithCSPNonce(r)
+					value = strings.Replace(value, middleware.CSPNoncePlaceholder, middleware.CSPNonce(r), -1)
+				}
+				if strings.Contains(value, "{") {
+					if rep == nil {
+						rep = middleware.NewReplacer(r, nil, "")
+					}
+					value = rep.Replace(value)
+				}
+				w.Header().Set(header.Name, value)
 			}
 		}
 	}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/mholt/caddy/middleware"
+	mwtest "github.com/mholt/caddy/middleware/testing"
 )
 
 func TestHeaders(t *testing.T) {
@@ -19,6 +20,8 @@ func TestHeaders(t *testing.T) {
 		{"/a", "Baz", ""},
 		{"/b", "Foo", ""},
 		{"/b", "Bar", "Removed in /a"},
+		{"/a?v=2", "Link", "</a/style.css?v=2>; rel=preload"},
+		{"/a", "X-Host", "example.com {unknown}"},
 	} {
 		he := Headers{
 			Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
@@ -28,11 +31,13 @@ func TestHeaders(t *testing.T) {
 				{Path: "/a", Headers: []Header{
 					{Name: "Foo", Value: "Bar"},
 					{Name: "-Bar"},
+					{Name: "Link", Value: "<{path}/style.css?v={?v}>; rel=preload"},
+					{Name: "X-Host", Value: "{host} {unknown}"},
 				}},
 			},
 		}
 
-		req, err := http.NewRequest("GET", test.from, nil)
+		req, err := http.NewRequest("GET", "http://example.com"+test.from, nil)
 		if err != nil {
 			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
 		}
@@ -48,3 +53,24 @@ func TestHeaders(t *testing.T) {
 		}
 	}
 }
+
+func TestHeadersChain(t *testing.T) {
+	next := &mwtest.Handler{Body: "hello"}
+	h := mwtest.Chain(next, func(next middleware.Handler) middleware.Handler {
+		return Headers{Next: next, Rules: []Rule{
+			{Path: "/a", Headers: []Header{{Name: "Foo", Value: "Bar"}}},
+		}}
+	})
+
+	rec := mwtest.Serve(h, httptest.NewRequest("GET", "/a/b", nil))
+	rec.AssertNoError(t)
+	rec.AssertStatus(t, http.StatusOK)
+	rec.AssertHeader(t, "Foo", "Bar")
+	rec.AssertBody(t, "hello")
+
+	rec = mwtest.Serve(h, httptest.NewRequest("GET", "/b", nil))
+	rec.AssertHeader(t, "Foo", "")
+	if next.Calls() != 2 {
+		t.Errorf("Expected next handler to be called twice, got %d", next.Calls())
+	}
+}
@@ -0,0 +1,68 @@
+// Package hostroute is middleware that sends the requests for
+// some hosts of a site through handlers of their own, so one
+// site (such as one for *.example.com) can do different things
+// for different hosts.
+package hostroute
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// HostRoute sends requests for the hosts of a route to its
+// Handler, and all other requests to Next. The first route
+// with a matching host wins.
+type HostRoute struct {
+	Next   middleware.Handler
+	Routes []Route
+}
+
+// Route is a set of host patterns and the handler for them,
+// which usually passes requests on to the rest of the site
+// once its own middleware is done with them.
+type Route struct {
+	Hosts   []string
+	Handler middleware.Handler
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (h HostRoute) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	host := hostname(r.Host)
+	for _, route := range h.Routes {
+		for _, pattern := range route.Hosts {
+			if Matches(pattern, host) {
+				return route.Handler.ServeHTTP(w, r)
+			}
+		}
+	}
+	return h.Next.ServeHTTP(w, r)
+}
+
+// Matches returns true if host matches pattern, ignoring case.
+// A pattern is a hostname, or a hostname with a wildcard label
+// in front, like *.example.com, which matches any one label in
+// its place (as a wildcard certificate does), but not the bare
+// example.com nor a.b.example.com.
+func Matches(pattern, host string) bool {
+	pattern, host = strings.ToLower(pattern), strings.ToLower(host)
+	if !strings.HasPrefix(pattern, "*.") {
+		return pattern == host
+	}
+	suffix := pattern[1:]
+	if !strings.HasSuffix(host, suffix) {
+		return false
+	}
+	label := host[:len(host)-len(suffix)]
+	return label != "" && !strings.Contains(label, ".")
+}
+
+// hostname returns host without its port or trailing dot.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
@@ -0,0 +1,58 @@
+package hostroute
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mwtest "github.com/mholt/caddy/middleware/testing"
+)
+
+func TestMatches(t *testing.T) {
+	for i, test := range []struct {
+		pattern, host string
+		expected      bool
+	}{
+		{"api.example.com", "api.example.com", true},
+		{"api.example.com", "API.Example.com", true},
+		{"api.example.com", "www.example.com", false},
+		{"*.example.com", "static.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "a.b.example.com", false},
+		{"*.example.com", "badexample.com", false},
+		{"*.example.com", ".example.com", false},
+	} {
+		if actual := Matches(test.pattern, test.host); actual != test.expected {
+			t.Errorf("Test %d: Expected %s matching %s to be %v, got %v", i, test.host, test.pattern, test.expected, actual)
+		}
+	}
+}
+
+func TestHostRoute(t *testing.T) {
+	h := HostRoute{
+		Next: &mwtest.Handler{Body: "site"},
+		Routes: []Route{
+			{Hosts: []string{"api.example.com"}, Handler: &mwtest.Handler{Body: "api"}},
+			{Hosts: []string{"static.example.com", "*.cdn.example.com"}, Handler: &mwtest.Handler{Body: "static"}},
+		},
+	}
+
+	for i, test := range []struct {
+		host, expectedBody string
+	}{
+		{"api.example.com", "api"},
+		{"api.example.com:8443", "api"},
+		{"api.example.com.", "api"},
+		{"static.example.com", "static"},
+		{"eu.cdn.example.com", "static"},
+		{"www.example.com", "site"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = test.host
+		rec := mwtest.Serve(h, r)
+		rec.AssertStatus(t, http.StatusOK)
+		if got := rec.Body.String(); got != test.expectedBody {
+			t.Errorf("Test %d: Expected %s to be handled by %q, got %q", i, test.host, test.expectedBody, got)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Package hotlink provides middleware that keeps other sites
+// from embedding a site's media files, by checking the Referer
+// header of requests for them.
+package hotlink
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// DefaultExtensions are the extensions of the media
+// files protected if none are given.
+var DefaultExtensions = []string{
+	".jpg", ".jpeg", ".png", ".gif", ".webp", ".avif", ".svg", ".ico",
+	".mp4", ".webm", ".ogg", ".mp3", ".m4a", ".wav", ".flac",
+}
+
+// Hotlink is middleware that blocks requests for files with
+// one of Extensions whose Referer is another site. Requests
+// are allowed if they come from the site's own hosts (the
+// request's Host) or one of Allowed.
+type Hotlink struct {
+	Next       middleware.Handler
+	Extensions []string
+
+	// Hosts of the sites that may embed the files; a host
+	// like "*.example.com" allows all of example.com's
+	// subdomains (but not example.com)
+	Allowed []string
+
+	// Whether to block requests without a Referer; browsers
+	// leave it out for privacy sometimes, so they are allowed
+	// by default
+	BlockEmpty bool
+
+	// Where to redirect blocked requests, like a placeholder
+	// image; they get 403 Forbidden if empty
+	Placeholder string
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (h Hotlink) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !h.protects(r.URL.Path) || h.allowed(r) {
+		return h.Next.ServeHTTP(w, r)
+	}
+
+	if h.Placeholder != "" {
+		http.Redirect(w, r, h.Placeholder, http.StatusFound)
+		return 0, nil
+	}
+	return http.StatusForbidden, nil
+}
+
+// protects returns true if the file at urlPath is protected.
+func (h Hotlink) protects(urlPath string) bool {
+	if urlPath == h.Placeholder {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(urlPath))
+	for _, e := range h.Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed returns true if the Referer of r is allowed.
+func (h Hotlink) allowed(r *http.Request) bool {
+	referer := r.Referer()
+	if referer == "" {
+		return !h.BlockEmpty
+	}
+	u, err := url.Parse(referer)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+
+	own := r.Host
+	if ownHost, _, err := net.SplitHostPort(own); err == nil {
+		own = ownHost
+	}
+	if host == strings.ToLower(own) {
+		return true
+	}
+
+	for _, allowed := range h.Allowed {
+		allowed = strings.ToLower(allowed)
+		if host == allowed ||
+			strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package hotlink
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	mwtest "github.com/mholt/caddy/middleware/testing"
+)
+
+func TestHotlink(t *testing.T) {
+	for i, test := range []struct {
+		hotlink          Hotlink
+		path             string
+		referer          string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{Hotlink{}, "/a.jpg", "", 200, ""},
+		{Hotlink{}, "/a.jpg", "https://example.com/page", 200, ""},
+		{Hotlink{}, "/a.JPG", "https://thief.net/page", 403, ""},
+		{Hotlink{}, "/a.html", "https://thief.net/page", 200, ""},
+		{Hotlink{}, "/a.jpg", "not a url", 403, ""},
+		{Hotlink{BlockEmpty: true}, "/a.jpg", "", 403, ""},
+		{Hotlink{Allowed: []string{"friend.org"}}, "/a.jpg", "http://FRIEND.org/", 200, ""},
+		{Hotlink{Allowed: []string{"*.friend.org"}}, "/a.jpg", "http://www.friend.org/", 200, ""},
+		{Hotlink{Allowed: []string{"*.friend.org"}}, "/a.jpg", "http://friend.org/", 403, ""},
+		{Hotlink{Allowed: []string{"*.friend.org"}}, "/a.jpg", "http://notfriend.org/", 403, ""},
+		{Hotlink{Placeholder: "/nope.png"}, "/a.jpg", "https://thief.net/", 302, "/nope.png"},
+		{Hotlink{Placeholder: "/nope.png"}, "/nope.png", "https://thief.net/", 200, ""},
+	} {
+		h := test.hotlink
+		h.Next = &mwtest.Handler{}
+		h.Extensions = []string{".jpg", ".png"}
+
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.Host = "example.com:8080"
+		if test.referer != "" {
+			r.Header.Set("Referer", test.referer)
+		}
+		rec := mwtest.Serve(h, r)
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, rec.Code)
+		}
+		if location := rec.Header().Get("Location"); location != test.expectedLocation {
+			t.Errorf("Test %d: Expected Location %q, got %q", i, test.expectedLocation, location)
+		}
+	}
+
+	if !(Hotlink{Extensions: DefaultExtensions}).protects("/video.webm") {
+		t.Error("Expected videos to be protected by default")
+	}
+}
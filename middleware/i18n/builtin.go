@@ -0,0 +1,102 @@
+package i18n
+
+// builtin are the translations that come with the server. The
+// English messages are what any locale falls back to; English
+// status texts are those of http.StatusText.
+var builtin = map[string]Messages{
+	"en": {
+		"browse.up":          "Up one level",
+		"browse.preview":     "Preview",
+		"browse.name":        "Name",
+		"browse.size":        "Size",
+		"browse.modified":    "Modified",
+		"browse.directory":   "directory",
+		"browse.directories": "directories",
+		"browse.file":        "file",
+		"browse.files":       "files",
+		"browse.previous":    "Previous",
+		"browse.next":        "Next",
+		"browse.page":        "Page %d of %d",
+	},
+	"de": {
+		"browse.up":          "Eine Ebene höher",
+		"browse.preview":     "Vorschau",
+		"browse.name":        "Name",
+		"browse.size":        "Größe",
+		"browse.modified":    "Geändert",
+		"browse.directory":   "Verzeichnis",
+		"browse.directories": "Verzeichnisse",
+		"browse.file":        "Datei",
+		"browse.files":       "Dateien",
+		"browse.previous":    "Zurück",
+		"browse.next":        "Weiter",
+		"browse.page":        "Seite %d von %d",
+
+		"status.400": "Ungültige Anfrage",
+		"status.401": "Nicht autorisiert",
+		"status.403": "Verboten",
+		"status.404": "Nicht gefunden",
+		"status.405": "Methode nicht erlaubt",
+		"status.408": "Zeitüberschreitung der Anfrage",
+		"status.413": "Anfrage zu groß",
+		"status.429": "Zu viele Anfragen",
+		"status.500": "Interner Serverfehler",
+		"status.502": "Fehlerhaftes Gateway",
+		"status.503": "Dienst nicht verfügbar",
+		"status.504": "Zeitüberschreitung des Gateways",
+	},
+	"es": {
+		"browse.up":          "Subir un nivel",
+		"browse.preview":     "Vista previa",
+		"browse.name":        "Nombre",
+		"browse.size":        "Tamaño",
+		"browse.modified":    "Modificado",
+		"browse.directory":   "directorio",
+		"browse.directories": "directorios",
+		"browse.file":        "archivo",
+		"browse.files":       "archivos",
+		"browse.previous":    "Anterior",
+		"browse.next":        "Siguiente",
+		"browse.page":        "Página %d de %d",
+
+		"status.400": "Solicitud incorrecta",
+		"status.401": "No autorizado",
+		"status.403": "Prohibido",
+		"status.404": "No encontrado",
+		"status.405": "Método no permitido",
+		"status.408": "Tiempo de espera agotado",
+		"status.413": "Solicitud demasiado grande",
+		"status.429": "Demasiadas solicitudes",
+		"status.500": "Error interno del servidor",
+		"status.502": "Puerta de enlace incorrecta",
+		"status.503": "Servicio no disponible",
+		"status.504": "Tiempo de espera de la puerta de enlace agotado",
+	},
+	"fr": {
+		"browse.up":          "Remonter d'un niveau",
+		"browse.preview":     "Aperçu",
+		"browse.name":        "Nom",
+		"browse.size":        "Taille",
+		"browse.modified":    "Modifié",
+		"browse.directory":   "dossier",
+		"browse.directories": "dossiers",
+		"browse.file":        "fichier",
+		"browse.files":       "fichiers",
+		"browse.previous":    "Précédent",
+		"browse.next":        "Suivant",
+		"browse.page":        "Page %d sur %d",
+
+		"status.400": "Requête incorrecte",
+		"status.401": "Non autorisé",
+		"status.403": "Interdit",
+		"status.404": "Introuvable",
+		"status.405": "Méthode non autorisée",
+		"status.408": "Délai d'attente de la requête dépassé",
+		"status.413": "Requête trop volumineuse",
+		"status.429": "Trop de requêtes",
+		"status.500": "Erreur interne du serveur",
+		"status.502": "Mauvaise passerelle",
+		"status.503": "Service indisponible",
+		"status.504": "Délai d'attente de la passerelle dépassé",
+	},
+}
@@ -0,0 +1,249 @@
+// Package i18n keeps catalogs of the messages on the pages the
+// server makes itself, such as default error pages and directory
+// listings, in the languages it can serve them in.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is the language messages are in when a client
+// doesn't ask for one that a catalog has.
+const DefaultLocale = "en"
+
+// Messages maps the key of each message to its text. The keys of
+// status texts are "status." followed by the code, like "status.404".
+type Messages map[string]string
+
+// Catalog holds the messages of each locale. Locales are language
+// tags, like "de" or "pt-br", and are kept lowercase. A message that
+// a locale lacks falls back to its base language ("pt" for "pt-br"),
+// and then to English.
+type Catalog struct {
+	locales map[string]Messages
+}
+
+// Default is the catalog of the translations that come with the
+// server. It must not be changed; use NewCatalog to add to it.
+var Default = NewCatalog()
+
+// NewCatalog returns a catalog of the translations that
+// come with the server, which can be added to or overridden.
+func NewCatalog() *Catalog {
+	c := &Catalog{locales: make(map[string]Messages)}
+	for locale, msgs := range builtin {
+		c.Add(locale, msgs)
+	}
+	return c
+}
+
+// Add adds msgs to the messages of locale, replacing
+// any that it already has with the same keys.
+func (c *Catalog) Add(locale string, msgs Messages) {
+	locale = strings.ToLower(locale)
+	if c.locales == nil {
+		c.locales = make(map[string]Messages)
+	}
+	if c.locales[locale] == nil {
+		c.locales[locale] = make(Messages)
+	}
+	for key, text := range msgs {
+		c.locales[locale][key] = text
+	}
+}
+
+// LoadDir adds the messages in the translation files in dir. Each
+// file is named by its locale, like de.json, and holds a JSON object
+// of keys to messages. Other files are ignored.
+func (c *Catalog) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		if _, err := os.Stat(dir); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var msgs Messages
+		if err := json.Unmarshal(body, &msgs); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		c.Add(strings.TrimSuffix(filepath.Base(file), ".json"), msgs)
+	}
+	return nil
+}
+
+// Locales returns the locales c has messages for, sorted.
+func (c *Catalog) Locales() []string {
+	var locales []string
+	if c != nil {
+		for locale := range c.locales {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Negotiate returns the locale of c that the Accept-Language
+// header value accept prefers most, or DefaultLocale.
+func (c *Catalog) Negotiate(accept string) string {
+	type choice struct {
+		tag string
+		q   float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(accept, ",") {
+		tag, q := parseQuality(part)
+		if tag != "" && q > 0 {
+			choices = append(choices, choice{tag, q})
+		}
+	}
+	// Most preferred first; those with the same
+	// quality stay in the order they were given
+	sort.SliceStable(choices, func(i, j int) bool {
+		return choices[i].q > choices[j].q
+	})
+
+	for _, ch := range choices {
+		if c.has(ch.tag) {
+			return ch.tag
+		}
+		base := baseLanguage(ch.tag)
+		if c.has(base) {
+			return base
+		}
+		if ch.tag == "*" || base == DefaultLocale {
+			return DefaultLocale
+		}
+	}
+	return DefaultLocale
+}
+
+// Translator returns a Translator for the locale that r prefers.
+func (c *Catalog) Translator(r *http.Request) Translator {
+	return Translator{catalog: c, Locale: c.Negotiate(r.Header.Get("Accept-Language"))}
+}
+
+// multilingual returns true if c has messages in
+// any language other than the default.
+func (c *Catalog) multilingual() bool {
+	if c == nil {
+		return false
+	}
+	for locale := range c.locales {
+		if baseLanguage(locale) != DefaultLocale {
+			return true
+		}
+	}
+	return false
+}
+
+// has returns true if c has messages for locale.
+func (c *Catalog) has(locale string) bool {
+	if c == nil {
+		return false
+	}
+	_, ok := c.locales[locale]
+	return ok
+}
+
+// lookup returns the message for key in locale, or else in
+// locale's base language, or else in English.
+func (c *Catalog) lookup(locale, key string) (string, bool) {
+	if c != nil {
+		for _, l := range []string{locale, baseLanguage(locale), DefaultLocale} {
+			if text, ok := c.locales[l][key]; ok {
+				return text, true
+			}
+		}
+	}
+	text, ok := builtin[DefaultLocale][key]
+	return text, ok
+}
+
+// Translator gives the messages of a catalog in one locale.
+// A Translator of a nil catalog gives English messages.
+type Translator struct {
+	catalog *Catalog
+	Locale  string
+}
+
+// T returns the message for key, formatted with args
+// like fmt.Sprintf if there are any. If no locale has
+// a message for key, key itself is returned.
+func (t Translator) T(key string, args ...interface{}) string {
+	text, ok := t.catalog.lookup(t.Locale, key)
+	if !ok {
+		text = key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// StatusText returns the text for the HTTP status code,
+// like http.StatusText does in English.
+func (t Translator) StatusText(code int) string {
+	if text, ok := t.catalog.lookup(t.Locale, "status."+strconv.Itoa(code)); ok {
+		return text
+	}
+	return http.StatusText(code)
+}
+
+// SetHeaders sets the Content-Language of a response that was
+// written in t's locale, and has caches vary it by the client's
+// Accept-Language. It does nothing if the catalog has no other
+// languages to choose from.
+func (t Translator) SetHeaders(h http.Header) {
+	if !t.catalog.multilingual() {
+		return
+	}
+	h.Add("Vary", "Accept-Language")
+	h.Set("Content-Language", t.Locale)
+}
+
+// baseLanguage returns the language of tag without its
+// region or script, like "pt" for "pt-br".
+func baseLanguage(tag string) string {
+	if i := strings.IndexAny(tag, "-_"); i > 0 {
+		return tag[:i]
+	}
+	return tag
+}
+
+// parseQuality splits an element of an Accept-Language header,
+// like "de-AT;q=0.8", into the lowercased tag and its quality,
+// which is 1 unless given.
+func parseQuality(part string) (string, float64) {
+	fields := strings.Split(part, ";")
+	tag := strings.ToLower(strings.TrimSpace(fields[0]))
+	q := 1.0
+	for _, param := range fields[1:] {
+		param = strings.TrimSpace(param)
+		if !strings.HasPrefix(param, "q=") && !strings.HasPrefix(param, "Q=") {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(param[2:], 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			parsed = 0
+		}
+		q = parsed
+	}
+	return tag, q
+}
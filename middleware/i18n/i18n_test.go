@@ -0,0 +1,168 @@
+package i18n
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	c := NewCatalog()
+	c.Add("pt-BR", Messages{"browse.name": "Nome"})
+
+	for i, test := range []struct {
+		accept   string
+		expected string
+	}{
+		{"", "en"},
+		{"de", "de"},
+		{"de-AT", "de"},
+		{"DE-at;q=0.9", "de"},
+		{"pt-BR", "pt-br"},
+		{"pt", "en"},
+		{"nl, fr;q=0.8, de;q=0.9", "de"},
+		{"nl, fr;q=0.8, *;q=0.5", "fr"},
+		{"nl, *;q=0.5", "en"},
+		{"en-GB, de;q=0.9", "en"},
+		{"fr;q=0, es", "es"},
+		{"fr;q=bogus, es;q=0.1", "es"},
+		{"fr, es", "fr"},
+	} {
+		if got := c.Negotiate(test.accept); got != test.expected {
+			t.Errorf("Test %d: Expected %s for %q, got %s", i, test.expected, test.accept, got)
+		}
+	}
+
+	var empty *Catalog
+	if got := empty.Negotiate("de"); got != DefaultLocale {
+		t.Errorf("Expected a nil catalog to negotiate %s, got %s", DefaultLocale, got)
+	}
+}
+
+func TestTranslator(t *testing.T) {
+	c := NewCatalog()
+	c.Add("de", Messages{"status.404": "Gibt es nicht"})
+	c.Add("de-ch", Messages{"browse.size": "Grösse"})
+
+	for i, test := range []struct {
+		catalog  *Catalog
+		locale   string
+		key      string
+		args     []interface{}
+		expected string
+	}{
+		{c, "de", "status.404", nil, "Gibt es nicht"},
+		{c, "de", "status.403", nil, "Verboten"},
+		{c, "de-ch", "browse.size", nil, "Grösse"},
+		{c, "de-ch", "browse.name", nil, "Name"},
+		{c, "de-ch", "browse.modified", nil, "Geändert"},
+		{c, "de", "browse.page", []interface{}{2, 3}, "Seite 2 von 3"},
+		{c, "fr", "browse.up", nil, "Remonter d'un niveau"},
+		{c, "es", "no.such.key", nil, "no.such.key"},
+		{nil, "de", "browse.page", []interface{}{1, 4}, "Page 1 of 4"},
+		{new(Catalog), "de", "browse.up", nil, "Up one level"},
+	} {
+		tr := Translator{catalog: test.catalog, Locale: test.locale}
+		if got := tr.T(test.key, test.args...); got != test.expected {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.expected, got)
+		}
+	}
+
+	for i, test := range []struct {
+		catalog  *Catalog
+		locale   string
+		code     int
+		expected string
+	}{
+		{c, "de", 404, "Gibt es nicht"},
+		{c, "fr", 503, "Service indisponible"},
+		{c, "fr", 418, "I'm a teapot"},
+		{c, "en", 404, "Not Found"},
+		{nil, "de", 500, "Internal Server Error"},
+	} {
+		tr := Translator{catalog: test.catalog, Locale: test.locale}
+		if got := tr.StatusText(test.code); got != test.expected {
+			t.Errorf("Status test %d: Expected %q, got %q", i, test.expected, got)
+		}
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	for i, test := range []struct {
+		catalog          *Catalog
+		accept           string
+		expectedVary     string
+		expectedLanguage string
+	}{
+		{Default, "fr-CA", "Accept-Language", "fr"},
+		{Default, "", "Accept-Language", "en"},
+		{nil, "fr", "", ""},
+		{new(Catalog), "fr", "", ""},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", test.accept)
+		h := make(http.Header)
+		test.catalog.Translator(r).SetHeaders(h)
+		if got := h.Get("Vary"); got != test.expectedVary {
+			t.Errorf("Test %d: Expected Vary %q, got %q", i, test.expectedVary, got)
+		}
+		if got := h.Get("Content-Language"); got != test.expectedLanguage {
+			t.Errorf("Test %d: Expected Content-Language %q, got %q", i, test.expectedLanguage, got)
+		}
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "i18n_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"de.json":    `{"status.404": "Seite nicht gefunden"}`,
+		"nl.json":    `{"browse.name": "Naam", "status.404": "Niet gevonden"}`,
+		"README.txt": `not a translation`,
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewCatalog()
+	if err := c.LoadDir(dir); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if c.has("readme") {
+		t.Error("Expected files other than .json to be ignored")
+	}
+	for i, test := range []struct {
+		locale, key, expected string
+	}{
+		{"de", "status.404", "Seite nicht gefunden"},
+		{"de", "status.403", "Verboten"},
+		{"nl", "browse.name", "Naam"},
+		{"nl", "browse.size", "Size"},
+	} {
+		if got := (Translator{catalog: c, Locale: test.locale}).T(test.key); got != test.expected {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.expected, got)
+		}
+	}
+	if got := Default.Negotiate("nl"); got != DefaultLocale {
+		t.Errorf("Expected loading into a new catalog to leave Default alone, got %s", got)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "fr.json"), []byte(`["nope"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewCatalog().LoadDir(dir); err == nil {
+		t.Error("Expected an error for a malformed translation file")
+	}
+	if err := NewCatalog().LoadDir(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
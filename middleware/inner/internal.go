@@ -4,6 +4,9 @@
 package inner
 
 import (
+	"bufio"
+	"errors"
+	"net"
 	"net/http"
 
 	"github.com/mholt/caddy/middleware"
@@ -88,3 +91,33 @@ func (w internalResponseWriter) Write(b []byte) (int, error) {
 	}
 	return w.ResponseWriter.Write(b)
 }
+
+// Flush flushes the underlying writer, unless the response
+// should be redirected to an internal location.
+func (w internalResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && !isInternalRedirect(w) {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the underlying connection, if it can be.
+func (w internalResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("I'm not a Hijacker")
+}
+
+// CloseNotify returns the channel of the underlying writer
+// that receives when the client goes away, if it has one.
+func (w internalResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return nil
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (i Internal) Scopes() []string {
+	return i.Paths
+}
@@ -58,7 +58,7 @@ func internalTestHandlerFunc(w http.ResponseWriter, r *http.Request) (int, error
 		w.Header().Set("X-Accel-Redirect", "/cycle")
 	}
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, r.URL.String())
+	fmt.Fprint(w, r.URL.String())
 
 	return 0, nil
 }
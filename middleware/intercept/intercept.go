@@ -0,0 +1,215 @@
+// Package intercept provides middleware that replaces responses
+// with certain status codes, typically ones from a proxied backend,
+// with a local file or with the site's own error handling.
+package intercept
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Intercept is middleware that intercepts responses
+// whose status matches a rule for their path.
+type Intercept struct {
+	Next    middleware.Handler
+	FileSys http.FileSystem
+	Rules   []Rule
+}
+
+// Rule maps the statuses of responses to requests under
+// Path to what should be done with them instead.
+type Rule struct {
+	Path     string
+	Statuses map[int]Action
+}
+
+// Action describes how an intercepted response is replaced. If File
+// is empty, Status is returned down the chain without writing anything,
+// so the errors middleware handles it. Otherwise File, which is relative
+// to the site root, is served with Status.
+type Action struct {
+	File   string
+	Status int
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (i Intercept) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	rule := i.rule(r.URL.Path)
+	if rule == nil {
+		return i.Next.ServeHTTP(w, r)
+	}
+
+	iw := &interceptWriter{ResponseWriter: w, header: make(http.Header), statuses: rule.Statuses}
+	status, err := i.Next.ServeHTTP(iw, r)
+	if !iw.intercepted {
+		if iw.wroteHeader {
+			return status, err
+		}
+		if _, ok := rule.Statuses[status]; !ok || status < 400 {
+			iw.copyHeader()
+			return status, err
+		}
+		// the status was returned rather than written
+		iw.code = status
+	}
+
+	action := rule.Statuses[iw.code]
+	if action.File == "" {
+		return action.Status, err
+	}
+	return i.serveFile(w, action)
+}
+
+// rule returns the rule with the longest path that matches
+// urlPath, or nil if there is none.
+func (i Intercept) rule(urlPath string) *Rule {
+	var best *Rule
+	for j := range i.Rules {
+		rule := &i.Rules[j]
+		if middleware.Path(urlPath).Matches(rule.Path) && (best == nil || len(rule.Path) > len(best.Path)) {
+			best = rule
+		}
+	}
+	return best
+}
+
+// serveFile writes the file of action to w with the action's status.
+func (i Intercept) serveFile(w http.ResponseWriter, action Action) (int, error) {
+	name := path.Clean("/" + action.File)
+	file, err := i.FileSys.Open(name)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer file.Close()
+
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	w.WriteHeader(action.Status)
+	_, err = io.Copy(w, file)
+	return 0, err
+}
+
+// interceptWriter holds back the headers of the response until
+// its status is known, then either writes the response through
+// or discards it if the status is intercepted.
+type interceptWriter struct {
+	http.ResponseWriter
+	header      http.Header
+	statuses    map[int]Action
+	code        int
+	wroteHeader bool
+	intercepted bool
+}
+
+// Header returns the headers that will be written unless the
+// response is intercepted. Once they are written, it returns the
+// headers of the underlying writer, so trailers can be set.
+func (w *interceptWriter) Header() http.Header {
+	if w.wroteHeader {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+// WriteHeader writes the headers and status, unless
+// status is intercepted. Informational (1xx) responses
+// are always written, with the headers set so far.
+func (w *interceptWriter) WriteHeader(status int) {
+	if w.wroteHeader || w.intercepted {
+		return
+	}
+	if status < 200 && status != http.StatusSwitchingProtocols {
+		w.writeInformational(status)
+		return
+	}
+	if _, ok := w.statuses[status]; ok {
+		w.code = status
+		w.intercepted = true
+		return
+	}
+	w.wroteHeader = true
+	w.copyHeader()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes b, or discards it if the response is intercepted.
+func (w *interceptWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader && !w.intercepted {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.intercepted {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// writeInformational writes a 1xx response with the held back headers,
+// leaving the headers of the underlying writer as they were.
+func (w *interceptWriter) writeInformational(status int) {
+	h := w.ResponseWriter.Header()
+	saved := make(http.Header)
+	for k, v := range w.header {
+		if prev, ok := h[k]; ok {
+			saved[k] = prev
+		}
+		h[k] = v
+	}
+	w.ResponseWriter.WriteHeader(status)
+	for k := range w.header {
+		delete(h, k)
+	}
+	for k, v := range saved {
+		h[k] = v
+	}
+}
+
+// copyHeader copies the held back headers to the underlying writer.
+func (w *interceptWriter) copyHeader() {
+	for k, v := range w.header {
+		w.ResponseWriter.Header()[k] = v
+	}
+}
+
+// Flush flushes the underlying writer if it is an http.Flusher
+// and the response is not intercepted.
+func (w *interceptWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && w.wroteHeader {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the underlying connection, which
+// is needed to proxy websockets.
+func (w *interceptWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		w.copyHeader()
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("I'm not a Hijacker")
+}
+
+// CloseNotify returns the channel of the underlying writer
+// that receives when the client goes away, if it has one.
+func (w *interceptWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return nil
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (i Intercept) Scopes() []string {
+	scopes := make([]string, len(i.Rules))
+	for j, rule := range i.Rules {
+		scopes[j] = rule.Path
+	}
+	return scopes
+}
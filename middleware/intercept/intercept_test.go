@@ -0,0 +1,128 @@
+package intercept
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestIntercept(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_intercept")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "missing.html"), []byte("local page"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	i := Intercept{
+		Next:    middleware.HandlerFunc(interceptTestHandlerFunc),
+		FileSys: http.Dir(root),
+		Rules: []Rule{
+			{Path: "/", Statuses: map[int]Action{
+				502: {Status: 502},
+			}},
+			{Path: "/api", Statuses: map[int]Action{
+				404: {File: "/missing.html", Status: 404},
+				500: {File: "/missing.html", Status: 200},
+				503: {Status: 500},
+			}},
+		},
+	}
+
+	tests := []struct {
+		url          string
+		expectedCode int
+		expectedBody string
+		expectedRec  int
+	}{
+		// not intercepted
+		{"/200", 0, "backend 200", 200},
+		{"/404", 0, "backend 404", 404},
+		{"/api/200", 0, "backend 200", 200},
+		{"/api/502", 0, "backend 502", 502},
+
+		// handed to the errors middleware
+		{"/502", 502, "", 200},
+		{"/api/503", 500, "", 200},
+		{"/returned/502", 502, "", 200},
+
+		// replaced with a local file
+		{"/api/404", 0, "local page", 404},
+		{"/api/500", 0, "local page", 200},
+		{"/api/returned/404", 0, "local page", 404},
+	}
+
+	for j, test := range tests {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", j, err)
+		}
+
+		rec := httptest.NewRecorder()
+		code, _ := i.ServeHTTP(rec, req)
+
+		if code != test.expectedCode {
+			t.Errorf("Test %d: Expected status code %d for %s, but got %d",
+				j, test.expectedCode, test.url, code)
+		}
+		if rec.Code != test.expectedRec {
+			t.Errorf("Test %d: Expected response status %d for %s, but got %d",
+				j, test.expectedRec, test.url, rec.Code)
+		}
+		if rec.Body.String() != test.expectedBody {
+			t.Errorf("Test %d: Expected body '%s' for %s, but got '%s'",
+				j, test.expectedBody, test.url, rec.Body.String())
+		}
+		if test.expectedCode != 0 && rec.Header().Get("X-Backend") != "" {
+			t.Errorf("Test %d: Expected headers of intercepted response to be dropped", j)
+		}
+	}
+}
+
+func TestInterceptConfined(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret.html"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.html"), filepath.Join(root, "missing.html")); err != nil {
+		t.Skipf("Can't create symlinks: %v", err)
+	}
+
+	i := Intercept{
+		Next:    middleware.HandlerFunc(interceptTestHandlerFunc),
+		FileSys: middleware.ConfinedDir(root),
+		Rules: []Rule{{Path: "/", Statuses: map[int]Action{
+			404: {File: "/missing.html", Status: 404},
+		}}},
+	}
+	rec := httptest.NewRecorder()
+	code, err := i.ServeHTTP(rec, httptest.NewRequest("GET", "/404", nil))
+	if code != http.StatusInternalServerError || err == nil {
+		t.Errorf("Expected status 500 and an error, got %d and %v", code, err)
+	}
+	if rec.Body.String() != "" {
+		t.Errorf("Expected nothing from outside the root, got %q", rec.Body.String())
+	}
+}
+
+func interceptTestHandlerFunc(w http.ResponseWriter, r *http.Request) (int, error) {
+	var status int
+	if _, err := fmt.Sscanf(filepath.Base(r.URL.Path), "%d", &status); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if filepath.Base(filepath.Dir(r.URL.Path)) == "returned" {
+		return status, nil
+	}
+	w.Header().Set("X-Backend", "yes")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "backend %d", status)
+	return 0, nil
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import "expvar"
+
+// LimitHits counts, by limiter name, how many times a request
+// was turned away because a resource limit had been reached.
+// It is published with the expvar package as "limit_hits".
+var LimitHits = expvar.NewMap("limit_hits")
+
+// Limiter caps how many of a resource may be in use at once.
+// A nil *Limiter has no limit.
+type Limiter struct {
+	name  string
+	slots chan struct{}
+}
+
+// NewLimiter returns a Limiter that allows max of a resource to be
+// in use at once. The name identifies the limit in LimitHits, for
+// example "example.com:80 fastcgi".
+func NewLimiter(name string, max int) *Limiter {
+	return &Limiter{name: name, slots: make(chan struct{}, max)}
+}
+
+// Acquire takes one of the resource if the limit hasn't been
+// reached and returns true. Otherwise, it records a hit on the
+// limit and returns false without waiting. Every successful
+// call to Acquire must be followed by a call to Release.
+func (l *Limiter) Acquire() bool {
+	if l == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		LimitHits.Add(l.name, 1)
+		return false
+	}
+}
+
+// Release gives back one of the resource taken by Acquire.
+func (l *Limiter) Release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import "testing"
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter("test", 2)
+
+	if !l.Acquire() || !l.Acquire() {
+		t.Fatal("Expected to acquire up to the limit")
+	}
+	if l.Acquire() {
+		t.Error("Expected not to acquire past the limit")
+	}
+	if hits := LimitHits.Get("test").String(); hits != "1" {
+		t.Errorf("Expected 1 limit hit, got %s", hits)
+	}
+
+	l.Release()
+	if !l.Acquire() {
+		t.Error("Expected to acquire after a release")
+	}
+
+	var unlimited *Limiter
+	for i := 0; i < 10; i++ {
+		if !unlimited.Acquire() {
+			t.Fatal("Expected nil limiter to have no limit")
+		}
+	}
+	unlimited.Release()
+}
@@ -0,0 +1,25 @@
+package log
+
+import (
+	"net/http"
+
+	"github.com/mholt/caddy/admin"
+)
+
+func init() {
+	// POST /logs/reopen reopens the log files, after they
+	// were rotated, like the SIGHUP signal does
+	admin.HandleFunc("/logs/reopen", serveReopen)
+}
+
+func serveReopen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		admin.Error(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	if err := Reopen(); err != nil {
+		admin.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
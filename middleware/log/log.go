@@ -2,11 +2,15 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/logtail"
 )
 
 // Logger is a basic request logging middleware.
@@ -14,14 +18,21 @@ type Logger struct {
 	Next      middleware.Handler
 	Rules     []Rule
 	ErrorFunc func(http.ResponseWriter, *http.Request, int) // failover error handler
+	Site      string                                        // whose entries these are (see logtail)
 }
 
 func (l Logger) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 	for _, rule := range l.Rules {
 		if middleware.Path(r.URL.Path).Matches(rule.PathScope) {
+			start := time.Now()
 			responseRecorder := middleware.NewResponseRecorder(w)
 			status, err := l.Next.ServeHTTP(responseRecorder, r)
-			if status >= 400 {
+			if status == middleware.StatusClientClosedRequest {
+				// The client is gone, so there is nothing to send,
+				// but the entry should show that it went away
+				responseRecorder.Unsent(status)
+				status = 0
+			} else if status >= 400 {
 				// There was an error up the chain, but no response has been written yet.
 				// The error must be handled here so the log entry will record the response size.
 				if l.ErrorFunc != nil {
@@ -34,18 +45,75 @@ func (l Logger) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 				status = 0
 			}
 			rep := middleware.NewReplacer(r, responseRecorder, CommonLogEmptyValue)
-			rule.Log.Println(rep.Replace(rule.Format))
+			var line string
+			if rule.JSON {
+				line = jsonEntry(r, responseRecorder.Status(), responseRecorder.Size(), start)
+			} else {
+				line = rep.Replace(rule.Format)
+			}
+			rule.Log.Println(line)
+			logtail.Record(logtail.Entry{
+				Time:   time.Now(),
+				Site:   l.Site,
+				Kind:   "access",
+				Remote: rep.Replace("{remote}"),
+				Method: r.Method,
+				Path:   r.URL.Path,
+				Status: responseRecorder.Status(),
+				Line:   line,
+			})
 			return status, err
 		}
 	}
 	return l.Next.ServeHTTP(w, r)
 }
 
+// Entry is an access log entry in JSON format.
+type Entry struct {
+	Time      time.Time `json:"ts"`
+	RemoteIP  string    `json:"remote_ip"`
+	Method    string    `json:"method"`
+	Host      string    `json:"host"`
+	Path      string    `json:"path"`
+	Query     string    `json:"query,omitempty"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     int       `json:"bytes"`
+	Latency   float64   `json:"latency"` // in seconds
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// jsonEntry returns the JSON log entry for r, whose response
+// had status and size bytes of body, and which started at start.
+func jsonEntry(r *http.Request, status, size int, start time.Time) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	entry, _ := json.Marshal(Entry{
+		Time:      start.UTC(),
+		RemoteIP:  ip,
+		Method:    r.Method,
+		Host:      r.Host,
+		Path:      r.URL.Path,
+		Query:     r.URL.RawQuery,
+		Proto:     r.Proto,
+		Status:    status,
+		Bytes:     size,
+		Latency:   time.Since(start).Seconds(),
+		Referer:   r.Referer(),
+		UserAgent: r.UserAgent(),
+	})
+	return string(entry)
+}
+
 // Rule configures the logging middleware.
 type Rule struct {
 	PathScope  string
 	OutputFile string
 	Format     string
+	JSON       bool // whether entries are JSON objects instead of lines in Format
 	Log        *log.Logger
 }
 
@@ -2,11 +2,15 @@ package log
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/mholt/caddy/middleware"
 )
 
 type erroringMiddleware struct{}
@@ -46,3 +50,119 @@ func TestLoggedStatus(t *testing.T) {
 		t.Error("Expected 404 to be logged. Logged string -", logged)
 	}
 }
+
+func TestLoggedClientClosedRequest(t *testing.T) {
+	var f bytes.Buffer
+	logger := Logger{
+		Rules: []Rule{{PathScope: "/", Format: DefaultLogFormat, Log: log.New(&f, "", 0)}},
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return middleware.StatusClientClosedRequest, nil
+		}),
+	}
+
+	rec := httptest.NewRecorder()
+	status, _ := logger.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if status != 0 {
+		t.Errorf("Expected status 0, got %d", status)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("Expected no response to be written, got %q", rec.Body.String())
+	}
+	if logged := f.String(); !strings.Contains(logged, "499 0") {
+		t.Errorf("Expected 499 to be logged, got %q", logged)
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	var f bytes.Buffer
+	logger := Logger{
+		Rules: []Rule{{PathScope: "/", JSON: true, Log: log.New(&f, "", 0)}},
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("hello"))
+			return 0, nil
+		}),
+	}
+
+	r := httptest.NewRequest("POST", "/items?id=1", nil)
+	r.RemoteAddr = "10.0.0.1:4321"
+	r.Header.Set("User-Agent", "tester/1.0")
+	logger.ServeHTTP(httptest.NewRecorder(), r)
+
+	var entry Entry
+	if err := json.Unmarshal(f.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected one JSON object to be logged, got %q: %v", f.String(), err)
+	}
+	if !strings.HasSuffix(f.String(), "}\n") {
+		t.Errorf("Expected the entry to end its line, got %q", f.String())
+	}
+	if entry.Method != "POST" || entry.Path != "/items" || entry.Query != "id=1" {
+		t.Errorf("Expected POST /items?id=1, got %s %s?%s", entry.Method, entry.Path, entry.Query)
+	}
+	if entry.Status != http.StatusCreated || entry.Bytes != 5 {
+		t.Errorf("Expected status 201 with 5 bytes, got %d with %d", entry.Status, entry.Bytes)
+	}
+	if entry.RemoteIP != "10.0.0.1" || entry.UserAgent != "tester/1.0" {
+		t.Errorf("Expected remote IP 10.0.0.1 and user agent tester/1.0, got %s and %s", entry.RemoteIP, entry.UserAgent)
+	}
+	if entry.Time.IsZero() || entry.Latency < 0 {
+		t.Errorf("Expected a time and latency, got %v and %v", entry.Time, entry.Latency)
+	}
+}
+
+type fakeOutput struct {
+	reopened int
+	err      error
+}
+
+func (o *fakeOutput) Reopen() error {
+	o.reopened++
+	return o.err
+}
+
+func TestReopen(t *testing.T) {
+	a, b := &fakeOutput{}, &fakeOutput{err: errors.New("gone")}
+	RegisterOutput(a)
+	RegisterOutput(b)
+
+	if err := Reopen(); err == nil {
+		t.Error("Expected the error reopening an output")
+	}
+	if a.reopened != 1 || b.reopened != 1 {
+		t.Errorf("Expected both outputs reopened once, got %d and %d", a.reopened, b.reopened)
+	}
+
+	UnregisterOutput(b)
+	if err := Reopen(); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+	if b.reopened != 1 {
+		t.Errorf("Expected an unregistered output not to be reopened, got %d", b.reopened)
+	}
+	UnregisterOutput(a)
+}
+
+func TestServeReopen(t *testing.T) {
+	out := &fakeOutput{}
+	RegisterOutput(out)
+	defer UnregisterOutput(out)
+
+	rec := httptest.NewRecorder()
+	serveReopen(rec, httptest.NewRequest("GET", "/logs/reopen", nil))
+	if rec.Code != http.StatusMethodNotAllowed || out.reopened != 0 {
+		t.Errorf("Expected GET to be refused, got %d and %d reopens", rec.Code, out.reopened)
+	}
+
+	rec = httptest.NewRecorder()
+	serveReopen(rec, httptest.NewRequest("POST", "/logs/reopen", nil))
+	if rec.Code != http.StatusNoContent || out.reopened != 1 {
+		t.Errorf("Expected 204 and one reopen, got %d and %d reopens", rec.Code, out.reopened)
+	}
+
+	out.err = errors.New("disk full")
+	rec = httptest.NewRecorder()
+	serveReopen(rec, httptest.NewRequest("POST", "/logs/reopen", nil))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "disk full") {
+		t.Errorf("Expected 500 with the error, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
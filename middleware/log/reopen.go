@@ -0,0 +1,49 @@
+package log
+
+import "sync"
+
+// Reopener is a log output that can be closed and opened again,
+// such as a file that was moved away so that it can be rotated.
+type Reopener interface {
+	Reopen() error
+}
+
+var outputs = struct {
+	sync.Mutex
+	list []Reopener
+}{}
+
+// RegisterOutput adds out to the outputs that Reopen reopens.
+func RegisterOutput(out Reopener) {
+	outputs.Lock()
+	defer outputs.Unlock()
+	outputs.list = append(outputs.list, out)
+}
+
+// UnregisterOutput removes out from the outputs that Reopen
+// reopens, as when the server using it shuts down.
+func UnregisterOutput(out Reopener) {
+	outputs.Lock()
+	defer outputs.Unlock()
+	for i, o := range outputs.list {
+		if o == out {
+			outputs.list = append(outputs.list[:i], outputs.list[i+1:]...)
+			return
+		}
+	}
+}
+
+// Reopen reopens all registered log outputs, so that log rotation
+// can move them away and have new ones made in their place. All
+// are reopened even if some fail; the first error is returned.
+func Reopen() error {
+	outputs.Lock()
+	defer outputs.Unlock()
+	var first error
+	for _, out := range outputs.list {
+		if err := out.Reopen(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
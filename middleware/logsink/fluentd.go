@@ -0,0 +1,84 @@
+package logsink
+
+import (
+	"net/url"
+	"strings"
+)
+
+// fluentd sends entries to Fluentd with the forward protocol.
+// Each batch is one message in Forward mode, whose records have
+// the entry in their "message" field.
+type fluentd struct {
+	tag  string
+	conn *streamConn
+}
+
+func newFluentd(u *url.URL) (transport, error) {
+	tag := strings.Trim(u.Path, "/")
+	if tag == "" {
+		tag = "caddy"
+	}
+	return &fluentd{tag: tag, conn: &streamConn{network: "tcp", address: u.Host}}, nil
+}
+
+func (f *fluentd) send(batch []entry) error {
+	// [tag, [[time, {"message": line}], ...]]
+	var buf msgpackBuffer
+	buf.arrayHeader(2)
+	buf.str(f.tag)
+	buf.arrayHeader(len(batch))
+	for _, e := range batch {
+		buf.arrayHeader(2)
+		buf.uint(uint64(e.at.Unix()))
+		buf.mapHeader(1)
+		buf.str("message")
+		buf.str(string(e.line))
+	}
+	return f.conn.write(buf)
+}
+
+func (f *fluentd) close() error {
+	return f.conn.close()
+}
+
+// msgpackBuffer encodes the few MessagePack types the
+// forward protocol needs.
+type msgpackBuffer []byte
+
+func (b *msgpackBuffer) header(fix, max byte, n int) {
+	switch {
+	case n < 16:
+		*b = append(*b, fix|byte(n))
+	case n < 1<<16:
+		*b = append(*b, max, byte(n>>8), byte(n))
+	default:
+		*b = append(*b, max+1, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func (b *msgpackBuffer) arrayHeader(n int) { b.header(0x90, 0xdc, n) }
+
+func (b *msgpackBuffer) mapHeader(n int) { b.header(0x80, 0xde, n) }
+
+func (b *msgpackBuffer) str(s string) {
+	switch n := len(s); {
+	case n < 32:
+		*b = append(*b, 0xa0|byte(n))
+	case n < 1<<8:
+		*b = append(*b, 0xd9, byte(n))
+	case n < 1<<16:
+		*b = append(*b, 0xda, byte(n>>8), byte(n))
+	default:
+		*b = append(*b, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	*b = append(*b, s...)
+}
+
+func (b *msgpackBuffer) uint(v uint64) {
+	if v < 1<<32 {
+		*b = append(*b, 0xce, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+		return
+	}
+	*b = append(*b, 0xcf, byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+		byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
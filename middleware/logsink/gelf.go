@@ -0,0 +1,131 @@
+package logsink
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+)
+
+// gelf sends entries to Graylog, as GELF messages.
+type gelf struct {
+	source string // the host the messages are from
+	udp    net.Conn
+	tcp    *streamConn
+}
+
+func newGELF(u *url.URL) (transport, error) {
+	g := &gelf{source: u.Query().Get("source")}
+	if g.source == "" {
+		g.source, _ = os.Hostname()
+	}
+	if u.Scheme == "gelf+tcp" {
+		g.tcp = &streamConn{network: "tcp", address: u.Host}
+		return g, nil
+	}
+	addr := u.Host
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	g.udp = conn
+	return g, nil
+}
+
+// gelfMessage is a GELF 1.1 message.
+type gelfMessage struct {
+	Version      string  `json:"version"`
+	Host         string  `json:"host"`
+	ShortMessage string  `json:"short_message"`
+	Timestamp    float64 `json:"timestamp"`
+	Level        int     `json:"level"`
+}
+
+func (g *gelf) message(e entry) ([]byte, error) {
+	return json.Marshal(gelfMessage{
+		Version:      "1.1",
+		Host:         g.source,
+		ShortMessage: string(e.line),
+		Timestamp:    float64(e.at.UnixNano()) / 1e9,
+		Level:        6, // informational
+	})
+}
+
+func (g *gelf) send(batch []entry) error {
+	if g.tcp != nil {
+		// over TCP, messages are separated by null bytes
+		var buf bytes.Buffer
+		for _, e := range batch {
+			msg, err := g.message(e)
+			if err != nil {
+				return err
+			}
+			buf.Write(msg)
+			buf.WriteByte(0)
+		}
+		return g.tcp.write(buf.Bytes())
+	}
+
+	for _, e := range batch {
+		msg, err := g.message(e)
+		if err != nil {
+			return err
+		}
+		if err := g.sendUDP(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GELF messages too big for a datagram are sent in chunks.
+const (
+	gelfDatagram   = 8192
+	gelfChunkData  = gelfDatagram - 12
+	gelfMaxChunks  = 128
+	gelfChunkMagic = "\x1e\x0f"
+)
+
+var errGELFTooBig = errors.New("GELF message too big to send over UDP")
+
+// sendUDP sends msg in one datagram if it fits, or in chunks.
+func (g *gelf) sendUDP(msg []byte) error {
+	if len(msg) <= gelfDatagram {
+		_, err := g.udp.Write(msg)
+		return err
+	}
+
+	count := (len(msg) + gelfChunkData - 1) / gelfChunkData
+	if count > gelfMaxChunks {
+		return errGELFTooBig
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	chunk := make([]byte, 0, gelfDatagram)
+	for i := 0; i < count; i++ {
+		data := msg[i*gelfChunkData:]
+		if len(data) > gelfChunkData {
+			data = data[:gelfChunkData]
+		}
+		chunk = append(chunk[:0], gelfChunkMagic...)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, data...)
+		if _, err := g.udp.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *gelf) close() error {
+	if g.tcp != nil {
+		return g.tcp.close()
+	}
+	return g.udp.Close()
+}
@@ -0,0 +1,39 @@
+package logsink
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// httpBulk POSTs each batch to a URL, one entry per line.
+type httpBulk struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPBulk(u *url.URL) (transport, error) {
+	return &httpBulk{url: u.String(), client: &http.Client{Timeout: connTimeout}}, nil
+}
+
+func (h *httpBulk) send(batch []entry) error {
+	var body bytes.Buffer
+	for _, e := range batch {
+		body.Write(e.line)
+		body.WriteByte('\n')
+	}
+	resp, err := h.client.Post(h.url, "text/plain; charset=utf-8", &body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded %s", h.url, resp.Status)
+	}
+	return nil
+}
+
+func (h *httpBulk) close() error {
+	return nil
+}
@@ -0,0 +1,275 @@
+// Package logsink sends log entries to external collectors: Graylog
+// (GELF over UDP or TCP), Fluentd (the forward protocol), or any HTTP
+// endpoint that accepts entries in bulk. A sink is an io.WriteCloser
+// that takes one entry per Write, which is how log.Logger writes, so
+// the log middleware can use it in place of a file.
+//
+// Entries are queued and sent in batches by a goroutine, so a slow
+// collector doesn't hold up requests. When the queue is full, Write
+// waits for room for a short while, and then drops the entry.
+package logsink
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dropped counts, by target, the log entries that were dropped
+// because the collector couldn't keep up or couldn't be reached.
+// It is published with the expvar package as "log_dropped".
+var Dropped = expvar.NewMap("log_dropped")
+
+// Defaults for the options in a target's query string.
+const (
+	DefaultBatch = 100                    // batch: entries sent at once
+	DefaultFlush = time.Second            // flush: longest an entry waits to be sent
+	DefaultQueue = 10000                  // queue: entries waiting to be sent
+	DefaultWait  = 100 * time.Millisecond // wait: how long Write waits when the queue is full
+)
+
+// IsTarget returns true if output names a collector rather than a file.
+func IsTarget(output string) bool {
+	i := strings.Index(output, "://")
+	if i <= 0 {
+		return false
+	}
+	_, ok := transports[output[:i]]
+	return ok
+}
+
+// Open returns a sink that sends entries to target, a URL like:
+//
+//	gelf://graylog.local:12201            GELF over UDP
+//	gelf+tcp://graylog.local:12201        GELF over TCP
+//	fluentd://fluentd.local:24224/tag     Fluentd forward protocol
+//	https://logs.example.com/bulk         newline-separated entries in a POST
+//
+// The query string may set the batch size, flush interval, queue
+// length and wait, like ?batch=500&flush=5s; for HTTP targets, these
+// are removed from the URL that is POSTed to.
+func Open(target string) (io.WriteCloser, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	newTransport, ok := transports[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unknown log target scheme '%s'", u.Scheme)
+	}
+
+	s := &sink{
+		name:  u.Scheme + "://" + u.Host + u.Path,
+		batch: DefaultBatch,
+		flush: DefaultFlush,
+		wait:  DefaultWait,
+		done:  make(chan struct{}),
+	}
+	queue := DefaultQueue
+
+	query := u.Query()
+	for key, values := range query {
+		val := values[0]
+		switch key {
+		case "batch", "queue":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid %s '%s' for log target %s", key, val, s.name)
+			}
+			if key == "batch" {
+				s.batch = n
+			} else {
+				queue = n
+			}
+		case "flush", "wait":
+			// flush is the interval of a ticker, so it must be above 0
+			dur, err := time.ParseDuration(val)
+			if err != nil || dur < 0 || key == "flush" && dur == 0 {
+				return nil, fmt.Errorf("invalid %s '%s' for log target %s", key, val, s.name)
+			}
+			if key == "flush" {
+				s.flush = dur
+			} else {
+				s.wait = dur
+			}
+		default:
+			continue
+		}
+		query.Del(key)
+	}
+	u.RawQuery = query.Encode()
+
+	s.transport, err = newTransport(u)
+	if err != nil {
+		return nil, err
+	}
+	s.queue = make(chan entry, queue)
+	go s.run()
+	return s, nil
+}
+
+// entry is a log entry and when it was written.
+type entry struct {
+	line []byte // without the trailing newline
+	at   time.Time
+}
+
+// transport sends batches of entries to a collector.
+type transport interface {
+	send(batch []entry) error
+	close() error
+}
+
+var transports = map[string]func(*url.URL) (transport, error){
+	"gelf":     newGELF,
+	"gelf+udp": newGELF,
+	"gelf+tcp": newGELF,
+	"fluentd":  newFluentd,
+	"http":     newHTTPBulk,
+	"https":    newHTTPBulk,
+}
+
+// sink queues entries for its transport.
+type sink struct {
+	name      string
+	transport transport
+	batch     int
+	flush     time.Duration
+	wait      time.Duration
+
+	queue     chan entry
+	closeOnce sync.Once
+	mu        sync.RWMutex // held for writing while closing
+	closed    bool
+	done      chan struct{}
+}
+
+var errClosed = errors.New("log sink closed")
+
+// Write queues a copy of p, an entry, to be sent.
+func (s *sink) Write(p []byte) (int, error) {
+	line := p
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+	e := entry{line: append([]byte(nil), line...), at: time.Now()}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return 0, errClosed
+	}
+	select {
+	case s.queue <- e:
+		return len(p), nil
+	default:
+	}
+
+	// the collector is falling behind; slow down a little
+	timer := time.NewTimer(s.wait)
+	defer timer.Stop()
+	select {
+	case s.queue <- e:
+	case <-timer.C:
+		Dropped.Add(s.name, 1)
+	}
+	return len(p), nil
+}
+
+// Close sends the entries still queued and closes the transport.
+func (s *sink) Close() error {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		close(s.queue)
+		s.mu.Unlock()
+	})
+	<-s.done
+	return nil
+}
+
+// run sends the queued entries in batches, until the queue is closed.
+func (s *sink) run() {
+	defer close(s.done)
+	defer s.transport.close()
+
+	ticker := time.NewTicker(s.flush)
+	defer ticker.Stop()
+
+	batch := make([]entry, 0, s.batch)
+	for {
+		select {
+		case e, ok := <-s.queue:
+			if !ok {
+				s.send(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) < s.batch {
+				continue
+			}
+		case <-ticker.C:
+		}
+		s.send(batch)
+		batch = batch[:0]
+	}
+}
+
+// send sends batch, trying again a couple of times if that fails.
+// If the collector can't be reached, the entries are dropped.
+func (s *sink) send(batch []entry) {
+	if len(batch) == 0 {
+		return
+	}
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 250 * time.Millisecond)
+		}
+		if s.transport.send(batch) == nil {
+			return
+		}
+	}
+	Dropped.Add(s.name, int64(len(batch)))
+}
+
+// streamConn is a connection to a collector that is
+// dialed when needed, and dialed again after an error.
+type streamConn struct {
+	network, address string
+	conn             net.Conn
+}
+
+// write writes p to the connection.
+func (c *streamConn) write(p []byte) error {
+	if c.conn == nil {
+		conn, err := net.DialTimeout(c.network, c.address, connTimeout)
+		if err != nil {
+			return err
+		}
+		c.conn = conn
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(connTimeout))
+	if _, err := c.conn.Write(p); err != nil {
+		c.close()
+		return err
+	}
+	return nil
+}
+
+func (c *streamConn) close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+const connTimeout = 10 * time.Second
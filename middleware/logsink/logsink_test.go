@@ -0,0 +1,189 @@
+package logsink
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsTarget(t *testing.T) {
+	for i, test := range []struct {
+		output   string
+		expected bool
+	}{
+		{"access.log", false},
+		{"/var/log/caddy/access.log", false},
+		{"stdout", false},
+		{"gelf://graylog:12201", true},
+		{"gelf+tcp://graylog:12201", true},
+		{"fluentd://localhost:24224/caddy.access", true},
+		{"https://logs.example.com/bulk", true},
+		{"ftp://example.com/log", false},
+	} {
+		if actual := IsTarget(test.output); actual != test.expected {
+			t.Errorf("Test %d: Expected IsTarget(%s) to be %v, got %v", i, test.output, test.expected, actual)
+		}
+	}
+}
+
+func TestHTTPBulk(t *testing.T) {
+	bodies := make(chan string, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "index=web" {
+			t.Errorf("Expected sink options to be removed from the query, got '%s'", r.URL.RawQuery)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer collector.Close()
+
+	sink, err := Open(collector.URL + "/bulk?index=web&batch=2&flush=1h")
+	if err != nil {
+		t.Fatalf("Expected no error opening sink, got: %v", err)
+	}
+	sink.Write([]byte("one\n"))
+	sink.Write([]byte("two\n"))
+	sink.Write([]byte("three\n"))
+	sink.Close()
+
+	if body := <-bodies; body != "one\ntwo\n" {
+		t.Errorf("Expected a full batch first, got %q", body)
+	}
+	if body := <-bodies; body != "three\n" {
+		t.Errorf("Expected the rest to be sent on close, got %q", body)
+	}
+	if _, err := sink.Write([]byte("four\n")); err == nil {
+		t.Error("Expected an error writing to a closed sink")
+	}
+}
+
+func TestGELFUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer conn.Close()
+
+	sink, err := Open("gelf://" + conn.LocalAddr().String() + "?source=web1&flush=10ms")
+	if err != nil {
+		t.Fatalf("Expected no error opening sink, got: %v", err)
+	}
+	defer sink.Close()
+
+	sink.Write([]byte("GET / 200\n"))
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Expected a datagram, got error: %v", err)
+	}
+	var msg gelfMessage
+	if err := json.Unmarshal(buf[:n], &msg); err != nil {
+		t.Fatalf("Expected a JSON message, got error: %v", err)
+	}
+	if msg.Version != "1.1" || msg.Host != "web1" || msg.ShortMessage != "GET / 200" || msg.Timestamp == 0 {
+		t.Errorf("Expected a GELF 1.1 message from web1, got %+v", msg)
+	}
+
+	// big messages are chunked
+	sink.Write([]byte(strings.Repeat("x", 20000)))
+	var chunks int
+	for chunks < 3 {
+		n, _, err = conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Expected chunk %d, got error: %v", chunks, err)
+		}
+		if n > gelfDatagram || string(buf[:2]) != gelfChunkMagic || buf[10] != byte(chunks) || buf[11] != 3 {
+			t.Fatalf("Expected chunk %d of 3, got % x", chunks, buf[:12])
+		}
+		chunks++
+	}
+}
+
+func TestFluentd(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 1024)
+		n, _ := bufio.NewReader(conn).Read(buf)
+		received <- buf[:n]
+	}()
+
+	sink, err := Open("fluentd://" + ln.Addr().String() + "/web.access?flush=10ms")
+	if err != nil {
+		t.Fatalf("Expected no error opening sink, got: %v", err)
+	}
+	defer sink.Close()
+	sink.Write([]byte("hello\n"))
+
+	var msg []byte
+	select {
+	case msg = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a message")
+	}
+	// [ "web.access", [ [ time, { "message": "hello" } ] ] ]
+	expected := "\x92\xaaweb.access\x91\x92\xce"
+	if !strings.HasPrefix(string(msg), expected) {
+		t.Errorf("Expected message to start with % x, got % x", expected, msg)
+	}
+	if !strings.HasSuffix(string(msg), "\x81\xa7message\xa5hello") {
+		t.Errorf("Expected record with the entry, got % x", msg)
+	}
+}
+
+func TestDropped(t *testing.T) {
+	// nothing listens here, so entries can't be sent
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	target := "gelf+tcp://" + addr + "?queue=1&batch=1&wait=1ms"
+	sink, err := Open(target)
+	if err != nil {
+		t.Fatalf("Expected no error opening sink, got: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := sink.Write([]byte("entry\n")); err != nil {
+			t.Errorf("Expected writes not to fail, got: %v", err)
+		}
+	}
+	sink.Close()
+
+	if n := Dropped.Get("gelf+tcp://" + addr); n == nil || n.String() != "5" {
+		t.Errorf("Expected 5 entries to be dropped, got %v", n)
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	for i, target := range []string{
+		"gelf://graylog:12201?flush=0",
+		"gelf://graylog:12201?flush=-1s",
+		"gelf://graylog:12201?wait=-1s",
+		"gelf://graylog:12201?batch=0",
+		"ftp://example.com/log",
+	} {
+		if s, err := Open(target); err == nil {
+			s.Close()
+			t.Errorf("Test %d: Expected an error for %s, got none", i, target)
+		}
+	}
+}
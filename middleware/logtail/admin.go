@@ -0,0 +1,78 @@
+package logtail
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/mholt/caddy/admin"
+)
+
+func init() {
+	admin.HandleFunc("/logs", serveLogs)
+}
+
+// DefaultLimit is how many entries /logs returns
+// if the request doesn't say.
+const DefaultLimit = 100
+
+func serveLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		admin.Error(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	query := r.URL.Query()
+	filter, err := ParseFilter(query)
+	if err != nil {
+		admin.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := DefaultLimit
+	if l := query.Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			admin.Error(w, http.StatusBadRequest, "invalid limit '"+l+"'")
+			return
+		}
+	}
+
+	if query.Get("follow") == "" {
+		entries := Recent(filter, limit)
+		if entries == nil {
+			entries = []Entry{}
+		}
+		admin.WriteJSON(w, http.StatusOK, entries)
+		return
+	}
+
+	// Stream the recent entries, then new ones as they come,
+	// one JSON object per line, until the client goes away
+	ch := subscribe()
+	defer unsubscribe(ch)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	for _, e := range Recent(filter, limit) {
+		enc.Encode(e)
+	}
+	flush(w)
+	for {
+		select {
+		case e := <-ch:
+			if !filter.Match(e) {
+				continue
+			}
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+			flush(w)
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
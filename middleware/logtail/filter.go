@@ -0,0 +1,75 @@
+package logtail
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Filter selects log entries. Its zero value matches all of them.
+type Filter struct {
+	Site string
+	Kind string
+	Path string // a path scope
+	IP   string
+
+	// A status code, or the first digit of a class of
+	// them (like 5 for 5xx); 0 matches any status
+	Status      int
+	StatusClass bool
+}
+
+// ParseFilter reads a filter from query parameters.
+func ParseFilter(query url.Values) (Filter, error) {
+	f := Filter{
+		Site: query.Get("site"),
+		Kind: query.Get("kind"),
+		Path: query.Get("path"),
+		IP:   query.Get("ip"),
+	}
+	if f.Kind != "" && f.Kind != "access" && f.Kind != "error" {
+		return f, fmt.Errorf("unknown kind '%s'; expected access or error", f.Kind)
+	}
+	if status := query.Get("status"); status != "" {
+		if len(status) == 3 && strings.HasSuffix(strings.ToLower(status), "xx") {
+			f.StatusClass = true
+			status = status[:1]
+		}
+		n, err := strconv.Atoi(status)
+		if err != nil || n < 1 {
+			return f, fmt.Errorf("invalid status '%s'", query.Get("status"))
+		}
+		f.Status = n
+	}
+	return f, nil
+}
+
+// Match returns true if f selects e.
+func (f Filter) Match(e Entry) bool {
+	if f.Site != "" && e.Site != f.Site {
+		return false
+	}
+	if f.Kind != "" && e.Kind != f.Kind {
+		return false
+	}
+	if f.Path != "" && !middleware.Path(e.Path).Matches(f.Path) {
+		return false
+	}
+	if f.IP != "" && e.Remote != f.IP {
+		return false
+	}
+	if f.StatusClass {
+		return e.Status/100 == f.Status
+	}
+	return f.Status == 0 || e.Status == f.Status
+}
+
+func sortByTime(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+}
@@ -0,0 +1,127 @@
+// Package logtail keeps the most recent access and error log entries
+// of each site in memory, and serves them on the admin API, so live
+// traffic can be looked into without access to the log files.
+//
+// GET /logs returns recent entries as a JSON array, oldest first. It
+// takes these query parameters, all optional:
+//
+//	site    only entries for this site, like example.com:80
+//	kind    access or error
+//	status  a status code, or a class like 5xx
+//	path    only requests under this path
+//	ip      only requests from this client IP
+//	limit   return at most this many of the newest entries (default 100)
+//	follow  if set, keep streaming new entries as lines of JSON
+package logtail
+
+import (
+	"sync"
+	"time"
+)
+
+// Entry is a log entry.
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Site   string    `json:"site"`
+	Kind   string    `json:"kind"` // "access" or "error"
+	Remote string    `json:"remote"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Status int       `json:"status"`
+	Line   string    `json:"line"` // as written to the log
+}
+
+// Size is how many entries are kept for each site.
+const Size = 1000
+
+// ring holds the last Size entries of a site.
+type ring struct {
+	entries [Size]Entry
+	next    int // where the next entry goes
+	full    bool
+}
+
+func (r *ring) add(e Entry) {
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % Size
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// each calls f for each entry, oldest first.
+func (r *ring) each(f func(Entry)) {
+	if r.full {
+		for _, e := range r.entries[r.next:] {
+			f(e)
+		}
+	}
+	for _, e := range r.entries[:r.next] {
+		f(e)
+	}
+}
+
+var (
+	mu          sync.Mutex
+	rings       = make(map[string]*ring)
+	subscribers = make(map[chan Entry]struct{})
+)
+
+// Record keeps e as one of the recent entries of its site,
+// and passes it on to those following the logs.
+func Record(e Entry) {
+	mu.Lock()
+	defer mu.Unlock()
+	r := rings[e.Site]
+	if r == nil {
+		r = new(ring)
+		rings[e.Site] = r
+	}
+	r.add(e)
+
+	for ch := range subscribers {
+		select {
+		case ch <- e:
+		default: // too slow to keep up; it misses this one
+		}
+	}
+}
+
+// Recent returns up to limit of the newest entries that f matches,
+// oldest first.
+func Recent(f Filter, limit int) []Entry {
+	mu.Lock()
+	defer mu.Unlock()
+	var matched []Entry
+	for site, r := range rings {
+		if f.Site != "" && site != f.Site {
+			continue
+		}
+		r.each(func(e Entry) {
+			if f.Match(e) {
+				matched = append(matched, e)
+			}
+		})
+	}
+	sortByTime(matched)
+	if len(matched) > limit {
+		matched = matched[len(matched)-limit:]
+	}
+	return matched
+}
+
+// subscribe returns a channel that gets each entry recorded from now
+// on, until it is unsubscribed.
+func subscribe() chan Entry {
+	ch := make(chan Entry, 100)
+	mu.Lock()
+	subscribers[ch] = struct{}{}
+	mu.Unlock()
+	return ch
+}
+
+func unsubscribe(ch chan Entry) {
+	mu.Lock()
+	delete(subscribers, ch)
+	mu.Unlock()
+}
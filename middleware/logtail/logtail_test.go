@@ -0,0 +1,147 @@
+package logtail
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// reset forgets all recorded entries.
+func reset() {
+	mu.Lock()
+	rings = make(map[string]*ring)
+	mu.Unlock()
+}
+
+func TestRecent(t *testing.T) {
+	reset()
+	start := time.Now()
+	for i, e := range []Entry{
+		{Site: "a.com:80", Kind: "access", Remote: "10.0.0.1", Path: "/", Status: 200},
+		{Site: "b.com:80", Kind: "access", Remote: "10.0.0.2", Path: "/api/users", Status: 502},
+		{Site: "a.com:80", Kind: "error", Remote: "10.0.0.1", Path: "/api/users", Status: 500},
+		{Site: "a.com:80", Kind: "access", Remote: "10.0.0.3", Path: "/missing", Status: 404},
+	} {
+		e.Time = start.Add(time.Duration(i) * time.Second)
+		e.Line = strconv.Itoa(i)
+		Record(e)
+	}
+
+	for i, test := range []struct {
+		filter   Filter
+		limit    int
+		expected string
+	}{
+		{Filter{}, 10, "0123"},
+		{Filter{}, 2, "23"},
+		{Filter{Site: "a.com:80"}, 10, "023"},
+		{Filter{Kind: "access"}, 10, "013"},
+		{Filter{Status: 5, StatusClass: true}, 10, "12"},
+		{Filter{Status: 404}, 10, "3"},
+		{Filter{Path: "/api"}, 10, "12"},
+		{Filter{IP: "10.0.0.1"}, 10, "02"},
+		{Filter{IP: "10.0.0.1", Kind: "access"}, 10, "0"},
+	} {
+		var actual string
+		for _, e := range Recent(test.filter, test.limit) {
+			actual += e.Line
+		}
+		if actual != test.expected {
+			t.Errorf("Test %d: Expected entries %s, got %s", i, test.expected, actual)
+		}
+	}
+}
+
+func TestRing(t *testing.T) {
+	reset()
+	for i := 0; i < Size+5; i++ {
+		Record(Entry{Site: "a.com:80", Line: strconv.Itoa(i)})
+	}
+	entries := Recent(Filter{}, Size*2)
+	if len(entries) != Size {
+		t.Fatalf("Expected %d entries to be kept, got %d", Size, len(entries))
+	}
+	if entries[0].Line != "5" || entries[Size-1].Line != strconv.Itoa(Size+4) {
+		t.Errorf("Expected entries 5 to %d, got %s to %s", Size+4, entries[0].Line, entries[Size-1].Line)
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	for i, test := range []struct {
+		query     string
+		shouldErr bool
+		expected  Filter
+	}{
+		{"", false, Filter{}},
+		{"status=5xx&kind=error", false, Filter{Kind: "error", Status: 5, StatusClass: true}},
+		{"status=404&path=/img&ip=1.2.3.4&site=a.com:80", false, Filter{Site: "a.com:80", Path: "/img", IP: "1.2.3.4", Status: 404}},
+		{"status=bad", true, Filter{}},
+		{"kind=debug", true, Filter{}},
+	} {
+		req, _ := http.NewRequest("GET", "/logs?"+test.query, nil)
+		actual, err := ParseFilter(req.URL.Query())
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if !test.shouldErr && actual != test.expected {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestServeLogs(t *testing.T) {
+	reset()
+	Record(Entry{Time: time.Now(), Site: "a.com:80", Kind: "access", Status: 200, Line: "old"})
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/logs?status=200", nil)
+	serveLogs(rec, req)
+	var entries []Entry
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatalf("Expected a JSON array, got error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Line != "old" {
+		t.Errorf("Expected the recorded entry, got %+v", entries)
+	}
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/logs?limit=many", nil)
+	serveLogs(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a bad limit, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	// following streams the recent entries and then new ones
+	server := httptest.NewServer(http.HandlerFunc(serveLogs))
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ = http.NewRequest("GET", server.URL+"/logs?follow=1&kind=access", nil)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("Expected no error following, got: %v", err)
+	}
+	defer resp.Body.Close()
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() {
+		t.Fatal("Expected the recent entry")
+	}
+
+	Record(Entry{Site: "a.com:80", Kind: "error", Line: "skipped"})
+	Record(Entry{Site: "a.com:80", Kind: "access", Line: "new"})
+	if !lines.Scan() {
+		t.Fatal("Expected a new entry")
+	}
+	var e Entry
+	json.Unmarshal(lines.Bytes(), &e)
+	if e.Line != "new" {
+		t.Errorf("Expected the new access entry, got %+v", e)
+	}
+}
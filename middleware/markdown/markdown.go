@@ -6,7 +6,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/mholt/caddy/middleware"
 	"github.com/russross/blackfriday"
@@ -29,6 +31,9 @@ type Markdown struct {
 
 	// The list of index files to try
 	IndexFiles []string
+
+	// Permissions for the files and directories of generated static sites
+	FilePerms middleware.FilePerms
 }
 
 // IsIndexFile checks to see if a file is an index file
@@ -95,22 +100,23 @@ func (md Markdown) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 					return http.StatusNotFound, nil
 				}
 
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
 				// if static site is generated, attempt to use it
-				if filepath, ok := m.StaticFiles[fpath]; ok {
-					if fs1, err := os.Stat(filepath); err == nil {
-						// if markdown has not been modified
-						// since static page generation,
-						// serve the static page
-						if fs.ModTime().UnixNano() < fs1.ModTime().UnixNano() {
-							if html, err := ioutil.ReadFile(filepath); err == nil {
-								w.Write(html)
-								return http.StatusOK, nil
-							}
-							if os.IsPermission(err) {
-								return http.StatusForbidden, err
-							}
-							return http.StatusNotFound, nil
+				staticFilesMu.RLock()
+				staticFile, ok := m.StaticFiles[fpath]
+				staticFilesMu.RUnlock()
+				if ok {
+					// if markdown has not been modified
+					// since static page generation,
+					// serve the static page
+					html, fresh, err := readStatic(m.StaticDir, staticFile, fs.ModTime())
+					if fresh {
+						if err != nil {
+							return http.StatusInternalServerError, err
 						}
+						w.Write(html)
+						return http.StatusOK, nil
 					}
 				}
 
@@ -133,3 +139,33 @@ func (md Markdown) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 	// Didn't qualify to serve as markdown; pass-thru
 	return md.Next.ServeHTTP(w, r)
 }
+
+// readStatic returns the static page name, which is in the static
+// directory dir, if it was generated after modTime. The page is read
+// confined to dir, so a link put there can't lead out of it.
+func readStatic(dir, name string, modTime time.Time) (html []byte, fresh bool, err error) {
+	rel, err := filepath.Rel(dir, name)
+	if err != nil {
+		return nil, false, nil
+	}
+	f, err := middleware.ConfinedDir(dir).Open("/" + filepath.ToSlash(rel))
+	if err != nil {
+		return nil, false, nil
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !modTime.Before(info.ModTime()) {
+		return nil, false, nil
+	}
+	html, err = ioutil.ReadAll(f)
+	return html, true, err
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (md Markdown) Scopes() []string {
+	scopes := make([]string, len(md.Configs))
+	for i, c := range md.Configs {
+		scopes[i] = c.PathScope
+	}
+	return scopes
+}
@@ -0,0 +1,200 @@
+package markdown
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/russross/blackfriday"
+)
+
+func TestMarkdown(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("layout.html", "<h1>{{.title}}</h1><p>{{.author}}</p>{{.markdown}}")
+	write("post.md", "---\ntitle: First post\ntemplate: layout\nvariables:\n  author: Ann\n---\n# Hello\n")
+	write("plain.md", "Just *text*\n")
+	write("yaml.md", "---\ntitle: <b>Bold</b>\n---\nBody\n")
+
+	md := Markdown{
+		Root:    root,
+		FileSys: http.Dir(root),
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Configs: []Config{{
+			Renderer:    blackfriday.HtmlRenderer(0, "", ""),
+			PathScope:   "/",
+			Extensions:  []string{".md"},
+			Templates:   map[string]string{"layout": filepath.Join(root, "layout.html")},
+			StaticFiles: make(map[string]string),
+		}},
+	}
+
+	for i, test := range []struct {
+		path           string
+		expectedStatus int
+		expectedBody   []string
+	}{
+		{"/post.md", http.StatusOK, []string{"<h1>First post</h1>", "<p>Ann</p>", "<h1>Hello</h1>"}},
+		{"/plain.md", http.StatusOK, []string{"<title>plain.md</title>", "<em>text</em>"}},
+		{"/yaml.md", http.StatusOK, []string{"<title>&lt;b&gt;Bold&lt;/b&gt;</title>"}},
+		{"/missing.md", http.StatusNotFound, nil},
+		{"/layout.html", http.StatusTeapot, nil},
+	} {
+		rec := httptest.NewRecorder()
+		status, err := md.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if status != http.StatusOK {
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+			t.Errorf("Test %d: Expected an HTML Content-Type, got %s", i, ct)
+		}
+		for _, s := range test.expectedBody {
+			if !strings.Contains(rec.Body.String(), s) {
+				t.Errorf("Test %d: Expected body to contain %q, got %q", i, s, rec.Body.String())
+			}
+		}
+	}
+}
+
+func TestProcessPagesApart(t *testing.T) {
+	c := Config{
+		Renderer:  blackfriday.HtmlRenderer(0, "", ""),
+		Templates: make(map[string]string),
+	}
+	pages := map[string]string{
+		"/a.md": "+++\ntitle = \"A\"\n[variables]\nsecret = \"a\"\n+++\nA\n",
+		"/b.md": "+++\ntitle = \"B\"\n+++\nB\n",
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		for path, page := range pages {
+			wg.Add(1)
+			go func(path, page string) {
+				defer wg.Done()
+				html, err := Markdown{}.Process(c, path, []byte(page))
+				if err != nil {
+					t.Errorf("Expected no error, got: %v", err)
+					return
+				}
+				if path == "/b.md" && strings.Contains(string(html), "<title>A</title>") {
+					t.Errorf("Expected page B to have its own title, got %s", html)
+				}
+			}(path, page)
+		}
+	}
+	wg.Wait()
+}
+
+func TestStaticGeneration(t *testing.T) {
+	root := t.TempDir()
+	static := filepath.Join(root, DefaultStaticDir)
+	md := Markdown{Root: root, IndexFiles: []string{"index.md"}}
+	c := Config{
+		Renderer:    blackfriday.HtmlRenderer(0, "", ""),
+		Templates:   make(map[string]string),
+		StaticFiles: make(map[string]string),
+		StaticDir:   static,
+	}
+
+	if _, err := md.Process(c, "/docs/index.md", []byte("# Docs\n")); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := filepath.Join(static, "docs", "index.html")
+	if c.StaticFiles["/docs/index.md"] != expected {
+		t.Errorf("Expected the page to be generated at %s, got %v", expected, c.StaticFiles)
+	}
+	if body, err := os.ReadFile(expected); err != nil || !strings.Contains(string(body), "<h1>Docs</h1>") {
+		t.Errorf("Expected the generated page to have the rendered markdown, got %q (%v)", body, err)
+	}
+}
+
+func TestConfinedRoot(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.md"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "layout.html"), []byte("secret {{.markdown}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.md"), filepath.Join(root, "secret.md")); err != nil {
+		t.Skipf("Can't create symlinks: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "layout.html"), filepath.Join(root, "layout.html")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "post.md"), []byte("---\ntemplate: layout\n---\nhi\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a generated page swapped for a link out of the static directory
+	static := filepath.Join(root, DefaultStaticDir)
+	if err := os.MkdirAll(filepath.Join(static, "page"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "page.md"), []byte("page"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "page.html"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(outside, "page.html"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "page.html"), filepath.Join(static, "page", "index.html")); err != nil {
+		t.Fatal(err)
+	}
+
+	md := Markdown{
+		Root:    root,
+		FileSys: middleware.ConfinedDir(root),
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusTeapot, nil
+		}),
+		Configs: []Config{{
+			Renderer:    blackfriday.HtmlRenderer(0, "", ""),
+			PathScope:   "/",
+			Extensions:  []string{".md"},
+			Templates:   map[string]string{"layout": filepath.Join(root, "layout.html")},
+			StaticFiles: map[string]string{"/page.md": filepath.Join(static, "page", "index.html")},
+			StaticDir:   static,
+		}},
+	}
+
+	for i, test := range []struct {
+		path           string
+		expectedStatus int
+	}{
+		{"/secret.md", http.StatusNotFound},
+		{"/post.md", http.StatusInternalServerError},
+		{"/page.md", http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		status, _ := md.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if strings.Contains(rec.Body.String(), "secret") {
+			t.Errorf("Test %d: Expected nothing from outside the root, got %q", i, rec.Body.String())
+		}
+	}
+}
@@ -11,13 +11,20 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
-var (
-	parsers = []MetadataParser{
-		&JSONMetadataParser{metadata: Metadata{Variables: make(map[string]interface{})}},
-		&TOMLMetadataParser{metadata: Metadata{Variables: make(map[string]interface{})}},
-		&YAMLMetadataParser{metadata: Metadata{Variables: make(map[string]interface{})}},
-	}
-)
+// parsers make the parsers of each kind of front matter. A parser
+// keeps the metadata of the page it parsed, so each page gets new
+// ones; otherwise pages would be given each other's variables.
+var parsers = []func() MetadataParser{
+	func() MetadataParser {
+		return &JSONMetadataParser{metadata: Metadata{Variables: make(map[string]interface{})}}
+	},
+	func() MetadataParser {
+		return &TOMLMetadataParser{metadata: Metadata{Variables: make(map[string]interface{})}}
+	},
+	func() MetadataParser {
+		return &YAMLMetadataParser{metadata: Metadata{Variables: make(map[string]interface{})}}
+	},
+}
 
 // Metadata stores a page's metadata
 type Metadata struct {
@@ -39,8 +46,8 @@ func (m *Metadata) load(parsedMap map[string]interface{}) {
 	if template, ok := parsedMap["template"]; ok {
 		m.Template, _ = template.(string)
 	}
-	if variables, ok := parsedMap["variables"]; ok {
-		m.Variables, _ = variables.(map[string]interface{})
+	if variables, ok := parsedMap["variables"].(map[string]interface{}); ok {
+		m.Variables = variables
 	}
 }
 
@@ -239,8 +246,8 @@ func findParser(b []byte) MetadataParser {
 		return nil
 	}
 	line = bytes.TrimSpace(line)
-	for _, parser := range parsers {
-		if bytes.Equal(parser.Opening(), line) {
+	for _, newParser := range parsers {
+		if parser := newParser(); bytes.Equal(parser.Opening(), line) {
 			return parser
 		}
 	}
@@ -2,11 +2,13 @@ package markdown
 
 import (
 	"bytes"
+	"html"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/russross/blackfriday"
@@ -17,6 +19,28 @@ const (
 	DefaultStaticDir = "generated_site"
 )
 
+// staticFilesMu protects the StaticFiles of configs, since
+// pages are generated while requests are being served.
+var staticFilesMu sync.RWMutex
+
+// readFile reads the file at fpath, a path on disk. Files under
+// md.Root are read through md.FileSys, so they are confined to the
+// root the same way as the pages themselves.
+func (md Markdown) readFile(fpath string) ([]byte, error) {
+	if md.FileSys != nil && md.Root != "" {
+		rel, err := filepath.Rel(md.Root, fpath)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			f, err := md.FileSys.Open("/" + filepath.ToSlash(rel))
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			return ioutil.ReadAll(f)
+		}
+	}
+	return ioutil.ReadFile(fpath)
+}
+
 // Process processes the contents of a page in b. It parses the metadata
 // (if any) and uses the template (if found).
 func (md Markdown) Process(c Config, requestPath string, b []byte) ([]byte, error) {
@@ -50,7 +74,7 @@ func (md Markdown) Process(c Config, requestPath string, b []byte) ([]byte, erro
 	var tmpl []byte
 	if metadata.Template != "" {
 		if t, ok := c.Templates[metadata.Template]; ok {
-			tmpl, err = ioutil.ReadFile(t)
+			tmpl, err = md.readFile(t)
 		}
 		if err != nil {
 			return nil, err
@@ -60,8 +84,11 @@ func (md Markdown) Process(c Config, requestPath string, b []byte) ([]byte, erro
 	// process markdown
 	markdown = blackfriday.Markdown(markdown, c.Renderer, 0)
 
-	// set it as body for template
+	// set it as body for template, with the title
 	metadata.Variables["markdown"] = string(markdown)
+	if _, ok := metadata.Variables["title"]; !ok {
+		metadata.Variables["title"] = metadata.Title
+	}
 
 	return md.processTemplate(c, requestPath, tmpl, metadata)
 }
@@ -104,7 +131,7 @@ func (md Markdown) generatePage(c Config, requestPath string, content []byte) er
 	if c.StaticDir != "" {
 		// if static directory is not existing, create it
 		if _, err := os.Stat(c.StaticDir); err != nil {
-			err := os.MkdirAll(c.StaticDir, os.FileMode(0755))
+			err := md.FilePerms.Defaults(0664, 0755).MkdirAll(c.StaticDir)
 			if err != nil {
 				return err
 			}
@@ -118,18 +145,20 @@ func (md Markdown) generatePage(c Config, requestPath string, content []byte) er
 		}
 
 		// Create the directory in case it is not existing
-		if err := os.MkdirAll(filePath, os.FileMode(0744)); err != nil {
+		if err := md.FilePerms.Defaults(0664, 0744).MkdirAll(filePath); err != nil {
 			return err
 		}
 
 		// generate index.html file in the directory
 		filePath = filepath.Join(filePath, "index.html")
-		err := ioutil.WriteFile(filePath, content, os.FileMode(0664))
+		err := md.FilePerms.Defaults(0664, 0744).WriteFile(filePath, content)
 		if err != nil {
 			return err
 		}
 
+		staticFilesMu.Lock()
 		c.StaticFiles[requestPath] = filePath
+		staticFilesMu.Unlock()
 	}
 
 	return nil
@@ -147,23 +176,20 @@ func defaultTemplate(c Config, metadata Metadata, requestPath string) []byte {
 		scripts.WriteString("\r\n")
 	}
 
-	// Title is first line (length-limited), otherwise filename
+	// Title is from the metadata, otherwise the filename
 	title := metadata.Title
 	if title == "" {
 		title = filepath.Base(requestPath)
-		if body, _ := metadata.Variables["markdown"].([]byte); len(body) > 128 {
-			title = string(body[:128])
-		} else if len(body) > 0 {
-			title = string(body)
-		}
 	}
+	// escaped for HTML, and so the template doesn't run it
+	title = strings.NewReplacer("{{", "&#123;&#123;").Replace(html.EscapeString(title))
 
-	html := []byte(htmlTemplate)
-	html = bytes.Replace(html, []byte("{{title}}"), []byte(title), 1)
-	html = bytes.Replace(html, []byte("{{css}}"), styles.Bytes(), 1)
-	html = bytes.Replace(html, []byte("{{js}}"), scripts.Bytes(), 1)
+	page := []byte(htmlTemplate)
+	page = bytes.Replace(page, []byte("{{title}}"), []byte(title), 1)
+	page = bytes.Replace(page, []byte("{{css}}"), styles.Bytes(), 1)
+	page = bytes.Replace(page, []byte("{{js}}"), scripts.Bytes(), 1)
 
-	return html
+	return page
 }
 
 const (
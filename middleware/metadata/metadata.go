@@ -0,0 +1,125 @@
+// Package metadata reads sidecar files that annotate the files
+// and directories next to them, for directory listings and for
+// the headers files are served with.
+package metadata
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/mholt/caddy/config/parse"
+)
+
+// DefaultFile is the name of the sidecar file that
+// is read in each directory if no other is given.
+const DefaultFile = ".metadata"
+
+// Entry annotates a file or directory.
+type Entry struct {
+	// Name to show instead of the file name
+	DisplayName string
+
+	// A sentence or two about it
+	Description string
+
+	// URL of an image to show next to it
+	Icon string
+
+	// Headers to serve the file with
+	Header http.Header
+}
+
+// SetHeaders sets the headers the file of e is served with on h:
+// those given for it and, if it has a display name and h has no
+// Content-Disposition, the name clients should save the file as.
+func (e Entry) SetHeaders(h http.Header) {
+	for name, vals := range e.Header {
+		h[name] = vals
+	}
+	if e.DisplayName != "" && h.Get("Content-Disposition") == "" {
+		disposition := mime.FormatMediaType("inline", map[string]string{"filename": e.DisplayName})
+		if disposition != "" {
+			h.Set("Content-Disposition", disposition)
+		}
+	}
+}
+
+// Dir maps the names of the entries in a directory to what its
+// sidecar file says about them. The directory itself is ".".
+type Dir map[string]Entry
+
+// Load reads the sidecar file named fileName in the directory
+// dir of fs. A directory without one has no entries. Sidecar
+// files look like:
+//
+//	. {
+//		description "Slides from the conference"
+//	}
+//	keynote.pdf {
+//		name        "Opening keynote"
+//		description "What's new this year"
+//		icon        /icons/slides.png
+//		header      Cache-Control "max-age=3600"
+//	}
+func Load(fs http.FileSystem, dir, fileName string) (Dir, error) {
+	file := path.Join("/", dir, fileName)
+	f, err := fs.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return parseDir(parse.NewDispenser(file, f))
+}
+
+// parseDir parses the entries of a sidecar file from d.
+func parseDir(d parse.Dispenser) (Dir, error) {
+	entries := make(Dir)
+
+	for d.Next() {
+		name := d.Val()
+		if len(d.RemainingArgs()) > 0 {
+			return entries, d.ArgErr()
+		}
+		if strings.Contains(name, "/") {
+			return entries, d.Errf("Entry '%s' must be in the same directory", name)
+		}
+		entry := entries[name]
+
+		for d.NextBlock() {
+			what := d.Val()
+			args := d.RemainingArgs()
+			if what == "header" {
+				if len(args) != 2 {
+					return entries, d.ArgErr()
+				}
+				if entry.Header == nil {
+					entry.Header = make(http.Header)
+				}
+				entry.Header.Add(args[0], args[1])
+				continue
+			}
+			if len(args) != 1 {
+				return entries, d.ArgErr()
+			}
+			switch what {
+			case "name":
+				entry.DisplayName = args[0]
+			case "description":
+				entry.Description = args[0]
+			case "icon":
+				entry.Icon = args[0]
+			default:
+				return entries, d.Errf("Unknown metadata property '%s'", what)
+			}
+		}
+		entries[name] = entry
+	}
+
+	return entries, nil
+}
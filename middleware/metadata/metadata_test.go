@@ -0,0 +1,129 @@
+package metadata
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/config/parse"
+)
+
+func TestParseDir(t *testing.T) {
+	tests := []struct {
+		input     string
+		shouldErr bool
+		expected  Dir
+	}{
+		{``, false, Dir{}},
+		{`. {
+			description "The files"
+		}
+		report.pdf {
+			name        "Q3 report"
+			description "Figures for the quarter"
+			icon        /icons/pdf.png
+			header      Cache-Control "max-age=60"
+			header      X-Robots-Tag noindex
+		}
+		"my notes.txt" {
+			name Notes
+		}`, false, Dir{
+			".": {Description: "The files"},
+			"report.pdf": {
+				DisplayName: "Q3 report",
+				Description: "Figures for the quarter",
+				Icon:        "/icons/pdf.png",
+				Header:      http.Header{"Cache-Control": {"max-age=60"}, "X-Robots-Tag": {"noindex"}},
+			},
+			"my notes.txt": {DisplayName: "Notes"},
+		}},
+		{`a.txt { name A }
+		a.txt {
+			description "More about A"
+		}`, false, Dir{"a.txt": {DisplayName: "A", Description: "More about A"}}},
+		{`a.txt b.txt {
+			name A
+		}`, true, nil},
+		{`sub/a.txt {
+			name A
+		}`, true, nil},
+		{`a.txt {
+			colour red
+		}`, true, nil},
+		{`a.txt {
+			name
+		}`, true, nil},
+		{`a.txt {
+			header Cache-Control
+		}`, true, nil},
+	}
+
+	for i, test := range tests {
+		actual, err := parseDir(parse.NewDispenser("Testfile", strings.NewReader(test.input)))
+
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if !test.shouldErr && !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test %d: Expected %+v, got %+v", i, test.expected, actual)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	root, err := ioutil.TempDir("", "metadata_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := os.Mkdir(filepath.Join(root, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "docs", DefaultFile), []byte("a.txt {\n\tname A\n}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := Load(http.Dir(root), "/docs/", DefaultFile)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if dir["a.txt"].DisplayName != "A" {
+		t.Errorf("Expected the entry for a.txt to be loaded, got %+v", dir)
+	}
+
+	dir, err = Load(http.Dir(root), "/", DefaultFile)
+	if err != nil || dir != nil {
+		t.Errorf("Expected no entries and no error without a sidecar file, got %v and %v", dir, err)
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	for i, test := range []struct {
+		entry    Entry
+		before   http.Header
+		expected http.Header
+	}{
+		{Entry{}, http.Header{}, http.Header{}},
+		{Entry{Description: "no headers"}, http.Header{}, http.Header{}},
+		{Entry{Header: http.Header{"Cache-Control": {"no-cache"}}}, http.Header{"Cache-Control": {"max-age=60"}},
+			http.Header{"Cache-Control": {"no-cache"}}},
+		{Entry{DisplayName: "Q3 report.pdf"}, http.Header{},
+			http.Header{"Content-Disposition": {`inline; filename="Q3 report.pdf"`}}},
+		{Entry{DisplayName: "Bericht Größe.pdf"}, http.Header{},
+			http.Header{"Content-Disposition": {`inline; filename*=utf-8''Bericht%20Gr%C3%B6%C3%9Fe.pdf`}}},
+		{Entry{DisplayName: "Q3", Header: http.Header{"Content-Disposition": {"attachment"}}}, http.Header{},
+			http.Header{"Content-Disposition": {"attachment"}}},
+	} {
+		test.entry.SetHeaders(test.before)
+		if !reflect.DeepEqual(test.before, test.expected) {
+			t.Errorf("Test %d: Expected headers %v, got %v", i, test.expected, test.before)
+		}
+	}
+}
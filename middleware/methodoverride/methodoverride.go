@@ -0,0 +1,123 @@
+// Package methodoverride provides middleware that lets clients which
+// can only send GET and POST, like HTML forms, make requests with
+// other methods.
+package methodoverride
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// MaxFormSize is the largest form body that is read to find
+// the method field; the field of larger forms is not honored.
+const MaxFormSize = 1 << 20
+
+// MethodOverride is middleware that changes the method of POST
+// requests to the one named in their Header or form Field, if it
+// is Allowed, before passing them on. Only POST requests are
+// overridden, since other methods aren't safe for a link or an
+// image to make the browser send.
+type MethodOverride struct {
+	Next    middleware.Handler
+	Paths   []string // paths to override methods under; all if empty
+	Header  string   // the header naming the method, if any
+	Field   string   // the form field naming the method, if any
+	Allowed []string // the methods that may be given
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (m MethodOverride) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != "POST" || !m.matches(r.URL.Path) {
+		return m.Next.ServeHTTP(w, r)
+	}
+
+	method := ""
+	if m.Header != "" {
+		method = r.Header.Get(m.Header)
+		r.Header.Del(m.Header) // so the backend doesn't override it again
+	}
+	if method == "" && m.Field != "" {
+		method = m.formMethod(r)
+	}
+	if method == "" {
+		return m.Next.ServeHTTP(w, r)
+	}
+
+	method = strings.ToUpper(method)
+	if !m.allowed(method) {
+		return http.StatusMethodNotAllowed, nil
+	}
+	middleware.TraceFrom(r).Note("method=%s", method)
+	r.Method = method
+
+	return m.Next.ServeHTTP(w, r)
+}
+
+// formMethod returns the value of the method field in the query
+// string or form body of r. The body is read, so it's replaced
+// with one that gives the same bytes to handlers after this one.
+func (m MethodOverride) formMethod(r *http.Request) string {
+	if method := r.URL.Query().Get(m.Field); method != "" {
+		return method
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" || r.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxFormSize+1))
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil || len(body) > MaxFormSize {
+		return ""
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return ""
+	}
+	return form.Get(m.Field)
+}
+
+// matches returns true if the methods of requests
+// for path may be overridden.
+func (m MethodOverride) matches(path string) bool {
+	if len(m.Paths) == 0 {
+		return true
+	}
+	for _, p := range m.Paths {
+		if middleware.Path(path).Matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed returns true if method may be given.
+func (m MethodOverride) allowed(method string) bool {
+	for _, a := range m.Allowed {
+		if a == method {
+			return true
+		}
+	}
+	return false
+}
+
+// readCloser reads from a Reader and closes the Closer,
+// which is the original body of the request.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (m MethodOverride) Scopes() []string {
+	if len(m.Paths) == 0 {
+		return []string{"/"}
+	}
+	return m.Paths
+}
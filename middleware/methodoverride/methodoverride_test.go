@@ -0,0 +1,70 @@
+package methodoverride
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestMethodOverride(t *testing.T) {
+	var method, body string
+	m := MethodOverride{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			method = r.Method
+			b, _ := io.ReadAll(r.Body)
+			body = string(b)
+			return http.StatusOK, nil
+		}),
+		Paths:   []string{"/api"},
+		Header:  "X-HTTP-Method-Override",
+		Field:   "_method",
+		Allowed: []string{"PUT", "DELETE"},
+	}
+
+	for i, test := range []struct {
+		method, path, header, contentType, body string
+		expectedStatus                          int
+		expectedMethod                          string
+	}{
+		{"POST", "/api/items", "PUT", "", "", http.StatusOK, "PUT"},
+		{"POST", "/api/items", "delete", "", "", http.StatusOK, "DELETE"},
+		{"POST", "/api/items", "PATCH", "", "", http.StatusMethodNotAllowed, ""},
+		{"GET", "/api/items", "DELETE", "", "", http.StatusOK, "GET"},
+		{"POST", "/other", "DELETE", "", "", http.StatusOK, "POST"},
+		{"POST", "/api/items?_method=DELETE", "", "", "", http.StatusOK, "DELETE"},
+		{"POST", "/api/items", "", "application/x-www-form-urlencoded", "name=x&_method=PUT", http.StatusOK, "PUT"},
+		{"POST", "/api/items", "", "application/x-www-form-urlencoded; charset=utf-8", "name=x", http.StatusOK, "POST"},
+		{"POST", "/api/items", "", "text/plain", "_method=PUT", http.StatusOK, "POST"},
+		{"POST", "/api/items", "", "application/x-www-form-urlencoded", "_method=PUT&big=" + strings.Repeat("x", MaxFormSize), http.StatusOK, "POST"},
+	} {
+		method, body = "", ""
+		r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.header != "" {
+			r.Header.Set("X-HTTP-Method-Override", test.header)
+		}
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+
+		status, err := m.ServeHTTP(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if method != test.expectedMethod {
+			t.Errorf("Test %d: Expected method %s, got %s", i, test.expectedMethod, method)
+		}
+		if test.expectedMethod != "" && body != test.body {
+			t.Errorf("Test %d: Expected the body to be passed on whole, got %d of %d bytes", i, len(body), len(test.body))
+		}
+		if test.expectedMethod != "" && test.expectedMethod != test.method && r.Header.Get("X-HTTP-Method-Override") != "" {
+			t.Errorf("Test %d: Expected the override header to be removed", i)
+		}
+	}
+}
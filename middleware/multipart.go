@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"os"
+)
+
+// Defaults for MultipartLimits.
+const (
+	DefaultMultipartMemory = 10 << 20 // 10MB
+	DefaultMultipartParts  = 1000
+	DefaultMultipartFiles  = 100
+)
+
+// Errors returned by MultipartLimits.Parse when a body goes
+// over the limits.
+var (
+	ErrMultipartParts  = errors.New("multipart: too many parts")
+	ErrMultipartFiles  = errors.New("multipart: too many files")
+	ErrMultipartMemory = errors.New("multipart: form values too large")
+)
+
+// MultipartLimits describes how multipart request bodies are
+// parsed by middleware that reads forms. The zero value uses
+// the defaults.
+type MultipartLimits struct {
+	// How many bytes of the body may be kept in memory; form
+	// values must fit, and files that don't are written to
+	// temporary files. 0 for DefaultMultipartMemory
+	Memory int64
+
+	// Directory for the temporary files; "" for os.TempDir()
+	TempDir string
+
+	// Permissions and ownership for the temporary files; nil
+	// leaves them private to the process
+	Perms *FilePerms
+
+	// How many parts, and how many of them files, a body
+	// may have; 0 for DefaultMultipartParts and
+	// DefaultMultipartFiles
+	MaxParts int
+	MaxFiles int
+}
+
+// MultipartForm is a parsed multipart body. Its temporary
+// files stay on disk until RemoveAll is called.
+type MultipartForm struct {
+	Value map[string][]string
+	File  map[string][]*MultipartFile
+}
+
+// MultipartFile is a file uploaded in a multipart body.
+type MultipartFile struct {
+	Filename string
+	Header   textproto.MIMEHeader
+	Size     int64
+
+	content []byte // the file, if kept in memory
+	tmpfile string // otherwise the name of the temporary file
+}
+
+// Open opens the file for reading.
+func (f *MultipartFile) Open() (io.ReadCloser, error) {
+	if f.tmpfile != "" {
+		return os.Open(f.tmpfile)
+	}
+	return ioutil.NopCloser(bytes.NewReader(f.content)), nil
+}
+
+// RemoveAll removes the temporary files of the form.
+func (f *MultipartForm) RemoveAll() error {
+	var err error
+	for _, files := range f.File {
+		for _, file := range files {
+			if file.tmpfile == "" {
+				continue
+			}
+			if e := os.Remove(file.tmpfile); e != nil && !os.IsNotExist(e) && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// Parse reads the multipart body of r as it streams in, within
+// the limits. If it fails, any temporary files it wrote are
+// removed; otherwise the caller must call RemoveAll on the form
+// when done with it.
+func (l MultipartLimits) Parse(r *http.Request) (*MultipartForm, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	maxParts, maxFiles, memory := l.MaxParts, l.MaxFiles, l.Memory
+	if maxParts <= 0 {
+		maxParts = DefaultMultipartParts
+	}
+	if maxFiles <= 0 {
+		maxFiles = DefaultMultipartFiles
+	}
+	if memory <= 0 {
+		memory = DefaultMultipartMemory
+	}
+
+	form := &MultipartForm{
+		Value: make(map[string][]string),
+		File:  make(map[string][]*MultipartFile),
+	}
+	fail := func(err error) (*MultipartForm, error) {
+		form.RemoveAll()
+		return nil, err
+	}
+
+	var parts, files int
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(err)
+		}
+
+		parts++
+		if parts > maxParts {
+			return fail(ErrMultipartParts)
+		}
+
+		name := p.FormName()
+		if name == "" {
+			continue
+		}
+
+		var buf bytes.Buffer
+		n, err := io.CopyN(&buf, p, memory+1)
+		if err != nil && err != io.EOF {
+			return fail(err)
+		}
+
+		filename := p.FileName()
+		if filename == "" {
+			memory -= n
+			if memory < 0 {
+				return fail(ErrMultipartMemory)
+			}
+			form.Value[name] = append(form.Value[name], buf.String())
+			continue
+		}
+
+		files++
+		if files > maxFiles {
+			return fail(ErrMultipartFiles)
+		}
+
+		file := &MultipartFile{Filename: filename, Header: p.Header}
+		if n <= memory {
+			file.content = buf.Bytes()
+			file.Size = n
+			memory -= n
+			form.File[name] = append(form.File[name], file)
+			continue
+		}
+
+		// Too big for memory; the file goes on disk, and into
+		// the form right away so that it's removed on failure
+		tmp, err := ioutil.TempFile(l.TempDir, "multipart-")
+		if err != nil {
+			return fail(err)
+		}
+		file.tmpfile = tmp.Name()
+		form.File[name] = append(form.File[name], file)
+		if l.Perms != nil {
+			if err := l.Perms.Apply(tmp.Name()); err != nil {
+				tmp.Close()
+				return fail(err)
+			}
+		}
+		file.Size, err = io.Copy(tmp, io.MultiReader(&buf, p))
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	return form, nil
+}
+
+// MultipartStatus returns the status to respond with when
+// MultipartLimits.Parse fails with err: 413 if the body
+// went over the limits, or 400 if it was malformed.
+func MultipartStatus(err error) int {
+	switch err {
+	case ErrMultipartParts, ErrMultipartFiles, ErrMultipartMemory:
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// multipartBody returns a multipart body with the fields and
+// files given, and its content type.
+func multipartBody(t *testing.T, fields, files map[string]string) (*bytes.Buffer, string) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		w.WriteField(name, value)
+	}
+	for name, content := range files {
+		fw, err := w.CreateFormFile(name, name+".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(content))
+	}
+	w.Close()
+	return &buf, w.FormDataContentType()
+}
+
+func TestMultipartParse(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "caddy_multipart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	big := strings.Repeat("x", 100)
+	body, contentType := multipartBody(t,
+		map[string]string{"name": "gopher"},
+		map[string]string{"small": "tiny", "big": big})
+	r := httptest.NewRequest("POST", "/", body)
+	r.Header.Set("Content-Type", contentType)
+
+	perms := FilePerms{Mode: 0640}
+	form, err := MultipartLimits{Memory: 50, TempDir: tmp, Perms: &perms}.Parse(r)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if got := form.Value["name"]; len(got) != 1 || got[0] != "gopher" {
+		t.Errorf("Expected value 'gopher', got %v", got)
+	}
+	for name, expected := range map[string]string{"small": "tiny", "big": big} {
+		file := form.File[name][0]
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		if string(content) != expected || file.Size != int64(len(expected)) {
+			t.Errorf("Expected file %s to have %q, got %q (size %d)", name, expected, content, file.Size)
+		}
+	}
+
+	if infos, _ := ioutil.ReadDir(tmp); len(infos) != 1 {
+		t.Errorf("Expected the big file in a temporary file, got %d files", len(infos))
+	} else if mode := infos[0].Mode().Perm(); mode != 0640 {
+		t.Errorf("Expected the temporary file to have mode 640, got %o", mode)
+	}
+	if err := form.RemoveAll(); err != nil {
+		t.Errorf("Expected no error removing files, got: %v", err)
+	}
+	if infos, _ := ioutil.ReadDir(tmp); len(infos) != 0 {
+		t.Errorf("Expected temporary files to be removed, got %d files", len(infos))
+	}
+}
+
+func TestMultipartLimits(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "caddy_multipart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	fields := map[string]string{"a": "1", "b": "2", "c": "3"}
+	files := map[string]string{"x": strings.Repeat("x", 100), "y": strings.Repeat("y", 100)}
+
+	for i, test := range []struct {
+		limits   MultipartLimits
+		expected error
+	}{
+		{MultipartLimits{MaxParts: 4}, ErrMultipartParts},
+		{MultipartLimits{MaxFiles: 1}, ErrMultipartFiles},
+		{MultipartLimits{Memory: 2}, ErrMultipartMemory},
+		{MultipartLimits{MaxParts: 5, MaxFiles: 2, Memory: 3}, nil},
+	} {
+		body, contentType := multipartBody(t, fields, files)
+		r := httptest.NewRequest("POST", "/", body)
+		r.Header.Set("Content-Type", contentType)
+
+		test.limits.TempDir = tmp
+		form, err := test.limits.Parse(r)
+		if err != test.expected {
+			t.Errorf("Test %d: Expected error %v, got %v", i, test.expected, err)
+		}
+		if form != nil {
+			form.RemoveAll()
+		}
+		if infos, _ := ioutil.ReadDir(tmp); len(infos) != 0 {
+			t.Errorf("Test %d: Expected no temporary files left, got %d", i, len(infos))
+		}
+	}
+
+	if status := MultipartStatus(ErrMultipartFiles); status != 413 {
+		t.Errorf("Expected status 413 for too many files, got %d", status)
+	}
+}
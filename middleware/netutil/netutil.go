@@ -0,0 +1,284 @@
+// Package netutil provides middleware that serves small network
+// utility endpoints, for sites at the edge: DNS over HTTPS (RFC
+// 8484) forwarded to a resolver, and echoes of the client's IP
+// address and of the server's time.
+package netutil
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// NetUtil is middleware that serves the utility endpoints; each
+// is disabled if its path is empty.
+type NetUtil struct {
+	Next middleware.Handler
+
+	// Path of the DNS over HTTPS endpoint, the resolver (host:port)
+	// queries are forwarded to, and how long to wait for it
+	DNSQuery string
+	Resolver string
+	Timeout  time.Duration
+
+	IP   string // path of the client IP echo
+	Time string // path of the server time echo
+}
+
+// DefaultTimeout is how long to wait for the resolver if
+// NetUtil.Timeout isn't set.
+const DefaultTimeout = 5 * time.Second
+
+// dnsMessageType is the media type of DNS messages.
+const dnsMessageType = "application/dns-message"
+
+// ServeHTTP implements the middleware.Handler interface.
+func (n NetUtil) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	switch p := r.URL.Path; {
+	case n.DNSQuery != "" && p == n.DNSQuery:
+		return n.serveDNSQuery(w, r)
+	case n.IP != "" && p == n.IP:
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		return echo(w, r, ip, map[string]string{"ip": ip})
+	case n.Time != "" && p == n.Time:
+		now := time.Now().UTC()
+		return echo(w, r, now.Format(time.RFC3339Nano), map[string]interface{}{
+			"time": now.Format(time.RFC3339Nano),
+			"unix": float64(now.UnixNano()) / float64(time.Second),
+		})
+	}
+	return n.Next.ServeHTTP(w, r)
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (n NetUtil) Scopes() []string {
+	var scopes []string
+	for _, p := range []string{n.DNSQuery, n.IP, n.Time} {
+		if p != "" {
+			scopes = append(scopes, p)
+		}
+	}
+	return scopes
+}
+
+// echo writes text, or v as JSON if the client accepts it, and
+// never to be cached.
+func echo(w http.ResponseWriter, r *http.Request, text string, v interface{}) (int, error) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		return http.StatusMethodNotAllowed, nil
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(v)
+		return 0, nil
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, text+"\n")
+	return 0, nil
+}
+
+// serveDNSQuery forwards the DNS query of r, in its dns parameter
+// for GET or its body for POST, to the resolver, and responds with
+// the answer.
+func (n NetUtil) serveDNSQuery(w http.ResponseWriter, r *http.Request) (int, error) {
+	var query []byte
+	switch r.Method {
+	case "GET", "HEAD":
+		var err error
+		query, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil {
+			return http.StatusBadRequest, nil
+		}
+	case "POST":
+		if r.Header.Get("Content-Type") != dnsMessageType {
+			return http.StatusUnsupportedMediaType, nil
+		}
+		var err error
+		query, err = ioutil.ReadAll(io.LimitReader(r.Body, 65536))
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		return http.StatusMethodNotAllowed, nil
+	}
+	if len(query) < 12 || len(query) > 65535 {
+		return http.StatusBadRequest, nil
+	}
+
+	answer, err := n.exchange(query)
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+
+	w.Header().Set("Content-Type", dnsMessageType)
+	if ttl, ok := minTTL(answer); ok {
+		// the answer may be cached as long as its records may (RFC 8484 5.1)
+		w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(ttl), 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(answer)
+	return 0, nil
+}
+
+// minTTL returns the smallest TTL of the resource records in the
+// DNS message msg, leaving out the EDNS OPT record, whose TTL field
+// holds flags. It returns false if msg has no records or can't be
+// parsed.
+func minTTL(msg []byte) (uint32, bool) {
+	if len(msg) < 12 {
+		return 0, false
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	records := int(binary.BigEndian.Uint16(msg[6:])) +
+		int(binary.BigEndian.Uint16(msg[8:])) +
+		int(binary.BigEndian.Uint16(msg[10:]))
+
+	off := 12
+	for i := 0; i < questions; i++ {
+		if off = skipName(msg, off); off < 0 || off+4 > len(msg) {
+			return 0, false
+		}
+		off += 4 // type and class
+	}
+
+	var ttl uint32
+	var found bool
+	for i := 0; i < records; i++ {
+		if off = skipName(msg, off); off < 0 || off+10 > len(msg) {
+			return 0, false
+		}
+		rrType := binary.BigEndian.Uint16(msg[off:])
+		rrTTL := binary.BigEndian.Uint32(msg[off+4:])
+		off += 10 + int(binary.BigEndian.Uint16(msg[off+8:]))
+		if off > len(msg) {
+			return 0, false
+		}
+		if rrType == 41 { // OPT
+			continue
+		}
+		if !found || rrTTL < ttl {
+			ttl, found = rrTTL, true
+		}
+	}
+	return ttl, found
+}
+
+// skipName returns the offset in msg just past the domain name that
+// starts at off, or -1 if the name runs past the end of msg.
+func skipName(msg []byte, off int) int {
+	for off < len(msg) {
+		switch length := int(msg[off]); {
+		case length == 0:
+			return off + 1
+		case length&0xC0 == 0xC0: // a pointer ends the name
+			if off+2 > len(msg) {
+				return -1
+			}
+			return off + 2
+		default:
+			off += 1 + length
+		}
+	}
+	return -1
+}
+
+// exchange sends query to the resolver and returns its answer. The
+// query goes over UDP, and again over TCP if the answer over UDP
+// was truncated. Clients of DNS over HTTPS usually use ID 0, so the
+// query is sent with a random ID, which is put back in the answer.
+func (n NetUtil) exchange(query []byte) ([]byte, error) {
+	timeout := n.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	msg := append([]byte(nil), query...)
+	if _, err := rand.Read(msg[:2]); err != nil {
+		return nil, err
+	}
+
+	answer, err := exchangeUDP(n.Resolver, msg, deadline)
+	if err == nil && answer[2]&0x02 != 0 { // TC: truncated
+		answer, err = exchangeTCP(n.Resolver, msg, deadline)
+	}
+	if err != nil {
+		return nil, err
+	}
+	copy(answer[:2], query[:2])
+	return answer, nil
+}
+
+var errBadAnswer = errors.New("resolver sent a bad answer")
+
+func exchangeUDP(resolver string, msg []byte, deadline time.Time) ([]byte, error) {
+	conn, err := net.Dial("udp", resolver)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// ignore stray datagrams that aren't the answer
+		if n >= 12 && buf[0] == msg[0] && buf[1] == msg[1] {
+			return buf[:n], nil
+		}
+	}
+}
+
+func exchangeTCP(resolver string, msg []byte, deadline time.Time) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", resolver, deadline.Sub(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+
+	// messages over TCP are prefixed with their length
+	framed := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(framed, uint16(len(msg)))
+	copy(framed[2:], msg)
+	if _, err := conn.Write(framed); err != nil {
+		return nil, err
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	answer := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, answer); err != nil {
+		return nil, err
+	}
+	if len(answer) < 12 || answer[0] != msg[0] || answer[1] != msg[1] {
+		return nil, errBadAnswer
+	}
+	return answer, nil
+}
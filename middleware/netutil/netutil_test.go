@@ -0,0 +1,187 @@
+package netutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mwtest "github.com/mholt/caddy/middleware/testing"
+)
+
+// query is a DNS query for example.com, type A, with ID 0.
+var query = []byte{
+	0, 0, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0,
+	7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+	0, 1, 0, 1,
+}
+
+// answer returns msg as an answer: with QR set, and TC if truncated.
+func answer(msg []byte, truncated bool) []byte {
+	a := append([]byte(nil), msg...)
+	a[2] |= 0x80
+	if truncated {
+		a[2] |= 0x02
+	}
+	return a
+}
+
+// startResolver starts a resolver that answers over UDP, truncated
+// if truncate is set, and over TCP on the same port. It returns its
+// address and the number of queries it got over TCP.
+func startResolver(t *testing.T, truncate bool) (string, *int32, func()) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		t.Skipf("Couldn't listen on the same port for TCP: %v", err)
+	}
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(answer(buf[:n], truncate), addr)
+		}
+	}()
+
+	var tcpQueries int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&tcpQueries, 1)
+			var length [2]byte
+			io.ReadFull(conn, length[:])
+			msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+			io.ReadFull(conn, msg)
+			a := answer(msg, false)
+			binary.BigEndian.PutUint16(length[:], uint16(len(a)))
+			conn.Write(append(length[:], a...))
+			conn.Close()
+		}
+	}()
+
+	return pc.LocalAddr().String(), &tcpQueries, func() { pc.Close(); ln.Close() }
+}
+
+func TestDNSQuery(t *testing.T) {
+	for _, truncate := range []bool{false, true} {
+		resolver, tcpQueries, stop := startResolver(t, truncate)
+		defer stop()
+		n := NetUtil{Next: &mwtest.Handler{}, DNSQuery: "/dns-query", Resolver: resolver, Timeout: time.Second}
+
+		get := httptest.NewRequest("GET", "/dns-query?dns="+base64.RawURLEncoding.EncodeToString(query), nil)
+		post := httptest.NewRequest("POST", "/dns-query", bytes.NewReader(query))
+		post.Header.Set("Content-Type", "application/dns-message")
+
+		for i, r := range []*http.Request{get, post} {
+			rec := mwtest.Serve(n, r)
+			rec.AssertStatus(t, http.StatusOK)
+			rec.AssertHeader(t, "Content-Type", "application/dns-message")
+			rec.AssertHeader(t, "Cache-Control", "") // the answer has no records
+			if expected := answer(query, false); !bytes.Equal(rec.Body.Bytes(), expected) {
+				t.Errorf("Test %d (truncate=%v): Expected answer %v, got %v", i, truncate, expected, rec.Body.Bytes())
+			}
+		}
+		if n := atomic.LoadInt32(tcpQueries); truncate && n != 2 {
+			t.Errorf("Expected truncated answers to be retried over TCP, got %d TCP queries", n)
+		}
+	}
+
+	n := NetUtil{Next: &mwtest.Handler{}, DNSQuery: "/dns-query", Resolver: "127.0.0.1:1", Timeout: 100 * time.Millisecond}
+	for _, test := range []struct {
+		method, url, contentType string
+		body                     []byte
+		expectedStatus           int
+	}{
+		{"GET", "/dns-query?dns=!!!", "", nil, http.StatusBadRequest},
+		{"GET", "/dns-query?dns=AAAA", "", nil, http.StatusBadRequest},
+		{"POST", "/dns-query", "text/plain", query, http.StatusUnsupportedMediaType},
+		{"PUT", "/dns-query", "", nil, http.StatusMethodNotAllowed},
+	} {
+		r := httptest.NewRequest(test.method, test.url, bytes.NewReader(test.body))
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		mwtest.Serve(n, r).AssertStatus(t, test.expectedStatus)
+	}
+}
+
+func TestMinTTL(t *testing.T) {
+	rr := func(name []byte, rrType uint16, ttl uint32, rdata ...byte) []byte {
+		b := append([]byte(nil), name...)
+		var fixed [10]byte
+		binary.BigEndian.PutUint16(fixed[0:], rrType)
+		binary.BigEndian.PutUint16(fixed[2:], 1)
+		binary.BigEndian.PutUint32(fixed[4:], ttl)
+		binary.BigEndian.PutUint16(fixed[8:], uint16(len(rdata)))
+		return append(append(b, fixed[:]...), rdata...)
+	}
+	pointer := []byte{0xC0, 12} // to the name of the question
+
+	msg := answer(query, false)
+	msg[7], msg[11] = 2, 1 // two answers and one additional record
+	msg = append(msg, rr(pointer, 1, 300, 93, 184, 216, 34)...)
+	msg = append(msg, rr(query[12:25], 1, 60, 93, 184, 216, 35)...)
+	msg = append(msg, rr([]byte{0}, 41, 0x8000, nil...)...) // OPT, whose TTL holds flags
+
+	for i, test := range []struct {
+		msg      []byte
+		expected uint32
+		ok       bool
+	}{
+		{msg, 60, true},
+		{answer(query, false), 0, false},
+		{msg[:len(msg)-3], 0, false},
+		{msg[:8], 0, false},
+	} {
+		ttl, ok := minTTL(test.msg)
+		if ttl != test.expected || ok != test.ok {
+			t.Errorf("Test %d: Expected %d, %v; got %d, %v", i, test.expected, test.ok, ttl, ok)
+		}
+	}
+}
+
+func TestEcho(t *testing.T) {
+	n := NetUtil{Next: &mwtest.Handler{Body: "next"}, IP: "/ip", Time: "/time"}
+
+	r := httptest.NewRequest("GET", "/ip", nil)
+	r.RemoteAddr = "192.0.2.7:4321"
+	rec := mwtest.Serve(n, r)
+	rec.AssertStatus(t, http.StatusOK)
+	rec.AssertBody(t, "192.0.2.7\n")
+	rec.AssertHeader(t, "Cache-Control", "no-store")
+
+	r.Header.Set("Accept", "application/json")
+	rec = mwtest.Serve(n, r)
+	var ip struct{ IP string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &ip); err != nil || ip.IP != "192.0.2.7" {
+		t.Errorf("Expected the IP as JSON, got %q (%v)", rec.Body.String(), err)
+	}
+
+	rec = mwtest.Serve(n, httptest.NewRequest("GET", "/time", nil))
+	rec.AssertStatus(t, http.StatusOK)
+	if _, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(rec.Body.String())); err != nil {
+		t.Errorf("Expected the time, got %q (%v)", rec.Body.String(), err)
+	}
+
+	mwtest.Serve(n, httptest.NewRequest("POST", "/time", nil)).AssertStatus(t, http.StatusMethodNotAllowed)
+	mwtest.Serve(n, httptest.NewRequest("GET", "/other", nil)).AssertBody(t, "next")
+}
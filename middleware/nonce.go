@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"sync"
+)
+
+// CSPNoncePlaceholder is replaced by the request's CSP nonce
+// in the values of headers set by the header directive, as in
+//
+//	header / Content-Security-Policy "script-src 'nonce-{csp_nonce}'"
+const CSPNoncePlaceholder = "{csp_nonce}"
+
+type cspNonceKey struct{}
+
+// cspNonce holds a request's nonce once it is made.
+type cspNonce struct {
+	once  sync.Once
+	value string
+}
+
+// WithCSPNonce returns r with a place in its context to keep the
+// nonce made by CSPNonce, so that every handler that r is passed
+// on to gets the same one. If r already has one, r is returned.
+func WithCSPNonce(r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(cspNonceKey{}).(*cspNonce); ok {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), cspNonceKey{}, new(cspNonce)))
+}
+
+// CSPNonce returns the nonce for r, for allowing inline scripts
+// and styles with a strict Content-Security-Policy. It is made
+// the first time it is asked for. If r wasn't prepared by
+// WithCSPNonce, a new nonce is returned every time.
+func CSPNonce(r *http.Request) string {
+	n, ok := r.Context().Value(cspNonceKey{}).(*cspNonce)
+	if !ok {
+		return newCSPNonce()
+	}
+	n.once.Do(func() { n.value = newCSPNonce() })
+	return n.value
+}
+
+// newCSPNonce returns 128 random bits, base64-encoded.
+func newCSPNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // no randomness; a guessable nonce is worse than none
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+)
+
+func TestCSPNonce(t *testing.T) {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if CSPNonce(r) == CSPNonce(r) {
+		t.Error("Expected a new nonce each time without WithCSPNonce")
+	}
+
+	r = WithCSPNonce(r)
+	nonce := CSPNonce(r)
+	if b, err := base64.StdEncoding.DecodeString(nonce); err != nil || len(b) != 16 {
+		t.Errorf("Expected 16 base64-encoded bytes, got %q (error: %v)", nonce, err)
+	}
+	if again := CSPNonce(WithCSPNonce(r)); again != nonce {
+		t.Errorf("Expected the same nonce %q for the request, got %q", nonce, again)
+	}
+
+	other := WithCSPNonce(r.WithContext(r.Context()))
+	if CSPNonce(other) != nonce {
+		t.Error("Expected a request derived from r to share its nonce")
+	}
+}
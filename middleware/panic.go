@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// Panics counts, by site address, how many times a handler
+// panicked while serving a request. It is published with the
+// expvar package as "panics".
+var Panics = expvar.NewMap("panics")
+
+// PanicPolicy is what is done when a handler panics while serving
+// a request. It implements flag.Value, so it can be set from the
+// command line.
+type PanicPolicy int
+
+const (
+	// PanicRecover responds with 500 Internal Server Error
+	// and keeps serving; this is the default.
+	PanicRecover PanicPolicy = iota
+
+	// PanicAbort aborts the connection without a response.
+	PanicAbort
+
+	// PanicExit exits the process, for operators who would
+	// rather crash than go on in an unknown state.
+	PanicExit
+)
+
+var panicPolicyNames = []string{"recover", "abort", "exit"}
+
+// ParsePanicPolicy returns the policy called name.
+func ParsePanicPolicy(name string) (PanicPolicy, error) {
+	for i, n := range panicPolicyNames {
+		if n == name {
+			return PanicPolicy(i), nil
+		}
+	}
+	return PanicRecover, fmt.Errorf("unknown panic policy '%s'; expected recover, abort or exit", name)
+}
+
+// String returns the name of p.
+func (p PanicPolicy) String() string {
+	if p < 0 || int(p) >= len(panicPolicyNames) {
+		return fmt.Sprintf("PanicPolicy(%d)", int(p))
+	}
+	return panicPolicyNames[p]
+}
+
+// Set sets p to the policy called name.
+func (p *PanicPolicy) Set(name string) error {
+	policy, err := ParsePanicPolicy(name)
+	if err != nil {
+		return err
+	}
+	*p = policy
+	return nil
+}
+
+// Handle counts a panic recovered while serving a request for site
+// and carries out p; the panic should already have been logged. It
+// only returns for PanicRecover, in which case the caller should go
+// on to respond with a 500 error. PanicAbort panics again with
+// http.ErrAbortHandler, which makes the http package close the
+// connection quietly.
+func (p PanicPolicy) Handle(site string) {
+	Panics.Add(site, 1)
+	switch p {
+	case PanicAbort:
+		panic(http.ErrAbortHandler)
+	case PanicExit:
+		os.Exit(2)
+	}
+}
@@ -1,6 +1,12 @@
 package middleware
 
-import "strings"
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
 
 // Path represents a URI path, maybe with pattern characters.
 type Path string
@@ -13,3 +19,71 @@ type Path string
 func (p Path) Matches(other string) bool {
 	return strings.HasPrefix(string(p), other)
 }
+
+// HiddenPath returns true if the clean path p, or a directory it is
+// in, matches one of patterns, as in path.Match. A pattern that starts
+// with "/" is matched against the whole path of p and of each of its
+// directories; others against each element of p. Matching ignores
+// case, since the file system may.
+func HiddenPath(patterns []string, p string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	p = strings.ToLower(p)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, "/") {
+			for dir := p; dir != "/" && dir != "."; dir = path.Dir(dir) {
+				if ok, _ := path.Match(pattern, dir); ok {
+					return true
+				}
+			}
+			continue
+		}
+		for _, elem := range strings.Split(p, "/") {
+			if ok, _ := path.Match(pattern, elem); ok && elem != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Scoped is implemented by handlers that only act on requests
+// whose path matches one of their scopes, passing all other
+// requests on to the next handler untouched. The server uses
+// it to send requests that none of a run of scoped handlers
+// care about straight to the file server.
+type Scoped interface {
+	// Scopes returns the paths this handler acts on.
+	Scopes() []string
+}
+
+// rawPathKey is the context key of requests whose URL.Path is
+// percent-encoded.
+type rawPathKey struct{}
+
+// WithRawPath returns a shallow copy of r marked as having a
+// URL.Path that is still percent-encoded, so that middleware
+// match the encoded path (see server.PathPolicy).
+func WithRawPath(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), rawPathKey{}, true))
+}
+
+// IsRawPath returns true if the URL.Path of r is percent-encoded.
+func IsRawPath(r *http.Request) bool {
+	raw, _ := r.Context().Value(rawPathKey{}).(bool)
+	return raw
+}
+
+// DecodedPath returns the path of r, decoded even if it is raw.
+func DecodedPath(r *http.Request) string {
+	if !IsRawPath(r) {
+		return r.URL.Path
+	}
+	p, err := url.PathUnescape(r.URL.Path)
+	if err != nil {
+		return r.URL.Path
+	}
+	return p
+}
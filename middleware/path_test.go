@@ -0,0 +1,33 @@
+package middleware
+
+import "testing"
+
+func TestHiddenPath(t *testing.T) {
+	patterns := []string{".git", "*.bak", "/private/*", "/drafts"}
+	for i, test := range []struct {
+		path     string
+		expected bool
+	}{
+		{"/index.html", false},
+		{"/.git", true},
+		{"/.git/config", true},
+		{"/sub/.GIT/HEAD", true},
+		{"/notes.bak", true},
+		{"/sub/notes.BAK", true},
+		{"/private/key", true},
+		{"/private/sub/key", true},
+		{"/private", false},
+		{"/drafts", true},
+		{"/drafts/post.md", true},
+		{"/drafts2", false},
+		{"/sub/private/key", false},
+		{"/", false},
+	} {
+		if actual := HiddenPath(patterns, test.path); actual != test.expected {
+			t.Errorf("Test %d: Expected %s hidden to be %v, got %v", i, test.path, test.expected, actual)
+		}
+	}
+	if HiddenPath(nil, "/.git") {
+		t.Error("Expected nothing to be hidden without patterns")
+	}
+}
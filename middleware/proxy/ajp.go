@@ -0,0 +1,578 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AJPTransport is an http.RoundTripper that speaks the Apache JServ
+// Protocol version 1.3 (AJP13) to servlet containers such as Tomcat
+// and Jetty. Proxy to it with upstream addresses like
+// ajp://localhost:8009. The client's address and the TLS state of
+// its connection are passed along in the protocol's request fields,
+// so the container sees them as if it served the client itself.
+type AJPTransport struct {
+	// Secret is sent with every request when the container's
+	// connector requires one (Tomcat's "secret" attribute).
+	Secret string
+
+	// MaxIdleConns is the number of idle connections to keep per
+	// backend. If zero, DefaultMaxIdleAJPConns is used.
+	MaxIdleConns int
+
+	// DialTimeout is how long connecting to the container may
+	// take. If zero, DefaultAJPDialTimeout is used.
+	DialTimeout time.Duration
+
+	// Timeout is how long each read from or write to the
+	// container may take, so a stalled container doesn't tie
+	// up the request for good. If zero, DefaultAJPTimeout is
+	// used; if negative, there is no limit.
+	Timeout time.Duration
+
+	// MaxBufferedBody is how many bytes of a request body of
+	// unknown length may be read into memory to measure it.
+	// If zero, DefaultAJPMaxBufferedBody is used.
+	MaxBufferedBody int64
+
+	mu   sync.Mutex
+	idle map[string][]*ajpConn
+}
+
+// Defaults for AJPTransport.
+const (
+	DefaultMaxIdleAJPConns    = 2
+	DefaultAJPDialTimeout     = 10 * time.Second
+	DefaultAJPTimeout         = time.Minute
+	DefaultAJPMaxBufferedBody = 10 << 20 // 10MB
+)
+
+// ErrAJPBodyTooLarge is returned for a request body of unknown
+// length that is longer than the transport's MaxBufferedBody.
+var ErrAJPBodyTooLarge = errors.New("ajp: request body of unknown length is too large to forward")
+
+const (
+	ajpMaxPacketSize = 8192
+	ajpMaxChunkSize  = ajpMaxPacketSize - 6 // packet header and chunk length
+
+	// packet types
+	ajpForwardRequest = 2
+	ajpSendBodyChunk  = 3
+	ajpSendHeaders    = 4
+	ajpEndResponse    = 5
+	ajpGetBodyChunk   = 6
+
+	// request attributes
+	ajpAttrQueryString = 0x05
+	ajpAttrSSLCert     = 0x07
+	ajpAttrSSLCipher   = 0x08
+	ajpAttrReqAttr     = 0x0A
+	ajpAttrSecret      = 0x0C
+	ajpAttrMethod      = 0x0D
+	ajpAttrDone        = 0xFF
+)
+
+var ajpMethods = map[string]byte{
+	"OPTIONS": 1, "GET": 2, "HEAD": 3, "POST": 4, "PUT": 5, "DELETE": 6,
+	"TRACE": 7, "PROPFIND": 8, "PROPPATCH": 9, "MKCOL": 10, "COPY": 11,
+	"MOVE": 12, "LOCK": 13, "UNLOCK": 14, "ACL": 15, "REPORT": 16,
+	"VERSION-CONTROL": 17, "CHECKIN": 18, "CHECKOUT": 19, "UNCHECKOUT": 20,
+	"SEARCH": 21, "MKWORKSPACE": 22, "UPDATE": 23, "LABEL": 24, "MERGE": 25,
+	"BASELINE-CONTROL": 26, "MKACTIVITY": 27,
+}
+
+var ajpRequestHeaders = map[string]uint16{
+	"Accept": 0xA001, "Accept-Charset": 0xA002, "Accept-Encoding": 0xA003,
+	"Accept-Language": 0xA004, "Authorization": 0xA005, "Connection": 0xA006,
+	"Content-Type": 0xA007, "Content-Length": 0xA008, "Cookie": 0xA009,
+	"Cookie2": 0xA00A, "Host": 0xA00B, "Pragma": 0xA00C, "Referer": 0xA00D,
+	"User-Agent": 0xA00E,
+}
+
+var ajpResponseHeaders = map[uint16]string{
+	0xA001: "Content-Type", 0xA002: "Content-Language", 0xA003: "Content-Length",
+	0xA004: "Date", 0xA005: "Last-Modified", 0xA006: "Location",
+	0xA007: "Set-Cookie", 0xA008: "Set-Cookie2", 0xA009: "Servlet-Engine",
+	0xA00A: "Status", 0xA00B: "WWW-Authenticate",
+}
+
+var errAJPMalformed = errors.New("ajp: malformed packet from backend")
+
+// RoundTrip sends req to the servlet container at req.URL.Host.
+func (t *AJPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, length, err := ajpRequestBody(req, t.maxBufferedBody())
+	if err != nil {
+		return nil, err
+	}
+	forward, err := ajpForward(req, length, t.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := t.getConn(req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.roundTrip(req, forward, body, length)
+	if err != nil && c.reused && !c.received && body == nil {
+		// the container closed the idle connection; try a fresh one
+		c.conn.Close()
+		if c, err = t.dial(req.URL.Host); err != nil {
+			return nil, err
+		}
+		resp, err = c.roundTrip(req, forward, body, length)
+	}
+	if err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+	resp.Body = &ajpResponseBody{t: t, c: c, host: req.URL.Host}
+	return resp, nil
+}
+
+func (t *AJPTransport) dial(host string) (*ajpConn, error) {
+	dialTimeout := t.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = DefaultAJPDialTimeout
+	}
+	conn, err := net.DialTimeout("tcp", host, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	timeout := t.Timeout
+	if timeout == 0 {
+		timeout = DefaultAJPTimeout
+	}
+	return &ajpConn{conn: conn, rb: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+func (t *AJPTransport) maxBufferedBody() int64 {
+	if t.MaxBufferedBody == 0 {
+		return DefaultAJPMaxBufferedBody
+	}
+	return t.MaxBufferedBody
+}
+
+func (t *AJPTransport) getConn(host string) (*ajpConn, error) {
+	t.mu.Lock()
+	if conns := t.idle[host]; len(conns) > 0 {
+		c := conns[len(conns)-1]
+		t.idle[host] = conns[:len(conns)-1]
+		t.mu.Unlock()
+		c.reused = true
+		return c, nil
+	}
+	t.mu.Unlock()
+	return t.dial(host)
+}
+
+func (t *AJPTransport) putConn(host string, c *ajpConn) {
+	max := t.MaxIdleConns
+	if max == 0 {
+		max = DefaultMaxIdleAJPConns
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.idle == nil {
+		t.idle = make(map[string][]*ajpConn)
+	}
+	if len(t.idle[host]) >= max {
+		c.conn.Close()
+		return
+	}
+	t.idle[host] = append(t.idle[host], c)
+}
+
+// ajpRequestBody returns the body of req and its length. AJP
+// needs the length up front, so a body of unknown length is
+// read into memory to measure it, up to max bytes.
+func ajpRequestBody(req *http.Request, max int64) (io.Reader, int64, error) {
+	if req.Body == nil || req.ContentLength == 0 {
+		return nil, 0, nil
+	}
+	if req.ContentLength > 0 {
+		return req.Body, req.ContentLength, nil
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(req.Body, max+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if int64(len(b)) > max {
+		return nil, 0, ErrAJPBodyTooLarge
+	}
+	return bytes.NewReader(b), int64(len(b)), nil
+}
+
+// ajpForward encodes req as a forward request packet.
+func ajpForward(req *http.Request, length int64, secret string) ([]byte, error) {
+	var p ajpPacket
+	p.WriteByte(ajpForwardRequest)
+	method, ok := ajpMethods[req.Method]
+	if !ok {
+		method = 0xFF // sent as an attribute instead
+	}
+	p.WriteByte(method)
+	p.str(req.Proto)
+	p.str(req.URL.EscapedPath())
+
+	remoteAddr := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	p.str(remoteAddr)
+	p.str(remoteAddr) // remote host; lookups are disabled
+
+	serverName, serverPort := req.Host, ""
+	if host, port, err := net.SplitHostPort(req.Host); err == nil {
+		serverName, serverPort = host, port
+	}
+	port, err := strconv.Atoi(serverPort)
+	if err != nil {
+		port = 80
+		if req.TLS != nil {
+			port = 443
+		}
+	}
+	p.str(serverName)
+	p.int(port)
+	p.bool(req.TLS != nil)
+
+	header := make(http.Header)
+	copyHeader(header, req.Header)
+	header.Set("Host", req.Host)
+	if length > 0 {
+		header.Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+	var count int
+	for _, vals := range header {
+		count += len(vals)
+	}
+	p.int(count)
+	for name, vals := range header {
+		for _, val := range vals {
+			if code, ok := ajpRequestHeaders[name]; ok {
+				p.int(int(code))
+			} else {
+				p.str(name)
+			}
+			p.str(val)
+		}
+	}
+
+	if req.URL.RawQuery != "" {
+		p.WriteByte(ajpAttrQueryString)
+		p.str(req.URL.RawQuery)
+	}
+	if method == 0xFF {
+		p.WriteByte(ajpAttrMethod)
+		p.str(req.Method)
+	}
+	if secret != "" {
+		p.WriteByte(ajpAttrSecret)
+		p.str(secret)
+	}
+	if _, port, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		p.WriteByte(ajpAttrReqAttr)
+		p.str("AJP_REMOTE_PORT")
+		p.str(port)
+	}
+	if req.TLS != nil {
+		if name := tlsCipherSuiteName(req.TLS.CipherSuite); name != "" {
+			p.WriteByte(ajpAttrSSLCipher)
+			p.str(name)
+		}
+		if len(req.TLS.PeerCertificates) > 0 {
+			cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: req.TLS.PeerCertificates[0].Raw})
+			p.WriteByte(ajpAttrSSLCert)
+			p.str(string(cert))
+		}
+	}
+	p.WriteByte(ajpAttrDone)
+
+	if p.Len() > ajpMaxPacketSize-4 {
+		return nil, errors.New("ajp: request headers are too large")
+	}
+	return p.packet(), nil
+}
+
+// ajpConn is a connection to a servlet container.
+type ajpConn struct {
+	conn     net.Conn
+	rb       *bufio.Reader
+	body     io.Reader
+	bodyLeft int64
+	reused   bool // whether the connection was idle in the pool
+	received bool // whether anything was read for the current request
+	done     bool // whether the container ended the response
+	reuse    bool // whether the container allows reusing the connection
+
+	timeout time.Duration // for each read or write; no limit if negative
+}
+
+// write writes b to the container within the timeout.
+func (c *ajpConn) write(b []byte) error {
+	if c.timeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// roundTrip sends the forward request and the request body, and
+// reads the response up to the headers.
+func (c *ajpConn) roundTrip(req *http.Request, forward []byte, body io.Reader, length int64) (*http.Response, error) {
+	c.body, c.bodyLeft = body, length
+	c.received, c.done, c.reuse = false, false, false
+
+	if err := c.write(forward); err != nil {
+		return nil, err
+	}
+	if length > 0 {
+		// the first chunk of the body is sent without being asked for
+		if err := c.sendChunk(ajpMaxChunkSize); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		pkt, err := c.next()
+		if err != nil {
+			return nil, err
+		}
+		switch pkt[0] {
+		case ajpSendHeaders:
+			return ajpResponse(req, pkt[1:])
+		case ajpEndResponse:
+			return nil, errors.New("ajp: backend ended the response before sending headers")
+		}
+	}
+}
+
+// next reads the next packet for the current request, answering
+// requests for more of the request body along the way.
+func (c *ajpConn) next() ([]byte, error) {
+	for {
+		if c.timeout > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+		}
+		var head [4]byte
+		if _, err := io.ReadFull(c.rb, head[:]); err != nil {
+			return nil, err
+		}
+		c.received = true
+		if head[0] != 'A' || head[1] != 'B' {
+			return nil, errAJPMalformed
+		}
+		pkt := make([]byte, binary.BigEndian.Uint16(head[2:]))
+		if _, err := io.ReadFull(c.rb, pkt); err != nil {
+			return nil, err
+		}
+		if len(pkt) == 0 {
+			return nil, errAJPMalformed
+		}
+		if pkt[0] != ajpGetBodyChunk {
+			return pkt, nil
+		}
+		if len(pkt) < 3 {
+			return nil, errAJPMalformed
+		}
+		if err := c.sendChunk(int(binary.BigEndian.Uint16(pkt[1:]))); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sendChunk sends up to max bytes of the request body,
+// or an empty chunk if all of it was sent already.
+func (c *ajpConn) sendChunk(max int) error {
+	if max > ajpMaxChunkSize {
+		max = ajpMaxChunkSize
+	}
+	if int64(max) > c.bodyLeft {
+		max = int(c.bodyLeft)
+	}
+	buf := make([]byte, 6+max)
+	buf[0], buf[1] = 0x12, 0x34
+	binary.BigEndian.PutUint16(buf[2:], uint16(max+2))
+	binary.BigEndian.PutUint16(buf[4:], uint16(max))
+	if max > 0 {
+		if _, err := io.ReadFull(c.body, buf[6:]); err != nil {
+			return err
+		}
+		c.bodyLeft -= int64(max)
+	} else {
+		buf = buf[:4]
+		binary.BigEndian.PutUint16(buf[2:], 0)
+	}
+	return c.write(buf)
+}
+
+// ajpResponse decodes the payload of a send headers packet.
+func ajpResponse(req *http.Request, data []byte) (*http.Response, error) {
+	r := ajpReader{data: data}
+	resp := &http.Response{
+		StatusCode:    r.int(),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		ContentLength: -1,
+		Request:       req,
+	}
+	if resp.StatusCode < 100 || resp.StatusCode > 999 {
+		return nil, errAJPMalformed
+	}
+	resp.Status = strconv.Itoa(resp.StatusCode) + " " + r.str()
+	for n := r.int(); n > 0 && r.err == nil; n-- {
+		var name string
+		if len(r.data) > 0 && r.data[0] == 0xA0 {
+			name = ajpResponseHeaders[uint16(r.int())]
+		} else {
+			name = r.str()
+		}
+		value := r.str()
+		if name != "" {
+			resp.Header.Add(name, value)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if cl, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+		resp.ContentLength = cl
+	}
+	return resp, nil
+}
+
+// ajpResponseBody reads the body chunks of a response. When it is
+// closed, the connection is kept for reuse if the whole response
+// was read and the container allows it.
+type ajpResponseBody struct {
+	t    *AJPTransport
+	c    *ajpConn
+	host string
+	buf  []byte
+	err  error
+}
+
+func (b *ajpResponseBody) Read(p []byte) (int, error) {
+	for len(b.buf) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		if b.c.done {
+			return 0, io.EOF
+		}
+		pkt, err := b.c.next()
+		if err != nil {
+			b.err = err
+			continue
+		}
+		switch pkt[0] {
+		case ajpSendBodyChunk:
+			r := ajpReader{data: pkt[1:]}
+			n := r.int()
+			if r.err != nil || n > len(r.data) {
+				b.err = errAJPMalformed
+				continue
+			}
+			b.buf = r.data[:n]
+		case ajpEndResponse:
+			b.c.done = true
+			b.c.reuse = len(pkt) > 1 && pkt[1] == 1
+		}
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
+
+func (b *ajpResponseBody) Close() error {
+	if b.c.done && b.c.reuse && b.err == nil {
+		b.t.putConn(b.host, b.c)
+		return nil
+	}
+	return b.c.conn.Close()
+}
+
+// ajpPacket builds the payload of a packet to the container.
+type ajpPacket struct {
+	bytes.Buffer
+}
+
+func (p *ajpPacket) int(n int) {
+	p.WriteByte(byte(n >> 8))
+	p.WriteByte(byte(n))
+}
+
+func (p *ajpPacket) bool(b bool) {
+	if b {
+		p.WriteByte(1)
+	} else {
+		p.WriteByte(0)
+	}
+}
+
+func (p *ajpPacket) str(s string) {
+	p.int(len(s))
+	p.WriteString(s)
+	p.WriteByte(0)
+}
+
+// packet returns the payload with the packet header.
+func (p *ajpPacket) packet() []byte {
+	return append([]byte{0x12, 0x34, byte(p.Len() >> 8), byte(p.Len())}, p.Bytes()...)
+}
+
+// ajpReader decodes the payload of a packet from the container.
+// After the first error, reads return zero values and err is set.
+type ajpReader struct {
+	data []byte
+	err  error
+}
+
+func (r *ajpReader) int() int {
+	if r.err != nil || len(r.data) < 2 {
+		r.err = errAJPMalformed
+		return 0
+	}
+	n := int(binary.BigEndian.Uint16(r.data))
+	r.data = r.data[2:]
+	return n
+}
+
+func (r *ajpReader) str() string {
+	n := r.int()
+	if n == 0xFFFF {
+		return "" // null string
+	}
+	if r.err != nil || len(r.data) < n+1 {
+		r.err = errAJPMalformed
+		return ""
+	}
+	s := string(r.data[:n])
+	r.data = r.data[n+1:]
+	return s
+}
+
+// tlsCipherSuiteName returns the name of the TLS cipher suite
+// id in the form servlet containers expect, or "" if unknown.
+func tlsCipherSuiteName(id uint16) string {
+	name := tls.CipherSuiteName(id)
+	if strings.HasPrefix(name, "0x") {
+		return ""
+	}
+	return name
+}
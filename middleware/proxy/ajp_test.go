@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ajpForwarded is what a fake container read from a forward request.
+type ajpForwarded struct {
+	method     byte
+	uri        string
+	remoteAddr string
+	serverName string
+	isSSL      bool
+	headers    map[string]string
+	body       string
+}
+
+// readAJPPacket reads a packet sent to the container.
+func readAJPPacket(conn net.Conn) ([]byte, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return nil, err
+	}
+	pkt := make([]byte, binary.BigEndian.Uint16(head[2:]))
+	_, err := io.ReadFull(conn, pkt)
+	return pkt, err
+}
+
+// writeAJPPacket writes a packet from the container.
+func writeAJPPacket(conn net.Conn, payload []byte) {
+	conn.Write(append([]byte{'A', 'B', byte(len(payload) >> 8), byte(len(payload))}, payload...))
+}
+
+// serveAJP runs a fake servlet container that answers every request
+// with the body "Hello, AJP" and reports what it received on got.
+func serveAJP(t *testing.T, got chan<- ajpForwarded, accepted *int32) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(accepted, 1)
+			go func(conn net.Conn) {
+				defer conn.Close()
+				for {
+					pkt, err := readAJPPacket(conn)
+					if err != nil {
+						return
+					}
+					var f ajpForwarded
+					f.method = pkt[1]
+					r := ajpReader{data: pkt[2:]}
+					r.str() // protocol
+					f.uri = r.str()
+					f.remoteAddr = r.str()
+					r.str() // remote host
+					f.serverName = r.str()
+					r.int() // server port
+					f.isSSL = r.data[0] == 1
+					r.data = r.data[1:]
+					f.headers = make(map[string]string)
+					for n := r.int(); n > 0; n-- {
+						var name string
+						if r.data[0] == 0xA0 {
+							for k, code := range ajpRequestHeaders {
+								if int(code) == int(binary.BigEndian.Uint16(r.data)) {
+									name = k
+								}
+							}
+							r.int()
+						} else {
+							name = r.str()
+						}
+						f.headers[name] = r.str()
+					}
+					if f.headers["Content-Length"] != "" {
+						chunk, _ := readAJPPacket(conn)
+						f.body = string(chunk[2:])
+					}
+					got <- f
+
+					writeAJPPacket(conn, []byte{ajpSendHeaders,
+						0, 200, 0, 2, 'O', 'K', 0,
+						0, 1, 0xA0, 0x01, 0, 10, 't', 'e', 'x', 't', '/', 'p', 'l', 'a', 'i', 'n', 0})
+					body := "Hello, AJP"
+					writeAJPPacket(conn, append(append([]byte{ajpSendBodyChunk, 0, byte(len(body))}, body...), 0))
+					writeAJPPacket(conn, []byte{ajpEndResponse, 1})
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestAJPTransport(t *testing.T) {
+	got := make(chan ajpForwarded, 3)
+	var accepted int32
+	addr := serveAJP(t, got, &accepted)
+
+	target, _ := url.Parse("ajp://" + addr)
+	p := NewSingleHostReverseProxy(target, "")
+	p.Transport = &AJPTransport{}
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "http://example.com/app/index.jsp", nil)
+		req.RemoteAddr = "10.0.0.1:54321"
+		req.TLS = &tls.ConnectionState{}
+		req.Header.Set("User-Agent", "test")
+		req.Header.Set("X-Custom", "value")
+		rec := httptest.NewRecorder()
+
+		if err := p.ServeHTTP(rec, req, nil); err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		f := <-got
+		if f.method != 2 {
+			t.Errorf("Test %d: Expected method code 2 (GET), got %d", i, f.method)
+		}
+		if f.uri != "/app/index.jsp" {
+			t.Errorf("Test %d: Expected URI /app/index.jsp, got '%s'", i, f.uri)
+		}
+		if f.remoteAddr != "10.0.0.1" {
+			t.Errorf("Test %d: Expected remote address 10.0.0.1, got '%s'", i, f.remoteAddr)
+		}
+		if !f.isSSL {
+			t.Errorf("Test %d: Expected is_ssl to be set", i)
+		}
+		if f.headers["User-Agent"] != "test" || f.headers["X-Custom"] != "value" {
+			t.Errorf("Test %d: Expected request headers to be forwarded, got %v", i, f.headers)
+		}
+		if rec.Code != http.StatusOK {
+			t.Errorf("Test %d: Expected status %d, got %d", i, http.StatusOK, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "text/plain" {
+			t.Errorf("Test %d: Expected Content-Type text/plain, got '%s'", i, ct)
+		}
+		if rec.Body.String() != "Hello, AJP" {
+			t.Errorf("Test %d: Expected body 'Hello, AJP', got '%s'", i, rec.Body.String())
+		}
+	}
+
+	if n := atomic.LoadInt32(&accepted); n != 1 {
+		t.Errorf("Expected the connection to be reused, but %d were made", n)
+	}
+}
+
+func TestAJPTransportBody(t *testing.T) {
+	got := make(chan ajpForwarded, 1)
+	var accepted int32
+	addr := serveAJP(t, got, &accepted)
+
+	req, _ := http.NewRequest("POST", "ajp://"+addr+"/form", strings.NewReader("name=caddy"))
+	resp, err := (&AJPTransport{}).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	f := <-got
+	if f.method != 4 {
+		t.Errorf("Expected method code 4 (POST), got %d", f.method)
+	}
+	if f.body != "name=caddy" {
+		t.Errorf("Expected request body 'name=caddy', got '%s'", f.body)
+	}
+	if string(body) != "Hello, AJP" {
+		t.Errorf("Expected response body 'Hello, AJP', got '%s'", body)
+	}
+}
+
+func TestAJPTransportTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(ioutil.Discard, conn) // never answers
+	}()
+
+	req, _ := http.NewRequest("GET", "ajp://"+ln.Addr().String()+"/slow", nil)
+	_, err = (&AJPTransport{Timeout: 50 * time.Millisecond}).RoundTrip(req)
+	if !isTimeout(err) {
+		t.Errorf("Expected a timeout from a stalled container, got: %v", err)
+	}
+}
+
+func TestAJPTransportBodyTooLarge(t *testing.T) {
+	req, _ := http.NewRequest("POST", "ajp://127.0.0.1:1/form", ioutil.NopCloser(strings.NewReader("too long")))
+	req.ContentLength = -1
+	if _, err := (&AJPTransport{MaxBufferedBody: 4}).RoundTrip(req); err != ErrAJPBodyTooLarge {
+		t.Errorf("Expected ErrAJPBodyTooLarge, got: %v", err)
+	}
+}
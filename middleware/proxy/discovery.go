@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDiscoverInterval is how often upstream hosts are
+// rediscovered if no interval is configured.
+const DefaultDiscoverInterval = 30 * time.Second
+
+// DefaultDiscoverTimeout is how long a discoverer may take to
+// find the hosts if it has no timeout of its own.
+const DefaultDiscoverTimeout = 10 * time.Second
+
+// Discoverer finds the current hosts of an upstream, so that the
+// pool can follow dynamic infrastructure. Addresses are in the same
+// form as hosts in the proxy directive.
+type Discoverer interface {
+	Discover() ([]string, error)
+}
+
+// SRVDiscoverer finds hosts by looking up DNS SRV records, such as
+// those published by Consul or for Kubernetes headless services.
+type SRVDiscoverer struct {
+	// The full SRV name to look up, like _http._tcp.api.service.consul
+	Name string
+
+	// The scheme to use for the hosts found, http or https
+	Scheme string
+
+	// How long the lookup may take; DefaultDiscoverTimeout if 0
+	Timeout time.Duration
+}
+
+// Discover returns the targets of the SRV records, in the
+// order of their priority.
+func (d SRVDiscoverer) Discover() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), discoverTimeout(d.Timeout))
+	defer cancel()
+	_, addrs, err := net.DefaultResolver.LookupSRV(ctx, "", "", d.Name)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]string, len(addrs))
+	for i, addr := range addrs {
+		target := strings.TrimSuffix(addr.Target, ".")
+		hosts[i] = d.Scheme + "://" + net.JoinHostPort(target, strconv.Itoa(int(addr.Port)))
+	}
+	return hosts, nil
+}
+
+// ListDiscoverer finds hosts by reading a JSON array of addresses
+// from a file or from a URL, which is fetched with a GET request.
+type ListDiscoverer struct {
+	Source string
+
+	// How long fetching Source may take; DefaultDiscoverTimeout if 0
+	Timeout time.Duration
+}
+
+// Discover reads and returns the list of addresses.
+func (d ListDiscoverer) Discover() ([]string, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(d.Source, "http://") || strings.HasPrefix(d.Source, "https://") {
+		var resp *http.Response
+		client := &http.Client{Timeout: discoverTimeout(d.Timeout)}
+		resp, err = client.Get(d.Source)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s: unexpected status %s", d.Source, resp.Status)
+		}
+		data, err = ioutil.ReadAll(resp.Body)
+	} else {
+		data, err = ioutil.ReadFile(d.Source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	if err := json.Unmarshal(data, &hosts); err != nil {
+		return nil, fmt.Errorf("%s: %v", d.Source, err)
+	}
+	return hosts, nil
+}
+
+func discoverTimeout(timeout time.Duration) time.Duration {
+	if timeout == 0 {
+		return DefaultDiscoverTimeout
+	}
+	return timeout
+}
+
+// srvDiscoverer returns a discoverer for host if it is an
+// SRV name: srv://name for HTTP or srv+https://name for HTTPS.
+func srvDiscoverer(host string) (Discoverer, bool) {
+	switch {
+	case strings.HasPrefix(host, "srv://"):
+		return SRVDiscoverer{Name: host[len("srv://"):], Scheme: "http"}, true
+	case strings.HasPrefix(host, "srv+https://"):
+		return SRVDiscoverer{Name: host[len("srv+https://"):], Scheme: "https"}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Downstream describes changes to make to the headers of responses
+// from an upstream before they are passed on to the client. These
+// are needed to proxy applications that don't know where they are
+// being served from, for example, under a sub-path.
+type Downstream struct {
+	// Headers to set on the response. A name prefixed with
+	// "-" removes that header instead.
+	Headers http.Header
+
+	// Prefixes to replace in the Location and
+	// Content-Location headers of redirects.
+	Location []Rewrite
+
+	// Domains and path prefixes to replace in the
+	// attributes of cookies set by the upstream.
+	CookieDomain []Rewrite
+	CookiePath   []Rewrite
+
+	// Whether to mark cookies Secure, so that an upstream that
+	// is spoken to over plain HTTP can be exposed over HTTPS.
+	CookieSecure bool
+
+	// SameSite attribute to give cookies (Strict, Lax or None),
+	// replacing the upstream's; cookies are left as they are if
+	// empty. SameSite=None cookies must be Secure, so they are
+	// marked as such too.
+	CookieSameSite string
+
+	// Prefix is the path the upstream is mounted under, when
+	// requests are forwarded without it. It is added to redirects
+	// to the upstream's own paths and to the paths of its cookies,
+	// unless one of the rewrites above applied.
+	Prefix string
+}
+
+// Rewrite replaces From with To.
+type Rewrite struct {
+	From, To string
+}
+
+// empty returns true if d does not change anything.
+func (d Downstream) empty() bool {
+	return len(d.Headers) == 0 && len(d.Location) == 0 &&
+		len(d.CookieDomain) == 0 && len(d.CookiePath) == 0 &&
+		!d.CookieSecure && d.CookieSameSite == "" && d.Prefix == ""
+}
+
+// Apply makes the changes described by d to the headers of res.
+func (d Downstream) Apply(res *http.Response) {
+	for name, vals := range d.Headers {
+		if strings.HasPrefix(name, "-") {
+			res.Header.Del(strings.TrimPrefix(name, "-"))
+		} else {
+			res.Header[name] = vals
+		}
+	}
+
+	for _, name := range []string{"Location", "Content-Location"} {
+		if loc := res.Header.Get(name); loc != "" {
+			res.Header.Set(name, d.rewriteLocation(res, loc))
+		}
+	}
+
+	if len(d.CookieDomain) > 0 || len(d.CookiePath) > 0 || d.Prefix != "" ||
+		d.CookieSecure || d.CookieSameSite != "" {
+		cookies := res.Header["Set-Cookie"]
+		for i, cookie := range cookies {
+			cookies[i] = d.rewriteCookie(cookie)
+		}
+	}
+}
+
+// rewriteCookie rewrites the Domain, Path, Secure and SameSite
+// attributes of cookie, which is the value of a Set-Cookie header.
+func (d Downstream) rewriteCookie(cookie string) string {
+	secure := d.CookieSecure || strings.EqualFold(d.CookieSameSite, "None")
+	sameSite := d.CookieSameSite
+
+	parts := strings.Split(cookie, ";")
+	for i, part := range parts {
+		attr := strings.TrimSpace(part)
+		if i > 0 && strings.EqualFold(attr, "secure") {
+			secure = false // already is
+			continue
+		}
+		eq := strings.Index(attr, "=")
+		if eq < 0 || i == 0 {
+			continue
+		}
+		name, val := attr[:eq], attr[eq+1:]
+		switch strings.ToLower(name) {
+		case "samesite":
+			if sameSite != "" {
+				parts[i] = " " + name + "=" + sameSite
+				sameSite = ""
+			}
+		case "domain":
+			for _, rw := range d.CookieDomain {
+				if strings.EqualFold(strings.TrimPrefix(val, "."), strings.TrimPrefix(rw.From, ".")) {
+					parts[i] = " " + name + "=" + rw.To
+					break
+				}
+			}
+		case "path":
+			path := replacePrefix(val, d.CookiePath)
+			if path == val && d.Prefix != "" && strings.HasPrefix(val, "/") {
+				path = singleJoiningSlash(d.Prefix, val)
+			}
+			if path != val {
+				parts[i] = " " + name + "=" + path
+			}
+		}
+	}
+	if sameSite != "" {
+		parts = append(parts, " SameSite="+sameSite)
+	}
+	if secure {
+		parts = append(parts, " Secure")
+	}
+	return strings.Join(parts, ";")
+}
+
+// rewriteLocation rewrites loc, the value of the Location or
+// Content-Location header of res.
+func (d Downstream) rewriteLocation(res *http.Response, loc string) string {
+	if rewritten := replacePrefix(loc, d.Location); rewritten != loc || d.Prefix == "" {
+		return rewritten
+	}
+
+	u, err := url.Parse(loc)
+	if err != nil {
+		return loc
+	}
+	if u.Host == "" && strings.HasPrefix(loc, "/") {
+		// a path on the upstream
+		return singleJoiningSlash(d.Prefix, loc)
+	}
+	if res.Request != nil && res.Request.URL != nil && u.Host == res.Request.URL.Host {
+		// an absolute URL to the upstream itself, which the client
+		// can't reach; send it to the same path under the prefix
+		return singleJoiningSlash(d.Prefix, u.RequestURI())
+	}
+	return loc
+}
+
+// replacePrefix replaces the prefix of s using
+// the first rewrite in rewrites that matches.
+func replacePrefix(s string, rewrites []Rewrite) string {
+	for _, rw := range rewrites {
+		if strings.HasPrefix(s, rw.From) {
+			return rw.To + strings.TrimPrefix(s, rw.From)
+		}
+	}
+	return s
+}
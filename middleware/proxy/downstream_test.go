@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/config/parse"
+)
+
+func TestDownstreamApply(t *testing.T) {
+	d := Downstream{
+		Headers: http.Header{
+			"-Server":   nil,
+			"X-Proxied": {"yes"},
+		},
+		Location:     []Rewrite{{"http://backend:8080/", "/app/"}},
+		CookieDomain: []Rewrite{{"backend", "example.com"}},
+		CookiePath:   []Rewrite{{"/", "/app/"}},
+	}
+
+	for i, test := range []struct {
+		header   http.Header
+		expected http.Header
+	}{
+		{
+			http.Header{"Server": {"Jetty"}, "Content-Type": {"text/html"}},
+			http.Header{"X-Proxied": {"yes"}, "Content-Type": {"text/html"}},
+		},
+		{
+			http.Header{"Location": {"http://backend:8080/login?next=/"}},
+			http.Header{"X-Proxied": {"yes"}, "Location": {"/app/login?next=/"}},
+		},
+		{
+			http.Header{"Location": {"http://elsewhere.com/"}},
+			http.Header{"X-Proxied": {"yes"}, "Location": {"http://elsewhere.com/"}},
+		},
+		{
+			http.Header{"Set-Cookie": {
+				"session=abc; Path=/; Domain=.backend; HttpOnly",
+				"lang=en; path=/static",
+				"other=1; Domain=other.org",
+			}},
+			http.Header{"X-Proxied": {"yes"}, "Set-Cookie": {
+				"session=abc; Path=/app/; Domain=example.com; HttpOnly",
+				"lang=en; path=/app/static",
+				"other=1; Domain=other.org",
+			}},
+		},
+	} {
+		res := &http.Response{Header: test.header}
+		d.Apply(res)
+		if !reflect.DeepEqual(res.Header, test.expected) {
+			t.Errorf("Test %d: Expected headers %v, got %v", i, test.expected, res.Header)
+		}
+	}
+}
+
+func TestDownstreamCookieAttributes(t *testing.T) {
+	for i, test := range []struct {
+		d        Downstream
+		cookie   string
+		expected string
+	}{
+		{Downstream{CookieSecure: true}, "session=abc; Path=/", "session=abc; Path=/; Secure"},
+		{Downstream{CookieSecure: true}, "session=abc; secure; HttpOnly", "session=abc; secure; HttpOnly"},
+		{Downstream{CookieSameSite: "Lax"}, "session=abc; Path=/", "session=abc; Path=/; SameSite=Lax"},
+		{Downstream{CookieSameSite: "Strict"}, "session=abc; samesite=None; Secure", "session=abc; samesite=Strict; Secure"},
+		{Downstream{CookieSameSite: "None"}, "session=abc", "session=abc; SameSite=None; Secure"},
+		{Downstream{CookieSecure: true, CookieSameSite: "Lax"}, "secure=1", "secure=1; SameSite=Lax; Secure"},
+	} {
+		res := &http.Response{Header: http.Header{"Set-Cookie": {test.cookie}}}
+		test.d.Apply(res)
+		if actual := res.Header.Get("Set-Cookie"); actual != test.expected {
+			t.Errorf("Test %d: Expected cookie %q, got %q", i, test.expected, actual)
+		}
+	}
+}
+
+func TestDownstreamParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+		expected  Downstream
+	}{
+		{`proxy / localhost:8080`, false, Downstream{}},
+		{`proxy / localhost:8080 {
+			header_downstream -Server
+			header_downstream X-Frame-Options DENY
+			rewrite_location http://localhost:8080/ /
+			rewrite_cookie_domain localhost example.com
+			rewrite_cookie_path / /app/
+		}`, false, Downstream{
+			Headers:      http.Header{"-Server": nil, "X-Frame-Options": {"DENY"}},
+			Location:     []Rewrite{{"http://localhost:8080/", "/"}},
+			CookieDomain: []Rewrite{{"localhost", "example.com"}},
+			CookiePath:   []Rewrite{{"/", "/app/"}},
+		}},
+		{`proxy / localhost:8080 {
+			cookie_secure
+			cookie_samesite lax
+		}`, false, Downstream{CookieSecure: true, CookieSameSite: "Lax"}},
+		{`proxy / localhost:8080 {
+			header_downstream X-Frame-Options
+		}`, true, Downstream{}},
+		{`proxy / localhost:8080 {
+			cookie_secure on
+		}`, true, Downstream{}},
+		{`proxy / localhost:8080 {
+			cookie_samesite
+		}`, true, Downstream{}},
+		{`proxy / localhost:8080 {
+			cookie_samesite always
+		}`, true, Downstream{}},
+		{`proxy / localhost:8080 {
+			header_downstream -Server value
+		}`, true, Downstream{}},
+		{`proxy / localhost:8080 {
+			rewrite_location /
+		}`, true, Downstream{}},
+	} {
+		upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile", strings.NewReader(test.input)))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+		upstream := upstreams[0].(*staticUpstream)
+		if test.expected.empty() {
+			if !upstream.Downstream.empty() {
+				t.Errorf("Test %d: Expected no downstream changes, got %#v", i, upstream.Downstream)
+			}
+			if upstream.Hosts[0].ReverseProxy.ModifyResponse != nil {
+				t.Errorf("Test %d: Expected no ModifyResponse func", i)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(upstream.Downstream, test.expected) {
+			t.Errorf("Test %d: Expected %#v, got %#v", i, test.expected, upstream.Downstream)
+		}
+		if upstream.Hosts[0].ReverseProxy.ModifyResponse == nil {
+			t.Errorf("Test %d: Expected ModifyResponse func to be set", i)
+		}
+	}
+}
+
+func TestDownstreamPrefix(t *testing.T) {
+	d := Downstream{
+		Location: []Rewrite{{"/static/", "https://cdn.example.com/"}},
+		Prefix:   "/app",
+	}
+	backendReq, _ := http.NewRequest("GET", "http://backend:8080/login", nil)
+
+	for i, test := range []struct {
+		header   http.Header
+		expected http.Header
+	}{
+		{
+			http.Header{"Location": {"/login?next=/home"}},
+			http.Header{"Location": {"/app/login?next=/home"}},
+		},
+		{
+			http.Header{"Location": {"http://backend:8080/home"}},
+			http.Header{"Location": {"/app/home"}},
+		},
+		{
+			http.Header{"Location": {"http://example.org/"}},
+			http.Header{"Location": {"http://example.org/"}},
+		},
+		{
+			http.Header{"Location": {"//example.org/"}},
+			http.Header{"Location": {"//example.org/"}},
+		},
+		{
+			// explicit rewrites take precedence
+			http.Header{"Location": {"/static/logo.png"}},
+			http.Header{"Location": {"https://cdn.example.com/logo.png"}},
+		},
+		{
+			http.Header{"Set-Cookie": {"session=abc; Path=/; HttpOnly", "pref=1; Path=/settings"}},
+			http.Header{"Set-Cookie": {"session=abc; Path=/app/; HttpOnly", "pref=1; Path=/app/settings"}},
+		},
+	} {
+		res := &http.Response{Header: test.header, Request: backendReq}
+		d.Apply(res)
+		if !reflect.DeepEqual(res.Header, test.expected) {
+			t.Errorf("Test %d: Expected headers %v, got %v", i, test.expected, res.Header)
+		}
+	}
+}
+
+func TestWithoutDirector(t *testing.T) {
+	for i, test := range []struct {
+		target, without, path, expected string
+	}{
+		{"http://backend", "/app", "/app/login", "/login"},
+		{"http://backend", "/app", "/app", "/"},
+		{"http://backend/base", "/app", "/app/login", "/base/login"},
+		{"http://backend", "", "/app/login", "/app/login"},
+	} {
+		target, _ := url.Parse(test.target)
+		req, _ := http.NewRequest("GET", "http://example.com"+test.path, nil)
+		NewSingleHostReverseProxy(target, test.without).Director(req)
+		if req.URL.Path != test.expected {
+			t.Errorf("Test %d: Expected path %s, got %s", i, test.expected, req.URL.Path)
+		}
+	}
+}
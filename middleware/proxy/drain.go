@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mholt/caddy/admin"
+)
+
+// Draining hosts are considered down, so they get no new requests
+// while the requests they are already handling finish. The state is
+// kept by host name, so it outlasts configuration reloads and applies
+// to the host in every upstream that uses it.
+var (
+	draining   = make(map[string]bool)
+	drainingMu sync.RWMutex
+)
+
+// Drain stops new requests from being proxied to the host
+// called name until Enable is called for it.
+func Drain(name string) {
+	drainingMu.Lock()
+	draining[hostName(name)] = true
+	drainingMu.Unlock()
+}
+
+// Enable lets requests be proxied to the host called
+// name again after it was drained.
+func Enable(name string) {
+	drainingMu.Lock()
+	delete(draining, hostName(name))
+	drainingMu.Unlock()
+}
+
+// Draining returns true if the host called name is being drained.
+func Draining(name string) bool {
+	drainingMu.RLock()
+	defer drainingMu.RUnlock()
+	return draining[hostName(name)]
+}
+
+// hostName returns name the way it is written in UpstreamHost.Name.
+func hostName(name string) string {
+	if !strings.Contains(name, "://") {
+		return "http://" + name
+	}
+	return name
+}
+
+// The upstreams of each site, by the site's address and the path
+// each upstream proxies, so the admin API can report on them.
+var (
+	sites   = make(map[string]map[string]Upstream)
+	sitesMu sync.Mutex
+)
+
+// Register records the upstreams used by the site at the address
+// site (host:port), replacing any that were registered for the
+// same site and path before.
+func Register(site string, upstreams []Upstream) {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	if sites[site] == nil {
+		sites[site] = make(map[string]Upstream)
+	}
+	for _, u := range upstreams {
+		sites[site][u.From()] = u
+	}
+}
+
+// Reset forgets the upstreams of the site at the address site,
+// which is done before its configuration is loaded again.
+func Reset(site string) {
+	sitesMu.Lock()
+	delete(sites, site)
+	sitesMu.Unlock()
+}
+
+// UpstreamStatus describes a host of an upstream in the admin API.
+type UpstreamStatus struct {
+	Site      string `json:"site"`
+	From      string `json:"from"`
+	Host      string `json:"host"`
+	Conns     int64  `json:"conns"`
+	Fails     int32  `json:"fails"`
+	Unhealthy bool   `json:"unhealthy"`
+	Draining  bool   `json:"draining"`
+}
+
+// hostStatus returns the status of every registered upstream host,
+// or only of those called name if name isn't empty.
+func hostStatus(name string) []UpstreamStatus {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	var names []string
+	for site := range sites {
+		names = append(names, site)
+	}
+	sort.Strings(names)
+
+	statuses := []UpstreamStatus{}
+	for _, site := range names {
+		var paths []string
+		for from := range sites[site] {
+			paths = append(paths, from)
+		}
+		sort.Strings(paths)
+		for _, from := range paths {
+			su, ok := sites[site][from].(*staticUpstream)
+			if !ok {
+				continue
+			}
+			for _, host := range su.pool() {
+				if name != "" && host.Name != hostName(name) {
+					continue
+				}
+				statuses = append(statuses, UpstreamStatus{
+					Site:      site,
+					From:      su.From(),
+					Host:      host.Name,
+					Conns:     atomic.LoadInt64(&host.Conns),
+					Fails:     atomic.LoadInt32(&host.Fails),
+					Unhealthy: host.Unhealthy,
+					Draining:  Draining(host.Name),
+				})
+			}
+		}
+	}
+	return statuses
+}
+
+// Hosts returns the status of every registered upstream host.
+func Hosts() []UpstreamStatus {
+	return hostStatus("")
+}
+
+func init() {
+	admin.HandleFunc("/proxy/upstreams", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			admin.Error(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, hostStatus(r.URL.Query().Get("host")))
+	})
+
+	// POST /proxy/upstreams/drain?host=10.0.0.1:8080 drains the host;
+	// its conns go to zero once its in-flight requests are done.
+	// POST /proxy/upstreams/enable?host=10.0.0.1:8080 undoes that.
+	setDraining := func(drain bool) func(http.ResponseWriter, *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" {
+				admin.Error(w, http.StatusMethodNotAllowed, "use POST")
+				return
+			}
+			name := r.URL.Query().Get("host")
+			if name == "" {
+				admin.Error(w, http.StatusBadRequest, "missing host")
+				return
+			}
+			if drain {
+				Drain(name)
+			} else {
+				Enable(name)
+			}
+			admin.WriteJSON(w, http.StatusOK, hostStatus(name))
+		}
+	}
+	admin.HandleFunc("/proxy/upstreams/drain", setDraining(true))
+	admin.HandleFunc("/proxy/upstreams/enable", setDraining(false))
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/admin"
+)
+
+func TestDrain(t *testing.T) {
+	upstream := &staticUpstream{
+		from:        "/",
+		Hosts:       testPool()[2:],
+		Policy:      &Random{},
+		FailTimeout: 10 * time.Second,
+		MaxFails:    1,
+	}
+	upstream.Hosts = append(upstream.Hosts, &UpstreamHost{Name: "http://D"})
+	Register("drain.test:80", []Upstream{upstream})
+	defer Reset("drain.test:80")
+	defer Enable("C")
+
+	handler := admin.Handler()
+	post := func(path string) []UpstreamStatus {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, nil)
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: Expected status 200, got %d", path, rec.Code)
+		}
+		var statuses []UpstreamStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil {
+			t.Fatalf("%s: Expected JSON response, got error: %v", path, err)
+		}
+		return statuses
+	}
+
+	statuses := post("/proxy/upstreams/drain?host=C")
+	if len(statuses) != 1 || statuses[0].Host != "http://C" || !statuses[0].Draining {
+		t.Errorf("Expected http://C to be reported as draining, got %+v", statuses)
+	}
+	if !upstream.Hosts[0].Down() {
+		t.Error("Expected draining host to be down")
+	}
+	for i := 0; i < 10; i++ {
+		if h := upstream.Select(nil); h == nil || h.Name != "http://D" {
+			t.Fatalf("Expected only http://D to be selected, got %v", h)
+		}
+	}
+
+	statuses = post("/proxy/upstreams/enable?host=http://C")
+	if len(statuses) != 1 || statuses[0].Draining {
+		t.Errorf("Expected http://C to no longer be draining, got %+v", statuses)
+	}
+	if upstream.Hosts[0].Down() {
+		t.Error("Expected enabled host to be up")
+	}
+}
+
+func TestDrainRequests(t *testing.T) {
+	handler := admin.Handler()
+	tests := []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/proxy/upstreams", http.StatusOK},
+		{"POST", "/proxy/upstreams", http.StatusMethodNotAllowed},
+		{"GET", "/proxy/upstreams/drain?host=C", http.StatusMethodNotAllowed},
+		{"POST", "/proxy/upstreams/drain", http.StatusBadRequest},
+		{"POST", "/proxy/upstreams/enable", http.StatusBadRequest},
+	}
+	for i, test := range tests {
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest(test.method, test.path, nil)
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.status, rec.Code)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	upstream := func(from, host string) Upstream {
+		return &staticUpstream{from: from, Hosts: HostPool{&UpstreamHost{Name: host}}, Policy: &Random{}}
+	}
+	Register("register.test:80", []Upstream{upstream("/api", "http://api"), upstream("/web", "http://web")})
+	Register("register.test:8080", []Upstream{upstream("/api", "http://other")})
+	defer Reset("register.test:80")
+	defer Reset("register.test:8080")
+
+	var got []string
+	for _, s := range Hosts() {
+		if strings.HasPrefix(s.Site, "register.test:") {
+			got = append(got, s.Site+s.From+" "+s.Host)
+		}
+	}
+	expected := []string{"register.test:80/api http://api", "register.test:80/web http://web", "register.test:8080/api http://other"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected upstreams %v, got %v", expected, got)
+	}
+
+	// registering a path again replaces only its upstream
+	Register("register.test:80", []Upstream{upstream("/api", "http://api2")})
+	if statuses := hostStatus("api2"); len(statuses) != 1 || statuses[0].From != "/api" {
+		t.Errorf("Expected http://api2 to be registered for /api, got %+v", statuses)
+	}
+	if statuses := hostStatus("web"); len(statuses) != 1 {
+		t.Errorf("Expected http://web to stay registered, got %+v", statuses)
+	}
+	if statuses := hostStatus("api"); len(statuses) != 0 {
+		t.Errorf("Expected http://api to be replaced, got %+v", statuses)
+	}
+}
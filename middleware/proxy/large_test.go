@@ -0,0 +1,52 @@
+//go:build largetests
+// +build largetests
+
+// The tests in this file move gigabytes of data, so they
+// only run with: go test -tags largetests
+
+package proxy
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/config/parse"
+)
+
+func TestProxyLargeRequestBody(t *testing.T) {
+	var received int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.Copy(ioutil.Discard, r.Body)
+	}))
+	defer backend.Close()
+
+	const size = 3 << 30
+	upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile", strings.NewReader("proxy / "+backend.URL)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	p := &Proxy{Upstreams: upstreams}
+	r, _ := http.NewRequest("PUT", "/upload", nil)
+	r.Body = &patternReader{n: size}
+	r.ContentLength = size
+
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if status, err := p.ServeHTTP(httptest.NewRecorder(), r); status != 0 || err != nil {
+		t.Fatalf("Expected status 0 and no error, got %d: %v", status, err)
+	}
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	if received != size {
+		t.Errorf("Expected backend to receive %d bytes, got %d", int64(size), received)
+	}
+	if grown := int64(after.HeapSys) - int64(before.HeapSys); grown > 256<<20 {
+		t.Errorf("Expected body to be streamed, but the heap grew by %d bytes", grown)
+	}
+}
@@ -1,29 +1,41 @@
 package proxy
 
 import (
+	"errors"
+	"hash/fnv"
 	"math/rand"
+	"net/http"
 	"sync/atomic"
 )
 
 // HostPool is a collection of UpstreamHosts.
 type HostPool []*UpstreamHost
 
-// Policy decides how a host will be selected from a pool.
+// Policy decides how a host will be selected from a pool. The request
+// being proxied is passed in, so a policy can pick a host based on it.
+// Custom policies are added with RegisterPolicy.
 type Policy interface {
-	Select(pool HostPool) *UpstreamHost
+	Select(pool HostPool, r *http.Request) *UpstreamHost
+}
+
+// PolicyConfigurer is implemented by policies that take arguments,
+// which follow the policy name in the policy subdirective.
+type PolicyConfigurer interface {
+	Configure(args []string) error
 }
 
 func init() {
 	RegisterPolicy("random", func() Policy { return &Random{} })
 	RegisterPolicy("least_conn", func() Policy { return &LeastConn{} })
 	RegisterPolicy("round_robin", func() Policy { return &RoundRobin{} })
+	RegisterPolicy("header", func() Policy { return &Header{} })
 }
 
 // Random is a policy that selects up hosts from a pool at random.
 type Random struct{}
 
 // Select selects an up host at random from the specified pool.
-func (r *Random) Select(pool HostPool) *UpstreamHost {
+func (r *Random) Select(pool HostPool, request *http.Request) *UpstreamHost {
 	// instead of just generating a random index
 	// this is done to prevent selecting a down host
 	var randHost *UpstreamHost
@@ -51,7 +63,7 @@ type LeastConn struct{}
 // Select selects the up host with the least number of connections in the
 // pool.  If more than one host has the same least number of connections,
 // one of the hosts is chosen at random.
-func (r *LeastConn) Select(pool HostPool) *UpstreamHost {
+func (r *LeastConn) Select(pool HostPool, request *http.Request) *UpstreamHost {
 	var bestHost *UpstreamHost
 	count := 0
 	leastConn := int64(1<<63 - 1)
@@ -86,7 +98,7 @@ type RoundRobin struct {
 }
 
 // Select selects an up host from the pool using a round robin ordering scheme.
-func (r *RoundRobin) Select(pool HostPool) *UpstreamHost {
+func (r *RoundRobin) Select(pool HostPool, request *http.Request) *UpstreamHost {
 	poolLen := uint32(len(pool))
 	selection := atomic.AddUint32(&r.Robin, 1) % poolLen
 	host := pool[selection]
@@ -99,3 +111,44 @@ func (r *RoundRobin) Select(pool HostPool) *UpstreamHost {
 	}
 	return host
 }
+
+// Header is a policy that selects hosts by hashing the value of a
+// request header, so requests with the same value go to the same host
+// for as long as it is up. It uses rendezvous hashing: when a host is
+// added or goes down, only the values that mapped to it are moved.
+// Requests without the header are sent to a random host.
+type Header struct {
+	Name string
+}
+
+// Configure sets the name of the header to hash.
+func (r *Header) Configure(args []string) error {
+	if len(args) != 1 {
+		return errors.New("header policy needs the name of a header")
+	}
+	r.Name = args[0]
+	return nil
+}
+
+// Select selects the up host with the highest hash
+// of its name and the value of the header.
+func (r *Header) Select(pool HostPool, request *http.Request) *UpstreamHost {
+	val := request.Header.Get(r.Name)
+	if val == "" {
+		return (&Random{}).Select(pool, request)
+	}
+	var bestHost *UpstreamHost
+	var bestWeight uint32
+	for _, host := range pool {
+		if host.Down() {
+			continue
+		}
+		h := fnv.New32a()
+		h.Write([]byte(host.Name))
+		h.Write([]byte(val))
+		if weight := h.Sum32(); bestHost == nil || weight > bestWeight {
+			bestHost, bestWeight = host, weight
+		}
+	}
+	return bestHost
+}
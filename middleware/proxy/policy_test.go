@@ -1,12 +1,13 @@
 package proxy
 
 import (
+	"net/http"
 	"testing"
 )
 
 type customPolicy struct{}
 
-func (r *customPolicy) Select(pool HostPool) *UpstreamHost {
+func (r *customPolicy) Select(pool HostPool, request *http.Request) *UpstreamHost {
 	return pool[0]
 }
 
@@ -28,19 +29,19 @@ func testPool() HostPool {
 func TestRoundRobinPolicy(t *testing.T) {
 	pool := testPool()
 	rrPolicy := &RoundRobin{}
-	h := rrPolicy.Select(pool)
+	h := rrPolicy.Select(pool, nil)
 	// First selected host is 1, because counter starts at 0
 	// and increments before host is selected
 	if h != pool[1] {
 		t.Error("Expected first round robin host to be second host in the pool.")
 	}
-	h = rrPolicy.Select(pool)
+	h = rrPolicy.Select(pool, nil)
 	if h != pool[2] {
 		t.Error("Expected second round robin host to be third host in the pool.")
 	}
 	// mark host as down
 	pool[0].Unhealthy = true
-	h = rrPolicy.Select(pool)
+	h = rrPolicy.Select(pool, nil)
 	if h != pool[1] {
 		t.Error("Expected third round robin host to be first host in the pool.")
 	}
@@ -51,12 +52,12 @@ func TestLeastConnPolicy(t *testing.T) {
 	lcPolicy := &LeastConn{}
 	pool[0].Conns = 10
 	pool[1].Conns = 10
-	h := lcPolicy.Select(pool)
+	h := lcPolicy.Select(pool, nil)
 	if h != pool[2] {
 		t.Error("Expected least connection host to be third host.")
 	}
 	pool[2].Conns = 100
-	h = lcPolicy.Select(pool)
+	h = lcPolicy.Select(pool, nil)
 	if h != pool[0] && h != pool[1] {
 		t.Error("Expected least connection host to be first or second host.")
 	}
@@ -65,8 +66,44 @@ func TestLeastConnPolicy(t *testing.T) {
 func TestCustomPolicy(t *testing.T) {
 	pool := testPool()
 	customPolicy := &customPolicy{}
-	h := customPolicy.Select(pool)
+	h := customPolicy.Select(pool, nil)
 	if h != pool[0] {
 		t.Error("Expected custom policy host to be the first host.")
 	}
 }
+
+func TestHeaderPolicy(t *testing.T) {
+	pool := testPool()
+	headerPolicy := &Header{Name: "X-User"}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("X-User", "alice")
+
+	h := headerPolicy.Select(pool, r)
+	for i := 0; i < 10; i++ {
+		if got := headerPolicy.Select(pool, r); got != h {
+			t.Fatalf("Expected the same host for the same header, got %s and %s", h.Name, got.Name)
+		}
+	}
+
+	// only requests that went to the host that is down should move
+	h.Unhealthy = true
+	defer func() { h.Unhealthy = false }()
+	moved := headerPolicy.Select(pool, r)
+	if moved == nil || moved == h {
+		t.Errorf("Expected a different host once %s is down, got %v", h.Name, moved)
+	}
+	for _, user := range []string{"bob", "carol", "dave", "erin", "frank"} {
+		r.Header.Set("X-User", user)
+		h.Unhealthy = false
+		before := headerPolicy.Select(pool, r)
+		h.Unhealthy = true
+		if after := headerPolicy.Select(pool, r); before != h && after != before {
+			t.Errorf("Expected %s to stay on %s, got %s", user, before.Name, after.Name)
+		}
+	}
+
+	r.Header.Del("X-User")
+	if h := headerPolicy.Select(pool, r); h == nil {
+		t.Error("Expected a host for a request without the header")
+	}
+}
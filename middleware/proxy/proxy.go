@@ -2,7 +2,10 @@
 package proxy
 
 import (
+	"context"
 	"errors"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"sync/atomic"
@@ -24,10 +27,41 @@ type Proxy struct {
 type Upstream interface {
 	// The path this upstream host should be routed on
 	From() string
-	// Selects an upstream host to be routed to.
-	Select() *UpstreamHost
+	// Selects an upstream host to route the request to.
+	Select(r *http.Request) *UpstreamHost
 }
 
+// Retrier is implemented by upstreams that configure how a request
+// fails over from hosts that can't be reached to other ones: it keeps
+// being tried for duration, waiting interval between tries. If it is
+// 0, a request is tried once; if interval is 0, a request is given up
+// on as soon as there are no hosts up.
+type Retrier interface {
+	Retries() (duration, interval time.Duration)
+}
+
+// Worker is implemented by upstreams that do work in the background
+// while they are in use, like discovering or health checking hosts.
+// Start is called before the site is served and Stop once it is shut
+// down or replaced by a reload.
+type Worker interface {
+	Start() error
+	Stop() error
+}
+
+// HostLister is implemented by upstreams whose hosts are given
+// in the configuration, so that they can be checked before the
+// site is served. Hosts found by discovery aren't listed.
+type HostLister interface {
+	// StaticHosts returns the hosts as configured, like
+	// "localhost:8080" or "https://backend".
+	StaticHosts() []string
+}
+
+// DefaultTryDuration is how long a request keeps failing
+// over for if its upstream isn't a Retrier.
+const DefaultTryDuration = 60 * time.Second
+
 // UpstreamHostDownFunc can be used to customize how Down behaves.
 type UpstreamHostDownFunc func(*UpstreamHost) bool
 
@@ -46,9 +80,13 @@ type UpstreamHost struct {
 }
 
 // Down checks whether the upstream host is down or not.
+// A host that is being drained is always down. Otherwise,
 // Down will try to use uh.CheckDown first, and will fall
 // back to some default criteria if necessary.
 func (uh *UpstreamHost) Down() bool {
+	if Draining(uh.Name) {
+		return true
+	}
 	if uh.CheckDown == nil {
 		// Default settings
 		return uh.Unhealthy || uh.Fails > 0
@@ -65,12 +103,33 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 			start := time.Now()
 			requestHost := r.Host
 
+			// The request body is streamed to the backend, not
+			// buffered, so a request can't be retried on another
+			// backend once some of its body was sent.
+			var body *trackingBody
+			if r.Body != nil {
+				body = &trackingBody{ReadCloser: r.Body}
+				r.Body = body
+			}
+
+			tryDuration, tryInterval := DefaultTryDuration, time.Duration(0)
+			if rt, ok := upstream.(Retrier); ok {
+				tryDuration, tryInterval = rt.Retries()
+			}
+
 			// Since Select() should give us "up" hosts, keep retrying
-			// hosts until timeout (or until we get a nil host).
-			for time.Now().Sub(start) < (60 * time.Second) {
-				host := upstream.Select()
+			// hosts until timeout (or until we get a nil host, unless
+			// there is an interval to wait for one to come back).
+			for {
+				if status := middleware.ContextStatus(r.Context()); status != 0 {
+					return status, r.Context().Err()
+				}
+				host := upstream.Select(r)
 				if host == nil {
-					return http.StatusBadGateway, errUnreachable
+					if tryInterval == 0 || !retry(r, start, tryDuration, tryInterval) {
+						return http.StatusBadGateway, errUnreachable
+					}
+					continue
 				}
 				proxy := host.ReverseProxy
 				r.Host = host.Name
@@ -103,12 +162,29 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 					}
 				}
 
+				middleware.TraceFrom(r).Note("upstream=%s", host.Name)
 				atomic.AddInt64(&host.Conns, 1)
 				backendErr := proxy.ServeHTTP(w, r, extraHeaders)
 				atomic.AddInt64(&host.Conns, -1)
 				if backendErr == nil {
 					return 0, nil
 				}
+				if status := middleware.ContextStatus(r.Context()); status != 0 {
+					// the client went away or the site's request
+					// timeout passed; that's not the backend's fault
+					return status, backendErr
+				}
+				if backendErr == ErrAJPBodyTooLarge {
+					return http.StatusRequestEntityTooLarge, backendErr
+				}
+				if isTimeout(backendErr) {
+					// the request took too long; don't let
+					// it tie up another backend as well
+					return http.StatusGatewayTimeout, backendErr
+				}
+				if body != nil && body.read {
+					return http.StatusBadGateway, backendErr
+				}
 				timeout := host.FailTimeout
 				if timeout == 0 {
 					timeout = 10 * time.Second
@@ -118,10 +194,67 @@ func (p Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
 					time.Sleep(timeout)
 					atomic.AddInt32(&host.Fails, -1)
 				}(host, timeout)
+
+				if !retry(r, start, tryDuration, tryInterval) {
+					return http.StatusBadGateway, errUnreachable
+				}
 			}
-			return http.StatusBadGateway, errUnreachable
 		}
 	}
 
 	return p.Next.ServeHTTP(w, r)
 }
+
+// retry waits interval before another try at r, unless the
+// request is canceled first. It returns false if there is no
+// time left for one, duration after start.
+func retry(r *http.Request, start time.Time, duration, interval time.Duration) bool {
+	if time.Since(start)+interval >= duration {
+		return false
+	}
+	if interval > 0 {
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+		}
+	}
+	return true
+}
+
+// isTimeout returns true if err is because a request to
+// a backend timed out.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return true
+	}
+	return false
+}
+
+// trackingBody is a request body that
+// records whether it has been read from.
+type trackingBody struct {
+	io.ReadCloser
+	read bool
+}
+
+func (b *trackingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.read = true
+	}
+	return n, err
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (p Proxy) Scopes() []string {
+	scopes := make([]string, len(p.Upstreams))
+	for i, upstream := range p.Upstreams {
+		scopes[i] = upstream.From()
+	}
+	return scopes
+}
@@ -3,15 +3,27 @@ package proxy
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"math/big"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
 	"net/url"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/mholt/caddy/config/parse"
+	"github.com/mholt/caddy/middleware"
 	"golang.org/x/net/websocket"
 )
 
@@ -53,6 +65,97 @@ func TestWebSocketReverseProxyServeHTTPHandler(t *testing.T) {
 	}
 }
 
+func TestWebSocketCompression(t *testing.T) {
+	// The backend accepts whatever extensions are offered, so
+	// the response shows what was passed on to it.
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		resp := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"
+		if ext := r.Header.Get("Sec-WebSocket-Extensions"); ext != "" {
+			resp += "Sec-WebSocket-Extensions: " + ext + "\r\n"
+		}
+		conn.Write([]byte(resp + "\r\n"))
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	for i, test := range []struct {
+		offered  string
+		strip    bool
+		expected string
+	}{
+		{"permessage-deflate; client_max_window_bits", false, "permessage-deflate; client_max_window_bits"},
+		{"permessage-deflate; client_max_window_bits", true, ""},
+		{"permessage-deflate, x-custom; level=2", true, "x-custom; level=2"},
+		{"", true, ""},
+	} {
+		rp := NewSingleHostReverseProxy(backendURL, "")
+		rp.StripWebSocketCompression = test.strip
+
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Host = backendURL.Host // as Proxy sets it
+		r.Header = http.Header{
+			"Connection":            {"Upgrade"},
+			"Upgrade":               {"websocket"},
+			"Sec-WebSocket-Key":     {"x3JJHMbDL1EzLkh9GBhXDw=="},
+			"Sec-WebSocket-Version": {"13"},
+		}
+		if test.offered != "" {
+			r.Header.Set("Sec-WebSocket-Extensions", test.offered)
+		}
+		w := &recorderHijacker{httptest.NewRecorder(), new(fakeConn)}
+
+		err := rp.ServeHTTP(w, r, http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}})
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+
+		resp := w.fakeConn.writeBuf.String()
+		if !strings.HasPrefix(resp, "HTTP/1.1 101 ") {
+			t.Fatalf("Test %d: Expected the backend's 101 response, got %q", i, resp)
+		}
+		if test.expected == "" {
+			if strings.Contains(resp, "Sec-WebSocket-Extensions") {
+				t.Errorf("Test %d: Expected no extensions negotiated, got %q", i, resp)
+			}
+		} else if !strings.Contains(resp, "\r\nSec-WebSocket-Extensions: "+test.expected+"\r\n") {
+			t.Errorf("Test %d: Expected extensions %q negotiated, got %q", i, test.expected, resp)
+		}
+		if r.Header.Get("Sec-WebSocket-Extensions") != test.offered {
+			t.Errorf("Test %d: Expected the client's request to be left alone, got %q", i, r.Header.Get("Sec-WebSocket-Extensions"))
+		}
+	}
+
+	for i, test := range []struct {
+		block     string
+		shouldErr bool
+		expected  bool
+	}{
+		{"websocket", false, false},
+		{"websocket_compression off", false, true},
+		{"websocket_compression on", false, false},
+		{"websocket_compression", true, false},
+		{"websocket_compression maybe", true, false},
+	} {
+		upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile",
+			strings.NewReader("proxy / localhost:8080 {\n"+test.block+"\n}")))
+		if err == nil && test.shouldErr {
+			t.Errorf("Parse test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Parse test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if err == nil {
+			if strip := upstreams[0].(*staticUpstream).Hosts[0].ReverseProxy.StripWebSocketCompression; strip != test.expected {
+				t.Errorf("Parse test %d: Expected stripping compression to be %v, got %v", i, test.expected, strip)
+			}
+		}
+	}
+}
+
 func TestWebSocketReverseProxyFromWSClient(t *testing.T) {
 	// Echo server allows us to test that socket bytes are properly
 	// being proxied.
@@ -93,16 +196,469 @@ func TestWebSocketReverseProxyFromWSClient(t *testing.T) {
 	}
 }
 
+func TestTransparentProxy(t *testing.T) {
+	var got *http.Request
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer backend.Close()
+
+	upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile",
+		strings.NewReader("proxy / "+backend.URL+" {\n transparent \n}")))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	p := &Proxy{Upstreams: upstreams}
+
+	r, err := http.NewRequest("GET", "http://example.com:8080/page", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	r.RemoteAddr = "10.0.0.1:54321"
+	if _, err := p.ServeHTTP(httptest.NewRecorder(), r); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if got == nil {
+		t.Fatal("Expected request to reach the backend")
+	}
+	if got.Host != "example.com:8080" {
+		t.Errorf("Expected Host example.com:8080, got %s", got.Host)
+	}
+	for header, expected := range map[string]string{
+		"X-Real-Ip":         "10.0.0.1",
+		"X-Forwarded-For":   "10.0.0.1",
+		"X-Forwarded-Proto": "http",
+		"X-Forwarded-Port":  "8080",
+	} {
+		if val := got.Header.Get(header); val != expected {
+			t.Errorf("Expected %s header %s, got %s", header, expected, val)
+		}
+	}
+
+	// the preset applies to its own upstream only
+	upstreams, err = NewStaticUpstreams(parse.NewDispenser("Testfile",
+		strings.NewReader("proxy / "+backend.URL)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	p = &Proxy{Upstreams: upstreams}
+	got = nil
+	r = httptest.NewRequest("GET", "http://example.com:8080/page", nil)
+	if _, err := p.ServeHTTP(httptest.NewRecorder(), r); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if got == nil {
+		t.Fatal("Expected request to reach the backend")
+	}
+	if got.Host == "example.com:8080" || got.Header.Get("X-Real-Ip") != "" {
+		t.Errorf("Expected headers of another upstream's preset not to be set, got Host %s and %v", got.Host, got.Header)
+	}
+}
+
+func TestProxyTimeouts(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	defer backend.Close()
+
+	for i, test := range []struct {
+		block          string
+		path           string
+		expectedStatus int
+	}{
+		{"", "/", 0},
+		{"timeout 20ms", "/", http.StatusGatewayTimeout},
+		{"timeout 20ms\n timeout /slow 5s", "/slow/report", 0},
+		{"timeout 20ms\n timeout /slow 5s", "/fast", http.StatusGatewayTimeout},
+		{"timeout 5s\n timeout /slow 20ms", "/slow", http.StatusGatewayTimeout},
+		{"header_timeout 20ms", "/", http.StatusGatewayTimeout},
+		{"dial_timeout 1s\n header_timeout 5s", "/", 0},
+	} {
+		upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile",
+			strings.NewReader("proxy / "+backend.URL+" {\n"+test.block+"\n}")))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		p := &Proxy{Upstreams: upstreams}
+
+		r, _ := http.NewRequest("GET", test.path, nil)
+		start := time.Now()
+		status, err := p.ServeHTTP(httptest.NewRecorder(), r)
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d (error: %v)", i, test.expectedStatus, status, err)
+		}
+		if test.expectedStatus == http.StatusGatewayTimeout && time.Since(start) > 90*time.Millisecond {
+			t.Errorf("Test %d: Expected request to time out early, took %v", i, time.Since(start))
+		}
+	}
+}
+
+func TestProxyFailover(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("done"))
+	}))
+	defer backend.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	for i, test := range []struct {
+		hosts          string
+		block          string
+		expectedStatus int
+		minDuration    time.Duration
+	}{
+		{dead.URL + " " + backend.URL, "policy round_robin", 0, 0},
+		{dead.URL + " " + backend.URL, "policy round_robin\n try_interval 10ms", 0, 0},
+		{dead.URL, "try_duration 0", http.StatusBadGateway, 0},
+		{dead.URL, "try_duration 100ms\n try_interval 30ms", http.StatusBadGateway, 60 * time.Millisecond},
+	} {
+		upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile",
+			strings.NewReader("proxy / "+test.hosts+" {\n"+test.block+"\n}")))
+		if err != nil {
+			t.Fatalf("Test %d: Expected no error, got: %v", i, err)
+		}
+		p := &Proxy{Upstreams: upstreams}
+
+		for j := 0; j < 3; j++ {
+			r, _ := http.NewRequest("GET", "/", nil)
+			start := time.Now()
+			status, err := p.ServeHTTP(httptest.NewRecorder(), r)
+			if status != test.expectedStatus {
+				t.Errorf("Test %d, request %d: Expected status %d, got %d (error: %v)", i, j, test.expectedStatus, status, err)
+			}
+			if took := time.Since(start); took < test.minDuration || took > 5*time.Second {
+				t.Errorf("Test %d, request %d: Expected to keep trying for at least %v, took %v", i, j, test.minDuration, took)
+			}
+		}
+	}
+
+	for i, block := range []string{"try_duration", "try_duration soon", "try_interval -1s"} {
+		_, err := NewStaticUpstreams(parse.NewDispenser("Testfile",
+			strings.NewReader("proxy / localhost:8080 {\n"+block+"\n}")))
+		if err == nil {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		}
+	}
+}
+
+func TestClientCertificateHeaders(t *testing.T) {
+	var got http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer backend.Close()
+
+	upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile",
+		strings.NewReader("proxy / "+backend.URL+" {\nclient_certificate pem\n}")))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	p := &Proxy{Upstreams: upstreams}
+
+	cert := &x509.Certificate{
+		Raw:          []byte("not really DER"),
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "alice"},
+		DNSNames:     []string{"alice.example.com"},
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	p.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got.Get("X-Client-Cert-Subject") != "CN=alice" || got.Get("X-Client-Cert-Serial") != "7" ||
+		got.Get("X-Client-Cert-Dns") != "alice.example.com" {
+		t.Errorf("Expected the certificate's subject, serial and DNS names, got %v", got)
+	}
+	if fp := got.Get("X-Client-Cert-Fingerprint"); fp != middleware.ClientCertFingerprint(cert) {
+		t.Errorf("Expected the certificate's fingerprint, got %q", fp)
+	}
+	if !strings.HasPrefix(got.Get("X-Client-Cert"), "-----BEGIN+CERTIFICATE-----") {
+		t.Errorf("Expected the escaped PEM certificate, got %q", got.Get("X-Client-Cert"))
+	}
+
+	// without a certificate, made-up headers are cleared
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Client-Cert-Subject", "CN=admin")
+	p.ServeHTTP(httptest.NewRecorder(), r)
+	if subject := got.Get("X-Client-Cert-Subject"); subject != "" {
+		t.Errorf("Expected the client's own subject header to be cleared, got %q", subject)
+	}
+
+	// the headers are set for the upstream's own hosts only
+	upstreams, err = NewStaticUpstreams(parse.NewDispenser("Testfile", strings.NewReader("proxy / "+backend.URL)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	(&Proxy{Upstreams: upstreams}).ServeHTTP(httptest.NewRecorder(), r)
+	if subject := got.Get("X-Client-Cert-Subject"); subject != "" {
+		t.Errorf("Expected no certificate headers for another upstream, got subject %q", subject)
+	}
+
+	for i, block := range []string{"client_certificate der", "client_certificate pem extra"} {
+		_, err := NewStaticUpstreams(parse.NewDispenser("Testfile",
+			strings.NewReader("proxy / localhost:8080 {\n"+block+"\n}")))
+		if err == nil {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		}
+	}
+}
+
+// patternReader produces n bytes without holding them in memory.
+// After the first chunk, it waits for started to be closed, so a
+// test can tell whether the body is streamed or read in full first.
+type patternReader struct {
+	n, read int64
+	started chan struct{}
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.read >= r.n {
+		return 0, io.EOF
+	}
+	if r.read > 0 && r.started != nil {
+		select {
+		case <-r.started:
+			r.started = nil
+		case <-time.After(5 * time.Second):
+			return 0, errors.New("body was not streamed")
+		}
+	}
+	if int64(len(p)) > r.n-r.read {
+		p = p[:r.n-r.read]
+	}
+	for i := range p {
+		p[i] = byte(r.read + int64(i))
+	}
+	r.read += int64(len(p))
+	return len(p), nil
+}
+
+func (r *patternReader) Close() error { return nil }
+
+func TestProxyStreamsRequestBody(t *testing.T) {
+	started := make(chan struct{})
+	var received int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := r.Body.Read(buf)
+			if received == 0 && n > 0 {
+				close(started)
+			}
+			received += int64(n)
+			if err != nil {
+				break
+			}
+		}
+	}))
+	defer backend.Close()
+
+	const size = 64 << 20
+	upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile", strings.NewReader("proxy / "+backend.URL)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	p := &Proxy{Upstreams: upstreams}
+	r, _ := http.NewRequest("POST", "/upload", nil)
+	r.Body = &patternReader{n: size, started: started}
+	r.ContentLength = -1 // chunked
+
+	if status, err := p.ServeHTTP(httptest.NewRecorder(), r); status != 0 || err != nil {
+		t.Fatalf("Expected status 0 and no error, got %d: %v", status, err)
+	}
+	if received != size {
+		t.Errorf("Expected backend to receive %d bytes, got %d", size, received)
+	}
+}
+
+func TestProxyNoRetryAfterBodySent(t *testing.T) {
+	var secondHit bool
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.CopyN(ioutil.Discard, r.Body, 1024)
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer broken.Close()
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondHit = true
+	}))
+	defer second.Close()
+
+	upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile",
+		strings.NewReader("proxy / "+broken.URL+" "+second.URL)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	// make sure the broken backend is tried first
+	upstreams[0].(*staticUpstream).Policy = &firstUpPolicy{}
+	p := &Proxy{Upstreams: upstreams}
+
+	r, _ := http.NewRequest("POST", "/upload", nil)
+	r.Body = &patternReader{n: 1 << 20}
+	r.ContentLength = 1 << 20
+	status, _ := p.ServeHTTP(httptest.NewRecorder(), r)
+	if status != http.StatusBadGateway {
+		t.Errorf("Expected status %d, got %d", http.StatusBadGateway, status)
+	}
+	if secondHit || upstreams[0].(*staticUpstream).Hosts[1].Fails != 0 {
+		t.Error("Expected request with a partly sent body not to be retried")
+	}
+}
+
+// firstUpPolicy selects the first host that is up.
+type firstUpPolicy struct{}
+
+func (r *firstUpPolicy) Select(pool HostPool, request *http.Request) *UpstreamHost {
+	for _, host := range pool {
+		if !host.Down() {
+			return host
+		}
+	}
+	return nil
+}
+
+func TestProxyExpectContinue(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// reject without reading the body
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}))
+	defer backend.Close()
+
+	upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile",
+		strings.NewReader("proxy / "+backend.URL+" {\n expect_continue 5s \n}")))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	p := &Proxy{Upstreams: upstreams}
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status, _ := p.ServeHTTP(w, r); status != 0 {
+			w.WriteHeader(status)
+		}
+	}))
+	defer front.Close()
+
+	body := &patternReader{n: 10 << 20}
+	req, _ := http.NewRequest("POST", front.URL+"/upload", body)
+	req.ContentLength = body.n
+	req.Header.Set("Expect", "100-continue")
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, resp.StatusCode)
+	}
+	if body.read != 0 {
+		t.Errorf("Expected client not to send the body, but %d bytes were read", body.read)
+	}
+}
+
+func TestProxyClientGone(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer backend.Close()
+
+	upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile",
+		strings.NewReader("proxy / "+backend.URL+" "+backend.URL+"/other")))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	upstream := upstreams[0].(*staticUpstream)
+	upstream.Policy = &firstUpPolicy{}
+	p := &Proxy{Upstreams: upstreams}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest("GET", "/", nil)
+	req = req.WithContext(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	status, _ := p.ServeHTTP(httptest.NewRecorder(), req)
+	if status != middleware.StatusClientClosedRequest {
+		t.Errorf("Expected status %d, got %d", middleware.StatusClientClosedRequest, status)
+	}
+	for i, host := range upstream.Hosts {
+		if host.Fails != 0 {
+			t.Errorf("Expected host %d not to be blamed for the client going away, got %d fails", i, host.Fails)
+		}
+	}
+}
+
+func TestProxyTrailersAndEarlyHints(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Te") != "trailers" {
+			t.Errorf("Expected TE: trailers to be forwarded, got %q", r.Header.Get("Te"))
+		}
+		w.Header().Set("Link", "</style.css>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Del("Link")
+
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "body")
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", "ok")
+	}))
+	defer backend.Close()
+
+	upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile", strings.NewReader("proxy / "+backend.URL)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	p := &Proxy{Upstreams: upstreams}
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// go through a wrapping writer, like the log middleware's
+		if status, _ := p.ServeHTTP(middleware.NewResponseRecorder(w), r); status != 0 {
+			w.WriteHeader(status)
+		}
+	}))
+	defer front.Close()
+
+	var hints []string
+	req, _ := http.NewRequest("GET", front.URL, nil)
+	req.Header.Set("Te", "trailers")
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			hints = append(hints, fmt.Sprintf("%d %s", code, header.Get("Link")))
+			return nil
+		},
+	}))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "body" {
+		t.Errorf("Expected body 'body', got %q", body)
+	}
+	if len(hints) != 1 || hints[0] != "103 </style.css>; rel=preload" {
+		t.Errorf("Expected one 103 response with the Link header, got %v", hints)
+	}
+	if resp.Header.Get("Link") != "" {
+		t.Errorf("Expected the Link header only on the 103 response, got %q", resp.Header.Get("Link"))
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("Expected trailer Grpc-Status: 0, got %q", got)
+	}
+	if got := resp.Trailer.Get("Grpc-Message"); got != "ok" {
+		t.Errorf("Expected unannounced trailer Grpc-Message: ok, got %q", got)
+	}
+}
+
 // newWebSocketTestProxy returns a test proxy that will
 // redirect to the specified backendAddr. The function
 // also sets up the rules/environment for testing WebSocket
 // proxy.
 func newWebSocketTestProxy(backendAddr string) *Proxy {
-	proxyHeaders = http.Header{
-		"Connection": {"{>Connection}"},
-		"Upgrade":    {"{>Upgrade}"},
-	}
-
 	return &Proxy{
 		Upstreams: []Upstream{&fakeUpstream{name: backendAddr}},
 	}
@@ -116,12 +672,15 @@ func (u *fakeUpstream) From() string {
 	return "/"
 }
 
-func (u *fakeUpstream) Select() *UpstreamHost {
+func (u *fakeUpstream) Select(r *http.Request) *UpstreamHost {
 	uri, _ := url.Parse(u.name)
 	return &UpstreamHost{
 		Name:         u.name,
 		ReverseProxy: NewSingleHostReverseProxy(uri, ""),
-		ExtraHeaders: proxyHeaders,
+		ExtraHeaders: http.Header{
+			"Connection": {"{>Connection}"},
+			"Upgrade":    {"{>Upgrade}"},
+		},
 	}
 }
 
@@ -149,3 +708,27 @@ func (c *fakeConn) SetWriteDeadline(t time.Time) error { return nil }
 func (c *fakeConn) Close() error                       { return nil }
 func (c *fakeConn) Read(b []byte) (int, error)         { return c.readBuf.Read(b) }
 func (c *fakeConn) Write(b []byte) (int, error)        { return c.writeBuf.Write(b) }
+
+func TestReverseProxyRawPath(t *testing.T) {
+	target, _ := url.Parse("http://backend/base")
+	rp := NewSingleHostReverseProxy(target, "")
+
+	for i, test := range []struct {
+		raw             bool
+		path            string
+		expectedEscaped string
+	}{
+		{false, "/a b/c", "/base/a%20b/c"},
+		{true, "/a%2Fb/c%20d", "/base/a%2Fb/c%20d"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.URL.Path = test.path
+		if test.raw {
+			r = middleware.WithRawPath(r)
+		}
+		rp.Director(r)
+		if escaped := r.URL.EscapedPath(); escaped != test.expectedEscaped {
+			t.Errorf("Test %d: Expected the backend to get %s, got %s", i, test.expectedEscaped, escaped)
+		}
+	}
+}
@@ -12,13 +12,18 @@
 package proxy
 
 import (
+	"context"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
 	"net/url"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/mholt/caddy/middleware"
 )
 
 // onExitFlushLoop is a callback set by tests to detect the state of the
@@ -44,6 +49,44 @@ type ReverseProxy struct {
 	// response body.
 	// If zero, no periodic flushing is done.
 	FlushInterval time.Duration
+
+	// ModifyResponse, if not nil, is called with the
+	// response from the backend before it is copied
+	// to the client.
+	ModifyResponse func(*http.Response)
+
+	// Timeout limits how long a request to the backend
+	// may take, including reading the whole response.
+	// PathTimeouts override it for requests under their
+	// path; the longest matching path is used. Zero
+	// means no limit.
+	Timeout      time.Duration
+	PathTimeouts []PathTimeout
+
+	// Whether to take the offers of compression out of the
+	// Sec-WebSocket-Extensions header of WebSocket handshakes,
+	// for backends that mishandle compressed messages. Other
+	// extensions are still offered. Otherwise the header goes
+	// to the backend as is, and the one it answers with goes
+	// back to the client, so both ends agree on compression.
+	StripWebSocketCompression bool
+}
+
+// PathTimeout is a timeout for requests under a path.
+type PathTimeout struct {
+	Path    string
+	Timeout time.Duration
+}
+
+// timeout returns the timeout for a request to path.
+func (p *ReverseProxy) timeout(path string) time.Duration {
+	timeout, longest := p.Timeout, -1
+	for _, pt := range p.PathTimeouts {
+		if middleware.Path(path).Matches(pt.Path) && len(pt.Path) > longest {
+			timeout, longest = pt.Timeout, len(pt.Path)
+		}
+	}
+	return timeout
 }
 
 func singleJoiningSlash(a, b string) string {
@@ -67,17 +110,25 @@ func singleJoiningSlash(a, b string) string {
 func NewSingleHostReverseProxy(target *url.URL, without string) *ReverseProxy {
 	targetQuery := target.RawQuery
 	director := func(req *http.Request) {
+		path := req.URL.Path
+		if without != "" {
+			// strip the prefix before joining, so the
+			// target's own base path is preserved
+			path = strings.TrimPrefix(path, without)
+		}
 		req.URL.Scheme = target.Scheme
 		req.URL.Host = target.Host
-		req.URL.Path = singleJoiningSlash(target.Path, req.URL.Path)
+		req.URL.Path = singleJoiningSlash(target.Path, path)
+		if middleware.IsRawPath(req) {
+			// send the path as it was matched, without escaping it again
+			req.URL.RawPath = req.URL.Path
+			req.URL.Path, _ = url.PathUnescape(req.URL.RawPath)
+		}
 		if targetQuery == "" || req.URL.RawQuery == "" {
 			req.URL.RawQuery = targetQuery + req.URL.RawQuery
 		} else {
 			req.URL.RawQuery = targetQuery + "&" + req.URL.RawQuery
 		}
-		if without != "" {
-			req.URL.Path = strings.TrimPrefix(req.URL.Path, without)
-		}
 	}
 	return &ReverseProxy{Director: director}
 }
@@ -112,6 +163,12 @@ func (p *ReverseProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request, extr
 	outreq := new(http.Request)
 	*outreq = *req // includes shallow copies of maps, but okay
 
+	if timeout := p.timeout(req.URL.Path); timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+		outreq = outreq.WithContext(ctx)
+	}
+
 	p.Director(outreq)
 	outreq.Proto = "HTTP/1.1"
 	outreq.ProtoMajor = 1
@@ -135,6 +192,41 @@ func (p *ReverseProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request, extr
 		}
 	}
 
+	if p.StripWebSocketCompression && len(outreq.Header["Sec-Websocket-Extensions"]) > 0 {
+		if !copiedHeaders {
+			outreq.Header = make(http.Header)
+			copyHeader(outreq.Header, req.Header)
+			copiedHeaders = true
+		}
+		stripCompression(outreq.Header)
+	}
+
+	// The client is saying it can handle trailers, which the
+	// backend only sends if it knows, so pass that on.
+	if acceptsTrailers(req.Header) {
+		outreq.Header.Set("Te", "trailers")
+	}
+
+	// Forward informational responses, like 103 Early Hints,
+	// to the client as soon as they arrive.
+	outreq = outreq.WithContext(httptrace.WithClientTrace(outreq.Context(), &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusSwitchingProtocols {
+				return nil
+			}
+			h := rw.Header()
+			for k, vv := range header {
+				h[k] = vv
+			}
+			rw.WriteHeader(code)
+			// the headers are not cleared after 1xx responses
+			for k := range header {
+				delete(h, k)
+			}
+			return nil
+		},
+	}))
+
 	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
 		// If we aren't the first proxy retain prior
 		// X-Forwarded-For information as a comma+space
@@ -186,15 +278,77 @@ func (p *ReverseProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request, extr
 			res.Header.Del(h)
 		}
 
+		if p.ModifyResponse != nil {
+			p.ModifyResponse(res)
+		}
+
 		copyHeader(rw.Header(), res.Header)
 
+		// Announce the trailers, whose values are
+		// only known once the body has been read
+		announced := len(res.Trailer)
+		if announced > 0 {
+			names := make([]string, 0, announced)
+			for k := range res.Trailer {
+				names = append(names, k)
+			}
+			rw.Header().Add("Trailer", strings.Join(names, ", "))
+		}
+
 		rw.WriteHeader(res.StatusCode)
 		p.copyResponse(rw, res.Body)
+
+		if len(res.Trailer) == announced {
+			copyHeader(rw.Header(), res.Trailer)
+		} else {
+			// some trailers weren't announced
+			for k, vv := range res.Trailer {
+				for _, v := range vv {
+					rw.Header().Add(http.TrailerPrefix+k, v)
+				}
+			}
+		}
 	}
 
 	return nil
 }
 
+// stripCompression removes the offers of permessage-deflate (and of
+// the older x-webkit-deflate-frame) from the Sec-WebSocket-Extensions
+// header in h, keeping any other extensions offered.
+func stripCompression(h http.Header) {
+	var keep []string
+	for _, v := range h["Sec-Websocket-Extensions"] {
+		for _, ext := range strings.Split(v, ",") {
+			ext = strings.TrimSpace(ext)
+			name := strings.TrimSpace(strings.SplitN(ext, ";", 2)[0])
+			if ext == "" || strings.EqualFold(name, "permessage-deflate") ||
+				strings.EqualFold(name, "x-webkit-deflate-frame") {
+				continue
+			}
+			keep = append(keep, ext)
+		}
+	}
+	if len(keep) == 0 {
+		h.Del("Sec-Websocket-Extensions")
+	} else {
+		h.Set("Sec-Websocket-Extensions", strings.Join(keep, ", "))
+	}
+}
+
+// acceptsTrailers returns true if the TE header
+// in h lists trailers.
+func acceptsTrailers(h http.Header) bool {
+	for _, te := range h["Te"] {
+		for _, v := range strings.Split(te, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), "trailers") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (p *ReverseProxy) copyResponse(dst io.Writer, src io.Reader) {
 	if p.FlushInterval != 0 {
 		if wf, ok := dst.(writeFlusher); ok {
@@ -3,19 +3,36 @@ package proxy
 import (
 	"io"
 	"io/ioutil"
+	"log"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/mholt/caddy/config/parse"
 )
 
-var (
-	supportedPolicies map[string]func() Policy = make(map[string]func() Policy)
-	proxyHeaders      http.Header              = make(http.Header)
-)
+var supportedPolicies = make(map[string]func() Policy)
+
+// clientCertHeaders are the headers that the client_certificate
+// subdirective sets, to the placeholders for the verified client
+// certificate. They are sent empty if there isn't one, so a client
+// can't make them up.
+var clientCertHeaders = map[string]string{
+	"X-Client-Cert-Subject":     "{tls_client_subject}",
+	"X-Client-Cert-Issuer":      "{tls_client_issuer}",
+	"X-Client-Cert-Serial":      "{tls_client_serial}",
+	"X-Client-Cert-Fingerprint": "{tls_client_fingerprint}",
+	"X-Client-Cert-Dns":         "{tls_client_san_dns}",
+	"X-Client-Cert-Email":       "{tls_client_san_email}",
+	"X-Client-Cert-Uri":         "{tls_client_san_uri}",
+	"X-Client-Cert-Ip":          "{tls_client_san_ip}",
+}
 
 type staticUpstream struct {
 	from   string
@@ -24,11 +41,44 @@ type staticUpstream struct {
 
 	FailTimeout time.Duration
 	MaxFails    int32
+	TryDuration time.Duration
+	TryInterval time.Duration
 	HealthCheck struct {
 		Path     string
 		Interval time.Duration
 	}
 	WithoutPathPrefix string
+	Downstream        Downstream
+
+	// Headers to set on requests to the hosts, with placeholders
+	UpstreamHeaders http.Header
+
+	// Settings for hosts spoken to over AJP (see AJPTransport)
+	AJPSecret          string
+	AJPTimeout         time.Duration
+	AJPMaxBufferedBody int64
+
+	// Whether WebSocket clients may not negotiate
+	// compression with the hosts
+	NoWebSocketCompression bool
+
+	// Hosts that are found by discovery are added
+	// to the static ones every DiscoverInterval.
+	static           []string
+	Discoverers      []Discoverer
+	DiscoverInterval time.Duration
+
+	// Timeouts for requests to the hosts
+	DialTimeout     time.Duration
+	HeaderTimeout   time.Duration
+	Timeout         time.Duration
+	PathTimeouts    []PathTimeout
+	ContinueTimeout time.Duration // -1 to not wait at all
+
+	mu        sync.RWMutex  // protects Hosts and stop
+	stop      chan struct{} // closed to stop the workers
+	ajp       *AJPTransport
+	transport http.RoundTripper
 }
 
 // NewStaticUpstreams parses the configuration input and sets up
@@ -42,14 +92,20 @@ func NewStaticUpstreams(c parse.Dispenser) ([]Upstream, error) {
 			Policy:      &Random{},
 			FailTimeout: 10 * time.Second,
 			MaxFails:    1,
+			TryDuration: DefaultTryDuration,
+
+			UpstreamHeaders: make(http.Header),
 		}
 
 		if !c.Args(&upstream.from) {
 			return upstreams, c.ArgErr()
 		}
-		to := c.RemainingArgs()
-		if len(to) == 0 {
-			return upstreams, c.ArgErr()
+		for _, host := range c.RemainingArgs() {
+			if d, ok := srvDiscoverer(host); ok {
+				upstream.Discoverers = append(upstream.Discoverers, d)
+			} else {
+				upstream.static = append(upstream.static, host)
+			}
 		}
 
 		for c.NextBlock() {
@@ -59,9 +115,17 @@ func NewStaticUpstreams(c parse.Dispenser) ([]Upstream, error) {
 					return upstreams, c.ArgErr()
 				}
 
-				if policyCreateFunc, ok := supportedPolicies[c.Val()]; ok {
-					upstream.Policy = policyCreateFunc()
-				} else {
+				policyCreateFunc, ok := supportedPolicies[c.Val()]
+				if !ok {
+					return upstreams, c.ArgErr()
+				}
+				upstream.Policy = policyCreateFunc()
+				args := c.RemainingArgs()
+				if configurer, ok := upstream.Policy.(PolicyConfigurer); ok {
+					if err := configurer.Configure(args); err != nil {
+						return upstreams, c.Err(err.Error())
+					}
+				} else if len(args) > 0 {
 					return upstreams, c.ArgErr()
 				}
 			case "fail_timeout":
@@ -82,6 +146,20 @@ func NewStaticUpstreams(c parse.Dispenser) ([]Upstream, error) {
 				} else {
 					return upstreams, err
 				}
+			case "try_duration", "try_interval":
+				what := c.Val()
+				if !c.NextArg() {
+					return upstreams, c.ArgErr()
+				}
+				dur, err := time.ParseDuration(c.Val())
+				if err != nil || dur < 0 {
+					return upstreams, c.Errf("Invalid %s '%s'", what, c.Val())
+				}
+				if what == "try_duration" {
+					upstream.TryDuration = dur
+				} else {
+					upstream.TryInterval = dur
+				}
 			case "health_check":
 				if !c.NextArg() {
 					return upstreams, c.ArgErr()
@@ -100,73 +178,401 @@ func NewStaticUpstreams(c parse.Dispenser) ([]Upstream, error) {
 				if !c.Args(&header, &value) {
 					return upstreams, c.ArgErr()
 				}
-				proxyHeaders.Add(header, value)
+				upstream.UpstreamHeaders.Add(header, value)
 			case "websocket":
-				proxyHeaders.Add("Connection", "{>Connection}")
-				proxyHeaders.Add("Upgrade", "{>Upgrade}")
+				upstream.UpstreamHeaders.Add("Connection", "{>Connection}")
+				upstream.UpstreamHeaders.Add("Upgrade", "{>Upgrade}")
+			case "websocket_compression":
+				if !c.NextArg() {
+					return upstreams, c.ArgErr()
+				}
+				switch c.Val() {
+				case "on":
+					upstream.NoWebSocketCompression = false
+				case "off":
+					upstream.NoWebSocketCompression = true
+				default:
+					return upstreams, c.Errf("Invalid websocket_compression setting '%s'; use on or off", c.Val())
+				}
+			case "transparent":
+				// X-Forwarded-For is always added by the reverse proxy
+				upstream.UpstreamHeaders.Add("Host", "{host}")
+				upstream.UpstreamHeaders.Add("X-Real-IP", "{remote}")
+				upstream.UpstreamHeaders.Add("X-Forwarded-Proto", "{scheme}")
+				upstream.UpstreamHeaders.Add("X-Forwarded-Port", "{server_port}")
+			case "client_certificate":
+				// with pem, the whole certificate is sent too
+				args := c.RemainingArgs()
+				if len(args) > 1 || len(args) == 1 && args[0] != "pem" {
+					return upstreams, c.ArgErr()
+				}
+				for header, placeholder := range clientCertHeaders {
+					upstream.UpstreamHeaders.Set(header, placeholder)
+				}
+				if len(args) == 1 {
+					upstream.UpstreamHeaders.Set("X-Client-Cert", "{tls_client_certificate}")
+				}
 			case "without":
 				if !c.NextArg() {
 					return upstreams, c.ArgErr()
 				}
 				upstream.WithoutPathPrefix = c.Val()
+			case "ajp_secret":
+				if !c.NextArg() {
+					return upstreams, c.ArgErr()
+				}
+				secret, err := c.Secret(c.Val())
+				if err != nil {
+					return upstreams, err
+				}
+				upstream.AJPSecret = secret
+			case "ajp_timeout":
+				if !c.NextArg() {
+					return upstreams, c.ArgErr()
+				}
+				dur, err := time.ParseDuration(c.Val())
+				if err != nil || dur <= 0 {
+					return upstreams, c.Errf("Invalid timeout '%s'", c.Val())
+				}
+				upstream.AJPTimeout = dur
+			case "ajp_max_body":
+				if !c.NextArg() {
+					return upstreams, c.ArgErr()
+				}
+				size, err := humanize.ParseBytes(c.Val())
+				if err != nil || size < 1 || size > math.MaxInt64 {
+					return upstreams, c.Errf("Invalid size '%s'", c.Val())
+				}
+				upstream.AJPMaxBufferedBody = int64(size)
+			case "header_downstream":
+				if upstream.Downstream.Headers == nil {
+					upstream.Downstream.Headers = make(http.Header)
+				}
+				args := c.RemainingArgs()
+				if len(args) == 1 && strings.HasPrefix(args[0], "-") {
+					upstream.Downstream.Headers["-"+http.CanonicalHeaderKey(args[0][1:])] = nil
+				} else if len(args) == 2 && !strings.HasPrefix(args[0], "-") {
+					upstream.Downstream.Headers.Add(args[0], args[1])
+				} else {
+					return upstreams, c.ArgErr()
+				}
+			case "rewrite_location", "rewrite_cookie_domain", "rewrite_cookie_path":
+				var rw Rewrite
+				what := c.Val()
+				if !c.Args(&rw.From, &rw.To) {
+					return upstreams, c.ArgErr()
+				}
+				switch what {
+				case "rewrite_location":
+					upstream.Downstream.Location = append(upstream.Downstream.Location, rw)
+				case "rewrite_cookie_domain":
+					upstream.Downstream.CookieDomain = append(upstream.Downstream.CookieDomain, rw)
+				case "rewrite_cookie_path":
+					upstream.Downstream.CookiePath = append(upstream.Downstream.CookiePath, rw)
+				}
+			case "cookie_secure":
+				if c.NextArg() {
+					return upstreams, c.ArgErr()
+				}
+				upstream.Downstream.CookieSecure = true
+			case "cookie_samesite":
+				if !c.NextArg() {
+					return upstreams, c.ArgErr()
+				}
+				switch strings.ToLower(c.Val()) {
+				case "strict":
+					upstream.Downstream.CookieSameSite = "Strict"
+				case "lax":
+					upstream.Downstream.CookieSameSite = "Lax"
+				case "none":
+					upstream.Downstream.CookieSameSite = "None"
+				default:
+					return upstreams, c.Errf("Invalid cookie_samesite '%s'; use Strict, Lax or None", c.Val())
+				}
+				if c.NextArg() {
+					return upstreams, c.ArgErr()
+				}
+			case "discover":
+				if !c.NextArg() {
+					return upstreams, c.ArgErr()
+				}
+				upstream.Discoverers = append(upstream.Discoverers, ListDiscoverer{Source: c.Val()})
+			case "dial_timeout", "header_timeout":
+				what := c.Val()
+				if !c.NextArg() {
+					return upstreams, c.ArgErr()
+				}
+				dur, err := time.ParseDuration(c.Val())
+				if err != nil || dur <= 0 {
+					return upstreams, c.Errf("Invalid timeout '%s'", c.Val())
+				}
+				if what == "dial_timeout" {
+					upstream.DialTimeout = dur
+				} else {
+					upstream.HeaderTimeout = dur
+				}
+			case "expect_continue":
+				if !c.NextArg() {
+					return upstreams, c.ArgErr()
+				}
+				if c.Val() == "off" {
+					upstream.ContinueTimeout = -1
+					break
+				}
+				dur, err := time.ParseDuration(c.Val())
+				if err != nil || dur <= 0 {
+					return upstreams, c.Errf("Invalid timeout '%s'", c.Val())
+				}
+				upstream.ContinueTimeout = dur
+			case "timeout":
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return upstreams, c.ArgErr()
+				}
+				dur, err := time.ParseDuration(args[len(args)-1])
+				if err != nil || dur <= 0 {
+					return upstreams, c.Errf("Invalid timeout '%s'", args[len(args)-1])
+				}
+				if len(args) == 1 {
+					upstream.Timeout = dur
+				} else {
+					upstream.PathTimeouts = append(upstream.PathTimeouts, PathTimeout{Path: args[0], Timeout: dur})
+				}
+			case "discover_interval":
+				if !c.NextArg() {
+					return upstreams, c.ArgErr()
+				}
+				dur, err := time.ParseDuration(c.Val())
+				if err != nil || dur <= 0 {
+					return upstreams, c.Errf("Invalid discover interval '%s'", c.Val())
+				}
+				upstream.DiscoverInterval = dur
 			}
 		}
 
-		upstream.Hosts = make([]*UpstreamHost, len(to))
-		for i, host := range to {
-			if !strings.HasPrefix(host, "http") {
-				host = "http://" + host
-			}
-			uh := &UpstreamHost{
-				Name:         host,
-				Conns:        0,
-				Fails:        0,
-				FailTimeout:  upstream.FailTimeout,
-				Unhealthy:    false,
-				ExtraHeaders: proxyHeaders,
-				CheckDown: func(upstream *staticUpstream) UpstreamHostDownFunc {
-					return func(uh *UpstreamHost) bool {
-						if uh.Unhealthy {
-							return true
-						}
-						if uh.Fails >= upstream.MaxFails &&
-							upstream.MaxFails != 0 {
-							return true
-						}
-						return false
+		if len(upstream.static) == 0 && len(upstream.Discoverers) == 0 {
+			return upstreams, c.ArgErr()
+		}
+
+		upstream.Downstream.Prefix = upstream.WithoutPathPrefix
+		upstream.ajp = &AJPTransport{
+			Secret:          upstream.AJPSecret,
+			DialTimeout:     upstream.DialTimeout,
+			Timeout:         upstream.AJPTimeout,
+			MaxBufferedBody: upstream.AJPMaxBufferedBody,
+		}
+		if upstream.DialTimeout != 0 || upstream.HeaderTimeout != 0 || upstream.ContinueTimeout != 0 {
+			upstream.transport = upstream.newTransport()
+		}
+
+		hosts, err := upstream.newHosts(upstream.static)
+		if err != nil {
+			return upstreams, err
+		}
+		upstream.Hosts = hosts
+
+		if len(upstream.Discoverers) > 0 && upstream.DiscoverInterval == 0 {
+			upstream.DiscoverInterval = DefaultDiscoverInterval
+		}
+		upstreams = append(upstreams, upstream)
+	}
+	return upstreams, nil
+}
+
+// newHosts makes hosts for the addresses in names.
+func (u *staticUpstream) newHosts(names []string) (HostPool, error) {
+	hosts := make(HostPool, len(names))
+	for i, host := range names {
+		if !strings.HasPrefix(host, "http") && !strings.HasPrefix(host, "ajp://") {
+			host = "http://" + host
+		}
+		uh := &UpstreamHost{
+			Name:         host,
+			Conns:        0,
+			Fails:        0,
+			FailTimeout:  u.FailTimeout,
+			Unhealthy:    false,
+			ExtraHeaders: u.UpstreamHeaders,
+			CheckDown: func(upstream *staticUpstream) UpstreamHostDownFunc {
+				return func(uh *UpstreamHost) bool {
+					if uh.Unhealthy {
+						return true
+					}
+					if uh.Fails >= upstream.MaxFails &&
+						upstream.MaxFails != 0 {
+						return true
 					}
-				}(upstream),
-				WithoutPathPrefix: upstream.WithoutPathPrefix,
+					return false
+				}
+			}(u),
+			WithoutPathPrefix: u.WithoutPathPrefix,
+		}
+		if baseURL, err := url.Parse(uh.Name); err == nil {
+			uh.ReverseProxy = NewSingleHostReverseProxy(baseURL, uh.WithoutPathPrefix)
+			if !u.Downstream.empty() {
+				uh.ReverseProxy.ModifyResponse = u.Downstream.Apply
 			}
-			if baseURL, err := url.Parse(uh.Name); err == nil {
-				uh.ReverseProxy = NewSingleHostReverseProxy(baseURL, uh.WithoutPathPrefix)
-			} else {
-				return upstreams, err
+			uh.ReverseProxy.Timeout = u.Timeout
+			uh.ReverseProxy.PathTimeouts = u.PathTimeouts
+			uh.ReverseProxy.StripWebSocketCompression = u.NoWebSocketCompression
+			if baseURL.Scheme == "ajp" {
+				uh.ReverseProxy.Transport = u.ajp
+			} else if u.transport != nil {
+				uh.ReverseProxy.Transport = u.transport
 			}
-			upstream.Hosts[i] = uh
+		} else {
+			return hosts, err
 		}
+		hosts[i] = uh
+	}
+	return hosts, nil
+}
 
-		if upstream.HealthCheck.Path != "" {
-			go upstream.HealthCheckWorker(nil)
+// newTransport returns a transport like http.DefaultTransport,
+// but with the upstream's timeouts for connecting to a host, for
+// waiting for the response headers once the request is sent, and
+// for waiting for a 100 Continue response before sending the body.
+func (u *staticUpstream) newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if u.DialTimeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   u.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+	transport.ResponseHeaderTimeout = u.HeaderTimeout
+	switch {
+	case u.ContinueTimeout < 0:
+		transport.ExpectContinueTimeout = 0
+	case u.ContinueTimeout > 0:
+		transport.ExpectContinueTimeout = u.ContinueTimeout
+	}
+	return transport
+}
+
+// discover updates the pool with the static hosts and the hosts
+// found by each discoverer. Hosts that were in the pool before keep
+// their state. If a discoverer fails, the pool is left as it is.
+func (u *staticUpstream) discover() error {
+	names := append([]string(nil), u.static...)
+	for _, d := range u.Discoverers {
+		found, err := d.Discover()
+		if err != nil {
+			return err
 		}
-		upstreams = append(upstreams, upstream)
+		names = append(names, found...)
 	}
-	return upstreams, nil
+
+	fresh, err := u.newHosts(names)
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	existing := make(map[string]*UpstreamHost, len(u.Hosts))
+	for _, host := range u.Hosts {
+		existing[host.Name] = host
+	}
+	for i, host := range fresh {
+		if old, ok := existing[host.Name]; ok {
+			fresh[i] = old
+		}
+	}
+	u.Hosts = fresh
+	return nil
 }
 
-// RegisterPolicy adds a custom policy to the proxy.
+// Start implements the Worker interface. The hosts are discovered
+// before it returns, so that the pool is complete when the site is
+// served, then rediscovered and health checked in the background.
+func (u *staticUpstream) Start() error {
+	u.mu.Lock()
+	if u.stop != nil {
+		u.mu.Unlock()
+		return nil
+	}
+	stop := make(chan struct{})
+	u.stop = stop
+	u.mu.Unlock()
+
+	if len(u.Discoverers) > 0 {
+		if err := u.discover(); err != nil {
+			log.Printf("[Warning] proxy %s: %v", u.from, err)
+		}
+		go u.DiscoverWorker(stop)
+	}
+	if u.HealthCheck.Path != "" {
+		go u.HealthCheckWorker(stop)
+	}
+	return nil
+}
+
+// Stop implements the Worker interface.
+func (u *staticUpstream) Stop() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.stop != nil {
+		close(u.stop)
+		u.stop = nil
+	}
+	return nil
+}
+
+// DiscoverWorker rediscovers the upstream's hosts
+// every DiscoverInterval until stop is closed.
+func (u *staticUpstream) DiscoverWorker(stop chan struct{}) {
+	ticker := time.NewTicker(u.DiscoverInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := u.discover(); err != nil {
+				log.Printf("[Warning] proxy %s: %v", u.from, err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// pool returns the current hosts of the upstream.
+func (u *staticUpstream) pool() HostPool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.Hosts
+}
+
+// RegisterPolicy adds a custom policy to the proxy, which can then be
+// used by name in the policy subdirective. If the policies it makes
+// implement PolicyConfigurer, they are given the arguments after the
+// name.
 func RegisterPolicy(name string, policy func() Policy) {
 	supportedPolicies[name] = policy
 }
 
+// Retries implements the Retrier interface.
+func (u *staticUpstream) Retries() (duration, interval time.Duration) {
+	return u.TryDuration, u.TryInterval
+}
+
+// StaticHosts implements HostLister.
+func (u *staticUpstream) StaticHosts() []string {
+	return u.static
+}
+
 func (u *staticUpstream) From() string {
 	return u.from
 }
 
 func (u *staticUpstream) healthCheck() {
-	for _, host := range u.Hosts {
+	for _, host := range u.pool() {
 		hostURL := host.Name + u.HealthCheck.Path
-		if r, err := http.Get(hostURL); err == nil {
+		client := http.DefaultClient
+		if host.ReverseProxy != nil && host.ReverseProxy.Transport != nil {
+			client = &http.Client{Transport: host.ReverseProxy.Transport}
+		}
+		if r, err := client.Get(hostURL); err == nil {
 			io.Copy(ioutil.Discard, r.Body)
 			r.Body.Close()
 			host.Unhealthy = r.StatusCode < 200 || r.StatusCode >= 400
@@ -178,21 +584,23 @@ func (u *staticUpstream) healthCheck() {
 
 func (u *staticUpstream) HealthCheckWorker(stop chan struct{}) {
 	ticker := time.NewTicker(u.HealthCheck.Interval)
+	defer ticker.Stop()
 	u.healthCheck()
 	for {
 		select {
 		case <-ticker.C:
 			u.healthCheck()
 		case <-stop:
-			// TODO: the library should provide a stop channel and global
-			// waitgroup to allow goroutines started by plugins a chance
-			// to clean themselves up.
+			return
 		}
 	}
 }
 
-func (u *staticUpstream) Select() *UpstreamHost {
-	pool := u.Hosts
+func (u *staticUpstream) Select(r *http.Request) *UpstreamHost {
+	pool := u.pool()
+	if len(pool) == 0 {
+		return nil
+	}
 	if len(pool) == 1 {
 		if pool[0].Down() {
 			return nil
@@ -211,7 +619,7 @@ func (u *staticUpstream) Select() *UpstreamHost {
 	}
 
 	if u.Policy == nil {
-		return (&Random{}).Select(pool)
+		return (&Random{}).Select(pool, r)
 	}
-	return u.Policy.Select(pool)
+	return u.Policy.Select(pool, r)
 }
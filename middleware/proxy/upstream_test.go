@@ -1,8 +1,16 @@
 package proxy
 
 import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/mholt/caddy/config/parse"
 )
 
 func TestHealthCheck(t *testing.T) {
@@ -33,11 +41,11 @@ func TestSelect(t *testing.T) {
 	upstream.Hosts[0].Unhealthy = true
 	upstream.Hosts[1].Unhealthy = true
 	upstream.Hosts[2].Unhealthy = true
-	if h := upstream.Select(); h != nil {
+	if h := upstream.Select(nil); h != nil {
 		t.Error("Expected select to return nil as all host are down")
 	}
 	upstream.Hosts[2].Unhealthy = false
-	if h := upstream.Select(); h == nil {
+	if h := upstream.Select(nil); h == nil {
 		t.Error("Expected select to not return nil")
 	}
 }
@@ -51,3 +59,213 @@ func TestRegisterPolicy(t *testing.T) {
 	}
 
 }
+
+func TestAJPUpstream(t *testing.T) {
+	t.Setenv("CADDY_TEST_AJP_SECRET", "s3cret")
+	upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile", strings.NewReader(`proxy / ajp://localhost:8009 localhost:8080 {
+		ajp_secret env:CADDY_TEST_AJP_SECRET
+		ajp_timeout 5s
+		ajp_max_body 1MB
+	}`)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	hosts := upstreams[0].(*staticUpstream).Hosts
+
+	transport, ok := hosts[0].ReverseProxy.Transport.(*AJPTransport)
+	if !ok {
+		t.Fatalf("Expected AJP transport for ajp:// host, got %#v", hosts[0].ReverseProxy.Transport)
+	}
+	if transport.Secret != "s3cret" {
+		t.Errorf("Expected secret 's3cret', got '%s'", transport.Secret)
+	}
+	if transport.Timeout != 5*time.Second || transport.MaxBufferedBody != 1000000 {
+		t.Errorf("Expected timeout 5s and body limit 1MB, got %v and %d", transport.Timeout, transport.MaxBufferedBody)
+	}
+	if hosts[1].Name != "http://localhost:8080" {
+		t.Errorf("Expected http://localhost:8080, got '%s'", hosts[1].Name)
+	}
+	if hosts[1].ReverseProxy.Transport != nil {
+		t.Errorf("Expected default transport for HTTP host, got %#v", hosts[1].ReverseProxy.Transport)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	list, err := ioutil.TempFile("", "caddy-upstreams")
+	if err != nil {
+		t.Fatalf("Unable to create temp file: %v", err)
+	}
+	defer os.Remove(list.Name())
+	list.WriteString(`["10.0.0.1:8080", "http://10.0.0.2:8080"]`)
+	list.Close()
+
+	upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile", strings.NewReader(`proxy / localhost:8080 {
+		discover `+list.Name()+`
+		discover_interval 1h
+	}`)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	upstream := upstreams[0].(*staticUpstream)
+	if got := len(upstream.pool()); got != 1 {
+		t.Errorf("Expected only the static host before Start, got %d hosts", got)
+	}
+	if err := upstream.Start(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer upstream.Stop()
+
+	names := func() []string {
+		var names []string
+		for _, host := range upstream.pool() {
+			names = append(names, host.Name)
+		}
+		return names
+	}
+	expected := []string{"http://localhost:8080", "http://10.0.0.1:8080", "http://10.0.0.2:8080"}
+	if got := names(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected hosts %v, got %v", expected, got)
+	}
+
+	// hosts that stay in the pool keep their state
+	upstream.pool()[1].Fails = 1
+	ioutil.WriteFile(list.Name(), []byte(`["10.0.0.1:8080", "10.0.0.3:8080"]`), 0644)
+	if err := upstream.discover(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected = []string{"http://localhost:8080", "http://10.0.0.1:8080", "http://10.0.0.3:8080"}
+	if got := names(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected hosts %v, got %v", expected, got)
+	}
+	if upstream.pool()[1].Fails != 1 {
+		t.Error("Expected host that stayed in the pool to keep its state")
+	}
+
+	// a failed discovery leaves the pool as it is
+	ioutil.WriteFile(list.Name(), []byte(`not json`), 0644)
+	if err := upstream.discover(); err == nil {
+		t.Error("Expected error for malformed list, got none")
+	}
+	if got := names(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected hosts %v after failed discovery, got %v", expected, got)
+	}
+}
+
+func TestListDiscovererTimeout(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	d := ListDiscoverer{Source: slow.URL, Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	if _, err := d.Discover(); err == nil {
+		t.Error("Expected error from a source that doesn't respond, got none")
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("Expected discovery to give up after its timeout, but it took %v", took)
+	}
+}
+
+func TestUpstreamStop(t *testing.T) {
+	upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile", strings.NewReader(`proxy / srv://_http._tcp.invalid {
+		discover_interval 1h
+	}`)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	w, ok := upstreams[0].(Worker)
+	if !ok {
+		t.Fatal("Expected the upstream to be a Worker")
+	}
+	for i := 0; i < 2; i++ {
+		if err := w.Start(); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if err := w.Stop(); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if upstreams[0].(*staticUpstream).stop != nil {
+			t.Error("Expected Stop to stop the workers")
+		}
+	}
+	// stopping twice is harmless
+	w.Stop()
+}
+
+func TestDiscoveryParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+	}{
+		{`proxy / srv://_http._tcp.invalid`, false},
+		{`proxy / srv+https://_https._tcp.invalid localhost:8080`, false},
+		{`proxy / {
+			discover http://127.0.0.1:1/upstreams.json
+		}`, false},
+		{`proxy /`, true},
+		{`proxy / {
+			discover
+		}`, true},
+		{`proxy / localhost:8080 {
+			discover_interval never
+		}`, true},
+	} {
+		_, err := NewStaticUpstreams(parse.NewDispenser("Testfile", strings.NewReader(test.input)))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+	}
+}
+
+func TestPolicyParse(t *testing.T) {
+	for i, test := range []struct {
+		input     string
+		shouldErr bool
+	}{
+		{`proxy / localhost:8080 {
+			policy round_robin
+		}`, false},
+		{`proxy / localhost:8080 {
+			policy header X-User
+		}`, false},
+		{`proxy / localhost:8080 {
+			policy header
+		}`, true},
+		{`proxy / localhost:8080 {
+			policy round_robin X-User
+		}`, true},
+		{`proxy / localhost:8080 {
+			policy nonexistent
+		}`, true},
+	} {
+		upstreams, err := NewStaticUpstreams(parse.NewDispenser("Testfile", strings.NewReader(test.input)))
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if i == 1 && err == nil {
+			if p, ok := upstreams[0].(*staticUpstream).Policy.(*Header); !ok || p.Name != "X-User" {
+				t.Errorf("Test %d: Expected header policy on X-User, got %#v", i, upstreams[0].(*staticUpstream).Policy)
+			}
+		}
+	}
+}
+
+func TestSRVDiscoverer(t *testing.T) {
+	d, ok := srvDiscoverer("srv+https://_https._tcp.example.com")
+	if !ok {
+		t.Fatal("Expected srv+https:// to be an SRV name")
+	}
+	if srv := d.(SRVDiscoverer); srv.Name != "_https._tcp.example.com" || srv.Scheme != "https" {
+		t.Errorf("Expected _https._tcp.example.com with scheme https, got %#v", srv)
+	}
+	if _, ok := srvDiscoverer("http://example.com"); ok {
+		t.Error("Expected http:// not to be an SRV name")
+	}
+}
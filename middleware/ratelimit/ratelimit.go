@@ -0,0 +1,83 @@
+// Package ratelimit provides middleware that limits the rate of
+// requests, by client IP address or by request path, with token
+// buckets: each key may make Burst requests at once, and its
+// bucket refills at Rate requests per second. Requests over the
+// limit get 429 Too Many Requests, which the errors middleware
+// can serve a page for.
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// RateLimit is middleware that limits the rate of requests
+// according to Rules, keeping the buckets in Store.
+type RateLimit struct {
+	Next  middleware.Handler
+	Rules []Rule
+	Store Store
+}
+
+// Rule is a limit on the requests under a path.
+type Rule struct {
+	Path  string
+	Rate  float64 // requests per second
+	Burst int     // requests at once
+	By    Key     // what requests are counted together
+}
+
+// Key says which requests share a bucket.
+type Key int
+
+const (
+	// ByIP gives each client IP address a bucket.
+	ByIP Key = iota
+
+	// ByPath gives each request path a bucket,
+	// shared by all clients.
+	ByPath
+)
+
+// ServeHTTP implements the middleware.Handler interface.
+func (rl RateLimit) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	now := time.Now()
+	for i, rule := range rl.Rules {
+		if !middleware.Path(r.URL.Path).Matches(rule.Path) {
+			continue
+		}
+		ok, wait := rl.Store.Take(rule.key(i, r), rule.Rate, rule.Burst, now)
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return http.StatusTooManyRequests, nil
+		}
+	}
+	return rl.Next.ServeHTTP(w, r)
+}
+
+// key returns the key of r's bucket for the rule at index i.
+func (rule Rule) key(i int, r *http.Request) string {
+	prefix := strconv.Itoa(i) + " "
+	if rule.By == ByPath {
+		return prefix + r.URL.Path
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return prefix + ip
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (rl RateLimit) Scopes() []string {
+	scopes := make([]string, len(rl.Rules))
+	for i, rule := range rl.Rules {
+		scopes[i] = rule.Path
+	}
+	return scopes
+}
@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware/storage"
+	mwtest "github.com/mholt/caddy/middleware/testing"
+)
+
+func TestRateLimit(t *testing.T) {
+	rl := RateLimit{
+		Next: &mwtest.Handler{},
+		Rules: []Rule{
+			{Path: "/api", Rate: 1, Burst: 2},
+			{Path: "/search", Rate: 1, Burst: 1, By: ByPath},
+		},
+		Store: NewMemoryStore(0),
+	}
+
+	for i, test := range []struct {
+		path           string
+		remote         string
+		expectedStatus int
+	}{
+		{"/api/a", "1.2.3.4:1000", http.StatusOK},
+		{"/api/b", "1.2.3.4:1001", http.StatusOK},
+		{"/api/c", "1.2.3.4:1002", http.StatusTooManyRequests}, // burst used up
+		{"/api/c", "5.6.7.8:1000", http.StatusOK},              // another client
+		{"/other", "1.2.3.4:1003", http.StatusOK},              // not limited
+		{"/search", "1.2.3.4:1004", http.StatusOK},
+		{"/search", "5.6.7.8:1001", http.StatusTooManyRequests}, // same path
+		{"/search/x", "5.6.7.8:1002", http.StatusOK},            // another path
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.RemoteAddr = test.remote
+		rec := mwtest.Serve(rl, r)
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, rec.Code)
+		}
+		if test.expectedStatus == http.StatusTooManyRequests {
+			rec.AssertHeader(t, "Retry-After", "1")
+		}
+	}
+
+	if scopes := rl.Scopes(); len(scopes) != 2 || scopes[0] != "/api" || scopes[1] != "/search" {
+		t.Errorf("Expected the rules' paths as scopes, got %v", scopes)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(0))
+}
+
+func TestStorageStore(t *testing.T) {
+	m := storage.NewMemory()
+	s := StorageStore{Storage: m, Prefix: "ratelimit/"}
+	testStore(t, s)
+
+	if keys, _ := m.List("ratelimit/"); len(keys) != 1 || keys[0] != "ratelimit/a" {
+		t.Errorf("Expected the bucket under the prefix, got %v", keys)
+	}
+
+	// buckets in a failing storage don't refuse requests
+	for i := 0; i < 3; i++ {
+		if ok, _ := (StorageStore{Storage: failingStorage{m}}).Take("b", 1, 1, time.Now()); !ok {
+			t.Error("Expected requests to be let through when the storage fails")
+		}
+	}
+}
+
+type failingStorage struct{ storage.Storage }
+
+func (failingStorage) Update(string, time.Duration, func([]byte) ([]byte, error)) error {
+	return errors.New("unreachable")
+}
+
+// testStore checks the buckets of s.
+func testStore(t *testing.T, s Store) {
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := s.Take("a", 2, 3, now); !ok {
+			t.Errorf("Expected token %d of the burst to be taken", i)
+		}
+	}
+	ok, wait := s.Take("a", 2, 3, now)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("Expected to wait 500ms for a token, got %v, %v", ok, wait)
+	}
+	if ok, _ := s.Take("a", 2, 3, now.Add(500*time.Millisecond)); !ok {
+		t.Error("Expected a token after it refilled")
+	}
+	if ok, _ := s.Take("a", 2, 3, now.Add(500*time.Millisecond)); ok {
+		t.Error("Expected no token right after taking the refilled one")
+	}
+	if ok, _ := s.Take("a", 2, 3, now.Add(time.Hour)); !ok {
+		t.Error("Expected a token much later")
+	}
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	s := NewMemoryStore(10)
+	now := time.Now()
+
+	// full buckets are evicted first
+	for i := 0; i < 10; i++ {
+		s.Take(fmt.Sprint("idle", i), 1, 1, now)
+	}
+	s.Take("busy", 1, 1, now.Add(time.Minute))
+	if n := s.Len(); n != 1 {
+		t.Errorf("Expected the refilled buckets to be evicted, leaving 1, got %d", n)
+	}
+
+	// then the ones used longest ago
+	for i := 0; i < 10; i++ {
+		s.Take(fmt.Sprint("busy", i), 1, 5, now.Add(time.Duration(i)*time.Millisecond))
+	}
+	s.Take("new", 1, 5, now.Add(time.Second))
+	if n := s.Len(); n > 10 {
+		t.Errorf("Expected at most 10 buckets, got %d", n)
+	}
+	if ok, _ := s.Take("busy9", 1, 5, now.Add(time.Second)); !ok {
+		t.Error("Expected the most recently used bucket to be kept")
+	}
+}
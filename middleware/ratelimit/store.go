@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/middleware/storage"
+)
+
+// Store keeps token buckets, so that other stores, like
+// one shared by several servers, can back the limits.
+type Store interface {
+	// Take takes a token from the bucket of key, which refills
+	// at rate tokens per second and holds at most burst, at time
+	// now. If the bucket is empty, it returns false and how long
+	// until there is a token.
+	Take(key string, rate float64, burst int, now time.Time) (bool, time.Duration)
+}
+
+// DefaultMaxKeys is how many buckets a MemoryStore
+// keeps at most if its MaxKeys isn't set.
+const DefaultMaxKeys = 100000
+
+// MemoryStore is a Store that keeps the buckets in memory.
+// Buckets that are full are the same as no bucket, so they
+// are evicted when there are MaxKeys of them; if they still
+// don't fit, the ones used longest ago are.
+type MemoryStore struct {
+	MaxKeys int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time // when tokens was last updated
+}
+
+// NewMemoryStore returns a MemoryStore that keeps at most
+// maxKeys buckets, or DefaultMaxKeys if maxKeys is 0.
+func NewMemoryStore(maxKeys int) *MemoryStore {
+	if maxKeys == 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	return &MemoryStore{MaxKeys: maxKeys, buckets: make(map[string]*bucket)}
+}
+
+// Take implements Store.
+func (s *MemoryStore) Take(key string, rate float64, burst int, now time.Time) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		if len(s.buckets) >= s.MaxKeys {
+			s.evict(rate, burst, now)
+		}
+		b = &bucket{tokens: float64(burst), last: now}
+		s.buckets[key] = b
+	}
+	b.refill(rate, burst, now)
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Len returns how many buckets s keeps.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+// refill adds the tokens the bucket has earned since it was last
+// updated.
+func (b *bucket) refill(rate float64, burst int, now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * rate
+		if b.tokens > float64(burst) {
+			b.tokens = float64(burst)
+		}
+		b.last = now
+	}
+}
+
+// evict makes room for a bucket: it removes those that are full
+// by now, and if that isn't enough, the tenth that were used
+// longest ago. Buckets of other rules are assumed to refill
+// like this one's, which at worst is lenient.
+func (s *MemoryStore) evict(rate float64, burst int, now time.Time) {
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rate >= float64(burst) {
+			delete(s.buckets, key)
+		}
+	}
+	if len(s.buckets) < s.MaxKeys {
+		return
+	}
+
+	times := make([]time.Time, 0, len(s.buckets))
+	for _, b := range s.buckets {
+		times = append(times, b.last)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	cutoff := times[len(times)/10]
+	for key, b := range s.buckets {
+		if !b.last.After(cutoff) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// StorageStore is a Store that keeps the buckets in a Storage,
+// like one that several servers share, under keys that start
+// with Prefix. A bucket expires when even an empty one would be
+// full again, since a full bucket is the same as none. If the
+// storage fails, the error is logged and requests are let through
+// rather than refused.
+type StorageStore struct {
+	Storage storage.Storage
+	Prefix  string
+}
+
+// Take implements Store.
+func (s StorageStore) Take(key string, rate float64, burst int, now time.Time) (bool, time.Duration) {
+	var ok bool
+	var wait time.Duration
+
+	ttl := time.Duration(float64(burst)/rate*float64(time.Second)) + time.Second
+	err := s.Storage.Update(s.Prefix+key, ttl, func(value []byte) ([]byte, error) {
+		b := bucket{tokens: float64(burst), last: now}
+		var tokens float64
+		var last int64
+		if _, err := fmt.Sscanf(string(value), "%g %d", &tokens, &last); err == nil {
+			b = bucket{tokens: tokens, last: time.Unix(0, last)}
+		}
+		b.refill(rate, burst, now)
+
+		ok, wait = b.tokens >= 1, 0
+		if ok {
+			b.tokens--
+		} else {
+			wait = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		}
+		return []byte(fmt.Sprintf("%g %d", b.tokens, b.last.UnixNano())), nil
+	})
+	if err != nil {
+		log.Printf("[ERROR] ratelimit: %s: %v; letting the request through", key, err)
+		return true, 0
+	}
+	return ok, wait
+}
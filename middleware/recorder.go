@@ -3,6 +3,7 @@ package middleware
 import (
 	"bufio"
 	"errors"
+	"io"
 	"net"
 	"net/http"
 	"time"
@@ -37,11 +38,36 @@ func NewResponseRecorder(w http.ResponseWriter) *responseRecorder {
 
 // WriteHeader records the status code and calls the
 // underlying ResponseWriter's WriteHeader method.
+// Informational (1xx) responses come before the
+// final one, so they are passed on without being
+// recorded.
 func (r *responseRecorder) WriteHeader(status int) {
+	if status < 200 && status != http.StatusSwitchingProtocols {
+		r.ResponseWriter.WriteHeader(status)
+		return
+	}
 	r.status = status
 	r.ResponseWriter.WriteHeader(status)
 }
 
+// Unsent records status as the status of a response that
+// won't be written, like StatusClientClosedRequest.
+func (r *responseRecorder) Unsent(status int) {
+	r.status = status
+}
+
+// Status returns the status code of the response; 200
+// if none was written.
+func (r *responseRecorder) Status() int {
+	return r.status
+}
+
+// Size returns the number of bytes of the body
+// written so far.
+func (r *responseRecorder) Size() int {
+	return r.size
+}
+
 // Write is a wrapper that records the size of the body
 // that gets written.
 func (r *responseRecorder) Write(buf []byte) (int, error) {
@@ -52,6 +78,22 @@ func (r *responseRecorder) Write(buf []byte) (int, error) {
 	return n, err
 }
 
+// ReadFrom lets the underlying ResponseWriter read the body
+// directly from src if it can, which it does with sendfile
+// when src is a file; otherwise it copies like io.Copy. It
+// records the size of the body.
+func (r *responseRecorder) ReadFrom(src io.Reader) (int64, error) {
+	var n int64
+	var err error
+	if rf, ok := r.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(struct{ io.Writer }{r.ResponseWriter}, src)
+	}
+	r.size += int(n)
+	return n, err
+}
+
 // Hijacker is a wrapper of http.Hijacker underearth if any,
 // otherwise it just returns an error.
 func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
@@ -60,3 +102,21 @@ func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	}
 	return nil, nil, errors.New("I'm not a Hijacker")
 }
+
+// Flush is a wrapper of http.Flusher underneath if any,
+// otherwise it does nothing.
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// CloseNotify is a wrapper of http.CloseNotifier underneath
+// if any, otherwise it returns a nil channel, which never
+// receives.
+func (r *responseRecorder) CloseNotify() <-chan bool {
+	if cn, ok := r.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return nil
+}
@@ -50,3 +50,13 @@ const metaRedir = `<!DOCTYPE html>
 	</head>
 	<body>Redirecting...</body>
 </html>`
+
+// Scopes implements the middleware.Scoped interface. Rules
+// match paths exactly, except for "/" which matches all.
+func (rd Redirect) Scopes() []string {
+	scopes := make([]string, len(rd.Rules))
+	for i, rule := range rd.Rules {
+		scopes[i] = rule.From
+	}
+	return scopes
+}
@@ -12,8 +12,16 @@ import (
 // substrings in a string with actual values from a
 // http.Request and responseRecorder. Always use
 // NewReplacer to get one of these.
+//
+// The placeholders are {method}, {scheme}, {host}, {path},
+// {query}, {fragment}, {proto}, {remote}, {port}, {server_port},
+// {uri} and {when}; {>Name} for the request header Name and
+// {?name} for the query argument name; and, if there is a
+// response, {status}, {size} and {latency}. Middleware can
+// add placeholders of its own with Set.
 type Replacer interface {
 	Replace(string) string
+	Set(key, value string)
 }
 
 type replacer struct {
@@ -57,6 +65,17 @@ func NewReplacer(r *http.Request, rr *responseRecorder, emptyValue string) Repla
 				}
 				return port
 			}(),
+			"{server_port}": func() string {
+				// the port the client addressed, which
+				// is implied by the scheme if not given
+				if _, port, err := net.SplitHostPort(r.Host); err == nil {
+					return port
+				}
+				if r.TLS != nil {
+					return "443"
+				}
+				return "80"
+			}(),
 			"{uri}": r.URL.RequestURI(),
 			"{when}": func() string {
 				return time.Now().Format(timeFormat)
@@ -70,39 +89,77 @@ func NewReplacer(r *http.Request, rr *responseRecorder, emptyValue string) Repla
 		rep.replacements["{latency}"] = time.Since(rr.start).String()
 	}
 
+	clientCertReplacements(r, rep.replacements)
+
 	// Header placeholders
 	for header, val := range r.Header {
 		rep.replacements[headerReplacer+header+"}"] = strings.Join(val, ",")
 	}
 
+	// Query argument placeholders
+	for name, val := range r.URL.Query() {
+		rep.replacements[queryReplacer+name+"}"] = strings.Join(val, ",")
+	}
+
 	return rep
 }
 
+// Set sets the value of the placeholder key, like "{name}",
+// which is added if it isn't a placeholder already.
+func (r replacer) Set(key, value string) {
+	r.replacements[key] = value
+}
+
 // Replace performs a replacement of values on s and returns
-// the string with the replaced values.
+// the string with the replaced values. Placeholders are found
+// in one pass over s, so a replacement value (which may come
+// from the request) is never itself scanned for placeholders.
 func (r replacer) Replace(s string) string {
-	for placeholder, replacement := range r.replacements {
-		if replacement == "" {
-			replacement = r.emptyValue
-		}
-		s = strings.Replace(s, placeholder, replacement, -1)
+	if !strings.Contains(s, "{") {
+		return s
 	}
 
-	// Replace any header placeholders that weren't found
-	for strings.Contains(s, headerReplacer) {
-		idxStart := strings.Index(s, headerReplacer)
-		endOffset := idxStart + len(headerReplacer)
-		idxEnd := strings.Index(s[endOffset:], "}")
-		if idxEnd > -1 {
-			s = s[:idxStart] + r.emptyValue + s[endOffset+idxEnd+1:]
-		} else {
+	var out strings.Builder
+	for {
+		start := strings.Index(s, "{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
 			break
 		}
+		end += start
+
+		// an opening brace before the closing one starts
+		// the placeholder instead, as in "{{path}}"
+		if open := strings.LastIndex(s[start:end], "{"); open > 0 {
+			start += open
+		}
+
+		placeholder := s[start : end+1]
+		replacement, ok := r.replacements[placeholder]
+		if !ok && !strings.HasPrefix(placeholder, headerReplacer) &&
+			!strings.HasPrefix(placeholder, queryReplacer) {
+			// not a placeholder; leave it alone
+			out.WriteString(s[:end+1])
+			s = s[end+1:]
+			continue
+		}
+		if replacement == "" {
+			// includes any header or query placeholders that weren't found
+			replacement = r.emptyValue
+		}
+		out.WriteString(s[:start])
+		out.WriteString(replacement)
+		s = s[end+1:]
 	}
-	return s
+	out.WriteString(s)
+	return out.String()
 }
 
 const (
 	timeFormat     = "02/Jan/2006:15:04:05 -0700"
 	headerReplacer = "{>"
+	queryReplacer  = "{?"
 )
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReplacer(t *testing.T) {
+	r, err := http.NewRequest("GET", "http://example.com/a/b?x=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.RemoteAddr = "1.2.3.4:5678"
+	r.Header.Set("User-Agent", "{path} {>Referer}")
+	rep := NewReplacer(r, nil, "-")
+
+	for i, test := range []struct {
+		input, expected string
+	}{
+		{"{method} {host}{uri}", "GET example.com/a/b?x=1"},
+		{"{remote}:{port} {query}", "1.2.3.4:5678 x=1"},
+		{"{fragment}|{>Missing}|{>User-Agent}", "-|-|{path} {>Referer}"},
+		{"{unknown} {path", "{unknown} {path"},
+		{"{{path}} {>", "{/a/b} {>"},
+		{"{?x}|{?y}", "1|-"},
+	} {
+		if got := rep.Replace(test.input); got != test.expected {
+			t.Errorf("Test %d: Expected %q, got %q", i, test.expected, got)
+		}
+	}
+
+	rep.Set("{upstream}", "10.0.0.1:8080")
+	rep.Set("{path}", "/c")
+	if got, expected := rep.Replace("{upstream}{path}"), "10.0.0.1:8080/c"; got != expected {
+		t.Errorf("Expected %q after Set, got %q", expected, got)
+	}
+}
+
+func TestReplacerResponse(t *testing.T) {
+	r, err := http.NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := NewResponseRecorder(httptest.NewRecorder())
+	rr.WriteHeader(http.StatusNotFound)
+	rr.Write([]byte("gone"))
+
+	rep := NewReplacer(r, rr, "-")
+	if got, expected := rep.Replace("{status} {size}"), "404 4"; got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if got := rep.Replace("{latency}"); got == "-" || got == "{latency}" {
+		t.Errorf("Expected the latency, got %q", got)
+	}
+}
+
+func FuzzReplacer(f *testing.F) {
+	f.Add("{method} {path} {>User-Agent}", "curl/7.0", "-")
+	f.Add("{>", "{>", "{>X}")
+	f.Add("{{{}}}", "{host}", "")
+	f.Fuzz(func(t *testing.T, s, header, emptyValue string) {
+		r, err := http.NewRequest("GET", "http://example.com/", nil)
+		if err != nil {
+			t.Skip()
+		}
+		r.Header["User-Agent"] = []string{header}
+		rep := NewReplacer(r, nil, emptyValue)
+		if got, again := rep.Replace(s), rep.Replace(s); got != again {
+			t.Fatalf("Replacing %q gave %q, then %q", s, got, again)
+		}
+	})
+}
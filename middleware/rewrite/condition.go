@@ -0,0 +1,93 @@
+package rewrite
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Operators that conditions can compare with.
+const (
+	Is         = "is"
+	Not        = "not"
+	Has        = "has"
+	NotHas     = "not_has"
+	StartsWith = "starts_with"
+	EndsWith   = "ends_with"
+	Match      = "match"
+	NotMatch   = "not_match"
+)
+
+// operators maps each operator to what it does.
+var operators = map[string]func(a, b string, re *regexp.Regexp) bool{
+	Is:         func(a, b string, _ *regexp.Regexp) bool { return a == b },
+	Not:        func(a, b string, _ *regexp.Regexp) bool { return a != b },
+	Has:        func(a, b string, _ *regexp.Regexp) bool { return strings.Contains(a, b) },
+	NotHas:     func(a, b string, _ *regexp.Regexp) bool { return !strings.Contains(a, b) },
+	StartsWith: func(a, b string, _ *regexp.Regexp) bool { return strings.HasPrefix(a, b) },
+	EndsWith:   func(a, b string, _ *regexp.Regexp) bool { return strings.HasSuffix(a, b) },
+	Match:      func(a, _ string, re *regexp.Regexp) bool { return re.MatchString(a) },
+	NotMatch:   func(a, _ string, re *regexp.Regexp) bool { return !re.MatchString(a) },
+}
+
+// If is a condition that a request must meet to be rewritten,
+// like `{>User-Agent} has Mobile` or `{?lang} is de`. A and B
+// may have placeholders, which are replaced with values from
+// the request (see middleware.Replacer); a header or query
+// argument that the request lacks is replaced with nothing.
+// For match and not_match, B is a regular expression.
+type If struct {
+	A, Operator, B string
+
+	re *regexp.Regexp // B compiled, for match and not_match
+}
+
+// NewIf returns a condition that compares a to b with operator.
+// It returns an error if operator isn't known or, for match and
+// not_match, if b isn't a valid regular expression.
+func NewIf(a, operator, b string) (If, error) {
+	if _, ok := operators[operator]; !ok {
+		return If{}, fmt.Errorf("invalid condition operator %s", operator)
+	}
+	cond := If{A: a, Operator: operator, B: b}
+	if operator == Match || operator == NotMatch {
+		re, err := regexp.Compile(b)
+		if err != nil {
+			return If{}, err
+		}
+		cond.re = re
+	}
+	return cond, nil
+}
+
+// True returns true if r meets the condition.
+func (i If) True(r *http.Request) bool {
+	return i.met(middleware.NewReplacer(r, nil, ""))
+}
+
+// met returns true if the condition is met once
+// its placeholders are replaced by rep.
+func (i If) met(rep middleware.Replacer) bool {
+	op, ok := operators[i.Operator]
+	if !ok || (i.re == nil && (i.Operator == Match || i.Operator == NotMatch)) {
+		return false
+	}
+	return op(rep.Replace(i.A), rep.Replace(i.B), i.re)
+}
+
+// allTrue returns true if r meets all the conditions in ifs.
+func allTrue(ifs []If, r *http.Request) bool {
+	if len(ifs) == 0 {
+		return true
+	}
+	rep := middleware.NewReplacer(r, nil, "")
+	for _, i := range ifs {
+		if !i.met(rep) {
+			return false
+		}
+	}
+	return true
+}
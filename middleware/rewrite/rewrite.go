@@ -68,6 +68,9 @@ type RegexpRule struct {
 	Exts []string
 
 	*regexp.Regexp
+
+	// Conditions the request must also meet
+	Ifs []If
 }
 
 // NewRegexpRule creates a new RegexpRule. It returns an error if regexp
@@ -89,10 +92,10 @@ func NewRegexpRule(base, pattern, to string, ext []string) (*RegexpRule, error)
 	}
 
 	return &RegexpRule{
-		base,
-		to,
-		ext,
-		r,
+		Base:   base,
+		To:     to,
+		Exts:   ext,
+		Regexp: r,
 	}, nil
 }
 
@@ -124,6 +127,11 @@ func (r *RegexpRule) Rewrite(req *http.Request) bool {
 		return false
 	}
 
+	// validate conditions
+	if !allTrue(r.Ifs, req) {
+		return false
+	}
+
 	to := r.To
 
 	// check variables
@@ -192,3 +200,20 @@ func (r *RegexpRule) matchExt(rPath string) bool {
 	}
 	return true
 }
+
+// Scopes implements the middleware.Scoped interface. Rules
+// of unknown types may rewrite any path.
+func (rw Rewrite) Scopes() []string {
+	scopes := make([]string, len(rw.Rules))
+	for i, rule := range rw.Rules {
+		switch rule := rule.(type) {
+		case SimpleRule:
+			scopes[i] = rule.From
+		case *RegexpRule:
+			scopes[i] = rule.Base
+		default:
+			scopes[i] = "/"
+		}
+	}
+	return scopes
+}
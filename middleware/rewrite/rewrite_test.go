@@ -98,6 +98,84 @@ func TestRewrite(t *testing.T) {
 }
 
 func urlPrinter(w http.ResponseWriter, r *http.Request) (int, error) {
-	fmt.Fprintf(w, r.URL.String())
+	fmt.Fprint(w, r.URL.String())
 	return 0, nil
 }
+
+func TestIf(t *testing.T) {
+	for i, test := range []struct {
+		a, operator, b string
+		shouldErr      bool
+		expected       bool
+	}{
+		{"{path}", Is, "/a/b.html", false, true},
+		{"{path}", Not, "/a/b.html", false, false},
+		{"{>User-Agent}", Has, "Mobile", false, true},
+		{"{>User-Agent}", NotHas, "Mobile", false, false},
+		{"{path}", StartsWith, "/a/", false, true},
+		{"{path}", EndsWith, ".php", false, false},
+		{"{?lang}", Is, "de", false, true},
+		{"{?missing}", Is, "", false, true},
+		{"{>X-Missing}", Not, "", false, false},
+		{"{query}", Match, `^lang=[a-z]+$`, false, true},
+		{"{>User-Agent}", NotMatch, `(?i)bot`, false, true},
+		{"{path}", "contains", "a", true, false},
+		{"{path}", Match, "(", true, false},
+	} {
+		cond, err := NewIf(test.a, test.operator, test.b)
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+		if test.shouldErr {
+			continue
+		}
+
+		req, err := http.NewRequest("GET", "/a/b.html?lang=de", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("User-Agent", "Mozilla/5.0 (iPhone) Mobile")
+		if got := cond.True(req); got != test.expected {
+			t.Errorf("Test %d: Expected %s %s %s to be %v", i, test.a, test.operator, test.b, test.expected)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/a", nil)
+	if (If{A: "a", Operator: Match, B: "a"}).True(req) {
+		t.Error("Expected a match condition that wasn't made with NewIf to be false")
+	}
+}
+
+func TestRewriteIf(t *testing.T) {
+	rule, err := NewRegexpRule("/", ".*", "/mobile/{path}", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ua, _ := NewIf("{>User-Agent}", Has, "Mobile")
+	notMobile, _ := NewIf("{path}", NotMatch, "^/mobile/")
+	rule.Ifs = []If{ua, notMobile}
+	rw := Rewrite{Next: middleware.HandlerFunc(urlPrinter), Rules: []Rule{rule}}
+
+	for i, test := range []struct {
+		from, userAgent, expectedTo string
+	}{
+		{"/page?x=1", "Mobile Safari", "/mobile/page?x=1"},
+		{"/page?x=1", "Desktop", "/page?x=1"},
+		{"/mobile/page", "Mobile Safari", "/mobile/page"},
+	} {
+		req, err := http.NewRequest("GET", test.from, nil)
+		if err != nil {
+			t.Fatalf("Test %d: Could not create HTTP request: %v", i, err)
+		}
+		req.Header.Set("User-Agent", test.userAgent)
+		rec := httptest.NewRecorder()
+		rw.ServeHTTP(rec, req)
+
+		if rec.Body.String() != test.expectedTo {
+			t.Errorf("Test %d: Expected URL to be '%s' but was '%s'",
+				i, test.expectedTo, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Package shortlinks provides middleware that redirects short
+// links, like /go/docs, to the URLs they stand for. Links are kept
+// in a Store, counting their hits, and may be managed through an
+// API that is authenticated with a bearer token.
+package shortlinks
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/mholt/caddy/admin"
+	"github.com/mholt/caddy/middleware"
+)
+
+// Shortlinks is middleware that redirects requests for the
+// slugs of links in Store, under Prefix.
+type Shortlinks struct {
+	Next   middleware.Handler
+	Prefix string // path the slugs are under, like "/go"
+	Store  *Store
+	Code   int // redirect status of links that don't have their own
+
+	// Path of the management API, and the token clients must
+	// send in an "Authorization: Bearer" header to use it; the
+	// API is disabled if either is empty
+	API   string
+	Token string
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (s Shortlinks) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if s.API != "" && s.Token != "" && middleware.Path(r.URL.Path).Matches(s.API) {
+		return s.serveAPI(w, r)
+	}
+
+	if slug := s.slug(r.URL.Path); slug != "" && (r.Method == "GET" || r.Method == "HEAD") {
+		if link, ok := s.Store.Hit(slug); ok {
+			code := link.Code
+			if code == 0 {
+				code = s.Code
+			}
+			http.Redirect(w, r, link.URL, code)
+			return 0, nil
+		}
+	}
+
+	return s.Next.ServeHTTP(w, r)
+}
+
+// slug returns the slug that urlPath asks for, or "" if it
+// isn't under Prefix; "/go/docs" is under "/go", "/gopher" isn't.
+func (s Shortlinks) slug(urlPath string) string {
+	rest := strings.TrimPrefix(urlPath, strings.TrimSuffix(s.Prefix, "/"))
+	if len(rest) == len(urlPath) && s.Prefix != "/" || !strings.HasPrefix(rest, "/") {
+		return ""
+	}
+	return strings.Trim(rest, "/")
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (s Shortlinks) Scopes() []string {
+	if s.API != "" && s.Token != "" {
+		return []string{s.Prefix, s.API}
+	}
+	return []string{s.Prefix}
+}
+
+// serveAPI manages the links:
+//
+//	GET    <api>        lists the links
+//	GET    <api>/slug   gets a link
+//	POST   <api>        adds the link in the body, like {"slug": "docs", "url": "https://..."}
+//	PUT    <api>/slug   adds or replaces the link in the body
+//	DELETE <api>/slug   removes a link
+func (s Shortlinks) serveAPI(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		admin.Error(w, http.StatusUnauthorized, "missing or wrong token")
+		return 0, nil
+	}
+
+	slug := strings.Trim(strings.TrimPrefix(r.URL.Path, s.API), "/")
+
+	switch {
+	case r.Method == "GET" && slug == "":
+		admin.WriteJSON(w, http.StatusOK, s.Store.List())
+
+	case r.Method == "GET":
+		link, ok := s.Store.Get(slug)
+		if !ok {
+			admin.Error(w, http.StatusNotFound, "no link "+slug)
+			return 0, nil
+		}
+		admin.WriteJSON(w, http.StatusOK, link)
+
+	case r.Method == "POST" && slug == "", r.Method == "PUT" && slug != "":
+		var link Link
+		if err := json.NewDecoder(r.Body).Decode(&link); err != nil {
+			admin.Error(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return 0, nil
+		}
+		if slug != "" {
+			link.Slug = slug
+		}
+		link.Hits = 0
+		if msg := validate(link); msg != "" {
+			admin.Error(w, http.StatusBadRequest, msg)
+			return 0, nil
+		}
+		if err := s.Store.Put(link); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		link, _ = s.Store.Get(link.Slug)
+		admin.WriteJSON(w, http.StatusOK, link)
+
+	case r.Method == "DELETE" && slug != "":
+		found, err := s.Store.Delete(slug)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if !found {
+			admin.Error(w, http.StatusNotFound, "no link "+slug)
+			return 0, nil
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		admin.Error(w, http.StatusMethodNotAllowed, "use GET, POST, PUT or DELETE")
+	}
+	return 0, nil
+}
+
+// authorized returns true if r carries the API token.
+func (s Shortlinks) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+// validate returns what is wrong with link, or "" if it's fine.
+func validate(link Link) string {
+	if msg := ValidSlug(link.Slug); msg != "" {
+		return msg
+	}
+	if msg := ValidURL(link.URL); msg != "" {
+		return msg
+	}
+	if link.Code != 0 && !RedirectCode(link.Code) {
+		return "invalid redirect code"
+	}
+	return ""
+}
+
+// ValidSlug returns what is wrong with slug, or "" if it's fine.
+// Slugs may have slashes, like "docs/v2", but not empty or dot
+// segments.
+func ValidSlug(slug string) string {
+	if slug == "" {
+		return "missing slug"
+	}
+	if path.Clean("/"+slug) != "/"+slug {
+		return "invalid slug " + slug
+	}
+	return ""
+}
+
+// ValidURL returns what is wrong with the target u,
+// or "" if it's fine. Targets are absolute URLs or paths.
+func ValidURL(u string) string {
+	if u == "" {
+		return "missing url"
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "invalid url: " + err.Error()
+	}
+	if !parsed.IsAbs() && !strings.HasPrefix(u, "/") {
+		return "url must be absolute, or a path starting with /"
+	}
+	return ""
+}
+
+// RedirectCode returns true if code is a status
+// that a link may redirect with.
+func RedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package shortlinks
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/storage"
+	mwtest "github.com/mholt/caddy/middleware/testing"
+)
+
+func newStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "caddy_shortlinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenStore(filepath.Join(dir, "links.json"), middleware.FilePerms{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, func() { os.RemoveAll(dir) }
+}
+
+func TestShortlinks(t *testing.T) {
+	store, cleanup := newStore(t)
+	defer cleanup()
+	err := store.Put(
+		Link{Slug: "docs", URL: "https://example.com/docs"},
+		Link{Slug: "docs/v2", URL: "/v2/", Code: 301},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Shortlinks{Next: &mwtest.Handler{Body: "next"}, Prefix: "/go", Store: store, Code: 302}
+
+	for i, test := range []struct {
+		method           string
+		path             string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"GET", "/go/docs", 302, "https://example.com/docs"},
+		{"HEAD", "/go/docs/", 302, "https://example.com/docs"},
+		{"GET", "/go/docs/v2", 301, "/v2/"},
+		{"POST", "/go/docs", 200, ""},
+		{"GET", "/go/nope", 200, ""},
+		{"GET", "/go", 200, ""},
+		{"GET", "/godocs", 200, ""},
+		{"GET", "/docs", 200, ""},
+	} {
+		rec := mwtest.Serve(s, httptest.NewRequest(test.method, test.path, nil))
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, rec.Code)
+		}
+		if location := rec.Header().Get("Location"); location != test.expectedLocation {
+			t.Errorf("Test %d: Expected Location %q, got %q", i, test.expectedLocation, location)
+		}
+	}
+
+	if link, _ := store.Get("docs"); link.Hits != 2 {
+		t.Errorf("Expected 2 hits, got %d", link.Hits)
+	}
+}
+
+func TestStorePersists(t *testing.T) {
+	store, cleanup := newStore(t)
+	defer cleanup()
+
+	defer func(interval time.Duration) { hitSaveInterval = interval }(hitSaveInterval)
+	hitSaveInterval = time.Hour
+
+	if err := store.Put(Link{Slug: "a", URL: "/a"}); err != nil {
+		t.Fatal(err)
+	}
+	store.Hit("a")
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(Link{Slug: "a", URL: "/b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// open it afresh, as a new process would
+	storesMu.Lock()
+	delete(stores, storeID{store.backend, store.key})
+	storesMu.Unlock()
+	dir := store.backend.(*storage.Dir).Path()
+	reopened, err := OpenStore(filepath.Join(dir, "links.json"), middleware.FilePerms{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	link, ok := reopened.Get("a")
+	if !ok || link.URL != "/b" || link.Hits != 1 || link.Created.IsZero() {
+		t.Errorf("Expected link to /b with 1 hit, got %+v", link)
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, "*")); len(names) != 1 {
+		t.Errorf("Expected only the links file, got %v", names)
+	}
+}
+
+func TestStoreShared(t *testing.T) {
+	defer func(interval time.Duration) { reloadInterval = interval }(reloadInterval)
+	reloadInterval = 0
+
+	// two servers sharing the storage
+	backend := storage.NewMemory()
+	one, err := Open(backend, "links")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storesMu.Lock()
+	delete(stores, storeID{backend, "links"})
+	storesMu.Unlock()
+	two, err := Open(backend, "links")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := one.Put(Link{Slug: "a", URL: "/a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := two.Hit("a"); !ok {
+		t.Fatal("Expected a link added by another server to be found")
+	}
+	one.Hit("a")
+	if err := two.Put(Link{Slug: "b", URL: "/b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := one.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if link, _ := two.Get("a"); link.Hits != 2 {
+		t.Errorf("Expected the hits of both servers to count, got %d", link.Hits)
+	}
+	if links := one.List(); len(links) != 2 {
+		t.Errorf("Expected 2 links, got %v", links)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	store, cleanup := newStore(t)
+	defer cleanup()
+	s := Shortlinks{Next: &mwtest.Handler{}, Prefix: "/", Store: store, Code: 302, API: "/_links", Token: "secret"}
+
+	for i, test := range []struct {
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"GET", "/_links", "", "", 401, "token"},
+		{"GET", "/_links", "wrong", "", 401, "token"},
+		{"POST", "/_links", "secret", `{"slug": "docs", "url": "https://example.com/docs"}`, 200, `"slug":"docs"`},
+		{"PUT", "/_links/blog", "secret", `{"url": "/blog/", "code": 301}`, 200, `"code":301`},
+		{"POST", "/_links", "secret", `{"slug": "x", "url": "relative"}`, 400, "absolute"},
+		{"POST", "/_links", "secret", `{"slug": "../x", "url": "/x"}`, 400, "invalid slug"},
+		{"POST", "/_links", "secret", `{"slug": "x", "url": "/x", "code": 200}`, 400, "code"},
+		{"POST", "/_links", "secret", `{`, 400, "invalid JSON"},
+		{"GET", "/_links/docs", "secret", "", 200, `"url":"https://example.com/docs"`},
+		{"GET", "/_links", "secret", "", 200, `"slug":"blog"`},
+		{"DELETE", "/_links/docs", "secret", "", 204, ""},
+		{"DELETE", "/_links/docs", "secret", "", 404, "no link"},
+		{"GET", "/_links/docs", "secret", "", 404, "no link"},
+		{"PATCH", "/_links/docs", "secret", "", 405, ""},
+	} {
+		r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		rec := mwtest.Serve(s, r)
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d: %s", i, test.expectedStatus, rec.Code, rec.Body)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectedBody) {
+			t.Errorf("Test %d: Expected body to contain %q, got %q", i, test.expectedBody, rec.Body)
+		}
+	}
+
+	rec := mwtest.Serve(s, httptest.NewRequest("GET", "/blog", nil))
+	rec.AssertStatus(t, http.StatusMovedPermanently)
+	rec.AssertHeader(t, "Location", "/blog/")
+}
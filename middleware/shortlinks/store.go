@@ -0,0 +1,249 @@
+package shortlinks
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/storage"
+)
+
+// hitSaveInterval is how often hit counts are saved; changes to
+// links themselves are saved right away.
+var hitSaveInterval = time.Minute
+
+// reloadInterval is how often the links are read again, to
+// pick up changes made by other servers sharing the storage.
+var reloadInterval = 10 * time.Second
+
+// Link is a short link: a slug that redirects to URL.
+type Link struct {
+	Slug    string    `json:"slug"`
+	URL     string    `json:"url"`
+	Code    int       `json:"code,omitempty"` // redirect status; 0 for the middleware's default
+	Hits    int64     `json:"hits"`
+	Created time.Time `json:"created"`
+}
+
+// Store keeps the links of one or more sites as a JSON list,
+// the value of one key in a Storage. Changes to links are made
+// to the stored list atomically, and hits are added to it, so
+// several servers can share the store.
+type Store struct {
+	backend storage.Storage
+	key     string
+
+	mu       sync.Mutex
+	links    map[string]*Link
+	hits     map[string]int64 // hits not yet saved
+	loaded   time.Time
+	lastSave time.Time
+}
+
+// Stores are shared by storage and key, so that sites using
+// the same links (and reloads of a site) don't overwrite each
+// other's hits.
+var (
+	stores   = make(map[storeID]*Store)
+	storesMu sync.Mutex
+)
+
+type storeID struct {
+	backend storage.Storage
+	key     string
+}
+
+// OpenStore returns the store kept in the file at path, loading
+// it if it isn't open already. A file that doesn't exist yet is
+// created when the first link is added.
+func OpenStore(path string, perms middleware.FilePerms) (*Store, error) {
+	return Open(storage.NewDir(filepath.Dir(path), perms), filepath.Base(path))
+}
+
+// Open returns the store kept under key in backend, loading
+// it if it isn't open already.
+func Open(backend storage.Storage, key string) (*Store, error) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	id := storeID{backend, key}
+	if s, ok := stores[id]; ok {
+		return s, nil
+	}
+	s := &Store{backend: backend, key: key, hits: make(map[string]int64), lastSave: time.Now()}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	stores[id] = s
+	return s, nil
+}
+
+// Get returns a copy of the link for slug, if there is one.
+func (s *Store) Get(slug string) (Link, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	link, ok := s.links[slug]
+	if !ok {
+		return Link{}, false
+	}
+	return *link, true
+}
+
+// Hit returns the link for slug and counts a visit to it.
+func (s *Store) Hit(slug string) (Link, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	link, ok := s.links[slug]
+	if !ok {
+		return Link{}, false
+	}
+	link.Hits++
+	s.hits[slug]++
+	if time.Since(s.lastSave) >= hitSaveInterval {
+		s.update(nil) // not worth failing the redirect over; retried on the next hit
+	}
+	return *link, true
+}
+
+// Put adds the links to the store, replacing those with the same
+// slugs but keeping their hit counts and creation times.
+func (s *Store) Put(links ...Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	return s.update(func(stored map[string]*Link) bool {
+		for _, link := range links {
+			link := link
+			if old, ok := stored[link.Slug]; ok {
+				link.Hits, link.Created = old.Hits, old.Created
+			}
+			if link.Created.IsZero() {
+				link.Created = now
+			}
+			stored[link.Slug] = &link
+		}
+		return true
+	})
+}
+
+// Delete removes the link for slug. It returns false
+// if there was none.
+func (s *Store) Delete(slug string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found bool
+	err := s.update(func(stored map[string]*Link) bool {
+		_, found = stored[slug]
+		delete(stored, slug)
+		return found
+	})
+	return found, err
+}
+
+// List returns copies of all the links, sorted by slug.
+func (s *Store) List() []Link {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh()
+	return list(s.links)
+}
+
+// Flush saves any hit counts that haven't been saved yet.
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.hits) == 0 {
+		return nil
+	}
+	return s.update(nil)
+}
+
+func list(links map[string]*Link) []Link {
+	list := make([]Link, 0, len(links))
+	for _, link := range links {
+		list = append(list, *link)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Slug < list[j].Slug })
+	return list
+}
+
+// refresh reads the links again if they were read longer than
+// reloadInterval ago. If that fails, the links read last are
+// kept. s.mu must be held.
+func (s *Store) refresh() {
+	if time.Since(s.loaded) >= reloadInterval {
+		s.reload()
+	}
+}
+
+// reload reads the links, counting the hits that haven't
+// been saved yet on top. s.mu must be held.
+func (s *Store) reload() error {
+	body, err := s.backend.Get(s.key)
+	if err != nil && err != storage.ErrNotFound {
+		return err
+	}
+	links, err := decodeLinks(body)
+	if err != nil {
+		return err
+	}
+	for slug, hits := range s.hits {
+		if link, ok := links[slug]; ok {
+			link.Hits += hits
+		}
+	}
+	s.links, s.loaded = links, time.Now()
+	return nil
+}
+
+// update changes the stored links with change, if it isn't nil,
+// adding the hits that haven't been saved yet, and keeps the
+// result as the store's links. change returns false if it didn't
+// change anything. s.mu must be held.
+func (s *Store) update(change func(map[string]*Link) bool) error {
+	var links map[string]*Link
+	err := s.backend.Update(s.key, 0, func(body []byte) ([]byte, error) {
+		var err error
+		links, err = decodeLinks(body)
+		if err != nil {
+			return nil, err
+		}
+		for slug, hits := range s.hits {
+			if link, ok := links[slug]; ok {
+				link.Hits += hits
+			}
+		}
+		if change != nil && !change(links) && len(s.hits) == 0 {
+			return body, nil
+		}
+		return json.MarshalIndent(list(links), "", "\t")
+	})
+	if err != nil {
+		return err
+	}
+	s.links, s.hits = links, make(map[string]int64)
+	s.loaded, s.lastSave = time.Now(), time.Now()
+	return nil
+}
+
+// decodeLinks decodes a stored list of links, which
+// is empty if body is.
+func decodeLinks(body []byte) (map[string]*Link, error) {
+	links := make(map[string]*Link)
+	if len(body) == 0 {
+		return links, nil
+	}
+	var list []*Link
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	for _, link := range list {
+		links[link.Slug] = link
+	}
+	return links, nil
+}
@@ -0,0 +1,182 @@
+// Package signedurl provides middleware that only serves files
+// to requests whose URLs carry a valid, unexpired signature, so
+// that files can be shared with time-limited links.
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/admin"
+	"github.com/mholt/caddy/middleware"
+)
+
+// The query parameters of a signed URL.
+const (
+	ExpiresParam   = "expires"
+	SignatureParam = "signature"
+)
+
+// Errors of requests that are refused.
+var (
+	ErrUnsigned = errors.New("URL is not signed")
+	ErrExpired  = errors.New("signed URL has expired")
+	ErrBadSig   = errors.New("URL signature is invalid")
+)
+
+// SignedURL is middleware that requires requests for Paths to
+// be signed with Key.
+type SignedURL struct {
+	Next  middleware.Handler
+	Paths []string
+	Key   []byte
+
+	// Path of the endpoint that signs URLs, and the token clients
+	// must send in an "Authorization: Bearer" header to use it;
+	// the endpoint is disabled if either is empty
+	Endpoint string
+	Token    string
+
+	// The longest time a URL may be signed for by the endpoint
+	MaxTTL time.Duration
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (s SignedURL) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if s.Endpoint != "" && s.Token != "" && r.URL.Path == s.Endpoint {
+		return s.serveSign(w, r)
+	}
+
+	for _, p := range s.Paths {
+		if !middleware.Path(r.URL.Path).Matches(p) {
+			continue
+		}
+		query := r.URL.Query()
+		if err := Verify(s.Key, r.URL.Path, query, time.Now()); err != nil {
+			return http.StatusForbidden, err
+		}
+
+		// the signature has done its job; keep it out of
+		// logs and cache keys further down the chain
+		query.Del(ExpiresParam)
+		query.Del(SignatureParam)
+		r.URL.RawQuery = query.Encode()
+		break
+	}
+
+	return s.Next.ServeHTTP(w, r)
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (s SignedURL) Scopes() []string {
+	if s.Endpoint != "" && s.Token != "" {
+		return append([]string{s.Endpoint}, s.Paths...)
+	}
+	return s.Paths
+}
+
+// Sign returns the query parameters that make a request for
+// urlPath valid until expires, like
+// "expires=1700000000&signature=...".
+func Sign(key []byte, urlPath string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	query := url.Values{}
+	query.Set(ExpiresParam, exp)
+	query.Set(SignatureParam, signature(key, urlPath, exp))
+	return query.Encode()
+}
+
+// Verify returns nil if query has a valid signature
+// for urlPath with key that has not expired at now.
+func Verify(key []byte, urlPath string, query url.Values, now time.Time) error {
+	exp, sig := query.Get(ExpiresParam), query.Get(SignatureParam)
+	if exp == "" || sig == "" {
+		return ErrUnsigned
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(key, urlPath, exp))) {
+		return ErrBadSig
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrBadSig
+	}
+	if now.Unix() >= expires {
+		return ErrExpired
+	}
+	return nil
+}
+
+// signature returns the signature of urlPath until exp.
+func signature(key []byte, urlPath, exp string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(urlPath))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(exp))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// serveSign signs the URL of the path parameter for the duration
+// of the ttl parameter (or MaxTTL), like
+//
+//	GET /_sign?path=/files/report.pdf&ttl=24h
+//
+// and responds with {"url": "/files/report.pdf?expires=...", "expires": "..."}.
+func (s SignedURL) serveSign(w http.ResponseWriter, r *http.Request) (int, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(s.Token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		admin.Error(w, http.StatusUnauthorized, "missing or wrong token")
+		return 0, nil
+	}
+	if r.Method != "GET" && r.Method != "POST" {
+		admin.Error(w, http.StatusMethodNotAllowed, "use GET or POST")
+		return 0, nil
+	}
+
+	urlPath := r.FormValue("path")
+	if !strings.HasPrefix(urlPath, "/") {
+		admin.Error(w, http.StatusBadRequest, "path must start with /")
+		return 0, nil
+	}
+	var signable bool
+	for _, p := range s.Paths {
+		if middleware.Path(urlPath).Matches(p) {
+			signable = true
+			break
+		}
+	}
+	if !signable {
+		admin.Error(w, http.StatusBadRequest, "path is not protected by signed URLs")
+		return 0, nil
+	}
+
+	ttl := s.MaxTTL
+	if v := r.FormValue("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			admin.Error(w, http.StatusBadRequest, "invalid ttl")
+			return 0, nil
+		}
+		if d > s.MaxTTL {
+			admin.Error(w, http.StatusBadRequest, "ttl is longer than "+s.MaxTTL.String())
+			return 0, nil
+		}
+		ttl = d
+	}
+
+	expires := time.Now().Add(ttl)
+	admin.WriteJSON(w, http.StatusOK, map[string]string{
+		"url":     (&url.URL{Path: urlPath}).EscapedPath() + "?" + Sign(s.Key, urlPath, expires),
+		"expires": expires.UTC().Format(time.RFC3339),
+	})
+	return 0, nil
+}
@@ -0,0 +1,107 @@
+package signedurl
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	mwtest "github.com/mholt/caddy/middleware/testing"
+)
+
+var key = []byte("0123456789abcdef")
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	query, _ := url.ParseQuery(Sign(key, "/files/a.zip", now.Add(time.Hour)))
+
+	for i, test := range []struct {
+		key      []byte
+		path     string
+		query    url.Values
+		now      time.Time
+		expected error
+	}{
+		{key, "/files/a.zip", query, now, nil},
+		{key, "/files/a.zip", query, now.Add(2 * time.Hour), ErrExpired},
+		{key, "/files/b.zip", query, now, ErrBadSig},
+		{[]byte("another key, longer"), "/files/a.zip", query, now, ErrBadSig},
+		{key, "/files/a.zip", url.Values{}, now, ErrUnsigned},
+		{key, "/files/a.zip", url.Values{"expires": {"9999999999"}, "signature": query["signature"]}, now, ErrBadSig},
+	} {
+		if err := Verify(test.key, test.path, test.query, test.now); err != test.expected {
+			t.Errorf("Test %d: Expected %v, got %v", i, test.expected, err)
+		}
+	}
+}
+
+func TestSignedURL(t *testing.T) {
+	next := &mwtest.Handler{}
+	s := SignedURL{Next: next, Paths: []string{"/files"}, Key: key,
+		Endpoint: "/_sign", Token: "secret", MaxTTL: time.Hour}
+
+	valid := "/files/a.zip?" + Sign(key, "/files/a.zip", time.Now().Add(time.Minute)) + "&download=1"
+	expired := "/files/a.zip?" + Sign(key, "/files/a.zip", time.Now().Add(-time.Minute))
+
+	for i, test := range []struct {
+		url            string
+		expectedStatus int
+	}{
+		{valid, http.StatusOK},
+		{expired, http.StatusForbidden},
+		{"/files/a.zip", http.StatusForbidden},
+		{"/public/a.zip", http.StatusOK},
+	} {
+		rec := mwtest.Serve(s, httptest.NewRequest("GET", test.url, nil))
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, rec.Code)
+		}
+	}
+
+	// the signature isn't passed on
+	mwtest.Serve(s, httptest.NewRequest("GET", valid, nil))
+	if query := next.Request().URL.RawQuery; query != "download=1" {
+		t.Errorf("Expected only the other parameters to be passed on, got %q", query)
+	}
+}
+
+func TestSignEndpoint(t *testing.T) {
+	s := SignedURL{Next: &mwtest.Handler{}, Paths: []string{"/files"}, Key: key,
+		Endpoint: "/_sign", Token: "secret", MaxTTL: time.Hour}
+
+	for i, test := range []struct {
+		url            string
+		token          string
+		expectedStatus int
+	}{
+		{"/_sign?path=/files/a%20b.zip&ttl=10m", "secret", 200},
+		{"/_sign?path=/files/a.zip", "secret", 200},
+		{"/_sign?path=/files/a.zip", "wrong", 401},
+		{"/_sign?path=/files/a.zip&ttl=2h", "secret", 400},
+		{"/_sign?path=/files/a.zip&ttl=soon", "secret", 400},
+		{"/_sign?path=/public/a.zip", "secret", 400},
+		{"/_sign?path=files/a.zip", "secret", 400},
+	} {
+		r := httptest.NewRequest("GET", test.url, nil)
+		r.Header.Set("Authorization", "Bearer "+test.token)
+		rec := mwtest.Serve(s, r)
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d: %s", i, test.expectedStatus, rec.Code, rec.Body)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		// the signed URL works
+		var resp map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		if rec := mwtest.Serve(s, httptest.NewRequest("GET", resp["url"], nil)); rec.Code != http.StatusOK {
+			t.Errorf("Test %d: Expected the signed URL %s to work, got %d", i, resp["url"], rec.Code)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+// Package slowlog implements middleware that logs requests which take
+// longer than a threshold, with a breakdown of where the time went.
+package slowlog
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// SlowLog is middleware that logs slow requests. Each entry has the
+// request, its status, how long it took, the time spent in each layer
+// of middleware, and notes from handlers, like the upstream used.
+type SlowLog struct {
+	Next       middleware.Handler
+	Threshold  time.Duration
+	OutputFile string
+	Log        *log.Logger
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (s *SlowLog) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	r, trace := middleware.WithTrace(r)
+	rec := middleware.NewResponseRecorder(w)
+	start := time.Now()
+
+	status, err := s.Next.ServeHTTP(rec, r)
+
+	if elapsed := time.Since(start); elapsed >= s.Threshold {
+		logged := strconv.Itoa(status)
+		if status < 400 {
+			logged = middleware.NewReplacer(r, rec, "-").Replace("{status}")
+		}
+		s.Log.Printf("%s [SLOW %v] %s %s %s %s",
+			start.Format(timeFormat), elapsed, r.Method, r.URL.RequestURI(), logged, trace)
+	}
+
+	return status, err
+}
+
+// DefaultLogFilename is the file slow requests are logged to.
+const DefaultLogFilename = "slow.log"
+
+const timeFormat = "02/Jan/2006:15:04:05 -0700"
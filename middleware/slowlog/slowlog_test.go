@@ -0,0 +1,67 @@
+package slowlog
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestSlowLog(t *testing.T) {
+	var buf bytes.Buffer
+	s := &SlowLog{
+		Next: middleware.TraceHandler(middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			if r.URL.Path == "/slow" {
+				time.Sleep(20 * time.Millisecond)
+			}
+			middleware.TraceFrom(r).Note("upstream=%s", "http://backend")
+			if r.URL.Path == "/missing" {
+				return http.StatusNotFound, nil
+			}
+			w.WriteHeader(http.StatusAccepted)
+			return 0, nil
+		})),
+		Threshold: 10 * time.Millisecond,
+		Log:       log.New(&buf, "", 0),
+	}
+
+	tests := []struct {
+		url      string
+		logged   bool
+		contains []string
+	}{
+		{"/fast", false, nil},
+		{"/slow?q=1", true, []string{"[SLOW ", "GET /slow?q=1 202 ", "middleware.HandlerFunc=", "upstream=http://backend"}},
+	}
+
+	for i, test := range tests {
+		buf.Reset()
+		r, _ := http.NewRequest("GET", test.url, nil)
+		s.ServeHTTP(httptest.NewRecorder(), r)
+
+		if logged := buf.Len() > 0; logged != test.logged {
+			t.Errorf("Test %d: Expected logged to be %v, got %q", i, test.logged, buf.String())
+		}
+		for _, want := range test.contains {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("Test %d: Expected entry to contain %q, got %q", i, want, buf.String())
+			}
+		}
+	}
+
+	// a status that wasn't written yet is logged as returned
+	buf.Reset()
+	s.Threshold = 0
+	r, _ := http.NewRequest("GET", "/missing", nil)
+	if status, _ := s.ServeHTTP(httptest.NewRecorder(), r); status != http.StatusNotFound {
+		t.Errorf("Expected status 404 to be passed on, got %d", status)
+	}
+	if !strings.Contains(buf.String(), "GET /missing 404 ") {
+		t.Errorf("Expected entry with status 404, got %q", buf.String())
+	}
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Dir is a Storage that keeps each value in a file of its own
+// in a directory, named after its key. Values without a ttl are
+// kept as they are, so the files can be read and edited by hand;
+// those with one start with a line saying when they expire.
+//
+// Writes go to a temporary file that is renamed over the value's
+// file, so a crash never leaves a value half-written. Updates are
+// atomic within the process, but not between processes that use
+// the same directory. The files of expired values are removed
+// every so often as values are written.
+type Dir struct {
+	path  string
+	perms middleware.FilePerms
+	mu    sync.Mutex // serializes updates
+
+	sweepInterval time.Duration // how often to remove expired values
+	lastSweep     time.Time
+}
+
+// DefaultDirSweepInterval is how often a Dir removes
+// the files of values that have expired.
+const DefaultDirSweepInterval = 10 * time.Minute
+
+// expiresHeader starts the first line of a value that expires.
+var expiresHeader = []byte("\x00expires ")
+
+// Dirs are shared by path, so that updates by sites using
+// the same directory (and reloads of a site) are atomic.
+var (
+	dirs   = make(map[string]*Dir)
+	dirsMu sync.Mutex
+)
+
+// NewDir returns the store kept in the directory at path, which is
+// created, with the given permissions, when the first value is put.
+func NewDir(path string, perms middleware.FilePerms) *Dir {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	dirsMu.Lock()
+	defer dirsMu.Unlock()
+	if d, ok := dirs[path]; ok {
+		return d
+	}
+	d := &Dir{path: path, perms: perms, sweepInterval: DefaultDirSweepInterval, lastSweep: time.Now()}
+	dirs[path] = d
+	return d
+}
+
+// Path returns the directory d keeps its values in.
+func (d *Dir) Path() string {
+	return d.path
+}
+
+// Get implements Storage.
+func (d *Dir) Get(key string) ([]byte, error) {
+	name, err := d.file(key)
+	if err != nil {
+		return nil, err
+	}
+	return readValue(name, time.Now())
+}
+
+// Put implements Storage.
+func (d *Dir) Put(key string, value []byte, ttl time.Duration) error {
+	name, err := d.file(key)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.write(name, value, expiry(ttl, time.Now()))
+}
+
+// Delete implements Storage.
+func (d *Dir) Delete(key string) error {
+	name, err := d.file(key)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List implements Storage.
+func (d *Dir) List(prefix string) ([]string, error) {
+	infos, err := ioutil.ReadDir(d.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var keys []string
+	for _, info := range infos {
+		key, err := url.QueryUnescape(info.Name())
+		if err != nil || info.IsDir() || !strings.HasPrefix(key, prefix) {
+			continue // temporary files don't unescape
+		}
+		if _, err := readValue(filepath.Join(d.path, info.Name()), now); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Update implements Storage.
+func (d *Dir) Update(key string, ttl time.Duration, fn func([]byte) ([]byte, error)) error {
+	name, err := d.file(key)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	old, err := readValue(name, now)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	value, err := fn(old)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return d.write(name, value, expiry(ttl, now))
+}
+
+// file returns the name of the file that keeps the value of key.
+func (d *Dir) file(key string) (string, error) {
+	name := url.QueryEscape(key)
+	if name == "" || name == "." || name == ".." {
+		return "", errors.New("storage: invalid key '" + key + "'")
+	}
+	return filepath.Join(d.path, name), nil
+}
+
+// write saves value to the file called name. d.mu must be held.
+func (d *Dir) write(name string, value []byte, expires time.Time) error {
+	if err := d.perms.MkdirAll(d.path); err != nil {
+		return err
+	}
+	if now := time.Now(); now.Sub(d.lastSweep) >= d.sweepInterval {
+		d.sweep(now)
+	}
+	if !expires.IsZero() {
+		header := strconv.AppendInt(append([]byte(nil), expiresHeader...), expires.UnixNano(), 10)
+		value = append(append(header, '\n'), value...)
+	}
+
+	tmp, err := ioutil.TempFile(d.path, "%tmp-")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	if err := d.perms.WriteFile(tmp.Name(), value); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// sweep removes the files of the values that have expired by
+// now. d.mu must be held.
+func (d *Dir) sweep(now time.Time) {
+	d.lastSweep = now
+	infos, err := ioutil.ReadDir(d.path)
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		if _, err := url.QueryUnescape(info.Name()); err != nil || info.IsDir() {
+			continue // temporary files don't unescape
+		}
+		name := filepath.Join(d.path, info.Name())
+		if _, err := readValue(name, now); err == ErrNotFound {
+			os.Remove(name)
+		}
+	}
+}
+
+// readValue reads the value in the file called name, without the
+// line saying when it expires, or ErrNotFound if it has expired.
+func readValue(name string, now time.Time) ([]byte, error) {
+	body, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(body, expiresHeader) {
+		return body, nil
+	}
+	end := bytes.IndexByte(body, '\n')
+	if end < 0 {
+		return nil, errors.New("storage: malformed value in " + name)
+	}
+	nanos, err := strconv.ParseInt(string(body[len(expiresHeader):end]), 10, 64)
+	if err != nil {
+		return nil, errors.New("storage: malformed value in " + name)
+	}
+	if expired(time.Unix(0, nanos), now) {
+		return nil, ErrNotFound
+	}
+	return body[end+1:], nil
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is a Storage that keeps values in memory, so they are
+// lost when the process exits and aren't shared with other
+// servers. Expired values are removed as the store grows.
+type Memory struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	sweepSize int // sweep expired entries when there are this many
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory returns an empty Memory store.
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]memoryEntry), sweepSize: 1024}
+}
+
+// Get implements Storage.
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.get(key, time.Now())
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+// Put implements Storage.
+func (m *Memory) Put(key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.put(key, value, ttl, time.Now())
+	return nil
+}
+
+// Delete implements Storage.
+func (m *Memory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// List implements Storage.
+func (m *Memory) List(prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var keys []string
+	for key, entry := range m.entries {
+		if strings.HasPrefix(key, prefix) && !expired(entry.expires, now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Update implements Storage.
+func (m *Memory) Update(key string, ttl time.Duration, fn func([]byte) ([]byte, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	old, _ := m.get(key, now)
+	value, err := fn(old)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		delete(m.entries, key)
+		return nil
+	}
+	m.put(key, value, ttl, now)
+	return nil
+}
+
+// get returns a copy of the value of key. m.mu must be held.
+func (m *Memory) get(key string, now time.Time) ([]byte, bool) {
+	entry, ok := m.entries[key]
+	if !ok || expired(entry.expires, now) {
+		return nil, false
+	}
+	return append([]byte(nil), entry.value...), true
+}
+
+// put stores a copy of value. m.mu must be held.
+func (m *Memory) put(key string, value []byte, ttl time.Duration, now time.Time) {
+	if len(m.entries) >= m.sweepSize {
+		m.sweep(now)
+	}
+	m.entries[key] = memoryEntry{append([]byte(nil), value...), expiry(ttl, now)}
+}
+
+// sweep removes the expired entries, and lets the store grow to
+// twice the entries that are left before the next sweep.
+func (m *Memory) sweep(now time.Time) {
+	for key, entry := range m.entries {
+		if expired(entry.expires, now) {
+			delete(m.entries, key)
+		}
+	}
+	if m.sweepSize = 2 * len(m.entries); m.sweepSize < 1024 {
+		m.sweepSize = 1024
+	}
+}
@@ -0,0 +1,377 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redis is a Storage kept in a Redis server, which several
+// servers can share. It speaks just enough of the protocol
+// for Storage. Each call gets a connection of its own from a
+// pool, opening a new one if none is idle; connections that
+// fail are closed rather than put back.
+type Redis struct {
+	// Address of the server, like "localhost:6379"
+	Addr string
+
+	// Password to authenticate with, if not empty
+	Password string
+
+	// Database number to select
+	DB int
+
+	// Prefix for all keys, so that several sites or
+	// applications can share a database
+	Prefix string
+
+	// How long a command may take; 5 seconds if 0
+	Timeout time.Duration
+
+	// How many idle connections to keep open; 4 if 0
+	MaxIdle int
+
+	mu   sync.Mutex // protects idle
+	idle []*redisConn
+}
+
+// redisConn is a connection to the server.
+type redisConn struct {
+	net.Conn
+	r      *bufio.Reader
+	broken bool // if a command failed other than with an error reply
+}
+
+// maxUpdateTries is how many times Update tries before giving
+// up on a key that others keep changing.
+const maxUpdateTries = 16
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// Ping checks that the server can be reached and accepts
+// the password, if any.
+func (rd *Redis) Ping() error {
+	return rd.call(func(c *redisConn) error {
+		_, err := c.do("PING")
+		return err
+	})
+}
+
+// Get implements Storage.
+func (rd *Redis) Get(key string) ([]byte, error) {
+	var value []byte
+	err := rd.call(func(c *redisConn) error {
+		reply, err := c.do("GET", rd.Prefix+key)
+		if err != nil {
+			return err
+		}
+		value, _ = reply.([]byte)
+		if value == nil {
+			return ErrNotFound
+		}
+		return nil
+	})
+	return value, err
+}
+
+// Put implements Storage.
+func (rd *Redis) Put(key string, value []byte, ttl time.Duration) error {
+	return rd.call(func(c *redisConn) error {
+		_, err := c.do(setArgs(rd.Prefix+key, value, ttl)...)
+		return err
+	})
+}
+
+// Delete implements Storage.
+func (rd *Redis) Delete(key string) error {
+	return rd.call(func(c *redisConn) error {
+		_, err := c.do("DEL", rd.Prefix+key)
+		return err
+	})
+}
+
+// List implements Storage.
+func (rd *Redis) List(prefix string) ([]string, error) {
+	seen := make(map[string]bool)
+	err := rd.call(func(c *redisConn) error {
+		cursor := "0"
+		for {
+			reply, err := c.do("SCAN", cursor, "MATCH", globEscape(rd.Prefix+prefix)+"*", "COUNT", "1000")
+			if err != nil {
+				return err
+			}
+			parts, _ := reply.([]interface{})
+			if len(parts) != 2 {
+				return errors.New("redis: unexpected reply to SCAN")
+			}
+			next, _ := parts[0].([]byte)
+			keys, _ := parts[1].([]interface{})
+			for _, key := range keys {
+				if key, ok := key.([]byte); ok {
+					seen[strings.TrimPrefix(string(key), rd.Prefix)] = true
+				}
+			}
+			if cursor = string(next); cursor == "0" || cursor == "" {
+				return nil
+			}
+		}
+	})
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, err
+}
+
+// Update implements Storage. It watches the key, so that the
+// new value is only set if no one changed the key meanwhile,
+// and tries again if someone did. If it fails midway, it ends
+// the transaction and the watch, so the connection can be used
+// for other commands again.
+func (rd *Redis) Update(key string, ttl time.Duration, fn func([]byte) ([]byte, error)) error {
+	key = rd.Prefix + key
+	return rd.call(func(c *redisConn) error {
+		for i := 0; i < maxUpdateTries; i++ {
+			if _, err := c.do("WATCH", key); err != nil {
+				return err
+			}
+			reply, err := c.do("GET", key)
+			if err != nil {
+				c.do("UNWATCH")
+				return err
+			}
+			old, _ := reply.([]byte)
+			value, err := fn(old)
+			if err != nil {
+				c.do("UNWATCH")
+				return err
+			}
+
+			if _, err := c.do("MULTI"); err != nil {
+				c.do("UNWATCH")
+				return err
+			}
+			if value == nil {
+				_, err = c.do("DEL", key)
+			} else {
+				_, err = c.do(setArgs(key, value, ttl)...)
+			}
+			if err != nil {
+				// DISCARD unwatches the key too
+				c.do("DISCARD")
+				return err
+			}
+			reply, err = c.do("EXEC")
+			if err != nil {
+				return err
+			}
+			if reply != nil {
+				return nil
+			}
+			// the key changed since WATCH; try again, after a while
+			// that grows with each try, so that clients racing for
+			// the key don't keep getting in each other's way
+			time.Sleep(time.Duration(rand.Int63n(int64(i+1) * int64(time.Millisecond))))
+		}
+		return fmt.Errorf("redis: %s kept changing while being updated", key)
+	})
+}
+
+// call runs fn with a connection from the pool, and puts
+// the connection back after, unless it broke.
+func (rd *Redis) call(fn func(c *redisConn) error) error {
+	c, err := rd.get()
+	if err != nil {
+		return err
+	}
+	c.SetDeadline(time.Now().Add(rd.timeout()))
+	err = fn(c)
+	rd.put(c)
+	return err
+}
+
+// get returns an idle connection, or opens a new one.
+func (rd *Redis) get() (*redisConn, error) {
+	rd.mu.Lock()
+	if n := len(rd.idle); n > 0 {
+		c := rd.idle[n-1]
+		rd.idle = rd.idle[:n-1]
+		rd.mu.Unlock()
+		return c, nil
+	}
+	rd.mu.Unlock()
+	return rd.dial()
+}
+
+// put puts c back in the pool, or closes it if there are enough
+// idle connections. If c broke, the idle connections are closed
+// too, as they likely broke the same way, like when the server
+// restarted.
+func (rd *Redis) put(c *redisConn) {
+	maxIdle := rd.MaxIdle
+	if maxIdle == 0 {
+		maxIdle = 4
+	}
+	rd.mu.Lock()
+	if c.broken {
+		for _, idle := range rd.idle {
+			idle.Close()
+		}
+		rd.idle = nil
+	} else if len(rd.idle) < maxIdle {
+		rd.idle = append(rd.idle, c)
+		rd.mu.Unlock()
+		return
+	}
+	rd.mu.Unlock()
+	c.Close()
+}
+
+func (rd *Redis) timeout() time.Duration {
+	if rd.Timeout == 0 {
+		return 5 * time.Second
+	}
+	return rd.Timeout
+}
+
+// dial opens a connection and authenticates.
+func (rd *Redis) dial() (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", rd.Addr, rd.timeout())
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(rd.timeout()))
+	c := &redisConn{Conn: conn, r: bufio.NewReader(conn)}
+
+	if rd.Password != "" {
+		if _, err := c.do("AUTH", rd.Password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if rd.DB != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(rd.DB)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// do sends a command and reads its reply. If that fails, other
+// than with an error reply, the connection is broken: it can't
+// be known what state it is in.
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	if c.broken {
+		return nil, errors.New("redis: connection broken")
+	}
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, "\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	if _, err := c.Write(buf); err != nil {
+		c.broken = true
+		return nil, err
+	}
+	reply, err := readReply(c.r)
+	if err != nil && !isRedisError(err) {
+		c.broken = true
+	}
+	return reply, err
+}
+
+// readReply reads a reply: a string for a status, an int64,
+// []byte for a bulk string and []interface{} for an array,
+// or nil for a null bulk string or array.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil && !isRedisError(err) {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, errors.New("redis: malformed reply")
+}
+
+// setArgs returns the arguments of a SET of key to value
+// that expires after ttl, if it's more than 0.
+func setArgs(key string, value []byte, ttl time.Duration) []string {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		ms := int64(ttl / time.Millisecond)
+		if ms < 1 {
+			ms = 1
+		}
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	return args
+}
+
+// globEscape escapes the characters that are special
+// in the patterns of SCAN MATCH.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]\`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func isRedisError(err error) bool {
+	_, ok := err.(redisError)
+	return ok
+}
@@ -0,0 +1,56 @@
+// Package storage gives middleware that keeps state, such as rate
+// limits and short links, a key/value store to keep it in. Sites
+// use a directory of files by default; a store like Redis lets
+// several servers share the state.
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by Get for a key that
+// has no value, or whose value has expired.
+var ErrNotFound = errors.New("storage: key not found")
+
+// Storage is a key/value store. Keys are any string; middleware
+// gives its keys a prefix of its own, like "ratelimit/", so that
+// several can share a store. Implementations must be safe for
+// concurrent use.
+type Storage interface {
+	// Get returns the value of key, or ErrNotFound.
+	Get(key string) ([]byte, error)
+
+	// Put sets the value of key. If ttl is more than 0, the
+	// value expires after that long.
+	Put(key string, value []byte, ttl time.Duration) error
+
+	// Delete removes key. It is not an error if there is none.
+	Delete(key string) error
+
+	// List returns the keys that start with prefix, sorted.
+	List(prefix string) ([]string, error)
+
+	// Update changes the value of key atomically: fn gets the
+	// current value, nil if there is none, and returns the new
+	// one, nil to delete the key. If fn returns an error, the
+	// value stays as it was and Update returns the error. fn
+	// may be called more than once if others change the value
+	// meanwhile, so it must not have side effects.
+	Update(key string, ttl time.Duration, fn func(value []byte) ([]byte, error)) error
+}
+
+// expired reports whether a value that expires at the
+// given time, or never if it's zero, has expired by now.
+func expired(expires, now time.Time) bool {
+	return !expires.IsZero() && !now.Before(expires)
+}
+
+// expiry returns when a value stored at now with
+// the given ttl expires; zero if it doesn't.
+func expiry(ttl time.Duration, now time.Time) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
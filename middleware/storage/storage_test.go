@@ -0,0 +1,430 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// testStorage checks the behavior all stores share.
+func testStorage(t *testing.T, s Storage) {
+	if _, err := s.Get("a"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for a missing key, got %v", err)
+	}
+
+	for _, key := range []string{"a", "b/1", "b/2", "b*", "c d"} {
+		if err := s.Put(key, []byte("value of "+key), 0); err != nil {
+			t.Fatalf("Putting %s: %v", key, err)
+		}
+	}
+	if value, err := s.Get("b/1"); err != nil || string(value) != "value of b/1" {
+		t.Errorf("Expected value of b/1, got '%s' (%v)", value, err)
+	}
+	if keys, err := s.List("b/"); err != nil || !reflect.DeepEqual(keys, []string{"b/1", "b/2"}) {
+		t.Errorf("Expected keys [b/1 b/2], got %v (%v)", keys, err)
+	}
+	if keys, err := s.List(""); err != nil || len(keys) != 5 {
+		t.Errorf("Expected 5 keys, got %v (%v)", keys, err)
+	}
+
+	if err := s.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("a"); err != nil {
+		t.Errorf("Expected no error deleting a missing key, got %v", err)
+	}
+	if _, err := s.Get("a"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for a deleted key, got %v", err)
+	}
+
+	if err := s.Put("short", []byte("x"), 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := s.Get("short"); err != nil || string(value) != "x" {
+		t.Errorf("Expected value x before it expires, got '%s' (%v)", value, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := s.Get("short"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for an expired key, got %v", err)
+	}
+	if keys, _ := s.List("short"); len(keys) != 0 {
+		t.Errorf("Expected expired key not to be listed, got %v", keys)
+	}
+
+	// updates from many goroutines all count
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Update("count", 0, func(value []byte) ([]byte, error) {
+				n, _ := strconv.Atoi(string(value))
+				return []byte(strconv.Itoa(n + 1)), nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if value, _ := s.Get("count"); string(value) != "20" {
+		t.Errorf("Expected count of 20, got '%s'", value)
+	}
+
+	failed := errors.New("failed")
+	err := s.Update("count", 0, func([]byte) ([]byte, error) { return []byte("0"), failed })
+	if err != failed {
+		t.Errorf("Expected the error of the update function, got %v", err)
+	}
+	if value, _ := s.Get("count"); string(value) != "20" {
+		t.Errorf("Expected a failed update to keep the value, got '%s'", value)
+	}
+	if err := s.Update("count", 0, func([]byte) ([]byte, error) { return nil, nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("count"); err != ErrNotFound {
+		t.Errorf("Expected an update to nil to delete the key, got %v", err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStorage(t, NewMemory())
+}
+
+func TestMemorySweep(t *testing.T) {
+	m := NewMemory()
+	m.sweepSize = 4
+	for i := 0; i < 4; i++ {
+		m.Put(strconv.Itoa(i), nil, time.Nanosecond)
+	}
+	time.Sleep(time.Millisecond)
+	m.Put("kept", nil, 0)
+	if len(m.entries) != 1 {
+		t.Errorf("Expected expired entries to be swept, got %d entries", len(m.entries))
+	}
+}
+
+func TestDir(t *testing.T) {
+	path, err := ioutil.TempDir("", "caddy_storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	d := NewDir(filepath.Join(path, "state"), middleware.FilePerms{})
+	if NewDir(filepath.Join(path, "state", "."), middleware.FilePerms{}) != d {
+		t.Error("Expected stores of the same directory to be shared")
+	}
+	if keys, err := d.List(""); err != nil || len(keys) != 0 {
+		t.Errorf("Expected no keys before the directory exists, got %v (%v)", keys, err)
+	}
+	testStorage(t, d)
+
+	// values without a ttl are kept as they are
+	body, err := ioutil.ReadFile(filepath.Join(d.Path(), "b%2F1"))
+	if err != nil || string(body) != "value of b/1" {
+		t.Errorf("Expected file b%%2F1 to hold the value as is, got '%s' (%v)", body, err)
+	}
+	names, _ := filepath.Glob(filepath.Join(d.Path(), "%tmp-*"))
+	if len(names) != 0 {
+		t.Errorf("Expected no temporary files left, got %v", names)
+	}
+	for _, key := range []string{"", ".", ".."} {
+		if err := d.Put(key, nil, 0); err == nil {
+			t.Errorf("Expected an error putting key '%s'", key)
+		}
+	}
+}
+
+func TestDirSweep(t *testing.T) {
+	path, err := ioutil.TempDir("", "caddy_storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	d := NewDir(path, middleware.FilePerms{})
+	d.Put("short", []byte("x"), time.Nanosecond)
+	d.Put("long", []byte("x"), time.Hour)
+	d.Put("forever", []byte("x"), 0)
+	time.Sleep(time.Millisecond)
+
+	d.sweepInterval = 0
+	d.Put("trigger", []byte("x"), 0)
+	names, _ := filepath.Glob(filepath.Join(path, "*"))
+	if len(names) != 3 {
+		t.Errorf("Expected the expired value's file to be removed, got %v", names)
+	}
+	if _, err := os.Stat(filepath.Join(path, "short")); !os.IsNotExist(err) {
+		t.Errorf("Expected file of expired value to be gone, got %v", err)
+	}
+}
+
+func TestRedis(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	defer server.Close()
+
+	rd := &Redis{Addr: server.Addr().String(), Password: "secret", Prefix: "site/"}
+	if err := rd.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, rd)
+
+	if _, err := server.data.Get("site/b/1"); err != nil {
+		t.Errorf("Expected keys to be stored with the prefix, got %v", err)
+	}
+
+	// an update retries when another client changes the key meanwhile
+	other := &Redis{Addr: server.Addr().String(), Password: "secret", Prefix: "site/"}
+	calls := 0
+	err := rd.Update("race", 0, func(value []byte) ([]byte, error) {
+		calls++
+		if calls == 1 {
+			other.Put("race", []byte("theirs"), 0)
+		}
+		return append(value, "+mine"...), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := rd.Get("race"); calls != 2 || string(value) != "theirs+mine" {
+		t.Errorf("Expected a second try on top of the other change, got '%s' after %d calls", value, calls)
+	}
+
+	// the connection is opened again after it breaks; the
+	// command that finds it broken fails
+	server.dropAll()
+	rd.Ping()
+	if err := rd.Put("again", []byte("x"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := rd.Get("again"); err != nil || string(value) != "x" {
+		t.Errorf("Expected to reconnect, got '%s' (%v)", value, err)
+	}
+
+	// a failed transaction is discarded, so that the connection
+	// can be used for other commands again
+	server.reject(true)
+	if err := rd.Update("tx", 0, func([]byte) ([]byte, error) { return []byte("x"), nil }); err == nil {
+		t.Error("Expected the update to fail")
+	}
+	server.reject(false)
+	if err := rd.Put("tx", []byte("after"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := rd.Get("tx"); err != nil || string(value) != "after" {
+		t.Errorf("Expected the connection to work after a failed update, got '%s' (%v)", value, err)
+	}
+
+	// connections are pooled, so concurrent calls don't wait for each other
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := rd.Put("pool/"+strconv.Itoa(i), []byte("x"), 0); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	rd.mu.Lock()
+	idle := len(rd.idle)
+	rd.mu.Unlock()
+	if idle < 1 || idle > 4 {
+		t.Errorf("Expected between 1 and 4 idle connections, got %d", idle)
+	}
+
+	wrong := &Redis{Addr: server.Addr().String(), Password: "wrong"}
+	if err := wrong.Ping(); err == nil || !strings.Contains(err.Error(), "invalid password") {
+		t.Errorf("Expected an error for a wrong password, got %v", err)
+	}
+}
+
+// fakeRedis serves the commands Redis uses, keeping
+// the data in a Memory store.
+type fakeRedis struct {
+	net.Listener
+	password string
+	data     *Memory
+
+	mu       sync.Mutex
+	versions map[string]int
+	conns    []net.Conn
+
+	// whether to refuse commands in a transaction
+	rejectQueued bool
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{Listener: ln, password: password, data: NewMemory(), versions: make(map[string]int)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns = append(f.conns, conn)
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) dropAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+}
+
+func (f *fakeRedis) reject(queued bool) {
+	f.mu.Lock()
+	f.rejectQueued = queued
+	f.mu.Unlock()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+	watched := make(map[string]int)
+	var queued [][]string
+	inMulti := false
+
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			b, _ := item.([]byte)
+			args[i] = string(b)
+		}
+		if len(args) == 0 {
+			return
+		}
+
+		f.mu.Lock()
+		reject := f.rejectQueued
+		f.mu.Unlock()
+
+		var out string
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			if authed = args[1] == f.password; authed {
+				out = "+OK\r\n"
+			} else {
+				out = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			out = "-NOAUTH Authentication required.\r\n"
+		case cmd == "WATCH":
+			f.mu.Lock()
+			watched[args[1]] = f.versions[args[1]]
+			f.mu.Unlock()
+			out = "+OK\r\n"
+		case cmd == "UNWATCH":
+			watched = make(map[string]int)
+			out = "+OK\r\n"
+		case cmd == "MULTI":
+			inMulti, queued = true, nil
+			out = "+OK\r\n"
+		case cmd == "DISCARD":
+			inMulti, queued, watched = false, nil, make(map[string]int)
+			out = "+OK\r\n"
+		case inMulti && cmd != "EXEC" && reject:
+			out = "-ERR rejected\r\n"
+		case inMulti && cmd != "EXEC":
+			queued = append(queued, args)
+			out = "+QUEUED\r\n"
+		case cmd == "EXEC":
+			f.mu.Lock()
+			ok := true
+			for key, version := range watched {
+				ok = ok && f.versions[key] == version
+			}
+			f.mu.Unlock()
+			inMulti, watched = false, make(map[string]int)
+			if !ok {
+				out = "*-1\r\n"
+				break
+			}
+			out = "*" + strconv.Itoa(len(queued)) + "\r\n"
+			for _, args := range queued {
+				out += f.run(args)
+			}
+		default:
+			out = f.run(args)
+		}
+		if _, err := conn.Write([]byte(out)); err != nil {
+			return
+		}
+	}
+}
+
+// run runs a command that doesn't depend on the connection.
+func (f *fakeRedis) run(args []string) string {
+	bulk := func(s string) string { return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n" }
+	changed := func(key string) {
+		f.mu.Lock()
+		f.versions[key]++
+		f.mu.Unlock()
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		value, err := f.data.Get(args[1])
+		if err != nil {
+			return "$-1\r\n"
+		}
+		return bulk(string(value))
+	case "SET":
+		var ttl time.Duration
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			ttl = time.Duration(ms) * time.Millisecond
+		}
+		f.data.Put(args[1], []byte(args[2]), ttl)
+		changed(args[1])
+		return "+OK\r\n"
+	case "DEL":
+		f.data.Delete(args[1])
+		changed(args[1])
+		return ":1\r\n"
+	case "SCAN":
+		// a glob of a literal prefix and *, escaped with backslashes
+		prefix := strings.TrimSuffix(args[3], "*")
+		prefix = strings.NewReplacer(`\*`, "*", `\?`, "?", `\[`, "[", `\]`, "]", `\\`, `\`).Replace(prefix)
+		keys, _ := f.data.List(prefix)
+		out := "*2\r\n" + bulk("0") + "*" + strconv.Itoa(len(keys)) + "\r\n"
+		for _, key := range keys {
+			out += bulk(key)
+		}
+		return out
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
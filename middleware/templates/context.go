@@ -6,10 +6,14 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"text/template"
+	"os"
+	"path"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/mholt/caddy/middleware"
+	"github.com/russross/blackfriday"
 )
 
 // This file contains the context and functions available for
@@ -20,6 +24,14 @@ type context struct {
 	root http.FileSystem
 	req  *http.Request
 	URL  *url.URL
+
+	// Body is the rendered file, when executing
+	// the layout it is rendered into
+	Body string
+
+	// form is the request's form, parsed the
+	// first time a template asks for it
+	form *form
 }
 
 // Include returns the contents of filename relative to the site root
@@ -35,7 +47,7 @@ func (c context) Include(filename string) (string, error) {
 		return "", err
 	}
 
-	tpl, err := template.New(filename).Parse(string(body))
+	tpl, err := newTemplate(filename).Parse(string(body))
 	if err != nil {
 		return "", err
 	}
@@ -54,6 +66,47 @@ func (c context) Date(format string) string {
 	return time.Now().Format(format)
 }
 
+// Now returns the current time, for use like {{.Now.Year}}.
+func (c context) Now() time.Time {
+	return time.Now()
+}
+
+// Env returns the value of the environment variable name.
+func (c context) Env(name string) string {
+	return os.Getenv(name)
+}
+
+// Markdown renders the Markdown text s as HTML. To render
+// a file, use it with Include, like {{.Markdown (.Include "/notes.md")}}.
+func (c context) Markdown(s string) string {
+	return string(blackfriday.MarkdownCommon([]byte(s)))
+}
+
+// ListFiles returns the names of the files in the directory
+// dir, which is relative to the site root, in sorted order.
+// Directories' names end with a slash.
+func (c context) ListFiles(dir string) ([]string, error) {
+	f, err := c.root.Open(path.Clean("/" + dir))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+		if info.IsDir() {
+			names[i] += "/"
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 // Cookie gets the value of a cookie with name name.
 func (c context) Cookie(name string) string {
 	cookies := c.req.Cookies()
@@ -70,6 +123,13 @@ func (c context) Header(name string) string {
 	return c.req.Header.Get(name)
 }
 
+// Replace replaces the placeholders in s, like {remote} or
+// {>Referer}, with values from the request, the same as in
+// log formats and headers (see middleware.Replacer).
+func (c context) Replace(s string) string {
+	return middleware.NewReplacer(c.req, nil, "").Replace(s)
+}
+
 // IP gets the (remote) IP address of the client making the request.
 func (c context) IP() string {
 	ip, _, err := net.SplitHostPort(c.req.RemoteAddr)
@@ -115,3 +175,87 @@ func (c context) Method() string {
 func (c context) PathMatches(pattern string) bool {
 	return middleware.Path(c.req.URL.Path).Matches(pattern)
 }
+
+// CSPNonce returns the request's Content-Security-Policy nonce,
+// the same one that the header directive puts in place of
+// {csp_nonce}, for use like <script nonce="{{.CSPNonce}}">.
+func (c context) CSPNonce() string {
+	return middleware.CSPNonce(c.req)
+}
+
+// Form returns the first value of the form field name, from
+// the query string or the request body.
+func (c context) Form(name string) (string, error) {
+	if err := c.form.parse(c.req); err != nil {
+		return "", err
+	}
+	if values := c.form.values[name]; len(values) > 0 {
+		return values[0], nil
+	}
+	return "", nil
+}
+
+// FormFile returns the first file uploaded in the form field
+// name of a multipart request body, or nil if there is none.
+func (c context) FormFile(name string) (*middleware.MultipartFile, error) {
+	if err := c.form.parse(c.req); err != nil {
+		return nil, err
+	}
+	if c.form.multipart == nil {
+		return nil, nil
+	}
+	if files := c.form.multipart.File[name]; len(files) > 0 {
+		return files[0], nil
+	}
+	return nil, nil
+}
+
+// form is the form of the request being rendered. Multipart
+// bodies are parsed within limits, and their temporary files
+// are removed once rendering is done.
+type form struct {
+	limits    middleware.MultipartLimits
+	parsed    bool
+	values    url.Values
+	multipart *middleware.MultipartForm
+	err       error
+}
+
+func (f *form) parse(r *http.Request) error {
+	if f.parsed {
+		return f.err
+	}
+	f.parsed = true
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f.err = r.ParseForm()
+		f.values = r.Form
+		return f.err
+	}
+
+	f.values = r.URL.Query()
+	f.multipart, f.err = f.limits.Parse(r)
+	if f.err != nil {
+		return f.err
+	}
+	for name, values := range f.multipart.Value {
+		f.values[name] = append(f.values[name], values...)
+	}
+	return nil
+}
+
+// status returns the status for the request if parsing its form
+// failed, or 0 if it didn't (or the form wasn't needed).
+func (f *form) status() int {
+	if f == nil || f.err == nil {
+		return 0
+	}
+	return middleware.MultipartStatus(f.err)
+}
+
+// removeAll removes any temporary files of the form.
+func (f *form) removeAll() {
+	if f != nil && f.multipart != nil {
+		f.multipart.RemoveAll()
+	}
+}
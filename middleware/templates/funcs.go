@@ -0,0 +1,27 @@
+package templates
+
+import (
+	"strings"
+	"text/template"
+)
+
+// funcMap holds the functions available to templates, besides
+// the methods of the context. They are for working with strings,
+// like {{.Header "Accept-Language" | lower | hasPrefix "fr"}}.
+var funcMap = template.FuncMap{
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"trim":      strings.TrimSpace,
+	"split":     strings.Split,
+	"join":      strings.Join,
+	"contains":  func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix": func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"replace":   func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+}
+
+// newTemplate returns a new template named name, with the
+// functions in funcMap, for parsing the text of a file.
+func newTemplate(name string) *template.Template {
+	return template.New(name).Funcs(funcMap)
+}
@@ -3,10 +3,13 @@ package templates
 
 import (
 	"bytes"
+	"html"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"sync"
 	"text/template"
 
 	"github.com/mholt/caddy/middleware"
@@ -30,29 +33,7 @@ func (t Templates) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 
 		for _, ext := range rule.Extensions {
 			if reqExt == ext {
-				// Create execution context
-				ctx := context{root: t.FileSys, req: r, URL: r.URL}
-
-				// Build the template
-				tpl, err := template.ParseFiles(filepath.Join(t.Root, fpath))
-				if err != nil {
-					if os.IsNotExist(err) {
-						return http.StatusNotFound, nil
-					} else if os.IsPermission(err) {
-						return http.StatusForbidden, nil
-					}
-					return http.StatusInternalServerError, err
-				}
-
-				// Execute it
-				var buf bytes.Buffer
-				err = tpl.Execute(&buf, ctx)
-				if err != nil {
-					return http.StatusInternalServerError, err
-				}
-				buf.WriteTo(w)
-
-				return http.StatusOK, nil
+				return t.render(w, middleware.WithCSPNonce(r), fpath, rule.Layouts[ext])
 			}
 		}
 	}
@@ -60,12 +41,149 @@ func (t Templates) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error
 	return t.Next.ServeHTTP(w, r)
 }
 
+// render executes the template file at fpath, or takes it as
+// is if layout says so, and writes the result into layout's
+// base template, if it has one. Nothing is written to w unless
+// rendering succeeds, so a template error can still be given
+// a proper error page by the errors middleware.
+func (t Templates) render(w http.ResponseWriter, r *http.Request, fpath string, layout Layout) (int, error) {
+	// Create execution context
+	ctx := context{root: t.FileSys, req: r, URL: r.URL, form: &form{limits: t.Multipart}}
+	defer ctx.form.removeAll()
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if layout.Raw {
+		body, err := t.readFile(fpath)
+		if err != nil {
+			return fileErrorStatus(err)
+		}
+		buf.WriteString(html.EscapeString(string(body)))
+	} else {
+		// Build the template
+		tpl, err := t.parseFile(fpath)
+		if err != nil {
+			return fileErrorStatus(err)
+		}
+		status, err := execute(tpl, buf, r, ctx)
+		if err != nil {
+			return status, err
+		}
+	}
+
+	if layout.File != "" {
+		tpl, err := t.parseFile(layout.File)
+		if err != nil {
+			// a missing layout is the site's fault, not the client's
+			return http.StatusInternalServerError, err
+		}
+		ctx.Body = buf.String()
+		buf.Reset()
+		status, err := execute(tpl, buf, r, ctx)
+		if err != nil {
+			return status, err
+		}
+	}
+
+	buf.WriteTo(w)
+	return http.StatusOK, nil
+}
+
+// parseFile parses the template file at fpath, which is relative
+// to the site root. The template is named by fpath, so that errors
+// in it say which file of the site and where, like
+// "template: /blog/index.html:12:5: ...".
+func (t Templates) parseFile(fpath string) (*template.Template, error) {
+	body, err := t.readFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	return newTemplate(fpath).Parse(string(body))
+}
+
+// readFile reads the file at fpath, which is relative to the
+// site root, through t.FileSys.
+func (t Templates) readFile(fpath string) ([]byte, error) {
+	f, err := t.FileSys.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// bufPool holds the buffers that templates are rendered into.
+var bufPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// maxPooledBuffer is the largest buffer put back in bufPool, so
+// that one huge page doesn't keep its memory in use for good.
+const maxPooledBuffer = 1 << 20
+
+func getBuffer() *bytes.Buffer {
+	return bufPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufPool.Put(buf)
+}
+
+// execute executes tpl into buf, giving up if the client
+// goes away or the request takes too long.
+func execute(tpl *template.Template, buf *bytes.Buffer, r *http.Request, ctx context) (int, error) {
+	err := tpl.Execute(requestWriter{buf, r}, ctx)
+	if status := middleware.ContextStatus(r.Context()); status != 0 {
+		return status, r.Context().Err()
+	}
+	if status := ctx.form.status(); status != 0 {
+		return status, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// fileErrorStatus returns the status for an error
+// opening the requested file.
+func fileErrorStatus(err error) (int, error) {
+	if os.IsNotExist(err) {
+		return http.StatusNotFound, nil
+	} else if os.IsPermission(err) {
+		return http.StatusForbidden, nil
+	}
+	return http.StatusInternalServerError, err
+}
+
+// requestWriter writes to a buffer until the context of the request
+// being rendered is done, so rendering stops early if it is abandoned.
+type requestWriter struct {
+	buf *bytes.Buffer
+	req *http.Request
+}
+
+func (w requestWriter) Write(p []byte) (int, error) {
+	if err := w.req.Context().Err(); err != nil {
+		return 0, err
+	}
+	return w.buf.Write(p)
+}
+
 // Templates is middleware to render templated files as the HTTP response.
 type Templates struct {
 	Next    middleware.Handler
 	Rules   []Rule
 	Root    string
 	FileSys http.FileSystem
+
+	// How multipart bodies are parsed for {{.Form}}
+	Multipart middleware.MultipartLimits
 }
 
 // Rule represents a template rule. A template will only execute
@@ -75,4 +193,82 @@ type Rule struct {
 	Path       string
 	Extensions []string
 	IndexFiles []string
+
+	// Layouts maps extensions to how files with
+	// them are rendered, if not on their own
+	Layouts map[string]Layout
+}
+
+// Layout is how the files with a particular extension are
+// rendered. The base template in File is executed with the
+// rendered file in {{.Body}}; if Raw is true, the file is
+// not executed as a template but inserted as is, with any
+// HTML in it escaped, as for showing text in a <pre> block.
+type Layout struct {
+	File string // path of the base template, relative to the site root
+	Raw  bool
+}
+
+// Scopes implements the middleware.Scoped interface.
+func (t Templates) Scopes() []string {
+	scopes := make([]string, len(t.Rules))
+	for i, rule := range t.Rules {
+		scopes[i] = rule.Path
+	}
+	return scopes
+}
+
+// ParseFiles parses the templates of rule under root, along with
+// its layouts, to find errors in them before they are served. The
+// files are read through fs, which serves root. It returns the
+// first error and how many files had one.
+func ParseFiles(root string, fs http.FileSystem, rule Rule) (int, error) {
+	var failed int
+	var first error
+	check := func(fpath string) {
+		if _, err := (Templates{Root: root, FileSys: fs}).parseFile(fpath); err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+
+	dir := filepath.Join(root, filepath.FromSlash(rule.Path))
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && name == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() || !hasExt(rule.Extensions, filepath.Ext(name)) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		check("/" + filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return failed, err
+	}
+	for _, layout := range rule.Layouts {
+		if !layout.Raw {
+			check(layout.File)
+		}
+	}
+	return failed, first
+}
+
+// hasExt returns true if ext is one of exts.
+func hasExt(exts []string, ext string) bool {
+	for _, e := range exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
 }
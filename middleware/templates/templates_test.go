@@ -0,0 +1,328 @@
+package templates
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/headers"
+	mwtest "github.com/mholt/caddy/middleware/testing"
+)
+
+func TestLayouts(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for name, body := range map[string]string{
+		"page.html":   `<p>{{.URL.Path}}</p>`,
+		"page.tmpl":   `<p>{{.URL.Path}}</p>`,
+		"notes.txt":   `a < b {{not executed}}`,
+		"base.html":   `<main>{{.Body}}</main>`,
+		"pre.html":    `<pre>{{.Body}}</pre>`,
+		"broken.html": `{{.Nope`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	next := &mwtest.Handler{Body: "next"}
+	tmpl := Templates{
+		Next:    next,
+		Root:    root,
+		FileSys: http.Dir(root),
+		Rules: []Rule{{
+			Path:       "/",
+			Extensions: []string{".html", ".tmpl", ".txt"},
+			Layouts: map[string]Layout{
+				".tmpl": {File: "/base.html"},
+				".txt":  {File: "/pre.html", Raw: true},
+			},
+		}},
+	}
+
+	for i, test := range []struct {
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"/page.html", http.StatusOK, "<p>/page.html</p>"},
+		{"/page.tmpl", http.StatusOK, "<main><p>/page.tmpl</p></main>"},
+		{"/notes.txt", http.StatusOK, "<pre>a &lt; b {{not executed}}</pre>"},
+		{"/missing.txt", http.StatusNotFound, "404 Not Found"},
+		{"/broken.html", http.StatusInternalServerError, "500 Internal Server Error"},
+		{"/other.css", http.StatusOK, "next"},
+	} {
+		rec := mwtest.Serve(tmpl, httptest.NewRequest("GET", test.path, nil))
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, rec.Code)
+		}
+		if got := rec.Body.String(); got != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, got)
+		}
+	}
+
+	// a layout that can't be loaded is a server error
+	tmpl.Rules[0].Layouts[".html"] = Layout{File: "/nowhere.html"}
+	rec := mwtest.Serve(tmpl, httptest.NewRequest("GET", "/page.html", nil))
+	rec.AssertStatus(t, http.StatusInternalServerError)
+}
+
+func TestTemplateErrors(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.Mkdir(filepath.Join(root, "blog"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "blog", "index.html"), []byte("<p>partial</p>\n{{.Nope}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := Templates{
+		Next:    &mwtest.Handler{},
+		Root:    root,
+		FileSys: http.Dir(root),
+		Rules:   []Rule{{Path: "/", Extensions: []string{".html"}, IndexFiles: []string{"index.html"}}},
+	}
+
+	rec := mwtest.Serve(tmpl, httptest.NewRequest("GET", "/blog/", nil))
+	rec.AssertStatus(t, http.StatusInternalServerError)
+	rec.AssertBody(t, "500 Internal Server Error")
+	if rec.Err == nil || !strings.Contains(rec.Err.Error(), "/blog/index.html:2:") {
+		t.Errorf("Expected the error to give the file and line, got: %v", rec.Err)
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for name, body := range map[string]string{
+		"index.html":       `<p>{{.URL.Path}}</p>`,
+		"blog/post.html":   `{{if .URL}}`,
+		"blog/other.html":  `{{.Nope`,
+		"blog/notes.txt":   `{{not a template`,
+		"layouts/pre.html": `<pre>{{.Body}}</pre>`,
+	} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, test := range []struct {
+		rule           Rule
+		expectedFailed int
+	}{
+		{Rule{Path: "/", Extensions: []string{".html"}}, 2},
+		{Rule{Path: "/blog", Extensions: []string{".txt"}}, 1},
+		{Rule{Path: "/layouts", Extensions: []string{".html"}}, 0},
+		{Rule{Path: "/missing", Extensions: []string{".html"}}, 0},
+		{Rule{Path: "/layouts", Extensions: []string{".html"}, Layouts: map[string]Layout{".html": {File: "/blog/post.html"}}}, 1},
+		{Rule{Path: "/layouts", Extensions: []string{".html"}, Layouts: map[string]Layout{".html": {File: "/blog/post.html", Raw: true}}}, 0},
+	} {
+		failed, err := ParseFiles(root, http.Dir(root), test.rule)
+		if failed != test.expectedFailed {
+			t.Errorf("Test %d: Expected %d files with errors, got %d (%v)", i, test.expectedFailed, failed, err)
+		}
+		if (err != nil) != (test.expectedFailed > 0) {
+			t.Errorf("Test %d: Expected an error only if a file failed, got %v", i, err)
+		}
+	}
+}
+
+func TestCSPNonce(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "page.html"), []byte(`{{.CSPNonce}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := mwtest.Chain(&mwtest.Handler{}, func(next middleware.Handler) middleware.Handler {
+		return headers.Headers{Next: next, Rules: []headers.Rule{{Path: "/", Headers: []headers.Header{
+			{Name: "Content-Security-Policy", Value: "script-src 'nonce-{csp_nonce}'"},
+		}}}}
+	}, func(next middleware.Handler) middleware.Handler {
+		return Templates{Next: next, Root: root, FileSys: http.Dir(root),
+			Rules: []Rule{{Path: "/", Extensions: []string{".html"}}}}
+	})
+
+	rec := mwtest.Serve(h, httptest.NewRequest("GET", "/page.html", nil))
+	rec.AssertStatus(t, http.StatusOK)
+	nonce := rec.Body.String()
+	if nonce == "" {
+		t.Fatal("Expected the page to have a nonce")
+	}
+	rec.AssertHeader(t, "Content-Security-Policy", "script-src 'nonce-"+nonce+"'")
+
+	if again := mwtest.Serve(h, httptest.NewRequest("GET", "/page.html", nil)).Body.String(); again == nonce {
+		t.Error("Expected a different nonce for each request")
+	}
+}
+
+func TestForm(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	page := `{{.Form "name"}} {{with .FormFile "upload"}}{{.Filename}} {{.Size}}{{end}}`
+	if err := ioutil.WriteFile(filepath.Join(root, "page.html"), []byte(page), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := Templates{Next: &mwtest.Handler{}, Root: root, FileSys: http.Dir(root),
+		Rules:     []Rule{{Path: "/", Extensions: []string{".html"}}},
+		Multipart: middleware.MultipartLimits{MaxFiles: 1}}
+
+	newRequest := func(files int) *http.Request {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		w.WriteField("name", "gopher")
+		for i := 0; i < files; i++ {
+			fw, _ := w.CreateFormFile("upload", "a.txt")
+			fw.Write([]byte("hello"))
+		}
+		w.Close()
+		r := httptest.NewRequest("POST", "/page.html", &buf)
+		r.Header.Set("Content-Type", w.FormDataContentType())
+		return r
+	}
+
+	rec := mwtest.Serve(tmpl, httptest.NewRequest("GET", "/page.html?name=query", nil))
+	rec.AssertStatus(t, http.StatusOK)
+	rec.AssertBody(t, "query ")
+
+	rec = mwtest.Serve(tmpl, newRequest(1))
+	rec.AssertStatus(t, http.StatusOK)
+	rec.AssertBody(t, "gopher a.txt 5")
+
+	rec = mwtest.Serve(tmpl, newRequest(2))
+	rec.AssertStatus(t, http.StatusRequestEntityTooLarge)
+}
+
+func TestFuncs(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.Mkdir(filepath.Join(root, "posts"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range map[string]string{
+		"posts/b.md":    "",
+		"posts/a.md":    "",
+		"partial.html":  `{{.Header "X-Name" | upper}}`,
+		"notes.md":      "# Notes",
+		"page.html":     `{{.Include "/partial.html"}}|{{.Env "CADDY_TEMPLATES_TEST"}}|{{.Markdown (.Include "/notes.md")}}|{{range .ListFiles "/posts"}}{{.}} {{end}}`,
+		"strings.html":  `{{join (split "a,b" ",") "+"}} {{"  x  " | trim}} {{.Method | lower}} {{replace "-" " " "a-b"}} {{.Header "X-Name" | hasPrefix "go"}} {{.Replace "{method} {path} {>X-Name}"}}`,
+		"missing.html":  `{{.ListFiles "/nope"}}`,
+		"now.html":      `{{if gt .Now.Year 2000}}ok{{end}}`,
+		"escaping.html": `{{.ListFiles "/../.."}}`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("CADDY_TEMPLATES_TEST", "env")
+
+	tmpl := Templates{Next: &mwtest.Handler{}, Root: root, FileSys: http.Dir(root),
+		Rules: []Rule{{Path: "/", Extensions: []string{".html"}}}}
+
+	for i, test := range []struct {
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"/page.html", http.StatusOK, "GOPHER|env|<h1>Notes</h1>\n|a.md b.md "},
+		{"/strings.html", http.StatusOK, "a+b x get a b true GET /strings.html gopher"},
+		{"/now.html", http.StatusOK, "ok"},
+		{"/missing.html", http.StatusInternalServerError, "500 Internal Server Error"},
+		// the site root can't be escaped
+		{"/escaping.html", http.StatusOK, "[escaping.html missing.html notes.md now.html page.html partial.html posts/ strings.html]"},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.Header.Set("X-Name", "gopher")
+		rec := mwtest.Serve(tmpl, r)
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, rec.Code)
+		}
+		if got := rec.Body.String(); got != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, got)
+		}
+	}
+}
+
+func TestConfinedRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	outside, err := ioutil.TempDir("", "caddy_templates_outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret.html"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.html"), filepath.Join(root, "secret.html")); err != nil {
+		t.Skipf("Can't create symlinks: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.html"), filepath.Join(root, "notes.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "page.html"), []byte(`{{.Include "/secret.html"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := Templates{Next: &mwtest.Handler{}, Root: root, FileSys: middleware.ConfinedDir(root),
+		Rules: []Rule{{Path: "/", Extensions: []string{".html", ".txt"},
+			Layouts: map[string]Layout{".txt": {Raw: true}}}}}
+
+	for i, test := range []struct {
+		path           string
+		expectedStatus int
+	}{
+		{"/secret.html", http.StatusNotFound},
+		{"/notes.txt", http.StatusNotFound},
+		{"/page.html", http.StatusInternalServerError},
+	} {
+		rec := mwtest.Serve(tmpl, httptest.NewRequest("GET", test.path, nil))
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, rec.Code)
+		}
+		if strings.Contains(rec.Body.String(), "secret") {
+			t.Errorf("Test %d: Expected nothing from outside the root, got %q", i, rec.Body.String())
+		}
+	}
+
+	if failed, _ := ParseFiles(root, middleware.ConfinedDir(root), Rule{Path: "/", Extensions: []string{".html"}}); failed != 1 {
+		t.Errorf("Expected the linked template to fail the check, got %d failures", failed)
+	}
+}
@@ -0,0 +1,182 @@
+// Package testing provides utilities for testing middleware:
+// a fake Handler to stand in for the next layer, a Recorder
+// with assertions on the response, and helpers that run a
+// chain of middleware against a request the way the server
+// does. Import it under another name, since it shares its
+// name with the standard library's testing package:
+//
+//	import mwtest "github.com/mholt/caddy/middleware/testing"
+package testing
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// T is the part of *testing.T (or *testing.B) that
+// the assertions use.
+type T interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Handler is a fake middleware.Handler. It records the requests
+// it handles and responds with Header, Status and Body. Following
+// the middleware convention, it only writes a response if Status
+// is less than 400; otherwise it leaves that to whatever called it.
+type Handler struct {
+	Status int         // status to return; 200 if 0
+	Header http.Header // headers to set on the response
+	Body   string      // body to write
+	Err    error       // error to return
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	h.mu.Lock()
+	h.requests = append(h.requests, r)
+	h.mu.Unlock()
+
+	status := h.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status >= 400 {
+		return status, h.Err
+	}
+
+	for name, values := range h.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(status)
+	fmt.Fprint(w, h.Body)
+	return status, h.Err
+}
+
+// Calls returns how many requests h has handled.
+func (h *Handler) Calls() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.requests)
+}
+
+// Request returns the last request h handled, as the
+// middleware above it passed it on, or nil if none.
+func (h *Handler) Request() *http.Request {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.requests) == 0 {
+		return nil
+	}
+	return h.requests[len(h.requests)-1]
+}
+
+// Chain builds a chain of middleware like a site's: the
+// first of layers is outermost, and last, usually a Handler,
+// is innermost, standing in for the file server.
+func Chain(last middleware.Handler, layers ...middleware.Middleware) middleware.Handler {
+	h := last
+	for i := len(layers) - 1; i >= 0; i-- {
+		h = layers[i](h)
+	}
+	return h
+}
+
+// Recorder records the response to a request handled by Serve,
+// along with what the outermost handler returned.
+type Recorder struct {
+	*httptest.ResponseRecorder
+	Returned int   // status returned by the handler
+	Err      error // error returned by the handler
+}
+
+// Serve has h handle r the way the server does: if h returns a
+// status of 400 or higher, it hasn't written a response, so the
+// default error response is written for it.
+func Serve(h middleware.Handler, r *http.Request) *Recorder {
+	rec := &Recorder{ResponseRecorder: httptest.NewRecorder()}
+	rec.Returned, rec.Err = h.ServeHTTP(rec, r)
+	if rec.Returned >= 400 {
+		writeError(rec, rec.Returned)
+	}
+	return rec
+}
+
+// HTTPHandler adapts h to an http.Handler that responds like the
+// server does, for use with httptest.NewServer or a real client.
+func HTTPHandler(h middleware.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := h.ServeHTTP(w, r)
+		if status >= 400 {
+			writeError(w, status)
+		}
+	})
+}
+
+// NewServer starts a test server that serves h. The
+// caller should call Close when finished with it.
+func NewServer(h middleware.Handler) *httptest.Server {
+	return httptest.NewServer(HTTPHandler(h))
+}
+
+// writeError writes the server's default error response.
+func writeError(w http.ResponseWriter, status int) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%d %s", status, http.StatusText(status))
+}
+
+// AssertStatus reports an error to t if the response
+// status isn't want.
+func (rec *Recorder) AssertStatus(t T, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Errorf("Expected status %d, got %d", want, rec.Code)
+	}
+}
+
+// AssertHeader reports an error to t if the response
+// header name isn't want. An empty want means the
+// header must not be set.
+func (rec *Recorder) AssertHeader(t T, name, want string) {
+	t.Helper()
+	if got := rec.Header().Get(name); got != want {
+		t.Errorf("Expected %s header to be %q, got %q", name, want, got)
+	}
+}
+
+// AssertBody reports an error to t if the response
+// body isn't want.
+func (rec *Recorder) AssertBody(t T, want string) {
+	t.Helper()
+	if got := rec.Body.String(); got != want {
+		t.Errorf("Expected body %q, got %q", want, got)
+	}
+}
+
+// AssertBodyContains reports an error to t if the
+// response body doesn't contain substr.
+func (rec *Recorder) AssertBodyContains(t T, substr string) {
+	t.Helper()
+	if got := rec.Body.String(); !strings.Contains(got, substr) {
+		t.Errorf("Expected body to contain %q, got %q", substr, got)
+	}
+}
+
+// AssertNoError reports an error to t if the handler
+// returned one.
+func (rec *Recorder) AssertNoError(t T) {
+	t.Helper()
+	if rec.Err != nil {
+		t.Errorf("Expected no error, got: %v", rec.Err)
+	}
+}
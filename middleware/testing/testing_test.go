@@ -0,0 +1,95 @@
+package testing
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// fakeT records the errors reported to it.
+type fakeT struct {
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+// tag is a middleware that sets a request header and a
+// response header, to show the order layers run in.
+func tag(name string) middleware.Middleware {
+	return func(next middleware.Handler) middleware.Handler {
+		return middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			r.Header.Add("X-Trace", name)
+			w.Header().Add("X-Trace", name)
+			return next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	next := &Handler{Body: "hello", Header: http.Header{"Content-Type": {"text/plain"}}}
+	h := Chain(next, tag("a"), tag("b"))
+
+	rec := Serve(h, httptest.NewRequest("GET", "/", nil))
+	rec.AssertNoError(t)
+	rec.AssertStatus(t, http.StatusOK)
+	rec.AssertHeader(t, "Content-Type", "text/plain")
+	rec.AssertBody(t, "hello")
+	if rec.Returned != http.StatusOK {
+		t.Errorf("Expected handler to return %d, got %d", http.StatusOK, rec.Returned)
+	}
+
+	if next.Calls() != 1 {
+		t.Errorf("Expected 1 call, got %d", next.Calls())
+	}
+	if got := next.Request().Header["X-Trace"]; len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Expected layers to run outermost first, got %v", got)
+	}
+}
+
+func TestServeError(t *testing.T) {
+	testErr := errors.New("no backend")
+	next := &Handler{Status: http.StatusBadGateway, Body: "not written", Err: testErr}
+
+	rec := Serve(next, httptest.NewRequest("GET", "/", nil))
+	rec.AssertStatus(t, http.StatusBadGateway)
+	rec.AssertBody(t, "502 Bad Gateway")
+	if rec.Err != testErr {
+		t.Errorf("Expected error %v, got %v", testErr, rec.Err)
+	}
+
+	ft := &fakeT{}
+	rec.AssertNoError(ft)
+	rec.AssertStatus(ft, http.StatusOK)
+	rec.AssertHeader(ft, "Content-Type", "text/html")
+	rec.AssertBodyContains(ft, "Gateway Timeout")
+	if len(ft.errors) != 4 {
+		t.Errorf("Expected 4 failed assertions, got %d: %v", len(ft.errors), ft.errors)
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	srv := NewServer(Chain(&Handler{Status: http.StatusNotFound}, tag("a")))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusNotFound || string(body) != "404 Not Found" {
+		t.Errorf("Expected the default 404 response, got %d %q", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("X-Trace"); got != "a" {
+		t.Errorf("Expected X-Trace header 'a', got %q", got)
+	}
+}
@@ -0,0 +1,178 @@
+// Package toggle lets layers of middleware, and settings of some
+// middleware, be turned on and off while the server runs, through
+// the admin API, without reloading the configuration. Each switch
+// is registered under the site it belongs to and a name, which for
+// a layer is the name of the directive that made it.
+package toggle
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mholt/caddy/admin"
+	"github.com/mholt/caddy/middleware"
+)
+
+// Switch is an on/off setting that is safe to
+// flip while requests are being handled.
+type Switch struct {
+	on int32
+}
+
+// NewSwitch returns a Switch that is on if on is true.
+func NewSwitch(on bool) *Switch {
+	s := new(Switch)
+	s.Set(on)
+	return s
+}
+
+// On returns true if the switch is on.
+func (s *Switch) On() bool {
+	return atomic.LoadInt32(&s.on) == 1
+}
+
+// Set turns the switch on or off.
+func (s *Switch) Set(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&s.on, v)
+}
+
+// Layer returns middleware that is m while s is on, and that
+// passes requests straight to the next handler while s is off.
+func Layer(s *Switch, m middleware.Middleware) middleware.Middleware {
+	return func(next middleware.Handler) middleware.Handler {
+		h := m(next)
+		if sc, ok := h.(middleware.Scoped); ok {
+			return scopedToggled{toggled{s, h, next}, sc}
+		}
+		return toggled{s, h, next}
+	}
+}
+
+// toggled is a handler that can be skipped.
+type toggled struct {
+	s    *Switch
+	h    middleware.Handler
+	next middleware.Handler
+}
+
+func (t toggled) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if t.s.On() {
+		return t.h.ServeHTTP(w, r)
+	}
+	return t.next.ServeHTTP(w, r)
+}
+
+// scopedToggled is a toggled handler that only acts on some
+// paths, so the server's fast path for others still applies.
+type scopedToggled struct {
+	toggled
+	sc middleware.Scoped
+}
+
+func (t scopedToggled) Scopes() []string {
+	return t.sc.Scopes()
+}
+
+// The switches of each site, by name.
+var (
+	sites   = make(map[string]map[string]*Switch)
+	sitesMu sync.Mutex
+)
+
+// Register records s as the switch called name of the site
+// site, replacing any that was registered with that name.
+func Register(site, name string, s *Switch) {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	if sites[site] == nil {
+		sites[site] = make(map[string]*Switch)
+	}
+	sites[site][name] = s
+}
+
+// Reset forgets the switches of site, which is done before
+// its configuration is loaded again.
+func Reset(site string) {
+	sitesMu.Lock()
+	delete(sites, site)
+	sitesMu.Unlock()
+}
+
+// Lookup returns the switch called name of site, if any.
+func Lookup(site, name string) (*Switch, bool) {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	s, ok := sites[site][name]
+	return s, ok
+}
+
+// Status describes a switch in the admin API.
+type Status struct {
+	Site string `json:"site"`
+	Name string `json:"name"`
+	On   bool   `json:"on"`
+}
+
+// statuses returns the status of every registered switch,
+// or only of those of site if site isn't empty.
+func statuses(site string) []Status {
+	sitesMu.Lock()
+	defer sitesMu.Unlock()
+	list := []Status{}
+	for s, switches := range sites {
+		if site != "" && s != site {
+			continue
+		}
+		for name, sw := range switches {
+			list = append(list, Status{Site: s, Name: name, On: sw.On()})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Site != list[j].Site {
+			return list[i].Site < list[j].Site
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func init() {
+	admin.HandleFunc("/middleware", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			admin.Error(w, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, statuses(r.URL.Query().Get("site")))
+	})
+
+	// POST /middleware/disable?site=example.com:443&name=gzip turns
+	// the site's gzip off; POST /middleware/enable turns it back on.
+	set := func(on bool) func(http.ResponseWriter, *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" {
+				admin.Error(w, http.StatusMethodNotAllowed, "use POST")
+				return
+			}
+			site, name := r.URL.Query().Get("site"), r.URL.Query().Get("name")
+			if site == "" || name == "" {
+				admin.Error(w, http.StatusBadRequest, "missing site or name")
+				return
+			}
+			s, ok := Lookup(site, name)
+			if !ok {
+				admin.Error(w, http.StatusNotFound, "no switch "+name+" for site "+site)
+				return
+			}
+			s.Set(on)
+			admin.WriteJSON(w, http.StatusOK, Status{Site: site, Name: name, On: on})
+		}
+	}
+	admin.HandleFunc("/middleware/enable", set(true))
+	admin.HandleFunc("/middleware/disable", set(false))
+}
@@ -0,0 +1,76 @@
+package toggle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/admin"
+	"github.com/mholt/caddy/middleware"
+	mwtest "github.com/mholt/caddy/middleware/testing"
+)
+
+type scopedHandler struct{ middleware.Handler }
+
+func (scopedHandler) Scopes() []string { return []string{"/api"} }
+
+func TestLayer(t *testing.T) {
+	s := NewSwitch(true)
+	header := func(next middleware.Handler) middleware.Handler {
+		return middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Header().Set("X-Layer", "on")
+			return next.ServeHTTP(w, r)
+		})
+	}
+	h := Layer(s, header)(&mwtest.Handler{})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	mwtest.Serve(h, r).AssertHeader(t, "X-Layer", "on")
+	s.Set(false)
+	mwtest.Serve(h, r).AssertHeader(t, "X-Layer", "")
+	s.Set(true)
+	mwtest.Serve(h, r).AssertHeader(t, "X-Layer", "on")
+
+	scoped := Layer(s, func(next middleware.Handler) middleware.Handler {
+		return scopedHandler{next}
+	})(&mwtest.Handler{})
+	if sc, ok := scoped.(middleware.Scoped); !ok || sc.Scopes()[0] != "/api" {
+		t.Errorf("Expected the scopes of the layer to be kept, got %T", scoped)
+	}
+	if _, ok := h.(middleware.Scoped); ok {
+		t.Error("Expected a layer that isn't scoped not to become scoped")
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	Reset("toggle_test:80")
+	s := NewSwitch(true)
+	Register("toggle_test:80", "gzip", s)
+
+	for i, test := range []struct {
+		method, path   string
+		expectedStatus int
+		expectedBody   string
+		expectedOn     bool
+	}{
+		{"GET", "/middleware?site=toggle_test:80", http.StatusOK, `"name":"gzip","on":true`, true},
+		{"POST", "/middleware/disable?site=toggle_test:80&name=gzip", http.StatusOK, `"on":false`, false},
+		{"GET", "/middleware/disable?site=toggle_test:80&name=gzip", http.StatusMethodNotAllowed, "use POST", false},
+		{"POST", "/middleware/enable?site=toggle_test:80&name=gzip", http.StatusOK, `"on":true`, true},
+		{"POST", "/middleware/enable?site=toggle_test:80&name=proxy", http.StatusNotFound, "no switch", true},
+		{"POST", "/middleware/enable?site=toggle_test:80", http.StatusBadRequest, "missing", true},
+	} {
+		rec := httptest.NewRecorder()
+		admin.Handler().ServeHTTP(rec, httptest.NewRequest(test.method, test.path, nil))
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectedBody) {
+			t.Errorf("Test %d: Expected body to contain %s, got %s", i, test.expectedBody, rec.Body.String())
+		}
+		if s.On() != test.expectedOn {
+			t.Errorf("Test %d: Expected switch on to be %v", i, test.expectedOn)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Trace records where the time handling a request went: how long
+// each layer of middleware took, and notes that handlers add, like
+// the upstream a request was proxied to. A request only carries a
+// trace if something wants it, such as the slowlog middleware.
+// All methods may be called on a nil *Trace, which does nothing.
+type Trace struct {
+	mu    sync.Mutex
+	spans []span
+	depth int
+	notes []string
+}
+
+// span is the time spent in one layer, including the
+// layers it called; depth is how deep it was nested.
+type span struct {
+	name     string
+	depth    int
+	start    time.Time
+	duration time.Duration
+}
+
+type traceKey struct{}
+
+// WithTrace returns a copy of r that carries a new trace, and the trace.
+func WithTrace(r *http.Request) (*http.Request, *Trace) {
+	t := new(Trace)
+	return r.WithContext(context.WithValue(r.Context(), traceKey{}, t)), t
+}
+
+// TraceFrom returns the trace carried by r, or nil if there is none.
+func TraceFrom(r *http.Request) *Trace {
+	t, _ := r.Context().Value(traceKey{}).(*Trace)
+	return t
+}
+
+// Note adds a note about the request, like "upstream=http://10.0.0.1".
+func (t *Trace) Note(format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.notes = append(t.notes, fmt.Sprintf(format, args...))
+	t.mu.Unlock()
+}
+
+func (t *Trace) begin(name string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = append(t.spans, span{name: name, depth: t.depth, start: time.Now()})
+	t.depth++
+	return len(t.spans) - 1
+}
+
+func (t *Trace) end(i int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans[i].duration = time.Since(t.spans[i].start)
+	t.depth--
+}
+
+// String describes the trace on one line: the time spent in each
+// layer itself, not counting the layers it called, then the notes.
+func (t *Trace) String() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var parts []string
+	for i, s := range t.spans {
+		self := s.duration
+		for _, inner := range t.spans[i+1:] {
+			if inner.depth <= s.depth {
+				break
+			}
+			if inner.depth == s.depth+1 {
+				self -= inner.duration
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%s=%v", s.name, self))
+	}
+	parts = append(parts, t.notes...)
+	return strings.Join(parts, " ")
+}
+
+// TraceHandler wraps h so that the time spent in it is recorded in
+// the trace of each request that has one. The handler is named by its
+// type, like proxy.Proxy.
+func TraceHandler(h Handler) Handler {
+	return tracedHandler{h: h, name: strings.TrimPrefix(fmt.Sprintf("%T", h), "*")}
+}
+
+type tracedHandler struct {
+	h    Handler
+	name string
+}
+
+func (h tracedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	t := TraceFrom(r)
+	if t == nil {
+		return h.h.ServeHTTP(w, r)
+	}
+	i := t.begin(h.name)
+	defer t.end(i)
+	return h.h.ServeHTTP(w, r)
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sleepHandler struct {
+	Next  Handler
+	Sleep time.Duration
+}
+
+func (h sleepHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	time.Sleep(h.Sleep)
+	if h.Next == nil {
+		TraceFrom(r).Note("upstream=%s", "backend")
+		return http.StatusOK, nil
+	}
+	return h.Next.ServeHTTP(w, r)
+}
+
+func TestTrace(t *testing.T) {
+	inner := TraceHandler(sleepHandler{Sleep: 50 * time.Millisecond})
+	outer := TraceHandler(sleepHandler{Next: inner, Sleep: 10 * time.Millisecond})
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r, trace := WithTrace(r)
+	if TraceFrom(r) != trace {
+		t.Fatal("Expected the request to carry the trace")
+	}
+	outer.ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(trace.spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(trace.spans))
+	}
+	if trace.spans[0].name != "middleware.sleepHandler" || trace.spans[0].depth != 0 || trace.spans[1].depth != 1 {
+		t.Errorf("Expected nested spans named by type, got %+v", trace.spans)
+	}
+	if trace.spans[0].duration < trace.spans[1].duration+10*time.Millisecond {
+		t.Errorf("Expected outer span to include the inner one, got %v and %v",
+			trace.spans[0].duration, trace.spans[1].duration)
+	}
+
+	fields := strings.Fields(trace.String())
+	if len(fields) != 3 || fields[2] != "upstream=backend" {
+		t.Fatalf("Expected two timings and a note, got %q", trace.String())
+	}
+	self, err := time.ParseDuration(strings.TrimPrefix(fields[0], "middleware.sleepHandler="))
+	if err != nil {
+		t.Fatalf("Expected a duration, got %q: %v", fields[0], err)
+	}
+	if self < 10*time.Millisecond || self >= 50*time.Millisecond {
+		t.Errorf("Expected outer layer's own time not to count the inner layer, got %v", self)
+	}
+}
+
+func TestTraceNil(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	trace := TraceFrom(r)
+	if trace != nil {
+		t.Fatalf("Expected no trace, got %v", trace)
+	}
+	trace.Note("upstream=%s", "backend") // must not panic
+	if trace.String() != "" {
+		t.Errorf("Expected empty string for nil trace, got %q", trace.String())
+	}
+
+	status, _ := TraceHandler(sleepHandler{}).ServeHTTP(httptest.NewRecorder(), r)
+	if status != http.StatusOK {
+		t.Errorf("Expected status 200 without a trace, got %d", status)
+	}
+}
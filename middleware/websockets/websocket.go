@@ -1,14 +1,22 @@
 package websockets
 
 import (
+	"io"
+	"log"
 	"net"
 	"net/http"
 	"os/exec"
 	"strings"
+	"time"
 
 	"golang.org/x/net/websocket"
 )
 
+// KillTimeout is how long a command may keep running after its
+// client has gone away and its standard input was closed, before
+// it is killed.
+var KillTimeout = 5 * time.Second
+
 // WebSocket represents a web socket server instance. A WebSocket
 // is instantiated for each new websocket request/connection.
 type WebSocket struct {
@@ -18,24 +26,44 @@ type WebSocket struct {
 
 // Handle handles a WebSocket connection. It launches the
 // specified command and streams input and output through
-// the command's stdin and stdout.
+// the command's stdin and stdout. What the command writes
+// to stderr goes to the log. The connection is closed when
+// the command exits, and the command is stopped when the
+// connection is closed.
 func (ws WebSocket) Handle(conn *websocket.Conn) {
-	cmd := exec.Command(ws.Command, ws.Arguments...)
+	defer conn.Close()
 
-	cmd.Stdin = conn
+	cmd := exec.Command(ws.Command, ws.Arguments...)
 	cmd.Stdout = conn
-	cmd.Stderr = conn // TODO: Make this configurable from the Caddyfile
+	cmd.Stderr = log.Writer()
+	cmd.Env = ws.buildEnv(cmd.Path)
 
-	metavars, err := ws.buildEnv(cmd.Path)
+	stdin, err := cmd.StdinPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
 	if err != nil {
-		panic(err) // TODO
+		log.Printf("[ERROR] websocket %s: %v", ws.Command, err)
+		return
 	}
 
-	cmd.Env = metavars
+	exited := make(chan struct{})
+	go func() {
+		io.Copy(stdin, conn)
+		// the client went away, so the command's input ends;
+		// it is killed if it doesn't exit of its own accord
+		stdin.Close()
+		select {
+		case <-exited:
+		case <-time.After(KillTimeout):
+			cmd.Process.Kill()
+		}
+	}()
 
-	err = cmd.Run()
+	err = cmd.Wait()
+	close(exited)
 	if err != nil {
-		panic(err)
+		log.Printf("[ERROR] websocket %s: %v", ws.Command, err)
 	}
 }
 
@@ -43,24 +71,31 @@ func (ws WebSocket) Handle(conn *websocket.Conn) {
 // to the CGI 1.1 specification: http://tools.ietf.org/html/rfc3875#section-4.1
 // cmdPath should be the path of the command being run.
 // The returned string slice can be set to the command's Env property.
-func (ws WebSocket) buildEnv(cmdPath string) (metavars []string, err error) {
+func (ws WebSocket) buildEnv(cmdPath string) []string {
 	remoteHost, remotePort, err := net.SplitHostPort(ws.RemoteAddr)
 	if err != nil {
-		return
+		remoteHost = ws.RemoteAddr
 	}
 
 	serverHost, serverPort, err := net.SplitHostPort(ws.Host)
 	if err != nil {
-		return
+		// the port is implied by the scheme
+		serverHost, serverPort = ws.Host, "80"
+		if ws.TLS != nil {
+			serverPort = "443"
+		}
 	}
 
-	metavars = []string{
+	// The command is run for the endpoint's path; the
+	// rest of the requested path is for it to interpret
+	pathInfo := strings.TrimPrefix(ws.URL.Path, strings.TrimSuffix(ws.Path, "/"))
+
+	metavars := []string{
 		`AUTH_TYPE=`,      // Not used
 		`CONTENT_LENGTH=`, // Not used
 		`CONTENT_TYPE=`,   // Not used
 		`GATEWAY_INTERFACE=` + GatewayInterface,
-		`PATH_INFO=`,       // TODO
-		`PATH_TRANSLATED=`, // TODO
+		`PATH_INFO=` + pathInfo,
 		`QUERY_STRING=` + ws.URL.RawQuery,
 		`REMOTE_ADDR=` + remoteHost,
 		`REMOTE_HOST=` + remoteHost, // Host lookups are slow - don't do them
@@ -68,7 +103,7 @@ func (ws WebSocket) buildEnv(cmdPath string) (metavars []string, err error) {
 		`REMOTE_PORT=` + remotePort,
 		`REMOTE_USER=`, // Not used,
 		`REQUEST_METHOD=` + ws.Method,
-		`REQUEST_URI=` + ws.RequestURI,
+		`REQUEST_URI=` + ws.URL.RequestURI(),
 		`SCRIPT_NAME=` + cmdPath, // path of the program being executed
 		`SERVER_NAME=` + serverHost,
 		`SERVER_PORT=` + serverPort,
@@ -85,5 +120,5 @@ func (ws WebSocket) buildEnv(cmdPath string) (metavars []string, err error) {
 		metavars = append(metavars, "HTTP_"+header+"="+value)
 	}
 
-	return
+	return metavars
 }
@@ -5,6 +5,7 @@ package websockets
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/mholt/caddy/middleware"
 	"golang.org/x/net/websocket"
@@ -33,7 +34,13 @@ type (
 )
 
 // ServeHTTP converts the HTTP request to a WebSocket connection and serves it up.
+// Requests that don't ask to be upgraded to WebSocket are passed on, so the
+// page using an endpoint can be served from the same path.
 func (ws WebSockets) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !isUpgrade(r) {
+		return ws.Next.ServeHTTP(w, r)
+	}
+
 	for _, sockconfig := range ws.Sockets {
 		if middleware.Path(r.URL.Path).Matches(sockconfig.Path) {
 			socket := WebSocket{
@@ -49,6 +56,19 @@ func (ws WebSockets) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, err
 	return ws.Next.ServeHTTP(w, r)
 }
 
+// isUpgrade returns true if r asks to be upgraded to WebSocket.
+func isUpgrade(r *http.Request) bool {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, token := range strings.Split(r.Header.Get("Connection"), ",") {
+		if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+			return true
+		}
+	}
+	return false
+}
+
 var (
 	// GatewayInterface is the dialect of CGI being used by the server
 	// to communicate with the script.  See CGI spec, 4.1.4
@@ -58,3 +78,12 @@ var (
 	// software making the CGI request.  See CGI spec, 4.1.17
 	ServerSoftware string
 )
+
+// Scopes implements the middleware.Scoped interface.
+func (ws WebSockets) Scopes() []string {
+	scopes := make([]string, len(ws.Sockets))
+	for i, sockconfig := range ws.Sockets {
+		scopes[i] = sockconfig.Path
+	}
+	return scopes
+}
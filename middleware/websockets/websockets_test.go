@@ -0,0 +1,92 @@
+package websockets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+	"golang.org/x/net/websocket"
+)
+
+func TestWebSockets(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("cat is needed to echo messages")
+	}
+
+	ws := WebSockets{
+		Next: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			w.Write([]byte("page"))
+			return http.StatusOK, nil
+		}),
+		Sockets: []Config{{Path: "/echo", Command: "cat"}},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	// plain requests for the endpoint are passed on
+	resp, err := http.Get(srv.URL + "/echo")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the page to be served, got status %d", resp.StatusCode)
+	}
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/echo", "", srv.URL)
+	if err != nil {
+		t.Fatalf("Expected to connect, got: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("Expected to send, got: %v", err)
+	}
+	var msg string
+	if err := websocket.Message.Receive(conn, &msg); err != nil {
+		t.Fatalf("Expected to receive, got: %v", err)
+	}
+	if msg != "hello\n" {
+		t.Errorf("Expected the command to echo 'hello', got %q", msg)
+	}
+}
+
+func TestBuildEnv(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://example.com/ws/chat/room?nick=bob", nil)
+	r.RemoteAddr = "10.0.0.1:4000"
+	r.Header.Set("Origin", "http://example.com")
+	ServerSoftware = "Caddy/test"
+
+	env := WebSocket{Config: Config{Path: "/ws", Command: "chat"}, Request: r}.buildEnv("/usr/bin/chat")
+
+	for _, expected := range []string{
+		"PATH_INFO=/chat/room",
+		"QUERY_STRING=nick=bob",
+		"REMOTE_ADDR=10.0.0.1",
+		"REMOTE_PORT=4000",
+		"REQUEST_URI=/ws/chat/room?nick=bob",
+		"SCRIPT_NAME=/usr/bin/chat",
+		"SERVER_NAME=example.com",
+		"SERVER_PORT=80",
+		"SERVER_SOFTWARE=Caddy/test",
+		"HTTP_ORIGIN=http://example.com",
+	} {
+		found := false
+		for _, v := range env {
+			if v == expected {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Expected %s in the environment %v", expected, env)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+// reloadOnSignal does nothing: there is no SIGUSR1 here.
+func reloadOnSignal() {}
+
+// reopenLogsOnSignal does nothing: there is no SIGHUP here;
+// the admin API's /logs/reopen can be used instead.
+func reopenLogsOnSignal() {}
@@ -0,0 +1,42 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	caddylog "github.com/mholt/caddy/middleware/log"
+)
+
+// reloadOnSignal reloads all sites whenever the process gets
+// SIGUSR1. Requests in progress finish on the old sites.
+func reloadOnSignal() {
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	go func() {
+		for range usr1 {
+			log.Println("Got SIGUSR1; reloading the configuration")
+			reloadAll()
+		}
+	}()
+}
+
+// reopenLogsOnSignal reopens the log files whenever the process
+// gets SIGHUP, so that log rotation can move them away (or copy
+// and truncate them) and have them written to afresh.
+func reopenLogsOnSignal() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Println("Got SIGHUP; reopening the log files")
+			if err := caddylog.Reopen(); err != nil {
+				log.Printf("[ERROR] Reopening the log files: %v", err)
+			}
+		}
+	}()
+}
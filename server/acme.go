@@ -0,0 +1,68 @@
+package server
+
+import (
+	"crypto/tls"
+	"sync"
+
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/server/acme"
+)
+
+// The ACME managers of all servers, one for each configuration,
+// so that sites with the same CA and account share them.
+var (
+	acmeManagers   = make(map[acmeManagerKey]*acme.Manager)
+	acmeManagersMu sync.Mutex
+)
+
+type acmeManagerKey struct {
+	ACMEConfig
+	perms middleware.FilePerms
+}
+
+// acmeManager returns the ACME manager for c, which
+// writes its files with perms.
+func acmeManager(c ACMEConfig, perms middleware.FilePerms) *acme.Manager {
+	acmeManagersMu.Lock()
+	defer acmeManagersMu.Unlock()
+	key := acmeManagerKey{c, perms}
+	m, ok := acmeManagers[key]
+	if !ok {
+		m = &acme.Manager{DirectoryURL: c.CA, Email: c.Email, Storage: acme.Storage(c.Storage), Perms: &perms}
+		acmeManagers[key] = m
+	}
+	return m
+}
+
+// manageCertificates makes the ACME managers of the managed sites
+// among vhosts manage their certificates, and returns a function
+// for tls.Config.GetCertificate that serves them.
+func manageCertificates(vhosts map[string]virtualHost) (func(*tls.ClientHelloInfo) (*tls.Certificate, error), error) {
+	var managers []*acme.Manager
+	seen := make(map[*acme.Manager]bool)
+	for _, vh := range vhosts {
+		if !vh.config.TLS.Managed() {
+			continue
+		}
+		m := acmeManager(vh.config.TLS.ACME, vh.config.FilePerms)
+		if err := m.Manage(vh.config.Host); err != nil {
+			return nil, err
+		}
+		if !seen[m] {
+			seen[m] = true
+			managers = append(managers, m)
+		}
+	}
+	if len(managers) == 0 {
+		return nil, nil
+	}
+
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		for _, m := range managers {
+			if cert, err := m.GetCertificate(hello); cert != nil || err != nil {
+				return cert, err
+			}
+		}
+		return nil, nil // try the certificates from files
+	}, nil
+}
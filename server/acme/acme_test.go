@@ -0,0 +1,422 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// fakeCA is an ACME server that validates the http-01 challenges
+// of its clients with their Challenges, and checks their requests'
+// signatures.
+type fakeCA struct {
+	t          *testing.T
+	server     *httptest.Server
+	key        *ecdsa.PrivateKey
+	cert       *x509.Certificate
+	challenges *Challenges
+	validFor   time.Duration
+
+	mu        sync.Mutex
+	accounts  map[string]*ecdsa.PublicKey
+	nonce     int
+	badNonces int  // how many requests to reject with badNonce
+	down      bool // whether to fail every request, like an outage
+	orders    int
+	answer    string // the last challenge answer
+	order     order
+	authz     authorization
+	chain     []byte
+}
+
+func newFakeCA(t *testing.T, challenges *Challenges) *fakeCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	ca := &fakeCA{t: t, key: key, cert: cert, challenges: challenges, validFor: 90 * 24 * time.Hour,
+		accounts: make(map[string]*ecdsa.PublicKey)}
+	ca.server = httptest.NewServer(http.HandlerFunc(ca.serveHTTP))
+	return ca
+}
+
+func (ca *fakeCA) url(path string) string { return ca.server.URL + path }
+
+func (ca *fakeCA) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if ca.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	ca.nonce++
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", ca.nonce))
+
+	if r.URL.Path == "/dir" {
+		json.NewEncoder(w).Encode(directory{NewNonce: ca.url("/nonce"), NewAccount: ca.url("/account"), NewOrder: ca.url("/order")})
+		return
+	}
+	if r.URL.Path == "/nonce" {
+		return
+	}
+
+	payload, ok := ca.verify(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Problem{Type: "urn:ietf:params:acme:error:malformed", Detail: "bad signature"})
+		return
+	}
+	if ca.badNonces > 0 {
+		ca.badNonces--
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Problem{Type: "urn:ietf:params:acme:error:badNonce", Detail: "try again"})
+		return
+	}
+
+	switch r.URL.Path {
+	case "/account":
+		w.Header().Set("Location", ca.url("/acct/1"))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{}"))
+	case "/order":
+		ca.orders++
+		var req struct{ Identifiers []identifier }
+		json.Unmarshal(payload, &req)
+		ca.authz = authorization{Status: "pending", Identifier: req.Identifiers[0], Challenges: []challenge{
+			{Type: "dns-01", URL: ca.url("/chal/dns"), Token: "dnstoken"},
+			{Type: "http-01", URL: ca.url("/chal/http"), Token: "httptoken"},
+		}}
+		ca.order = order{Status: "pending", Authorizations: []string{ca.url("/authz/1")}, Finalize: ca.url("/finalize/1")}
+		w.Header().Set("Location", ca.url("/order/1"))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(ca.order)
+	case "/authz/1":
+		json.NewEncoder(w).Encode(ca.authz)
+	case "/chal/http":
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://"+ca.authz.Identifier.Value+ChallengePath+"httptoken", nil)
+		if ca.challenges.ServeHTTP(rec, req) {
+			ca.answer = rec.Body.String()
+			ca.authz.Status = "valid"
+		} else {
+			ca.authz.Status = "invalid"
+			ca.authz.Challenges[1].Error = &Problem{Type: "urn:ietf:params:acme:error:unauthorized", Detail: "no answer"}
+		}
+		w.Write([]byte("{}"))
+	case "/finalize/1":
+		var req struct{ CSR string }
+		json.Unmarshal(payload, &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil || ca.authz.Status != "valid" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(Problem{Type: "urn:ietf:params:acme:error:unauthorized", Detail: "not authorized"})
+			return
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(ca.orders + 1)),
+			Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(ca.validFor),
+		}
+		leaf, _ := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, csr.PublicKey, ca.key)
+		ca.chain = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})...)
+		ca.order.Status, ca.order.Certificate = "valid", ca.url("/cert/1")
+		json.NewEncoder(w).Encode(ca.order)
+	case "/order/1":
+		json.NewEncoder(w).Encode(ca.order)
+	case "/cert/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(ca.chain)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// verify checks the signature of the JWS in the body of r and
+// returns its payload.
+func (ca *fakeCA) verify(r *http.Request) ([]byte, bool) {
+	var jws struct{ Protected, Payload, Signature string }
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		return nil, false
+	}
+	header, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	var protected struct {
+		Alg, Nonce, URL, Kid string
+		JWK                  struct{ Crv, Kty, X, Y string }
+	}
+	if err := json.Unmarshal(header, &protected); err != nil || protected.Alg != "ES256" || protected.URL != ca.url(r.URL.Path) {
+		return nil, false
+	}
+
+	var pub *ecdsa.PublicKey
+	if protected.Kid != "" {
+		pub = ca.accounts[protected.Kid]
+	} else if r.URL.Path == "/account" {
+		x, _ := base64.RawURLEncoding.DecodeString(protected.JWK.X)
+		y, _ := base64.RawURLEncoding.DecodeString(protected.JWK.Y)
+		pub = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		ca.accounts[ca.url("/acct/1")] = pub
+	}
+	if pub == nil {
+		return nil, false
+	}
+
+	sig, _ := base64.RawURLEncoding.DecodeString(jws.Signature)
+	if len(sig) != 64 {
+		return nil, false
+	}
+	hash := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	if !ecdsa.Verify(pub, hash[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return nil, false
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return payload, true
+}
+
+func TestClientObtain(t *testing.T) {
+	challenges := new(Challenges)
+	ca := newFakeCA(t, challenges)
+	defer ca.server.Close()
+	ca.badNonces = 1
+
+	key, _ := newKey()
+	certKey, _ := newKey()
+	c := &Client{DirectoryURL: ca.url("/dir"), Key: key, PollInterval: 10 * time.Millisecond}
+
+	chain, err := c.Obtain([]string{"example.com"}, certKey, challenges)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if expected := "httptoken." + thumbprint(key); ca.answer != expected {
+		t.Errorf("Expected the challenge answer %q, got %q", expected, ca.answer)
+	}
+	if challenges.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", ChallengePath+"httptoken", nil)) {
+		t.Error("Expected the challenge to be removed once done")
+	}
+
+	keyPEM, _ := encodeKey(certKey)
+	cert, err := tls.X509KeyPair(chain, keyPEM)
+	if err != nil {
+		t.Fatalf("Expected the chain to go with the key, got: %v", err)
+	}
+	if len(cert.Certificate) != 2 {
+		t.Errorf("Expected a chain of 2 certificates, got %d", len(cert.Certificate))
+	}
+
+	// without the answer, the authorization fails
+	c = &Client{DirectoryURL: ca.url("/dir"), Key: key, PollInterval: 10 * time.Millisecond}
+	ca.challenges = new(Challenges)
+	if _, err := c.Obtain([]string{"example.com"}, certKey, challenges); err == nil || !strings.Contains(err.Error(), "no answer") {
+		t.Errorf("Expected the failed challenge to be reported, got: %v", err)
+	}
+}
+
+func TestManager(t *testing.T) {
+	storage, err := ioutil.TempDir("", "caddy_acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(storage)
+
+	challenges := new(Challenges)
+	ca := newFakeCA(t, challenges)
+	defer ca.server.Close()
+
+	m := &Manager{DirectoryURL: ca.url("/dir"), Storage: Storage(storage), Challenges: challenges}
+	hello := &tls.ClientHelloInfo{ServerName: "Example.com"}
+
+	if cert, err := m.GetCertificate(hello); cert != nil || err != nil {
+		t.Errorf("Expected nothing for a domain that isn't managed, got %v, %v", cert, err)
+	}
+	for _, domain := range []string{"", "*.example.com", "../etc", "a/b"} {
+		if err := m.Manage(domain); err == nil {
+			t.Errorf("Expected an error managing '%s'", domain)
+		}
+	}
+
+	if err := m.Manage("example.com"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var cert *tls.Certificate
+	for deadline := time.Now().Add(5 * time.Second); cert == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		cert, _ = m.GetCertificate(hello)
+	}
+	if cert == nil {
+		t.Fatal("Expected a certificate to be obtained")
+	}
+	if cert.Leaf.Subject.CommonName != "example.com" {
+		t.Errorf("Expected a certificate for example.com, got one for %s", cert.Leaf.Subject.CommonName)
+	}
+	if m.due("example.com") {
+		t.Error("Expected a new certificate not to be due for renewal")
+	}
+
+	host := strings.TrimPrefix(ca.server.URL, "http://")
+	host = strings.Replace(host, ":", "_", 1)
+	for _, file := range []string{"accounts/default.key", "sites/example.com.crt", "sites/example.com.key"} {
+		if _, err := os.Stat(filepath.Join(storage, host, file)); err != nil {
+			t.Errorf("Expected %s to be stored, got: %v", file, err)
+		}
+	}
+
+	// another manager loads it from storage
+	m2 := &Manager{DirectoryURL: ca.url("/dir"), Storage: Storage(storage), Challenges: challenges}
+	m2.Manage("example.com")
+	if cert, _ := m2.GetCertificate(hello); cert == nil {
+		t.Error("Expected the certificate to be loaded from storage")
+	}
+	if ca.orders != 1 {
+		t.Errorf("Expected 1 order, got %d", ca.orders)
+	}
+
+	// and certificates that expire soon are renewed
+	m2.RenewBefore = 100 * 24 * time.Hour
+	if !m2.due("example.com") {
+		t.Error("Expected the certificate to be due for renewal")
+	}
+}
+
+func TestManagerRetry(t *testing.T) {
+	storage, err := ioutil.TempDir("", "caddy_acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(storage)
+
+	challenges := new(Challenges)
+	ca := newFakeCA(t, challenges)
+	defer ca.server.Close()
+	ca.mu.Lock()
+	ca.down = true
+	ca.mu.Unlock()
+
+	// failures are retried with backoff, and recorded
+	m := &Manager{DirectoryURL: ca.url("/dir"), Storage: Storage(storage), Challenges: challenges,
+		RetryMin: 20 * time.Millisecond, RetryMax: 40 * time.Millisecond}
+	if err := m.Manage("example.com"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var state RetryState
+	for deadline := time.Now().Add(5 * time.Second); state.Failures < 3 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		state, _ = Storage(storage).Retry(ca.url("/dir"), "example.com")
+	}
+	if state.Failures < 3 {
+		t.Fatalf("Expected at least 3 failures to be recorded, got %d", state.Failures)
+	}
+	if !strings.Contains(state.LastError, "503") {
+		t.Errorf("Expected the last error to be recorded, got %q", state.LastError)
+	}
+
+	// once the CA is back, the certificate is obtained
+	// and the record of failures is removed
+	ca.mu.Lock()
+	ca.down = false
+	ca.mu.Unlock()
+	for deadline := time.Now().Add(5 * time.Second); state.Failures > 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		state, _ = Storage(storage).Retry(ca.url("/dir"), "example.com")
+	}
+	if state.Failures > 0 {
+		t.Errorf("Expected the failures to be forgotten after success, got %+v", state)
+	}
+	if cert, _ := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"}); cert == nil {
+		t.Error("Expected a certificate once the CA was back")
+	}
+
+	// after a restart, a domain that failed waits out its backoff
+	err = Storage(storage).SaveRetry(ca.url("/dir"), "example.org", RetryState{Failures: 4, Next: time.Now().Add(time.Hour)}, middleware.FilePerms{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.mu.Lock()
+	orders := ca.orders
+	ca.mu.Unlock()
+	m2 := &Manager{DirectoryURL: ca.url("/dir"), Storage: Storage(storage), Challenges: challenges}
+	m2.Manage("example.org")
+	time.Sleep(50 * time.Millisecond)
+	ca.mu.Lock()
+	if ca.orders != orders {
+		t.Errorf("Expected no order before the backoff is over, got %d more", ca.orders-orders)
+	}
+	ca.mu.Unlock()
+	if !m2.retrying("example.org") {
+		t.Error("Expected a retry of example.org to be scheduled")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	m := &Manager{RetryMin: time.Minute, RetryMax: time.Hour}
+	for i, test := range []struct {
+		failures int
+		max      time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{7, time.Hour},
+		{100, time.Hour},
+	} {
+		for n := 0; n < 10; n++ {
+			if d := m.backoff(test.failures); d > test.max || d < test.max/2 {
+				t.Errorf("Test %d: Expected a backoff between %v and %v, got %v", i, test.max/2, test.max, d)
+			}
+		}
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	c := new(Client)
+	for i, test := range []struct {
+		date     string
+		expected time.Duration
+	}{
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), time.Hour},
+		{time.Now().Add(-10 * time.Minute).UTC().Format(http.TimeFormat), -10 * time.Minute},
+		{"not a date", -10 * time.Minute}, // unchanged
+	} {
+		c.observeClock(&http.Response{Header: http.Header{"Date": {test.date}}})
+		if skew := c.ClockSkew(); skew < test.expected-2*time.Second || skew > test.expected+2*time.Second {
+			t.Errorf("Test %d: Expected a skew of about %v, got %v", i, test.expected, skew)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package acme
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ChallengePath is the path under which http-01 challenges are
+// fetched by the certificate authority.
+const ChallengePath = "/.well-known/acme-challenge/"
+
+// Challenges holds the answers (key authorizations) to the
+// http-01 challenges in progress, by token.
+type Challenges struct {
+	mu      sync.RWMutex
+	answers map[string]string
+}
+
+func (c *Challenges) put(token, answer string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.answers == nil {
+		c.answers = make(map[string]string)
+	}
+	c.answers[token] = answer
+}
+
+func (c *Challenges) remove(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.answers, token)
+}
+
+// ServeHTTP answers r if it fetches a challenge in progress, and
+// returns true if it did. Requests for other paths are left alone.
+func (c *Challenges) ServeHTTP(w http.ResponseWriter, r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, ChallengePath) {
+		return false
+	}
+	c.mu.RLock()
+	answer, ok := c.answers[r.URL.Path[len(ChallengePath):]]
+	c.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, answer)
+	return true
+}
+
+// DefaultChallenges holds the challenges of all the Managers
+// that don't have their own, so that any HTTP server of the
+// process can answer them.
+var DefaultChallenges = new(Challenges)
@@ -0,0 +1,383 @@
+// Package acme obtains and renews TLS certificates automatically
+// from a certificate authority that speaks ACME (RFC 8555), like
+// Let's Encrypt, proving control of each domain with the http-01
+// challenge.
+package acme
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LetsEncrypt is the directory URL of Let's Encrypt's production CA.
+const LetsEncrypt = "https://acme-v02.api.letsencrypt.org/directory"
+
+// Client talks to the ACME server at a directory URL on behalf
+// of one account. It gets one certificate at a time: Obtain must
+// not be called again before it returns.
+type Client struct {
+	DirectoryURL string
+	Key          *ecdsa.PrivateKey // the account key
+	Email        string            // contact for the account, if any
+	HTTPClient   *http.Client      // http.DefaultClient if nil
+
+	// How often to check on authorizations and orders that
+	// are being processed, and for how long at most
+	PollInterval time.Duration
+	PollTimeout  time.Duration
+
+	mu     sync.Mutex
+	dir    *directory
+	kid    string        // the account URL, once registered
+	nonces []string      // unused nonces from earlier responses
+	skew   time.Duration // how far the CA's clock is ahead of ours
+}
+
+type directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type order struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+	Error          *Problem `json:"error"`
+}
+
+type authorization struct {
+	Status     string      `json:"status"`
+	Identifier identifier  `json:"identifier"`
+	Challenges []challenge `json:"challenges"`
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type challenge struct {
+	Type   string   `json:"type"`
+	URL    string   `json:"url"`
+	Token  string   `json:"token"`
+	Status string   `json:"status"`
+	Error  *Problem `json:"error"`
+}
+
+// Problem is an error reported by the ACME server (RFC 7807).
+type Problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("acme: %s: %s", p.Type, p.Detail)
+}
+
+// Obtain gets a certificate for domains, with the public key of
+// certKey, answering their http-01 challenges with challenges.
+// It returns the certificate chain in PEM form, leaf first.
+func (c *Client) Obtain(domains []string, certKey *ecdsa.PrivateKey, challenges *Challenges) ([]byte, error) {
+	if err := c.register(); err != nil {
+		return nil, err
+	}
+
+	var ids []identifier
+	for _, d := range domains {
+		ids = append(ids, identifier{Type: "dns", Value: d})
+	}
+	var o order
+	resp, err := c.post(c.dir.NewOrder, map[string]interface{}{"identifiers": ids}, &o)
+	if err != nil {
+		return nil, err
+	}
+	orderURL := resp.Header.Get("Location")
+
+	for _, authzURL := range o.Authorizations {
+		if err := c.authorize(authzURL, challenges); err != nil {
+			return nil, err
+		}
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, certKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.post(o.Finalize, map[string]string{"csr": b64(csr)}, &o); err != nil {
+		return nil, err
+	}
+	err = c.poll(orderURL, &o, func() (bool, error) {
+		switch o.Status {
+		case "valid":
+			return true, nil
+		case "invalid":
+			if o.Error != nil {
+				return false, o.Error
+			}
+			return false, errors.New("acme: order is invalid")
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err = c.post(o.Certificate, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	chain, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(chain); block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("acme: server sent no certificate")
+	}
+	return chain, nil
+}
+
+// authorize proves control of the identifier of the authorization
+// at authzURL, if that wasn't done already, with its http-01 challenge.
+func (c *Client) authorize(authzURL string, challenges *Challenges) error {
+	var authz authorization
+	if _, err := c.post(authzURL, nil, &authz); err != nil {
+		return err
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+
+	var chal *challenge
+	for i := range authz.Challenges {
+		if authz.Challenges[i].Type == "http-01" {
+			chal = &authz.Challenges[i]
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("acme: no http-01 challenge offered for %s", authz.Identifier.Value)
+	}
+
+	challenges.put(chal.Token, chal.Token+"."+thumbprint(c.Key))
+	defer challenges.remove(chal.Token)
+
+	resp, err := c.post(chal.URL, struct{}{}, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if _, err := c.post(authzURL, nil, &authz); err != nil {
+		return err
+	}
+	return c.poll(authzURL, &authz, func() (bool, error) {
+		switch authz.Status {
+		case "valid":
+			return true, nil
+		case "pending", "processing":
+			return false, nil
+		}
+		for _, ch := range authz.Challenges {
+			if ch.Type == "http-01" && ch.Error != nil {
+				return false, ch.Error
+			}
+		}
+		return false, fmt.Errorf("acme: authorization for %s is %s", authz.Identifier.Value, authz.Status)
+	})
+}
+
+// poll fetches url into v until done says it's done, or fails.
+func (c *Client) poll(url string, v interface{}, done func() (bool, error)) error {
+	interval, timeout := c.PollInterval, c.PollTimeout
+	if interval == 0 {
+		interval = time.Second
+	}
+	if timeout == 0 {
+		timeout = 2 * time.Minute
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := done()
+		if ok || err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("acme: timed out waiting for %s", url)
+		}
+		time.Sleep(interval)
+		if _, err := c.post(url, nil, v); err != nil {
+			return err
+		}
+	}
+}
+
+// register fetches the directory and registers the account, or
+// finds it if it exists, unless that was done already.
+func (c *Client) register() error {
+	c.mu.Lock()
+	registered := c.kid != ""
+	c.mu.Unlock()
+	if registered {
+		return nil
+	}
+
+	if c.dir == nil {
+		resp, err := c.httpClient().Get(c.DirectoryURL)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		c.observeClock(resp)
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("acme: getting directory %s: %s", c.DirectoryURL, resp.Status)
+		}
+		var dir directory
+		if err := json.NewDecoder(resp.Body).Decode(&dir); err != nil {
+			return fmt.Errorf("acme: decoding directory: %v", err)
+		}
+		c.dir = &dir
+	}
+
+	account := map[string]interface{}{"termsOfServiceAgreed": true}
+	if c.Email != "" {
+		account["contact"] = []string{"mailto:" + c.Email}
+	}
+	resp, err := c.post(c.dir.NewAccount, account, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	c.mu.Lock()
+	c.kid = resp.Header.Get("Location")
+	c.mu.Unlock()
+	if c.kid == "" {
+		return errors.New("acme: server sent no account URL")
+	}
+	return nil
+}
+
+// post sends a signed POST request with payload to url, decoding the
+// response into v if it isn't nil; it returns the response, whose body
+// must be closed if v is nil. A request with a bad nonce is retried.
+func (c *Client) post(url string, payload, v interface{}) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		nonce, err := c.nonce()
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		kid := c.kid
+		c.mu.Unlock()
+		body, err := signJWS(c.Key, kid, nonce, url, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.httpClient().Post(url, "application/jose+json", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		c.saveNonce(resp)
+		c.observeClock(resp)
+
+		if resp.StatusCode >= 400 {
+			problem := &Problem{Status: resp.StatusCode}
+			json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(problem)
+			resp.Body.Close()
+			if problem.Type == "urn:ietf:params:acme:error:badNonce" && attempt < 3 {
+				continue
+			}
+			if problem.Detail == "" {
+				problem.Detail = resp.Status
+			}
+			return nil, problem
+		}
+
+		if v != nil {
+			defer resp.Body.Close()
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				return nil, fmt.Errorf("acme: decoding response from %s: %v", url, err)
+			}
+		}
+		return resp, nil
+	}
+}
+
+// nonce returns a nonce to sign a request with.
+func (c *Client) nonce() (string, error) {
+	c.mu.Lock()
+	if n := len(c.nonces); n > 0 {
+		nonce := c.nonces[n-1]
+		c.nonces = c.nonces[:n-1]
+		c.mu.Unlock()
+		return nonce, nil
+	}
+	c.mu.Unlock()
+
+	resp, err := c.httpClient().Head(c.dir.NewNonce)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	c.observeClock(resp)
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errors.New("acme: server sent no nonce")
+	}
+	return nonce, nil
+}
+
+// saveNonce keeps the nonce of resp, if it has one, for later.
+func (c *Client) saveNonce(resp *http.Response) {
+	if nonce := resp.Header.Get("Replay-Nonce"); nonce != "" {
+		c.mu.Lock()
+		c.nonces = append(c.nonces, nonce)
+		c.mu.Unlock()
+	}
+}
+
+// observeClock notes how far the CA's clock, as given by the
+// Date header of resp, is from ours.
+func (c *Client) observeClock(resp *http.Response) {
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	c.skew = date.Sub(time.Now()).Round(time.Second)
+	c.mu.Unlock()
+}
+
+// ClockSkew returns how far the CA's clock was ahead of ours (or
+// behind, if negative) in its last response. A clock that is far
+// off makes certificates seem not yet valid or already expired.
+func (c *Client) ClockSkew() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.skew
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
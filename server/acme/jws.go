@@ -0,0 +1,85 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+)
+
+// b64 encodes b the way JWS does: URL-safe base64 without padding.
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// jwk returns the JSON Web Key of the public part of key, with its
+// members in the order RFC 7638 requires for thumbprints.
+func jwk(key *ecdsa.PrivateKey) json.RawMessage {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	return json.RawMessage(`{"crv":"` + key.Curve.Params().Name + `","kty":"EC","x":"` +
+		b64(pad(key.X, size)) + `","y":"` + b64(pad(key.Y, size)) + `"}`)
+}
+
+// thumbprint returns the RFC 7638 thumbprint of the public part of key.
+func thumbprint(key *ecdsa.PrivateKey) string {
+	sum := sha256.Sum256(jwk(key))
+	return b64(sum[:])
+}
+
+// signJWS returns the flattened JWS JSON serialization of payload,
+// signed with key (an ES256 key), for a request to url. The key is
+// named by kid if it isn't empty (an account URL), or else embedded
+// as a JWK, as for new accounts. A nil payload makes the request a
+// POST-as-GET.
+func signJWS(key *ecdsa.PrivateKey, kid, nonce, url string, payload interface{}) ([]byte, error) {
+	protected := map[string]interface{}{"alg": "ES256", "nonce": nonce, "url": url}
+	if kid != "" {
+		protected["kid"] = kid
+	} else {
+		protected["jwk"] = jwk(key)
+	}
+	header, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if payload != nil {
+		if body, err = json.Marshal(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	signed := b64(header) + "." + b64(body)
+	hash := crypto.SHA256.New()
+	hash.Write([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	sig := append(pad(r, 32), pad(s, 32)...)
+
+	return json.Marshal(map[string]string{
+		"protected": b64(header),
+		"payload":   b64(body),
+		"signature": b64(sig),
+	})
+}
+
+// pad returns the big-endian bytes of n, left-padded with zeros to size.
+func pad(n *big.Int, size int) []byte {
+	b := n.Bytes()
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
+
+// newKey generates a new P-256 key, for accounts and certificates.
+func newKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
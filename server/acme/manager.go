@@ -0,0 +1,348 @@
+package acme
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Defaults for Manager.
+const (
+	DefaultRenewBefore   = 30 * 24 * time.Hour
+	DefaultCheckInterval = time.Hour
+	DefaultRetryMin      = time.Minute
+	DefaultRetryMax      = 24 * time.Hour
+)
+
+// MaxClockSkew is how far the system clock may be from the CA's
+// before a warning is logged. A clock that is far off makes
+// certificates seem not yet valid or already expired, to us or
+// to clients, so it must be fixed.
+var MaxClockSkew = 5 * time.Minute
+
+// Manager obtains certificates for the domains it manages, keeps
+// them in Storage, and renews them before they expire. Its
+// GetCertificate method serves them in TLS handshakes.
+type Manager struct {
+	DirectoryURL string                // of the CA; LetsEncrypt if empty
+	Email        string                // for the account with the CA
+	Storage      Storage               // DefaultStorage() if empty
+	Perms        *middleware.FilePerms // for files in Storage; default if nil
+	Challenges   *Challenges           // DefaultChallenges if nil
+	HTTPClient   *http.Client
+
+	// How long before a certificate expires to renew it, and
+	// how often to check; certificates that couldn't be obtained
+	// are tried again at every check
+	RenewBefore   time.Duration
+	CheckInterval time.Duration
+
+	// How long to wait before trying again after a certificate
+	// couldn't be obtained, such as when DNS or the network is
+	// down: RetryMin after the first failure, doubling with each
+	// one after that up to RetryMax, less up to half as jitter
+	RetryMin time.Duration
+	RetryMax time.Duration
+
+	mu      sync.RWMutex
+	certs   map[string]*tls.Certificate // by domain
+	retries map[string]RetryState       // of domains that failed
+	timers  map[string]*time.Timer      // of the next retry of each
+	started bool
+
+	obtainMu sync.Mutex // one certificate is obtained at a time
+	client   *Client
+}
+
+// Manage makes m manage the certificate of domain: one is loaded
+// from storage, or else obtained in the background, and renewed
+// when it's due. Domains must be plain hostnames; wildcards can't be
+// validated with http-01.
+func (m *Manager) Manage(domain string) error {
+	domain = strings.ToLower(domain)
+	if domain == "" || strings.ContainsAny(domain, "*/\\:") || strings.Trim(domain, ".") != domain || strings.Contains(domain, "..") {
+		return fmt.Errorf("acme: can't get a certificate for '%s'", domain)
+	}
+
+	m.mu.Lock()
+	if m.certs == nil {
+		m.certs = make(map[string]*tls.Certificate)
+		m.retries = make(map[string]RetryState)
+		m.timers = make(map[string]*time.Timer)
+	}
+	if _, ok := m.certs[domain]; ok {
+		m.mu.Unlock()
+		return nil
+	}
+	m.certs[domain] = nil
+	start := !m.started
+	m.started = true
+	m.mu.Unlock()
+
+	if chain, key, err := m.storage().Site(m.directoryURL(), domain); err == nil {
+		if cert, err := tls.X509KeyPair(chain, key); err == nil {
+			m.setCert(domain, &cert)
+		}
+	}
+
+	// Failures before a restart still count, so that
+	// a restart doesn't make the CA be tried right away
+	state, err := m.storage().Retry(m.directoryURL(), domain)
+	if err != nil {
+		log.Printf("[WARNING] acme: reading the retry state of %s: %v", domain, err)
+	}
+	if state.Failures > 0 {
+		m.mu.Lock()
+		m.retries[domain] = state
+		m.mu.Unlock()
+	}
+	if m.due(domain) {
+		if wait := time.Until(state.Next); wait > 0 {
+			m.retryAfter(domain, wait)
+		} else {
+			go m.obtainLogged(domain)
+		}
+	}
+	if start {
+		go m.checkLoop()
+	}
+	return nil
+}
+
+// GetCertificate returns the certificate for the server name of
+// hello, for use in tls.Config. It returns nil and no error if the
+// name isn't managed by m, so that other certificates may be tried.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	m.mu.RLock()
+	cert, ok := m.certs[name]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+	if cert == nil {
+		return nil, fmt.Errorf("acme: no certificate for %s yet", name)
+	}
+	return cert, nil
+}
+
+// Manages returns true if m manages the certificate of domain.
+func (m *Manager) Manages(domain string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.certs[strings.ToLower(domain)]
+	return ok
+}
+
+// CertificateFile returns the file m keeps the certificate
+// chain of domain in.
+func (m *Manager) CertificateFile(domain string) string {
+	return m.storage().SiteCertificateFile(m.directoryURL(), domain)
+}
+
+// due returns true if the certificate of domain is missing or
+// should be renewed.
+func (m *Manager) due(domain string) bool {
+	m.mu.RLock()
+	cert := m.certs[domain]
+	m.mu.RUnlock()
+	if cert == nil || cert.Leaf == nil {
+		return true
+	}
+	renewBefore := m.RenewBefore
+	if renewBefore == 0 {
+		renewBefore = DefaultRenewBefore
+	}
+	return time.Until(cert.Leaf.NotAfter) < renewBefore
+}
+
+// checkLoop obtains the certificates that are due, forever.
+func (m *Manager) checkLoop() {
+	interval := m.CheckInterval
+	if interval == 0 {
+		interval = DefaultCheckInterval
+	}
+	for range time.Tick(interval) {
+		m.mu.RLock()
+		var domains []string
+		for domain := range m.certs {
+			domains = append(domains, domain)
+		}
+		m.mu.RUnlock()
+		for _, domain := range domains {
+			if m.due(domain) && !m.retrying(domain) {
+				m.obtainLogged(domain)
+			}
+		}
+	}
+}
+
+// retrying returns true if a retry of domain is scheduled.
+func (m *Manager) retrying(domain string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return time.Now().Before(m.retries[domain].Next)
+}
+
+// obtainLogged obtains the certificate of domain and logs the
+// outcome. If it fails, another try is scheduled after a backoff,
+// which is saved so it outlasts restarts.
+func (m *Manager) obtainLogged(domain string) {
+	err := m.Obtain(domain)
+	m.checkClock()
+
+	m.mu.Lock()
+	var state RetryState
+	if err != nil {
+		state = m.retries[domain]
+		state.Failures++
+		state.Next = time.Now().Add(m.backoff(state.Failures))
+		state.LastError = err.Error()
+		m.retries[domain] = state
+	} else {
+		delete(m.retries, domain)
+	}
+	m.mu.Unlock()
+	if serr := m.storage().SaveRetry(m.directoryURL(), domain, state, m.perms()); serr != nil {
+		log.Printf("[WARNING] acme: saving the retry state of %s: %v", domain, serr)
+	}
+
+	if err != nil {
+		wait := time.Until(state.Next).Round(time.Second)
+		log.Printf("[ERROR] Getting a certificate for %s (failure %d): %v; trying again in %v",
+			domain, state.Failures, err, wait)
+		m.retryAfter(domain, wait)
+		return
+	}
+	log.Printf("Got a certificate for %s", domain)
+}
+
+// retryAfter schedules an attempt to obtain the certificate
+// of domain after wait, replacing any that was scheduled.
+func (m *Manager) retryAfter(domain string, wait time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t := m.timers[domain]; t != nil {
+		t.Stop()
+	}
+	m.timers[domain] = time.AfterFunc(wait, func() {
+		if m.due(domain) {
+			m.obtainLogged(domain)
+		}
+	})
+}
+
+// backoff returns how long to wait after the given number of
+// consecutive failures: exponentially longer, with jitter so
+// that many sites that failed together don't retry together.
+func (m *Manager) backoff(failures int) time.Duration {
+	min, max := m.RetryMin, m.RetryMax
+	if min == 0 {
+		min = DefaultRetryMin
+	}
+	if max == 0 {
+		max = DefaultRetryMax
+	}
+	d := max
+	if failures < 32 && min<<uint(failures-1) < max {
+		d = min << uint(failures-1)
+	}
+	return d - time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// checkClock warns if the system clock was far from the
+// CA's in its last response.
+func (m *Manager) checkClock() {
+	m.obtainMu.Lock()
+	client := m.client
+	m.obtainMu.Unlock()
+	if client == nil {
+		return
+	}
+	skew := client.ClockSkew()
+	switch {
+	case skew > MaxClockSkew:
+		log.Printf("[WARNING] acme: the system clock is %v behind the CA's; certificates may seem not yet valid until it is fixed", skew)
+	case skew < -MaxClockSkew:
+		log.Printf("[WARNING] acme: the system clock is %v ahead of the CA's; certificates may seem expired early until it is fixed", -skew)
+	}
+}
+
+// Obtain gets a new certificate for domain from the CA and stores it.
+func (m *Manager) Obtain(domain string) error {
+	m.obtainMu.Lock()
+	defer m.obtainMu.Unlock()
+
+	if m.client == nil {
+		key, err := m.storage().AccountKey(m.directoryURL(), m.Email, m.perms())
+		if err != nil {
+			return err
+		}
+		m.client = &Client{DirectoryURL: m.directoryURL(), Key: key, Email: m.Email, HTTPClient: m.HTTPClient}
+	}
+
+	certKey, err := newKey()
+	if err != nil {
+		return err
+	}
+	challenges := m.Challenges
+	if challenges == nil {
+		challenges = DefaultChallenges
+	}
+	chain, err := m.client.Obtain([]string{domain}, certKey, challenges)
+	if err != nil {
+		return err
+	}
+
+	keyPEM, err := encodeKey(certKey)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(chain, keyPEM)
+	if err != nil {
+		return err
+	}
+	if err := m.storage().SaveSite(m.directoryURL(), domain, chain, keyPEM, m.perms()); err != nil {
+		return err
+	}
+	m.setCert(domain, &cert)
+	return nil
+}
+
+func (m *Manager) setCert(domain string, cert *tls.Certificate) {
+	if cert.Leaf == nil {
+		cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+	m.mu.Lock()
+	m.certs[domain] = cert
+	m.mu.Unlock()
+}
+
+func (m *Manager) directoryURL() string {
+	if m.DirectoryURL == "" {
+		return LetsEncrypt
+	}
+	return m.DirectoryURL
+}
+
+func (m *Manager) storage() Storage {
+	if m.Storage == "" {
+		return DefaultStorage()
+	}
+	return m.Storage
+}
+
+func (m *Manager) perms() middleware.FilePerms {
+	if m.Perms == nil {
+		return middleware.FilePerms{}
+	}
+	return *m.Perms
+}
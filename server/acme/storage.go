@@ -0,0 +1,205 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// Storage keeps account keys and issued certificates and their keys
+// as PEM files in a directory, with a subdirectory for each CA:
+//
+//	<dir>/<CA host>/accounts/<email>.key
+//	<dir>/<CA host>/sites/<domain>.crt
+//	<dir>/<CA host>/sites/<domain>.key
+//	<dir>/<CA host>/sites/<domain>.retry
+//
+// The .retry file records failures to obtain the certificate
+// of the domain, so retries back off even across restarts.
+//
+// The methods that write files give them the ownership in the
+// FilePerms they are passed. Keys and directories stay private
+// to the owner; certificates and .retry files also get the modes.
+type Storage string
+
+// DefaultStorage returns the directory certificates are kept in by
+// default: .caddy/acme in the user's home directory, or in the
+// current directory if that isn't known.
+func DefaultStorage() Storage {
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = os.Getenv("USERPROFILE") // Windows
+	}
+	return Storage(filepath.Join(home, ".caddy", "acme"))
+}
+
+// caDir returns the directory of the CA at directoryURL.
+func (s Storage) caDir(directoryURL string) string {
+	host := directoryURL
+	if u, err := url.Parse(directoryURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return filepath.Join(string(s), safeName(host))
+}
+
+// AccountKey returns the key of the account of email with the CA at
+// directoryURL, generating and saving a new one if there is none.
+func (s Storage) AccountKey(directoryURL, email string, perms middleware.FilePerms) (*ecdsa.PrivateKey, error) {
+	if email == "" {
+		email = "default"
+	}
+	file := filepath.Join(s.caDir(directoryURL), "accounts", safeName(email)+".key")
+	if key, err := loadKey(file); err == nil {
+		return key, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	return key, saveKey(file, key, perms)
+}
+
+// Site returns the certificate chain of domain from the CA at
+// directoryURL and its key, both PEM-encoded.
+func (s Storage) Site(directoryURL, domain string) (chain, key []byte, err error) {
+	base := filepath.Join(s.caDir(directoryURL), "sites", safeName(domain))
+	if chain, err = ioutil.ReadFile(base + ".crt"); err != nil {
+		return nil, nil, err
+	}
+	if key, err = ioutil.ReadFile(base + ".key"); err != nil {
+		return nil, nil, err
+	}
+	return chain, key, nil
+}
+
+// SiteCertificateFile returns the file the certificate chain
+// of domain from the CA at directoryURL is kept in.
+func (s Storage) SiteCertificateFile(directoryURL, domain string) string {
+	return filepath.Join(s.caDir(directoryURL), "sites", safeName(domain)+".crt")
+}
+
+// SaveSite saves the certificate chain of domain from the CA at
+// directoryURL and its key, both PEM-encoded.
+func (s Storage) SaveSite(directoryURL, domain string, chain, key []byte, perms middleware.FilePerms) error {
+	base := filepath.Join(s.caDir(directoryURL), "sites", safeName(domain))
+	if err := privatePerms(perms).MkdirAll(filepath.Dir(base)); err != nil {
+		return err
+	}
+	if err := writeFile(base+".key", key, privatePerms(perms)); err != nil {
+		return err
+	}
+	return writeFile(base+".crt", chain, perms.Defaults(0644, 0700))
+}
+
+// RetryState is the record of failures to obtain a certificate.
+type RetryState struct {
+	Failures  int       `json:"failures"`
+	Next      time.Time `json:"next"` // when to try again
+	LastError string    `json:"last_error"`
+}
+
+// Retry returns the retry state of domain with the CA at
+// directoryURL; it is the zero value if there is none.
+func (s Storage) Retry(directoryURL, domain string) (RetryState, error) {
+	var state RetryState
+	data, err := ioutil.ReadFile(filepath.Join(s.caDir(directoryURL), "sites", safeName(domain)+".retry"))
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// SaveRetry saves the retry state of domain with the CA at
+// directoryURL, or removes it if state is the zero value.
+func (s Storage) SaveRetry(directoryURL, domain string, state RetryState, perms middleware.FilePerms) error {
+	file := filepath.Join(s.caDir(directoryURL), "sites", safeName(domain)+".retry")
+	if state.Failures == 0 {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := privatePerms(perms).MkdirAll(filepath.Dir(file)); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFile(file, data, perms.Defaults(0644, 0700))
+}
+
+// privatePerms returns the permissions of keys and directories:
+// the ownership in perms, but readable only by the owner.
+func privatePerms(perms middleware.FilePerms) middleware.FilePerms {
+	return perms.Owner().Defaults(0600, 0700)
+}
+
+// writeFile writes data to file by renaming a temporary file over
+// it, so that the file is never left half written.
+func writeFile(file string, data []byte, perms middleware.FilePerms) error {
+	tmp := file + ".tmp"
+	if err := perms.WriteFile(tmp, data); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func loadKey(file string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New(file + ": no key found")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func saveKey(file string, key *ecdsa.PrivateKey, perms middleware.FilePerms) error {
+	perms = privatePerms(perms)
+	if err := perms.MkdirAll(filepath.Dir(file)); err != nil {
+		return err
+	}
+	data, err := encodeKey(key)
+	if err != nil {
+		return err
+	}
+	return writeFile(file, data, perms)
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// safeName makes name safe to use as a file name.
+func safeName(name string) string {
+	name = strings.ToLower(name)
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == '*' || r == '?' || r == '"' || r == '<' || r == '>' || r == '|' {
+			return '_'
+		}
+		return r
+	}, name)
+}
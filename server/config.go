@@ -2,8 +2,12 @@ package server
 
 import (
 	"net"
+	"net/http"
+	"time"
 
 	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/middleware/i18n"
+	"github.com/mholt/caddy/middleware/storage"
 )
 
 // Config configuration for a single server.
@@ -11,6 +15,21 @@ type Config struct {
 	// The hostname or IP on which to serve
 	Host string
 
+	// All the hostnames of the site this config is for, in the
+	// order they were given; the first is the primary name and
+	// the rest are other names for it
+	Hosts []string
+
+	// Whether this site was made to redirect plain HTTP to the
+	// HTTPS site of the same host, rather than being configured;
+	// it gives way to a configured site at the same address
+	HTTPSRedirect bool
+
+	// The hostnames among Hosts that were given after the alias
+	// keyword, like foo.example.net in
+	// "example.com www.example.com alias foo.example.net"
+	Aliases []string
+
 	// The host address to bind on - defaults to (virtual) Host if empty
 	BindHost string
 
@@ -20,12 +39,77 @@ type Config struct {
 	// The directory from which to serve files
 	Root string
 
+	// Whether files may only be served if they are inside Root
+	// after symbolic links are followed (see middleware.ConfinedDir)
+	ConfineRoot bool
+
 	// HTTPS configuration
 	TLS TLSConfig
 
-	// Middleware stack; map of path scope to middleware -- TODO: Support path scope?
+	// Caps on the resources the site may use
+	Limits Limits
+
+	// Permissions and ownership for files the site creates
+	FilePerms middleware.FilePerms
+
+	// Where middleware keeps state, like rate limits and short
+	// links, if the site gives a store; nil leaves each to its
+	// own default
+	Storage storage.Storage
+
+	// How request paths are normalized before middleware
+	Paths PathPolicy
+
+	// Requests refused before middleware for their headers
+	Reject RejectPolicy
+
+	// Keeping small static files in memory
+	MemCache MemCacheConfig
+
+	// Name of the sidecar files that annotate the files in their
+	// directory (see package metadata); none are read if empty
+	MetadataFile string
+
+	// Set up to purge the site's file caches, if not nil
+	Purger *CachePurger
+
+	// Paths the server requests from the site itself once it
+	// starts serving it, before the site is reported ready
+	Warmup []string
+
+	// How the file server at the end of the middleware serves files
+	Files FilesConfig
+
+	// Socket tuning for serving large files
+	Downloads DownloadsConfig
+
+	// How middleware parses multipart request bodies
+	Multipart middleware.MultipartLimits
+
+	// What to do when a handler panics
+	PanicPolicy middleware.PanicPolicy
+
+	// Translations of the pages the server makes itself, like
+	// default error pages; i18n.Default is used if nil
+	Locales *i18n.Catalog
+
+	// Whether to time each layer of middleware for requests
+	// that carry a trace (see middleware.Trace)
+	TraceMiddleware bool
+
+	// Directives whose middleware starts turned off; it can
+	// be turned on through the admin API (see package toggle)
+	Disabled []string
+
+	// Middleware stack; map of path scope to middleware. A
+	// request goes through the layers of the longest scope that
+	// its path is under, "/" if no other, then to the file server
 	Middleware map[string][]middleware.Middleware
 
+	// Layers that go ahead of the middleware of every scope, for
+	// checks that no request may skip, like access policies
+	Guards []middleware.Middleware
+
 	// Functions (or methods) to execute at server start; these
 	// are executed before any parts of the server are configured,
 	// and the functions are blocking
@@ -35,9 +119,23 @@ type Config struct {
 	// these are executed in response to SIGINT and are blocking
 	Shutdown []func() error
 
+	// Functions that make the site known to the admin API, like
+	// its switches and proxy upstreams, and that forget it again;
+	// they run when the site goes into and out of service, which
+	// on a reload is only once the reload is committed
+	Publish, Unpublish []func()
+
+	// What the directives of the site need from the machine,
+	// checked by -diagnose (see Diagnostics)
+	Checks []Check
+
 	// The path to the configuration file from which this was loaded
 	ConfigFile string
 
+	// The tokens of each directive in the site's server block,
+	// as text, so reloads can tell which directives changed
+	Directives map[string]string
+
 	// The name of the application
 	AppName string
 
@@ -45,6 +143,14 @@ type Config struct {
 	AppVersion string
 }
 
+// FileSystem returns the file system to serve the site's files from.
+func (c Config) FileSystem() http.FileSystem {
+	if c.ConfineRoot {
+		return middleware.ConfinedDir(c.Root)
+	}
+	return http.Dir(c.Root)
+}
+
 // Address returns the host:port of c as a string.
 func (c Config) Address() string {
 	return net.JoinHostPort(c.Host, c.Port)
@@ -62,4 +168,114 @@ type TLSConfig struct {
 	ProtocolMaxVersion       uint16
 	PreferServerCipherSuites bool
 	ClientCerts              []string
+
+	// How to obtain the certificate automatically, if
+	// Certificate and Key aren't set
+	ACME ACMEConfig
+}
+
+// Managed returns true if the certificate is obtained and
+// renewed automatically with ACME.
+func (t TLSConfig) Managed() bool {
+	return t.Enabled && t.Certificate == "" && t.Key == ""
+}
+
+// ACMEConfig describes how to obtain a site's certificate from
+// a certificate authority with ACME.
+type ACMEConfig struct {
+	CA      string // directory URL of the CA; Let's Encrypt if empty
+	Email   string // contact for the account with the CA
+	Storage string // directory to keep certificates in; a default if empty
+}
+
+// MemCacheConfig describes how the file server keeps small files in
+// memory. The memory all the files may take is Limits.CacheMemory,
+// or DefaultCacheMemory if that isn't set.
+type MemCacheConfig struct {
+	Enabled bool
+
+	// Largest file to keep in memory
+	MaxFileSize int64
+
+	// Whether to memory-map files instead of reading them
+	Mmap bool
+}
+
+// Defaults for MemCacheConfig.
+const (
+	DefaultMemCacheMaxFileSize = 256 << 10
+	DefaultCacheMemory         = 64 << 20
+)
+
+// FilesConfig describes how the file server at the end of a site's
+// middleware finds and describes the files it serves.
+type FilesConfig struct {
+	// Names of the files served for a directory, most preferred
+	// first; browse.IndexPages if empty
+	IndexPages []string
+
+	// Patterns of the files and directories that are served as
+	// though they don't exist (see middleware.HiddenPath)
+	Hide []string
+
+	// Whether to leave out the ETag of files
+	NoETag bool
+}
+
+// DownloadsConfig describes how the file server tunes the connection
+// when it serves a file of at least Threshold bytes. It has no effect
+// if Threshold is 0.
+type DownloadsConfig struct {
+	Threshold int64
+
+	// Whether to hold back partial packets while the headers and body
+	// are being sent (TCP_CORK on Linux, TCP_NOPUSH on macOS), so they
+	// go out in full packets
+	Cork bool
+
+	// Size of the connection's send buffer (SO_SNDBUF), if not 0
+	WriteBuffer int
+
+	// Size of the writes the body is copied in when the file can't
+	// be sent with sendfile, such as when it is compressed, if not 0
+	ChunkSize int
+
+	// Most byte ranges one request may ask for; a request for more
+	// is answered with the whole file. Players seeking in a video
+	// ask for one or two, so many small ones are likely abuse. No
+	// limit if 0.
+	MaxRanges int
+
+	// Size of the blocks the file is read in ahead of what has
+	// been sent, if not 0. It is worth setting, larger than the
+	// 32KB a body is copied in, for disks that are slow to seek;
+	// files read this way can't be sent with sendfile.
+	ReadAhead int
+
+	// Range requests that one client IP address may be streaming
+	// at once, if not 0; more are refused with 429 Too Many Requests
+	Streams int
+}
+
+// DefaultDownloadThreshold is the size of files that are
+// tuned for if the downloads directive doesn't give one.
+const DefaultDownloadThreshold = 1 << 20
+
+// Limits caps the resources a site may use. The middleware
+// and caches that use each resource enforce its limit. A
+// zero value means there is no limit.
+type Limits struct {
+	// Requests that may be handled by FastCGI at once
+	FastCGI int
+
+	// Bytes of memory that the memory cache may use; the site
+	// must enable it (see MemCacheConfig)
+	CacheMemory int64
+
+	// Files that the file server may keep open in its cache
+	OpenFiles int
+
+	// How long a request may take; once it passes, the
+	// request's context is canceled and handlers give up
+	RequestTimeout time.Duration
 }
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+func setCork(conn *net.TCPConn, on bool) error {
+	return errors.New("corking not supported on this platform")
+}
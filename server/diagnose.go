@@ -0,0 +1,170 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/mholt/caddy/server/acme"
+)
+
+// Check is something a site needs from the machine it is served
+// on, like a log file it can write, that can be checked before
+// anything is served (see the -diagnose flag). Setup functions
+// add the checks of their directives to Config.Checks.
+type Check struct {
+	What string       // what is checked, like "log file access.log"
+	Run  func() error // returns why the check fails, or nil
+}
+
+// Diagnostics returns the checks of c: that its root, certificate
+// and key can be read and that the directory its managed certificate
+// is kept in can be written, followed by the checks of its directives.
+func (c Config) Diagnostics() []Check {
+	checks := []Check{{"root " + c.Root, CheckReadable(c.Root, true)}}
+
+	if c.TLS.Enabled {
+		if c.TLS.Managed() {
+			storage := c.TLS.ACME.Storage
+			if storage == "" {
+				storage = string(acme.DefaultStorage())
+			}
+			checks = append(checks, Check{"certificate storage " + storage, CheckWritableDir(storage)})
+		} else {
+			cert, key := c.TLS.Certificate, c.TLS.Key
+			checks = append(checks,
+				Check{"certificate " + cert, CheckReadable(cert, false)},
+				Check{"key " + key + " matches the certificate", func() error {
+					if err := CheckReadable(key, false)(); err != nil {
+						return err
+					}
+					if CheckReadable(cert, false)() != nil {
+						return nil // the certificate's check fails already
+					}
+					_, err := tls.LoadX509KeyPair(cert, key)
+					return err
+				}})
+		}
+		for _, ca := range c.TLS.ClientCerts {
+			checks = append(checks, Check{"client CA " + ca, CheckReadable(ca, false)})
+		}
+	}
+
+	return append(checks, c.Checks...)
+}
+
+// CheckReadable returns a check that name can be opened for
+// reading, and is a directory if dir is true or a file if not.
+func CheckReadable(name string, dir bool) func() error {
+	return func() error {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if info.IsDir() != dir {
+			if dir {
+				return fmt.Errorf("%s is not a directory", name)
+			}
+			return fmt.Errorf("%s is a directory", name)
+		}
+		if dir {
+			_, err = f.Readdirnames(1)
+			if err != nil && err != io.EOF {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// CheckWritableFile returns a check that the file name could be
+// appended to, or created if it doesn't exist yet. Nothing is
+// written to it.
+func CheckWritableFile(name string) func() error {
+	return func() error {
+		info, err := os.Stat(name)
+		if os.IsNotExist(err) {
+			return createIn(filepath.Dir(name))
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return fmt.Errorf("%s is a directory", name)
+		}
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+}
+
+// CheckWritableDir returns a check that files can be created in
+// dir, or in the nearest directory above it that exists if it
+// doesn't exist yet, as it would be made when it is needed.
+func CheckWritableDir(dir string) func() error {
+	return func() error {
+		for {
+			info, err := os.Stat(dir)
+			if err == nil {
+				if !info.IsDir() {
+					return fmt.Errorf("%s is not a directory", dir)
+				}
+				break
+			}
+			if !os.IsNotExist(err) || filepath.Dir(dir) == dir {
+				return err
+			}
+			dir = filepath.Dir(dir)
+		}
+		return createIn(dir)
+	}
+}
+
+// createIn returns an error if a file can't be created in dir.
+func createIn(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".diagnose")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// CheckResolves returns a check that host, unless it is an IP
+// address, resolves to at least one address.
+func CheckResolves(host string) func() error {
+	return func() error {
+		if net.ParseIP(host) != nil {
+			return nil
+		}
+		_, err := net.LookupHost(host)
+		return err
+	}
+}
+
+// CheckListen returns a check that the address addr is free
+// for the server to listen on, which it may not be if another
+// process has it or it is a privileged port.
+func CheckListen(addr string) func() error {
+	return func() error {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		return ln.Close()
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestChecks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caddy_diagnose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "access.log")
+	if err := ioutil.WriteFile(file, []byte("entry\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	readOnly := filepath.Join(dir, "readonly")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatal(err)
+	}
+	// root can write anywhere, and Windows ignores the mode of directories
+	canTestModes := os.Geteuid() != 0 && runtime.GOOS != "windows"
+
+	for i, test := range []struct {
+		check     func() error
+		shouldErr bool
+	}{
+		{CheckReadable(dir, true), false},
+		{CheckReadable(file, false), false},
+		{CheckReadable(file, true), true},
+		{CheckReadable(dir, false), true},
+		{CheckReadable(filepath.Join(dir, "missing"), true), true},
+		{CheckWritableFile(file), false},
+		{CheckWritableFile(filepath.Join(dir, "new.log")), false},
+		{CheckWritableFile(filepath.Join(dir, "missing", "new.log")), true},
+		{CheckWritableFile(dir), true},
+		{CheckWritableDir(dir), false},
+		{CheckWritableDir(filepath.Join(dir, "not", "made", "yet")), false},
+		{CheckWritableDir(file), true},
+		{CheckWritableDir(filepath.Join(readOnly, "cache")), canTestModes},
+		{CheckResolves("127.0.0.1"), false},
+		{CheckResolves("localhost"), false},
+		{CheckResolves("nonexistent.invalid"), true},
+	} {
+		err := test.check()
+		if err == nil && test.shouldErr {
+			t.Errorf("Test %d didn't error, but it should have", i)
+		} else if err != nil && !test.shouldErr {
+			t.Errorf("Test %d errored, but it shouldn't have; got '%v'", i, err)
+		}
+	}
+
+	// nothing is left behind
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected the checks to leave the directory as it was, got %d entries", len(entries))
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	for i, test := range []struct {
+		config   Config
+		expected int
+	}{
+		{Config{Root: "."}, 1},
+		{Config{Root: ".", Checks: []Check{{What: "extra"}}}, 2},
+		{Config{Root: ".", TLS: TLSConfig{Enabled: true, Certificate: "cert.pem", Key: "key.pem"}}, 3},
+		{Config{Root: ".", TLS: TLSConfig{Enabled: true, ACME: ACMEConfig{Storage: "acme"}}}, 2},
+		{Config{Root: ".", TLS: TLSConfig{Enabled: true, Certificate: "cert.pem", Key: "key.pem", ClientCerts: []string{"ca.pem"}}}, 4},
+	} {
+		if got := len(test.config.Diagnostics()); got != test.expected {
+			t.Errorf("Test %d: Expected %d checks, got %d", i, test.expected, got)
+		}
+	}
+}
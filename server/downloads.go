@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+)
+
+type connKey struct{}
+
+// withConn is used as http.Server.ConnContext, so that handlers
+// can reach the connection a request came in on.
+func withConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// tcpConn returns the TCP connection r came in on, or nil if it
+// isn't known. For HTTPS, it is the connection under the TLS.
+func tcpConn(r *http.Request) *net.TCPConn {
+	c, _ := r.Context().Value(connKey{}).(net.Conn)
+	if tc, ok := c.(interface{ NetConn() net.Conn }); ok {
+		c = tc.NetConn()
+	}
+	tcp, _ := c.(*net.TCPConn)
+	return tcp
+}
+
+// tuneDownload applies config to the connection of r and w before a
+// large file is sent. It returns the writer to send the file to, and
+// a function to call once it has been sent.
+func tuneDownload(w http.ResponseWriter, r *http.Request, config DownloadsConfig) (http.ResponseWriter, func()) {
+	done := func() {}
+	if conn := tcpConn(r); conn != nil {
+		if config.WriteBuffer > 0 {
+			conn.SetWriteBuffer(config.WriteBuffer)
+		}
+		if config.Cork && setCork(conn, true) == nil {
+			done = func() {
+				// push out what was held back; the rest of the
+				// response is flushed after the handler returns
+				if f, ok := w.(http.Flusher); ok {
+					f.Flush()
+				}
+				setCork(conn, false)
+			}
+		}
+	}
+	if config.ChunkSize > 0 {
+		w = chunkWriter{ResponseWriter: w, size: config.ChunkSize}
+	}
+	return w, done
+}
+
+// chunkWriter copies bodies to the ResponseWriter in writes of size
+// bytes, unless the ResponseWriter can take them directly, which it
+// does with sendfile when the body is a file.
+type chunkWriter struct {
+	http.ResponseWriter
+	size int
+}
+
+func (w chunkWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	// hide ReadFrom, or CopyBuffer would call it again
+	return io.CopyBuffer(struct{ io.Writer }{w.ResponseWriter}, src, make([]byte, w.size))
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloads(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_downloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1<<16) // 1 MiB
+	if err := ioutil.WriteFile(filepath.Join(root, "big.bin"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var sawConn bool
+	fh := &fileHandler{
+		root:      http.Dir(root),
+		downloads: DownloadsConfig{Threshold: 1024, Cork: true, WriteBuffer: 1 << 20, ChunkSize: 64 << 10},
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sawConn = tcpConn(r) != nil
+		if status, _ := fh.ServeHTTP(w, r); status >= 400 {
+			w.WriteHeader(status)
+		}
+	}))
+	ts.Config.ConnContext = withConn
+	ts.Start()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/big.bin")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if !sawConn {
+		t.Error("Expected the handler to find the TCP connection")
+	}
+	if !bytes.Equal(body, content) {
+		t.Errorf("Expected %d bytes of the file, got %d different bytes", len(content), len(body))
+	}
+}
+
+// writeCounter records the sizes of the writes to it.
+type writeCounter struct {
+	http.ResponseWriter
+	sizes []int
+}
+
+func (w *writeCounter) Write(b []byte) (int, error) {
+	w.sizes = append(w.sizes, len(b))
+	return len(b), nil
+}
+
+func TestChunkWriter(t *testing.T) {
+	wc := &writeCounter{ResponseWriter: httptest.NewRecorder()}
+	w := chunkWriter{ResponseWriter: wc, size: 1000}
+
+	n, err := io.Copy(w, struct{ io.Reader }{bytes.NewReader(make([]byte, 2500))})
+	if err != nil || n != 2500 {
+		t.Fatalf("Expected 2500 bytes copied without error, got %d and %v", n, err)
+	}
+	if len(wc.sizes) != 3 || wc.sizes[0] != 1000 || wc.sizes[2] != 500 {
+		t.Errorf("Expected writes of 1000, 1000 and 500 bytes, got %v", wc.sizes)
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_streaming")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1<<12) // 64 KiB
+	for _, name := range []string{"clip.mp4", "clip.webm"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fh := &fileHandler{
+		root:      http.Dir(root),
+		downloads: DownloadsConfig{Threshold: 1024, MaxRanges: 2, ReadAhead: 4096, Streams: 1},
+		streams:   newStreamLimiter(1),
+	}
+
+	for i, test := range []struct {
+		path           string
+		rng            string
+		expectedStatus int
+		expectedType   string
+		expectedBody   []byte
+	}{
+		{"/clip.mp4", "", http.StatusOK, "video/mp4", content},
+		{"/clip.webm", "bytes=16-31", http.StatusPartialContent, "video/webm", content[16:32]},
+		{"/clip.mp4", "bytes=65520-", http.StatusPartialContent, "video/mp4", content[65520:]},
+		{"/clip.mp4", "bytes=40000-40009", http.StatusPartialContent, "video/mp4", content[40000:40010]},
+		{"/clip.mp4", "bytes=0-0,10-10,20-20", http.StatusOK, "video/mp4", content},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		if test.rng != "" {
+			r.Header.Set("Range", test.rng)
+		}
+		rec := httptest.NewRecorder()
+		if _, err := fh.ServeHTTP(rec, r); err != nil {
+			t.Errorf("Test %d: Expected no error, got: %v", i, err)
+		}
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, rec.Code)
+		}
+		if ctype := rec.Header().Get("Content-Type"); ctype != test.expectedType {
+			t.Errorf("Test %d: Expected content type %s, got %s", i, test.expectedType, ctype)
+		}
+		if !bytes.Equal(rec.Body.Bytes(), test.expectedBody) {
+			t.Errorf("Test %d: Expected %d bytes of the file, got %d different bytes", i, len(test.expectedBody), rec.Body.Len())
+		}
+	}
+
+	// two ranges are allowed, and sent as a multipart body
+	r := httptest.NewRequest("GET", "/clip.mp4", nil)
+	r.Header.Set("Range", "bytes=0-9,100-109")
+	rec := httptest.NewRecorder()
+	fh.ServeHTTP(rec, r)
+	if rec.Code != http.StatusPartialContent || !strings.HasPrefix(rec.Header().Get("Content-Type"), "multipart/byteranges") {
+		t.Errorf("Expected a multipart 206 response for two ranges, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	// while the one stream allowed is busy, another range is refused
+	busy := httptest.NewRequest("GET", "/clip.mp4", nil)
+	if !fh.streams.acquire(busy) {
+		t.Fatal("Expected the first stream to be allowed")
+	}
+	r = httptest.NewRequest("GET", "/clip.mp4", nil)
+	r.Header.Set("Range", "bytes=0-9")
+	status, _ := fh.ServeHTTP(httptest.NewRecorder(), r)
+	if status != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d with a stream busy, got %d", http.StatusTooManyRequests, status)
+	}
+	fh.streams.release(busy)
+	rec = httptest.NewRecorder()
+	fh.ServeHTTP(rec, r)
+	if rec.Code != http.StatusPartialContent {
+		t.Errorf("Expected status %d once the stream is done, got %d", http.StatusPartialContent, rec.Code)
+	}
+}
+
+func TestReadAheadFile(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	ra := newReadAheadFile(bytes.NewReader(content), 16)
+
+	buf := make([]byte, 4)
+	io.ReadFull(ra, buf)
+	if pos, _ := ra.Seek(0, io.SeekCurrent); pos != 4 {
+		t.Errorf("Expected position 4 after reading 4 bytes, got %d", pos)
+	}
+	if _, err := ra.Seek(30, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, _ := ioutil.ReadAll(ra)
+	if string(rest) != "uvwxyz" {
+		t.Errorf("Expected to read uvwxyz after seeking, got %q", rest)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// DrainTimeout is how long a virtual host that was replaced by a
+// reload waits for the requests it is still handling to finish
+// before its resources are released anyway. Long-lived requests,
+// like WebSocket connections or streams, may take longer.
+var DrainTimeout = 30 * time.Second
+
+// inflight counts the requests a virtual host is handling.
+type inflight struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{} // closed when n drops to 0, if anyone waits
+}
+
+func (f *inflight) add() {
+	f.mu.Lock()
+	f.n++
+	f.mu.Unlock()
+}
+
+func (f *inflight) done() {
+	f.mu.Lock()
+	f.n--
+	if f.n == 0 && f.idle != nil {
+		close(f.idle)
+		f.idle = nil
+	}
+	f.mu.Unlock()
+}
+
+// wait waits up to timeout for there to be no requests, and
+// returns whether there are none.
+func (f *inflight) wait(timeout time.Duration) bool {
+	f.mu.Lock()
+	if f.n == 0 {
+		f.mu.Unlock()
+		return true
+	}
+	if f.idle == nil {
+		f.idle = make(chan struct{})
+	}
+	idle := f.idle
+	f.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// retire waits for the requests vh is handling to finish, then runs
+// its shutdown functions and releases its resources. It is for hosts
+// that no longer get new requests, because a reload replaced them.
+func (vh virtualHost) retire() {
+	if !vh.requests.wait(DrainTimeout) {
+		log.Printf("[WARNING] %s: requests still running %v after reload; closing anyway",
+			vh.config.Address(), DrainTimeout)
+	}
+	for _, shutdown := range vh.config.Shutdown {
+		if err := shutdown(); err != nil {
+			log.Printf("[ERROR] %s: shutting down: %v", vh.config.Address(), err)
+		}
+	}
+	vh.close()
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// staticFastPath sits below the outermost layer of the stack that
+// isn't middleware.Scoped. Requests that none of the scoped layers
+// under it act on are served by the file server right away, rather
+// than passing through each of those layers in turn.
+type staticFastPath struct {
+	next       middleware.Handler
+	fileServer middleware.Handler
+	scopes     []string
+
+	// passThrough is set once it turns out that the layer
+	// above is scoped too, so this fork has nothing to skip.
+	passThrough bool
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (f *staticFastPath) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if f.passThrough || !f.static(r.URL.Path) {
+		return f.next.ServeHTTP(w, r)
+	}
+	return f.fileServer.ServeHTTP(w, r)
+}
+
+// static returns true if no scoped layer acts on urlPath. Paths that
+// aren't clean take the full chain, since the file server would clean
+// them into what might be one of the scopes.
+func (f *staticFastPath) static(urlPath string) bool {
+	if urlPath == "" {
+		return false
+	}
+	if clean := path.Clean(urlPath); clean != urlPath && clean+"/" != urlPath {
+		return false
+	}
+	for _, scope := range f.scopes {
+		if middleware.Path(urlPath).Matches(scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// tracedLayer appends its name to a shared trace
+// when it handles a request.
+type tracedLayer struct {
+	name  string
+	next  middleware.Handler
+	trace *[]string
+}
+
+func (l tracedLayer) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	*l.trace = append(*l.trace, l.name)
+	return l.next.ServeHTTP(w, r)
+}
+
+// scopedLayer is a tracedLayer that is middleware.Scoped.
+type scopedLayer struct {
+	tracedLayer
+	scopes []string
+}
+
+func (l scopedLayer) Scopes() []string { return l.scopes }
+
+func TestStaticFastPath(t *testing.T) {
+	var trace []string
+	layer := func(name string, scopes ...string) middleware.Middleware {
+		return func(next middleware.Handler) middleware.Handler {
+			l := tracedLayer{name: name, next: next, trace: &trace}
+			if scopes == nil {
+				return l
+			}
+			return scopedLayer{l, scopes}
+		}
+	}
+
+	vh := &virtualHost{fileServer: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		trace = append(trace, "files")
+		return http.StatusOK, nil
+	})}
+	vh.compile([]middleware.Middleware{
+		layer("log"),
+		layer("rewrite", "/old"),
+		layer("proxy", "/api"),
+		layer("templates", "/docs"),
+	})
+
+	for i, test := range []struct {
+		path     string
+		expected string
+	}{
+		{"/style.css", "log files"},
+		{"/img/", "log files"},
+		{"/api/users", "log rewrite proxy templates files"},
+		{"/docs/index.html", "log rewrite proxy templates files"},
+		{"/old", "log rewrite proxy templates files"},
+		{"/img/../api/users", "log rewrite proxy templates files"},
+		{"//api", "log rewrite proxy templates files"},
+	} {
+		trace = nil
+		r, _ := http.NewRequest("GET", "http://localhost"+test.path, nil)
+		vh.stack.ServeHTTP(httptest.NewRecorder(), r)
+		if got := strings.Join(trace, " "); got != test.expected {
+			t.Errorf("Test %d: Expected %s to go through '%s', got '%s'", i, test.path, test.expected, got)
+		}
+	}
+
+	// a layer that isn't scoped keeps those below it from being skipped
+	vh.compile([]middleware.Middleware{
+		layer("proxy", "/api"),
+		layer("ext"),
+		layer("templates", "/docs"),
+	})
+	trace = nil
+	r, _ := http.NewRequest("GET", "http://localhost/style.css", nil)
+	vh.stack.ServeHTTP(httptest.NewRecorder(), r)
+	if got := strings.Join(trace, " "); got != "proxy ext files" {
+		t.Errorf("Expected request to go through 'proxy ext files', got '%s'", got)
+	}
+}
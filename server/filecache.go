@@ -0,0 +1,192 @@
+package server
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileCacheValid is how long a cached file is served without
+// checking whether it changed on disk.
+const fileCacheValid = time.Second
+
+// fileCache is an http.FileSystem that keeps the most recently used
+// regular files open, so that serving a popular file does not open,
+// stat and close it on every request. At most max files are kept open;
+// the least recently used one is closed to make room for another.
+//
+// A cached file is served as is for fileCacheValid; after that it is
+// checked again, and reopened if its size or modification time changed.
+// Cached files are shared by concurrent requests, which read them with
+// ReadAt, so files that don't support it are not cached. Neither are
+// directories.
+type fileCache struct {
+	fs      http.FileSystem
+	max     int
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // of *cacheEntry, most recently used first
+}
+
+// cacheEntry is a file kept open by a fileCache.
+type cacheEntry struct {
+	name    string
+	file    http.File
+	info    os.FileInfo
+	checked time.Time
+	refs    int  // requests using the file
+	evicted bool // removed from the cache; close when refs is 0
+}
+
+func newFileCache(fs http.FileSystem, max int) *fileCache {
+	return &fileCache{
+		fs:      fs,
+		max:     max,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Open opens the file called name, from the cache if it is there.
+// The file must be closed when the caller is done with it.
+func (c *fileCache) Open(name string) (http.File, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[name]; ok {
+		e := el.Value.(*cacheEntry)
+		if time.Since(e.checked) < fileCacheValid {
+			c.lru.MoveToFront(el)
+			e.refs++
+			c.mu.Unlock()
+			return newCachedFile(c, e), nil
+		}
+	}
+	c.mu.Unlock()
+
+	f, err := c.fs.Open(name)
+	if err != nil {
+		c.remove(name)
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		c.remove(name)
+		return nil, err
+	}
+	if _, ok := f.(io.ReaderAt); !ok || !info.Mode().IsRegular() {
+		c.remove(name)
+		return f, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[name]; ok {
+		e := el.Value.(*cacheEntry)
+		if e.info.ModTime().Equal(info.ModTime()) && e.info.Size() == info.Size() {
+			// unchanged; keep the file that is already open
+			f.Close()
+			e.checked = time.Now()
+			c.lru.MoveToFront(el)
+			e.refs++
+			return newCachedFile(c, e), nil
+		}
+		c.evict(el)
+	}
+
+	e := &cacheEntry{name: name, file: f, info: info, checked: time.Now(), refs: 1}
+	c.entries[name] = c.lru.PushFront(e)
+	for c.lru.Len() > c.max {
+		c.evict(c.lru.Back())
+	}
+	return newCachedFile(c, e), nil
+}
+
+// Close closes all the files in the cache, each as soon
+// as no request is using it.
+func (c *fileCache) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.lru.Len() > 0 {
+		c.evict(c.lru.Back())
+	}
+}
+
+// remove evicts the file called name, if it is cached.
+func (c *fileCache) remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[name]; ok {
+		c.evict(el)
+	}
+}
+
+// evict removes el from the cache. c.mu must be held.
+func (c *fileCache) evict(el *list.Element) {
+	e := el.Value.(*cacheEntry)
+	c.lru.Remove(el)
+	delete(c.entries, e.name)
+	e.evicted = true
+	if e.refs == 0 {
+		e.file.Close()
+	}
+}
+
+// release is called when a request is done with e.
+func (c *fileCache) release(e *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.refs--
+	if e.refs == 0 && e.evicted {
+		e.file.Close()
+	}
+}
+
+// cachedFile is one request's view of a cached file, with
+// its own offset, since the file itself is shared.
+type cachedFile struct {
+	*io.SectionReader
+	cache  *fileCache
+	entry  *cacheEntry
+	closed bool
+}
+
+func newCachedFile(c *fileCache, e *cacheEntry) *cachedFile {
+	return &cachedFile{
+		SectionReader: io.NewSectionReader(e.file.(io.ReaderAt), 0, e.info.Size()),
+		cache:         c,
+		entry:         e,
+	}
+}
+
+func (f *cachedFile) Close() error {
+	if f.closed {
+		return errors.New("file already closed")
+	}
+	f.closed = true
+	f.cache.release(f.entry)
+	return nil
+}
+
+// Fd returns the descriptor of the shared file, so it can be
+// memory-mapped (see memCache), or an invalid descriptor if
+// the file has none.
+func (f *cachedFile) Fd() uintptr {
+	if fd, ok := f.entry.file.(interface {
+		Fd() uintptr
+	}); ok {
+		return fd.Fd()
+	}
+	return ^uintptr(0)
+}
+
+func (f *cachedFile) Stat() (os.FileInfo, error) {
+	return f.entry.info, nil
+}
+
+func (f *cachedFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, errors.New("not a directory")
+}
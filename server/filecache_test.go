@@ -0,0 +1,139 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingFS counts the files opened through it.
+type countingFS struct {
+	http.FileSystem
+	mu    sync.Mutex
+	opens map[string]int
+}
+
+func (fs *countingFS) Open(name string) (http.File, error) {
+	fs.mu.Lock()
+	fs.opens[name]++
+	fs.mu.Unlock()
+	return fs.FileSystem.Open(name)
+}
+
+func TestFileCache(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_filecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte("file "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs := &countingFS{FileSystem: http.Dir(root), opens: make(map[string]int)}
+	cache := newFileCache(fs, 2)
+	defer cache.Close()
+
+	read := func(name string) string {
+		f, err := cache.Open(name)
+		if err != nil {
+			t.Fatalf("Expected no error opening %s, got: %v", name, err)
+		}
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatalf("Expected no error reading %s, got: %v", name, err)
+		}
+		return string(b)
+	}
+
+	// hits are served without opening the file again
+	for i := 0; i < 3; i++ {
+		if got := read("/a.txt"); got != "file a.txt" {
+			t.Errorf("Expected 'file a.txt', got '%s'", got)
+		}
+	}
+	if fs.opens["/a.txt"] != 1 {
+		t.Errorf("Expected /a.txt to be opened once, got %d", fs.opens["/a.txt"])
+	}
+
+	// concurrent readers each have their own offset
+	f1, _ := cache.Open("/a.txt")
+	f2, _ := cache.Open("/a.txt")
+	buf := make([]byte, 4)
+	f1.Read(buf)
+	if b, _ := ioutil.ReadAll(f2); string(b) != "file a.txt" {
+		t.Errorf("Expected second reader to start at the beginning, got '%s'", b)
+	}
+	f1.Close()
+	f2.Close()
+
+	// the least recently used file is closed to make room
+	read("/b.txt")
+	read("/c.txt")
+	if _, ok := cache.entries["/a.txt"]; ok {
+		t.Error("Expected /a.txt to be evicted")
+	}
+	if cache.lru.Len() != 2 {
+		t.Errorf("Expected 2 open files, got %d", cache.lru.Len())
+	}
+
+	// changed files are reopened once they are due to be checked;
+	// until then, a file that was replaced is served as it was
+	if err := ioutil.WriteFile(filepath.Join(root, "c.tmp"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(root, "c.tmp"), filepath.Join(root, "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("/c.txt"); got != "file c.txt" {
+		t.Errorf("Expected cached content until the next check, got '%s'", got)
+	}
+	cache.entries["/c.txt"].Value.(*cacheEntry).checked = time.Time{}
+	if got := read("/c.txt"); got != "changed" {
+		t.Errorf("Expected changed content after the check, got '%s'", got)
+	}
+
+	// directories are not cached
+	d, err := cache.Open("/")
+	if err != nil {
+		t.Fatalf("Expected no error opening directory, got: %v", err)
+	}
+	d.Close()
+	if _, ok := cache.entries["/"]; ok {
+		t.Error("Expected directory not to be cached")
+	}
+}
+
+func TestFileCacheCloseInUse(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_filecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := newFileCache(http.Dir(root), 1)
+	f, err := cache.Open("/a.txt")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	entry := f.(*cachedFile).entry
+
+	cache.Close()
+	if b, err := ioutil.ReadAll(f); err != nil || string(b) != "hello" {
+		t.Errorf("Expected file in use to stay readable, got '%s' and error %v", b, err)
+	}
+	f.Close()
+	if _, err := entry.file.Stat(); err == nil {
+		t.Error("Expected file to be closed once it was no longer used")
+	}
+}
@@ -1,13 +1,16 @@
 package server
 
 import (
+	"io"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 
 	"github.com/mholt/caddy/middleware"
 	"github.com/mholt/caddy/middleware/browse"
+	"github.com/mholt/caddy/middleware/metadata"
 )
 
 // FileServer is adapted from the one in net/http by
@@ -24,12 +27,16 @@ func FileServer(root http.FileSystem, hide []string) middleware.Handler {
 }
 
 type fileHandler struct {
-	root http.FileSystem
-	hide []string // list of files to treat as "Not Found"
+	root      http.FileSystem
+	hide      []string        // list of files to treat as "Not Found"
+	files     FilesConfig     // index pages, hidden patterns and ETags
+	metadata  string          // name of sidecar files with headers for files
+	downloads DownloadsConfig // tuning for large files
+	streams   *streamLimiter  // range requests being streamed to each client
 }
 
 func (fh *fileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
-	upath := r.URL.Path
+	upath := middleware.DecodedPath(r)
 	if !strings.HasPrefix(upath, "/") {
 		upath = "/" + upath
 		r.URL.Path = upath
@@ -40,6 +47,12 @@ func (fh *fileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, e
 // serveFile writes the specified file to the HTTP response.
 // name is '/'-separated, not filepath.Separator.
 func (fh *fileHandler) serveFile(w http.ResponseWriter, r *http.Request, name string) (int, error) {
+	// If the file or a directory it is in is supposed to be hidden,
+	// return a 404 without revealing anything about it
+	if middleware.HiddenPath(fh.files.Hide, name) {
+		return http.StatusNotFound, nil
+	}
+
 	f, err := fh.root.Open(name)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -82,8 +95,15 @@ func (fh *fileHandler) serveFile(w http.ResponseWriter, r *http.Request, name st
 
 	// use contents of an index file, if present, for directory
 	if d.IsDir() {
-		for _, indexPage := range browse.IndexPages {
+		indexPages := fh.files.IndexPages
+		if len(indexPages) == 0 {
+			indexPages = browse.IndexPages
+		}
+		for _, indexPage := range indexPages {
 			index := strings.TrimSuffix(name, "/") + "/" + indexPage
+			if middleware.HiddenPath(fh.files.Hide, index) {
+				continue
+			}
 			ff, err := fh.root.Open(index)
 			if err == nil {
 				defer ff.Close()
@@ -118,13 +138,63 @@ func (fh *fileHandler) serveFile(w http.ResponseWriter, r *http.Request, name st
 		}
 	}
 
+	if fh.metadata != "" {
+		entries, err := metadata.Load(fh.root, path.Dir(name), fh.metadata)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		entries[path.Base(name)].SetHeaders(w.Header())
+	}
+
+	if ctype, ok := mediaTypes[strings.ToLower(path.Ext(name))]; ok && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+
+	// With an ETag, ServeContent also answers If-None-Match and
+	// If-Range; it handles the dates and Range requests on its own
+	if !fh.files.NoETag && w.Header().Get("ETag") == "" {
+		w.Header().Set("ETag", fileETag(d))
+	}
+
+	var content io.ReadSeeker = f
+	if t := fh.downloads.Threshold; t > 0 && d.Size() >= t {
+		if rng := r.Header.Get("Range"); rng != "" {
+			if max := fh.downloads.MaxRanges; max > 0 && numRanges(rng) > max {
+				// too many to be worth seeking around for;
+				// send the whole file, as the spec allows
+				r = r.Clone(r.Context())
+				r.Header.Del("Range")
+			} else {
+				if !fh.streams.acquire(r) {
+					w.Header().Set("Retry-After", "1")
+					return http.StatusTooManyRequests, nil
+				}
+				defer fh.streams.release(r)
+			}
+		}
+		if size := fh.downloads.ReadAhead; size > 0 {
+			content = newReadAheadFile(f, size)
+		}
+
+		var done func()
+		w, done = tuneDownload(w, r, fh.downloads)
+		defer done()
+	}
+
 	// Note: Errors generated by ServeContent are written immediately
 	// to the response. This usually only happens if seeking fails (rare).
-	http.ServeContent(w, r, d.Name(), d.ModTime(), f)
+	http.ServeContent(w, r, d.Name(), d.ModTime(), content)
 
 	return http.StatusOK, nil
 }
 
+// fileETag returns a strong entity tag for the file described
+// by d, which changes whenever its size or modification time do.
+func fileETag(d os.FileInfo) string {
+	return `"` + strconv.FormatInt(d.ModTime().UnixNano(), 36) + "-" +
+		strconv.FormatInt(d.Size(), 36) + `"`
+}
+
 // redirect is taken from http.localRedirect of the std lib. It
 // sends an HTTP redirect to the client but will preserve the
 // query string for the new path.
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileServerMetadata(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	files := map[string]string{
+		"report.pdf": "%PDF",
+		"plain.txt":  "plain",
+		".metadata": `report.pdf {
+			name   "Q3 report.pdf"
+			header Cache-Control "max-age=60"
+		}`,
+	}
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fh := &fileHandler{root: http.Dir(root), hide: []string{".metadata"}, metadata: ".metadata"}
+
+	for i, test := range []struct {
+		path                string
+		expectedStatus      int
+		expectedCache       string
+		expectedDisposition string
+	}{
+		{"/report.pdf", http.StatusOK, "max-age=60", `inline; filename="Q3 report.pdf"`},
+		{"/plain.txt", http.StatusOK, "", ""},
+		{"/.metadata", http.StatusNotFound, "", ""},
+	} {
+		req := httptest.NewRequest("GET", test.path, nil)
+		rec := httptest.NewRecorder()
+		status, err := fh.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Test %d: Expected no error, got %v", i, err)
+		}
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expectedStatus, status)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != test.expectedCache {
+			t.Errorf("Test %d: Expected Cache-Control %q, got %q", i, test.expectedCache, got)
+		}
+		if got := rec.Header().Get("Content-Disposition"); got != test.expectedDisposition {
+			t.Errorf("Test %d: Expected Content-Disposition %q, got %q", i, test.expectedDisposition, got)
+		}
+	}
+}
+
+func TestFileServerConditional(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_fileserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for name, body := range map[string]string{
+		"file.txt":          "0123456789",
+		"docs/home.html":    "home",
+		"docs/index.html":   "index",
+		"notes.bak":         "old",
+		".git/config":       "secret",
+		"private/key.txt":   "secret",
+		"hidden/index.html": "index",
+	} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fh := &fileHandler{root: http.Dir(root), files: FilesConfig{
+		IndexPages: []string{"home.html", "index.html"},
+		Hide:       []string{".git", "*.bak", "/private", "/hidden/index.html"},
+	}}
+	serve := func(path string, header http.Header) (*httptest.ResponseRecorder, int) {
+		req := httptest.NewRequest("GET", path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		status, err := fh.ServeHTTP(rec, req)
+		if err != nil {
+			t.Errorf("Expected no error serving %s, got %v", path, err)
+		}
+		if status < 400 && rec.Code != http.StatusOK {
+			status = rec.Code
+		}
+		return rec, status
+	}
+
+	rec, _ := serve("/file.txt", nil)
+	etag, modified := rec.Header().Get("ETag"), rec.Header().Get("Last-Modified")
+	if etag == "" || modified == "" {
+		t.Fatalf("Expected an ETag and Last-Modified, got %q and %q", etag, modified)
+	}
+
+	for i, test := range []struct {
+		path           string
+		header         http.Header
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"/file.txt", http.Header{"If-None-Match": {etag}}, http.StatusNotModified, ""},
+		{"/file.txt", http.Header{"If-None-Match": {`"other"`}}, http.StatusOK, "0123456789"},
+		{"/file.txt", http.Header{"If-Modified-Since": {modified}}, http.StatusNotModified, ""},
+		{"/file.txt", http.Header{"Range": {"bytes=2-4"}}, http.StatusPartialContent, "234"},
+		{"/file.txt", http.Header{"Range": {"bytes=2-4"}, "If-Range": {etag}}, http.StatusPartialContent, "234"},
+		{"/file.txt", http.Header{"Range": {"bytes=2-4"}, "If-Range": {`"other"`}}, http.StatusOK, "0123456789"},
+		{"/docs/", nil, http.StatusOK, "home"},
+		{"/notes.bak", nil, http.StatusNotFound, ""},
+		{"/.git/config", nil, http.StatusNotFound, ""},
+		{"/private/key.txt", nil, http.StatusNotFound, ""},
+		{"/private", nil, http.StatusNotFound, ""},
+		{"/hidden/", nil, http.StatusNotFound, ""},
+	} {
+		rec, status := serve(test.path, test.header)
+		if status != test.expectedStatus {
+			t.Errorf("Test %d: Expected status %d for %s, got %d", i, test.expectedStatus, test.path, status)
+		}
+		if body := rec.Body.String(); status < 400 && body != test.expectedBody {
+			t.Errorf("Test %d: Expected body %q, got %q", i, test.expectedBody, body)
+		}
+	}
+
+	fh.files.NoETag = true
+	if rec, _ := serve("/file.txt", nil); rec.Header().Get("ETag") != "" {
+		t.Errorf("Expected no ETag when turned off, got %q", rec.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"expvar"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// MemCacheStats counts how the in-memory caches of all sites are
+// doing: "hits" and "misses" are requests for files that were and
+// weren't in memory, "files" and "bytes" are what the caches hold.
+// It is published with the expvar package as "mem_cache".
+var MemCacheStats = expvar.NewMap("mem_cache")
+
+// memCache is an http.FileSystem that keeps the contents of recently
+// used small files in memory, so the hottest assets are served without
+// disk I/O. Files larger than maxFile are not cached, and the least
+// recently used files are dropped to keep the total under maxBytes.
+//
+// With mmap, files are memory-mapped rather than read into memory, so
+// their pages are shared with the OS page cache. A mapped file must be
+// replaced on disk (e.g. renamed over), not truncated in place.
+//
+// Cached files are checked for changes the same way as in fileCache.
+type memCache struct {
+	fs       http.FileSystem
+	maxFile  int64
+	maxBytes int64
+	mmap     bool
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // of *memEntry, most recently used first
+	size    int64
+}
+
+// memEntry is a file held in memory by a memCache.
+type memEntry struct {
+	name    string
+	data    []byte
+	info    os.FileInfo
+	checked time.Time
+	mapped  bool
+	refs    int  // requests reading data
+	evicted bool // removed from the cache; unmap when refs is 0
+}
+
+func newMemCache(fs http.FileSystem, maxFile, maxBytes int64, mmap bool) *memCache {
+	return &memCache{
+		fs:       fs,
+		maxFile:  maxFile,
+		maxBytes: maxBytes,
+		mmap:     mmap,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Open opens the file called name, from memory if it is there.
+// The file must be closed when the caller is done with it.
+func (c *memCache) Open(name string) (http.File, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[name]; ok {
+		e := el.Value.(*memEntry)
+		if time.Since(e.checked) < fileCacheValid {
+			f := c.hit(el)
+			c.mu.Unlock()
+			return f, nil
+		}
+	}
+	c.mu.Unlock()
+
+	f, err := c.fs.Open(name)
+	if err != nil {
+		c.remove(name)
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		c.remove(name)
+		return nil, err
+	}
+	if !info.Mode().IsRegular() || info.Size() > c.maxFile || info.Size() > c.maxBytes {
+		c.remove(name)
+		if info.Mode().IsRegular() {
+			MemCacheStats.Add("misses", 1)
+		}
+		return f, nil
+	}
+
+	c.mu.Lock()
+	if el, ok := c.entries[name]; ok {
+		e := el.Value.(*memEntry)
+		if e.info.ModTime().Equal(info.ModTime()) && e.info.Size() == info.Size() {
+			// unchanged; keep what is already in memory
+			f.Close()
+			e.checked = time.Now()
+			mf := c.hit(el)
+			c.mu.Unlock()
+			return mf, nil
+		}
+	}
+	c.mu.Unlock()
+
+	MemCacheStats.Add("misses", 1)
+	data, mapped, err := c.load(f, info)
+	f.Close()
+	if err != nil {
+		c.remove(name)
+		return c.fs.Open(name)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[name]; ok {
+		c.evict(el)
+	}
+	e := &memEntry{name: name, data: data, info: info, checked: time.Now(), mapped: mapped, refs: 1}
+	c.entries[name] = c.lru.PushFront(e)
+	c.size += int64(len(data))
+	MemCacheStats.Add("files", 1)
+	MemCacheStats.Add("bytes", int64(len(data)))
+	for c.size > c.maxBytes {
+		c.evict(c.lru.Back())
+	}
+	return &memFile{Reader: bytes.NewReader(data), cache: c, entry: e}, nil
+}
+
+// load reads the contents of f into memory, or maps them if c.mmap
+// is set and f has a file descriptor. It returns true if they were
+// mapped.
+func (c *memCache) load(f http.File, info os.FileInfo) ([]byte, bool, error) {
+	if c.mmap && info.Size() > 0 {
+		if fd, ok := f.(interface {
+			Fd() uintptr
+		}); ok {
+			if data, err := mmapFile(fd.Fd(), info.Size()); err == nil {
+				return data, true, nil
+			}
+		}
+	}
+	data := make([]byte, info.Size())
+	_, err := io.ReadFull(f, data)
+	return data, false, err
+}
+
+// hit returns a file reading the entry in el. c.mu must be held.
+func (c *memCache) hit(el *list.Element) *memFile {
+	e := el.Value.(*memEntry)
+	c.lru.MoveToFront(el)
+	e.refs++
+	MemCacheStats.Add("hits", 1)
+	return &memFile{Reader: bytes.NewReader(e.data), cache: c, entry: e}
+}
+
+// Close drops all the files in the cache.
+func (c *memCache) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.lru.Len() > 0 {
+		c.evict(c.lru.Back())
+	}
+}
+
+// remove drops the file called name, if it is cached.
+func (c *memCache) remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[name]; ok {
+		c.evict(el)
+	}
+}
+
+// evict removes el from the cache. c.mu must be held.
+func (c *memCache) evict(el *list.Element) {
+	e := el.Value.(*memEntry)
+	c.lru.Remove(el)
+	delete(c.entries, e.name)
+	c.size -= int64(len(e.data))
+	MemCacheStats.Add("files", -1)
+	MemCacheStats.Add("bytes", -int64(len(e.data)))
+	e.evicted = true
+	if e.refs == 0 {
+		e.free()
+	}
+}
+
+// release is called when a request is done with e.
+func (c *memCache) release(e *memEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.refs--
+	if e.refs == 0 && e.evicted {
+		e.free()
+	}
+}
+
+// free unmaps the entry's data if it was mapped.
+func (e *memEntry) free() {
+	if e.mapped {
+		munmapFile(e.data)
+	}
+	e.data = nil
+}
+
+// memFile is one request's reader of a file in memory.
+type memFile struct {
+	*bytes.Reader
+	cache  *memCache
+	entry  *memEntry
+	closed bool
+}
+
+func (f *memFile) Close() error {
+	if f.closed {
+		return errors.New("file already closed")
+	}
+	f.closed = true
+	f.cache.release(f.entry)
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	return f.entry.info, nil
+}
+
+func (f *memFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, errors.New("not a directory")
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"expvar"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMemCache(t *testing.T) {
+	for _, mmap := range []bool{false, true} {
+		root, err := ioutil.TempDir("", "caddy_memcache")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(root)
+		files := map[string]string{
+			"a.css": strings.Repeat("a", 40),
+			"b.css": strings.Repeat("b", 40),
+			"c.css": strings.Repeat("c", 40),
+			"big":   strings.Repeat("x", 200),
+		}
+		for name, content := range files {
+			if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		fs := &countingFS{FileSystem: http.Dir(root), opens: make(map[string]int)}
+		cache := newMemCache(fs, 100, 100, mmap)
+
+		read := func(name string) string {
+			f, err := cache.Open(name)
+			if err != nil {
+				t.Fatalf("mmap=%v: Expected no error opening %s, got: %v", mmap, name, err)
+			}
+			defer f.Close()
+			b, err := ioutil.ReadAll(f)
+			if err != nil {
+				t.Fatalf("mmap=%v: Expected no error reading %s, got: %v", mmap, name, err)
+			}
+			return string(b)
+		}
+
+		hits := memCacheHits()
+		for i := 0; i < 3; i++ {
+			if got := read("/a.css"); got != files["a.css"] {
+				t.Errorf("mmap=%v: Expected contents of a.css, got '%s'", mmap, got)
+			}
+		}
+		if fs.opens["/a.css"] != 1 {
+			t.Errorf("mmap=%v: Expected /a.css to be read from disk once, got %d", mmap, fs.opens["/a.css"])
+		}
+		if memCacheHits() != hits+2 {
+			t.Errorf("mmap=%v: Expected hits to be counted", mmap)
+		}
+		if e := cache.entries["/a.css"].Value.(*memEntry); e.mapped != mmap {
+			t.Errorf("mmap=%v: Expected mapped to be %v", mmap, mmap)
+		}
+
+		// files over the size ceiling are served from disk
+		if got := read("/big"); got != files["big"] {
+			t.Errorf("mmap=%v: Expected contents of big, got '%s'", mmap, got)
+		}
+		if _, ok := cache.entries["/big"]; ok {
+			t.Errorf("mmap=%v: Expected big file not to be cached", mmap)
+		}
+
+		// the least recently used files are dropped to stay in budget
+		read("/b.css")
+		read("/c.css")
+		if _, ok := cache.entries["/a.css"]; ok {
+			t.Errorf("mmap=%v: Expected /a.css to be dropped", mmap)
+		}
+		if cache.size != 80 {
+			t.Errorf("mmap=%v: Expected 80 bytes cached, got %d", mmap, cache.size)
+		}
+
+		// a file being read stays readable after it is dropped
+		f, _ := cache.Open("/b.css")
+		cache.Close()
+		if b, _ := ioutil.ReadAll(f); string(b) != files["b.css"] {
+			t.Errorf("mmap=%v: Expected dropped file in use to stay readable, got '%s'", mmap, b)
+		}
+		f.Close()
+		if cache.size != 0 || cache.lru.Len() != 0 {
+			t.Errorf("mmap=%v: Expected empty cache after Close, got %d bytes in %d files", mmap, cache.size, cache.lru.Len())
+		}
+	}
+}
+
+func TestMemCacheOverFileCache(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_memcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a.js"), []byte("alert(1)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := newFileCache(http.Dir(root), 10)
+	defer files.Close()
+	cache := newMemCache(files, 100, 100, true)
+	defer cache.Close()
+
+	f, err := cache.Open("/a.js")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer f.Close()
+	if b, _ := ioutil.ReadAll(f); string(b) != "alert(1)" {
+		t.Errorf("Expected 'alert(1)', got '%s'", b)
+	}
+}
+
+func memCacheHits() int64 {
+	if v, ok := MemCacheStats.Get("hits").(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestCachePurger(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_purge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a.css"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	purger := new(CachePurger)
+	purger.Purge() // not set up yet; must do nothing
+
+	vh := &virtualHost{config: Config{
+		Root:     root,
+		MemCache: MemCacheConfig{Enabled: true, MaxFileSize: 100},
+		Purger:   purger,
+	}}
+	if err := vh.buildStack(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := vh.mem.Open("/a.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if n := len(vh.mem.entries); n != 1 {
+		t.Fatalf("Expected 1 cached file, got %d", n)
+	}
+
+	purger.Purge()
+	if n := len(vh.mem.entries); n != 0 {
+		t.Errorf("Expected the cache to be purged, got %d files", n)
+	}
+}
+
+func TestLimitsBuildStack(t *testing.T) {
+	vh := &virtualHost{config: Config{
+		Root:     ".",
+		MemCache: MemCacheConfig{Enabled: true, MaxFileSize: 100},
+		Limits:   Limits{CacheMemory: 1000, OpenFiles: 10},
+	}}
+	if err := vh.buildStack(); err != nil {
+		t.Fatal(err)
+	}
+	if vh.files == nil || vh.files.max != 10 {
+		t.Errorf("Expected the file cache to keep 10 files open, got %+v", vh.files)
+	}
+	if vh.mem == nil || vh.mem.maxBytes != 1000 {
+		t.Errorf("Expected the memory cache to take 1000 bytes, got %+v", vh.mem)
+	}
+
+	vh = &virtualHost{config: Config{Root: ".", Limits: Limits{CacheMemory: 1000}}}
+	if err := vh.buildStack(); err == nil {
+		t.Error("Expected an error for cache_memory without memcache")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package server
+
+import "errors"
+
+func mmapFile(fd uintptr, size int64) ([]byte, error) {
+	return nil, errors.New("memory mapping not supported on this platform")
+}
+
+func munmapFile(data []byte) error {
+	return errors.New("memory mapping not supported on this platform")
+}
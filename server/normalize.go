@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// PathPolicy describes how the path of each request is normalized
+// before any middleware sees it, so that filters and rewrites can't
+// be bypassed by encoding a path differently. Percent-encoded
+// unreserved characters (letters, digits and -._~) are always
+// decoded and dot segments removed; what happens to the others
+// depends on Raw.
+type PathPolicy struct {
+	Enabled bool
+
+	// Match the path with the other characters still encoded,
+	// so that /a%2Fb doesn't match /a/b; otherwise they are
+	// decoded too, and matched (and proxied) as decoded
+	Raw bool
+
+	// Reject paths that decode to invalid (or over-long) UTF-8,
+	// a NUL, or a path that is still encoded (double encoding)
+	Reject bool
+}
+
+// normalize normalizes the path of r according to p. It returns
+// the request to serve, or nil if the request must be rejected.
+func (p PathPolicy) normalize(r *http.Request) *http.Request {
+	canonical, ok := canonicalEscape(r.URL.EscapedPath())
+	if !ok {
+		return nil
+	}
+	decoded, err := url.PathUnescape(canonical)
+	if err != nil {
+		return nil
+	}
+	if p.Reject && (!utf8.ValidString(decoded) || strings.ContainsRune(decoded, 0) || stillEncoded(decoded)) {
+		return nil
+	}
+
+	if p.Raw {
+		r.URL.Path, r.URL.RawPath = cleanPath(canonical), ""
+		return middleware.WithRawPath(r)
+	}
+	r.URL.Path, r.URL.RawPath = cleanPath(decoded), ""
+	return r
+}
+
+// canonicalEscape decodes the percent-encoded unreserved characters
+// in escaped, and writes the hex digits of the other encoded bytes in
+// upper case. It returns false if escaped has an invalid escape.
+func canonicalEscape(escaped string) (string, bool) {
+	if !strings.Contains(escaped, "%") {
+		return escaped, true
+	}
+	var b strings.Builder
+	for i := 0; i < len(escaped); i++ {
+		if escaped[i] != '%' {
+			b.WriteByte(escaped[i])
+			continue
+		}
+		if i+2 >= len(escaped) || !isHex(escaped[i+1]) || !isHex(escaped[i+2]) {
+			return "", false
+		}
+		c := unhex(escaped[i+1])<<4 | unhex(escaped[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString(strings.ToUpper(escaped[i : i+3]))
+		}
+		i += 2
+	}
+	return b.String(), true
+}
+
+// stillEncoded returns true if s has a percent-encoded byte.
+func stillEncoded(s string) bool {
+	for i := 0; i+2 < len(s); i++ {
+		if s[i] == '%' && isHex(s[i+1]) && isHex(s[i+2]) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanPath removes the dot segments and repeated slashes of p,
+// keeping a trailing slash.
+func cleanPath(p string) string {
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c <= '9':
+		return c - '0'
+	case c <= 'F':
+		return c - 'A' + 10
+	}
+	return c - 'a' + 10
+}
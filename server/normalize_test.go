@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestPathPolicy(t *testing.T) {
+	for i, test := range []struct {
+		policy       PathPolicy
+		uri          string
+		expectedPath string // "" if rejected
+		expectedRaw  bool
+	}{
+		{PathPolicy{}, "/%61dmin/x", "/admin/x", false},
+		{PathPolicy{}, "/public/../admin", "/admin", false},
+		{PathPolicy{}, "/public/%2e%2e/admin/", "/admin/", false},
+		{PathPolicy{}, "/a%2Fb", "/a/b", false},
+		{PathPolicy{}, "/a%20b//c", "/a b/c", false},
+		{PathPolicy{}, "/%252e%252e/admin", "/%2e%2e/admin", false},
+		{PathPolicy{Reject: true}, "/%252e%252e/admin", "", false},
+		{PathPolicy{Reject: true}, "/%c0%ae%c0%ae/admin", "", false}, // over-long "."
+		{PathPolicy{Reject: true}, "/a%00.php", "", false},
+		{PathPolicy{Reject: true}, "/caf%C3%A9", "/café", false},
+		{PathPolicy{Raw: true}, "/%61dmin/%2e%2e/x", "/x", true},
+		{PathPolicy{Raw: true}, "/a%2fb/c%20d", "/a%2Fb/c%20d", true},
+	} {
+		r := httptest.NewRequest("GET", test.uri, nil)
+		normalized := test.policy.normalize(r)
+		if test.expectedPath == "" {
+			if normalized != nil {
+				t.Errorf("Test %d: Expected %s to be rejected, got %s", i, test.uri, normalized.URL.Path)
+			}
+			continue
+		}
+		if normalized == nil {
+			t.Errorf("Test %d: Expected %s to be accepted", i, test.uri)
+			continue
+		}
+		if normalized.URL.Path != test.expectedPath {
+			t.Errorf("Test %d: Expected path %q, got %q", i, test.expectedPath, normalized.URL.Path)
+		}
+		if raw := middleware.IsRawPath(normalized); raw != test.expectedRaw {
+			t.Errorf("Test %d: Expected raw to be %v, got %v", i, test.expectedRaw, raw)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import "sync"
+
+// CachePurger drops the files held by the file server caches of
+// the site whose Config has it, such as after the site's files were
+// changed in a way the caches can't notice. Until the site is built,
+// and if it has no caches, Purge does nothing.
+type CachePurger struct {
+	mu    sync.Mutex
+	files *fileCache
+	mem   *memCache
+}
+
+// Purge drops all the files in the caches.
+func (p *CachePurger) Purge() {
+	p.mu.Lock()
+	files, mem := p.files, p.mem
+	p.mu.Unlock()
+	if mem != nil {
+		mem.Close()
+	}
+	if files != nil {
+		files.Close()
+	}
+}
+
+// set makes p purge the caches of vh.
+func (p *CachePurger) set(vh *virtualHost) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files, p.mem = vh.files, vh.mem
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RejectPolicy describes requests that are refused before any
+// middleware sees them, because their headers are malformed or
+// look like an attempt to smuggle a request past a proxy. Each
+// check is off while its status code is 0.
+type RejectPolicy struct {
+	// Requests whose Cookie headers are longer than
+	// CookieSize bytes in all
+	CookieSize     int64
+	CookieSizeCode int
+
+	// Requests whose header names and values are longer
+	// than HeaderSize bytes in all
+	HeaderSize     int64
+	HeaderSizeCode int
+
+	// Requests without a Host, which HTTP/1.0 allows
+	NoHostCode int
+
+	// Requests whose body length is ambiguous: those with
+	// a Transfer-Encoding but also a Content-Length, or in
+	// HTTP/1.0, which has no Transfer-Encoding, or with any
+	// other coding than a single chunked
+	TransferEncodingCode int
+
+	// Requests with any of these headers
+	Headers []RejectHeader
+}
+
+// RejectHeader describes a header that requests may not have.
+type RejectHeader struct {
+	Name    string
+	Pattern *regexp.Regexp // values to reject; any if nil
+	Code    int
+}
+
+// check returns the status code to reject r with,
+// or 0 if it may be served.
+func (p RejectPolicy) check(r *http.Request) int {
+	if p.NoHostCode != 0 && r.Host == "" {
+		return p.NoHostCode
+	}
+	if p.TransferEncodingCode != 0 && ambiguousLength(r) {
+		return p.TransferEncodingCode
+	}
+	if p.CookieSizeCode != 0 && headerSize(r.Header["Cookie"]) > p.CookieSize {
+		return p.CookieSizeCode
+	}
+	if p.HeaderSizeCode != 0 {
+		var size int64
+		for name, vals := range r.Header {
+			size += int64(len(name)*len(vals)) + headerSize(vals)
+		}
+		if size > p.HeaderSize {
+			return p.HeaderSizeCode
+		}
+	}
+	for _, h := range p.Headers {
+		for _, val := range r.Header[h.Name] {
+			if h.Pattern == nil || h.Pattern.MatchString(val) {
+				return h.Code
+			}
+		}
+	}
+	return 0
+}
+
+// ambiguousLength returns true if servers and proxies could
+// disagree on where the body of r ends.
+func ambiguousLength(r *http.Request) bool {
+	te := r.TransferEncoding
+	if len(te) == 0 {
+		te = r.Header["Transfer-Encoding"]
+	}
+	if len(te) == 0 {
+		return false
+	}
+	if !r.ProtoAtLeast(1, 1) || len(r.Header["Content-Length"]) > 0 {
+		return true
+	}
+	return len(te) != 1 || !strings.EqualFold(strings.TrimSpace(te[0]), "chunked")
+}
+
+// headerSize returns the length of vals in all.
+func headerSize(vals []string) int64 {
+	var size int64
+	for _, val := range vals {
+		size += int64(len(val))
+	}
+	return size
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRejectPolicy(t *testing.T) {
+	p := RejectPolicy{
+		CookieSize:           16,
+		CookieSizeCode:       http.StatusRequestHeaderFieldsTooLarge,
+		HeaderSize:           256,
+		HeaderSizeCode:       http.StatusRequestHeaderFieldsTooLarge,
+		NoHostCode:           http.StatusBadRequest,
+		TransferEncodingCode: http.StatusBadRequest,
+		Headers: []RejectHeader{
+			{Name: "X-Debug", Code: http.StatusForbidden},
+			{Name: "User-Agent", Pattern: regexp.MustCompile(`(?i)sqlmap`), Code: http.StatusForbidden},
+		},
+	}
+
+	for i, test := range []struct {
+		setup    func(r *http.Request)
+		expected int
+	}{
+		{func(r *http.Request) {}, 0},
+		{func(r *http.Request) { r.Header.Set("Cookie", "a=1; b=2") }, 0},
+		{func(r *http.Request) { r.Header.Set("Cookie", "session=0123456789abcdef") }, http.StatusRequestHeaderFieldsTooLarge},
+		{func(r *http.Request) { r.Header.Set("X-Padding", strings.Repeat("x", 256)) }, http.StatusRequestHeaderFieldsTooLarge},
+		{func(r *http.Request) { r.Host = "" }, http.StatusBadRequest},
+		{func(r *http.Request) { r.TransferEncoding = []string{"chunked"} }, 0},
+		{func(r *http.Request) {
+			r.TransferEncoding = []string{"chunked"}
+			r.Header.Set("Content-Length", "5")
+		}, http.StatusBadRequest},
+		{func(r *http.Request) { r.TransferEncoding = []string{"gzip", "chunked"} }, http.StatusBadRequest},
+		{func(r *http.Request) {
+			r.Proto, r.ProtoMajor, r.ProtoMinor = "HTTP/1.0", 1, 0
+			r.Header.Set("Transfer-Encoding", "chunked")
+		}, http.StatusBadRequest},
+		{func(r *http.Request) { r.Header.Set("X-Debug", "") }, http.StatusForbidden},
+		{func(r *http.Request) { r.Header.Set("User-Agent", "Mozilla/5.0") }, 0},
+		{func(r *http.Request) { r.Header.Set("User-Agent", "sqlmap/1.4") }, http.StatusForbidden},
+	} {
+		r := httptest.NewRequest("POST", "/", nil)
+		test.setup(r)
+		if actual := p.check(r); actual != test.expected {
+			t.Errorf("Test %d: Expected status %d, got %d", i, test.expected, actual)
+		}
+	}
+
+	if status := (RejectPolicy{}).check(httptest.NewRequest("GET", "/", nil)); status != 0 {
+		t.Errorf("Expected no checks by default, got status %d", status)
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+// scopeRouter sends each request through the chain of the longest
+// path scope that it is under, or to next, the chain of the site,
+// if it is under none of them.
+type scopeRouter struct {
+	scopes []string // longest first
+	chains map[string]middleware.Handler
+	next   middleware.Handler
+}
+
+// ServeHTTP implements the middleware.Handler interface.
+func (sr *scopeRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	for _, scope := range sr.scopes {
+		if middleware.Path(r.URL.Path).Matches(scope) {
+			return sr.chains[scope].ServeHTTP(w, r)
+		}
+	}
+	return sr.next.ServeHTTP(w, r)
+}
+
+// sort orders the scopes so that the longest match comes first.
+func (sr *scopeRouter) sort() {
+	sort.Slice(sr.scopes, func(i, j int) bool {
+		if len(sr.scopes[i]) != len(sr.scopes[j]) {
+			return len(sr.scopes[i]) > len(sr.scopes[j])
+		}
+		return sr.scopes[i] < sr.scopes[j]
+	})
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestScopeRouter(t *testing.T) {
+	var trace []string
+	builds := make(map[string]int)
+	layer := func(name string, scopes ...string) middleware.Middleware {
+		return func(next middleware.Handler) middleware.Handler {
+			builds[name]++
+			l := tracedLayer{name: name, next: next, trace: &trace}
+			if scopes == nil {
+				return l
+			}
+			return scopedLayer{l, scopes}
+		}
+	}
+
+	assets := []middleware.Middleware{layer("gzip"), layer("expires")}
+	vh := &virtualHost{
+		config: Config{
+			Middleware: map[string][]middleware.Middleware{
+				"/":           {layer("log"), layer("proxy", "/api")},
+				"/api":        {layer("errors")},
+				"/api/public": {layer("cors")},
+				"/static":     assets,
+				"/assets":     assets,
+			},
+			Guards: []middleware.Middleware{layer("access")},
+		},
+		fileServer: middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			trace = append(trace, "files")
+			return http.StatusOK, nil
+		}),
+	}
+	vh.compile(vh.config.Middleware["/"])
+
+	for i, test := range []struct {
+		path     string
+		expected string
+	}{
+		{"/index.html", "access log files"},
+		{"/api/users", "access errors files"},
+		{"/api/public/feed", "access cors files"},
+		{"/static/app.js", "access gzip expires files"},
+		{"/assets/logo.png", "access gzip expires files"},
+	} {
+		trace = nil
+		r := httptest.NewRequest("GET", test.path, nil)
+		vh.stack.ServeHTTP(httptest.NewRecorder(), r)
+		if got := strings.Join(trace, " "); got != test.expected {
+			t.Errorf("Test %d: Expected %s to go through '%s', got '%s'", i, test.path, test.expected, got)
+		}
+	}
+
+	if builds["log"] != 1 || builds["access"] != 1 {
+		t.Errorf("Expected the site's layers and guards to be built once, got %v", builds)
+	}
+}
@@ -4,6 +4,7 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
@@ -13,8 +14,12 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"time"
 
 	"github.com/bradfitz/http2"
+	"github.com/mholt/caddy/middleware"
+	"github.com/mholt/caddy/server/acme"
 )
 
 // Server represents an instance of a server, which serves
@@ -24,6 +29,10 @@ type Server struct {
 	address string                 // the actual address for net.Listen to listen on
 	tls     bool                   // whether this server is serving all HTTPS hosts or not
 	vhosts  map[string]virtualHost // virtual hosts keyed by their address
+	mu      sync.RWMutex           // protects vhosts
+	conns   int64                  // open client connections
+
+	listener net.Listener // bound by Listen, if it was called
 }
 
 // New creates a new Server which will bind to addr and serve
@@ -60,11 +69,176 @@ func New(addr string, configs []Config) (*Server, error) {
 	return s, nil
 }
 
+// Address returns the address the server listens on.
+func (s *Server) Address() string {
+	return s.address
+}
+
+// FileConfigs returns the configurations of the sites
+// that were loaded from the configuration file configFile.
+func (s *Server) FileConfigs(configFile string) []Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var configs []Config
+	for _, vh := range s.vhosts {
+		if vh.config.ConfigFile == configFile {
+			configs = append(configs, vh.config)
+		}
+	}
+	return configs
+}
+
+// ReplaceFile replaces the virtual hosts that were loaded from
+// the configuration file configFile with the ones in configs,
+// leaving hosts from other files alone. This is how a single
+// site's configuration is reloaded without a restart. If any
+// of configs can't be set up, nothing is replaced. HTTPS
+// redirects (see Config.HTTPSRedirect) give way to the sites
+// of other files: one from configFile is left out if another
+// file's site has its host, and one from another file is
+// replaced by a site of configFile with the same host.
+//
+// The new hosts serve requests as soon as ReplaceFile returns,
+// but the old ones are kept until the returned Replacement is
+// committed, so that the swap can still be undone if reloading
+// the same file fails on another server.
+func (s *Server) ReplaceFile(configFile string, configs []Config) (*Replacement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vhosts := make(map[string]virtualHost)
+	for host, vh := range s.vhosts {
+		if vh.config.ConfigFile != configFile {
+			vhosts[host] = vh
+		}
+	}
+
+	var added, yielded []virtualHost
+	fail := func(err error) (*Replacement, error) {
+		for _, vh := range added {
+			vh.close()
+		}
+		return nil, err
+	}
+
+	for _, conf := range configs {
+		if conf.ConfigFile != configFile {
+			return fail(fmt.Errorf("cannot serve %s - not loaded from %s", conf.Address(), configFile))
+		}
+		if s.tls || conf.TLS.Enabled {
+			// certificates are only loaded when the listener starts
+			return fail(fmt.Errorf("cannot reload %s - HTTPS sites require a restart", conf.Address()))
+		}
+		if other, exists := vhosts[conf.Host]; exists {
+			switch {
+			case conf.HTTPSRedirect:
+				continue // the site of another file serves the host
+			case other.config.HTTPSRedirect:
+				yielded = append(yielded, other) // the redirect of another file gives way
+			default:
+				return fail(fmt.Errorf("cannot serve %s - host already defined for address %s", conf.Address(), s.address))
+			}
+		}
+
+		vh := virtualHost{config: conf}
+		err := vh.buildStack()
+		if err != nil {
+			return fail(err)
+		}
+
+		vhosts[conf.Host] = vh
+		added = append(added, vh)
+	}
+
+	for _, conf := range configs {
+		for _, start := range conf.Startup {
+			err := start()
+			if err != nil {
+				return fail(err)
+			}
+		}
+	}
+
+	r := &Replacement{server: s, old: s.vhosts, new: added, replaced: yielded}
+	for _, vh := range s.vhosts {
+		if vh.config.ConfigFile == configFile {
+			r.replaced = append(r.replaced, vh)
+		}
+	}
+	s.vhosts = vhosts
+	return r, nil
+}
+
+// Replacement is a swap of virtual hosts made by ReplaceFile
+// that is not final yet. Exactly one of Commit or Rollback
+// must be called on it.
+type Replacement struct {
+	server   *Server
+	old      map[string]virtualHost // all hosts before the swap
+	replaced []virtualHost          // hosts that were swapped out
+	new      []virtualHost          // hosts that were swapped in
+}
+
+// Commit makes the swap final. The admin API forgets the hosts
+// that were replaced and learns of the new ones. The replaced
+// hosts are shut down and released in the background, once the
+// requests they are still handling are done (see DrainTimeout),
+// and the new ones are warmed up.
+func (r *Replacement) Commit() {
+	for _, vh := range r.replaced {
+		vh.unpublish()
+	}
+	for _, vh := range r.new {
+		vh.publish()
+	}
+	for _, vh := range r.replaced {
+		go vh.retire()
+	}
+	go r.server.warmup(r.new)
+}
+
+// Rollback puts the hosts that were replaced back in service,
+// and shuts down and releases the new ones once the requests
+// they got in the meantime are done. The new hosts were never
+// published, so the admin API still reports on the old ones.
+func (r *Replacement) Rollback() {
+	r.server.mu.Lock()
+	r.server.vhosts = r.old
+	r.server.mu.Unlock()
+	for _, vh := range r.new {
+		go vh.retire()
+	}
+}
+
+// Listen binds the server's address without serving it yet,
+// so that an address that is in use can be reported before
+// anything else is changed. Serve listens by itself if Listen
+// was not called first.
+func (s *Server) Listen() error {
+	ln, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return err
+	}
+	s.listener = ln
+	return nil
+}
+
+// Close closes the listener bound by Listen, for a
+// server that will not be served after all.
+func (s *Server) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
 // Serve starts the server. It blocks until the server quits.
 func (s *Server) Serve() error {
 	server := &http.Server{
-		Addr:    s.address,
-		Handler: s,
+		Addr:        s.address,
+		Handler:     s,
+		ConnContext: withConn,
+		ConnState:   s.connState,
 	}
 
 	if s.HTTP2 {
@@ -72,7 +246,15 @@ func (s *Server) Serve() error {
 		http2.ConfigureServer(server, nil)
 	}
 
-	for _, vh := range s.vhosts {
+	// TODO: Serve HTTP/3 (an http3 option per site, answering on UDP at
+	// the same port and advertised with Alt-Svc) once a QUIC transport
+	// can be vendored; neither the std lib nor our dependencies have one
+
+	s.mu.RLock()
+	vhosts := s.vhosts
+	s.mu.RUnlock()
+
+	for _, vh := range vhosts {
 		// Execute startup functions now
 		for _, start := range vh.config.Startup {
 			err := start()
@@ -98,14 +280,39 @@ func (s *Server) Serve() error {
 		}
 	}
 
+	if s.listener == nil {
+		err := s.Listen()
+		if err != nil {
+			return err
+		}
+	}
+
+	var warmups []virtualHost
+	for _, vh := range vhosts {
+		vh.publish()
+		warmups = append(warmups, vh)
+	}
+	go s.warmup(warmups)
+
 	if s.tls {
+		getCertificate, err := manageCertificates(vhosts)
+		if err != nil {
+			return err
+		}
+		if getCertificate != nil {
+			if server.TLSConfig == nil {
+				server.TLSConfig = new(tls.Config)
+			}
+			server.TLSConfig.GetCertificate = getCertificate
+		}
+
 		var tlsConfigs []TLSConfig
-		for _, vh := range s.vhosts {
+		for _, vh := range vhosts {
 			tlsConfigs = append(tlsConfigs, vh.config.TLS)
 		}
-		return ListenAndServeTLSWithSNI(server, tlsConfigs)
+		return serveTLSWithSNI(server, s.listener, tlsConfigs)
 	}
-	return server.ListenAndServe()
+	return server.Serve(s.listener)
 }
 
 // ListenAndServeTLSWithSNI serves TLS with Server Name Indication (SNI) support, which allows
@@ -118,6 +325,16 @@ func ListenAndServeTLSWithSNI(srv *http.Server, tlsConfigs []TLSConfig) error {
 		addr = ":https"
 	}
 
+	conn, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return serveTLSWithSNI(srv, conn, tlsConfigs)
+}
+
+// serveTLSWithSNI is like ListenAndServeTLSWithSNI,
+// but serves on the listener conn.
+func serveTLSWithSNI(srv *http.Server, conn net.Listener, tlsConfigs []TLSConfig) error {
 	config := new(tls.Config)
 	if srv.TLSConfig != nil {
 		*config = *srv.TLSConfig
@@ -128,13 +345,18 @@ func ListenAndServeTLSWithSNI(srv *http.Server, tlsConfigs []TLSConfig) error {
 
 	// Here we diverge from the stdlib a bit by loading multiple certs/key pairs
 	// then we map the server names to their certs
-	var err error
-	config.Certificates = make([]tls.Certificate, len(tlsConfigs))
-	for i, tlsConfig := range tlsConfigs {
-		config.Certificates[i], err = tls.LoadX509KeyPair(tlsConfig.Certificate, tlsConfig.Key)
+	// Managed certificates are served by config.GetCertificate
+	config.Certificates = nil
+	for _, tlsConfig := range tlsConfigs {
+		if tlsConfig.Managed() {
+			continue
+		}
+		cert, err := tls.LoadX509KeyPair(tlsConfig.Certificate, tlsConfig.Key)
 		if err != nil {
+			conn.Close()
 			return err
 		}
+		config.Certificates = append(config.Certificates, cert)
 	}
 	config.BuildNameToCertificate()
 
@@ -145,16 +367,13 @@ func ListenAndServeTLSWithSNI(srv *http.Server, tlsConfigs []TLSConfig) error {
 	config.PreferServerCipherSuites = tlsConfigs[0].PreferServerCipherSuites
 
 	// TLS client authentication, if user enabled it
-	err = setupClientAuth(tlsConfigs, config)
+	err := setupClientAuth(tlsConfigs, config)
 	if err != nil {
+		conn.Close()
 		return err
 	}
 
-	// Create listener and we're on our way
-	conn, err := net.Listen("tcp", addr)
-	if err != nil {
-		return err
-	}
+	// Wrap the listener and we're on our way
 	tlsListener := tls.NewListener(conn, config)
 
 	return srv.Serve(tlsListener)
@@ -196,10 +415,28 @@ func setupClientAuth(tlsConfigs []TLSConfig, config *tls.Config) error {
 // defined in the Host header so that the correct virtualhost
 // (configuration and middleware stack) will handle the request.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The CA may check that we control any of our sites
+	if acme.DefaultChallenges.ServeHTTP(w, r) {
+		return
+	}
+
+	var site *Config // once it is known
 	defer func() {
 		// In case the user doesn't enable error middleware, we still
-		// need to make sure that we stay alive up here
+		// need to make sure that we stay alive up here, unless the
+		// site's panic policy says otherwise
 		if rec := recover(); rec != nil {
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			policy, name := middleware.PanicRecover, s.address
+			if site != nil {
+				policy, name = site.PanicPolicy, site.Address()
+			}
+			if policy != middleware.PanicRecover {
+				log.Printf("[PANIC %s] %v (panic policy: %s)", r.URL, rec, policy)
+			}
+			policy.Handle(name)
 			http.Error(w, http.StatusText(http.StatusInternalServerError),
 				http.StatusInternalServerError)
 		}
@@ -210,23 +447,58 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		host = r.Host // oh well
 	}
 
+	s.mu.RLock()
+	vhosts := s.vhosts
+	s.mu.RUnlock()
+
 	// Try the host as given, or try falling back to 0.0.0.0 (wildcard)
-	if _, ok := s.vhosts[host]; !ok {
-		if _, ok2 := s.vhosts["0.0.0.0"]; ok2 {
+	if _, ok := vhosts[host]; !ok {
+		if _, ok2 := vhosts["0.0.0.0"]; ok2 {
 			host = "0.0.0.0"
-		} else if _, ok2 := s.vhosts[""]; ok2 {
+		} else if _, ok2 := vhosts[""]; ok2 {
 			host = ""
 		}
 	}
 
-	if vh, ok := s.vhosts[host]; ok {
+	if vh, ok := vhosts[host]; ok {
+		site = &vh.config
+		if vh.config.Paths.Enabled {
+			normalized := vh.config.Paths.normalize(r)
+			if normalized == nil {
+				DefaultErrorFunc(w, r, http.StatusBadRequest)
+				return
+			}
+			r = normalized
+		}
+		if status := vh.config.Reject.check(r); status != 0 {
+			// what follows on the connection may not be
+			// where the client meant, so it is closed
+			w.Header().Set("Connection", "close")
+			DefaultErrorFunc(w, r, status)
+			return
+		}
+		vh.requests.add()
+		defer vh.requests.done()
 		w.Header().Set("Server", "Caddy")
 
-		status, _ := vh.stack.ServeHTTP(w, r)
+		// The request's context is canceled when the client goes
+		// away or the request takes too long, so that handlers
+		// can stop working on it
+		if timeout := vh.config.Limits.RequestTimeout; timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		vh.stats.start(time.Now())
+		defer func() { vh.stats.done(sw.status) }()
+
+		status, _ := vh.stack.ServeHTTP(sw, r)
 
 		// Fallback error response in case error handling wasn't chained in
-		if status >= 400 {
-			DefaultErrorFunc(w, r, status)
+		if status >= 400 && status != middleware.StatusClientClosedRequest {
+			DefaultErrorFunc(sw, r, status)
 		}
 	} else {
 		w.WriteHeader(http.StatusNotFound)
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReplaceFile(t *testing.T) {
+	s, err := New("localhost:0", []Config{
+		{Host: "a.com", Port: "80", Root: ".", ConfigFile: "a.conf"},
+		{Host: "b.com", Port: "80", Root: ".", ConfigFile: "b.conf"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	hosts := func() map[string]string {
+		m := make(map[string]string)
+		for host, vh := range s.vhosts {
+			m[host] = vh.config.ConfigFile
+		}
+		return m
+	}
+
+	// a failed replacement changes nothing
+	_, err = s.ReplaceFile("a.conf", []Config{
+		{Host: "b.com", Port: "80", Root: ".", ConfigFile: "a.conf"},
+	})
+	if err == nil {
+		t.Error("Expected an error replacing a host defined by another file")
+	}
+	if h := hosts(); len(h) != 2 || h["a.com"] != "a.conf" || h["b.com"] != "b.conf" {
+		t.Errorf("Expected hosts to be unchanged, got %v", h)
+	}
+
+	// a rolled back replacement puts the old hosts back
+	r, err := s.ReplaceFile("a.conf", []Config{
+		{Host: "c.com", Port: "80", Root: ".", ConfigFile: "a.conf"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if h := hosts(); len(h) != 2 || h["c.com"] != "a.conf" {
+		t.Errorf("Expected c.com to be served before the replacement is final, got %v", h)
+	}
+	r.Rollback()
+	if h := hosts(); len(h) != 2 || h["a.com"] != "a.conf" {
+		t.Errorf("Expected a.com to be back after rollback, got %v", h)
+	}
+
+	// a committed one keeps the new hosts
+	r, err = s.ReplaceFile("a.conf", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	r.Commit()
+	if h := hosts(); len(h) != 1 || h["b.com"] != "b.conf" {
+		t.Errorf("Expected only b.com after removing a.conf's sites, got %v", h)
+	}
+}
+
+func TestReplaceFileRedirects(t *testing.T) {
+	s, err := New("localhost:0", []Config{
+		{Host: "a.com", Port: "80", Root: ".", ConfigFile: "a.conf", HTTPSRedirect: true},
+		{Host: "b.com", Port: "80", Root: ".", ConfigFile: "b.conf"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// a redirect gives way to the site of another file...
+	r, err := s.ReplaceFile("c.conf", []Config{
+		{Host: "a.com", Port: "80", Root: ".", ConfigFile: "c.conf"},
+		{Host: "b.com", Port: "80", Root: ".", ConfigFile: "c.conf", HTTPSRedirect: true},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	r.Commit()
+	if vh := s.vhosts["a.com"]; vh.config.ConfigFile != "c.conf" || vh.config.HTTPSRedirect {
+		t.Errorf("Expected c.conf's site to replace a.conf's redirect, got %+v", vh.config)
+	}
+	// ...and is left out if another file's site has the host
+	if vh := s.vhosts["b.com"]; vh.config.ConfigFile != "b.conf" || vh.config.HTTPSRedirect {
+		t.Errorf("Expected b.conf's site to be kept, got %+v", vh.config)
+	}
+}
+
+func TestReplaceFilePublish(t *testing.T) {
+	published := make(map[string]string)
+	site := func(host, version string) Config {
+		return Config{
+			Host: host, Port: "80", Root: ".", ConfigFile: "a.conf",
+			Publish:   []func(){func() { published[host] = version }},
+			Unpublish: []func(){func() { delete(published, host) }},
+		}
+	}
+	s, err := New("localhost:0", []Config{site("a.com", "old")})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for _, vh := range s.vhosts {
+		vh.publish()
+	}
+
+	// a rolled back replacement leaves the old site published
+	r, err := s.ReplaceFile("a.conf", []Config{site("a.com", "new")})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if published["a.com"] != "old" {
+		t.Errorf("Expected the old site to stay published until commit, got %v", published)
+	}
+	r.Rollback()
+	if len(published) != 1 || published["a.com"] != "old" {
+		t.Errorf("Expected the old site to be published after rollback, got %v", published)
+	}
+
+	// a committed one swaps the sites
+	r, err = s.ReplaceFile("a.conf", []Config{site("a.com", "new"), site("b.com", "new")})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	r.Commit()
+	if len(published) != 2 || published["a.com"] != "new" || published["b.com"] != "new" {
+		t.Errorf("Expected the new sites to be published after commit, got %v", published)
+	}
+	r, err = s.ReplaceFile("a.conf", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	r.Commit()
+	if len(published) != 0 {
+		t.Errorf("Expected removed sites to be forgotten, got %v", published)
+	}
+}
+
+func TestListen(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	s, err := New(ln.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := s.Listen(); err == nil {
+		s.Close()
+		t.Error("Expected an error listening on an address in use")
+	}
+
+	s, err = New("localhost:0", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := s.Listen(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Expected no error closing, got: %v", err)
+	}
+}
+
+func TestReplaceFileDrains(t *testing.T) {
+	shutdown := make(chan struct{})
+	s, err := New("localhost:0", []Config{{
+		Host: "a.com", Port: "80", Root: ".", ConfigFile: "a.conf",
+		Shutdown: []func() error{func() error { close(shutdown); return nil }},
+	}})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// a request that is still running on the old host
+	vh := s.vhosts["a.com"]
+	vh.requests.add()
+
+	r, err := s.ReplaceFile("a.conf", []Config{{Host: "a.com", Port: "80", Root: ".", ConfigFile: "a.conf"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	r.Commit()
+
+	select {
+	case <-shutdown:
+		t.Fatal("Expected the old host to wait for its request before shutting down")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	vh.requests.done()
+	select {
+	case <-shutdown:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the old host to shut down once its request was done")
+	}
+}
+
+func TestInflightWaitTimeout(t *testing.T) {
+	var f inflight
+	if !f.wait(time.Millisecond) {
+		t.Error("Expected no requests to need no waiting")
+	}
+	f.add()
+	if f.wait(10 * time.Millisecond) {
+		t.Error("Expected waiting for a running request to time out")
+	}
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SiteStats is a snapshot of a site's traffic since it was last
+// (re)loaded, for the dashboard.
+type SiteStats struct {
+	Site     string
+	Requests int64
+	Active   int64    // requests being handled now
+	Statuses [5]int64 // responses by class: 1xx, 2xx, 3xx, 4xx, 5xx
+	Rate     float64  // requests per second over the last minute
+
+	// When the site's certificate expires; zero if the
+	// site isn't served over HTTPS
+	CertExpiry time.Time
+}
+
+// siteCounters counts a virtual host's requests.
+type siteCounters struct {
+	requests   int64
+	active     int64
+	statuses   [5]int64
+	certExpiry time.Time
+
+	mu      sync.Mutex
+	seconds [60]int64 // the second each count is for
+	counts  [60]int64 // requests started in that second
+}
+
+func newSiteCounters(config Config) *siteCounters {
+	sc := new(siteCounters)
+	if config.TLS.Enabled {
+		sc.certExpiry, _ = certExpiry(config.TLS.Certificate)
+	}
+	return sc
+}
+
+// start counts a request as it begins.
+func (sc *siteCounters) start(now time.Time) {
+	atomic.AddInt64(&sc.requests, 1)
+	atomic.AddInt64(&sc.active, 1)
+
+	sec := now.Unix()
+	i := sec % 60
+	sc.mu.Lock()
+	if sc.seconds[i] != sec {
+		sc.seconds[i], sc.counts[i] = sec, 0
+	}
+	sc.counts[i]++
+	sc.mu.Unlock()
+}
+
+// done counts a request that was responded to with status.
+func (sc *siteCounters) done(status int) {
+	atomic.AddInt64(&sc.active, -1)
+	if class := status/100 - 1; class >= 0 && class < len(sc.statuses) {
+		atomic.AddInt64(&sc.statuses[class], 1)
+	}
+}
+
+// rate returns the requests per second over the minute before now.
+func (sc *siteCounters) rate(now time.Time) float64 {
+	sec := now.Unix()
+	var n int64
+	sc.mu.Lock()
+	for i, s := range sc.seconds {
+		if s > sec-60 && s < sec {
+			n += sc.counts[i]
+		}
+	}
+	sc.mu.Unlock()
+	return float64(n) / 59
+}
+
+func (sc *siteCounters) snapshot(site string, now time.Time) SiteStats {
+	stats := SiteStats{
+		Site:       site,
+		Requests:   atomic.LoadInt64(&sc.requests),
+		Active:     atomic.LoadInt64(&sc.active),
+		Rate:       sc.rate(now),
+		CertExpiry: sc.certExpiry,
+	}
+	for i := range sc.statuses {
+		stats.Statuses[i] = atomic.LoadInt64(&sc.statuses[i])
+	}
+	return stats
+}
+
+// certExpiry returns when the first certificate in
+// the PEM file certFile expires.
+func certExpiry(certFile string) (time.Time, error) {
+	data, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return time.Time{}, errors.New("no certificate in " + certFile)
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return cert.NotAfter, nil
+	}
+}
+
+// Stats returns a snapshot of the traffic of each site the
+// server serves, sorted by site address.
+func (s *Server) Stats() []SiteStats {
+	s.mu.RLock()
+	vhosts := s.vhosts
+	s.mu.RUnlock()
+
+	now := time.Now()
+	var stats []SiteStats
+	for _, vh := range vhosts {
+		if vh.stats != nil {
+			stats = append(stats, vh.stats.snapshot(vh.config.Address(), now))
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Site < stats[j].Site })
+	return stats
+}
+
+// Connections returns how many client connections are open.
+func (s *Server) Connections() int64 {
+	return atomic.LoadInt64(&s.conns)
+}
+
+// connState keeps count of the open connections.
+func (s *Server) connState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		atomic.AddInt64(&s.conns, 1)
+	case http.StateHijacked, http.StateClosed:
+		atomic.AddInt64(&s.conns, -1)
+	}
+}
+
+// statusWriter records the status of the response written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 && (status >= 200 || status == http.StatusSwitchingProtocols) {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// ReadFrom lets the underlying writer use sendfile if it can.
+func (w *statusWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(struct{ io.Writer }{w.ResponseWriter}, src)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("response writer can't be hijacked")
+}
+
+func (w *statusWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return nil
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
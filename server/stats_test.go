@@ -0,0 +1,58 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	root, err := ioutil.TempDir("", "caddy_stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "index.html"), []byte("hi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New("127.0.0.1:0", []Config{{Host: "localhost", Port: "2015", Root: root}})
+	if err != nil {
+		t.Fatalf("Expected no error creating server, got: %v", err)
+	}
+	for _, path := range []string{"/index.html", "/index.html", "/missing"} {
+		r, _ := http.NewRequest("GET", "http://localhost"+path, nil)
+		s.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	stats := s.Stats()
+	if len(stats) != 1 {
+		t.Fatalf("Expected stats for 1 site, got %d", len(stats))
+	}
+	site := stats[0]
+	if site.Site != "localhost:2015" {
+		t.Errorf("Expected site localhost:2015, got %s", site.Site)
+	}
+	if site.Requests != 3 || site.Active != 0 {
+		t.Errorf("Expected 3 requests and none in flight, got %d and %d", site.Requests, site.Active)
+	}
+	if site.Statuses != [5]int64{0, 2, 0, 1, 0} {
+		t.Errorf("Expected 2 2xx and 1 4xx responses, got %v", site.Statuses)
+	}
+	if !site.CertExpiry.IsZero() {
+		t.Errorf("Expected no certificate expiry for an HTTP site, got %v", site.CertExpiry)
+	}
+
+	// requests count towards the rate for a minute
+	later := time.Now().Add(time.Second)
+	if rate := s.vhosts["localhost"].stats.rate(later); rate != 3.0/59 {
+		t.Errorf("Expected a rate of 3 requests a minute, got %v/s", rate)
+	}
+	if rate := s.vhosts["localhost"].stats.rate(later.Add(time.Minute)); rate != 0 {
+		t.Errorf("Expected a rate of 0 a minute later, got %v/s", rate)
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// mediaTypes are the content types of the video and audio files
+// that players stream with range requests. They are set here, and
+// not left to the system's MIME tables, which often lack them, or
+// to content sniffing, which can't tell what a range of them is.
+var mediaTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".m4a":  "audio/mp4",
+	".mov":  "video/quicktime",
+	".webm": "video/webm",
+	".ogv":  "video/ogg",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".mp3":  "audio/mpeg",
+	".flac": "audio/flac",
+}
+
+// numRanges returns how many byte ranges the Range header
+// value h asks for, or 0 if it isn't a byte range.
+func numRanges(h string) int {
+	if !strings.HasPrefix(h, "bytes=") {
+		return 0
+	}
+	n := 0
+	for _, spec := range strings.Split(h[len("bytes="):], ",") {
+		if strings.TrimSpace(spec) != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// streamLimiter limits how many range requests each client
+// may be streaming at once. A nil *streamLimiter allows any.
+type streamLimiter struct {
+	mu    sync.Mutex
+	max   int
+	count map[string]int
+}
+
+// newStreamLimiter returns a streamLimiter that allows max
+// streams per client, or nil if max is 0.
+func newStreamLimiter(max int) *streamLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &streamLimiter{max: max, count: make(map[string]int)}
+}
+
+// acquire returns true and counts a stream for the client
+// of r if it may start one; release must be called with the
+// same request when the stream is done.
+func (l *streamLimiter) acquire(r *http.Request) bool {
+	if l == nil {
+		return true
+	}
+	ip := remoteIP(r)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.count[ip] >= l.max {
+		return false
+	}
+	l.count[ip]++
+	return true
+}
+
+func (l *streamLimiter) release(r *http.Request) {
+	if l == nil {
+		return
+	}
+	ip := remoteIP(r)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.count[ip]--; l.count[ip] <= 0 {
+		delete(l.count, ip)
+	}
+}
+
+// remoteIP returns the IP address of the client of r.
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// readAheadFile reads a file in blocks of at least the size of
+// its buffer, so that the small reads of a stream (and the seeks
+// between the ranges of a request) become fewer, larger ones.
+type readAheadFile struct {
+	f io.ReadSeeker
+	r *bufio.Reader
+}
+
+func newReadAheadFile(f io.ReadSeeker, size int) *readAheadFile {
+	return &readAheadFile{f: f, r: bufio.NewReaderSize(f, size)}
+}
+
+func (ra *readAheadFile) Read(p []byte) (int, error) {
+	return ra.r.Read(p)
+}
+
+func (ra *readAheadFile) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekCurrent {
+		// the file is ahead of the reader by what's buffered
+		offset -= int64(ra.r.Buffered())
+	}
+	pos, err := ra.f.Seek(offset, whence)
+	ra.r.Reset(ra.f)
+	return pos, err
+}
@@ -1,7 +1,7 @@
 package server
 
 import (
-	"net/http"
+	"fmt"
 
 	"github.com/mholt/caddy/middleware"
 )
@@ -14,28 +14,162 @@ type virtualHost struct {
 	config     Config
 	fileServer middleware.Handler
 	stack      middleware.Handler
+	files      *fileCache // open files kept by the file server, if any
+	mem        *memCache  // files kept in memory by the file server, if any
+	stats      *siteCounters
+	requests   *inflight // requests being handled, to drain on reload
+	warm       *warmth   // whether the warm-up requests are done
 }
 
 // buildStack builds the server's middleware stack based
 // on its config. This method should be called last before
 // ListenAndServe begins.
 func (vh *virtualHost) buildStack() error {
-	vh.fileServer = FileServer(http.Dir(vh.config.Root), []string{vh.config.ConfigFile})
+	vh.stats = newSiteCounters(vh.config)
+	vh.requests = new(inflight)
+	vh.warm = new(warmth)
+	if len(vh.config.Warmup) == 0 {
+		vh.warm.finish()
+	}
+
+	// the memory cache is the only one cache_memory limits
+	if vh.config.Limits.CacheMemory > 0 && !vh.config.MemCache.Enabled {
+		return fmt.Errorf("%s: limits cache_memory needs memcache to be enabled", vh.config.Address())
+	}
+
+	fs := vh.config.FileSystem()
+	if n := vh.config.Limits.OpenFiles; n > 0 {
+		vh.files = newFileCache(fs, n)
+		fs = vh.files
+	}
+	if mc := vh.config.MemCache; mc.Enabled {
+		maxBytes := vh.config.Limits.CacheMemory
+		if maxBytes == 0 {
+			maxBytes = DefaultCacheMemory
+		}
+		vh.mem = newMemCache(fs, mc.MaxFileSize, maxBytes, mc.Mmap)
+		fs = vh.mem
+	}
+	if vh.config.Purger != nil {
+		vh.config.Purger.set(vh)
+	}
+	hide := []string{vh.config.ConfigFile}
+	if vh.config.MetadataFile != "" {
+		hide = append(hide, vh.config.MetadataFile)
+	}
+	vh.fileServer = &fileHandler{
+		root:      fs,
+		hide:      hide,
+		files:     vh.config.Files,
+		metadata:  vh.config.MetadataFile,
+		downloads: vh.config.Downloads,
+		streams:   newStreamLimiter(vh.config.Downloads.Streams),
+	}
 
-	// TODO: We only compile middleware for the "/" scope.
-	// Partial support for multiple location contexts already
-	// exists at the parser and config levels, but until full
-	// support is implemented, this is all we do right here.
 	vh.compile(vh.config.Middleware["/"])
 
 	return nil
 }
 
 // compile is an elegant alternative to nesting middleware function
-// calls like handler1(handler2(handler3(finalHandler))).
+// calls like handler1(handler2(handler3(finalHandler))). Each request
+// takes the chain of the longest path scope in vh.config.Middleware
+// that it is under on its way to the file server, or layers, those
+// of the site, if it is under none. The guards of the site go on top
+// of all of them.
 func (vh *virtualHost) compile(layers []middleware.Middleware) {
-	vh.stack = vh.fileServer // core app layer
+	fileServer := vh.fileServer // core app layer
+	if vh.config.TraceMiddleware {
+		fileServer = middleware.TraceHandler(fileServer)
+	}
+
+	next := vh.chain(layers, fileServer)
+	if len(vh.config.Middleware) > 1 {
+		router := &scopeRouter{next: next, chains: make(map[string]middleware.Handler)}
+		for scope, scoped := range vh.config.Middleware {
+			if scope == "/" {
+				continue
+			}
+			// A block with several paths gives each the same layers,
+			// which are built again for each path into the same chain
+			router.scopes = append(router.scopes, scope)
+			router.chains[scope] = vh.chain(scoped, fileServer)
+		}
+		router.sort()
+		next = router
+	}
+	vh.stack = vh.chain(vh.config.Guards, next)
+}
+
+// chain builds layers on top of next, which is the handler that
+// requests reach if they go through all of them.
+//
+// The innermost layers, such as proxy, fastcgi or templates, usually
+// only act on requests under certain paths. Below the first layer up
+// the stack that isn't middleware.Scoped (or on top, if all of them
+// are), chain inserts a fast path that sends all other requests
+// straight to next. Whether a layer is scoped is only known once it
+// has been built, so each layer in the scoped run gets a fork; all
+// but the last pass through.
+func (vh *virtualHost) chain(layers []middleware.Middleware, next middleware.Handler) middleware.Handler {
+	stack := next
+
+	var scopes []string
+	scoped := true
 	for i := len(layers) - 1; i >= 0; i-- {
-		vh.stack = layers[i](vh.stack)
+		below := stack
+		var fork *staticFastPath
+		if scoped && i < len(layers)-1 {
+			fork = &staticFastPath{
+				next:       stack,
+				fileServer: next,
+				scopes:     append([]string(nil), scopes...),
+			}
+			below = fork
+		}
+
+		h := layers[i](below)
+		if s, ok := h.(middleware.Scoped); ok && scoped {
+			scopes = append(scopes, s.Scopes()...)
+			if fork != nil {
+				fork.passThrough = true
+			}
+		} else {
+			scoped = false
+		}
+
+		stack = h
+		if vh.config.TraceMiddleware {
+			stack = middleware.TraceHandler(stack)
+		}
+	}
+	if scoped && len(layers) > 0 {
+		stack = &staticFastPath{next: stack, fileServer: next, scopes: scopes}
+	}
+	return stack
+}
+
+// close releases the resources held by the virtual host
+// once it is no longer serving.
+func (vh *virtualHost) close() {
+	if vh.mem != nil {
+		vh.mem.Close()
+	}
+	if vh.files != nil {
+		vh.files.Close()
+	}
+}
+
+// publish makes the virtual host known to the admin API.
+func (vh *virtualHost) publish() {
+	for _, f := range vh.config.Publish {
+		f()
+	}
+}
+
+// unpublish makes the admin API forget the virtual host.
+func (vh *virtualHost) unpublish() {
+	for _, f := range vh.config.Unpublish {
+		f()
 	}
 }
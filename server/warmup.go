@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// WarmupTimeout is how long each warm-up request may take.
+var WarmupTimeout = 30 * time.Second
+
+// warmth tells whether a virtual host's warm-up requests,
+// if it has any, are done.
+type warmth struct {
+	done int32
+}
+
+func (w *warmth) warmed() bool {
+	return atomic.LoadInt32(&w.done) == 1
+}
+
+func (w *warmth) finish() {
+	atomic.StoreInt32(&w.done, 1)
+}
+
+// warmup requests the warm-up paths of each of vhosts from the
+// server itself, one at a time, so caches are filled and upstream
+// connections are open before the sites are reported ready.
+// Requests that fail are logged, but don't keep a site from
+// being ready.
+func (s *Server) warmup(vhosts []virtualHost) {
+	for _, vh := range vhosts {
+		for _, path := range vh.config.Warmup {
+			status, err := s.warmupRequest(vh.config, path)
+			if err != nil {
+				log.Printf("[WARNING] Warming up %s%s: %v", vh.config.Address(), path, err)
+			} else if status >= 400 {
+				log.Printf("[WARNING] Warming up %s%s: got status %d", vh.config.Address(), path, status)
+			}
+		}
+		vh.warm.finish()
+	}
+}
+
+// warmupRequest serves a GET request for path on the site of
+// conf, and returns the response's status code.
+func (s *Server) warmupRequest(conf Config, path string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), WarmupTimeout)
+	defer cancel()
+	r, err := http.NewRequestWithContext(ctx, "GET", "http://"+conf.Address()+path, nil)
+	if err != nil {
+		return 0, err
+	}
+	r.Host = conf.Host
+	r.RemoteAddr = "127.0.0.1:0"
+	r.Header.Set("User-Agent", conf.AppName+" warm-up")
+
+	w := &discardWriter{header: make(http.Header)}
+	s.ServeHTTP(w, r)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.status, nil
+}
+
+// Warming returns the addresses of the sites of s whose
+// warm-up requests aren't done yet.
+func (s *Server) Warming() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var warming []string
+	for _, vh := range s.vhosts {
+		if !vh.warm.warmed() {
+			warming = append(warming, vh.config.Address())
+		}
+	}
+	return warming
+}
+
+// discardWriter is a ResponseWriter that only
+// keeps the status code of the response.
+type discardWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/middleware"
+)
+
+func TestWarmup(t *testing.T) {
+	var mu sync.Mutex
+	var requested []string
+	record := func(next middleware.Handler) middleware.Handler {
+		return middleware.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			mu.Lock()
+			requested = append(requested, r.Host+r.URL.Path)
+			mu.Unlock()
+			if r.URL.Path == "/missing" {
+				return http.StatusNotFound, nil
+			}
+			return http.StatusOK, nil
+		})
+	}
+	conf := func(paths ...string) Config {
+		return Config{
+			Host: "a.com", Port: "80", Root: ".", ConfigFile: "a.conf",
+			Middleware: map[string][]middleware.Middleware{"/": {record}},
+			Warmup:     paths,
+		}
+	}
+
+	s, err := New("localhost:0", []Config{conf("/", "/missing")})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if warming := s.Warming(); len(warming) != 1 || warming[0] != "a.com:80" {
+		t.Errorf("Expected a.com:80 to be warming up before serving, got %v", warming)
+	}
+	s.warmup([]virtualHost{s.vhosts["a.com"]})
+	if warming := s.Warming(); len(warming) != 0 {
+		t.Errorf("Expected no site warming up after the warm-up, got %v", warming)
+	}
+	if len(requested) != 2 || requested[0] != "a.com/" || requested[1] != "a.com/missing" {
+		t.Errorf("Expected the warm-up paths to be requested in order, got %v", requested)
+	}
+
+	// sites swapped in by a reload are warmed up when committed
+	requested = nil
+	r, err := s.ReplaceFile("a.conf", []Config{conf("/reloaded")})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if warming := s.Warming(); len(warming) != 1 {
+		t.Errorf("Expected the new site to be warming up, got %v", warming)
+	}
+	r.Commit()
+	deadline := time.Now().Add(time.Second)
+	for len(s.Warming()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if warming := s.Warming(); len(warming) != 0 {
+		t.Errorf("Expected the new site to be warmed up after the commit, got %v", warming)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requested) != 1 || requested[0] != "a.com/reloaded" {
+		t.Errorf("Expected the new site's warm-up path to be requested, got %v", requested)
+	}
+
+	// sites without warm-up paths are ready right away
+	s, err = New("localhost:0", []Config{conf()})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if warming := s.Warming(); len(warming) != 0 {
+		t.Errorf("Expected no site warming up, got %v", warming)
+	}
+}